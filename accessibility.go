@@ -0,0 +1,227 @@
+package mail
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// The lowest contrast ratio WCAG 2 (level AA) allows for normal text.
+const minContrast = 4.5
+
+// An HTML body with images and fewer than this many characters of text is
+// considered to consist of images only.
+const minImageOnlyText = 40
+
+// Colors by CSS name, as red, green and blue from 0 to 255. Only the
+// commonest names are known.
+var cssColors = map[string][3]int{
+	"black": {0, 0, 0}, "white": {255, 255, 255}, "gray": {128, 128, 128},
+	"grey": {128, 128, 128}, "silver": {192, 192, 192}, "red": {255, 0, 0},
+	"maroon": {128, 0, 0}, "yellow": {255, 255, 0}, "olive": {128, 128, 0},
+	"lime": {0, 255, 0}, "green": {0, 128, 0}, "aqua": {0, 255, 255},
+	"cyan": {0, 255, 255}, "teal": {0, 128, 128}, "blue": {0, 0, 255},
+	"navy": {0, 0, 128}, "fuchsia": {255, 0, 255}, "magenta": {255, 0, 255},
+	"purple": {128, 0, 128}, "orange": {255, 165, 0},
+	"lightgray": {211, 211, 211}, "lightgrey": {211, 211, 211},
+	"darkgray": {169, 169, 169}, "darkgrey": {169, 169, 169},
+}
+
+// Reports HTML bodies which do not say what language they are in.
+func lintLanguage(c *lintContext) {
+	if cl := c.part.Header.ContentLanguage(); cl != nil && len(cl.Languages) > 0 {
+		return
+	}
+	for _, t := range c.tokens {
+		if (t.t == htmlStartTagToken || t.t == htmlSelfClosingTagToken) &&
+			(t.tag == "html" || t.tag == "body") {
+			if lang, _ := t.attr("lang"); strings.TrimSpace(lang) != "" {
+				return
+			}
+		}
+	}
+	c.add(DiagnosticMissingLang, SeverityWarning,
+		"add a lang attribute to the html element, e.g. <html lang=\"en\">, "+
+			"so that screen readers pronounce the text correctly")
+}
+
+// Reports headings which skip a level, e.g. an h4 following an h2.
+func lintHeadings(c *lintContext) {
+	last := 0
+	for _, t := range c.tokens {
+		if t.t != htmlStartTagToken || len(t.tag) != 2 || t.tag[0] != 'h' ||
+			t.tag[1] < '1' || t.tag[1] > '6' {
+			continue
+		}
+		level := int(t.tag[1] - '0')
+		if last > 0 && level > last+1 {
+			c.add(DiagnosticHeadingOrder, SeverityWarning,
+				"h%d follows h%d; do not skip heading levels, since screen reader "+
+					"users navigate by them", level, last)
+		}
+		last = level
+	}
+}
+
+// Reports text whose color contrasts too little with its background. The
+// colors are taken from color, background-color and background in style
+// attributes, and from the color and bgcolor attributes, and are inherited
+// as in a browser. The background defaults to white and the text to black.
+func lintContrast(c *lintContext) {
+	type colors struct {
+		tag    string
+		fg, bg [3]int
+	}
+	stack := []colors{{fg: [3]int{0, 0, 0}, bg: [3]int{255, 255, 255}}}
+	for _, t := range c.tokens {
+		switch t.t {
+		case htmlStartTagToken, htmlSelfClosingTagToken:
+			if t.t == htmlSelfClosingTagToken || isVoidElement(t.tag) {
+				continue
+			}
+			top := stack[len(stack)-1]
+			next := colors{tag: t.tag, fg: top.fg, bg: top.bg}
+			if v, ok := t.attr("color"); ok {
+				if rgb, ok := parseCSSColor(v); ok {
+					next.fg = rgb
+				}
+			}
+			if v, ok := t.attr("bgcolor"); ok {
+				if rgb, ok := parseCSSColor(v); ok {
+					next.bg = rgb
+				}
+			}
+			if style, ok := t.attr("style"); ok {
+				for _, d := range parseCSSDeclarations(style) {
+					switch d.property {
+					case "color":
+						if rgb, ok := parseCSSColor(d.value); ok {
+							next.fg = rgb
+						}
+					case "background-color", "background":
+						if rgb, ok := parseCSSColor(d.value); ok {
+							next.bg = rgb
+						}
+					}
+				}
+			}
+			stack = append(stack, next)
+		case htmlEndTagToken:
+			for i := len(stack) - 1; i > 0; i-- {
+				if stack[i].tag == t.tag {
+					stack = stack[:i]
+					break
+				}
+			}
+		case htmlTextToken:
+			top := stack[len(stack)-1]
+			if strings.TrimSpace(htmlUnescape(t.raw)) == "" || top.tag == "style" ||
+				top.tag == "script" || top.tag == "title" {
+				continue
+			}
+			if ratio := contrastRatio(top.fg, top.bg); ratio < minContrast {
+				c.add(DiagnosticLowContrast, SeverityWarning,
+					"text colored %s on %s has a contrast ratio of %.1f:1; "+
+						"use at least %.1f:1 so that it can be read", hexColor(top.fg),
+					hexColor(top.bg), ratio, minContrast)
+			}
+		}
+	}
+}
+
+// Reports HTML bodies which consist of images with hardly any text, which
+// screen readers and clients that block images cannot show.
+func lintImageOnly(c *lintContext) {
+	images := 0
+	for _, t := range c.tokens {
+		if (t.t == htmlStartTagToken || t.t == htmlSelfClosingTagToken) && t.tag == "img" {
+			images++
+		}
+	}
+	if images == 0 {
+		return
+	}
+	text := strings.Join(strings.Fields(htmlToText(c.part.Text)), " ")
+	if n := len([]rune(text)); n < minImageOnlyText {
+		c.add(DiagnosticImageOnly, SeverityWarning,
+			"the body consists of %d image(s) and only %d characters of text; "+
+				"put the message in text, since many readers will not see the images",
+			images, n)
+	}
+}
+
+// Parses the CSS color \a s, e.g. "#fff", "#1a2b3c", "rgb(10, 20, 30)" or
+// "navy", and returns it and true, or false if it cannot be parsed. Only the
+// first word of \a s is considered, so that the value of a background
+// shorthand property can be passed.
+func parseCSSColor(s string) ([3]int, bool) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if strings.HasPrefix(s, "rgb(") || strings.HasPrefix(s, "rgba(") {
+		end := strings.IndexByte(s, ')')
+		if end < 0 {
+			return [3]int{}, false
+		}
+		parts := strings.Split(s[strings.IndexByte(s, '(')+1:end], ",")
+		if len(parts) < 3 {
+			return [3]int{}, false
+		}
+		var rgb [3]int
+		for i := 0; i < 3; i++ {
+			n, err := strconv.Atoi(strings.TrimSpace(parts[i]))
+			if err != nil || n < 0 || n > 255 {
+				return [3]int{}, false
+			}
+			rgb[i] = n
+		}
+		return rgb, true
+	}
+	if f := strings.Fields(s); len(f) > 0 {
+		s = f[0]
+	}
+	if rgb, ok := cssColors[s]; ok {
+		return rgb, true
+	}
+	s = strings.TrimPrefix(s, "#")
+	if len(s) == 3 {
+		s = string([]byte{s[0], s[0], s[1], s[1], s[2], s[2]})
+	}
+	if len(s) != 6 {
+		return [3]int{}, false
+	}
+	n, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return [3]int{}, false
+	}
+	return [3]int{int(n >> 16), int(n >> 8 & 0xff), int(n & 0xff)}, true
+}
+
+// Returns the WCAG 2 contrast ratio of the colors \a a and \a b, from 1 to
+// 21.
+func contrastRatio(a, b [3]int) float64 {
+	la := relativeLuminance(a)
+	lb := relativeLuminance(b)
+	if la < lb {
+		la, lb = lb, la
+	}
+	return (la + 0.05) / (lb + 0.05)
+}
+
+// Returns the WCAG 2 relative luminance of \a rgb, from 0 to 1.
+func relativeLuminance(rgb [3]int) float64 {
+	var l [3]float64
+	for i, c := range rgb {
+		v := float64(c) / 255
+		if v <= 0.03928 {
+			l[i] = v / 12.92
+		} else {
+			l[i] = math.Pow((v+0.055)/1.055, 2.4)
+		}
+	}
+	return 0.2126*l[0] + 0.7152*l[1] + 0.0722*l[2]
+}
+
+// Returns \a rgb in the form #rrggbb.
+func hexColor(rgb [3]int) string {
+	return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2])
+}
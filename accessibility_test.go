@@ -0,0 +1,30 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestLintAccessibility(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "Hello"
+	c.HTML = "<body lang=\"de\" bgcolor=\"#333\"><h1>Hallo</h1><h3 style=\"color: #fff\">Neu</h3>" +
+		"<p style=\"color: #444\">Dunkel auf dunkel, <span style=\"background: yellow url(x.png)\">" +
+		"schwarz auf gelb</span></p><h2>Ende</h2></body>"
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{}
+	for _, d := range m.Lint() {
+		codes = append(codes, d.Code+": "+d.Message)
+	}
+	testStringEquals(t, "diagnostics", strings.Join(codes, "\n"),
+		"unsupported-css: background images are not shown by Outlook; give the element a background color too\n"+
+			"heading-order: h3 follows h1; do not skip heading levels, since screen reader users navigate by them\n"+
+			"low-contrast: text colored #000000 on #333333 has a contrast ratio of 1.7:1; use at least 4.5:1 so that it can be read\n"+
+			"low-contrast: text colored #444444 on #333333 has a contrast ratio of 1.3:1; use at least 4.5:1 so that it can be read")
+}
@@ -174,7 +174,7 @@ func (a *Address) localpartIsSensible() bool {
 	for i < len(a.Localpart) {
 		c := a.Localpart[i]
 		if c == '.' {
-			if a.Localpart[i+1] == '.' {
+			if i+1 == len(a.Localpart) || a.Localpart[i+1] == '.' {
 				return false
 			}
 		} else if !((c >= 'a' && c <= 'z') ||
@@ -454,7 +454,7 @@ func (p *AddressParser) findBorder(left, right int) int {
 					if !(c >= 'a' && c <= 'z') &&
 						!(c >= 'A' && c <= 'Z') &&
 						!(c >= '0' && c <= '9') {
-						if strings.ToLower(p.s[b:l]) == tld {
+						if strings.ToLower(p.s[b:b+l]) == tld {
 							return b + l
 						}
 					}
@@ -518,7 +518,7 @@ func (p *AddressParser) add(name, localpart, domain string) {
 	}
 	// anti-outlook hackery, step 1: remove extra surrounding quotes
 	i := 0
-	for i < len(name)-1 &&
+	for i < len(name)-1-i &&
 		(name[i] == name[len(name)-1-i] &&
 			(name[i] == '\'' || name[i] == '"')) {
 		i++
@@ -607,7 +607,7 @@ func (p *AddressParser) address(i int) int {
 		var dom string
 		dom, i = p.domain(i)
 		var lp, name string
-		if s[i] == '<' {
+		if i < 0 || s[i] == '<' {
 			lp = dom
 			dom = ""
 		} else {
@@ -657,7 +657,7 @@ func (p *AddressParser) address(i int) int {
 					name = buf.String()
 				} else {
 					lp, i = p.localpart(i)
-					if s[i] != '<' {
+					if i >= 0 && s[i] != '<' {
 						j := i
 						for j >= 0 &&
 							((s[j] >= 'a' && s[j] <= 'z') ||
@@ -713,14 +713,14 @@ func (p *AddressParser) address(i int) int {
 		i -= 3
 		var dom string
 		dom, i = p.domain(i)
-		if s[i] == '@' {
+		if i >= 0 && s[i] == '@' {
 			i--
 			for i > 0 && s[i] == '@' {
 				i--
 			}
 			var lp string
 			lp, i = p.localpart(i)
-			if s[i] == '<' {
+			if i >= 0 && s[i] == '<' {
 				i--
 				_, i = p.atom(i) // discard the "supplied" display-name
 				p.add("", lp, dom)
@@ -745,14 +745,14 @@ func (p *AddressParser) address(i int) int {
 				p.setError("Parsing stopped while in group parser", i)
 				return i
 			}
-			if s[i] == ',' {
+			if i >= 0 && s[i] == ',' {
 				i--
-			} else if s[i] != ':' {
+			} else if i < 0 || s[i] != ':' {
 				p.setError("Expected : or ',' while parsing group", i)
 				return i
 			}
 		}
-		if s[i] == ':' {
+		if i >= 0 && s[i] == ':' {
 			i--
 			var name string
 			name, i = p.phrase(i)
@@ -951,6 +951,9 @@ func (p *AddressParser) ccontent(i int) int {
 			i--
 		} else if p.s[i] == ')' {
 			i = p.comment(i)
+			if i < 0 {
+				return 0
+			}
 		} else if p.s[i] == '(' {
 			return i
 		}
@@ -972,8 +975,8 @@ func unqp(s string) string {
 		if s[j] == ' ' || s[j] == 9 ||
 			s[j] == 10 || s[j] == 13 {
 			sp = true
-			for s[j] == ' ' || s[j] == 9 ||
-				s[j] == 10 || s[j] == 13 {
+			for j < len(s) && (s[j] == ' ' || s[j] == 9 ||
+				s[j] == 10 || s[j] == 13) {
 				j++
 			}
 		} else {
@@ -981,7 +984,7 @@ func unqp(s string) string {
 				buf.WriteByte(' ')
 				sp = false
 			}
-			if s[j] == '\\' {
+			if s[j] == '\\' && j+1 < len(s) {
 				j++
 				buf.WriteByte(s[j])
 				j++
@@ -1017,7 +1020,7 @@ func (p *AddressParser) domain(i int) (string, int) {
 		// scan for an unquoted IPv4 address and turn that into an
 		// address literal if found.
 		j := i
-		for (p.s[i] >= '0' && p.s[i] <= '9') || p.s[i] == '.' {
+		for i >= 0 && ((p.s[i] >= '0' && p.s[i] <= '9') || p.s[i] == '.') {
 			i--
 		}
 		test := net.ParseIP(p.s[i+1 : j+1])
@@ -1116,10 +1119,14 @@ func (p *AddressParser) phrase(i int) (string, int) {
 					progressing = false
 				}
 			}
+			start := i
 			if i < 0 || p.s[i] != '"' {
 				p.setError("quoted phrase must begin with '\"'", i)
+				if start < 0 {
+					start = 0
+				}
 			}
-			w := unquote(p.s[i:j+1], '"', '\'')
+			w := unquote(p.s[start:j+1], '"', '\'')
 			l := 0
 			for l >= 0 && l < len(w) && !drop {
 				b := strings.Index(w[l:], "=?")
@@ -1222,7 +1229,7 @@ func (p *AddressParser) localpart(i int) (string, int) {
 		more = false
 	}
 	atomOnly := true
-	for more {
+	for more && i >= 0 {
 		w := ""
 		if p.s[i] == '"' {
 			atomOnly = false
@@ -1238,7 +1245,7 @@ func (p *AddressParser) localpart(i int) (string, int) {
 		if i >= 0 && p.s[i] == '.' {
 			s = p.s[i : i+1]
 			i--
-		} else if strings.HasPrefix(w, "%") {
+		} else if i >= 0 && strings.HasPrefix(w, "%") {
 			s = ""
 		} else {
 			more = false
@@ -1287,7 +1294,7 @@ func (p *AddressParser) setError(s string, i int) {
 	if i > 8 {
 		start = i - 8
 	}
-	end := 20
+	end := start + 20
 	if end > len(p.s) {
 		end = len(p.s)
 	}
@@ -0,0 +1,93 @@
+package mail
+
+// An AlternativeScorer rates \a p, one of the children of a
+// multipart/alternative, so that the best suited can be chosen: the one with
+// the highest score, and of those with the same score, the last, since RFC
+// 2046 orders alternatives from the plainest to the richest. An alternative
+// with a negative score is never chosen.
+//
+// PreferHTML, PreferPlain and PreferCalendar suit common needs; a scorer of
+// one's own may use AlternativeType() to see what an alternative holds.
+type AlternativeScorer func(p *Part) int
+
+// Prefers HTML to plain text, and either to anything else.
+func PreferHTML(p *Part) int {
+	switch p.AlternativeType() {
+	case "text/html":
+		return 2
+	case "text/plain":
+		return 1
+	}
+	return 0
+}
+
+// Prefers plain text to HTML, and either to anything else.
+func PreferPlain(p *Part) int {
+	switch p.AlternativeType() {
+	case "text/plain":
+		return 2
+	case "text/html":
+		return 1
+	}
+	return 0
+}
+
+// Prefers a calendar object (text/calendar, as in meeting invitations), then
+// HTML, then plain text.
+func PreferCalendar(p *Part) int {
+	if p.AlternativeType() == "text/calendar" {
+		return 3
+	}
+	return PreferHTML(p)
+}
+
+// Returns the content type of what this alternative holds, as
+// "type/subtype": for a multipart/related, that of its root; for another
+// multipart, that of its first child; for anything else, its own.
+func (p *Part) AlternativeType() string {
+	if len(p.Parts) > 0 && p.message == nil {
+		if root := p.RelatedRoot(); root != nil {
+			return root.AlternativeType()
+		}
+		return p.Parts[0].AlternativeType()
+	}
+	if ct := p.contentType(); ct != "" {
+		return ct
+	}
+	return p.defaultContentType()
+}
+
+// Returns the child of this multipart/alternative which \a score rates
+// highest, as described for AlternativeScorer, or nil if this is not a
+// multipart/alternative or \a score rejects all children.
+func (p *Part) Alternative(score AlternativeScorer) *Part {
+	if p.contentType() != "multipart/alternative" {
+		return nil
+	}
+	return bestAlternative(p.Parts, score)
+}
+
+// Returns the last of \a parts with the highest score that is not
+// negative, or nil.
+func bestAlternative(parts []*Part, score AlternativeScorer) *Part {
+	var best *Part
+	high := 0
+	for _, c := range parts {
+		if s := score(c); s >= 0 && (best == nil || s >= high) {
+			best, high = c, s
+		}
+	}
+	return best
+}
+
+// Returns the bodypart which should be displayed as the body of this
+// message, choosing among alternatives with \a score, or nil if there is
+// none. The body is always text/plain or text/html; alternatives which
+// hold neither, e.g. calendar objects, are only considered by
+// Part.Alternative().
+func (m *Message) DisplayBody(score AlternativeScorer) *Part {
+	if m.Part == nil {
+		return nil
+	}
+	return m.Part.displayBody(score)
+}
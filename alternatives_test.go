@@ -0,0 +1,46 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAlternativeSelection(t *testing.T) {
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=alt\r\n" +
+		"\r\n--alt\r\n" +
+		"Content-Type: text/plain\r\n\r\nPlain invitation\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/calendar; method=REQUEST\r\n\r\nBEGIN:VCALENDAR\r\nEND:VCALENDAR\r\n" +
+		"--alt\r\n" +
+		"Content-Type: multipart/related; boundary=rel\r\n" +
+		"\r\n--rel\r\n" +
+		"Content-Type: text/html\r\n\r\n<p>HTML invitation\r\n" +
+		"--rel--\r\n" +
+		"--alt--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "html", m.Part.Alternative(mail.PreferHTML).AlternativeType(), "text/html")
+	testStringEquals(t, "plain", m.Part.Alternative(mail.PreferPlain).AlternativeType(), "text/plain")
+	testStringEquals(t, "calendar", m.Part.Alternative(mail.PreferCalendar).AlternativeType(),
+		"text/calendar")
+	testStringEquals(t, "display html", m.DisplayBody(mail.PreferHTML).Text, "<p>HTML invitation\r\n")
+	testStringEquals(t, "display calendar", m.DisplayBody(mail.PreferCalendar).Text,
+		"<p>HTML invitation\r\n")
+
+	noHTML := func(p *mail.Part) int {
+		if p.AlternativeType() == "text/html" {
+			return -1
+		}
+		return 0
+	}
+	testStringEquals(t, "custom", m.Part.Alternative(noHTML).AlternativeType(), "text/calendar")
+	testStringEquals(t, "display custom", m.DisplayBody(noHTML).Text, "Plain invitation\r\n")
+	if m.Parts[0].Alternative(mail.PreferHTML) != nil {
+		t.Error("a text/plain part has an alternative")
+	}
+}
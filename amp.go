@@ -0,0 +1,68 @@
+package mail
+
+import (
+	"strings"
+)
+
+// The content type of the AMP for Email alternative.
+const AMPContentType = "text/x-amp-html"
+
+// The largest AMP document mail providers display, in bytes.
+const maxAMPSize = 200 * 1024
+
+// Returns the AMP for Email document of this message, i.e. the text of its
+// first text/x-amp-html bodypart outside embedded messages, or an empty
+// string if it has none.
+//
+// Since AMP documents expire and are only shown by some clients, the
+// message's DisplayBody() is never the AMP document; it is the HTML or
+// plain text alternative.
+func (m *Message) AMPBody() string {
+	if m.Part == nil {
+		return ""
+	}
+	var amp *Part
+	var search func(p *Part)
+	search = func(p *Part) {
+		if amp != nil || p != m.Part && p.message != nil {
+			return
+		}
+		if len(p.Parts) == 0 && p.contentType() == AMPContentType {
+			amp = p
+		}
+		for _, c := range p.Parts {
+			search(c)
+		}
+	}
+	search(m.Part)
+	if amp == nil {
+		return ""
+	}
+	return amp.Text
+}
+
+// Checks the AMP for Email document \a amp against the basic requirements of
+// the AMP for Email specification, and returns an error matching
+// ErrInvalidAMP describing the first problem found, or nil. It does not
+// validate the document fully; that needs the AMP validator.
+func checkAMP(amp string) error {
+	lower := strings.ToLower(amp)
+	html := strings.Index(lower, "<html")
+	end := -1
+	if html >= 0 {
+		end = strings.IndexByte(lower[html:], '>')
+	}
+	switch {
+	case len(amp) > maxAMPSize:
+		return wrapError(ErrInvalidAMP, "mail: AMP document is %d bytes, more than %d",
+			len(amp), maxAMPSize)
+	case end < 0 || !strings.Contains(lower[html:html+end], "⚡4email") &&
+		!strings.Contains(lower[html:html+end], "amp4email"):
+		return wrapError(ErrInvalidAMP, "mail: AMP document's html element lacks the amp4email attribute")
+	case !strings.Contains(lower, "https://cdn.ampproject.org/v0.js"):
+		return wrapError(ErrInvalidAMP, "mail: AMP document does not load the AMP runtime")
+	case !strings.Contains(lower, "amp4email-boilerplate"):
+		return wrapError(ErrInvalidAMP, "mail: AMP document lacks the amp4email-boilerplate style")
+	}
+	return nil
+}
@@ -0,0 +1,47 @@
+package mail_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAMP(t *testing.T) {
+	amp := "<!doctype html>\n<html ⚡4email data-css-strict>\n<head><meta charset=\"utf-8\">\n" +
+		"<script async src=\"https://cdn.ampproject.org/v0.js\"></script>\n" +
+		"<style amp4email-boilerplate>body{visibility:hidden}</style>\n" +
+		"</head><body>Live order status</body></html>\n"
+	c := mail.NewComposer()
+	c.Header.Add("From", "shop@example.com")
+	c.Header.Add("To", "bob@example.com")
+	c.Text = "Your order has shipped.\n"
+	c.HTML = "<p>Your order has shipped.</p>\n"
+	c.AMP = amp
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := []string{}
+	for _, p := range m.Parts {
+		types = append(types, p.AlternativeType())
+	}
+	testStringEquals(t, "order", strings.Join(types, " "), "text/plain text/x-amp-html text/html")
+	testStringEquals(t, "amp body", m.AMPBody(), strings.Replace(amp, "\n", "\r\n", -1))
+	testStringEquals(t, "display", m.DisplayBody(mail.PreferHTML).Text,
+		"<p>Your order has shipped.</p>\r\n")
+
+	c.AMP = "<html><body>Not AMP</body></html>"
+	if _, err := c.Compose(); !errors.Is(err, mail.ErrInvalidAMP) {
+		t.Errorf("expected ErrInvalidAMP, got %v", err)
+	}
+	c.AMP, c.Text, c.HTML = amp, "", ""
+	if _, err := c.Compose(); !errors.Is(err, mail.ErrInvalidAMP) {
+		t.Errorf("expected ErrInvalidAMP without a fallback, got %v", err)
+	}
+}
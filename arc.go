@@ -0,0 +1,283 @@
+package mail
+
+import (
+	"crypto"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	// The fields of an ARC set (RFC 8617), and the field they record.
+	ARCSealFieldName                  = "ARC-Seal"
+	ARCMessageSignatureFieldName      = "ARC-Message-Signature"
+	ARCAuthenticationResultsFieldName = "ARC-Authentication-Results"
+	AuthenticationResultsFieldName    = "Authentication-Results"
+)
+
+// The largest number of ARC sets a message may carry (RFC 8617 section
+// 4.2.1).
+const maxARCInstances = 50
+
+// An ARCResult is the outcome of validating a message's ARC chain.
+//
+// Result is "none" if the message has no ARC sets, "pass" if the chain is
+// intact, and "fail" otherwise, in which case Err says why. Instances is the
+// number of ARC sets, and Sealers the domains which sealed them, oldest
+// first.
+type ARCResult struct {
+	Result    string
+	Err       error
+	Instances int
+	Sealers   []string
+}
+
+// Returns a description of this result in the form used in
+// Authentication-Results, e.g. "arc=pass".
+func (r *ARCResult) String() string {
+	s := "arc=" + r.Result
+	if r.Err != nil && r.Result != "pass" {
+		s += " (" + r.Err.Error() + ")"
+	}
+	return s
+}
+
+// The three fields of one ARC set, each without its final CRLF.
+type arcSet struct {
+	aar string
+	ams string
+	as  string
+}
+
+// Returns the instance (i=) of the ARC field \a field, or an error.
+func arcInstance(field string) (int, error) {
+	value := field[strings.IndexByte(field, ':')+1:]
+	if semi := strings.IndexByte(value, ';'); semi >= 0 {
+		value = value[:semi]
+	}
+	eq := strings.IndexByte(value, '=')
+	if eq < 0 || strings.TrimSpace(value[:eq]) != "i" {
+		return 0, errors.New("mail: ARC field lacks i=")
+	}
+	i, err := strconv.Atoi(strings.TrimSpace(value[eq+1:]))
+	if err != nil || i < 1 || i > maxARCInstances {
+		return 0, fmt.Errorf("mail: bad ARC instance %q", strings.TrimSpace(value[eq+1:]))
+	}
+	return i, nil
+}
+
+// Returns the ARC sets in \a fields, ordered by instance, or an error if
+// any set is incomplete, duplicated or missing.
+func arcSets(fields []string) ([]arcSet, error) {
+	sets := map[int]*arcSet{}
+	max := 0
+	for _, f := range fields {
+		var slot func(s *arcSet) *string
+		switch rawFieldName(f) {
+		case "arc-authentication-results":
+			slot = func(s *arcSet) *string { return &s.aar }
+		case "arc-message-signature":
+			slot = func(s *arcSet) *string { return &s.ams }
+		case "arc-seal":
+			slot = func(s *arcSet) *string { return &s.as }
+		default:
+			continue
+		}
+		i, err := arcInstance(f)
+		if err != nil {
+			return nil, err
+		}
+		if sets[i] == nil {
+			sets[i] = &arcSet{}
+		}
+		p := slot(sets[i])
+		if *p != "" {
+			return nil, fmt.Errorf("mail: duplicate %s for ARC instance %d",
+				strings.TrimSpace(f[:strings.IndexByte(f, ':')]), i)
+		}
+		*p = f
+		if i > max {
+			max = i
+		}
+	}
+	r := []arcSet{}
+	for i := 1; i <= max; i++ {
+		s := sets[i]
+		if s == nil || s.aar == "" || s.ams == "" || s.as == "" {
+			return nil, fmt.Errorf("mail: ARC set %d is incomplete", i)
+		}
+		r = append(r, *s)
+	}
+	return r, nil
+}
+
+// Validates the ARC chain in \a rfc5322 (RFC 8617 section 5.2), looking up
+// keys as Verify() does.
+func (v *DKIMVerifier) VerifyARC(rfc5322 string) *ARCResult {
+	rfc5322 = NormalizeLineEndings(rfc5322, "\r\n")
+	fields, body := splitRawMessage(rfc5322)
+	r := &ARCResult{Result: "fail"}
+	sets, err := arcSets(fields)
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Instances = len(sets)
+	if len(sets) == 0 {
+		r.Result = "none"
+		return r
+	}
+
+	seals := make([]map[string]string, len(sets))
+	for i, s := range sets {
+		tags, err := parseDKIMTags(s.as[strings.IndexByte(s.as, ':')+1:])
+		if err != nil {
+			r.Err = err
+			return r
+		}
+		want := "pass"
+		if i == 0 {
+			want = "none"
+		}
+		if strings.ToLower(tags["cv"]) != want {
+			r.Err = fmt.Errorf("mail: ARC-Seal %d has cv=%s", i+1, tags["cv"])
+			return r
+		}
+		seals[i] = tags
+		r.Sealers = append(r.Sealers, tags["d"])
+	}
+
+	ams := v.verify(sets[len(sets)-1].ams, fields, body, true)
+	if ams.Result != "pass" {
+		r.Err = fmt.Errorf("mail: ARC-Message-Signature %d: %v", len(sets), ams.Err)
+		return r
+	}
+	for i := len(sets); i > 0; i-- {
+		if err := v.checkSeal(sets[:i], seals[i-1]); err != nil {
+			r.Err = fmt.Errorf("mail: ARC-Seal %d: %v", i, err)
+			return r
+		}
+	}
+	r.Result = "pass"
+	return r
+}
+
+// Returns the data signed by the ARC-Seal of the last of \a sets: all the
+// sets' fields, canonicalized by the "relaxed" algorithm, with the b= value
+// of that seal removed.
+func arcSealData(sets []arcSet) string {
+	var buf strings.Builder
+	for i, s := range sets {
+		buf.WriteString(relaxedHeaderField(s.aar) + crlf)
+		buf.WriteString(relaxedHeaderField(s.ams) + crlf)
+		if i < len(sets)-1 {
+			buf.WriteString(relaxedHeaderField(s.as) + crlf)
+		} else {
+			buf.WriteString(relaxedHeaderField(withoutDKIMSignature(s.as)))
+		}
+	}
+	return buf.String()
+}
+
+// Checks the ARC-Seal of the last of \a sets, whose tags are \a tags.
+func (v *DKIMVerifier) checkSeal(sets []arcSet, tags map[string]string) error {
+	for _, t := range []string{"a", "b", "d", "s"} {
+		if _, ok := tags[t]; !ok {
+			return fmt.Errorf("mail: ARC-Seal lacks %s=", t)
+		}
+	}
+	if _, ok := tags["h"]; ok {
+		return errors.New("mail: ARC-Seal has h=")
+	}
+	key, err := v.publicKey(tags["s"], tags["d"])
+	if err != nil {
+		return err
+	}
+	want, err := dkimKeyAlgorithm(key)
+	if err != nil || strings.ToLower(tags["a"]) != want {
+		return errors.New("mail: ARC-Seal algorithm " + tags["a"] +
+			" is not supported or does not match the key")
+	}
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		return errors.New("mail: bad ARC-Seal b=")
+	}
+	return dkimCheck(key, arcSealData(sets), b)
+}
+
+// An ARCSealer adds ARC sets to messages, as an intermediary which has
+// authenticated a message and may modify it (RFC 8617).
+//
+// Domain, Selector and Key are as for a DKIMSigner. AuthServID is the
+// authentication service identifier recorded in the
+// ARC-Authentication-Results field, normally the host name. Fields lists the
+// fields the ARC-Message-Signature covers if present; if nil, the usual
+// ones are. Clock, if not nil, gives the signing time instead of the system
+// clock.
+type ARCSealer struct {
+	Domain     string
+	Selector   string
+	Key        crypto.Signer
+	AuthServID string
+	Fields     []string
+	Clock      Clock
+}
+
+// Returns a new ARCSealer for \a domain and \a selector using \a key, which
+// identifies itself as \a authServID.
+func NewARCSealer(domain, selector string, key crypto.Signer, authServID string) *ARCSealer {
+	return &ARCSealer{Domain: domain, Selector: selector, Key: key, AuthServID: authServID}
+}
+
+// Returns \a rfc5322 with a new ARC set prepended, recording \a results
+// (the authentication results, e.g. "dkim=pass header.d=example.com; spf=pass
+// smtp.mailfrom=example.com") and \a chain, the result of validating the
+// message's ARC chain on arrival with DKIMVerifier.VerifyARC().
+func (s *ARCSealer) Seal(rfc5322, results string, chain *ARCResult) (string, error) {
+	algorithm, err := dkimAlgorithm(s.Key)
+	if err != nil {
+		return "", err
+	}
+	rfc5322 = NormalizeLineEndings(rfc5322, "\r\n")
+	fields, body := splitRawMessage(rfc5322)
+	sets, err := arcSets(fields)
+	if err != nil {
+		return "", err
+	}
+	instance := len(sets) + 1
+	if instance > maxARCInstances {
+		return "", errors.New("mail: message has too many ARC sets")
+	}
+	cv := "none"
+	if len(sets) > 0 {
+		cv = "fail"
+		if chain != nil && chain.Result == "pass" {
+			cv = "pass"
+		}
+	}
+	if strings.TrimSpace(results) == "" {
+		results = "none"
+	}
+	i := "i=" + strconv.Itoa(instance)
+
+	set := arcSet{}
+	set.aar = ARCAuthenticationResultsFieldName + ": " + i + "; " +
+		s.AuthServID + ";" + crlf + "\t" + results
+	signer := &DKIMSigner{Domain: s.Domain, Selector: s.Selector, Key: s.Key,
+		Fields: s.Fields, Relaxed: true, Clock: s.Clock}
+	set.ams, err = signer.signature(ARCMessageSignatureFieldName, i, fields, body)
+	if err != nil {
+		return "", err
+	}
+	set.as = ARCSealFieldName + ": " + i + "; a=" + algorithm + "; cv=" + cv +
+		"; d=" + s.Domain + "; s=" + s.Selector + ";" + crlf +
+		"\tt=" + strconv.FormatInt(clockNow(s.Clock).Unix(), 10) + ";" + crlf + "\tb="
+	sig, err := dkimSign(s.Key, arcSealData(append(sets, set)))
+	if err != nil {
+		return "", err
+	}
+	set.as += foldBase64(sig)
+	return set.as + crlf + set.ams + crlf + set.aar + crlf + rfc5322, nil
+}
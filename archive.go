@@ -0,0 +1,205 @@
+package mail
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ArchiveFormat is the kind of file an ArchiveWriter writes and
+// ImportArchive() reads.
+type ArchiveFormat int
+
+const (
+	// ArchiveMbox is an mboxrd file, as written by MboxWriter. Since mbox
+	// has no folders, each message carries its labels, or if it has none,
+	// its folder, in an X-Gmail-Labels field, as in Google Takeout.
+	ArchiveMbox ArchiveFormat = iota
+	// ArchiveTar is a tar file holding each message as a ".eml" file in a
+	// directory named after its folder. Labels are kept as for ArchiveMbox,
+	// but only if there are any.
+	ArchiveTar
+	// ArchiveJSONL is a file with one JSON object per line, holding the
+	// folder, labels and text of a message, as ArchiveEntry describes.
+	ArchiveJSONL
+)
+
+// An ArchiveEntry is one line of an ArchiveJSONL file.
+type ArchiveEntry struct {
+	Folder  string   `json:"folder"`
+	Labels  []string `json:"labels,omitempty"`
+	Message string   `json:"message"`
+}
+
+// An ArchiveWriter writes messages to a backup or export file. It is a
+// MigrationTarget, so anything which copies messages into a store, e.g. a
+// Migration, can write an archive instead, and ImportArchive() copies an
+// archive into any MigrationTarget, including another ArchiveWriter. Thus
+// one code path serves for backups, restores and conversion between
+// formats.
+//
+// Close() must be called after the last message is appended.
+type ArchiveWriter struct {
+	format ArchiveFormat
+	mbox   *MboxWriter
+	tar    *tar.Writer
+	json   *json.Encoder
+	count  int
+}
+
+// Returns a new ArchiveWriter writing \a f to \a w.
+func NewArchiveWriter(w io.Writer, f ArchiveFormat) *ArchiveWriter {
+	a := &ArchiveWriter{format: f}
+	switch f {
+	case ArchiveMbox:
+		a.mbox = NewMboxWriter(w)
+	case ArchiveTar:
+		a.tar = tar.NewWriter(w)
+	default:
+		a.json = json.NewEncoder(w)
+		a.json.SetEscapeHTML(false)
+	}
+	return a
+}
+
+// Writes \a m to the archive as belonging in \a folder, which uses "/" as
+// the hierarchy separator, with the Gmail-style \a labels (which may be
+// nil).
+func (a *ArchiveWriter) Append(folder string, m *Message, labels []string) error {
+	a.count++
+	switch {
+	case a.mbox != nil:
+		if len(labels) == 0 && folder != "" {
+			labels = []string{folder}
+		}
+		return a.mbox.Write(m, labels)
+	case a.tar != nil:
+		text := m.RFC822(false)
+		if len(labels) > 0 {
+			text = withGmailLabels(text, labels)
+		}
+		name := fmt.Sprintf("%06d.eml", a.count)
+		if dir := archiveFolder(folder); dir != "" {
+			name = dir + "/" + name
+		}
+		err := a.tar.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     name,
+			Mode:     0600,
+			Size:     int64(len(text)),
+			ModTime:  mboxDate(m.Header),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(a.tar, text)
+		return err
+	}
+	return a.json.Encode(&ArchiveEntry{Folder: folder, Labels: labels, Message: m.RFC822(false)})
+}
+
+// Finishes the archive. The underlying writer is not closed.
+func (a *ArchiveWriter) Close() error {
+	switch {
+	case a.mbox != nil:
+		return a.mbox.Flush()
+	case a.tar != nil:
+		return a.tar.Close()
+	}
+	return nil
+}
+
+// Reads the archive of kind \a f from \a r and appends each message in it to
+// \a target, in the order in which they were written. Messages are parsed,
+// and thereby repaired, as by ReadMessage().
+//
+// The folder of a message in an ArchiveMbox file is chosen from its labels
+// by TakeoutFolder(); that of a message in an ArchiveTar file is the
+// directory holding it, or "INBOX" for files at the top level. Other files
+// in a tar archive are ignored.
+func ImportArchive(r io.Reader, f ArchiveFormat, target MigrationTarget) error {
+	switch f {
+	case ArchiveMbox:
+		mr := NewMboxReader(r)
+		for {
+			m, err := mr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			labels := m.Header.GmailLabels()
+			if err := target.Append(TakeoutFolder(labels), m, labels); err != nil {
+				return err
+			}
+		}
+	case ArchiveTar:
+		tr := tar.NewReader(r)
+		for {
+			h, err := tr.Next()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if h.Typeflag != tar.TypeReg || !strings.HasSuffix(h.Name, ".eml") {
+				continue
+			}
+			b, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return err
+			}
+			m, err := ReadMessage(string(b))
+			if err != nil {
+				return err
+			}
+			folder := path.Dir(path.Clean("/" + h.Name))[1:]
+			if folder == "" {
+				folder = "INBOX"
+			}
+			if err := target.Append(folder, m, m.Header.GmailLabels()); err != nil {
+				return err
+			}
+		}
+	}
+	d := json.NewDecoder(r)
+	for {
+		e := &ArchiveEntry{}
+		err := d.Decode(e)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if e.Message == "" {
+			return errors.New("mail: archive entry without a message")
+		}
+		m, err := ReadMessage(e.Message)
+		if err != nil {
+			return err
+		}
+		if err := target.Append(e.Folder, m, e.Labels); err != nil {
+			return err
+		}
+	}
+}
+
+// Returns \a folder as a relative directory name for a tar archive, without
+// empty, "." or ".." components.
+func archiveFolder(folder string) string {
+	var r []string
+	for _, c := range strings.Split(folder, "/") {
+		if c != "" && c != "." && c != ".." {
+			r = append(r, c)
+		}
+	}
+	return strings.Join(r, "/")
+}
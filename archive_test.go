@@ -0,0 +1,74 @@
+package mail_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// A MigrationTarget which records what is appended to it.
+type recordingTarget struct {
+	entries []string
+}
+
+func (t *recordingTarget) Append(folder string, m *mail.Message, labels []string) error {
+	t.entries = append(t.entries, folder+" "+strings.Join(labels, ",")+" "+m.Header.Subject())
+	return nil
+}
+
+func TestArchive(t *testing.T) {
+	message := func(subject string) *mail.Message {
+		m, err := mail.ReadMessage("From: alice@example.com\r\n" +
+			"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\nSubject: " + subject +
+			"\r\n\r\nFrom the start\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	appendAll := func(target mail.MigrationTarget) {
+		target.Append("INBOX", message("one"), nil)
+		target.Append("Work/Projects", message("two"), nil)
+		target.Append("Archive", message("three"), []string{"Inbox", "Family"})
+	}
+	want := map[mail.ArchiveFormat][]string{
+		mail.ArchiveMbox: {"INBOX INBOX one", "Work/Projects Work/Projects two",
+			"INBOX Inbox,Family three"},
+		mail.ArchiveTar: {"INBOX  one", "Work/Projects  two",
+			"Archive Inbox,Family three"},
+		mail.ArchiveJSONL: {"INBOX  one", "Work/Projects  two",
+			"Archive Inbox,Family three"},
+	}
+	for f, entries := range want {
+		var buf bytes.Buffer
+		w := mail.NewArchiveWriter(&buf, f)
+		appendAll(w)
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got := &recordingTarget{}
+		if err := mail.ImportArchive(&buf, f, got); err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, "import", strings.Join(got.entries, "\n"), strings.Join(entries, "\n"))
+	}
+
+	// conversion from one format to another
+	var jsonl, tarred bytes.Buffer
+	w := mail.NewArchiveWriter(&jsonl, mail.ArchiveJSONL)
+	appendAll(w)
+	w.Close()
+	w = mail.NewArchiveWriter(&tarred, mail.ArchiveTar)
+	if err := mail.ImportArchive(&jsonl, mail.ArchiveJSONL, w); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	got := &recordingTarget{}
+	if err := mail.ImportArchive(&tarred, mail.ArchiveTar, got); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "converted", strings.Join(got.entries, "\n"),
+		strings.Join(want[mail.ArchiveTar], "\n"))
+}
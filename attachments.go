@@ -0,0 +1,206 @@
+package mail
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// Apple Mail: the size of an attachment whose content was not
+	// downloaded, or was replaced by a Mail Drop link.
+	XAppleContentLengthFieldName = "X-Apple-Content-Length"
+)
+
+// Returns the attachments of this message: the bodyparts which are not part
+// of the text displayed as its body. Embedded messages are returned as single
+// attachments.
+//
+// This knows about the structures Apple Mail produces. Attachments placed
+// inline among fragments of the HTML body, inside a multipart/alternative, are
+// found, and the HTML fragments themselves are not returned. For AppleDouble
+// files (multipart/appledouble, RFC 1740) only the data fork is returned; the
+// application/applefile resource fork is of no use on other platforms.
+func (m *Message) Attachments() []*Part {
+	if m.Part == nil {
+		return nil
+	}
+	return m.Part.appendAttachments(nil, m.Part.displayBody(PreferPlain))
+}
+
+// Appends the attachments of this part to \a r and returns the result,
+// ignoring \a body, the part displayed as the body.
+func (p *Part) appendAttachments(r []*Part, body *Part) []*Part {
+	if p == body {
+		return r
+	}
+	if p.message != nil {
+		return append(r, p)
+	}
+
+	switch p.contentType() {
+	case "multipart/appledouble":
+		if fork := p.dataFork(); fork != nil {
+			r = append(r, fork)
+		}
+		return r
+	case "application/applefile":
+		return r
+	}
+
+	if len(p.Parts) > 0 {
+		for _, c := range p.Parts {
+			r = c.appendAttachments(r, body)
+		}
+		return r
+	}
+
+	// text without a name is a body fragment (or an alternative to the
+	// body), not an attachment
+	switch p.contentType() {
+	case "", "text/plain", "text/html", "text/enriched", "text/richtext":
+		if !p.isAttachment() {
+			return r
+		}
+	}
+	return append(r, p)
+}
+
+// Returns the resource and data forks of this multipart/appledouble part,
+// either of which may be nil.
+func (p *Part) appleDoubleForks() (resource, data *Part) {
+	for _, c := range p.Parts {
+		if c.contentType() == "application/applefile" {
+			resource = c
+		} else if data == nil {
+			data = c
+		}
+	}
+	return resource, data
+}
+
+// Returns the data fork of this multipart/appledouble part, or nil if it has
+// none.
+func (p *Part) dataFork() *Part {
+	_, data := p.appleDoubleForks()
+	return data
+}
+
+// Returns true if this bodypart is marked as an attachment, or has a file
+// name.
+func (p *Part) isAttachment() bool {
+	if p.Header == nil {
+		return false
+	}
+	if cd := p.Header.ContentDisposition(); cd != nil &&
+		strings.ToLower(cd.Disposition) == "attachment" {
+		return true
+	}
+	return p.Filename() != ""
+}
+
+// Returns true if this bodypart should be presented to the user as an
+// attachment, rather than as (part of) the message's body.
+//
+// Content-Disposition is only one of the clues, since clients disagree
+// about it: some mark every image "inline", others mark the images of an
+// HTML body "attachment". So multiparts are never attachments, and
+// embedded messages always are. A part whose Content-ID an HTML part of the
+// same message refers to (with a "cid:" URL) is not, since the HTML
+// displays it. Otherwise, a part marked "attachment", or which has a file
+// name, is. Of the rest, text/plain, text/html, text/enriched and
+// text/richtext parts are not, and anything else, e.g. a PDF or an image
+// the HTML does not use, is.
+func (p *Part) IsAttachment() bool {
+	if p.message != nil {
+		return true
+	}
+	if len(p.Parts) > 0 || strings.HasPrefix(p.contentType(), "multipart/") {
+		return false
+	}
+	if p.Header != nil {
+		if ids := p.Header.Addresses(ContentIDFieldName); len(ids) == 1 &&
+			p.referencedFromHTML(ids[0].lpdomain()) {
+			return false
+		}
+	}
+	if p.isAttachment() {
+		return true
+	}
+	switch p.contentType() {
+	case "", "text/plain", "text/html", "text/enriched", "text/richtext":
+		return false
+	}
+	return true
+}
+
+// Returns true if an HTML part of the message containing this bodypart
+// refers to the Content-ID \a id with a "cid:" URL. Embedded messages are
+// not searched, nor is the message containing this one.
+func (p *Part) referencedFromHTML(id string) bool {
+	root := p
+	for root.parent != nil && root.message == nil {
+		root = root.parent
+	}
+	url := "cid:" + strings.ToLower(id)
+	found := false
+	var search func(q *Part)
+	search = func(q *Part) {
+		if found || q != root && q.message != nil {
+			return
+		}
+		if q.hasText && q.contentType() == "text/html" &&
+			strings.Contains(strings.ToLower(q.Text), url) {
+			found = true
+		}
+		for _, c := range q.Parts {
+			search(c)
+		}
+	}
+	search(root)
+	return found
+}
+
+// Returns the file name of this bodypart, from the Content-Disposition
+// filename parameter or the Content-Type name parameter, or an empty string.
+// The data fork of an AppleDouble file which has no name of its own has
+// that of its resource fork.
+func (p *Part) Filename() string {
+	if p.Header == nil {
+		return ""
+	}
+	if cd := p.Header.ContentDisposition(); cd != nil {
+		if n := cd.parameter("filename"); n != "" {
+			return n
+		}
+	}
+	if ct := p.Header.ContentType(); ct != nil {
+		if n := ct.parameter("name"); n != "" {
+			return n
+		}
+	}
+	if p.parent != nil && p.parent.contentType() == "multipart/appledouble" {
+		if resource, data := p.parent.appleDoubleForks(); data == p && resource != nil {
+			return resource.Filename()
+		}
+	}
+	return ""
+}
+
+// Returns the size of the decoded content of this bodypart, in bytes,
+// including content spilled by a SpillStorage. If the content is missing and
+// Apple Mail recorded the original size in an X-Apple-Content-Length field,
+// that size is returned instead.
+func (p *Part) Size() int {
+	size := len(p.Data)
+	if p.spill != nil {
+		size = p.spill.size
+	} else if p.hasText {
+		size = len(p.Text)
+	}
+	if size == 0 && p.Header != nil {
+		if n, err := strconv.Atoi(simplify(p.Header.Get(XAppleContentLengthFieldName))); err == nil && n > 0 {
+			return n
+		}
+	}
+	return size
+}
@@ -0,0 +1,71 @@
+package mail_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAppleAttachments(t *testing.T) {
+	msg := loadFixture(t, "apple")
+	before := msg.RFC822(false)
+	a := msg.Attachments()
+	if len(a) != 3 {
+		t.Fatalf("expected 3 attachments, got %d", len(a))
+	}
+	testStringEquals(t, "inline image", a[0].Filename(), "photo.jpg")
+	testStringEquals(t, "data fork", a[1].Filename(), "notes.pages")
+	testIntegerEquals(t, "data fork size", a[1].Size(), 4)
+	testStringEquals(t, "stripped attachment", a[2].Filename(), "movie.mov")
+	testIntegerEquals(t, "stripped attachment size", a[2].Size(), 104857600)
+	if msg.RFC822(false) != before {
+		t.Error("Attachments() modified the message")
+	}
+
+	text := msg.Export(mail.ExportText)
+	if !strings.Contains(text, "\nHere you go.\n") {
+		t.Errorf("unexpected body in export: %s", text)
+	}
+}
+
+func TestIsAttachment(t *testing.T) {
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=outer\r\n" +
+		"\r\n--outer\r\n" +
+		"Content-Type: multipart/related; boundary=inner\r\n" +
+		"\r\n--inner\r\n" +
+		"Content-Type: text/html\r\n\r\n<p>Chart: <img src=\"CID:chart@example.com\">\r\n" +
+		"--inner\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: attachment; filename=chart.png\r\n" +
+		"Content-ID: <chart@example.com>\r\n\r\npng\r\n" +
+		"--inner\r\n" +
+		"Content-Type: image/gif\r\n" +
+		"Content-Disposition: inline\r\n" +
+		"Content-ID: <unused@example.com>\r\n\r\ngif\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: inline\r\n\r\nFooter\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"Content-Disposition: inline; filename=notes.txt\r\n\r\nNotes\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf\r\n\r\npdf\r\n" +
+		"--outer--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	related := m.Parts[0]
+	results := []string{}
+	for _, p := range []*mail.Part{related, related.Parts[0], related.Parts[1],
+		related.Parts[2], m.Parts[1], m.Parts[2], m.Parts[3]} {
+		results = append(results, fmt.Sprint(p.IsAttachment()))
+	}
+	testStringEquals(t, "attachments", strings.Join(results, " "),
+		"false false false true false true true")
+}
@@ -0,0 +1,228 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// The chunk size SendBDAT() uses if none is given.
+const defaultBDATChunkSize = 1024 * 1024
+
+// The largest message a BDATReceiver accepts if its MaxSize is not set.
+const defaultBDATMaxSize = 64 * 1024 * 1024
+
+// Sends \a m from \a from to \a to using the client \a c, which must have
+// greeted the server already. If the server supports CHUNKING (RFC 3030),
+// the message is sent with BDAT in chunks of at most \a chunkSize bytes
+// (1MB if \a chunkSize is 0 or less), straight from the rendered message
+// without dot-stuffing; otherwise it falls back to DATA.
+//
+// Returns an error without sending anything if \a m requires 8BITMIME and
+// the server does not support it; Message.Downgrade() avoids that.
+func SendBDAT(c *smtp.Client, from string, to []string, m *Message, chunkSize int) error {
+	chunking, _ := c.Extension("CHUNKING")
+	if eight, _ := c.Extension("8BITMIME"); !eight && m.Requires8BitMIME() {
+		return errors.New("mail: server does not support 8BITMIME")
+	}
+	return sendRaw(c, from, to, m.RFC822(false), chunking, chunkSize)
+}
+
+// Sends \a rfc5322 as it is from \a from to \a to using \a c, with BDAT in
+// chunks of at most \a chunkSize bytes if \a chunking is true, and otherwise
+// with DATA.
+func sendRaw(c *smtp.Client, from string, to []string, rfc5322 string, chunking bool, chunkSize int) (err error) {
+	o := startOperation("mail.send")
+	o.size(len(rfc5322))
+	o.span.SetAttribute("mail.recipients", len(to))
+	o.span.SetAttribute("mail.chunking", chunking)
+	queueID := ""
+	defer func() {
+		args := []interface{}{LogMessageID, rawMessageID(rfc5322), LogEnvelopeFrom, from,
+			LogEnvelopeTo, strings.Join(to, ",")}
+		if err != nil {
+			DefaultLogger.Warn("mail: sending failed", append(args, "error", err.Error())...)
+		} else {
+			DefaultLogger.Info("mail: sent", append(args, LogQueueID, queueID)...)
+		}
+		o.end(err)
+	}()
+	if err := c.Mail(from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	if !chunking {
+		w, err := c.Data()
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(w, rfc5322); err != nil {
+			w.Close()
+			return err
+		}
+		return w.Close()
+	}
+	if chunkSize <= 0 {
+		chunkSize = defaultBDATChunkSize
+	}
+	for rest := rfc5322; ; rest = rest[chunkSize:] {
+		if len(rest) <= chunkSize {
+			reply, err := sendChunk(c, rest, true)
+			queueID = replyQueueID(reply)
+			return err
+		}
+		if _, err := sendChunk(c, rest[:chunkSize], false); err != nil {
+			return err
+		}
+	}
+}
+
+// Sends \a chunk using BDAT and waits for the server's reply, whose text is
+// returned. \a last is true for the message's last chunk.
+func sendChunk(c *smtp.Client, chunk string, last bool) (string, error) {
+	cmd := "BDAT " + strconv.Itoa(len(chunk))
+	if last {
+		cmd += " LAST"
+	}
+	id := c.Text.Next()
+	c.Text.StartRequest(id)
+	_, err := c.Text.W.WriteString(cmd + "\r\n")
+	if err == nil {
+		_, err = c.Text.W.WriteString(chunk)
+	}
+	if err == nil {
+		err = c.Text.W.Flush()
+	}
+	c.Text.EndRequest(id)
+	if err != nil {
+		return "", err
+	}
+	c.Text.StartResponse(id)
+	defer c.Text.EndResponse(id)
+	_, reply, err := c.Text.ReadResponse(250)
+	return reply, err
+}
+
+// Parses the arguments of a BDAT command, e.g. "4096" or "512 LAST", and
+// returns the chunk size and whether it is the last chunk.
+func ParseBDAT(args string) (size int, last bool, err error) {
+	words := strings.Fields(args)
+	if len(words) == 0 || len(words) > 2 {
+		return 0, false, fmt.Errorf("mail: bad BDAT arguments: %q", args)
+	}
+	size, err = strconv.Atoi(words[0])
+	if err != nil || size < 0 || words[0][0] == '+' {
+		return 0, false, fmt.Errorf("mail: bad BDAT chunk size: %q", words[0])
+	}
+	if len(words) == 2 {
+		if !strings.EqualFold(words[1], "LAST") {
+			return 0, false, fmt.Errorf("mail: bad BDAT arguments: %q", args)
+		}
+		last = true
+	}
+	return size, last, nil
+}
+
+// A BDATReceiver collects the chunks of a message sent with BDAT, for an
+// SMTP server. The server parses each BDAT command with ParseBDAT() and
+// passes its connection to ReadChunk(), which reads exactly the chunk's
+// bytes; after the last chunk, Message() parses the message.
+//
+// A message larger than MaxSize bytes (64MB if MaxSize is 0 or less) is
+// rejected. QueueID and Envelope, if set by the server, identify the
+// transaction in the entries logged to DefaultLogger.
+type BDATReceiver struct {
+	MaxSize  int
+	QueueID  string
+	Envelope Envelope
+
+	b        strings.Builder
+	last     bool
+	tooLarge bool
+}
+
+// Reads a chunk of \a size bytes from \a src, as announced by a BDAT command
+// with those arguments, and returns nil if the server should accept it.
+// \a last is true if the command had the LAST keyword.
+//
+// The chunk is consumed even if it is rejected, e.g. with
+// ErrMessageTooLarge, so that the server stays in step with the client; if
+// reading fails, the connection should be closed.
+func (r *BDATReceiver) ReadChunk(src io.Reader, size int, last bool) error {
+	if r.last {
+		if _, err := io.CopyN(ioutil.Discard, src, int64(size)); err != nil {
+			return err
+		}
+		return errors.New("mail: BDAT after LAST")
+	}
+	if size > r.maxSize()-r.b.Len() {
+		r.tooLarge = true
+	}
+	if r.tooLarge {
+		if _, err := io.CopyN(ioutil.Discard, src, int64(size)); err != nil {
+			return err
+		}
+		r.last = last
+		return ErrMessageTooLarge
+	}
+	// the builder grows as the data arrives, not by the announced size
+	if _, err := io.CopyN(&r.b, src, int64(size)); err != nil {
+		return err
+	}
+	r.last = last
+	return nil
+}
+
+// Returns MaxSize, or the default if it is not set.
+func (r *BDATReceiver) maxSize() int {
+	if r.MaxSize <= 0 {
+		return defaultBDATMaxSize
+	}
+	return r.MaxSize
+}
+
+// Returns true once the last chunk has been read.
+func (r *BDATReceiver) Done() bool {
+	return r.last
+}
+
+// Parses the message sent, as ReadMessage() does. Returns an error if the
+// last chunk has not been read or the message was too large.
+func (r *BDATReceiver) Message() (*Message, error) {
+	if !r.last {
+		return nil, errors.New("mail: BDAT LAST not yet received")
+	}
+	args := []interface{}{LogQueueID, r.QueueID, LogEnvelopeFrom, r.Envelope.From,
+		LogEnvelopeTo, strings.Join(r.Envelope.To, ",")}
+	if r.tooLarge {
+		DefaultLogger.Warn("mail: message too large", append(args, "max_size", r.maxSize())...)
+		return nil, ErrMessageTooLarge
+	}
+	m, err := ReadMessage(r.b.String())
+	if err != nil {
+		DefaultLogger.Warn("mail: cannot parse message", append(args, "error", err.Error())...)
+		return m, err
+	}
+	DefaultLogger.Info("mail: received",
+		append(args, LogMessageID, m.Header.MessageID(), "size", r.b.Len())...)
+	return m, nil
+}
+
+// Discards the chunks read so far, as a server must after RSET or the end of
+// a transaction.
+func (r *BDATReceiver) Reset() {
+	r.b.Reset()
+	r.last = false
+	r.tooLarge = false
+}
@@ -0,0 +1,178 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestBDAT(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("Subject", "Chunks")
+	c.Text = strings.Repeat("A line of text.\n.\n", 20)
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server := net.Pipe()
+	received := make(chan string, 1)
+	chunks := 0
+	go func() {
+		defer server.Close()
+		r := bufio.NewReader(server)
+		rcv := &mail.BDATReceiver{MaxSize: 100000}
+		server.Write([]byte("220 mx.example ESMTP\r\n"))
+		for {
+			l, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			l = strings.TrimSpace(l)
+			switch {
+			case strings.HasPrefix(l, "EHLO"):
+				server.Write([]byte("250-mx.example\r\n250-8BITMIME\r\n250 CHUNKING\r\n"))
+			case strings.HasPrefix(l, "MAIL"), strings.HasPrefix(l, "RCPT"):
+				server.Write([]byte("250 ok\r\n"))
+			case strings.HasPrefix(l, "BDAT "):
+				size, last, err := mail.ParseBDAT(l[5:])
+				if err != nil {
+					server.Write([]byte("501 syntax\r\n"))
+					continue
+				}
+				if err := rcv.ReadChunk(r, size, last); err != nil {
+					server.Write([]byte("552 too large\r\n"))
+					continue
+				}
+				chunks++
+				if rcv.Done() {
+					m, err := rcv.Message()
+					if err != nil {
+						server.Write([]byte("554 bad message\r\n"))
+						continue
+					}
+					received <- m.Text
+					rcv.Reset()
+				}
+				server.Write([]byte("250 ok\r\n"))
+			case l == "QUIT":
+				server.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				server.Write([]byte("502 unimplemented\r\n"))
+			}
+		}
+	}()
+
+	sc, err := smtp.NewClient(client, "mx.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := sc.Hello("client.example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mail.SendBDAT(sc, "alice@example.com", []string{"bob@example.com"}, m, 100); err != nil {
+		t.Fatal(err)
+	}
+	sc.Quit()
+	testStringEquals(t, "received", <-received, strings.Repeat("A line of text.\r\n.\r\n", 20))
+	testIntegerEquals(t, "chunks", chunks, (len(m.RFC822(false))+99)/100)
+
+	for _, c := range []struct {
+		args string
+		size int
+		last bool
+		ok   bool
+	}{
+		{"4096", 4096, false, true},
+		{"0 LAST", 0, true, true},
+		{"12 last", 12, true, true},
+		{"", 0, false, false},
+		{"-1", 0, false, false},
+		{"12 FIRST", 0, false, false},
+	} {
+		size, last, err := mail.ParseBDAT(c.args)
+		if (err == nil) != c.ok || size != c.size || last != c.last {
+			t.Errorf("ParseBDAT(%q) = %d, %v, %v", c.args, size, last, err)
+		}
+	}
+
+	rcv := &mail.BDATReceiver{MaxSize: 10}
+	input := strings.NewReader("0123456789abcdef")
+	if err := rcv.ReadChunk(input, 8, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := rcv.ReadChunk(input, 8, true); !errors.Is(err, mail.ErrMessageTooLarge) {
+		t.Errorf("oversized chunk accepted: %v", err)
+	}
+	testIntegerEquals(t, "unread", input.Len(), 0)
+
+	// a huge announced size is refused without allocating it
+	rcv = &mail.BDATReceiver{}
+	size, _, err := mail.ParseBDAT("99999999999 LAST")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := rcv.ReadChunk(strings.NewReader("short"), size, true); err == nil {
+		t.Error("truncated chunk accepted")
+	}
+
+	// without a MaxSize, the default limit applies
+	rcv = &mail.BDATReceiver{}
+	size = 64*1024*1024 + 1
+	zeros := io.LimitReader(zeroReader{}, int64(size))
+	if err := rcv.ReadChunk(zeros, size, true); !errors.Is(err, mail.ErrMessageTooLarge) {
+		t.Errorf("chunk over the default limit accepted: %v", err)
+	}
+}
+
+// Reads an endless run of NUL bytes.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
+
+func TestBDATReceiverLogging(t *testing.T) {
+	logger := &recordingLogger{}
+	old := mail.DefaultLogger
+	mail.DefaultLogger = logger
+	defer func() {
+		mail.DefaultLogger = old
+	}()
+
+	text := "From: alice@example.com\r\nMessage-ID: <1@example.com>\r\n" +
+		"Content-MD5: AAAAAAAAAAAAAAAAAAAAAA==\r\n\r\nHello\r\n"
+	r := &mail.BDATReceiver{QueueID: "Q1",
+		Envelope: mail.Envelope{From: "alice@example.com", To: []string{"bob@example.com"}}}
+	if err := r.ReadChunk(strings.NewReader(text), len(text), true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Message(); err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "entries", len(logger.entries), 2)
+	if len(logger.entries) == 2 {
+		if !strings.HasPrefix(logger.entries[0], "WARN mail: repaired message message_id=<1@example.com> "+
+			"code=content-md5-mismatch") {
+			t.Errorf("unexpected entry %q", logger.entries[0])
+		}
+		testStringEquals(t, "received", logger.entries[1],
+			"INFO mail: received queue_id=Q1 envelope_from=alice@example.com "+
+				"envelope_to=bob@example.com message_id=<1@example.com> size="+fmt.Sprint(len(text)))
+	}
+}
@@ -0,0 +1,94 @@
+package mail
+
+import (
+	"strings"
+)
+
+// The names of the bidi formatting characters, which change the direction
+// of the text up to the end of the string or the matching U+202C or U+2069.
+var bidiFormattingNames = map[rune]string{
+	0x202a: "LEFT-TO-RIGHT EMBEDDING",
+	0x202b: "RIGHT-TO-LEFT EMBEDDING",
+	0x202c: "POP DIRECTIONAL FORMATTING",
+	0x202d: "LEFT-TO-RIGHT OVERRIDE",
+	0x202e: "RIGHT-TO-LEFT OVERRIDE",
+	0x2066: "LEFT-TO-RIGHT ISOLATE",
+	0x2067: "RIGHT-TO-LEFT ISOLATE",
+	0x2068: "FIRST STRONG ISOLATE",
+	0x2069: "POP DIRECTIONAL ISOLATE",
+}
+
+// Returns true if \a c is a bidi embedding, override or isolate, or one of
+// the characters ending them.
+func isBidiFormatting(c rune) bool {
+	return c >= 0x202a && c <= 0x202e || c >= 0x2066 && c <= 0x2069
+}
+
+// Returns true if \a c belongs to a script written from right to left,
+// such as Hebrew or Arabic.
+func isRightToLeft(c rune) bool {
+	return c >= 0x0590 && c <= 0x08ff || c >= 0xfb1d && c <= 0xfdff ||
+		c >= 0xfe70 && c <= 0xfeff || c >= 0x10800 && c <= 0x10fff ||
+		c >= 0x1e800 && c <= 0x1efff
+}
+
+// Returns \a s made safe to display among other text, e.g. as a subject,
+// sender or file name in a message list. Bidi embeddings, overrides and
+// isolates are removed, so that they cannot make text such as "invoice",
+// U+202E, "fdp.exe" display as "invoiceexe.pdf", and if \a s contains
+// right-to-left characters, it is wrapped in a first strong isolate
+// (U+2068 ... U+2069), so that it cannot reorder the text around it
+// either. Left-to-right and right-to-left marks, which only affect the
+// characters next to them, are kept.
+func SanitizeBidi(s string) string {
+	s = strings.Map(func(c rune) rune {
+		if isBidiFormatting(c) {
+			return -1
+		}
+		return c
+	}, s)
+	if strings.IndexFunc(s, isRightToLeft) >= 0 {
+		s = "\u2068" + s + "\u2069"
+	}
+	return s
+}
+
+// Returns the file name of this bodypart as Filename() does, made safe to
+// display by SanitizeBidi().
+func (p *Part) DisplayFilename() string {
+	return SanitizeBidi(p.Filename())
+}
+
+// Records a DiagnosticBidiControl for each field in this header whose
+// subject, display names or file name contain bidi embeddings, overrides
+// or isolates, which are used to disguise the real text, most often the
+// extension of an attachment's name.
+func (h *Header) checkBidiControls() {
+	for _, f := range h.Fields {
+		var what, text string
+		switch f := f.(type) {
+		case *HeaderField:
+			if f.Name() == SubjectFieldName {
+				what, text = "the subject", f.Value()
+			}
+		case *AddressField:
+			names := []string{}
+			for _, a := range f.Addresses {
+				names = append(names, a.name)
+			}
+			what, text = "a display name", strings.Join(names, " ")
+		case *ContentType:
+			what, text = "the name parameter", f.parameter("name")
+		case *ContentDisposition:
+			what, text = "the file name", f.parameter("filename")
+		}
+		i := strings.IndexFunc(text, isBidiFormatting)
+		if i < 0 {
+			continue
+		}
+		c := []rune(text[i:])[0]
+		h.addDiagnostic(DiagnosticBidiControl, SeverityWarning, f,
+			"%s contains U+%04X %s, which can disguise text such as a file name extension; "+
+				"without it, the text is %q", what, c, bidiFormattingNames[c], SanitizeBidi(text))
+	}
+}
@@ -0,0 +1,44 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestBidiControls(t *testing.T) {
+	testStringEquals(t, "override", mail.SanitizeBidi("invoice\u202efdp.exe"), "invoicefdp.exe")
+	testStringEquals(t, "Hebrew", mail.SanitizeBidi("\u05e9\u05dc\u05d5\u05dd"),
+		"\u2068\u05e9\u05dc\u05d5\u05dd\u2069")
+	testStringEquals(t, "plain", mail.SanitizeBidi("report.pdf"), "report.pdf")
+
+	m, err := mail.ReadMessage("From: alice@example.com\r\n" +
+		"Subject: =?utf-8?q?Your_invoice_=E2=80=AEfdp.exe?=\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=x\r\n" +
+		"\r\n" +
+		"--x\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		"--x\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=\"invoice\xe2\x80\xaefdp.exe\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n" +
+		"\r\n" +
+		"TVo=\r\n" +
+		"--x--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := []string{}
+	for _, d := range m.Diagnostics() {
+		if d.Code == mail.DiagnosticBidiControl {
+			parts = append(parts, d.Part+" "+d.Field)
+		}
+	}
+	testStringEquals(t, "diagnostics", strings.Join(parts, ", "),
+		" Subject, 2 Content-Disposition")
+	testStringEquals(t, "file name", m.Parts[1].DisplayFilename(), "invoicefdp.exe")
+}
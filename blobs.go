@@ -0,0 +1,237 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Names the blob holding the content of a bodypart moved into a BlobStore.
+const XBlobFieldName = "X-Blob"
+
+// A BlobStore keeps the content of attachments in Dir, addressed by its
+// SHA-256 digest, so that an attachment sent to many people, or forwarded
+// many times, is stored once however many archived messages contain it.
+//
+// Each blob has a reference count, which Put() increments and Release()
+// decrements; a blob is removed when its count reaches zero. Store() moves
+// the large attachments of a message into the store, and Load() puts them
+// back.
+//
+// Blobs are kept in subdirectories named after the first two hex digits of
+// their digest, each next to a ".refs" file holding its count. A BlobStore
+// is safe for concurrent use, but only one BlobStore may use a directory.
+type BlobStore struct {
+	Dir string
+
+	mu sync.Mutex
+}
+
+// Returns a BlobStore keeping blobs in \a dir, which is created if
+// necessary.
+func NewBlobStore(dir string) (*BlobStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &BlobStore{Dir: dir}, nil
+}
+
+// Adds a reference to the blob holding \a data, storing it if it is not
+// stored yet, and returns its key, the hex SHA-256 digest of \a data.
+func (s *BlobStore) Put(data string) (string, error) {
+	sum := sha256.Sum256([]byte(data))
+	key := hex.EncodeToString(sum[:])
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(key)
+	if err != nil {
+		return "", err
+	}
+	if refs == 0 {
+		if err := os.MkdirAll(filepath.Dir(s.path(key)), 0700); err != nil {
+			return "", err
+		}
+		if err := writeFileAtomically(s.path(key), []byte(data)); err != nil {
+			return "", err
+		}
+	}
+	return key, s.setRefs(key, refs+1)
+}
+
+// Returns the content of the blob \a key, or an error if there is no such
+// blob.
+func (s *BlobStore) Get(key string) (string, error) {
+	if !validBlobKey(key) {
+		return "", errors.New("mail: invalid blob key " + key)
+	}
+	b, err := ioutil.ReadFile(s.path(key))
+	return string(b), err
+}
+
+// Removes a reference to the blob \a key, and the blob itself if that was
+// the last one.
+func (s *BlobStore) Release(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	refs, err := s.refs(key)
+	if err != nil {
+		return err
+	}
+	if refs <= 1 {
+		os.Remove(s.path(key) + ".refs")
+		return os.Remove(s.path(key))
+	}
+	return s.setRefs(key, refs-1)
+}
+
+// Returns the number of references to the blob \a key, which is 0 if there
+// is no such blob.
+func (s *BlobStore) Refs(key string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.refs(key)
+}
+
+// Moves the content of each bodypart of \a m whose decoded content is at
+// least \a minSize bytes into this store. Afterwards such a bodypart has no
+// content, and an X-Blob field naming its blob, so m.RFC822() is as much
+// smaller; Load() restores it. Embedded messages and text parts are left
+// alone, as SpillStorage leaves them.
+//
+// \a m must be a message as received, not one Store() has seen already: any
+// X-Blob fields it has are removed first, since its sender could otherwise
+// name someone else's blob, and have Load() restore it or ReleaseMessage()
+// drop a reference the message never took.
+func (s *BlobStore) Store(m *Message, minSize int) error {
+	if m.Part == nil {
+		return nil
+	}
+	m.Part.walkLeaves(func(p *Part) {
+		if p.Header != nil {
+			p.Header.RemoveAllNamed(XBlobFieldName)
+		}
+	})
+	var err error
+	m.Part.walkLeaves(func(p *Part) {
+		if err != nil || p.hasText || p.Header == nil || p.Size() < minSize {
+			return
+		}
+		data, e := p.data()
+		if e != nil {
+			err = e
+			return
+		}
+		var key string
+		if key, err = s.Put(data); err == nil {
+			p.Header.Add(XBlobFieldName, "sha256:"+key)
+			p.Data = ""
+			if p.spill != nil {
+				err = p.spill.remove()
+				p.spill = nil
+			}
+		}
+	})
+	return err
+}
+
+// Restores the content of each bodypart of \a m which Store() moved into
+// this store, and removes its X-Blob field. The blobs keep their
+// references; ReleaseMessage() removes them.
+func (s *BlobStore) Load(m *Message) error {
+	if m.Part == nil {
+		return nil
+	}
+	var err error
+	m.Part.walkLeaves(func(p *Part) {
+		if err != nil || p.Header == nil {
+			return
+		}
+		key := blobKey(p.Header)
+		if key == "" {
+			return
+		}
+		var data string
+		if data, err = s.Get(key); err == nil {
+			p.Data = data
+			p.Header.RemoveAllNamed(XBlobFieldName)
+		}
+	})
+	return err
+}
+
+// Removes the references \a m holds to blobs in this store, e.g. when the
+// archived message is deleted.
+func (s *BlobStore) ReleaseMessage(m *Message) error {
+	if m.Part == nil {
+		return nil
+	}
+	var err error
+	m.Part.walkLeaves(func(p *Part) {
+		if p.Header == nil {
+			return
+		}
+		if key := blobKey(p.Header); key != "" {
+			if e := s.Release(key); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
+
+// Returns the key in the X-Blob field of \a h, or an empty string if there
+// is none or it is invalid.
+func blobKey(h *Header) string {
+	key := strings.TrimPrefix(simplify(h.Get(XBlobFieldName)), "sha256:")
+	if !validBlobKey(key) {
+		return ""
+	}
+	return key
+}
+
+// Returns the name of the file holding the blob \a key.
+func (s *BlobStore) path(key string) string {
+	return filepath.Join(s.Dir, key[:2], key)
+}
+
+// Returns the reference count of \a key. The caller must hold s.mu.
+func (s *BlobStore) refs(key string) (int, error) {
+	if !validBlobKey(key) {
+		return 0, errors.New("mail: invalid blob key " + key)
+	}
+	b, err := ioutil.ReadFile(s.path(key) + ".refs")
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(b)))
+}
+
+// Sets the reference count of \a key to \a n. The caller must hold s.mu.
+func (s *BlobStore) setRefs(key string, n int) error {
+	return writeFileAtomically(s.path(key)+".refs", []byte(strconv.Itoa(n)+"\n"))
+}
+
+// Returns true if \a key is a hex SHA-256 digest, so that it cannot name a
+// file outside the store.
+func validBlobKey(key string) bool {
+	if len(key) != 2*sha256.Size {
+		return false
+	}
+	for _, c := range key {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
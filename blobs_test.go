@@ -0,0 +1,151 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestBlobStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := mail.NewBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := strings.Repeat("%PDF quarterly report ", 500)
+	compose := func(to string) string {
+		c := mail.NewComposer()
+		c.Header.Add("From", "alice@example.com")
+		c.Header.Add("To", to)
+		c.Text = "See attached.\n"
+		c.Attach("report.pdf", "application/pdf", report)
+		c.Attach("tiny.bin", "application/octet-stream", "tiny")
+		m, err := c.Compose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.RFC822(false)
+	}
+	stored := []string{}
+	for _, to := range []string{"bob@example.com", "carol@example.com"} {
+		original := compose(to)
+		m, err := mail.ReadMessage(original)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Store(m, 1024); err != nil {
+			t.Fatal(err)
+		}
+		text := m.RFC822(false)
+		if len(text) > len(original)/4 {
+			t.Errorf("stored message is %d bytes, the original %d", len(text), len(original))
+		}
+		stored = append(stored, text)
+	}
+
+	sum := sha256.Sum256([]byte(report))
+	key := hex.EncodeToString(sum[:])
+	refs, err := s.Refs(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "refs", refs, 2)
+	files, _ := ioutil.ReadDir(filepath.Join(dir, key[:2]))
+	testIntegerEquals(t, "files", len(files), 2)
+
+	m, err := mail.ReadMessage(stored[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(m); err != nil {
+		t.Fatal(err)
+	}
+	attachments := m.Attachments()
+	testIntegerEquals(t, "attachments", len(attachments), 2)
+	testStringEquals(t, "restored", attachments[0].Data, report)
+	testStringEquals(t, "tiny", attachments[1].Data, "tiny")
+	testStringEquals(t, "field", attachments[0].Header.Get(mail.XBlobFieldName), "")
+
+	for _, text := range stored {
+		m, err := mail.ReadMessage(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.ReleaseMessage(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	refs, _ = s.Refs(key)
+	testIntegerEquals(t, "released", refs, 0)
+	if _, err := s.Get(key); err == nil {
+		t.Error("the blob outlived its references")
+	}
+	if _, err := s.Get("../../etc/passwd"); err == nil {
+		t.Error("an invalid key was accepted")
+	}
+}
+
+func TestBlobStoreForgedField(t *testing.T) {
+	dir, err := ioutil.TempDir("", "blobs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := mail.NewBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret := strings.Repeat("confidential ", 200)
+	key, err := s.Put(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	forged, err := mail.ReadMessage("From: mallory@example.com\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nHi\r\n" +
+		"--b\r\nContent-Type: application/octet-stream\r\n" +
+		"X-Blob: sha256:" + key + "\r\n\r\n" +
+		"--b--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Store(forged, 1024); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage(forged.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load(m); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range m.Parts {
+		if strings.Contains(p.Data, "confidential") {
+			t.Error("the forged field loaded another message's blob")
+		}
+	}
+	m, err = mail.ReadMessage(forged.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.ReleaseMessage(m); err != nil {
+		t.Fatal(err)
+	}
+	refs, _ := s.Refs(key)
+	testIntegerEquals(t, "refs", refs, 1)
+}
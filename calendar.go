@@ -0,0 +1,638 @@
+package mail
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Calendar is the content of an iCalendar (RFC 5545) object, as sent in
+// text/calendar bodyparts of invitations, replies and free/busy messages.
+// Method is the iTIP method (RFC 5546), e.g. "REQUEST" or "CANCEL".
+//
+// All times are resolved to absolute times: those given with a TZID use the
+// VTIMEZONE of that name in the object, including its daylight saving time
+// rules, or the IANA time zone of that name if the object defines none.
+// Floating times, which have no time zone, are taken to be in the location
+// given to ParseCalendar().
+type Calendar struct {
+	Method   string
+	Events   []CalendarEvent
+	FreeBusy []BusyPeriod
+}
+
+// A CalendarEvent is a VEVENT. End is Start plus the DURATION if there is
+// no DTEND. For an all-day event, Start and End are midnight in the
+// location given to ParseCalendar(), and End is the day after the last day.
+// Status and Transparency are upper-cased, e.g. "CANCELLED" and
+// "TRANSPARENT"; Organizer is the address without "mailto:".
+type CalendarEvent struct {
+	UID          string    `json:"uid"`
+	Sequence     int       `json:"sequence,omitempty"`
+	Summary      string    `json:"summary,omitempty"`
+	Location     string    `json:"location,omitempty"`
+	Organizer    string    `json:"organizer,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	Transparency string    `json:"transparency,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+	AllDay       bool      `json:"allDay,omitempty"`
+}
+
+// A BusyPeriod is a time during which someone is busy: Type is an FBTYPE
+// (RFC 5545 section 3.2.9), e.g. "BUSY" or "BUSY-TENTATIVE".
+type BusyPeriod struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+	Type  string    `json:"type"`
+}
+
+// A calendarLine is a content line: a property with its parameters, whose
+// names are upper-cased, and value.
+type calendarLine struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// A calendarComponent is a BEGIN/END block and the properties and
+// components in it.
+type calendarComponent struct {
+	name       string
+	properties []calendarLine
+	children   []*calendarComponent
+}
+
+// Returns the value of the first property named \a name, or an empty
+// string.
+func (c *calendarComponent) get(name string) string {
+	if l := c.property(name); l != nil {
+		return l.value
+	}
+	return ""
+}
+
+// Returns the first property named \a name, or nil.
+func (c *calendarComponent) property(name string) *calendarLine {
+	for i := range c.properties {
+		if c.properties[i].name == name {
+			return &c.properties[i]
+		}
+	}
+	return nil
+}
+
+// Parses the iCalendar object \a text. Floating times are taken to be in
+// \a loc, or UTC if \a loc is nil. Returns an error if \a text is not an
+// iCalendar object; properties which cannot be understood are skipped.
+func ParseCalendar(text string, loc *time.Location) (*Calendar, error) {
+	if loc == nil {
+		loc = time.UTC
+	}
+	root := &calendarComponent{}
+	stack := []*calendarComponent{root}
+	for _, l := range unfoldCalendarLines(text) {
+		cl, ok := parseCalendarLine(l)
+		if !ok {
+			continue
+		}
+		top := stack[len(stack)-1]
+		switch cl.name {
+		case "BEGIN":
+			c := &calendarComponent{name: strings.ToUpper(cl.value)}
+			top.children = append(top.children, c)
+			stack = append(stack, c)
+		case "END":
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		default:
+			top.properties = append(top.properties, cl)
+		}
+	}
+	var vcal *calendarComponent
+	for _, c := range root.children {
+		if c.name == "VCALENDAR" {
+			vcal = c
+			break
+		}
+	}
+	if vcal == nil {
+		return nil, errors.New("mail: not an iCalendar object")
+	}
+
+	zones := map[string]*calendarZone{}
+	for _, c := range vcal.children {
+		if c.name == "VTIMEZONE" {
+			if z := newCalendarZone(c); z != nil {
+				zones[z.id] = z
+			}
+		}
+	}
+	r := &calendarResolver{zones: zones, loc: loc}
+	cal := &Calendar{Method: strings.ToUpper(vcal.get("METHOD"))}
+	for _, c := range vcal.children {
+		switch c.name {
+		case "VEVENT":
+			if e, ok := r.event(c); ok {
+				cal.Events = append(cal.Events, e)
+			}
+		case "VFREEBUSY":
+			for _, p := range c.properties {
+				if p.name == "FREEBUSY" {
+					cal.FreeBusy = append(cal.FreeBusy, r.periods(p)...)
+				}
+			}
+		}
+	}
+	return cal, nil
+}
+
+// Returns the times during which the events and free/busy periods in this
+// calendar make someone busy, in UTC, sorted and with overlapping periods
+// of the same type merged. Cancelled and transparent events, and all events
+// of a CANCEL, do not count.
+func (c *Calendar) Busy() []BusyPeriod {
+	var r []BusyPeriod
+	for _, e := range c.Events {
+		if c.Method == "CANCEL" || e.Status == "CANCELLED" || e.Transparency == "TRANSPARENT" {
+			continue
+		}
+		t := "BUSY"
+		if e.Status == "TENTATIVE" {
+			t = "BUSY-TENTATIVE"
+		}
+		r = append(r, BusyPeriod{Start: e.Start.UTC(), End: e.End.UTC(), Type: t})
+	}
+	for _, p := range c.FreeBusy {
+		if p.Type != "FREE" {
+			r = append(r, BusyPeriod{Start: p.Start.UTC(), End: p.End.UTC(), Type: p.Type})
+		}
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Start.Before(r[j].Start)
+	})
+	merged := []BusyPeriod{}
+	for _, p := range r {
+		n := len(merged)
+		if n > 0 && merged[n-1].Type == p.Type && !p.Start.After(merged[n-1].End) {
+			if p.End.After(merged[n-1].End) {
+				merged[n-1].End = p.End
+			}
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// Returns the calendars in the text/calendar bodyparts of this message,
+// outside embedded messages, parsed as by ParseCalendar() with \a loc.
+// Bodyparts which cannot be parsed are skipped.
+func (m *Message) Calendars(loc *time.Location) []*Calendar {
+	r := []*Calendar{}
+	if m.Part == nil {
+		return r
+	}
+	var search func(p *Part)
+	search = func(p *Part) {
+		if p != m.Part && p.message != nil {
+			return
+		}
+		if len(p.Parts) == 0 && p.contentType() == "text/calendar" {
+			text := p.Text
+			if !p.hasText {
+				text, _ = p.data()
+			}
+			if c, err := ParseCalendar(text, loc); err == nil {
+				r = append(r, c)
+			}
+		}
+		for _, c := range p.Parts {
+			search(c)
+		}
+	}
+	search(m.Part)
+	return r
+}
+
+// Returns the logical lines of \a text, joining folded lines.
+func unfoldCalendarLines(text string) []string {
+	var r []string
+	for _, l := range splitLines(text) {
+		if (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) && len(r) > 0 {
+			r[len(r)-1] += l[1:]
+		} else if l != "" {
+			r = append(r, l)
+		}
+	}
+	return r
+}
+
+// Parses the content line \a l, e.g. "DTSTART;TZID="W. Europe Standard
+// Time":20261005T100000".
+func parseCalendarLine(l string) (calendarLine, bool) {
+	cl := calendarLine{params: map[string]string{}}
+	quoted := false
+	colon := -1
+	for i := 0; i < len(l) && colon < 0; i++ {
+		switch l[i] {
+		case '"':
+			quoted = !quoted
+		case ':':
+			if !quoted {
+				colon = i
+			}
+		}
+	}
+	if colon < 0 {
+		return cl, false
+	}
+	cl.value = l[colon+1:]
+	head := l[:colon]
+	parts := []string{}
+	quoted = false
+	start := 0
+	for i := 0; i < len(head); i++ {
+		switch head[i] {
+		case '"':
+			quoted = !quoted
+		case ';':
+			if !quoted {
+				parts = append(parts, head[start:i])
+				start = i + 1
+			}
+		}
+	}
+	parts = append(parts, head[start:])
+	cl.name = strings.ToUpper(parts[0])
+	for _, p := range parts[1:] {
+		if i := strings.IndexByte(p, '='); i > 0 {
+			cl.params[strings.ToUpper(p[:i])] = strings.Trim(p[i+1:], "\"")
+		}
+	}
+	return cl, true
+}
+
+// Returns the text value \a s with its escapes (RFC 5545 section 3.3.11)
+// decoded.
+func calendarText(s string) string {
+	return strings.NewReplacer("\\n", "\n", "\\N", "\n", "\\,", ",", "\\;", ";", "\\\\", "\\").Replace(s)
+}
+
+// A calendarResolver turns DATE and DATE-TIME values into absolute times.
+type calendarResolver struct {
+	zones map[string]*calendarZone
+	loc   *time.Location
+}
+
+// Returns the event described by \a c, and true, or false if it lacks a
+// valid start.
+func (r *calendarResolver) event(c *calendarComponent) (CalendarEvent, bool) {
+	e := CalendarEvent{
+		UID:          c.get("UID"),
+		Summary:      calendarText(c.get("SUMMARY")),
+		Location:     calendarText(c.get("LOCATION")),
+		Status:       strings.ToUpper(c.get("STATUS")),
+		Transparency: strings.ToUpper(c.get("TRANSP")),
+	}
+	e.Sequence, _ = strconv.Atoi(c.get("SEQUENCE"))
+	if o := c.get("ORGANIZER"); o != "" {
+		if strings.HasPrefix(strings.ToLower(o), "mailto:") {
+			o = o[len("mailto:"):]
+		}
+		e.Organizer = o
+	}
+	start := c.property("DTSTART")
+	if start == nil {
+		return e, false
+	}
+	var ok bool
+	if e.Start, e.AllDay, ok = r.time(start); !ok {
+		return e, false
+	}
+	if end := c.property("DTEND"); end != nil {
+		e.End, _, ok = r.time(end)
+	} else if d, valid := parseCalendarDuration(c.get("DURATION")); valid {
+		e.End, ok = e.Start.Add(d), true
+		if e.AllDay && d%(24*time.Hour) == 0 {
+			e.End = e.Start.AddDate(0, 0, int(d/(24*time.Hour)))
+		}
+	} else {
+		ok = false
+	}
+	if !ok {
+		// RFC 5545 section 3.6.1: a date lasts one day, a date-time
+		// none
+		e.End = e.Start
+		if e.AllDay {
+			e.End = e.Start.AddDate(0, 0, 1)
+		}
+	}
+	return e, true
+}
+
+// Returns the periods in the FREEBUSY property \a p.
+func (r *calendarResolver) periods(p calendarLine) []BusyPeriod {
+	t := strings.ToUpper(p.params["FBTYPE"])
+	if t == "" {
+		t = "BUSY"
+	}
+	var result []BusyPeriod
+	for _, v := range strings.Split(p.value, ",") {
+		i := strings.IndexByte(v, '/')
+		if i < 0 {
+			continue
+		}
+		start, _, ok := r.value(v[:i], "", false)
+		if !ok {
+			continue
+		}
+		end, _, ok := r.value(v[i+1:], "", false)
+		if !ok {
+			d, valid := parseCalendarDuration(v[i+1:])
+			if !valid {
+				continue
+			}
+			end = start.Add(d)
+		}
+		result = append(result, BusyPeriod{Start: start, End: end, Type: t})
+	}
+	return result
+}
+
+// Returns the time given by the DATE or DATE-TIME property \a l, and
+// whether it is a date.
+func (r *calendarResolver) time(l *calendarLine) (time.Time, bool, bool) {
+	return r.value(l.value, l.params["TZID"], strings.EqualFold(l.params["VALUE"], "DATE"))
+}
+
+// Returns the time given by the DATE or DATE-TIME value \a v with the time
+// zone \a tzid, whether it is a date, and whether it is valid.
+func (r *calendarResolver) value(v, tzid string, date bool) (time.Time, bool, bool) {
+	if date || len(v) == 8 {
+		t, err := time.ParseInLocation("20060102", v, r.loc)
+		return t, true, err == nil
+	}
+	if strings.HasSuffix(v, "Z") {
+		t, err := time.Parse("20060102T150405Z", v)
+		return t, false, err == nil
+	}
+	local, err := time.Parse("20060102T150405", v)
+	if err != nil {
+		return time.Time{}, false, false
+	}
+	if z := r.zones[tzid]; z != nil {
+		return z.resolve(local), false, true
+	}
+	loc := r.loc
+	if tzid != "" {
+		if l, err := time.LoadLocation(tzid); err == nil {
+			loc = l
+		}
+	}
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(),
+		local.Minute(), local.Second(), 0, loc), false, true
+}
+
+// Parses the DURATION value \a s, e.g. "PT1H30M" or "-P1W".
+func parseCalendarDuration(s string) (time.Duration, bool) {
+	sign := time.Duration(1)
+	if strings.HasPrefix(s, "-") {
+		sign = -1
+		s = s[1:]
+	}
+	s = strings.TrimPrefix(s, "+")
+	if !strings.HasPrefix(s, "P") || len(s) < 3 {
+		return 0, false
+	}
+	var d time.Duration
+	n := 0
+	digits := false
+	inTime := false
+	for _, c := range s[1:] {
+		switch {
+		case c >= '0' && c <= '9':
+			n = n*10 + int(c-'0')
+			digits = true
+			continue
+		case c == 'T':
+			inTime = true
+			continue
+		}
+		if !digits {
+			return 0, false
+		}
+		unit := map[rune]time.Duration{'W': 7 * 24 * time.Hour, 'D': 24 * time.Hour}
+		if inTime {
+			unit = map[rune]time.Duration{'H': time.Hour, 'M': time.Minute, 'S': time.Second}
+		}
+		u, ok := unit[c]
+		if !ok {
+			return 0, false
+		}
+		d += time.Duration(n) * u
+		n = 0
+		digits = false
+	}
+	if digits {
+		return 0, false
+	}
+	return sign * d, true
+}
+
+// A calendarZone is a VTIMEZONE: the observances which determine its UTC
+// offset at any time.
+type calendarZone struct {
+	id          string
+	observances []calendarObservance
+}
+
+// A calendarObservance is a STANDARD or DAYLIGHT component: from each
+// onset on, the zone's offset is offsetTo, until the next onset of any
+// observance. The onsets are start and those given by the yearly rule
+// (month, and either day or week and weekday) until until, and dates.
+type calendarObservance struct {
+	name       string
+	start      time.Time
+	offsetFrom int
+	offsetTo   int
+	yearly     bool
+	month      time.Month
+	day        int
+	week       int
+	weekday    time.Weekday
+	until      time.Time
+	dates      []time.Time
+}
+
+// Returns the zone described by the VTIMEZONE \a c, or nil if it has no
+// TZID or no usable observance.
+func newCalendarZone(c *calendarComponent) *calendarZone {
+	z := &calendarZone{id: c.get("TZID")}
+	for _, o := range c.children {
+		if o.name != "STANDARD" && o.name != "DAYLIGHT" {
+			continue
+		}
+		start, err := time.Parse("20060102T150405", o.get("DTSTART"))
+		from, ok1 := parseUTCOffset(o.get("TZOFFSETFROM"))
+		to, ok2 := parseUTCOffset(o.get("TZOFFSETTO"))
+		if err != nil || !ok1 || !ok2 {
+			continue
+		}
+		ob := calendarObservance{name: o.name, start: start, offsetFrom: from, offsetTo: to,
+			month: start.Month(), day: start.Day()}
+		for _, p := range o.properties {
+			if p.name == "RDATE" {
+				for _, v := range strings.Split(p.value, ",") {
+					if t, err := time.Parse("20060102T150405", v); err == nil {
+						ob.dates = append(ob.dates, t)
+					}
+				}
+			}
+		}
+		if rule := o.get("RRULE"); rule != "" && !ob.parseRule(rule) {
+			continue
+		}
+		z.observances = append(z.observances, ob)
+	}
+	if z.id == "" || len(z.observances) == 0 {
+		return nil
+	}
+	return z
+}
+
+// Parses the RRULE \a rule, which must be yearly, as time zone rules are.
+// Returns false if it is not understood.
+func (ob *calendarObservance) parseRule(rule string) bool {
+	weekdays := map[string]time.Weekday{"SU": time.Sunday, "MO": time.Monday,
+		"TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+		"FR": time.Friday, "SA": time.Saturday}
+	for _, part := range strings.Split(strings.ToUpper(rule), ";") {
+		i := strings.IndexByte(part, '=')
+		if i < 0 {
+			return false
+		}
+		k, v := part[:i], part[i+1:]
+		switch k {
+		case "FREQ":
+			if v != "YEARLY" {
+				return false
+			}
+			ob.yearly = true
+		case "BYMONTH":
+			n, err := strconv.Atoi(v)
+			if err != nil || n < 1 || n > 12 {
+				return false
+			}
+			ob.month = time.Month(n)
+		case "BYMONTHDAY":
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return false
+			}
+			ob.day, ob.week = n, 0
+		case "BYDAY":
+			if len(v) < 2 {
+				return false
+			}
+			wd, ok := weekdays[v[len(v)-2:]]
+			n, err := strconv.Atoi(strings.TrimPrefix(v[:len(v)-2], "+"))
+			if !ok || err != nil || n == 0 {
+				return false
+			}
+			ob.week, ob.weekday = n, wd
+		case "UNTIL":
+			t, err := time.Parse("20060102T150405Z", v)
+			if err != nil {
+				if t, err = time.Parse("20060102", v); err != nil {
+					return false
+				}
+			}
+			ob.until = t
+		}
+	}
+	return ob.yearly
+}
+
+// Returns the onset of this observance in \a year, as local time before
+// the change, and true, or false if there is none that year.
+func (ob *calendarObservance) onset(year int) (time.Time, bool) {
+	if !ob.yearly || year < ob.start.Year() {
+		return time.Time{}, false
+	}
+	h, m, s := ob.start.Clock()
+	var t time.Time
+	if ob.week == 0 {
+		t = time.Date(year, ob.month, ob.day, h, m, s, 0, time.UTC)
+	} else if ob.week > 0 {
+		t = time.Date(year, ob.month, 1, h, m, s, 0, time.UTC)
+		t = t.AddDate(0, 0, (int(ob.weekday)-int(t.Weekday())+7)%7+7*(ob.week-1))
+	} else {
+		t = time.Date(year, ob.month+1, 0, h, m, s, 0, time.UTC)
+		t = t.AddDate(0, 0, -((int(t.Weekday())-int(ob.weekday)+7)%7)+7*(ob.week+1))
+	}
+	if t.Month() != ob.month || !ob.until.IsZero() && t.Add(-time.Duration(ob.offsetFrom)*time.Second).After(ob.until) {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Returns the absolute time at which clocks in this zone showed \a local
+// (whose own zone is ignored), in a fixed zone with the offset then.
+func (z *calendarZone) resolve(local time.Time) time.Time {
+	// the latest onset at or before local, compared in local time as it
+	// was before each change; with no onset before, the earliest
+	// observance's offset before its start applies
+	var latest time.Time
+	offset := 0
+	found := false
+	earliest := z.observances[0]
+	for _, ob := range z.observances {
+		if ob.start.Before(earliest.start) {
+			earliest = ob
+		}
+		candidates := append([]time.Time{ob.start}, ob.dates...)
+		for _, y := range []int{local.Year() - 1, local.Year()} {
+			if t, ok := ob.onset(y); ok {
+				candidates = append(candidates, t)
+			}
+		}
+		for _, t := range candidates {
+			if !t.After(local) && (!found || t.After(latest)) {
+				latest, offset, found = t, ob.offsetTo, true
+			}
+		}
+	}
+	if !found {
+		offset = earliest.offsetFrom
+	}
+	zone := time.FixedZone(z.id, offset)
+	return time.Date(local.Year(), local.Month(), local.Day(), local.Hour(),
+		local.Minute(), local.Second(), 0, zone)
+}
+
+// Parses a UTC-OFFSET value such as "+0200" or "-053000", and returns it in
+// seconds east of UTC.
+func parseUTCOffset(s string) (int, bool) {
+	if len(s) != 5 && len(s) != 7 || s[0] != '+' && s[0] != '-' {
+		return 0, false
+	}
+	n := 0
+	for i, unit := range []int{3600, 60, 1} {
+		if 1+2*i >= len(s) {
+			break
+		}
+		v, err := strconv.Atoi(s[1+2*i : 3+2*i])
+		if err != nil {
+			return 0, false
+		}
+		n += v * unit
+	}
+	if s[0] == '-' {
+		n = -n
+	}
+	return n, true
+}
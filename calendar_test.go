@@ -0,0 +1,69 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestCalendar(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nMETHOD:REQUEST\r\nPRODID:Microsoft Exchange Server 2010\r\n" +
+		"BEGIN:VTIMEZONE\r\nTZID:W. Europe Standard Time\r\n" +
+		"BEGIN:STANDARD\r\nDTSTART:16010101T030000\r\nTZOFFSETFROM:+0200\r\n" +
+		"TZOFFSETTO:+0100\r\nRRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=10\r\nEND:STANDARD\r\n" +
+		"BEGIN:DAYLIGHT\r\nDTSTART:16010101T020000\r\nTZOFFSETFROM:+0100\r\n" +
+		"TZOFFSETTO:+0200\r\nRRULE:FREQ=YEARLY;INTERVAL=1;BYDAY=-1SU;BYMONTH=3\r\nEND:DAYLIGHT\r\n" +
+		"END:VTIMEZONE\r\n" +
+		"BEGIN:VEVENT\r\nUID:one\r\nSUMMARY;LANGUAGE=en-US:Quarterly review\\, part\r\n  one\r\n" +
+		"ORGANIZER;CN=\"Doe; Jane\":mailto:jane@example.com\r\n" +
+		"DTSTART;TZID=\"W. Europe Standard Time\":20261005T100000\r\n" +
+		"DTEND;TZID=\"W. Europe Standard Time\":20261005T113000\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:two\r\nSTATUS:TENTATIVE\r\n" +
+		"DTSTART;TZID=W. Europe Standard Time:20261102T100000\r\nDURATION:PT1H\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:three\r\nDTSTART;VALUE=DATE:20261224\r\nTRANSP:TRANSPARENT\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nUID:four\r\nDTSTART:20261005T090000Z\r\nDTEND:20261005T120000Z\r\nEND:VEVENT\r\n" +
+		"BEGIN:VFREEBUSY\r\nFREEBUSY;FBTYPE=BUSY-UNAVAILABLE:20261006T080000Z/PT8H,20261007T080000Z/20261007T090000Z\r\n" +
+		"END:VFREEBUSY\r\nEND:VCALENDAR\r\n"
+	m, err := mail.ReadMessage("From: jane@example.com\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/alternative; boundary=b\r\n\r\n--b\r\n" +
+		"Content-Type: text/plain\r\n\r\nReview\r\n--b\r\n" +
+		"Content-Type: text/calendar; method=REQUEST; charset=utf-8\r\n\r\n" + ics + "\r\n--b--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cals := m.Calendars(nil)
+	testIntegerEquals(t, "calendars", len(cals), 1)
+	c := cals[0]
+	testStringEquals(t, "method", c.Method, "REQUEST")
+	testIntegerEquals(t, "events", len(c.Events), 4)
+	e := c.Events[0]
+	testStringEquals(t, "summary", e.Summary, "Quarterly review, part one")
+	testStringEquals(t, "organizer", e.Organizer, "jane@example.com")
+	testStringEquals(t, "summer", e.Start.Format(time.RFC3339), "2026-10-05T10:00:00+02:00")
+	testStringEquals(t, "summer end", e.End.UTC().Format(time.RFC3339), "2026-10-05T09:30:00Z")
+	testStringEquals(t, "winter", c.Events[1].Start.UTC().Format(time.RFC3339), "2026-11-02T09:00:00Z")
+	testStringEquals(t, "duration", c.Events[1].End.UTC().Format(time.RFC3339), "2026-11-02T10:00:00Z")
+	if !c.Events[2].AllDay || c.Events[2].End.Sub(c.Events[2].Start) != 24*time.Hour {
+		t.Errorf("all-day event: %v", c.Events[2])
+	}
+
+	busy := []string{}
+	for _, p := range c.Busy() {
+		busy = append(busy, p.Start.Format("02T15:04")+"-"+p.End.Format("02T15:04")+" "+p.Type)
+	}
+	testStringEquals(t, "busy", strings.Join(busy, ", "),
+		"05T08:00-05T12:00 BUSY, 06T08:00-06T16:00 BUSY-UNAVAILABLE, "+
+			"07T08:00-07T09:00 BUSY-UNAVAILABLE, 02T09:00-02T10:00 BUSY-TENTATIVE")
+
+	if _, err := mail.ParseCalendar("BEGIN:VCARD\r\nEND:VCARD\r\n", nil); err == nil {
+		t.Error("vCard accepted as a calendar")
+	}
+	// the hour that does not exist when clocks go forward, and the switch
+	// back
+	z, _ := mail.ParseCalendar(strings.Replace(ics, "20261005T100000", "20260329T020000", 1), nil)
+	testStringEquals(t, "spring", z.Events[0].Start.UTC().Format(time.RFC3339), "2026-03-29T00:00:00Z")
+	z, _ = mail.ParseCalendar(strings.Replace(ics, "20261005T100000", "20261025T030000", 1), nil)
+	testStringEquals(t, "autumn", z.Events[0].Start.UTC().Format(time.RFC3339), "2026-10-25T02:00:00Z")
+}
@@ -0,0 +1,273 @@
+package mail
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Returns the name of the character set \a s, the undecoded text of a
+// bodypart which declares none, most likely uses, and a confidence between
+// 1 and 100, or an empty string and 0 if nothing is plausible.
+//
+// A byte order mark, ISO-2022-JP escape sequences, pure ASCII and valid
+// UTF-8 are recognised with certainty, as is UTF-16 without a byte order
+// mark, whose alternate bytes are mostly NULs. Other text is tried as the
+// legacy encodings of Western European (windows-1252) and Russian
+// (windows-1251, koi8-r) text, and of Japanese (shift_jis, euc-jp), Chinese
+// (gb2312, big5) and Korean (euc-kr) text, and the one producing the most
+// plausible text wins: for the double-byte encodings, the one in which the
+// most common characters of the language occur most often; for the others,
+// the one whose words are the most consistent in script and case.
+func DetectCharset(s string) (string, int) {
+	switch {
+	case strings.HasPrefix(s, "\xef\xbb\xbf"):
+		return "utf-8", 100
+	case strings.HasPrefix(s, "\xff\xfe"):
+		return "utf-16le", 100
+	case strings.HasPrefix(s, "\xfe\xff"):
+		return "utf-16be", 100
+	}
+	ascii := true
+	for i := 0; i < len(s) && ascii; i++ {
+		ascii = s[i] < 128
+	}
+	if ascii {
+		if strings.Contains(s, "\x1b$B") || strings.Contains(s, "\x1b$@") ||
+			strings.Contains(s, "\x1b(J") || strings.Contains(s, "\x1b(I") {
+			return "iso-2022-jp", 100
+		}
+		return "us-ascii", 100
+	}
+	if utf8.ValidString(s) {
+		return "utf-8", 100
+	}
+	if cs := detectUTF16(s); cs != "" {
+		return cs, 100
+	}
+
+	best, score := "", 0.0
+	for _, c := range doubleByteCharsets {
+		if r := c.score(s); r > score {
+			best, score = c.name, r
+		}
+	}
+	// text in a double-byte encoding is rarely plausible as single-byte
+	// text and vice versa, but a few frequent characters are not enough
+	if score < 0.1 {
+		best, score = "", 0
+		for _, c := range singleByteCharsets {
+			if r := c.score(s); r > score {
+				best, score = c.name, r
+			}
+		}
+	}
+	if best == "" {
+		return "", 0
+	}
+	confidence := int(score * 100)
+	if confidence < 1 {
+		confidence = 1
+	}
+	return best, confidence
+}
+
+// Returns "utf-16le" or "utf-16be" if \a s looks like UTF-16 text without a
+// byte order mark, i.e. mostly Latin text with a NUL next to each
+// character, and an empty string if not.
+func detectUTF16(s string) string {
+	if len(s) < 4 || len(s)%2 != 0 {
+		return ""
+	}
+	even, odd := 0, 0
+	for i := 0; i < len(s); i += 2 {
+		if s[i] == 0 {
+			even++
+		}
+		if s[i+1] == 0 {
+			odd++
+		}
+	}
+	n := len(s) / 2
+	switch {
+	case odd*10 > n*6 && even*10 < n:
+		return "utf-16le"
+	case even*10 > n*6 && odd*10 < n:
+		return "utf-16be"
+	}
+	return ""
+}
+
+// A singleByteCharset maps the bytes 0x80 and above to Unicode; the bytes
+// below are ASCII.
+type singleByteCharset struct {
+	name  string
+	high  []rune
+	latin bool
+}
+
+var singleByteCharsets = []*singleByteCharset{
+	{"windows-1252", []rune("€�‚ƒ„…†‡ˆ‰Š‹Œ�Ž��‘’“”•–—˜™š›œ�žŸ" +
+		"\u00a0¡¢£¤¥¦§¨©ª«¬\u00ad®¯°±²³´µ¶·¸¹º»¼½¾¿" +
+		"ÀÁÂÃÄÅÆÇÈÉÊËÌÍÎÏÐÑÒÓÔÕÖ×ØÙÚÛÜÝÞßàáâãäåæçèéêëìíîïðñòóôõö÷øùúûüýþÿ"), true},
+	{"windows-1251", []rune("ЂЃ‚ѓ„…†‡€‰Љ‹ЊЌЋЏђ‘’“”•–—�™љ›њќћџ" +
+		"\u00a0ЎўЈ¤Ґ¦§Ё©Є«¬\u00ad®Ї°±Ііґµ¶·ё№є»јЅѕї" +
+		"АБВГДЕЖЗИЙКЛМНОПРСТУФХЦЧШЩЪЫЬЭЮЯабвгдежзийклмнопрстуфхцчшщъыьэюя"), false},
+	{"koi8-r", []rune("─│┌┐└┘├┤┬┴┼▀▄█▌▐░▒▓⌠■∙√≈≤≥\u00a0⌡°²·÷" +
+		"═║╒ё╓╔╕╖╗╘╙╚╛╜╝╞╟╠╡Ё╢╣╤╥╦╧╨╩╪╫╬©" +
+		"юабцдефгхийклмнопярстужвьызшэщчъЮАБЦДЕФГХИЙКЛМНОПЯРСТУЖВЬЫЗШЭЩЧЪ"), false},
+}
+
+// Returns the rune the byte \a b stands for in this character set.
+func (c *singleByteCharset) rune(b byte) rune {
+	if b < 128 {
+		return rune(b)
+	}
+	return c.high[b-128]
+}
+
+// Returns how plausible \a s is as text in this character set, between -1
+// and 1. Adjacent letters count against it if one of them is not ASCII and
+// they are of different scripts, if a capital follows a small letter, or
+// (in Latin text, where accents are sparse) if both are accented, and for
+// it if the second is a small letter. Unassigned bytes count against it
+// twice, and symbols between letters once.
+func (c *singleByteCharset) score(s string) float64 {
+	good, bad := 0, 0
+	for i := 0; i < len(s); i++ {
+		r := c.rune(s[i])
+		if r == utf8.RuneError {
+			bad += 2
+			continue
+		}
+		if i == 0 {
+			continue
+		}
+		p := c.rune(s[i-1])
+		if s[i] < 128 && s[i-1] < 128 {
+			continue
+		}
+		if unicode.IsSymbol(r) && unicode.IsLetter(p) && i+1 < len(s) &&
+			unicode.IsLetter(c.rune(s[i+1])) {
+			bad++
+			continue
+		}
+		if !unicode.IsLetter(p) || !unicode.IsLetter(r) {
+			continue
+		}
+		switch {
+		case unicode.Is(unicode.Cyrillic, p) != unicode.Is(unicode.Cyrillic, r):
+			bad++
+		case unicode.IsLower(p) && unicode.IsUpper(r):
+			bad++
+		case c.latin && s[i] >= 128 && s[i-1] >= 128:
+			bad++
+		case unicode.IsLower(r):
+			good++
+		}
+	}
+	if good+bad == 0 {
+		return 0
+	}
+	return float64(good-bad) / float64(good+bad)
+}
+
+// A doubleByteCharset is an encoding of CJK text in which bytes below 0x80
+// are ASCII, single bytes accepted by single (if not nil) stand alone, and
+// other characters are a lead byte and a trail byte. Text in the language
+// uses the characters in frequent (concatenated two-byte sequences) often,
+// as it does those whose lead byte is accepted by frequentLead.
+type doubleByteCharset struct {
+	name         string
+	single       func(b byte) bool
+	lead         func(b byte) bool
+	trail        func(b byte) bool
+	frequent     string
+	frequentLead func(b byte) bool
+}
+
+// Returns 0 if \a s is not valid in this character set, and otherwise the
+// proportion of its two-byte characters which are frequent, doubled, up to
+// 1.
+func (c *doubleByteCharset) score(s string) float64 {
+	n, hits := 0, 0
+	for i := 0; i < len(s); i++ {
+		b := s[i]
+		switch {
+		case b < 128 || c.single != nil && c.single(b):
+		case c.lead(b) && i+1 < len(s) && c.trail(s[i+1]):
+			n++
+			if c.frequentLead != nil && c.frequentLead(b) ||
+				c.isFrequent(s[i:i+2]) {
+				hits++
+			}
+			i++
+		default:
+			return 0
+		}
+	}
+	if n < 2 {
+		return 0
+	}
+	r := 2 * float64(hits) / float64(n)
+	if r > 1 {
+		r = 1
+	}
+	return r
+}
+
+// Returns true if the two-byte character \a ch is one of the frequent ones.
+func (c *doubleByteCharset) isFrequent(ch string) bool {
+	for i := 0; i+1 < len(c.frequent); i += 2 {
+		if c.frequent[i:i+2] == ch {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns a function accepting bytes from \a lo to \a hi inclusive.
+func byteRange(lo, hi byte) func(b byte) bool {
+	return func(b byte) bool {
+		return b >= lo && b <= hi
+	}
+}
+
+var doubleByteCharsets = []*doubleByteCharset{
+	// Japanese text is largely hiragana and katakana
+	{name: "shift_jis", single: byteRange(0xa1, 0xdf),
+		lead: func(b byte) bool { return b >= 0x81 && b <= 0x9f || b >= 0xe0 && b <= 0xfc },
+		trail: func(b byte) bool {
+			return b >= 0x40 && b <= 0x7e || b >= 0x80 && b <= 0xfc
+		},
+		frequentLead: byteRange(0x82, 0x83)},
+	{name: "euc-jp", single: func(b byte) bool { return b == 0x8f },
+		lead:  func(b byte) bool { return b == 0x8e || b >= 0xa1 && b <= 0xfe },
+		trail: byteRange(0xa1, 0xfe), frequentLead: byteRange(0xa4, 0xa5)},
+	// 的一是不了在人有我他这个们中来上大为和国地到以说时要就出会可也你
+	// 对生能而子那得于着下自之年过发后作里
+	{name: "gb2312", lead: byteRange(0xa1, 0xf7), trail: byteRange(0xa1, 0xfe),
+		frequent: "\xb5\xc4\xd2\xbb\xca\xc7\xb2\xbb\xc1\xcb\xd4\xda\xc8\xcb\xd3\xd0" +
+			"\xce\xd2\xcb\xfb\xd5\xe2\xb8\xf6\xc3\xc7\xd6\xd0\xc0\xb4\xc9\xcf" +
+			"\xb4\xf3\xce\xaa\xba\xcd\xb9\xfa\xb5\xd8\xb5\xbd\xd2\xd4\xcb\xb5" +
+			"\xca\xb1\xd2\xaa\xbe\xcd\xb3\xf6\xbb\xe1\xbf\xc9\xd2\xb2\xc4\xe3" +
+			"\xb6\xd4\xc9\xfa\xc4\xdc\xb6\xf8\xd7\xd3\xc4\xc7\xb5\xc3\xd3\xda" +
+			"\xd7\xc5\xcf\xc2\xd7\xd4\xd6\xae\xc4\xea\xb9\xfd\xb7\xa2\xba\xf3" +
+			"\xd7\xf7\xc0\xef"},
+	// the same in traditional characters
+	{name: "big5", lead: byteRange(0xa1, 0xf9),
+		trail: func(b byte) bool { return b >= 0x40 && b <= 0x7e || b >= 0xa1 && b <= 0xfe },
+		frequent: "\xaa\xba\xa4\x40\xac\x4f\xa4\xa3\xa4\x46\xa6\x62\xa4\x48\xa6\xb3" +
+			"\xa7\xda\xa5\x4c\xb3\x6f\xad\xd3\xad\xcc\xa4\xa4\xa8\xd3\xa4\x57" +
+			"\xa4\x6a\xac\xb0\xa9\x4d\xb0\xea\xa6\x61\xa8\xec\xa5\x48\xbb\xa1" +
+			"\xae\xc9\xad\x6e\xb4\x4e\xa5\x58\xb7\x7c\xa5\x69\xa4\x5d\xa7\x41" +
+			"\xb9\xef\xa5\xcd\xaf\xe0\xa6\xd3\xa4\x6c\xa8\xba\xb1\x6f\xa9\xf3" +
+			"\xb5\xdb\xa4\x55\xa6\xdb\xa4\xa7\xa6\x7e\xb9\x4c\xb5\x6f\xab\xe1" +
+			"\xa7\x40\xb8\xcc"},
+	// 이다는의에하고가을지서로한기리도사시자니들해게으나정대수어일보
+	{name: "euc-kr", lead: byteRange(0xa1, 0xfe), trail: byteRange(0xa1, 0xfe),
+		frequent: "\xc0\xcc\xb4\xd9\xb4\xc2\xc0\xc7\xbf\xa1\xc7\xcf\xb0\xed\xb0\xa1" +
+			"\xc0\xbb\xc1\xf6\xbc\xad\xb7\xce\xc7\xd1\xb1\xe2\xb8\xae\xb5\xb5" +
+			"\xbb\xe7\xbd\xc3\xc0\xda\xb4\xcf\xb5\xe9\xc7\xd8\xb0\xd4\xc0\xb8" +
+			"\xb3\xaa\xc1\xa4\xb4\xeb\xbc\xf6\xbe\xee\xc0\xcf\xba\xb8"},
+}
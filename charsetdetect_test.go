@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDetectCharset(t *testing.T) {
+	cases := []struct {
+		charset string
+		text    string
+	}{
+		{"us-ascii", "Hello"},
+		{"utf-8", "caf\xc3\xa9"},
+		{"utf-8", "\xef\xbb\xbfcaf\xe9"},
+		{"utf-16le", "c\x00a\x00f\x00\xe9\x00"},
+		{"iso-2022-jp", "\x1b$B$3$s$K$A$O\x1b(B"},
+		{"windows-1252", "Gr\xfc\xdfe aus M\xfcnchen, \xe0 bient\xf4t!"},
+		{"windows-1251", "\xcf\xf0\xe8\xe2\xe5\xf2! \xca\xe0\xea \xf3 \xe2\xe0\xf1 \xe4\xe5\xeb\xe0? " +
+			"\xcd\xe0\xe4\xe5\xfe\xf1\xfc, \xe2\xf1\xb8 \xf5\xee\xf0\xee\xf8\xee."},
+		{"koi8-r", "\xf0\xd2\xc9\xd7\xc5\xd4! \xeb\xc1\xcb \xd5 \xd7\xc1\xd3 \xc4\xc5\xcc\xc1? " +
+			"\xee\xc1\xc4\xc5\xc0\xd3\xd8, \xd7\xd3\xa3 \xc8\xcf\xd2\xcf\xdb\xcf."},
+		{"shift_jis", "\x82\xb1\x82\xf1\x82\xc9\x82\xbf\x82\xcd\x81B\x82\xa8\x8c\xb3\x8bC" +
+			"\x82\xc5\x82\xb7\x82\xa9\x81H\x89\xef\x8bc\x82\xcd\x96\xbe\x93\xfa\x82\xcc" +
+			"\x8c\xdf\x8c\xe3\x82\xc5\x82\xb7\x81B"},
+		{"euc-jp", "\xa4\xb3\xa4\xf3\xa4\xcb\xa4\xc1\xa4\xcf\xa1\xa3\xa4\xaa\xb8\xb5\xb5\xa4" +
+			"\xa4\xc7\xa4\xb9\xa4\xab\xa1\xa9\xb2\xf1\xb5\xc4\xa4\xcf\xcc\xc0\xc6\xfc\xa4\xce" +
+			"\xb8\xe1\xb8\xe5\xa4\xc7\xa4\xb9\xa1\xa3"},
+		{"gb2312", "\xce\xd2\xc3\xc7\xc3\xf7\xcc\xec\xcf\xc2\xce\xe7\xd4\xda\xb9\xab\xcb\xbe" +
+			"\xbf\xaa\xbb\xe1\xa3\xac\xc4\xe3\xd3\xd0\xca\xb1\xbc\xe4\xc2\xf0\xa3\xbf"},
+		{"big5", "\xa7\xda\xad\xcc\xa9\xfa\xa4\xd1\xa4U\xa4\xc8\xa6b\xa4\xbd\xa5q\xb6}\xb7|" +
+			"\xa1A\xa7A\xa6\xb3\xae\xc9\xb6\xa1\xb6\xdc\xa1H"},
+		{"euc-kr", "\xbe\xc8\xb3\xe7\xc7\xcf\xbc\xbc\xbf\xe4. \xb3\xbb\xc0\xcf \xc8\xb8\xc0\xc7" +
+			"\xb0\xa1 \xc0\xd6\xbd\xc0\xb4\xcf\xb4\xd9. \xbd\xc3\xb0\xa3\xc0\xcc \xb5\xc7" +
+			"\xbd\xc3\xb3\xaa\xbf\xe4?"},
+	}
+	for _, c := range cases {
+		cs, _ := mail.DetectCharset(c.text)
+		testStringEquals(t, "charset of "+c.charset+" text", cs, c.charset)
+	}
+
+	m, err := mail.ReadMessage("From: a@example.com\r\n" +
+		"Subject: Guessing\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"Cr\xe8me br\xfbl\xe9e au caf\xe9\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "text", m.Text, "Crème brûlée au café\r\n")
+	testStringEquals(t, "Content-Type", m.Header.ContentType().Value(), "text/plain; charset=windows-1252")
+	found := false
+	for _, d := range m.Diagnostics() {
+		found = found || d.Code == mail.DiagnosticCharsetGuessed
+	}
+	if !found {
+		t.Errorf("no %s diagnostic in %v", mail.DiagnosticCharsetGuessed, m.Diagnostics())
+	}
+}
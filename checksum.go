@@ -0,0 +1,107 @@
+package mail
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const (
+	XChecksumFieldName = "X-Checksum"
+)
+
+// Returns the RFC 1864 Content-MD5 value of this bodypart: the base64-encoded
+// MD5 digest of its decoded content, with the lines of text converted to
+// CRLF form. Returns an empty string for multiparts and embedded messages,
+// which RFC 1864 does not cover.
+func (p *Part) ContentMD5() string {
+	content, ok := p.checksummedContent()
+	if !ok {
+		return ""
+	}
+	sum := md5.Sum([]byte(content))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// Returns the value of an X-Checksum field for this bodypart, "sha256="
+// followed by the hex SHA-256 digest of the content ContentMD5() digests,
+// or an empty string for multiparts and embedded messages.
+func (p *Part) Checksum() string {
+	content, ok := p.checksummedContent()
+	if !ok {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(content))
+	return "sha256=" + hex.EncodeToString(sum[:])
+}
+
+// Adds Content-MD5 fields if \a md5 is true and X-Checksum fields if \a sha256
+// is true to this bodypart and each of its descendants which is neither a
+// multipart nor an embedded message, replacing any such fields already
+// present. Embedded messages are left as they are.
+func (p *Part) addChecksums(md5, sha256 bool) {
+	if p.message != nil {
+		return
+	}
+	for _, c := range p.Parts {
+		c.addChecksums(md5, sha256)
+	}
+	if _, ok := p.checksummedContent(); !ok || p.Header == nil {
+		return
+	}
+	if md5 {
+		p.Header.RemoveAllNamed(ContentMd5FieldName)
+		p.Header.Add(ContentMd5FieldName, p.ContentMD5())
+	}
+	if sha256 {
+		p.Header.RemoveAllNamed(XChecksumFieldName)
+		p.Header.Add(XChecksumFieldName, p.Checksum())
+	}
+}
+
+// Returns the content of this bodypart as RFC 1864 defines it for
+// checksumming, and true, or false if it is a multipart or an embedded
+// message.
+func (p *Part) checksummedContent() (string, bool) {
+	var ct *ContentType
+	if p.Header != nil {
+		ct = p.Header.ContentType()
+	}
+	if p.message != nil || ct != nil && (ct.Type == "multipart" || ct.Type == "message") {
+		return "", false
+	}
+	if ct == nil || ct.Type == "text" {
+		return toCRLF(p.Text), true
+	}
+	s, _ := p.data()
+	return s, true
+}
+
+// Compares the Content-MD5 and X-Checksum fields of this header, if any,
+// with \a content, the decoded content of the bodypart as it was received,
+// and records a diagnostic for each which does not match.
+func (h *Header) checkChecksums(content string) {
+	if f := h.field(ContentMd5FieldName, 0); f != nil {
+		sum := md5.Sum([]byte(content))
+		if strings.TrimSpace(f.Value()) != base64.StdEncoding.EncodeToString(sum[:]) {
+			h.addDiagnostic(DiagnosticContentMD5Mismatch, SeverityError, f,
+				"does not match the content")
+		}
+	}
+	if f := h.field(XChecksumFieldName, 0); f != nil {
+		v := strings.TrimSpace(f.Value())
+		eq := strings.IndexByte(v, '=')
+		if eq < 0 || !strings.EqualFold(v[:eq], "sha256") {
+			h.addDiagnostic(DiagnosticChecksumMismatch, SeverityInfo, f,
+				"unsupported checksum %q", v)
+			return
+		}
+		sum := sha256.Sum256([]byte(content))
+		if !strings.EqualFold(v[eq+1:], hex.EncodeToString(sum[:])) {
+			h.addDiagnostic(DiagnosticChecksumMismatch, SeverityError, f,
+				"does not match the content")
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestChecksums(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("Subject", "Checksums")
+	c.Text = "Hello\nBob\n"
+	c.Attach("data.bin", "application/octet-stream", "\x00\x01\x02binary")
+	c.ContentMD5 = true
+	c.Checksums = true
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := m.RFC822(false)
+	// RFC 1864 checksums text in CRLF form
+	testStringEquals(t, "text md5", m.Parts[0].Header.Get(mail.ContentMd5FieldName),
+		"lYCB2CfCsgXtxH10xYMDjw==")
+
+	parsed, err := mail.ReadMessage(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "diagnostics", len(parsed.Diagnostics()), 0)
+	for _, p := range parsed.Parts {
+		testStringEquals(t, "md5", p.ContentMD5(), p.Header.Get(mail.ContentMd5FieldName))
+		testStringEquals(t, "sha256", p.Checksum(), p.Header.Get(mail.XChecksumFieldName))
+	}
+	if parsed.Header.Get(mail.ContentMd5FieldName) != "" {
+		t.Error("multipart has a Content-MD5 field")
+	}
+
+	parsed, err = mail.ReadMessage(strings.Replace(text, "Bob", "Eve", 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := parsed.Diagnostics()
+	if len(d) != 2 {
+		t.Fatalf("expected two diagnostics, got %v", d)
+	}
+	testStringEquals(t, "code", d[0].Code, mail.DiagnosticContentMD5Mismatch)
+	testStringEquals(t, "code", d[1].Code, mail.DiagnosticChecksumMismatch)
+	testStringEquals(t, "part", d[0].Part, "1")
+}
@@ -0,0 +1,185 @@
+package mail
+
+import (
+	"bufio"
+	"io"
+	"strings"
+	"sync"
+)
+
+// Local parts which name a function rather than a person: those required or
+// suggested by RFC 2142, and others in common use, including the no-reply
+// addresses of automated senders.
+var roleLocalparts = []string{
+	"abuse", "admin", "administrator", "billing", "bounce", "bounces",
+	"compliance", "contact", "do-not-reply", "donotreply", "dmarc",
+	"enquiries", "feedback", "ftp", "help", "hostmaster", "hr", "info",
+	"inquiries", "jobs", "legal", "list", "list-request", "mailer-daemon",
+	"marketing", "news", "newsletter", "no-reply", "noc", "noreply",
+	"notifications", "notify", "office", "orders", "postmaster", "press",
+	"privacy", "root", "sales", "security", "service", "support",
+	"sysadmin", "team", "usenet", "uucp", "webmaster", "www",
+}
+
+// An AddressClass says what kind of mailbox an address is likely to be.
+//
+// Role is true if the local part names a function (e.g. postmaster or
+// noreply) rather than a person; RoleName is then that function. FreeMail is
+// true if the domain is a free mail provider, such as gmail.com, and
+// Disposable if it hands out throwaway addresses, such as mailinator.com.
+// Domain is the domain which matched, which may be a parent of the address's
+// domain.
+type AddressClass struct {
+	Role       bool   `json:"role"`
+	RoleName   string `json:"roleName,omitempty"`
+	FreeMail   bool   `json:"freeMail"`
+	Disposable bool   `json:"disposable"`
+	Domain     string `json:"domain,omitempty"`
+}
+
+// An AddressClassifier classifies addresses using lists of role local parts,
+// free mail domains and disposable domains. The lists may be extended at
+// run time, e.g. from a file which is updated more often than this package.
+// An AddressClassifier is safe for concurrent use.
+type AddressClassifier struct {
+	mu         sync.RWMutex
+	roles      map[string]bool
+	freeMail   map[string]bool
+	disposable map[string]bool
+}
+
+// Returns a new AddressClassifier using the lists built into this package.
+// generate-domainlists.sh regenerates the built-in domain lists.
+func NewAddressClassifier() *AddressClassifier {
+	c := &AddressClassifier{
+		roles:      map[string]bool{},
+		freeMail:   map[string]bool{},
+		disposable: map[string]bool{},
+	}
+	c.AddRoles(roleLocalparts...)
+	c.AddFreeMail(freeMailDomains...)
+	c.AddDisposable(disposableDomains...)
+	return c
+}
+
+// Adds \a localparts to the role local parts.
+func (c *AddressClassifier) AddRoles(localparts ...string) {
+	c.add(c.roles, localparts)
+}
+
+// Adds \a domains to the free mail domains.
+func (c *AddressClassifier) AddFreeMail(domains ...string) {
+	c.add(c.freeMail, domains)
+}
+
+// Adds \a domains to the disposable domains. Their subdomains are
+// disposable too.
+func (c *AddressClassifier) AddDisposable(domains ...string) {
+	c.add(c.disposable, domains)
+}
+
+// Reads a list of disposable domains from \a r, one per line, and adds them.
+// Blank lines and "#" comments are ignored, so the lists maintained by the
+// disposable-email-domains project can be used as they are.
+func (c *AddressClassifier) LoadDisposable(r io.Reader) error {
+	domains, err := readDomainList(r)
+	if err != nil {
+		return err
+	}
+	c.AddDisposable(domains...)
+	return nil
+}
+
+// Reads a list of free mail domains from \a r, in the same format as
+// LoadDisposable().
+func (c *AddressClassifier) LoadFreeMail(r io.Reader) error {
+	domains, err := readDomainList(r)
+	if err != nil {
+		return err
+	}
+	c.AddFreeMail(domains...)
+	return nil
+}
+
+func (c *AddressClassifier) add(m map[string]bool, names []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, n := range names {
+		n = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(n)), ".")
+		if n != "" {
+			m[n] = true
+		}
+	}
+}
+
+// Returns the names listed in \a r, one per line.
+func readDomainList(r io.Reader) ([]string, error) {
+	domains := []string{}
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		l := s.Text()
+		if i := strings.IndexByte(l, '#'); i >= 0 {
+			l = l[:i]
+		}
+		if l = strings.TrimSpace(l); l != "" {
+			domains = append(domains, l)
+		}
+	}
+	return domains, s.Err()
+}
+
+// Classifies \a a.
+//
+// The local part is compared without any "+" or "-" subaddress suffix
+// (noreply+bounces is a role account). The domain and its parents are
+// compared with the domain lists, so that e.g. eu.mailinator.com is
+// disposable.
+func (c *AddressClassifier) Classify(a Address) AddressClass {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	r := AddressClass{}
+	lp := strings.ToLower(a.Localpart)
+	if c.roles[lp] {
+		r.Role, r.RoleName = true, lp
+	} else if i := strings.IndexAny(lp, "+-"); i > 0 && c.roles[lp[:i]] {
+		r.Role, r.RoleName = true, lp[:i]
+	}
+
+	d := strings.TrimSuffix(strings.ToLower(a.Domain), ".")
+	for d != "" {
+		if c.disposable[d] {
+			r.Disposable, r.Domain = true, d
+			break
+		}
+		if c.freeMail[d] {
+			r.FreeMail, r.Domain = true, d
+			break
+		}
+		i := strings.IndexByte(d, '.')
+		if i < 0 {
+			break
+		}
+		d = d[i+1:]
+	}
+	return r
+}
+
+var defaultClassifier struct {
+	once sync.Once
+	c    *AddressClassifier
+}
+
+// Returns the AddressClassifier used by Address.Classify(). Its lists may be
+// extended, and the changes then apply to all later calls.
+func DefaultAddressClassifier() *AddressClassifier {
+	defaultClassifier.once.Do(func() {
+		defaultClassifier.c = NewAddressClassifier()
+	})
+	return defaultClassifier.c
+}
+
+// Classifies this address using DefaultAddressClassifier().
+func (a Address) Classify() AddressClass {
+	return DefaultAddressClassifier().Classify(a)
+}
@@ -0,0 +1,41 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAddressClassification(t *testing.T) {
+	classify := func(s string) mail.AddressClass {
+		return mail.NewAddressParser(s).Addresses[0].Classify()
+	}
+	c := classify("Postmaster@example.com")
+	if !c.Role || c.RoleName != "postmaster" || c.FreeMail || c.Disposable {
+		t.Errorf("postmaster: %+v", c)
+	}
+	c = classify("noreply+bounces@example.com")
+	testStringEquals(t, "subaddressed role", c.RoleName, "noreply")
+	c = classify("jane@gmail.com")
+	if c.Role || !c.FreeMail || c.Domain != "gmail.com" {
+		t.Errorf("gmail: %+v", c)
+	}
+	c = classify("x@eu.Mailinator.com")
+	if !c.Disposable || c.Domain != "mailinator.com" {
+		t.Errorf("mailinator subdomain: %+v", c)
+	}
+
+	ac := mail.NewAddressClassifier()
+	err := ac.LoadDisposable(strings.NewReader("# local additions\nthrowaway.example\n\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := mail.NewAddressParser("x@throwaway.example").Addresses[0]
+	if !ac.Classify(a).Disposable {
+		t.Error("loaded domain is not disposable")
+	}
+	if a.Classify().Disposable {
+		t.Error("loading into one classifier changed the default")
+	}
+}
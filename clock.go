@@ -0,0 +1,51 @@
+package mail
+
+import (
+	"crypto/rand"
+	"io"
+	"time"
+)
+
+// A Clock tells the time. Types which date what they produce, e.g.
+// Composer and DKIMSigner, have a Clock field; if it is nil, the system
+// clock is used, and a test may set it to a fake clock instead, such as
+// testutil.FakeClock, to get the same output every time.
+type Clock interface {
+	Now() time.Time
+}
+
+// A RandSource supplies the randomness used e.g. for MIME boundaries,
+// Message-Ids and SASL nonces. Types which use randomness have a field of
+// this type; if it is nil, crypto/rand is used, and a test may set it to a
+// seeded source instead, e.g. a math/rand.Rand, to get the same output
+// every time.
+//
+// It is an io.Reader, so any reader may be used.
+type RandSource interface {
+	Read(p []byte) (n int, err error)
+}
+
+// SystemClock is a Clock which returns the current time.
+var SystemClock Clock = systemClock{}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Returns the time according to \a c, or the current time if \a c is nil.
+func clockNow(c Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c.Now()
+}
+
+// Returns \a r as a reader, or crypto/rand if \a r is nil.
+func randReader(r RandSource) io.Reader {
+	if r == nil {
+		return rand.Reader
+	}
+	return r
+}
@@ -0,0 +1,119 @@
+package mail_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	mrand "math/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+type brokenRand struct{}
+
+func (brokenRand) Read(p []byte) (int, error) {
+	return 0, errors.New("no entropy")
+}
+
+func TestClock(t *testing.T) {
+	signedAt := time.Date(2026, time.October, 5, 10, 0, 0, 0, time.UTC)
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	s := mail.NewDKIMSigner("example.com", "ed", key)
+	s.Clock = fixedClock(signedAt)
+	s.Expiry = time.Hour
+	signed, err := s.Sign("From: alice@example.com\r\nSubject: Hi\r\n\r\nHello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tag := range []string{"t=1791194400;", "x=1791198000;"} {
+		if !strings.Contains(signed, tag) {
+			t.Errorf("no %s in %q", tag, signed)
+		}
+	}
+
+	v := &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+		return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+	}}
+	for _, c := range []struct {
+		at     time.Time
+		result string
+	}{
+		{signedAt.Add(time.Minute), "pass"},
+		{signedAt.Add(2 * time.Hour), "permerror"},
+	} {
+		v.Clock = fixedClock(c.at)
+		if r := v.Verify(signed); len(r) != 1 {
+			t.Errorf("%d results", len(r))
+		} else {
+			testStringEquals(t, c.at.String(), r[0].Result, c.result)
+		}
+	}
+
+	compose := func() string {
+		c := mail.NewComposer()
+		c.Clock = fixedClock(signedAt)
+		c.Rand = mrand.New(mrand.NewSource(1))
+		c.Header.Add(mail.FromFieldName, "alice@example.com")
+		c.Text = "Hello"
+		c.Attach("a.txt", "text/plain", "attached")
+		m, err := c.Compose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.RFC822(false)
+	}
+	text := compose()
+	testStringEquals(t, "repeated", compose(), text)
+	if !strings.Contains(text, "Date: Mon, 05 Oct 2026 10:00:00 +0000") {
+		t.Errorf("Date not from the clock: %q", text)
+	}
+
+	// without randomness, the boundaries and Message-Id use the clock too
+	c := mail.NewComposer()
+	c.Clock = fixedClock(signedAt)
+	c.Rand = brokenRand{}
+	c.Header.Add(mail.FromFieldName, "alice@example.com")
+	c.Text = "Hello"
+	c.Attach("a.txt", "text/plain", "attached")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hex := strconv.FormatInt(signedAt.UnixNano(), 16)
+	testStringEquals(t, "Message-Id", m.Header.Get(mail.MessageIDFieldName),
+		"<"+hex+"@example.com>")
+	if !strings.Contains(m.RFC822(false), "boundary=\"=_"+hex+"_1\"") {
+		t.Errorf("boundary not from the clock: %q", m.RFC822(false))
+	}
+
+	// nested multiparts get different boundaries from the same time
+	c.HTML = "<p>Hello</p>"
+	m, err = c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text = m.RFC822(false)
+	for _, b := range []string{"=_" + hex + "_2", "=_" + hex + "_1"} {
+		if !strings.Contains(text, "boundary=\""+b+"\"") {
+			t.Errorf("no boundary %s in %q", b, text)
+		}
+	}
+	m, err = mail.ReadMessage(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Parts) != 2 || len(m.Parts[0].Parts) != 2 {
+		t.Errorf("nested structure lost: %q", text)
+	}
+}
@@ -0,0 +1,66 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+// #include <stdlib.h>
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
+
+//export mail_parse
+func mail_parse(text *C.char, length C.int) *C.char {
+	if length < 0 || text == nil && length > 0 {
+		return cResult(errorJSON(errors.New("mail_parse: invalid text or length")))
+	}
+	return cResult(safely(func() []byte {
+		return parse(C.GoStringN(text, length))
+	}))
+}
+
+//export mail_compose
+func mail_compose(request *C.char) *C.char {
+	return cResult(safely(func() []byte {
+		return compose([]byte(C.GoString(request)))
+	}))
+}
+
+//export mail_free
+func mail_free(p *C.char) {
+	C.free(unsafe.Pointer(p))
+}
+
+// Returns \a b as a NUL-terminated string allocated with malloc(), which
+// the caller must free with mail_free(). JSON never contains NUL.
+func cResult(b []byte) *C.char {
+	return C.CString(string(b))
+}
+
+// Calls mail_parse() as a C caller would: with \a text copied to memory
+// allocated by C and freed before the result is read, and frees the result
+// with mail_free(). For tests, which cannot use cgo themselves.
+func callParse(text string) string {
+	return callParseLength(text, len(text))
+}
+
+// Calls mail_parse() as callParse() does, but passes \a length as the
+// length of \a text.
+func callParseLength(text string, length int) string {
+	in := C.CString(text)
+	r := mail_parse(in, C.int(length))
+	C.free(unsafe.Pointer(in))
+	defer mail_free(r)
+	return C.GoString(r)
+}
+
+// Calls mail_compose() as callParse() calls mail_parse().
+func callCompose(request string) string {
+	in := C.CString(request)
+	r := mail_compose(in)
+	C.free(unsafe.Pointer(in))
+	defer mail_free(r)
+	return C.GoString(r)
+}
@@ -0,0 +1,42 @@
+//go:build cgo
+// +build cgo
+
+package main
+
+import (
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestExports(t *testing.T) {
+	r := callCompose(`{"header": [{"name": "From", "value": "alice@example.com"}], "text": "Hi"}`)
+	if !strings.HasPrefix(r, `{"message":"`) {
+		t.Fatalf("mail_compose: %s", r)
+	}
+	text := "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello\r\n"
+	if r := callParse(text); !strings.Contains(r, `"text":"Hello\r\n"`) {
+		t.Errorf("mail_parse: %s", r)
+	}
+
+	if r := callParseLength(text, -1); !strings.HasPrefix(r, `{"error":"`) {
+		t.Errorf("mail_parse with a negative length: %s", r)
+	}
+
+	// the results are independent allocations, so concurrent callers
+	// cannot see each other's
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				if r := callParse(text); !strings.Contains(r, `"value":"Hi"`) {
+					t.Errorf("concurrent mail_parse: %s", r)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
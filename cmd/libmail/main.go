@@ -0,0 +1,164 @@
+// Command libmail is package mail as a C shared library, so that programs
+// in other languages, e.g. Python with ctypes or Node with ffi-napi, can
+// parse and compose messages with it. It uses only the public API of
+// package mail.
+//
+// Build it with cgo:
+//
+//	go build -buildmode=c-shared -o libmail.so ./cmd/libmail
+//
+// which also writes libmail.h, declaring these functions:
+//
+//	char *mail_parse(char *text, int length);
+//	char *mail_compose(char *request);
+//	void mail_free(char *p);
+//
+// mail_parse() parses the \a length bytes of \a text as a message and
+// returns it as JSON: an object with the header ("header", a list of
+// objects with "name" and "value"), the plain text and HTML bodies ("text"
+// and "html"), the attachments ("attachments", each described as
+// mail.AttachmentInfo is, with its content in base64 as "data") and the
+// repairs the parser made ("diagnostics").
+//
+// mail_compose() composes a message from the JSON object \a request, which
+// has "header", "text" and "html" as above, and "attachments", each an
+// object with "filename", "contentType", "data" (in base64), and
+// optionally "inline" and "contentId". It returns a JSON object whose
+// "message" is the text of the message, with CRLF line endings.
+//
+// If either fails, it returns a JSON object whose "error" says why
+// instead. That includes a negative \a length, and a panic inside the
+// library, which does not reach the caller.
+//
+// Memory: the arguments remain the caller's; they are copied before the
+// functions return, and may be freed at once. The result is allocated with
+// malloc() and belongs to the caller, who must free it with mail_free()
+// (or free() from the same C library). A result is never NULL. The
+// functions may be called from several threads at once.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/jimexcel/mail"
+)
+
+// A c-shared library needs a main function, which is never called.
+func main() {}
+
+// A parsed message, as mail_parse() returns it.
+type parsedMessage struct {
+	Header      *mail.Header      `json:"header"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Attachments []attachment      `json:"attachments"`
+	Diagnostics []mail.Diagnostic `json:"diagnostics"`
+}
+
+// An attachment of a parsed message, with its content.
+type attachment struct {
+	mail.AttachmentInfo
+	Data []byte `json:"data"`
+}
+
+// A message to compose, as mail_compose() takes it.
+type composeRequest struct {
+	Header      *mail.Header `json:"header"`
+	Text        string       `json:"text"`
+	HTML        string       `json:"html"`
+	Attachments []struct {
+		Filename    string `json:"filename"`
+		ContentType string `json:"contentType"`
+		Data        []byte `json:"data"`
+		Inline      bool   `json:"inline"`
+		ContentID   string `json:"contentId"`
+	} `json:"attachments"`
+}
+
+// Returns the JSON object describing the message \a text, as described
+// for mail_parse().
+func parse(text string) []byte {
+	m, err := mail.ReadMessage(text)
+	if err != nil {
+		return errorJSON(err)
+	}
+	r := parsedMessage{
+		Header:      m.Header,
+		Attachments: []attachment{},
+		Diagnostics: m.Diagnostics(),
+	}
+	if p := m.DisplayBody(mail.PreferPlain); p != nil && p.AlternativeType() == "text/plain" {
+		r.Text = p.Text
+	}
+	if p := m.DisplayBody(mail.PreferHTML); p != nil && p.AlternativeType() == "text/html" {
+		r.HTML = p.Text
+	}
+	for _, p := range m.Attachments() {
+		a := attachment{AttachmentInfo: p.AttachmentInfo(false)}
+		rc, err := p.Open()
+		if err != nil {
+			return errorJSON(err)
+		}
+		a.Data, err = ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			return errorJSON(err)
+		}
+		r.Attachments = append(r.Attachments, a)
+	}
+	return resultJSON(r)
+}
+
+// Returns the JSON object holding the message composed as \a request
+// describes, as described for mail_compose().
+func compose(request []byte) []byte {
+	c := mail.NewComposer()
+	r := composeRequest{Header: c.Header}
+	if err := json.Unmarshal(request, &r); err != nil {
+		return errorJSON(err)
+	}
+	c.Text = r.Text
+	c.HTML = r.HTML
+	for _, a := range r.Attachments {
+		att := c.Attach(a.Filename, a.ContentType, string(a.Data))
+		att.Inline = a.Inline
+		att.ContentID = a.ContentID
+	}
+	m, err := c.Compose()
+	if err != nil {
+		return errorJSON(err)
+	}
+	return resultJSON(struct {
+		Message string `json:"message"`
+	}{m.RFC822(false)})
+}
+
+// Returns the result of \a f, or an error object if \a f panics, since a
+// panic would abort the program which loaded the library.
+func safely(f func() []byte) (r []byte) {
+	defer func() {
+		if p := recover(); p != nil {
+			r = errorJSON(fmt.Errorf("internal error: %v", p))
+		}
+	}()
+	return f()
+}
+
+// Returns \a v as JSON, or an error object if it cannot be encoded.
+func resultJSON(v interface{}) []byte {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return errorJSON(err)
+	}
+	return b
+}
+
+// Returns the JSON object reporting \a err.
+func errorJSON(err error) []byte {
+	b, _ := json.Marshal(struct {
+		Error string `json:"error"`
+	}{err.Error()})
+	return b
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestComposeAndParse(t *testing.T) {
+	request := `{
+		"header": [
+			{"name": "From", "value": "Alice <alice@example.com>"},
+			{"name": "To", "value": "bob@example.com"},
+			{"name": "Subject", "value": "Café"}
+		],
+		"text": "Hello",
+		"html": "<p>Hello</p>",
+		"attachments": [
+			{"filename": "a.bin", "contentType": "application/octet-stream", "data": "AAEC/w=="}
+		]
+	}`
+	var composed struct {
+		Message string `json:"message"`
+		Error   string `json:"error"`
+	}
+	if err := json.Unmarshal(compose([]byte(request)), &composed); err != nil {
+		t.Fatal(err)
+	}
+	if composed.Error != "" || !strings.Contains(composed.Message, "\r\nSubject: ") {
+		t.Fatalf("compose: %+v", composed)
+	}
+
+	var parsed struct {
+		Header []struct {
+			Name  string `json:"name"`
+			Value string `json:"value"`
+		} `json:"header"`
+		Text        string `json:"text"`
+		HTML        string `json:"html"`
+		Attachments []struct {
+			Filename    string `json:"filename"`
+			ContentType string `json:"contentType"`
+			Size        int    `json:"size"`
+			Data        []byte `json:"data"`
+		} `json:"attachments"`
+	}
+	if err := json.Unmarshal(parse(composed.Message), &parsed); err != nil {
+		t.Fatal(err)
+	}
+	subject := ""
+	for _, f := range parsed.Header {
+		if f.Name == "Subject" {
+			subject = f.Value
+		}
+	}
+	if subject != "Café" {
+		t.Errorf("Subject = %q", subject)
+	}
+	if strings.TrimSpace(parsed.Text) != "Hello" || strings.TrimSpace(parsed.HTML) != "<p>Hello</p>" {
+		t.Errorf("bodies = %q, %q", parsed.Text, parsed.HTML)
+	}
+	if len(parsed.Attachments) != 1 {
+		t.Fatalf("%d attachments", len(parsed.Attachments))
+	}
+	a := parsed.Attachments[0]
+	if a.Filename != "a.bin" || a.Size != 4 || string(a.Data) != "\x00\x01\x02\xff" {
+		t.Errorf("attachment = %+v", a)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	for _, c := range []struct {
+		name, result, want string
+	}{
+		{"bad JSON", string(compose([]byte("{"))), `{"error":"unexpected end of JSON input"}`},
+		{"no From", string(compose([]byte(`{"text": "Hi"}`))), `{"error":"0 From fields seen. At least 1 must be present."}`},
+		{"panic", string(safely(func() []byte { panic("boom") })), `{"error":"internal error: boom"}`},
+	} {
+		if c.result != c.want {
+			t.Errorf("%s: %s, want %s", c.name, c.result, c.want)
+		}
+	}
+}
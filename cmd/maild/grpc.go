@@ -0,0 +1,413 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/jimexcel/mail"
+)
+
+// The gRPC status codes maild uses.
+const (
+	grpcOK               = 0
+	grpcInvalidArgument  = 3
+	grpcResourceExceeded = 8
+	grpcUnimplemented    = 12
+	grpcInternal         = 13
+	grpcUnauthenticated  = 16
+)
+
+// The largest chunk of a rendered document sent in one message.
+const grpcChunkSize = 64 * 1024
+
+// A grpcError ends an RPC with a status other than OK.
+type grpcError struct {
+	code int
+	msg  string
+}
+
+func (e *grpcError) Error() string {
+	return e.msg
+}
+
+// Serves the RPC \a r of the service maild.proto describes. The request
+// and response messages are encoded by hand, since maild takes on no
+// dependencies. The status is sent in the trailer, as gRPC requires.
+func (s *server) serveGRPC(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/grpc")
+	w.Header().Add("Trailer", "Grpc-Status")
+	w.Header().Add("Trailer", "Grpc-Message")
+	err := s.callGRPC(w, r)
+	code, msg := grpcOK, ""
+	if err != nil {
+		code, msg = grpcInternal, err.Error()
+		if ge, ok := err.(*grpcError); ok {
+			code = ge.code
+		}
+	}
+	w.Header().Set("Grpc-Status", strconv.Itoa(code))
+	w.Header().Set("Grpc-Message", grpcEscape(msg))
+}
+
+// Calls the method named by the path of \a r, and returns its error.
+func (s *server) callGRPC(w http.ResponseWriter, r *http.Request) error {
+	if r.Header.Get("Grpc-Encoding") != "" && r.Header.Get("Grpc-Encoding") != "identity" {
+		return &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	in := &grpcReader{r: http.MaxBytesReader(w, r.Body, s.maxSize+grpcChunkSize)}
+	out := &grpcWriter{w: w}
+	switch r.URL.Path {
+	case "/maild.v1.Mail/Parse":
+		text, err := s.readChunks(in)
+		if err != nil {
+			return err
+		}
+		m, err := mail.ReadMessage(text)
+		if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		defer m.Close()
+		return parseEvents(m, func(p parsed) error {
+			return out.send(encodeParseEvent(p))
+		})
+	case "/maild.v1.Mail/Render":
+		b, err := in.next()
+		if err != nil {
+			return err
+		}
+		var format uint64
+		var text []byte
+		err = pbFields(b, func(field int, v uint64, data []byte) {
+			switch field {
+			case 1:
+				format = v
+			case 2:
+				text = data
+			}
+		})
+		if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		m, err := mail.ReadMessage(string(text))
+		if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		doc := m.Export(mail.ExportText)
+		if format == 1 {
+			doc = m.Export(mail.ExportHTML)
+		}
+		for i := 0; i == 0 || i < len(doc); i += grpcChunkSize {
+			end := i + grpcChunkSize
+			if end > len(doc) {
+				end = len(doc)
+			}
+			var c pbBuffer
+			c.bytes(1, []byte(doc[i:end]))
+			if err := out.send(c.b); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "/maild.v1.Mail/VerifyAuth":
+		text, err := s.readChunks(in)
+		if err != nil {
+			return err
+		}
+		return out.send(encodeAuthResults(s.authResults(text)))
+	case "/maild.v1.Mail/Send":
+		if s.transport == nil {
+			return &grpcError{grpcUnimplemented, "sending is not configured; see -relay"}
+		}
+		if !s.authorized(r) {
+			return &grpcError{grpcUnauthenticated, "sending needs the token in MAILD_TOKEN"}
+		}
+		b, err := in.next()
+		if err != nil {
+			return err
+		}
+		var env mail.Envelope
+		var text []byte
+		err = pbFields(b, func(field int, v uint64, data []byte) {
+			switch field {
+			case 1:
+				env.From = string(data)
+			case 2:
+				env.To = append(env.To, string(data))
+			case 3:
+				text = data
+			}
+		})
+		if err != nil {
+			return &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		env, err = s.deliver(env, string(text))
+		if re, ok := err.(*requestError); ok {
+			return &grpcError{grpcInvalidArgument, re.msg}
+		}
+		return out.send(encodeSendReply(env, err))
+	}
+	return &grpcError{grpcUnimplemented, "unknown method " + r.URL.Path}
+}
+
+// Returns the message sent as a stream of chunks on \a in, or an error if
+// it is larger than the server accepts.
+func (s *server) readChunks(in *grpcReader) (string, error) {
+	var buf strings.Builder
+	for {
+		b, err := in.next()
+		if err == io.EOF {
+			return buf.String(), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		err = pbFields(b, func(field int, v uint64, data []byte) {
+			if field == 1 {
+				buf.Write(data)
+			}
+		})
+		if err != nil {
+			return "", &grpcError{grpcInvalidArgument, err.Error()}
+		}
+		if int64(buf.Len()) > s.maxSize {
+			return "", &grpcError{grpcResourceExceeded, "the message is too large"}
+		}
+	}
+}
+
+// A grpcReader reads the length-prefixed messages of a gRPC request.
+type grpcReader struct {
+	r io.Reader
+}
+
+// Returns the next message, or io.EOF if there are no more.
+func (g *grpcReader) next() ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(g.r, prefix[:]); err != nil {
+		if err == io.EOF {
+			return nil, err
+		}
+		return nil, &grpcError{grpcInvalidArgument, "truncated message: " + err.Error()}
+	}
+	if prefix[0] != 0 {
+		return nil, &grpcError{grpcUnimplemented, "compressed messages are not supported"}
+	}
+	b := make([]byte, binary.BigEndian.Uint32(prefix[1:]))
+	if _, err := io.ReadFull(g.r, b); err != nil {
+		return nil, &grpcError{grpcResourceExceeded, "truncated or too large message: " + err.Error()}
+	}
+	return b, nil
+}
+
+// A grpcWriter writes the length-prefixed messages of a gRPC response,
+// each as soon as it is ready.
+type grpcWriter struct {
+	w http.ResponseWriter
+}
+
+func (g *grpcWriter) send(b []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(b)))
+	if _, err := g.w.Write(append(prefix[:], b...)); err != nil {
+		return err
+	}
+	if f, ok := g.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// Returns \a s percent-encoded as the Grpc-Message field requires.
+func grpcEscape(s string) string {
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < ' ' || c > '~' || c == '%' {
+			fmt.Fprintf(&buf, "%%%02X", c)
+		} else {
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// A pbBuffer builds a protobuf message. Fields with default values are
+// left out, as proto3 does.
+type pbBuffer struct {
+	b []byte
+}
+
+func (p *pbBuffer) varint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	p.b = appendVarint(p.b, uint64(field)<<3)
+	p.b = appendVarint(p.b, v)
+}
+
+func (p *pbBuffer) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	p.b = appendVarint(p.b, uint64(field)<<3|2)
+	p.b = appendVarint(p.b, uint64(len(b)))
+	p.b = append(p.b, b...)
+}
+
+func (p *pbBuffer) string(field int, s string) {
+	p.bytes(field, []byte(s))
+}
+
+// Adds the message \a m as \a field, even if it is empty, as a member of
+// a oneof or a repeated field must be.
+func (p *pbBuffer) message(field int, m []byte) {
+	p.b = appendVarint(p.b, uint64(field)<<3|2)
+	p.b = appendVarint(p.b, uint64(len(m)))
+	p.b = append(p.b, m...)
+}
+
+func appendVarint(b []byte, v uint64) []byte {
+	for v >= 0x80 {
+		b = append(b, byte(v)|0x80)
+		v >>= 7
+	}
+	return append(b, byte(v))
+}
+
+// Calls \a fn for each field of the protobuf message \a b, with its value
+// if it is a varint, or its content if it is length-delimited. Fields of
+// other wire types are skipped.
+func pbFields(b []byte, fn func(field int, v uint64, data []byte)) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("malformed protobuf message")
+		}
+		b = b[n:]
+		field := int(key >> 3)
+		switch key & 7 {
+		case 0:
+			v, n := binary.Uvarint(b)
+			if n <= 0 {
+				return errors.New("malformed protobuf varint")
+			}
+			fn(field, v, nil)
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return errors.New("truncated protobuf message")
+			}
+			b = b[8:]
+		case 2:
+			l, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < l {
+				return errors.New("truncated protobuf message")
+			}
+			fn(field, 0, b[n:n+int(l)])
+			b = b[n+int(l):]
+		case 5:
+			if len(b) < 4 {
+				return errors.New("truncated protobuf message")
+			}
+			b = b[4:]
+		default:
+			return errors.New("unsupported protobuf wire type")
+		}
+	}
+	return nil
+}
+
+// Returns \a p, which has one field set, as a ParseEvent.
+func encodeParseEvent(p parsed) []byte {
+	var e pbBuffer
+	switch {
+	case p.Header != nil:
+		var h pbBuffer
+		for i := 0; i < p.Header.Len(); i++ {
+			f := p.Header.At(i)
+			var fb pbBuffer
+			fb.string(1, f.Name())
+			fb.string(2, f.Value())
+			h.message(1, fb.b)
+		}
+		e.message(1, h.b)
+	case p.Text != "":
+		e.message(2, []byte(p.Text))
+	case p.HTML != "":
+		e.message(3, []byte(p.HTML))
+	case p.Attachment != nil:
+		var a pbBuffer
+		a.string(1, p.Attachment.Filename)
+		a.string(2, p.Attachment.ContentType)
+		a.varint(3, uint64(p.Attachment.Size))
+		a.string(4, p.Attachment.ContentID)
+		a.bytes(5, p.Attachment.Data)
+		e.message(4, a.b)
+	default:
+		var ds pbBuffer
+		for _, d := range p.Diagnostics {
+			var db pbBuffer
+			db.string(1, d.Code)
+			db.string(2, d.Severity.String())
+			db.string(3, d.Part)
+			db.string(4, d.Field)
+			db.string(5, d.Message)
+			ds.message(1, db.b)
+		}
+		e.message(5, ds.b)
+	}
+	return e.b
+}
+
+// Returns \a r as an AuthResults message.
+func encodeAuthResults(r authResults) []byte {
+	var b pbBuffer
+	for _, d := range r.DKIM {
+		var db pbBuffer
+		db.string(1, d.Result)
+		db.string(2, d.Domain)
+		db.string(3, d.Selector)
+		db.string(4, d.Error)
+		b.message(1, db.b)
+	}
+	b.string(2, r.ARC)
+	for _, s := range r.ARCSealers {
+		b.message(3, []byte(s))
+	}
+	b.string(4, r.AuthenticationResults)
+	return b.b
+}
+
+// Returns the SendReply for sending to \a env with the result \a err.
+func encodeSendReply(env mail.Envelope, err error) []byte {
+	var b pbBuffer
+	if err == nil {
+		b.varint(1, 1)
+		for _, to := range env.To {
+			b.message(2, []byte(to))
+		}
+		return b.b
+	}
+	b.string(3, err.Error())
+	if status, ok := mail.SMTPStatusFromError(err); ok {
+		var sb pbBuffer
+		sb.varint(1, uint64(status.Code))
+		sb.string(2, status.Enhanced)
+		for _, l := range status.Lines {
+			sb.message(3, []byte(l))
+		}
+		b.message(4, sb.b)
+		if advice, retry := status.Retry(); retry {
+			b.varint(5, uint64(advice.Delay.Seconds()))
+		}
+	}
+	return b.b
+}
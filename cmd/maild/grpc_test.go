@@ -0,0 +1,145 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package main
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+	"github.com/jimexcel/mail/testutil"
+)
+
+// Calls \a method with the request messages \a in, and returns the
+// response messages, the gRPC status and its message.
+func callGRPC(s *server, method, token string, in ...[]byte) ([][]byte, string, string) {
+	var body bytes.Buffer
+	for _, b := range in {
+		w := &grpcWriter{w: httptest.NewRecorder()}
+		w.send(b)
+		body.Write(w.w.(*httptest.ResponseRecorder).Body.Bytes())
+	}
+	r := httptest.NewRequest("POST", "/maild.v1.Mail/"+method, &body)
+	r.Header.Set("Content-Type", "application/grpc")
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	res := rec.Result()
+	var out [][]byte
+	g := &grpcReader{r: res.Body}
+	for {
+		b, err := g.next()
+		if err != nil {
+			break
+		}
+		out = append(out, b)
+	}
+	status, msg := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, msg = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	return out, status, msg
+}
+
+// Returns the fields of the protobuf message \a b, each as its varint
+// value or its content.
+func pbDecode(t *testing.T, b []byte) map[int][]string {
+	fields := map[int][]string{}
+	err := pbFields(b, func(field int, v uint64, data []byte) {
+		if data == nil {
+			data = []byte(strings.Repeat("1", int(v)))
+		}
+		fields[field] = append(fields[field], string(data))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fields
+}
+
+func chunk(s string) []byte {
+	var b pbBuffer
+	b.string(1, s)
+	return b.b
+}
+
+func TestGRPC(t *testing.T) {
+	sink := testutil.NewSink(t)
+	defer sink.Close()
+	s := &server{
+		transport: &mail.SMTPTransport{Addr: sink.Addr},
+		verifier:  &mail.DKIMVerifier{},
+		maxSize:   1 << 20,
+		token:     "secret",
+	}
+	text, err := testutil.MixedMessage(1).Subject("Report").
+		Attach("data.bin", "application/octet-stream", "\x00\x01\x02").RFC822()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the message may arrive in any number of chunks
+	out, status, msg := callGRPC(s, "Parse", "", chunk(text[:100]), chunk(text[100:]))
+	if status != "0" || len(out) < 3 {
+		t.Fatalf("Parse: %s %s, %d events", status, msg, len(out))
+	}
+	header := pbDecode(t, []byte(pbDecode(t, out[0])[1][0]))
+	found := false
+	for _, f := range header[1] {
+		fd := pbDecode(t, []byte(f))
+		if fd[1][0] == mail.SubjectFieldName && fd[2][0] == "Report" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Parse: no Subject in %q", header)
+	}
+	a := pbDecode(t, []byte(pbDecode(t, out[len(out)-1])[4][0]))
+	if a[1][0] != "data.bin" || a[5][0] != "\x00\x01\x02" {
+		t.Errorf("Parse: attachment %q", a)
+	}
+
+	var render pbBuffer
+	render.varint(1, 1)
+	render.string(2, text)
+	out, status, _ = callGRPC(s, "Render", "", render.b)
+	if status != "0" || len(out) != 1 || !strings.Contains(pbDecode(t, out[0])[1][0], "<html") {
+		t.Errorf("Render: %s %q", status, out)
+	}
+
+	out, status, _ = callGRPC(s, "VerifyAuth", "", chunk(text))
+	if status != "0" || len(out) != 1 || pbDecode(t, out[0])[2][0] != "none" {
+		t.Errorf("VerifyAuth: %s %q", status, out)
+	}
+
+	var send pbBuffer
+	send.string(1, "alice@example.com")
+	send.string(2, "bob@example.com")
+	send.string(3, "Bcc: carol@example.com\r\n"+text)
+	if _, status, _ = callGRPC(s, "Send", "", send.b); status != "16" {
+		t.Errorf("Send without a token: status %s", status)
+	}
+	out, status, msg = callGRPC(s, "Send", "secret", send.b)
+	if status != "0" || len(out) != 1 {
+		t.Fatalf("Send: %s %s", status, msg)
+	}
+	if reply := pbDecode(t, out[0]); len(reply[1]) != 1 || reply[2][0] != "bob@example.com" {
+		t.Errorf("Send: %q", reply)
+	}
+	if d := sink.WasSentTo(t, "bob@example.com"); d != nil && d.Text != text {
+		t.Errorf("delivered %q", d.Text)
+	}
+
+	if _, status, _ = callGRPC(s, "Nonesuch", ""); status != "12" {
+		t.Errorf("unknown method: status %s", status)
+	}
+	s.maxSize = 10
+	if _, status, _ = callGRPC(s, "VerifyAuth", "", chunk(text)); status != "8" {
+		t.Errorf("too large: status %s", status)
+	}
+}
@@ -0,0 +1,524 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+// Command maild offers package mail as an HTTP service, so that programs in
+// any language can parse, render, authenticate and send messages. It uses
+// only the public API of package mail.
+//
+// Usage:
+//
+//	maild [-addr host:port] [-relay host:port] [-max-size bytes]
+//	      [-tls-cert file -tls-key file]
+//
+// Each operation is a POST whose body is the message, as it would be sent
+// by SMTP; chunked requests are accepted, so a client need not know the
+// size of a large message in advance. Results are JSON, except for the
+// document /v1/render returns:
+//
+//	POST /v1/parse        the header, bodies, attachments and diagnostics
+//	POST /v1/render       the message as a document, ?format=text or html
+//	POST /v1/verify-auth  the DKIM signatures and ARC chain
+//	POST /v1/send         sends the message through the relay
+//
+// GET /metrics offers the service's metrics to Prometheus: those package
+// mail records, e.g. mail_parse_duration_seconds and
+// mail_dkim_results_total, and maild_requests_total, counting the requests
+// by operation and status code.
+//
+// /v1/parse answers with a single JSON object, or, if the request accepts
+// application/x-ndjson, with one JSON object per line, written as each is
+// ready: the header, the text and HTML bodies, each attachment with its
+// content, and the diagnostics, so that a client may process a large
+// message's attachments one at a time.
+//
+// /v1/render serves HTML with a Content-Security-Policy which sandboxes it
+// and allows no scripts and nothing from elsewhere, as mailpreview does.
+//
+// /v1/send takes the envelope from the "from" and "to" query parameters,
+// or if there are none, from the message's From, To, Cc and Bcc fields.
+// Either way, the Bcc fields are removed before the message is sent, and
+// nothing else is changed, so that DKIM signatures remain valid. It is
+// only offered if -relay names an SMTP server, and only to clients which
+// send the token in the MAILD_TOKEN environment variable as
+// "Authorization: Bearer token". A rejection is reported with the
+// server's reply and, if the server asked to retry later, a Retry-After
+// field.
+//
+// Requests from web pages in other origins, which carry an Origin field
+// naming another host, are refused, so that a page cannot use the
+// browser of someone running maild.
+//
+// maild also serves the same operations as the gRPC service maild.proto
+// describes, with the message and the replies streamed in chunks, to
+// requests whose Content-Type is application/grpc. gRPC needs HTTP/2,
+// which maild speaks when -tls-cert and -tls-key name its certificate and
+// key. The protobuf messages are encoded by maild itself, since package
+// mail takes on no dependencies such as gRPC's; clients may be generated
+// from maild.proto as usual.
+//
+// Whichever way a message arrives, maild reads all of it, up to -max-size
+// bytes, before parsing it, since package mail parses messages held in
+// memory. Only the replies of /v1/parse, Parse and Render are streamed.
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jimexcel/mail"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8026", "the address to listen on")
+	relay := flag.String("relay", "", "the SMTP server to send through, e.g. smtp.example.com:587")
+	maxSize := flag.Int64("max-size", 50<<20, "the largest message accepted, in bytes")
+	certFile := flag.String("tls-cert", "", "the certificate to serve HTTPS and HTTP/2 with")
+	keyFile := flag.String("tls-key", "", "the private key of -tls-cert")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: maild [-addr host:port] [-relay host:port] [-max-size bytes] [-tls-cert file -tls-key file]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 || (*certFile == "") != (*keyFile == "") {
+		flag.Usage()
+		os.Exit(2)
+	}
+	metrics := mail.NewPrometheusMetrics()
+	mail.DefaultMetrics = metrics
+	s := &server{verifier: &mail.DKIMVerifier{}, maxSize: *maxSize, metrics: metrics}
+	if *relay != "" {
+		s.token = os.Getenv("MAILD_TOKEN")
+		if s.token == "" {
+			log.Fatal("maild: -relay needs a token for senders in MAILD_TOKEN")
+		}
+		s.transport = &mail.SMTPTransport{Addr: *relay}
+	}
+	if *certFile != "" {
+		log.Printf("serving on https://%s/", *addr)
+		log.Fatal(http.ListenAndServeTLS(*addr, *certFile, *keyFile, s))
+	}
+	log.Printf("serving on http://%s/", *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+// A server serves the operations. Messages are sent with transport, which
+// is nil if sending is not offered, by clients which present token.
+// metrics serves /metrics, if not nil.
+type server struct {
+	transport mail.Transport
+	token     string
+	verifier  *mail.DKIMVerifier
+	maxSize   int64
+	metrics   http.Handler
+}
+
+// The JSON objects describing a parsed message. /v1/parse returns one
+// holding all; the streamed form has one per line, each with one field set.
+type parsed struct {
+	Header      *mail.Header      `json:"header,omitempty"`
+	Text        string            `json:"text,omitempty"`
+	HTML        string            `json:"html,omitempty"`
+	Attachments []attachment      `json:"attachments,omitempty"`
+	Attachment  *attachment       `json:"attachment,omitempty"`
+	Diagnostics []mail.Diagnostic `json:"diagnostics,omitempty"`
+}
+
+// An attachment of a parsed message, with its content in base64.
+type attachment struct {
+	mail.AttachmentInfo
+	Data []byte `json:"data"`
+}
+
+// The result of /v1/verify-auth.
+type authResults struct {
+	DKIM                  []dkimResult `json:"dkim"`
+	ARC                   string       `json:"arc"`
+	ARCSealers            []string     `json:"arcSealers,omitempty"`
+	AuthenticationResults string       `json:"authenticationResults"`
+}
+
+// One DKIM signature's result.
+type dkimResult struct {
+	Result   string `json:"result"`
+	Domain   string `json:"domain,omitempty"`
+	Selector string `json:"selector,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// An error reply. SMTPStatus is the relay's reply if it refused a message.
+type errorReply struct {
+	Error      string           `json:"error"`
+	SMTPStatus *mail.SMTPStatus `json:"smtpStatus,omitempty"`
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		if r.Method != http.MethodPost || crossOrigin(r) {
+			replyError(w, http.StatusForbidden, "gRPC requests must be same-origin POSTs")
+			return
+		}
+		s.serveGRPC(w, r)
+		return
+	}
+	var serve func(w http.ResponseWriter, r *http.Request, text string)
+	switch r.URL.Path {
+	case "/metrics":
+		if s.metrics == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.metrics.ServeHTTP(w, r)
+		return
+	case "/v1/parse":
+		serve = s.parse
+	case "/v1/render":
+		serve = s.render
+	case "/v1/verify-auth":
+		serve = s.verifyAuth
+	case "/v1/send":
+		serve = s.send
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	w = sw
+	defer func() {
+		mail.DefaultMetrics.Record("maild.requests", 1, map[string]string{
+			"operation": strings.TrimPrefix(r.URL.Path, "/v1/"),
+			"code":      strconv.Itoa(sw.code),
+		})
+	}()
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		replyError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	if crossOrigin(r) {
+		replyError(w, http.StatusForbidden, "cross-origin requests are not served")
+		return
+	}
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, s.maxSize))
+	if err != nil {
+		replyError(w, http.StatusRequestEntityTooLarge, err.Error())
+		return
+	}
+	serve(w, r, string(b))
+}
+
+// Serves /v1/parse for the message \a text.
+func (s *server) parse(w http.ResponseWriter, r *http.Request, text string) {
+	m, err := mail.ReadMessage(text)
+	if err != nil {
+		replyError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	defer m.Close()
+
+	if !strings.Contains(r.Header.Get("Accept"), "application/x-ndjson") {
+		p := parsed{Header: m.Header, Diagnostics: m.Diagnostics()}
+		p.Text, p.HTML = bodies(m)
+		for _, part := range m.Attachments() {
+			a, err := readAttachment(part)
+			if err != nil {
+				replyError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			p.Attachments = append(p.Attachments, *a)
+		}
+		reply(w, http.StatusOK, p)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	err = parseEvents(m, func(p parsed) error {
+		enc.Encode(p)
+		if flusher != nil {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil {
+		// the status has been sent, so the error is a line of its own
+		enc.Encode(errorReply{Error: err.Error()})
+	}
+}
+
+// Calls \a emit for each part of the streamed description of \a m, each
+// with one field set: the header, the text and HTML bodies, each
+// attachment and the diagnostics. Returns the first error from \a emit or
+// from reading an attachment.
+func parseEvents(m *mail.Message, emit func(parsed) error) error {
+	if err := emit(parsed{Header: m.Header}); err != nil {
+		return err
+	}
+	text, html := bodies(m)
+	if text != "" {
+		if err := emit(parsed{Text: text}); err != nil {
+			return err
+		}
+	}
+	if html != "" {
+		if err := emit(parsed{HTML: html}); err != nil {
+			return err
+		}
+	}
+	for _, part := range m.Attachments() {
+		a, err := readAttachment(part)
+		if err != nil {
+			return err
+		}
+		if err := emit(parsed{Attachment: a}); err != nil {
+			return err
+		}
+	}
+	if d := m.Diagnostics(); len(d) > 0 {
+		return emit(parsed{Diagnostics: d})
+	}
+	return nil
+}
+
+// Returns the plain text and HTML bodies of \a m, either of which may be
+// empty.
+func bodies(m *mail.Message) (string, string) {
+	text, html := "", ""
+	if p := m.DisplayBody(mail.PreferPlain); p != nil && p.AlternativeType() == "text/plain" {
+		text = p.Text
+	}
+	if p := m.DisplayBody(mail.PreferHTML); p != nil && p.AlternativeType() == "text/html" {
+		html = p.Text
+	}
+	return text, html
+}
+
+// Returns the attachment \a p with its content.
+func readAttachment(p *mail.Part) (*attachment, error) {
+	rc, err := p.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, err
+	}
+	return &attachment{AttachmentInfo: p.AttachmentInfo(false), Data: data}, nil
+}
+
+// Serves /v1/render for the message \a text.
+func (s *server) render(w http.ResponseWriter, r *http.Request, text string) {
+	format, contentType := mail.ExportText, "text/plain; charset=utf-8"
+	switch r.URL.Query().Get("format") {
+	case "", "text":
+	case "html":
+		format, contentType = mail.ExportHTML, "text/html; charset=utf-8"
+	default:
+		replyError(w, http.StatusBadRequest, "format must be text or html")
+		return
+	}
+	m, err := mail.ReadMessage(text)
+	if err != nil {
+		replyError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if format == mail.ExportHTML {
+		// the HTML is sanitized, but comes from the sender, so it gets
+		// no scripts, no origin and nothing from elsewhere either
+		w.Header().Set("Content-Security-Policy",
+			"default-src 'none'; img-src data:; style-src 'unsafe-inline'; sandbox")
+	}
+	w.Write([]byte(m.Export(format)))
+}
+
+// Serves /v1/verify-auth for the message \a text.
+func (s *server) verifyAuth(w http.ResponseWriter, r *http.Request, text string) {
+	reply(w, http.StatusOK, s.authResults(text))
+}
+
+// Returns the results of verifying the DKIM signatures and ARC chain of
+// the message \a text.
+func (s *server) authResults(text string) authResults {
+	results := authResults{DKIM: []dkimResult{}}
+	var summary []string
+	for _, d := range s.verifier.Verify(text) {
+		res := dkimResult{Result: d.Result, Domain: d.Domain, Selector: d.Selector}
+		if d.Err != nil {
+			res.Error = d.Err.Error()
+		}
+		results.DKIM = append(results.DKIM, res)
+		summary = append(summary, d.String())
+	}
+	if len(results.DKIM) == 0 {
+		summary = append(summary, "dkim=none")
+	}
+	arc := s.verifier.VerifyARC(text)
+	results.ARC = arc.Result
+	results.ARCSealers = arc.Sealers
+	summary = append(summary, arc.String())
+	results.AuthenticationResults = strings.Join(summary, "; ")
+	return results
+}
+
+// Serves /v1/send for the message \a text.
+func (s *server) send(w http.ResponseWriter, r *http.Request, text string) {
+	if s.transport == nil {
+		replyError(w, http.StatusNotImplemented, "sending is not configured; see -relay")
+		return
+	}
+	if !s.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		replyError(w, http.StatusUnauthorized, "sending needs the token in MAILD_TOKEN")
+		return
+	}
+	env, err := s.deliver(mail.Envelope{From: r.URL.Query().Get("from"), To: r.URL.Query()["to"]}, text)
+	if re, ok := err.(*requestError); ok {
+		replyError(w, re.code, re.msg)
+		return
+	}
+	if err == nil {
+		reply(w, http.StatusOK, map[string]interface{}{"sent": true, "recipients": env.To})
+		return
+	}
+	status, ok := mail.SMTPStatusFromError(err)
+	if !ok {
+		replyError(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	code := http.StatusBadGateway
+	if advice, retry := status.Retry(); retry {
+		code = http.StatusServiceUnavailable
+		w.Header().Set("Retry-After", strconv.Itoa(int(advice.Delay.Seconds())))
+	}
+	reply(w, code, errorReply{Error: err.Error(), SMTPStatus: &status})
+}
+
+// An error in a request, which is answered with the HTTP status code.
+type requestError struct {
+	code int
+	msg  string
+}
+
+func (e *requestError) Error() string {
+	return e.msg
+}
+
+// Sends the message \a text to \a env, taking the sender and recipients
+// from the message's header if \a env lacks them, and removing its Bcc
+// fields. Returns the envelope used and the transport's error, or a
+// *requestError if the message cannot be sent as it is.
+func (s *server) deliver(env mail.Envelope, text string) (mail.Envelope, error) {
+	if env.From == "" || len(env.To) == 0 {
+		m, err := mail.ReadMessage(text)
+		if err != nil {
+			return env, &requestError{http.StatusUnprocessableEntity, err.Error()}
+		}
+		if env.From == "" {
+			if from := m.Header.Addresses(mail.FromFieldName); len(from) > 0 {
+				env.From = from[0].Localpart + "@" + from[0].Domain
+			}
+		}
+		if len(env.To) == 0 {
+			for _, name := range []string{mail.ToFieldName, mail.CcFieldName, mail.BccFieldName} {
+				for _, a := range m.Header.Addresses(name) {
+					env.To = append(env.To, a.Localpart+"@"+a.Domain)
+				}
+			}
+		}
+	}
+	if len(env.To) == 0 {
+		return env, &requestError{http.StatusBadRequest, "the message has no recipients"}
+	}
+	// Bcc must not reach the recipients, whoever chose the envelope
+	return env, s.transport.Send(env, stripBcc(text))
+}
+
+// Returns \a text without its Bcc fields, and otherwise exactly as it is,
+// so that a DKIM signature over the message still verifies.
+func stripBcc(text string) string {
+	var buf strings.Builder
+	bcc := false
+	i := 0
+	for i < len(text) {
+		end := strings.IndexByte(text[i:], '\n') + i + 1
+		if end == i {
+			end = len(text)
+		}
+		line := text[i:end]
+		if line == "\r\n" || line == "\n" {
+			// the rest is the body
+			buf.WriteString(text[i:])
+			break
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			colon := strings.IndexByte(line, ':')
+			bcc = colon > 0 && strings.EqualFold(strings.TrimRight(line[:colon], " \t"), "bcc")
+		}
+		if !bcc {
+			buf.WriteString(line)
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// Returns true if the request \a r carries the server's token. Without a
+// token, nothing is authorized.
+func (s *server) authorized(r *http.Request) bool {
+	want := "Bearer " + s.token
+	got := r.Header.Get("Authorization")
+	return s.token != "" && subtle.ConstantTimeCompare([]byte(got), []byte(want)) == 1
+}
+
+// Returns true if \a r comes from a web page in another origin. Browsers
+// send Origin with every cross-origin POST, so a page cannot make a
+// visitor's browser use a maild on e.g. localhost.
+func crossOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return false
+	}
+	u, err := url.Parse(origin)
+	return err != nil || !strings.EqualFold(u.Host, r.Host)
+}
+
+// A statusWriter remembers the status code of its reply, for the metrics.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Writes \a v as a JSON reply with the status \a code.
+func reply(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+// Writes an error reply saying \a msg with the status \a code.
+func replyError(w http.ResponseWriter, code int, msg string) {
+	reply(w, code, errorReply{Error: msg})
+}
@@ -0,0 +1,204 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestServer(t *testing.T) {
+	sink := testutil.NewSink(t)
+	defer sink.Close()
+	sink.Reject = func(rcpt string) string {
+		if strings.HasPrefix(rcpt, "busy@") {
+			return "451 4.7.1 Greylisted, try again in 120 seconds"
+		}
+		return ""
+	}
+	pub, key, _ := ed25519.GenerateKey(rand.Reader)
+	s := &server{
+		transport: &mail.SMTPTransport{Addr: sink.Addr},
+		verifier: &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(pub)}, nil
+		}},
+		maxSize: 1 << 20,
+		token:   "secret",
+	}
+	post := func(path, accept, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("POST", path, strings.NewReader(body))
+		r.Header.Set("Accept", accept)
+		r.Header.Set("Authorization", "Bearer secret")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		return w
+	}
+
+	text, err := testutil.MixedMessage(1).Subject("Report").
+		Attach("data.bin", "application/octet-stream", "\x00\x01\x02").RFC822()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := post("/v1/parse", "application/json", text)
+	var p parsed
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("parse: %d %v %s", w.Code, err, w.Body)
+	}
+	if got := p.Header.Get(mail.SubjectFieldName); got != "Report" {
+		t.Errorf("Subject = %q", got)
+	}
+	if p.Text == "" || len(p.Attachments) == 0 {
+		t.Errorf("parse: %+v", p)
+	}
+	if a := p.Attachments[len(p.Attachments)-1]; a.Filename != "data.bin" || string(a.Data) != "\x00\x01\x02" {
+		t.Errorf("attachment = %+v", a)
+	}
+
+	// streamed, each object is a line of its own
+	w = post("/v1/parse", "application/x-ndjson", text)
+	var kinds []string
+	lines := bufio.NewScanner(w.Body)
+	for lines.Scan() {
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(lines.Bytes(), &fields); err != nil || len(fields) != 1 {
+			t.Fatalf("line %q: %v", lines.Text(), err)
+		}
+		for k := range fields {
+			kinds = append(kinds, k)
+		}
+	}
+	if got := strings.Join(kinds, " "); !strings.HasPrefix(got, "header text ") ||
+		!strings.HasSuffix(got, " attachment") {
+		t.Errorf("streamed %s", got)
+	}
+
+	w = post("/v1/render?format=html", "", text)
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(w.Body.String(), "Report") {
+		t.Errorf("render: %d %s", w.Code, w.Body)
+	}
+	if csp := w.Header().Get("Content-Security-Policy"); !strings.Contains(csp, "default-src 'none'") ||
+		!strings.Contains(csp, "sandbox") {
+		t.Errorf("render: Content-Security-Policy = %q", csp)
+	}
+	if w = post("/v1/render?format=pdf", "", text); w.Code != http.StatusBadRequest {
+		t.Errorf("render as pdf: %d", w.Code)
+	}
+
+	signed, err := (&mail.DKIMSigner{Domain: "example.com", Selector: "ed", Key: key, Relaxed: true}).Sign(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w = post("/v1/verify-auth", "", signed)
+	var auth authResults
+	json.Unmarshal(w.Body.Bytes(), &auth)
+	if len(auth.DKIM) != 1 || auth.DKIM[0].Result != "pass" ||
+		auth.AuthenticationResults != "dkim=pass header.d=example.com header.s=ed; arc=none" {
+		t.Errorf("verify-auth: %s", w.Body)
+	}
+
+	w = post("/v1/send", "", text)
+	if w.Code != http.StatusOK {
+		t.Fatalf("send: %d %s", w.Code, w.Body)
+	}
+	sink.WasSentTo(t, "bob@example.com")
+
+	// Bcc is removed without changing anything a signature covers
+	w = post("/v1/send?from=alice@example.com&to=dave@example.com", "",
+		"Bcc: carol@example.com,\r\n eve@example.com\r\n"+signed)
+	if w.Code != http.StatusOK {
+		t.Fatalf("send with envelope: %d %s", w.Code, w.Body)
+	}
+	if d := sink.WasSentTo(t, "dave@example.com"); d != nil {
+		if d.Text != signed {
+			t.Errorf("sent message changed:\n%s", d.Text)
+		}
+		if r := s.verifier.Verify(d.Text); len(r) != 1 || r[0].Result != "pass" {
+			t.Errorf("signature of the sent message: %v", r)
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/v1/send", strings.NewReader(text))
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("send without token: %d", rec.Code)
+	}
+	r = httptest.NewRequest("POST", "/v1/send", strings.NewReader(text))
+	r.Header.Set("Authorization", "Bearer secret")
+	r.Header.Set("Origin", "https://evil.example")
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("cross-origin send: %d", rec.Code)
+	}
+
+	w = post("/v1/send?from=alice@example.com&to=busy@example.com", "", text)
+	var e errorReply
+	json.Unmarshal(w.Body.Bytes(), &e)
+	if w.Code != http.StatusServiceUnavailable || w.Header().Get("Retry-After") != "120" ||
+		e.SMTPStatus == nil || e.SMTPStatus.Code != 451 {
+		t.Errorf("deferred send: %d %s %s", w.Code, w.Header(), w.Body)
+	}
+
+	if w = post("/v1/nothing", "", text); w.Code != http.StatusNotFound {
+		t.Errorf("unknown path: %d", w.Code)
+	}
+	r = httptest.NewRequest("GET", "/v1/parse", nil)
+	rec = httptest.NewRecorder()
+	s.ServeHTTP(rec, r)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: %d", rec.Code)
+	}
+	if w = post("/v1/parse", "", strings.Repeat("x", 2<<20)); w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("too large: %d", w.Code)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	metrics := mail.NewPrometheusMetrics()
+	oldMetrics := mail.DefaultMetrics
+	mail.DefaultMetrics = metrics
+	defer func() {
+		mail.DefaultMetrics = oldMetrics
+	}()
+	s := &server{verifier: &mail.DKIMVerifier{}, maxSize: 1 << 20, metrics: metrics}
+
+	for _, path := range []string{"/v1/parse", "/v1/render?format=pdf"} {
+		r := httptest.NewRequest("POST", path, strings.NewReader("From: alice@example.com\r\n\r\nHi\r\n"))
+		s.ServeHTTP(httptest.NewRecorder(), r)
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type = %q", w.Header().Get("Content-Type"))
+	}
+	for _, line := range []string{
+		"\nmail_parse_duration_seconds_count 1\n",
+		"\nmaild_requests_total{code=\"200\",operation=\"parse\"} 1\n",
+		"\nmaild_requests_total{code=\"400\",operation=\"render\"} 1\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("missing %q in:\n%s", line, w.Body)
+		}
+	}
+
+	s.metrics = nil
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != http.StatusNotFound {
+		t.Errorf("without metrics: %d", w.Code)
+	}
+}
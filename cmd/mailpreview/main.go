@@ -0,0 +1,285 @@
+// Command mailpreview serves messages over HTTP for previewing, e.g. while
+// developing email templates. It uses only the public API of package mail.
+//
+// Usage:
+//
+//	mailpreview [-addr host:port] file-or-directory...
+//
+// Each argument is a .eml file, an mbox, or a directory whose .eml files are
+// served. The files are read again for each request, so a page shows the
+// current version of a message after a reload.
+//
+// The HTML body of each message is sanitized, so that it cannot run scripts
+// or fetch anything from elsewhere, and shown in a sandboxed frame. Images
+// referred to by cid: URLs are served from the message, and attachments may
+// be downloaded.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jimexcel/mail"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8025", "the address to listen on")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: mailpreview [-addr host:port] file-or-directory...")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	s := &server{paths: flag.Args()}
+	log.Printf("serving %d path(s) on http://%s/", len(s.paths), *addr)
+	log.Fatal(http.ListenAndServe(*addr, s))
+}
+
+// A server serves the messages found in paths.
+type server struct {
+	paths []string
+}
+
+// A source is a message and where it was found.
+type source struct {
+	Name    string
+	Raw     string
+	Message *mail.Message
+	Err     error
+}
+
+// Returns the messages in the server's paths, in order.
+func (s *server) load() ([]*source, error) {
+	var r []*source
+	for _, path := range s.paths {
+		names := []string{path}
+		if fi, err := os.Stat(path); err != nil {
+			return nil, err
+		} else if fi.IsDir() {
+			names, err = filepath.Glob(filepath.Join(path, "*.eml"))
+			if err != nil {
+				return nil, err
+			}
+			sort.Strings(names)
+		}
+		for _, name := range names {
+			b, err := ioutil.ReadFile(name)
+			if err != nil {
+				return nil, err
+			}
+			text := string(b)
+			if !strings.HasPrefix(text, "From ") {
+				r = append(r, newSource(name, text))
+				continue
+			}
+			mbox := mail.NewMboxReader(strings.NewReader(text))
+			for i := 1; ; i++ {
+				raw, err := mbox.NextRaw()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					return nil, err
+				}
+				r = append(r, newSource(name+":"+strconv.Itoa(i), raw))
+			}
+		}
+	}
+	return r, nil
+}
+
+// Returns a source for the message \a raw, found in \a name.
+func newSource(name, raw string) *source {
+	m, err := mail.ReadMessage(raw)
+	return &source{Name: name, Raw: raw, Message: m, Err: err}
+}
+
+// Serves "/", the list of messages, and "/m/<n>/...", the pages for message
+// n.
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	sources, err := s.load()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Path == "/" {
+		render(w, indexPage, sources)
+		return
+	}
+	path := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(path) < 2 || path[0] != "m" {
+		http.NotFound(w, r)
+		return
+	}
+	n, err := strconv.Atoi(path[1])
+	if err != nil || n < 1 || n > len(sources) {
+		http.NotFound(w, r)
+		return
+	}
+	src := sources[n-1]
+	action := strings.Join(path[2:], "/")
+	if action == "raw" || src.Err != nil && action == "" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		io.WriteString(w, src.Raw)
+		return
+	}
+	if src.Err != nil {
+		http.Error(w, src.Err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	switch {
+	case action == "":
+		render(w, messagePage, struct {
+			N int
+			*source
+		}{n, src})
+	case action == "body":
+		s.body(w, n, src.Message)
+	case strings.HasPrefix(action, "cid/"):
+		id, err := url.PathUnescape(strings.TrimPrefix(action, "cid/"))
+		p := src.Message.PartByContentID(id)
+		if err != nil || p == nil {
+			http.NotFound(w, r)
+			return
+		}
+		servePart(w, p, false)
+	case strings.HasPrefix(action, "attachment/"):
+		k, err := strconv.Atoi(strings.TrimPrefix(action, "attachment/"))
+		attachments := src.Message.Attachments()
+		if err != nil || k < 1 || k > len(attachments) {
+			http.NotFound(w, r)
+			return
+		}
+		servePart(w, attachments[k-1], true)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// Serves the sanitized body of \a m, which is message \a n, as a document
+// which may load nothing but the message's own parts.
+func (s *server) body(w http.ResponseWriter, n int, m *mail.Message) {
+	html := m.SanitizedHTML(func(id string) string {
+		return "/m/" + strconv.Itoa(n) + "/cid/" + url.PathEscape(id)
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy",
+		"default-src 'none'; img-src 'self' data:; style-src 'unsafe-inline'")
+	io.WriteString(w, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n"+
+		"<base target=\"_blank\">\n</head>\n<body>\n"+html+"\n</body>\n</html>\n")
+}
+
+// Serves the decoded content of \a p, as a download if \a download is true.
+func servePart(w http.ResponseWriter, p *mail.Part, download bool) {
+	ct := "application/octet-stream"
+	if t := p.Header.ContentType(); t != nil {
+		ct = t.Type + "/" + t.Subtype
+		if t.Type == "text" {
+			ct += "; charset=utf-8"
+		}
+	} else {
+		ct = "text/plain; charset=utf-8"
+	}
+	if download || !strings.HasPrefix(ct, "image/") {
+		// anything but an image might be active content, e.g. HTML or SVG
+		// with scripts, so it must not be displayed as part of this site
+		name := p.Filename()
+		if name == "" {
+			name = "attachment"
+		}
+		w.Header().Set("Content-Disposition",
+			"attachment; filename*=UTF-8''"+url.PathEscape(name))
+	}
+	if ct == "image/svg+xml" {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'")
+	}
+	w.Header().Set("Content-Type", ct)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	r, err := p.Open()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer r.Close()
+	io.Copy(w, r)
+}
+
+// Executes \a t with \a data, writing the result to \a w.
+func render(w http.ResponseWriter, t *template.Template, data interface{}) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		log.Print(err)
+	}
+}
+
+var funcs = template.FuncMap{
+	"inc": func(i int) int { return i + 1 },
+	"from": func(m *mail.Message) string {
+		if a := m.Header.Addresses(mail.FromFieldName); len(a) > 0 {
+			return a[0].String()
+		}
+		return ""
+	},
+}
+
+const style = `<style>
+body { font-family: sans-serif; margin: 1em 2em; }
+table { border-collapse: collapse; }
+th { text-align: right; padding-right: 1em; vertical-align: top; }
+td { padding: 0.1em 1em 0.1em 0; }
+iframe { width: 100%; height: 70vh; border: 1px solid #ccc; }
+</style>`
+
+var indexPage = template.Must(template.New("index").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>mailpreview</title>
+` + style + `
+</head>
+<body>
+<h1>Messages</h1>
+<table>
+{{range $i, $s := .}}<tr><td><a href="/m/{{inc $i}}">{{inc $i}}</a></td>
+{{if $s.Err}}<td>{{$s.Name}}</td><td colspan="2">{{$s.Err}}</td>
+{{else}}<td>{{from $s.Message}}</td><td><a href="/m/{{inc $i}}">{{$s.Message.Header.Subject}}</a></td><td>{{$s.Name}}</td>
+{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+var messagePage = template.Must(template.New("message").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Message.Header.Subject}}</title>
+` + style + `
+</head>
+<body>
+<p><a href="/">All messages</a> | <a href="/m/{{.N}}/raw">Raw</a></p>
+<table>
+{{range .Message.Header.Fields}}<tr><th>{{.Name}}:</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+{{with .Message.Attachments}}<h2>Attachments</h2>
+<ol>
+{{range $i, $a := .}}<li><a href="/m/{{$.N}}/attachment/{{inc $i}}">{{or $a.Filename "(unnamed)"}}</a> ({{$a.Size}} bytes)</li>
+{{end}}</ol>
+{{end}}<iframe sandbox src="/m/{{.N}}/body"></iframe>
+</body>
+</html>
+`))
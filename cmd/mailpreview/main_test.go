@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestServer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailpreview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("Subject", "Newsletter")
+	c.HTML = "<p onclick=\"evil()\">Hello<script>evil()</script></p>" +
+		"<img src=\"cid:logo@example.com\" alt=\"Logo\">" +
+		"<img src=\"https://tracker.example/pixel.gif\">"
+	c.Attach("logo.png", "image/png", "\x89PNG\r\n").ContentID = "logo@example.com"
+	c.Attach("terms.pdf", "application/pdf", "%PDF-1.4\n")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "news.eml"), []byte(m.RFC822(false)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(&server{paths: []string{dir}})
+	defer ts.Close()
+
+	get := func(path string) (*http.Response, string) {
+		t.Helper()
+		r, err := http.Get(ts.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Body.Close()
+		b, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return r, string(b)
+	}
+	contains := func(what, s string, substrings ...string) {
+		t.Helper()
+		for _, sub := range substrings {
+			if !strings.Contains(s, sub) {
+				t.Errorf("%s does not contain %q:\n%s", what, sub, s)
+			}
+		}
+	}
+
+	_, index := get("/")
+	contains("index", index, `<a href="/m/1">Newsletter</a>`, "alice@example.com")
+
+	_, page := get("/m/1")
+	contains("page", page, `<iframe sandbox src="/m/1/body">`,
+		`<a href="/m/1/attachment/2">terms.pdf</a>`)
+
+	r, body := get("/m/1/body")
+	contains("body", body, `<img src="/m/1/cid/logo@example.com" alt="Logo">`, "<p>Hello</p>")
+	if strings.Contains(body, "evil") || strings.Contains(body, "tracker") {
+		t.Errorf("body is not sanitized:\n%s", body)
+	}
+	contains("policy", r.Header.Get("Content-Security-Policy"), "default-src 'none'")
+
+	r, logo := get("/m/1/cid/logo@example.com")
+	if logo != "\x89PNG\r\n" || r.Header.Get("Content-Type") != "image/png" {
+		t.Errorf("logo: %q %v", logo, r.Header)
+	}
+	r, pdf := get("/m/1/attachment/2")
+	if pdf != "%PDF-1.4\n" ||
+		r.Header.Get("Content-Disposition") != "attachment; filename*=UTF-8''terms.pdf" {
+		t.Errorf("attachment: %q %v", pdf, r.Header)
+	}
+	if r, _ := get("/m/2"); r.StatusCode != http.StatusNotFound {
+		t.Errorf("status %d for a missing message", r.StatusCode)
+	}
+}
@@ -0,0 +1,306 @@
+// Command mailview is a terminal browser for messages in .eml and mbox
+// files. It uses only the public API of package mail.
+//
+// Usage:
+//
+//	mailview file...
+//
+// Each file may hold a single message or be an mbox. mailview lists the
+// messages and reads commands from standard input:
+//
+//	<n>           show message n
+//	n, p          show the next or previous message
+//	l             list the messages
+//	h             show all header fields of the current message
+//	t             show the MIME structure of the current message
+//	r             toggle between the decoded and the raw view
+//	s <k> [file]  save attachment k of the current message
+//	q             quit
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jimexcel/mail"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprintln(os.Stderr, "usage: mailview file...")
+		os.Exit(2)
+	}
+	v := &viewer{out: os.Stdout}
+	if fi, err := os.Stdout.Stat(); err == nil && fi.Mode()&os.ModeCharDevice != 0 {
+		v.clear = true
+	}
+	for _, name := range os.Args[1:] {
+		if err := v.load(name); err != nil {
+			fmt.Fprintln(os.Stderr, "mailview:", err)
+			os.Exit(1)
+		}
+	}
+	v.run(os.Stdin)
+}
+
+// An entry is a message and the text it was parsed from.
+type entry struct {
+	source  string
+	raw     string
+	message *mail.Message
+	err     error
+}
+
+// A viewer holds the loaded messages and the state of the display.
+type viewer struct {
+	out     io.Writer
+	clear   bool
+	entries []*entry
+	current int
+	raw     bool
+}
+
+// Loads the messages in the file \a name, which may be an mbox.
+func (v *viewer) load(name string) error {
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	text := string(b)
+	if !strings.HasPrefix(text, "From ") {
+		v.add(name, text)
+		return nil
+	}
+	r := mail.NewMboxReader(strings.NewReader(text))
+	for i := 1; ; i++ {
+		raw, err := r.NextRaw()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		v.add(name+":"+strconv.Itoa(i), raw)
+	}
+}
+
+// Adds the message \a raw, which was read from \a source.
+func (v *viewer) add(source, raw string) {
+	m, err := mail.ReadMessage(raw)
+	v.entries = append(v.entries, &entry{source: source, raw: raw, message: m, err: err})
+}
+
+// Reads commands from \a in until it ends or the user quits.
+func (v *viewer) run(in io.Reader) {
+	v.list()
+	s := bufio.NewScanner(in)
+	for {
+		fmt.Fprint(v.out, "> ")
+		if !s.Scan() {
+			fmt.Fprintln(v.out)
+			return
+		}
+		words := strings.Fields(s.Text())
+		if len(words) == 0 {
+			continue
+		}
+		if !v.command(words) {
+			return
+		}
+	}
+}
+
+// Carries out the command \a words and returns false if it is to quit.
+func (v *viewer) command(words []string) bool {
+	if n, err := strconv.Atoi(words[0]); err == nil {
+		v.show(n - 1)
+		return true
+	}
+	switch words[0] {
+	case "q", "quit":
+		return false
+	case "l", "list":
+		v.list()
+	case "n", "next":
+		v.show(v.current + 1)
+	case "p", "previous":
+		v.show(v.current - 1)
+	case "h", "header":
+		v.header()
+	case "t", "tree":
+		v.structure()
+	case "r", "raw":
+		v.raw = !v.raw
+		v.show(v.current)
+	case "s", "save":
+		v.save(words[1:])
+	default:
+		fmt.Fprintln(v.out, "commands: <n> n p l h t r s <k> [file] q")
+	}
+	return true
+}
+
+// Clears the screen, if output goes to a terminal.
+func (v *viewer) clearScreen() {
+	if v.clear {
+		fmt.Fprint(v.out, "\x1b[H\x1b[2J")
+	}
+}
+
+// Lists the messages, one per line.
+func (v *viewer) list() {
+	v.clearScreen()
+	for i, e := range v.entries {
+		marker := " "
+		if i == v.current {
+			marker = ">"
+		}
+		line := fmt.Sprintf("%s%4d  ", marker, i+1)
+		if e.err != nil {
+			line += e.source + ": " + e.err.Error()
+		} else {
+			h := e.message.Header
+			date := "                "
+			if d := h.Date(); d != nil {
+				date = d.Format("2006-01-02 15:04")
+			}
+			from := ""
+			if a := h.Addresses(mail.FromFieldName); len(a) > 0 {
+				from = a[0].String()
+			}
+			line += date + "  " + pad(from, 28) + "  " + h.Subject()
+		}
+		fmt.Fprintln(v.out, truncate(line, 100))
+	}
+}
+
+// Shows message \a i, decoded or raw.
+func (v *viewer) show(i int) {
+	if i < 0 || i >= len(v.entries) {
+		fmt.Fprintln(v.out, "no such message")
+		return
+	}
+	v.current = i
+	e := v.entries[i]
+	v.clearScreen()
+	fmt.Fprintf(v.out, "--- %d/%d  %s\n", i+1, len(v.entries), e.source)
+	if v.raw || e.err != nil {
+		if e.err != nil {
+			fmt.Fprintln(v.out, "cannot parse:", e.err)
+		}
+		fmt.Fprint(v.out, strings.Replace(e.raw, "\r\n", "\n", -1))
+		return
+	}
+	// Export lists the attachments numbered as save expects them
+	fmt.Fprint(v.out, e.message.Export(mail.ExportText))
+}
+
+// Shows all header fields of the current message, decoded.
+func (v *viewer) header() {
+	m := v.message()
+	if m == nil {
+		return
+	}
+	for _, f := range m.Header.Fields {
+		fmt.Fprintf(v.out, "%s: %s\n", f.Name(), f.Value())
+	}
+}
+
+// Shows the MIME structure of the current message.
+func (v *viewer) structure() {
+	if m := v.message(); m != nil {
+		fmt.Fprint(v.out, m.StructureString())
+	}
+}
+
+// Saves the attachment numbered args[0] of the current message to the file
+// args[1], or if there is no args[1], to a file named after the attachment
+// in the current directory.
+func (v *viewer) save(args []string) {
+	m := v.message()
+	if m == nil {
+		return
+	}
+	attachments := m.Attachments()
+	k := 0
+	if len(args) > 0 {
+		k, _ = strconv.Atoi(args[0])
+	}
+	if k < 1 || k > len(attachments) {
+		fmt.Fprintf(v.out, "usage: s <1-%d> [file]\n", len(attachments))
+		return
+	}
+	a := attachments[k-1]
+	name := ""
+	if len(args) > 1 {
+		name = args[1]
+	} else {
+		// the name comes from the message, so it must not choose the
+		// directory
+		name = filepath.Base(filepath.Clean("/" + a.Filename()))
+		if name == "/" || name == "." {
+			name = "attachment-" + strconv.Itoa(k)
+		}
+	}
+	if err := writePart(name, a); err != nil {
+		fmt.Fprintln(v.out, "cannot save:", err)
+		return
+	}
+	fmt.Fprintf(v.out, "saved %d bytes to %s\n", a.Size(), name)
+}
+
+// Returns the current message, or nil after saying why there is none.
+func (v *viewer) message() *mail.Message {
+	if v.current >= len(v.entries) {
+		fmt.Fprintln(v.out, "no message")
+		return nil
+	}
+	e := v.entries[v.current]
+	if e.err != nil {
+		fmt.Fprintln(v.out, "cannot parse:", e.err)
+		return nil
+	}
+	return e.message
+}
+
+// Writes the decoded content of \a p to the file \a name.
+func writePart(name string, p *mail.Part) error {
+	r, err := p.Open()
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// Returns \a s padded with spaces or truncated to \a n runes.
+func pad(s string, n int) string {
+	s = truncate(s, n)
+	if l := len([]rune(s)); l < n {
+		s += strings.Repeat(" ", n-l)
+	}
+	return s
+}
+
+// Returns \a s truncated to \a n runes.
+func truncate(s string, n int) string {
+	r := []rune(s)
+	if len(r) > n {
+		return string(r[:n])
+	}
+	return s
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestViewer(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mailview")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	plain, err := testutil.PlainMessage(1).Subject("First").RFC822()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mixed, err := testutil.MixedMessage(2).RFC822()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mbox := "From alice@example.com Thu Jan  2 03:04:05 2020\n" + plain + "\n" +
+		"From alice@example.com Thu Jan  2 03:04:05 2020\n" + mixed + "\n"
+	name := filepath.Join(dir, "test.mbox")
+	if err := ioutil.WriteFile(name, []byte(mbox), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	v := &viewer{out: &out}
+	if err := v.load(name); err != nil {
+		t.Fatal(err)
+	}
+	saved := filepath.Join(dir, "figures.csv")
+	v.run(strings.NewReader("2\nt\nh\nr\ns 2 " + saved + "\nq\nl\n"))
+
+	for _, s := range []string{
+		"   1  2020-01-02 03:04  alice@example.com             First\n",
+		"--- 2/2  " + name + ":2\n",
+		"Subject: Quarterly report\n",
+		"Attachments:\n1. report.pdf",
+		"|-- 2 application/pdf, \"report.pdf\", base64",
+		"Content-Type: multipart/mixed; boundary=",
+		"saved 33 bytes to " + saved,
+	} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("output does not contain %q:\n%s", s, out.String())
+		}
+	}
+	b, err := ioutil.ReadFile(saved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "quarter,revenue\r\nQ1,100\r\nQ2,120\r\n" {
+		t.Errorf("saved %q", b)
+	}
+}
@@ -0,0 +1,49 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bytes"
+	"os/exec"
+	"strings"
+)
+
+// A CommandPreviewer previews attachments of the ContentTypes by running
+// Command with the attachment's content as standard input, and taking its
+// standard output as a preview image of the type Output. This renders
+// e.g. the first page of PDF documents with Poppler:
+//
+//	&CommandPreviewer{
+//		ContentTypes: []string{"application/pdf"},
+//		Command: []string{"pdftoppm", "-png", "-singlefile", "-scale-to", "200"},
+//		Output: "image/png",
+//	}
+type CommandPreviewer struct {
+	ContentTypes []string
+	Command      []string
+	Output       string
+}
+
+func (c *CommandPreviewer) Name() string {
+	return "command/" + strings.Join(c.Command, " ")
+}
+
+// Runs the command on \a data if \a p is of one of the ContentTypes.
+func (c *CommandPreviewer) Preview(p *Part, data []byte) (*Preview, error) {
+	ct := p.AttachmentInfo(false).ContentType
+	handled := false
+	for _, t := range c.ContentTypes {
+		handled = handled || strings.EqualFold(t, ct)
+	}
+	if !handled || len(c.Command) == 0 {
+		return nil, nil
+	}
+	cmd := exec.Command(c.Command[0], c.Command[1:]...)
+	cmd.Stdin = bytes.NewReader(data)
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	return &Preview{ContentType: c.Output, Data: out}, nil
+}
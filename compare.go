@@ -0,0 +1,361 @@
+package mail
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// The kinds of difference reported by Compare().
+type ChangeKind int
+
+const (
+	FieldAdded ChangeKind = iota
+	FieldRemoved
+	FieldChanged
+	PartAdded
+	PartRemoved
+	ContentChanged
+)
+
+func (k ChangeKind) String() string {
+	switch k {
+	case FieldAdded:
+		return "field added"
+	case FieldRemoved:
+		return "field removed"
+	case FieldChanged:
+		return "field changed"
+	case PartAdded:
+		return "part added"
+	case PartRemoved:
+		return "part removed"
+	case ContentChanged:
+		return "content changed"
+	}
+	return "unknown"
+}
+
+func (k ChangeKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// A Change is a single difference between two messages, as found by
+// Compare().
+//
+// Part is the IMAP part number of the bodypart concerned, or "" for the
+// message itself. The header of a message/rfc822 bodypart's embedded message
+// is reported with Part set to the part number followed by ".HEADER", as in
+// IMAP section specifiers.
+//
+// For field changes, Field is the field name and Old and New are the field
+// values. For content changes, Old and New are the SHA-256 hashes of the
+// decoded contents. For added and removed parts, Old or New is the part's
+// content type.
+type Change struct {
+	Kind  ChangeKind `json:"kind"`
+	Part  string     `json:"part,omitempty"`
+	Field string     `json:"field,omitempty"`
+	Old   string     `json:"old,omitempty"`
+	New   string     `json:"new,omitempty"`
+}
+
+// Returns a one-line description of this change, e.g.
+// "1.2: field changed: Subject: "a" -> "b"".
+func (c Change) String() string {
+	r := c.Part
+	if r == "" {
+		r = "message"
+	}
+	r += ": " + c.Kind.String()
+	if c.Field != "" {
+		r += ": " + c.Field
+	}
+	switch c.Kind {
+	case FieldAdded, PartAdded:
+		r += ": " + strconv.Quote(c.New)
+	case FieldRemoved, PartRemoved:
+		r += ": " + strconv.Quote(c.Old)
+	default:
+		r += ": " + strconv.Quote(c.Old) + " -> " + strconv.Quote(c.New)
+	}
+	return r
+}
+
+// Compares \a a and \a b and returns their differences: header fields that
+// have been added, removed or changed, bodyparts that have been added or
+// removed, and bodyparts whose decoded content differs. Returns an empty
+// slice if the two messages are equivalent. If only one of them is nil,
+// the whole message is reported as added or removed, with Part "".
+//
+// Bodyparts are matched by position, and header fields by name and position
+// among the fields with that name, so reordering fields is not reported.
+// This is meant for regression testing of gateways and migrations, where the
+// output is expected to be mostly the same as the input.
+func Compare(a, b *Message) []Change {
+	r := []Change{}
+	switch {
+	case a == nil || a.Part == nil:
+		if b != nil && b.Part != nil {
+			r = append(r, Change{Kind: PartAdded, New: b.Part.contentType()})
+		}
+		return r
+	case b == nil || b.Part == nil:
+		return append(r, Change{Kind: PartRemoved, Old: a.Part.contentType()})
+	}
+	return comparePart(r, "", a.Part, b.Part)
+}
+
+// Appends the differences between \a a and \a b, whose part number is
+// \a number, to \a r and returns the result.
+func comparePart(r []Change, number string, a, b *Part) []Change {
+	r = compareHeaders(r, number, a.Header, b.Header)
+
+	if len(a.Parts) == 0 && len(b.Parts) == 0 {
+		ha := a.contentHash()
+		hb := b.contentHash()
+		if ha != hb {
+			r = append(r, Change{Kind: ContentChanged, Part: number, Old: ha, New: hb})
+		}
+	}
+
+	if a.message != nil && b.message != nil {
+		r = compareHeaders(r, partNumber(number, 0)+"HEADER",
+			a.message.Header, b.message.Header)
+	}
+
+	for i := 0; i < len(a.Parts) || i < len(b.Parts); i++ {
+		n := partNumber(number, i+1)
+		switch {
+		case i >= len(b.Parts):
+			r = append(r, Change{Kind: PartRemoved, Part: n, Old: a.Parts[i].contentType()})
+		case i >= len(a.Parts):
+			r = append(r, Change{Kind: PartAdded, Part: n, New: b.Parts[i].contentType()})
+		default:
+			r = comparePart(r, n, a.Parts[i], b.Parts[i])
+		}
+	}
+	return r
+}
+
+// Returns the part number of child \a n of the part numbered \a parent. If
+// \a n is 0, returns the prefix used for all children.
+func partNumber(parent string, n int) string {
+	r := ""
+	if parent != "" {
+		r = parent + "."
+	}
+	if n > 0 {
+		r += strconv.Itoa(n)
+	}
+	return r
+}
+
+// Appends the differences between the fields of \a a and \a b to \a r and
+// returns the result.
+func compareHeaders(r []Change, number string, a, b *Header) []Change {
+	fa := headerValues(a)
+	fb := headerValues(b)
+	names := []string{}
+	seen := map[string]bool{}
+	for _, h := range []*Header{a, b} {
+		if h == nil {
+			continue
+		}
+		for _, f := range h.Fields {
+			if !seen[f.Name()] {
+				seen[f.Name()] = true
+				names = append(names, f.Name())
+			}
+		}
+	}
+	for _, name := range names {
+		va := fa[name]
+		vb := fb[name]
+		for i := 0; i < len(va) || i < len(vb); i++ {
+			switch {
+			case i >= len(vb):
+				r = append(r, Change{Kind: FieldRemoved, Part: number, Field: name, Old: va[i]})
+			case i >= len(va):
+				r = append(r, Change{Kind: FieldAdded, Part: number, Field: name, New: vb[i]})
+			case va[i] != vb[i]:
+				r = append(r, Change{Kind: FieldChanged, Part: number, Field: name, Old: va[i], New: vb[i]})
+			}
+		}
+	}
+	return r
+}
+
+// Returns the values of the fields in \a h, grouped by field name.
+func headerValues(h *Header) map[string][]string {
+	r := map[string][]string{}
+	if h == nil {
+		return r
+	}
+	for _, f := range h.Fields {
+		r[f.Name()] = append(r[f.Name()], f.Value())
+	}
+	return r
+}
+
+// Returns the SHA-256 hash of the decoded content of this bodypart, in hex.
+func (p *Part) contentHash() string {
+	s, _ := p.data()
+	if p.hasText {
+		s = p.Text
+	}
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
+// Returns the content type of this bodypart as "type/subtype", or "" if it
+// has none.
+func (p *Part) contentType() string {
+	if p.Header == nil {
+		return ""
+	}
+	ct := p.Header.ContentType()
+	if ct == nil {
+		return ""
+	}
+	return ct.Type + "/" + ct.Subtype
+}
+
+// Returns true if \a a and \a b are semantically equal, i.e. if they would
+// look the same to a reader, even if their text differs.
+//
+// Unlike Compare(), Equal() disregards what only serves to transport the
+// message: Content-Transfer-Encoding and MIME-Version fields, empty fields
+// (which the parser removes), MIME boundaries, the charset parameter (since
+// content is compared decoded), a Content-Type field which gives the
+// default type, and the form of line breaks in text, including whether it
+// ends with one. The case of MIME types, dispositions and parameter names,
+// and the order of parameters, do not matter either. Other header fields
+// are compared as Compare() compares them, so a message is Equal() to itself
+// after being rendered with RFC822() and parsed again.
+func Equal(a, b *Message) bool {
+	if a == nil || b == nil || a.Part == nil || b.Part == nil {
+		return (a == nil || a.Part == nil) && (b == nil || b.Part == nil)
+	}
+	return equalParts(a.Part, b.Part)
+}
+
+// Returns true if the bodyparts \a a and \a b are equal as described for
+// Equal().
+func equalParts(a, b *Part) bool {
+	if !equalHeaders(a, b) {
+		return false
+	}
+	if (a.message == nil) != (b.message == nil) {
+		return false
+	}
+	if a.message != nil {
+		// the embedded message's header is its root part's header
+		return a.message.Part != nil && b.message.Part != nil &&
+			equalParts(a.message.Part, b.message.Part)
+	}
+	if len(a.Parts) != len(b.Parts) {
+		return false
+	}
+	if len(a.Parts) == 0 {
+		if a.hasText && b.hasText {
+			return canonicalText(a.Text) == canonicalText(b.Text)
+		}
+		return a.contentHash() == b.contentHash()
+	}
+	for i := range a.Parts {
+		if !equalParts(a.Parts[i], b.Parts[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the headers of \a a and \a b hold the same fields, with
+// equivalent values, disregarding those which only serve transport.
+func equalHeaders(a, b *Part) bool {
+	fa := semanticFields(a)
+	fb := semanticFields(b)
+	if len(fa) != len(fb) {
+		return false
+	}
+	for name, va := range fa {
+		vb := fb[name]
+		if len(va) != len(vb) {
+			return false
+		}
+		for i := range va {
+			if va[i] != vb[i] {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns the values of the header fields of \a p, grouped by field name,
+// in the form compared by Equal().
+func semanticFields(p *Part) map[string][]string {
+	r := map[string][]string{}
+	if p.Header == nil {
+		return r
+	}
+	for _, f := range p.Header.Fields {
+		v := f.Value()
+		switch f := f.(type) {
+		case *ContentTransferEncoding:
+			continue
+		case *ContentType:
+			v = mimeValue(f.Type+"/"+f.Subtype, &f.MIMEField, "boundary", "charset")
+			if v == p.defaultContentType() {
+				continue
+			}
+		case *ContentDisposition:
+			v = mimeValue(f.Disposition, &f.MIMEField)
+		}
+		if f.Name() == MIMEVersionFieldName || strings.TrimSpace(v) == "" {
+			continue
+		}
+		r[f.Name()] = append(r[f.Name()], v)
+	}
+	return r
+}
+
+// Returns the Content-Type a bodypart has if it has no Content-Type field,
+// as "type/subtype".
+func (p *Part) defaultContentType() string {
+	if p.parent != nil && p.parent.contentType() == "multipart/digest" {
+		return "message/rfc822"
+	}
+	return "text/plain"
+}
+
+// Returns \a base, lower-cased, followed by the parameters of \a f except
+// those named in \a ignored, sorted by name.
+func mimeValue(base string, f *MIMEField, ignored ...string) string {
+	params := []string{}
+	for _, p := range f.Parameters {
+		name := strings.ToLower(p.Name)
+		skip := false
+		for _, i := range ignored {
+			skip = skip || name == i
+		}
+		if !skip {
+			params = append(params, name+"="+p.Value)
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(append([]string{strings.ToLower(base)}, params...), "; ")
+}
+
+// Returns \a text with CRLF line breaks, ending with one unless it is
+// empty, as text is when parsed from base64, quoted-printable or 7bit alike.
+func canonicalText(text string) string {
+	text = NormalizeLineEndings(text, crlf)
+	if text != "" && !strings.HasSuffix(text, crlf) {
+		text += crlf
+	}
+	return text
+}
@@ -0,0 +1,182 @@
+package mail_test
+
+import (
+	"fmt"
+	mrand "math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestCompare(t *testing.T) {
+	a := loadFixture(t, "multipart")
+	b := loadFixture(t, "multipart")
+	if changes := mail.Compare(a, b); len(changes) != 0 {
+		t.Fatalf("expected no changes, got %v", changes)
+	}
+
+	b.Header.RemoveAllNamed("Subject")
+	b.Parts[0].Parts[0].Text = "Dog!\r\n"
+	b.Parts = b.Parts[:1]
+	changes := mail.Compare(a, b)
+	if len(changes) != 3 {
+		t.Fatalf("expected 3 changes, got %v", changes)
+	}
+	if changes[0].Kind != mail.FieldRemoved || changes[0].Field != "Subject" {
+		t.Errorf("unexpected change: %v", changes[0])
+	}
+	if changes[1].Kind != mail.ContentChanged || changes[1].Part != "1.1" {
+		t.Errorf("unexpected change: %v", changes[1])
+	}
+	if changes[2].Kind != mail.PartRemoved || changes[2].Part != "2" ||
+		changes[2].Old != "image/png" {
+		t.Errorf("unexpected change: %v", changes[2])
+	}
+}
+
+func TestCompareNil(t *testing.T) {
+	m := loadFixture(t, "multipart")
+	changes := mail.Compare(nil, m)
+	if len(changes) != 1 || changes[0].Kind != mail.PartAdded || changes[0].Part != "" ||
+		changes[0].New != "multipart/related" {
+		t.Errorf("Compare(nil, m) = %v", changes)
+	}
+	changes = mail.Compare(m, nil)
+	if len(changes) != 1 || changes[0].Kind != mail.PartRemoved || changes[0].Old != "multipart/related" {
+		t.Errorf("Compare(m, nil) = %v", changes)
+	}
+	if changes = mail.Compare(nil, nil); len(changes) != 0 {
+		t.Errorf("Compare(nil, nil) = %v", changes)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	a, err := mail.ReadMessage("From: alice@example.com\r\nSubject: Hi\r\n" +
+		"Content-Type: text/plain; charset=us-ascii\r\n" +
+		"Content-Transfer-Encoding: 7bit\r\n\r\nHello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := mail.ReadMessage("Subject: Hi\r\nFrom: alice@example.com\r\n" +
+		"MIME-Version: 1.0\r\nContent-Transfer-Encoding: base64\r\n\r\nSGVsbG8NCg==\r\n")
+	c, _ := mail.ReadMessage("From: alice@example.com\r\nSubject: Hi!\r\n\r\nHello\r\n")
+	d, _ := mail.ReadMessage("From: alice@example.com\r\nSubject: Hi\r\n" +
+		"Content-Type: text/html\r\n\r\nHello\r\n")
+	if !mail.Equal(a, b) {
+		t.Errorf("transport differences reported: %v", mail.Compare(a, b))
+	}
+	if mail.Equal(a, c) {
+		t.Error("different subjects are equal")
+	}
+	if mail.Equal(a, d) {
+		t.Error("different content types are equal")
+	}
+	if !mail.Equal(mail.NewMessage(), mail.NewMessage()) || !mail.Equal(nil, nil) {
+		t.Error("empty messages differ")
+	}
+}
+
+// A random input to a Composer, for property tests.
+type composeInput struct {
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []*mail.Attachment
+}
+
+// Returns a random string of up to \a n characters, drawing on ASCII, Latin
+// and other scripts, line breaks, and characters with meaning in MIME.
+func randomText(r *mrand.Rand, n int) string {
+	pieces := []string{"a", "Z", "0", " ", "  ", "\n", "\r\n", "=", "?", "_",
+		".", "-", "--", "From ", "é", "ü", "日本", "€", "\t", "\"", "<", ">", ";"}
+	var b strings.Builder
+	for i := r.Intn(n + 1); i > 0; i-- {
+		if r.Intn(3) == 0 {
+			b.WriteString(pieces[r.Intn(len(pieces))])
+		} else {
+			b.WriteByte(byte('a' + r.Intn(26)))
+		}
+	}
+	return b.String()
+}
+
+// Returns randomText() without control characters, e.g. for a subject.
+func randomLine(r *mrand.Rand, n int) string {
+	return strings.NewReplacer("\r", "", "\n", "", "\t", " ").Replace(randomText(r, n))
+}
+
+func (composeInput) Generate(r *mrand.Rand, size int) reflect.Value {
+	in := composeInput{}
+	in.Subject = randomLine(r, 40)
+	in.Text = randomText(r, size*8)
+	if r.Intn(2) == 0 {
+		in.HTML = "<p>" + htmlEscapeForTest(randomText(r, size*4)) + "</p>"
+	}
+	for i := r.Intn(3); i > 0; i-- {
+		a := &mail.Attachment{Filename: fmt.Sprintf("file%d.dat", i)}
+		switch r.Intn(3) {
+		case 0:
+			a.ContentType = "text/plain"
+			a.Data = randomText(r, size*8)
+		case 1:
+			a.ContentType = "application/octet-stream"
+			data := make([]byte, r.Intn(size*8+1))
+			r.Read(data)
+			a.Data = string(data)
+		default:
+			a.ContentType = "image/png"
+			a.Filename = "Bild " + randomLine(r, 5) + ".png"
+			a.Data = "\x89PNG\r\n\x1a\n" + randomText(r, size)
+		}
+		in.Attachments = append(in.Attachments, a)
+	}
+	return reflect.ValueOf(in)
+}
+
+func htmlEscapeForTest(s string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// Composing, rendering and parsing a message yields an Equal message, and
+// rendering and parsing it again changes nothing.
+func TestRoundTripProperty(t *testing.T) {
+	roundTrip := func(in composeInput) bool {
+		c := mail.NewComposer()
+		c.Header.Add("From", "Alice <alice@example.com>")
+		c.Header.Add("To", "bob@example.com")
+		c.Header.Add("Subject", in.Subject)
+		c.Text = in.Text
+		c.HTML = in.HTML
+		c.Attachments = in.Attachments
+		m, err := c.Compose()
+		if err != nil {
+			t.Logf("cannot compose %+v: %v", in, err)
+			return false
+		}
+		for _, avoidUTF8 := range []bool{false, true} {
+			text := m.RFC822(avoidUTF8)
+			parsed, err := mail.ReadMessage(text)
+			if err != nil {
+				t.Logf("cannot parse:\n%s\n%v", text, err)
+				return false
+			}
+			if !mail.Equal(m, parsed) {
+				t.Logf("differs after parsing:\n%s\n%v", text, mail.Compare(m, parsed))
+				return false
+			}
+			again, _ := mail.ReadMessage(parsed.RFC822(avoidUTF8))
+			if !mail.Equal(parsed, again) {
+				t.Logf("differs after parsing twice:\n%s\n%v", text, mail.Compare(parsed, again))
+				return false
+			}
+		}
+		return true
+	}
+	config := &quick.Config{MaxCount: 300, Rand: mrand.New(mrand.NewSource(1))}
+	if err := quick.Check(roundTrip, config); err != nil {
+		t.Error(err)
+	}
+}
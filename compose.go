@@ -0,0 +1,668 @@
+package mail
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	XExternalAttachmentFieldName = "X-External-Attachment"
+)
+
+// An Attachment is a file to be attached to a composed message.
+//
+// ContentType defaults to application/octet-stream. If Inline is true, the
+// attachment is marked for display inline, and ContentID may be used to refer
+// to it from the HTML body (as "cid:" + ContentID). TransferEncoding may be
+// "7bit", "quoted-printable" or "base64"; if empty, the Composer chooses.
+// The Data of a message/rfc822 attachment is parsed and embedded as a
+// message, which needs no transfer encoding.
+//
+// CreationDate, ModificationDate and ReadDate, if not zero, and Size, if not
+// 0, are given as the Content-Disposition parameters of the same names
+// (RFC 2183); AttachFile() sets ModificationDate and Size from the file.
+type Attachment struct {
+	Filename         string
+	ContentType      string
+	Data             string
+	Inline           bool
+	ContentID        string
+	TransferEncoding string
+
+	CreationDate     time.Time
+	ModificationDate time.Time
+	ReadDate         time.Time
+	Size             int
+}
+
+// An Uploader stores the attachment \a a outside the message, e.g. on a file
+// server, and returns the URL from which it can be retrieved.
+type Uploader func(a *Attachment) (string, error)
+
+// A Composer builds a new message from its parts.
+//
+// Header holds the fields of the message, e.g. From, To and Subject; Compose()
+// adds Date, Message-Id and the MIME fields. Text and HTML are the body, and
+// either or both may be empty. Attachments are added after the body.
+//
+// AMP, if not empty, is an AMP for Email document, sent as a
+// text/x-amp-html alternative between the text and the HTML, where clients
+// which support AMP look for it. Since AMP documents expire and many
+// clients do not show them, Text or HTML is required as well.
+//
+// If InlineCSS is true, the rules of the HTML body's style elements are
+// copied into the style attributes of the elements they apply to, as
+// InlineCSS() describes, since many webmail clients ignore style elements.
+//
+// If Flowed is true, the text body is sent as format=flowed (RFC 3676),
+// wrapped by FormatFlowed() so that readers can reflow its paragraphs; if
+// DelSp is true as well, it is labelled DelSp=yes, which lets words longer
+// than a line be broken.
+//
+// Preheader, if not empty, is the text mailbox lists should show below the
+// subject instead of the start of the body. It is added at the start of the
+// HTML body in an invisible element, padded so that clients do not fill
+// the rest of the preview from the visible text, and as the first paragraph
+// of the text body.
+//
+// The Content-Transfer-Encoding of each part is chosen by
+// ChooseTransferEncoding(). TransferEncoding, if not empty, overrides the
+// choice for the text and HTML bodies, and Attachment.TransferEncoding for
+// each attachment.
+//
+// If Uploader is not nil, each attachment larger than ExternalizeAbove bytes
+// is passed to it and replaced by a short text (or HTML, if the message has an
+// HTML body) part linking to the uploaded file. The replacement part carries
+// an X-External-Attachment field describing the original, which
+// Part.ExternalAttachment() returns.
+//
+// Rand, if not nil, is read for the MIME boundaries and the Message-Id
+// instead of crypto/rand, and Clock, if not nil, gives the time for the Date
+// field, and for the boundaries and Message-Id if Rand cannot be read,
+// instead of the system clock, so that e.g. tests can compose the same
+// message twice.
+//
+// Transforms are applied to the composed message in order, e.g. a
+// LinkTracker's Transform() for the message's recipient. If one fails,
+// Compose() returns its error.
+//
+// If ContentMD5 is true, each part other than multiparts and embedded
+// messages gets an RFC 1864 Content-MD5 field, and if Checksums is true, an
+// X-Checksum field with its SHA-256 digest. ReadMessage() verifies both and
+// reports mismatches in Message.Diagnostics().
+type Composer struct {
+	Header      *Header
+	Text        string
+	HTML        string
+	AMP         string
+	Preheader   string
+	Attachments []*Attachment
+
+	InlineCSS bool
+	Flowed    bool
+	DelSp     bool
+
+	TransferEncoding string
+
+	ExternalizeAbove int
+	Uploader         Uploader
+
+	Rand  RandSource
+	Clock Clock
+
+	Transforms []Transform
+
+	ContentMD5 bool
+	Checksums  bool
+}
+
+// Returns a new Composer with an empty header.
+func NewComposer() *Composer {
+	return &Composer{Header: &Header{mode: RFC5322Header}}
+}
+
+// Adds an attachment named \a filename with type \a contentType and
+// content \a data.
+func (c *Composer) Attach(filename, contentType, data string) *Attachment {
+	a := &Attachment{Filename: filename, ContentType: contentType, Data: data}
+	c.Attachments = append(c.Attachments, a)
+	return a
+}
+
+// Sets the Preheader to \a text.
+func (c *Composer) SetPreheader(text string) {
+	c.Preheader = text
+}
+
+// Returns a new message built from the composer's contents, or an error if
+// an upload fails, the AMP document is invalid (ErrInvalidAMP) or the
+// resulting header is not valid (e.g. because it has no From field).
+//
+// Values which may come from users, such as field values, display names and
+// attachment file names, must not contain control characters; if one does,
+// a *HeaderInjectionError is returned, so that text from a web form cannot
+// add fields of its own.
+func (c *Composer) Compose() (*Message, error) {
+	if err := c.checkInjection(); err != nil {
+		return nil, err
+	}
+	if c.AMP != "" {
+		if c.Text == "" && c.HTML == "" {
+			return nil, wrapError(ErrInvalidAMP, "mail: AMP email needs an HTML or text alternative")
+		}
+		if err := checkAMP(c.AMP); err != nil {
+			return nil, err
+		}
+	}
+	h := &Header{mode: RFC5322Header}
+	if c.Header != nil {
+		for _, f := range c.Header.Fields {
+			h.addField(f)
+		}
+	}
+	if h.field(DateFieldName, 0) == nil {
+		h.Add(DateFieldName, clockNow(c.Clock).Format(dateLayout))
+	}
+	if h.field(MessageIDFieldName, 0) == nil {
+		h.Add(MessageIDFieldName, newMessageID(h, c.Rand, c.Clock))
+	}
+	h.Add(MIMEVersionFieldName, "1.0")
+
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+	m := withRoot(h, root)
+	for _, t := range c.Transforms {
+		if err := t(m); err != nil {
+			return nil, err
+		}
+	}
+	if c.ContentMD5 || c.Checksums {
+		m.Part.addChecksums(c.ContentMD5, c.Checksums)
+	}
+	if err := h.Error(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Returns a *HeaderInjectionError if any header field or attachment
+// parameter contains a control character, and nil otherwise.
+func (c *Composer) checkInjection() error {
+	if c.Header != nil {
+		for _, f := range c.Header.Fields {
+			name := f.Name()
+			if hasControl(name) || strings.ContainsAny(name, ": ") {
+				return &HeaderInjectionError{Field: "field name", Value: name}
+			}
+			var ie *HeaderInjectionError
+			if errors.As(f.Error(), &ie) {
+				return ie
+			}
+			af, ok := f.(*AddressField)
+			if !ok {
+				if hasControl(f.Value()) {
+					return &HeaderInjectionError{Field: name, Value: f.Value()}
+				}
+				continue
+			}
+			for _, a := range af.Addresses {
+				for _, s := range []string{a.name, a.Localpart, a.Domain} {
+					if hasControl(s) {
+						return &HeaderInjectionError{Field: name, Value: s}
+					}
+				}
+			}
+		}
+	}
+	for _, a := range c.Attachments {
+		for _, s := range []string{a.Filename, a.ContentType, a.ContentID} {
+			if hasControl(s) {
+				return &HeaderInjectionError{Field: "attachment", Value: s}
+			}
+		}
+	}
+	if err := checkTransferEncoding(c.TransferEncoding); err != nil {
+		return err
+	}
+	for _, a := range c.Attachments {
+		if err := checkTransferEncoding(a.TransferEncoding); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns an error if \a cte is neither empty nor an encoding the Composer
+// can produce.
+func checkTransferEncoding(cte string) error {
+	switch cte {
+	case "", "7bit", "quoted-printable", "base64":
+		return nil
+	}
+	return fmt.Errorf("mail: cannot compose with Content-Transfer-Encoding %q", cte)
+}
+
+// Returns true if \a s contains a control character other than tab.
+func hasControl(s string) bool {
+	for _, r := range s {
+		if r < ' ' && r != '\t' || r == 0x7f || r >= 0x80 && r < 0xa0 ||
+			r == 0x2028 || r == 0x2029 {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the root bodypart of the composed message, without the message's
+// own header fields.
+func (c *Composer) root() (*Part, error) {
+	var parts []*Part
+	if body := c.body(); body != nil {
+		parts = append(parts, body)
+	}
+	for _, a := range c.Attachments {
+		p, err := c.attachmentPart(a)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, p)
+	}
+
+	switch len(parts) {
+	case 0:
+		return textPart("plain", ""), nil
+	case 1:
+		return parts[0], nil
+	}
+	return multipart("mixed", parts, c.Rand, c.Clock), nil
+}
+
+// Returns a message whose header is \a h and whose body is that of \a root.
+// The fields of \a root's header are added to \a h.
+func withRoot(h *Header, root *Part) *Message {
+	// the message's own header doubles as its root part's header
+	m := NewMessage()
+	for _, f := range root.Header.Fields {
+		h.addField(f)
+	}
+	root.Header = h
+	m.Part = root
+	for _, p := range root.Parts {
+		p.parent = m.Part
+	}
+	return m
+}
+
+// Returns the part holding the text and HTML bodies, or nil if there are
+// neither.
+func (c *Composer) body() *Part {
+	plain, html := c.Text, c.HTML
+	if c.InlineCSS && html != "" {
+		html = InlineCSS(html)
+	}
+	if c.Preheader != "" {
+		if plain != "" {
+			plain = c.Preheader + "\n\n" + plain
+		}
+		if html != "" {
+			html = withPreheader(html, c.Preheader)
+		}
+	}
+	text := func(subtype, s string) *Part {
+		p := textPart(subtype, s)
+		if c.TransferEncoding != "" {
+			setTransferEncoding(p, c.TransferEncoding)
+		}
+		return p
+	}
+	plainPart := func() *Part {
+		if !c.Flowed {
+			return text("plain", plain)
+		}
+		p := text("plain", FormatFlowed(plain, 0, c.DelSp))
+		ct := p.Header.ContentType()
+		ct.addParameter("format", "flowed")
+		if c.DelSp {
+			ct.addParameter("delsp", "yes")
+		}
+		return p
+	}
+	if c.AMP != "" {
+		alternatives := []*Part{}
+		if plain != "" {
+			alternatives = append(alternatives, plainPart())
+		}
+		alternatives = append(alternatives, text("x-amp-html", c.AMP))
+		if html != "" {
+			alternatives = append(alternatives, text("html", html))
+		}
+		return multipart("alternative", alternatives, c.Rand, c.Clock)
+	}
+	switch {
+	case plain != "" && html != "":
+		return multipart("alternative",
+			[]*Part{plainPart(), text("html", html)}, c.Rand, c.Clock)
+	case html != "":
+		return text("html", html)
+	case plain != "":
+		return plainPart()
+	}
+	return nil
+}
+
+// Returns the HTML document \a html with an invisible element holding
+// \a preheader inserted at the start of its body. The element is hidden in
+// every way some client honours, and followed by invisible padding so that
+// clients which show more than the preheader do not go on with the
+// visible text.
+func withPreheader(html, preheader string) string {
+	div := "<div style=\"display:none;font-size:1px;color:transparent;line-height:1px;" +
+		"max-height:0;max-width:0;opacity:0;overflow:hidden;mso-hide:all\">" +
+		htmlEscape(preheader) + strings.Repeat("&#847;&zwnj;&nbsp;", 100) + "</div>"
+	lower := strings.ToLower(html)
+	if i := strings.Index(lower, "<body"); i >= 0 {
+		if end := strings.IndexByte(lower[i:], '>'); end >= 0 {
+			i += end + 1
+			return html[:i] + div + html[i:]
+		}
+	}
+	return div + html
+}
+
+// Returns the part for the attachment \a a, or the stub linking to it if it
+// is externalized.
+func (c *Composer) attachmentPart(a *Attachment) (*Part, error) {
+	ct := a.ContentType
+	if ct == "" {
+		ct = "application/octet-stream"
+	}
+	if c.Uploader != nil && len(a.Data) > c.ExternalizeAbove {
+		url, err := c.Uploader(a)
+		if err != nil {
+			return nil, fmt.Errorf("mail: could not upload %s: %w", a.Filename, err)
+		}
+		return c.externalPart(a, ct, url), nil
+	}
+
+	p := &Part{Header: &Header{mode: MIMEHeader}}
+	h := p.Header
+	h.Add(ContentTypeFieldName, ct)
+	h.Add(ContentDispositionFieldName, disposition(a.Inline, a.Filename))
+	if cd := h.ContentDisposition(); cd != nil {
+		cd.setDateParameter("creation-date", a.CreationDate)
+		cd.setDateParameter("modification-date", a.ModificationDate)
+		cd.setDateParameter("read-date", a.ReadDate)
+		if a.Size > 0 {
+			cd.addParameter("size", strconv.Itoa(a.Size))
+		}
+	}
+	if a.ContentID != "" {
+		h.Add(ContentIDFieldName, "<"+a.ContentID+">")
+	}
+	if strings.HasPrefix(strings.ToLower(ct), "message/rfc822") {
+		m, err := ReadMessage(a.Data)
+		if err != nil {
+			return nil, fmt.Errorf("mail: could not parse %s: %w", a.Filename, err)
+		}
+		m.parent = p
+		for _, c := range m.Parts {
+			p.Parts = append(p.Parts, c)
+			c.parent = p
+		}
+		p.message = m
+		return p, nil
+	}
+	text := strings.HasPrefix(strings.ToLower(ct), "text/")
+	cte := a.TransferEncoding
+	if cte == "" {
+		cte = ChooseTransferEncoding(a.Data, text)
+	}
+	setTransferEncoding(p, cte)
+	if text {
+		p.Text = a.Data
+		if cte != "base64" {
+			// line breaks in text are CRLF in transit
+			p.Text = toCRLF(a.Data)
+		}
+		p.hasText = true
+	} else {
+		p.Data = a.Data
+	}
+	return p, nil
+}
+
+// Returns the Content-Transfer-Encoding best suited to \a data: "7bit" if
+// it can be sent as it is, "quoted-printable" if it is mostly ASCII text, and
+// "base64" otherwise. \a text is true if \a data is text, whose line breaks
+// may be converted to CRLF; other data must use base64 unless it consists of
+// complete CRLF-terminated lines, since anything else would not survive.
+//
+// Data which contains NUL or many control characters is treated as binary.
+// Text is sent as 7bit only if it is ASCII with lines short enough not to be
+// wrapped and nothing which might be mistaken for a boundary or mbox "From "
+// line. Otherwise, quoted-printable is used if at most a sixth of the bytes
+// would need escaping, since it keeps the text readable, and base64 if more,
+// since it is then smaller.
+func ChooseTransferEncoding(data string, text bool) string {
+	if !text && !strings.HasSuffix(data, "\r\n") {
+		return "base64"
+	}
+	eight, control := 0, 0
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch {
+		case c == 0:
+			return "base64"
+		case c == '\r' && i+1 < len(data) && data[i+1] == '\n':
+			i++
+		case c == '\r' || c == '\n':
+			if !text {
+				return "base64"
+			}
+		case c >= 0x80:
+			eight++
+		case c < ' ' && c != '\t' || c == 0x7f:
+			control++
+		}
+	}
+	if control > 0 && (!text || control*100 > len(data)) {
+		return "base64"
+	}
+	if eight == 0 && control == 0 && !needsQP(toCRLF(data)) {
+		return "7bit"
+	}
+	if (eight+control)*6 > len(data) {
+		return "base64"
+	}
+	return "quoted-printable"
+}
+
+// Sets the Content-Transfer-Encoding of \a p to \a cte.
+func setTransferEncoding(p *Part, cte string) {
+	p.Header.RemoveAllNamed(ContentTransferEncodingFieldName)
+	if cte != "7bit" {
+		p.Header.Add(ContentTransferEncodingFieldName, cte)
+	}
+}
+
+// Returns a part linking to \a url, where the attachment \a a, whose content
+// type is \a ct, has been uploaded.
+func (c *Composer) externalPart(a *Attachment, ct, url string) *Part {
+	name := a.Filename
+	if name == "" {
+		name = "attachment"
+	}
+	var p *Part
+	if c.HTML != "" {
+		p = textPart("html", "<p>"+htmlEscape(name)+" ("+
+			formatSize(len(a.Data))+") is available at <a href=\""+
+			htmlEscape(url)+"\">"+htmlEscape(url)+"</a></p>\r\n")
+	} else {
+		p = textPart("plain", name+" ("+formatSize(len(a.Data))+
+			") is available at\r\n"+url+"\r\n")
+	}
+	p.Header.Add(ContentDispositionFieldName, "inline")
+	p.Header.Add(XExternalAttachmentFieldName,
+		(&ExternalAttachment{URL: url, Filename: a.Filename,
+			ContentType: ct, Size: len(a.Data)}).String())
+	return p
+}
+
+// An ExternalAttachment describes an attachment which has been replaced by a
+// link, as recorded in the X-External-Attachment field.
+type ExternalAttachment struct {
+	URL         string `json:"url"`
+	Filename    string `json:"filename,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+	Size        int    `json:"size"`
+}
+
+// Returns the value of an X-External-Attachment field describing \a e, e.g.
+// "<https://example.com/f/1>; filename="a.pdf"; type=application/pdf;
+// size=1048576".
+func (e *ExternalAttachment) String() string {
+	r := "<" + e.URL + ">"
+	if e.Filename != "" {
+		r += "; filename=" + quote(e.Filename, '"', '\\')
+	}
+	if e.ContentType != "" {
+		r += "; type=" + e.ContentType
+	}
+	return r + "; size=" + strconv.Itoa(e.Size)
+}
+
+// Returns the description of the attachment this part replaces, or nil if
+// it has no valid X-External-Attachment field.
+func (p *Part) ExternalAttachment() *ExternalAttachment {
+	if p.Header == nil {
+		return nil
+	}
+	v := simplify(p.Header.Get(XExternalAttachmentFieldName))
+	if !strings.HasPrefix(v, "<") || strings.IndexByte(v, '>') < 0 {
+		return nil
+	}
+	end := strings.IndexByte(v, '>')
+	e := &ExternalAttachment{URL: v[1:end]}
+	for k, v := range parseKeyValues(v[end+1:]) {
+		switch k {
+		case "filename":
+			e.Filename = v
+		case "type":
+			e.ContentType = v
+		case "size":
+			e.Size, _ = strconv.Atoi(v)
+		}
+	}
+	return e
+}
+
+// Returns a new text/\a subtype part containing \a text.
+func textPart(subtype, text string) *Part {
+	p := &Part{Header: &Header{mode: MIMEHeader}}
+	cs := "us-ascii"
+	if !isAscii(text) {
+		cs = "utf-8"
+	}
+	p.Header.Add(ContentTypeFieldName, "text/"+subtype+"; charset="+cs)
+	p.hasText = true
+	p.Text = toCRLF(text)
+	setTransferEncoding(p, ChooseTransferEncoding(text, true))
+	return p
+}
+
+// Returns a new multipart/\a subtype part whose children are \a children,
+// with a boundary made from \a r and \a c as for newBoundary().
+func multipart(subtype string, children []*Part, r RandSource, c Clock) *Part {
+	p := &Part{Header: &Header{mode: MIMEHeader}, Parts: children}
+	p.Header.Add(ContentTypeFieldName,
+		"multipart/"+subtype+"; boundary=\""+newBoundary(r, c, nesting(p))+"\"")
+	for i, c := range children {
+		c.parent = p
+		c.Number = i + 1
+	}
+	return p
+}
+
+// Returns the value of a Content-Disposition field for an attachment called
+// \a filename.
+func disposition(inline bool, filename string) string {
+	r := "attachment"
+	if inline {
+		r = "inline"
+	}
+	if filename != "" {
+		r += "; filename=" + quote(filename, '"', '\\')
+	}
+	return r
+}
+
+// Returns \a n as a human-readable size, e.g. "12 MB".
+func formatSize(n int) string {
+	switch {
+	case n >= 1024*1024:
+		return strconv.Itoa((n+512*1024)/(1024*1024)) + " MB"
+	case n >= 1024:
+		return strconv.Itoa((n+512)/1024) + " KB"
+	}
+	return strconv.Itoa(n) + " bytes"
+}
+
+// Returns \a n random bytes as a hexadecimal string.
+func randomHex(n int) string {
+	return readHex(nil, nil, n)
+}
+
+// Returns \a n bytes read from \a r as a hexadecimal string. If \a r is
+// nil, crypto/rand is used; if it cannot be read, the time from \a c (or
+// the system clock if nil) is used instead.
+func readHex(r RandSource, c Clock, n int) string {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(randReader(r), b); err != nil {
+		// no randomness available; fall back on the clock
+		return strconv.FormatInt(clockNow(c).UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Returns a new MIME boundary made from \a r (or crypto/rand if nil), or
+// failing that from \a c, which cannot occur in base64 or quoted-printable
+// text. \a depth is the nesting depth of the multipart, which tells apart
+// the boundaries of a multipart and the multiparts it contains when they
+// are all made from the same time.
+func newBoundary(r RandSource, c Clock, depth int) string {
+	b := make([]byte, 12)
+	if _, err := io.ReadFull(randReader(r), b); err != nil {
+		return "=_" + strconv.FormatInt(clockNow(c).UnixNano(), 16) + "_" + strconv.Itoa(depth)
+	}
+	return "=_" + hex.EncodeToString(b)
+}
+
+// Returns the number of levels of bodyparts below \a p, e.g. 1 for a
+// multipart whose children are all single parts.
+func nesting(p *Part) int {
+	n := 0
+	for _, c := range p.Parts {
+		if d := nesting(c) + 1; d > n {
+			n = d
+		}
+	}
+	return n
+}
+
+// Returns a new Message-Id for a message with the header \a h, using the
+// domain of its From address and randomness from \a r (or crypto/rand if
+// nil), or failing that the time from \a c.
+func newMessageID(h *Header, r RandSource, c Clock) string {
+	domain := "localhost"
+	if from := h.Addresses(FromFieldName); len(from) > 0 && from[0].Domain != "" {
+		domain = from[0].Domain
+	}
+	return "<" + readHex(r, c, 16) + "@" + domain + ">"
+}
@@ -0,0 +1,193 @@
+package mail_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestComposeExternalAttachments(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "Alice <alice@example.com>")
+	c.Header.Add("To", "bob@example.com")
+	c.Header.Add("Subject", "Reports")
+	c.Text = "See attached.\n"
+	c.Attach("small.txt", "text/plain", "small\r\n")
+	c.Attach("large.pdf", "application/pdf", strings.Repeat("x", 2048))
+	c.ExternalizeAbove = 1024
+	uploaded := []string{}
+	c.Uploader = func(a *mail.Attachment) (string, error) {
+		uploaded = append(uploaded, a.Filename)
+		return "https://files.example.com/" + a.Filename, nil
+	}
+
+	composed, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "uploads", len(uploaded), 1)
+
+	msg, err := mail.ReadMessage(composed.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Header.Valid() {
+		t.Fatalf("composed message is not valid: %v", msg.Header.Error())
+	}
+	testStringEquals(t, "content type", msg.Header.ContentType().Type, "multipart")
+	testIntegerEquals(t, "parts", len(msg.Parts), 3)
+	testStringEquals(t, "body", msg.Parts[0].Text, "See attached.\r\n")
+	testStringEquals(t, "small attachment", msg.Parts[1].Text, "small\r\n")
+	if msg.Parts[1].ExternalAttachment() != nil {
+		t.Error("small attachment was externalized")
+	}
+
+	e := msg.Parts[2].ExternalAttachment()
+	if e == nil {
+		t.Fatal("large attachment was not externalized")
+	}
+	testStringEquals(t, "url", e.URL, "https://files.example.com/large.pdf")
+	testStringEquals(t, "filename", e.Filename, "large.pdf")
+	testStringEquals(t, "type", e.ContentType, "application/pdf")
+	testIntegerEquals(t, "size", e.Size, 2048)
+	if !strings.Contains(msg.Parts[2].Text, e.URL) {
+		t.Errorf("stub does not link to the upload: %q", msg.Parts[2].Text)
+	}
+}
+
+func TestComposeHeaderInjection(t *testing.T) {
+	compose := func(setup func(c *mail.Composer)) error {
+		c := mail.NewComposer()
+		c.Header.Add("From", "alice@example.com")
+		c.Text = "Hello\n"
+		setup(c)
+		_, err := c.Compose()
+		return err
+	}
+
+	err := compose(func(c *mail.Composer) {
+		c.Header.Add("X-Form-Field", "value\nBcc: victim@example.com")
+	})
+	var ie *mail.HeaderInjectionError
+	if !errors.As(err, &ie) || ie.Field != "X-Form-Field" {
+		t.Errorf("unexpected error for field value: %v", err)
+	}
+	if !errors.Is(err, mail.ErrHeaderInjection) {
+		t.Error("error does not match ErrHeaderInjection")
+	}
+
+	for _, name := range []string{"To", "Reply-To"} {
+		err = compose(func(c *mail.Composer) {
+			c.Header.Add(name, "bob@example.com\r\nBcc: victim@example.com")
+		})
+		if !errors.As(err, &ie) || ie.Field != name {
+			t.Errorf("unexpected error for %s: %v", name, err)
+		}
+	}
+
+	h := &mail.Header{}
+	h.Add("To", "bob@example.com")
+	h.Add("To", "carol@example.com\nBcc: victim@example.com")
+	if !errors.Is(h.Error(), mail.ErrHeaderInjection) {
+		t.Errorf("unexpected header error: %v", h.Error())
+	}
+	if strings.Contains(h.AsText(false), "victim") {
+		t.Errorf("injected field in header: %q", h.AsText(false))
+	}
+
+	err = compose(func(c *mail.Composer) {
+		to := mail.NewAddressField("To")
+		to.Addresses = append(to.Addresses,
+			mail.NewAddress("Bob\r\nBcc: victim@example.com", "bob", "example.com"))
+		c.Header.Fields = append(c.Header.Fields, to)
+	})
+	if !errors.Is(err, mail.ErrHeaderInjection) {
+		t.Errorf("unexpected error for display name: %v", err)
+	}
+
+	err = compose(func(c *mail.Composer) {
+		c.Attach("a.txt\r\nContent-Type: text/html", "text/plain", "x")
+	})
+	if !errors.Is(err, mail.ErrHeaderInjection) {
+		t.Errorf("unexpected error for file name: %v", err)
+	}
+
+	err = compose(func(c *mail.Composer) {
+		c.Header.Add("Subject", "Hello\tworld")
+	})
+	if err != nil {
+		t.Errorf("harmless subject rejected: %v", err)
+	}
+}
+
+func TestChooseTransferEncoding(t *testing.T) {
+	for _, c := range []struct {
+		data string
+		text bool
+		want string
+	}{
+		{"Hello\nworld\n", true, "7bit"},
+		{"From the start\n", true, "quoted-printable"},
+		{strings.Repeat("long ", 40) + "\n", true, "quoted-printable"},
+		{"Café au lait, s'il vous plaît.\n", true, "quoted-printable"},
+		{"Привет, как дела?\n", true, "base64"},
+		{"a\x00b", true, "base64"},
+		{"line one\r\nline two\r\n", false, "7bit"},
+		{"line one\nline two\n", false, "base64"},
+		{"\x89PNG\r\n\x1a\n", false, "base64"},
+	} {
+		testStringEquals(t, fmt.Sprintf("%q", c.data),
+			mail.ChooseTransferEncoding(c.data, c.text), c.want)
+	}
+
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "Привет\n"
+	a := c.Attach("notes.txt", "text/plain", "plain ascii\n")
+	a.TransferEncoding = "base64"
+	composed, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(composed.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "body encoding", composed.Parts[0].Header.Get("Content-Transfer-Encoding"), "base64")
+	testStringEquals(t, "body", msg.Parts[0].Text, "Привет\r\n")
+	testStringEquals(t, "overridden encoding", composed.Parts[1].Header.Get("Content-Transfer-Encoding"), "base64")
+	testStringEquals(t, "attachment", msg.Parts[1].Text, "plain ascii\r\n")
+
+	c.TransferEncoding = "8bit"
+	if _, err := c.Compose(); err == nil {
+		t.Error("unsupported transfer encoding accepted")
+	}
+}
+
+func TestPreheader(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "news@example.com")
+	c.Header.Add("To", "reader@example.com")
+	c.Text = "Our autumn sale starts today.\n"
+	c.HTML = "<html><body class=\"x\"><p>Our autumn sale starts today.</p></body></html>"
+	c.SetPreheader("Up to 50% off & free shipping")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "text", m.DisplayBody(mail.PreferPlain).Text,
+		"Up to 50% off & free shipping\r\n\r\nOur autumn sale starts today.\r\n")
+	html := m.DisplayBody(mail.PreferHTML).Text
+	if !strings.HasPrefix(html, "<html><body class=\"x\"><div style=\"display:none;") ||
+		!strings.Contains(html, ">Up to 50% off &amp; free shipping&#847;") {
+		t.Errorf("preheader not inserted: %.200s", html)
+	}
+	testStringEquals(t, "snippet", m.Snippet(29), "Up to 50% off & free shipping")
+
+	c.Text = ""
+	m, _ = c.Compose()
+	testStringEquals(t, "hidden in html", m.Snippet(100), "Our autumn sale starts today.")
+}
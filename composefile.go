@@ -0,0 +1,33 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"io/ioutil"
+	"mime"
+	"os"
+	"path/filepath"
+)
+
+// Adds the file at \a path as an attachment with type \a contentType, named
+// as the file is, with its modification time and size. If \a contentType
+// is empty, it is guessed from the file name's extension. Returns an error
+// if the file cannot be read.
+func (c *Composer) AttachFile(path, contentType string) (*Attachment, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		contentType = mime.TypeByExtension(filepath.Ext(path))
+	}
+	a := c.Attach(filepath.Base(path), contentType, string(data))
+	a.ModificationDate = info.ModTime()
+	a.Size = len(data)
+	return a, nil
+}
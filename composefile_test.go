@@ -0,0 +1,81 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDispositionDates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dispositiondates")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "report.pdf")
+	if err := ioutil.WriteFile(path, []byte("%PDF-1.4 report"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	modified := time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC)
+	if err := os.Chtimes(path, modified, modified); err != nil {
+		t.Fatal(err)
+	}
+
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("To", "bob@example.com")
+	c.Text = "See attached.\n"
+	a, err := c.AttachFile(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.CreationDate = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	attachments := m.Attachments()
+	testIntegerEquals(t, "attachments", len(attachments), 1)
+	testStringEquals(t, "filename", attachments[0].Filename(), "report.pdf")
+	testStringEquals(t, "type", attachments[0].Header.ContentType().Type+"/"+
+		attachments[0].Header.ContentType().Subtype, "application/pdf")
+	cd := attachments[0].Header.ContentDisposition()
+	if d, ok := cd.ModificationDate(); !ok || !d.Equal(modified) {
+		t.Errorf("unexpected modification-date %v, %v", d, ok)
+	}
+	if d, ok := cd.CreationDate(); !ok || !d.Equal(a.CreationDate) {
+		t.Errorf("unexpected creation-date %v, %v", d, ok)
+	}
+	if _, ok := cd.ReadDate(); ok {
+		t.Error("unexpected read-date")
+	}
+	size, ok := cd.Size()
+	testIntegerEquals(t, "size", size, 15)
+
+	m, err = mail.ReadMessage("From: x@example.com\r\n" +
+		"Content-Type: application/octet-stream\r\n" +
+		"Content-Disposition: attachment; filename=x.bin;\r\n" +
+		" read-date=\"Tue, 6 Oct 2026 09:30:00 +0200\"; size=oops\r\n" +
+		"\r\nData\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cd = m.Header.ContentDisposition()
+	if d, ok := cd.ReadDate(); !ok || d.UTC().Hour() != 7 {
+		t.Errorf("unexpected read-date %v, %v", d, ok)
+	}
+	if _, ok = cd.Size(); ok {
+		t.Error("an invalid size was accepted")
+	}
+}
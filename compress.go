@@ -0,0 +1,215 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionFormat is the kind of stream a Compression writes. Streams
+// of every format are read whatever the Compression's Format.
+type CompressionFormat int
+
+const (
+	// CompressGzip writes gzip streams, which can be read with zcat, or
+	// with a Dictionary, zlib streams primed with it.
+	CompressGzip CompressionFormat = iota
+	// CompressZstd writes zstd (RFC 8878) frames, which compress better
+	// and decompress faster, with the Dictionary as a raw dictionary if
+	// there is one.
+	CompressZstd
+)
+
+// A Compression describes how stored messages are compressed, in the
+// Format given. A Dictionary makes small messages much smaller, since most
+// of their header is then found in it; see TrainDictionary().
+//
+// Level is a compress/flate level for CompressGzip and a zstd level (1-22)
+// for CompressZstd, and the format's default if 0.
+type Compression struct {
+	Format     CompressionFormat
+	Level      int
+	Dictionary []byte
+}
+
+// Returns the suffix which files compressed with \a c have, after ".eml":
+// ".zst" for zstd, ".gz" for gzip and ".z" for zlib with a dictionary.
+func (c *Compression) suffix() string {
+	switch {
+	case c.Format == CompressZstd:
+		return ".zst"
+	case len(c.Dictionary) > 0:
+		return ".z"
+	}
+	return ".gz"
+}
+
+// The suffixes of stored messages, uncompressed or as suffix() returns.
+var compressionSuffixes = []string{"", ".gz", ".z", ".zst"}
+
+// Returns the ID under which zstd frames name the Dictionary of \a c.
+// IDs below 32768 are reserved, so it is derived from a checksum of the
+// dictionary above that.
+func (c *Compression) dictionaryID() uint32 {
+	return 32768 + crc32.ChecksumIEEE(c.Dictionary)%(1<<31-32768)
+}
+
+// Returns \a b compressed as described by \a c.
+func (c *Compression) compress(b []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := c.NewWriter(&buf)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(b); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Returns a writer which compresses what is written to it as described by
+// \a c, and writes it to \a w. Closing the writer flushes it, but does not
+// close \a w.
+func (c *Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	if c.Format == CompressZstd {
+		opts := []zstd.EOption{}
+		if c.Level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(c.Level)))
+		}
+		if len(c.Dictionary) > 0 {
+			opts = append(opts, zstd.WithEncoderDictRaw(c.dictionaryID(), c.Dictionary))
+		}
+		return zstd.NewWriter(w, opts...)
+	}
+	level := c.Level
+	if level == 0 {
+		level = flate.DefaultCompression
+	}
+	if len(c.Dictionary) > 0 {
+		return zlib.NewWriterLevelDict(w, level, c.Dictionary)
+	}
+	return gzip.NewWriterLevel(w, level)
+}
+
+// Returns a reader which decompresses \a r as it is read, whether it holds
+// a gzip stream, a zlib stream or a zstd frame (compressed with the
+// Dictionary of \a c, if any) or an uncompressed message, which is returned
+// as it is. \a c may be nil if no dictionary is used.
+//
+// Closing the returned reader does not close \a r.
+func (c *Compression) NewReader(r io.Reader) (io.ReadCloser, error) {
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(4)
+	switch {
+	case len(magic) >= 2 && magic[0] == 0x1f && magic[1] == 0x8b:
+		return gzip.NewReader(br)
+	case len(magic) == 4 && magic[0] == 0x28 && magic[1] == 0xb5 && magic[2] == 0x2f && magic[3] == 0xfd:
+		opts := []zstd.DOption{zstd.WithDecoderConcurrency(1)}
+		if c != nil && len(c.Dictionary) > 0 {
+			opts = append(opts, zstd.WithDecoderDictRaw(c.dictionaryID(), c.Dictionary))
+		}
+		d, err := zstd.NewReader(br, opts...)
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case len(magic) >= 2 && magic[0]&0x0f == 8 && (int(magic[0])<<8|int(magic[1]))%31 == 0:
+		if magic[1]&0x20 == 0 {
+			return zlib.NewReader(br)
+		}
+		if c == nil || len(c.Dictionary) == 0 {
+			return nil, errors.New("mail: message was compressed with a dictionary")
+		}
+		return zlib.NewReaderDict(br, c.Dictionary)
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// Reads a message from \a r, decompressing it as Compression.NewReader()
+// does, and parses it. \a c may be nil as for NewReader().
+//
+// The parser needs the whole message, so the decompressed text is read
+// into memory, but the compressed text never is.
+func (c *Compression) ReadMessage(r io.Reader) (*Message, error) {
+	d, err := c.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+	b, err := ioutil.ReadAll(d)
+	if err != nil {
+		return nil, err
+	}
+	return ReadMessage(string(b))
+}
+
+// Returns a preset dictionary of at most \a size bytes (32768, the most
+// flate can use, if \a size is 0 or less) for compressing messages like
+// \a samples, e.g. a few hundred messages from the corpus being stored.
+// zstd can use a larger one; flate uses only its last 32768 bytes.
+//
+// The dictionary consists of the lines which occur in more than one sample,
+// the most valuable (occurrences times length) last, since flate and zstd
+// find nearby matches more cheaply.
+func TrainDictionary(samples []string, size int) []byte {
+	if size <= 0 {
+		size = 32768
+	}
+	type line struct {
+		text  string
+		count int
+	}
+	counts := map[string]int{}
+	for _, s := range samples {
+		seen := map[string]bool{}
+		for _, l := range strings.SplitAfter(s, "\n") {
+			if len(l) > 3 && !seen[l] {
+				seen[l] = true
+				counts[l]++
+			}
+		}
+	}
+	lines := []line{}
+	for text, n := range counts {
+		if n > 1 {
+			lines = append(lines, line{text, n})
+		}
+	}
+	sort.Slice(lines, func(i, j int) bool {
+		vi := lines[i].count * len(lines[i].text)
+		vj := lines[j].count * len(lines[j].text)
+		if vi != vj {
+			return vi > vj
+		}
+		return lines[i].text < lines[j].text
+	})
+	chosen := []string{}
+	n := 0
+	for _, l := range lines {
+		if n+len(l.text) <= size {
+			chosen = append(chosen, l.text)
+			n += len(l.text)
+		}
+	}
+	var buf bytes.Buffer
+	for i := len(chosen) - 1; i >= 0; i-- {
+		buf.WriteString(chosen[i])
+	}
+	return buf.Bytes()
+}
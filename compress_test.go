@@ -0,0 +1,110 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestCompressedQuarantine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "compressed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	samples := []string{}
+	for i := 0; i < 20; i++ {
+		samples = append(samples, "Received: from mx.example.com (mx.example.com [192.0.2.1])\r\n"+
+			"\tby mail.example.org with ESMTPS; Mon, 1 Jan 2024 10:00:00 +0000\r\n"+
+			"From: Newsletter <news@example.com>\r\n"+
+			"To: subscriber"+strconv.Itoa(i)+"@example.org\r\n"+
+			"MIME-Version: 1.0\r\n"+
+			"Content-Type: text/plain; charset=utf-8\r\n"+
+			"List-Unsubscribe: <https://example.com/unsubscribe>\r\n\r\n"+
+			"Issue "+strconv.Itoa(i)+" of our newsletter.\r\n")
+	}
+	dict := mail.TrainDictionary(samples[:10], 0)
+	if !bytes.Contains(dict, []byte("MIME-Version: 1.0\r\n")) {
+		t.Errorf("dictionary lacks common lines: %q", dict)
+	}
+
+	sizes := map[string]int64{}
+	for _, c := range []*mail.Compression{nil, {}, {Dictionary: dict},
+		{Format: mail.CompressZstd, Dictionary: dict}} {
+		q, err := mail.NewQuarantine(filepath.Join(dir, strconv.Itoa(len(sizes))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		q.Compression = c
+		e, err := q.Add(samples[15], mail.Envelope{}, "held", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files, _ := filepath.Glob(filepath.Join(q.Dir, e.ID+".eml*"))
+		if len(files) != 1 {
+			t.Fatalf("files: %v", files)
+		}
+		info, _ := os.Stat(files[0])
+		sizes[filepath.Ext(files[0])] = info.Size()
+		text, err := q.Message(e.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, "round trip", text, samples[15])
+
+		r, err := q.Open(e.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := c.ReadMessage(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, "parsed", m.Header.Get("To"), "subscriber15@example.org")
+		if err := q.Delete(e.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := q.Message(e.ID); err != mail.ErrNotQuarantined {
+			t.Errorf("deleted message: %v", err)
+		}
+	}
+	if sizes[".zst"] >= sizes[".gz"] || sizes[".z"] >= sizes[".gz"] || sizes[".gz"] >= sizes[".eml"] {
+		t.Errorf("sizes: %v", sizes)
+	}
+
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	w.Write([]byte(samples[0]))
+	w.Close()
+	if _, err := (&mail.Compression{Dictionary: dict}).ReadMessage(&buf); err != nil {
+		t.Errorf("plain gzip: %v", err)
+	}
+
+	// a zstd frame needs the dictionary it was compressed with
+	buf.Reset()
+	w2, err := (&mail.Compression{Format: mail.CompressZstd, Dictionary: dict}).NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w2.Write([]byte(samples[0]))
+	w2.Close()
+	if _, err := (*mail.Compression)(nil).ReadMessage(bytes.NewReader(buf.Bytes())); err == nil {
+		t.Error("zstd frame read without its dictionary")
+	}
+	m, err := (&mail.Compression{Dictionary: dict}).ReadMessage(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "zstd", m.Header.Get("To"), "subscriber0@example.org")
+}
@@ -0,0 +1,209 @@
+package mail
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// A Conversation is the messages of one thread arranged for display, as
+// mail clients show them: each message once, with only what its author
+// wrote, either in the order in which they were sent or as a tree of
+// replies.
+type Conversation struct {
+	// The messages which reply to no other message in the conversation,
+	// oldest first.
+	Roots []*ConversationMessage
+
+	messages []*ConversationMessage
+}
+
+// A ConversationMessage is a message in a Conversation.
+//
+// ID is its Message-ID, or an empty string if it has none. Parent is the
+// message it replies to, or nil if that is not in the conversation, and
+// Children are its replies, oldest first. Depth is 0 for roots and one more
+// than the parent's depth for replies.
+//
+// Content is the text its author wrote: the plain text of its body (or the
+// HTML converted to text), without quoted text, the attribution line
+// introducing it ("On Monday, Bob wrote:"), forwarded or original messages
+// quoted Outlook-style, or the signature. Duplicates counts the other
+// copies of the message which were given to NewConversation(), e.g. the
+// copy in Sent and the one received through a mailing list.
+type ConversationMessage struct {
+	Message    *Message
+	ID         string
+	Date       time.Time
+	Parent     *ConversationMessage
+	Children   []*ConversationMessage
+	Depth      int
+	Content    string
+	Duplicates int
+}
+
+// Returns a Conversation assembling \a members, which should be the
+// messages of one thread, e.g. those sharing a Header.ThreadRoot(), in any
+// order.
+//
+// Messages with the same Message-ID are copies of one message; the first
+// is kept. Each message is placed below its Header.Parent(), or if that is
+// missing, below the nearest ancestor in its References which is present,
+// so a thread with gaps still forms a tree.
+func NewConversation(members []*Message) *Conversation {
+	c := &Conversation{}
+	byID := map[string]*ConversationMessage{}
+	for _, m := range members {
+		if m == nil || m.Header == nil {
+			continue
+		}
+		id := m.Header.MessageID()
+		if cm := byID[id]; id != "" && cm != nil {
+			cm.Duplicates++
+			continue
+		}
+		cm := &ConversationMessage{Message: m, ID: id, Content: uniqueContent(m)}
+		if d := m.Header.Date(); d != nil {
+			cm.Date = *d
+		}
+		if id != "" {
+			byID[id] = cm
+		}
+		c.messages = append(c.messages, cm)
+	}
+	sort.SliceStable(c.messages, func(i, j int) bool {
+		return c.messages[i].Date.Before(c.messages[j].Date)
+	})
+
+	for _, cm := range c.messages {
+		ancestors := append(cm.Message.Header.References(), cm.Message.Header.Parent())
+		for i := len(ancestors) - 1; i >= 0 && cm.Parent == nil; i-- {
+			if p := byID[ancestors[i]]; p != nil && p != cm && !p.descendsFrom(cm) {
+				cm.Parent = p
+			}
+		}
+		if cm.Parent != nil {
+			cm.Parent.Children = append(cm.Parent.Children, cm)
+		} else {
+			c.Roots = append(c.Roots, cm)
+		}
+	}
+	var setDepth func(cm *ConversationMessage, depth int)
+	setDepth = func(cm *ConversationMessage, depth int) {
+		cm.Depth = depth
+		for _, child := range cm.Children {
+			setDepth(child, depth+1)
+		}
+	}
+	for _, r := range c.Roots {
+		setDepth(r, 0)
+	}
+	return c
+}
+
+// Returns true if \a cm is \a ancestor or one of its replies, directly or
+// indirectly, as far as the tree has been built.
+func (cm *ConversationMessage) descendsFrom(ancestor *ConversationMessage) bool {
+	for p := cm; p != nil; p = p.Parent {
+		if p == ancestor {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the messages in the order in which they were sent, as a linear
+// conversation view shows them.
+func (c *Conversation) Linear() []*ConversationMessage {
+	return append([]*ConversationMessage{}, c.messages...)
+}
+
+// Returns the messages in tree order, i.e. each message followed by its
+// replies, recursively, as a threaded view shows them indented by Depth.
+func (c *Conversation) Tree() []*ConversationMessage {
+	r := []*ConversationMessage{}
+	var add func(cm *ConversationMessage)
+	add = func(cm *ConversationMessage) {
+		r = append(r, cm)
+		for _, child := range cm.Children {
+			add(child)
+		}
+	}
+	for _, root := range c.Roots {
+		add(root)
+	}
+	return r
+}
+
+// Matches the lines with which clients introduce quoted text, e.g. "On Mon,
+// 5 Oct 2026, Bob <bob@example.com> wrote:" or "Am 05.10.2026 schrieb
+// Bob:".
+var attributionLine = regexp.MustCompile(`(?i)^(on|am|le|el|il|op)\b.*(wrote|schrieb|a écrit|escribió|ha scritto|schreef)\s*:\s*$`)
+
+// Matches the lines with which Outlook and others begin a forwarded or
+// quoted message without quote marks.
+var originalMessageLine = regexp.MustCompile(`(?i)^\s*-+\s*(original message|forwarded message|ursprüngliche nachricht)\s*-+\s*$|^_{20,}\s*$`)
+
+// Returns the text the author of \a m wrote, as described for
+// ConversationMessage.Content.
+func uniqueContent(m *Message) string {
+	body := m.DisplayBody(PreferPlain)
+	if body == nil {
+		return ""
+	}
+	return strings.TrimSpace(strings.Join(authoredLines(body), "\n"))
+}
+
+// Returns the lines of the text body \a body which its author wrote,
+// leaving out quotes and their attribution lines, and stopping at the
+// signature or a quoted original message. HTML is converted to text by
+// visibleHTMLText().
+func authoredLines(body *Part) []string {
+	var quotes *QuoteBlock
+	if body.contentType() == "text/html" {
+		quotes = ParseQuotes(visibleHTMLText(body.Text), false, false)
+	} else {
+		quotes = body.Quotes()
+	}
+	if quotes == nil {
+		return nil
+	}
+	var lines []string
+	// an attribution line belongs to the quote it introduces
+	dropAttribution := func() {
+		n := len(lines)
+		for n > 0 && strings.TrimSpace(lines[n-1]) == "" {
+			n--
+		}
+		if n > 0 && attributionLine.MatchString(strings.TrimSpace(lines[n-1])) {
+			lines = lines[:n-1]
+		}
+	}
+	var own func(b *QuoteBlock) bool
+	own = func(b *QuoteBlock) bool {
+		if b.Depth > 0 {
+			dropAttribution()
+			return true
+		}
+		if !b.IsText() {
+			for i := range b.Blocks {
+				if !own(&b.Blocks[i]) {
+					return false
+				}
+			}
+			return true
+		}
+		for _, l := range b.Lines {
+			if l == "-- " || originalMessageLine.MatchString(l) {
+				return false
+			}
+			lines = append(lines, l)
+		}
+		return true
+	}
+	own(quotes)
+	// visibleHTMLText() drops quotes, but not always their attribution
+	dropAttribution()
+	return lines
+}
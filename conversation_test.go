@@ -0,0 +1,52 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestConversation(t *testing.T) {
+	message := func(id, date, refs, body string) *mail.Message {
+		text := "From: someone@example.com\r\nSubject: Lunch\r\n" +
+			"Date: " + date + "\r\nMessage-ID: <" + id + "@example.com>\r\n"
+		if refs != "" {
+			text += "References: " + refs + "\r\nIn-Reply-To: " +
+				refs[strings.LastIndexByte(refs, '<'):] + "\r\n"
+		}
+		m, err := mail.ReadMessage(text + "\r\n" + body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	a := message("a", "Mon, 5 Oct 2026 10:00:00 +0000", "", "Lunch at noon?\r\n")
+	b := message("b", "Mon, 5 Oct 2026 10:05:00 +0000", "<a@example.com>",
+		"Sure.\r\n\r\nOn Mon, 5 Oct 2026, Alice <alice@example.com> wrote:\r\n"+
+			"> Lunch at noon?\r\n\r\n-- \r\nBob\r\n")
+	c := message("c", "Mon, 5 Oct 2026 10:10:00 +0000", "<a@example.com> <b@example.com>",
+		"Great, see you.\r\n\r\n-----Original Message-----\r\nFrom: Bob\r\nSure.\r\n")
+	// replies to a message which is missing
+	d := message("d", "Mon, 5 Oct 2026 10:07:00 +0000", "<a@example.com> <x@example.com>",
+		"> Where?\r\nThe usual place.\r\n")
+	conv := mail.NewConversation([]*mail.Message{c, b, d, a, b})
+
+	linear := []string{}
+	for _, cm := range conv.Linear() {
+		linear = append(linear, cm.ID+" "+cm.Content)
+	}
+	testStringEquals(t, "linear", strings.Join(linear, "|"),
+		"<a@example.com> Lunch at noon?|<b@example.com> Sure.|"+
+			"<d@example.com> The usual place.|<c@example.com> Great, see you.")
+	tree := []string{}
+	for _, cm := range conv.Tree() {
+		tree = append(tree, strings.Repeat(" ", cm.Depth)+cm.ID[1:2])
+	}
+	testStringEquals(t, "tree", strings.Join(tree, ","), "a, b,  c, d")
+	testIntegerEquals(t, "roots", len(conv.Roots), 1)
+	testIntegerEquals(t, "duplicates", conv.Linear()[1].Duplicates, 1)
+	if conv.Linear()[3].Parent != conv.Linear()[1] {
+		t.Error("c is not a reply to b")
+	}
+}
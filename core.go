@@ -0,0 +1,46 @@
+//go:build tinygo || mailcore
+// +build tinygo mailcore
+
+package mail
+
+import (
+	"io"
+	"net"
+)
+
+// This file stands in for the files which need a filesystem or network
+// access when the package is built with TinyGo or the mailcore build tag,
+// e.g. for WebAssembly in a browser or an edge function. Such a build
+// parses, composes, signs and checks messages as any other does, but lacks
+// the transports, the file-based stores, Verifier, MXDialer and the other
+// network clients, and the webhook parsers which read an *http.Request.
+
+// Without a filesystem, bodyparts cannot be spilled, so a spillFile is
+// never made.
+type spillFile struct {
+	size int
+}
+
+func newSpillFile(dir, data string) (*spillFile, error) {
+	return nil, wrapError(ErrUnsupported, "mail: cannot spill bodyparts without a filesystem")
+}
+
+func (f *spillFile) open() (io.ReadCloser, error) {
+	return nil, ErrUnsupported
+}
+
+func (f *spillFile) remove() error {
+	return nil
+}
+
+// Without network access there is no system resolver; a Resolver which
+// asks e.g. a DNS-over-HTTPS service must be given instead.
+type systemResolver struct{}
+
+func (systemResolver) LookupTXT(name string) ([]string, error) {
+	return nil, wrapError(ErrUnsupported, "mail: no resolver for %s", name)
+}
+
+func (systemResolver) LookupMX(name string) ([]*net.MX, error) {
+	return nil, wrapError(ErrUnsupported, "mail: no resolver for %s", name)
+}
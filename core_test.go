@@ -0,0 +1,32 @@
+package mail_test
+
+import (
+	"go/build"
+	"testing"
+)
+
+func TestCoreBuild(t *testing.T) {
+	for _, tag := range []string{"mailcore", "tinygo"} {
+		ctx := build.Default
+		ctx.BuildTags = []string{tag}
+		pkg, err := ctx.ImportDir(".", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, path := range pkg.Imports {
+			switch path {
+			case "os", "os/exec", "path/filepath", "net/http", "net/smtp", "crypto/tls", "syscall":
+				t.Errorf("the %s build imports %s", tag, path)
+			}
+		}
+		for _, file := range []string{"core.go", "parser.go", "compose.go", "dkim.go"} {
+			found := false
+			for _, f := range pkg.GoFiles {
+				found = found || f == file
+			}
+			if !found {
+				t.Errorf("the %s build lacks %s", tag, file)
+			}
+		}
+	}
+}
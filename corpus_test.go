@@ -0,0 +1,142 @@
+package mail_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// The corpus test parses every .eml file in a directory and compares the
+// outcome with a golden JSON snapshot stored next to it, e.g. fixtures/foo.eml
+// and fixtures/foo.json. To add a message to the corpus, drop it in the
+// directory and run
+//
+//	go test -run TestCorpus -update
+//
+// and check the new snapshot. Other corpora can be tested with -corpus.
+var (
+	corpusDir    = flag.String("corpus", "fixtures", "directory of .eml files for TestCorpus")
+	updateGolden = flag.Bool("update", false, "rewrite the golden snapshots of TestCorpus")
+)
+
+type corpusPart struct {
+	Header *mail.Header  `json:"header"`
+	Text   string        `json:"text,omitempty"`
+	Data   string        `json:"data,omitempty"`
+	Parts  []*corpusPart `json:"parts,omitempty"`
+}
+
+type corpusResult struct {
+	// whether the header as read is valid, and whether it is after
+	// Repair()
+	HeaderValid bool `json:"headerValid"`
+	Valid       bool `json:"valid"`
+
+	// whether the message survives a second parse/format cycle
+	// unchanged, and if not, how it changes
+	Stable           bool     `json:"stable"`
+	RoundTripChanges []string `json:"roundTripChanges,omitempty"`
+
+	// whether Repair() had to add a Date field. the added field uses
+	// the current time, so it is left out of the snapshot.
+	DateAdded bool `json:"dateAdded,omitempty"`
+
+	Message *corpusPart `json:"message"`
+}
+
+// Returns a snapshot of \a p. Binary data is represented by its hash, to
+// keep the snapshots readable.
+func snapshotPart(p *mail.Part) *corpusPart {
+	r := &corpusPart{Header: p.Header, Text: p.Text}
+	if p.Data != "" {
+		h := sha256.Sum256([]byte(p.Data))
+		r.Data = "sha256:" + hex.EncodeToString(h[:])
+	}
+	for _, c := range p.Parts {
+		r.Parts = append(r.Parts, snapshotPart(c))
+	}
+	return r
+}
+
+func TestCorpus(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join(*corpusDir, "*.eml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Skipf("no messages in %s", *corpusDir)
+	}
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), ".eml")
+		t.Run(name, func(t *testing.T) {
+			testCorpusMessage(t, file)
+		})
+	}
+}
+
+func testCorpusMessage(t *testing.T, file string) {
+	raw, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := corpusResult{}
+	if h, err := mail.ReadHeader(string(raw), mail.RFC5322Header); err == nil {
+		r.HeaderValid = h.Valid()
+		r.DateAdded = true
+		for _, f := range h.Fields {
+			if f.Name() == mail.DateFieldName {
+				r.DateAdded = false
+			}
+		}
+	}
+	m, err := mail.ReadMessage(string(raw))
+	if err != nil {
+		t.Fatalf("cannot parse: %v", err)
+	}
+	r.Valid = m.Header.Valid()
+
+	first := m.RFC822(false)
+	m2, err := mail.ReadMessage(first)
+	if err != nil {
+		t.Fatalf("cannot parse own output: %v", err)
+	}
+	r.Stable = m2.RFC822(false) == first
+	for _, c := range mail.Compare(m, m2) {
+		r.RoundTripChanges = append(r.RoundTripChanges, c.String())
+	}
+
+	if r.DateAdded {
+		m.Header.RemoveAllNamed(mail.DateFieldName)
+	}
+	r.Message = snapshotPart(m.Part)
+
+	actual, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	actual = append(actual, '\n')
+
+	golden := strings.TrimSuffix(file, ".eml") + ".json"
+	if *updateGolden {
+		if err := ioutil.WriteFile(golden, actual, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	expected, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("no snapshot (run with -update to create it): %v", err)
+	}
+	if !bytes.Equal(actual, expected) {
+		t.Errorf("result differs from %s:\nexpected %s\n     got %s", golden, expected, actual)
+	}
+}
@@ -0,0 +1,388 @@
+package mail
+
+import (
+	"bytes"
+	"sort"
+	"strings"
+)
+
+type cssDeclaration struct {
+	property, value string
+	important       bool
+}
+
+// A single step of a CSS selector: a compound selector such as div.foo#bar,
+// and the combinator linking it to the step to its left.
+type cssCompound struct {
+	tag     string
+	id      string
+	classes []string
+	child   bool // ">" rather than descendant
+}
+
+type cssRule struct {
+	selector     []cssCompound
+	declarations []cssDeclaration
+	specificity  int
+	order        int
+}
+
+// Parses the declaration block \a s (the part between the braces, or the
+// contents of a style attribute).
+func parseCSSDeclarations(s string) []cssDeclaration {
+	r := []cssDeclaration{}
+	for _, d := range strings.Split(s, ";") {
+		colon := strings.IndexByte(d, ':')
+		if colon < 0 {
+			continue
+		}
+		p := strings.ToLower(strings.TrimSpace(d[:colon]))
+		v := strings.TrimSpace(d[colon+1:])
+		if p == "" || v == "" {
+			continue
+		}
+		important := false
+		if i := strings.Index(strings.ToLower(v), "!important"); i >= 0 {
+			important = true
+			v = strings.TrimSpace(v[:i])
+		}
+		r = append(r, cssDeclaration{property: p, value: v, important: important})
+	}
+	return r
+}
+
+// Parses \a s as a selector we know how to apply to an element. Returns nil
+// if the selector uses anything beyond type, class and id selectors and the
+// descendant and child combinators, e.g. pseudo-classes or attribute
+// selectors, which cannot be expressed as inline styles.
+func parseCSSSelector(s string) []cssCompound {
+	s = strings.Replace(s, ">", " > ", -1)
+	r := []cssCompound{}
+	child := false
+	for _, w := range strings.Fields(s) {
+		if w == ">" {
+			if len(r) == 0 || child {
+				return nil
+			}
+			child = true
+			continue
+		}
+		c := cssCompound{child: child}
+		child = false
+		i := 0
+		for i < len(w) {
+			j := i + 1
+			for j < len(w) && w[j] != '.' && w[j] != '#' {
+				j++
+			}
+			part := w[i:j]
+			switch {
+			case part[0] == '.' && len(part) > 1:
+				c.classes = append(c.classes, part[1:])
+			case part[0] == '#' && len(part) > 1:
+				c.id = part[1:]
+			case i == 0 && part == "*":
+			case i == 0:
+				c.tag = strings.ToLower(part)
+			default:
+				return nil
+			}
+			i = j
+		}
+		for _, x := range []string{c.tag, c.id, strings.Join(c.classes, "")} {
+			if strings.ContainsAny(x, ":[]()+~*,\\") {
+				return nil
+			}
+		}
+		r = append(r, c)
+	}
+	if len(r) == 0 || child {
+		return nil
+	}
+	return r
+}
+
+// Returns the specificity of \a selector, in a form suitable for comparison.
+func cssSpecificity(selector []cssCompound) int {
+	ids, classes, tags := 0, 0, 0
+	for _, c := range selector {
+		if c.id != "" {
+			ids++
+		}
+		classes += len(c.classes)
+		if c.tag != "" {
+			tags++
+		}
+	}
+	return ids*10000 + classes*100 + tags
+}
+
+// Parses the style sheet \a s. Rules that can be inlined are returned in
+// \a rules; everything else (at-rules such as @media, and rules with
+// selectors we can't apply) is returned as text in \a rest, so that it can be
+// left in a style element.
+func parseCSS(s string, order int) (rules []cssRule, rest string) {
+	var keep bytes.Buffer
+
+	// remove comments first
+	for {
+		start := strings.Index(s, "/*")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start+2:], "*/")
+		if end < 0 {
+			s = s[:start]
+			break
+		}
+		s = s[:start] + s[start+2+end+2:]
+	}
+
+	i := 0
+	for i < len(s) {
+		open := strings.IndexByte(s[i:], '{')
+		if open < 0 {
+			break
+		}
+		open += i
+		prelude := strings.TrimSpace(s[i:open])
+
+		// find the matching brace; at-rules may nest
+		depth := 0
+		end := open
+		for end < len(s) {
+			if s[end] == '{' {
+				depth++
+			} else if s[end] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+			end++
+		}
+		block := s[open+1 : end]
+		if end < len(s) {
+			end++
+		}
+
+		if strings.HasPrefix(prelude, "@") || prelude == "" {
+			keep.WriteString(s[i:end])
+			keep.WriteString("\n")
+			i = end
+			continue
+		}
+
+		decls := parseCSSDeclarations(block)
+		for _, sel := range strings.Split(prelude, ",") {
+			sel = strings.TrimSpace(sel)
+			compound := parseCSSSelector(sel)
+			if compound == nil {
+				keep.WriteString(sel + " {" + block + "}\n")
+				continue
+			}
+			rules = append(rules, cssRule{
+				selector:     compound,
+				declarations: decls,
+				specificity:  cssSpecificity(compound),
+				order:        order,
+			})
+			order++
+		}
+		i = end
+	}
+
+	return rules, strings.TrimSpace(keep.String())
+}
+
+// Returns true if the compound selector \a c matches the element \a t.
+func (c *cssCompound) matches(t *htmlToken) bool {
+	if c.tag != "" && c.tag != t.tag {
+		return false
+	}
+	if c.id != "" {
+		if id, _ := t.attr("id"); id != c.id {
+			return false
+		}
+	}
+	for _, cl := range c.classes {
+		if !t.hasClass(cl) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if \a r applies to the element \a t, whose open ancestors are
+// \a stack (outermost first).
+func (r *cssRule) matches(t *htmlToken, stack []*htmlToken) bool {
+	last := len(r.selector) - 1
+	if !r.selector[last].matches(t) {
+		return false
+	}
+	s := len(stack) - 1
+	for i := last - 1; i >= 0; i-- {
+		child := r.selector[i+1].child
+		found := false
+		for s >= 0 {
+			ok := r.selector[i].matches(stack[s])
+			s--
+			if ok {
+				found = true
+				break
+			}
+			if child {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns a copy of the HTML document \a html in which the rules of its
+// style elements have been copied into the style attributes of the elements
+// they apply to. Many webmail clients ignore or strip style elements, so this
+// is commonly done before sending HTML mail.
+//
+// Declarations in existing style attributes take precedence over the style
+// sheet, except for !important declarations in the sheet. Rules that cannot
+// be inlined, such as @media queries and selectors with pseudo-classes, are
+// kept in a style element; style elements which become empty are removed.
+func InlineCSS(html string) string {
+	tokens := htmlTokenize(html)
+
+	rules := []cssRule{}
+	styleElements := []int{}
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i].t != htmlStartTagToken || tokens[i].tag != "style" {
+			continue
+		}
+		if media, ok := tokens[i].attr("media"); ok &&
+			media != "" && strings.ToLower(media) != "all" && strings.ToLower(media) != "screen" {
+			continue
+		}
+		styleElements = append(styleElements, i)
+		if tokens[i+1].t == htmlTextToken {
+			r, rest := parseCSS(tokens[i+1].raw, len(rules))
+			rules = append(rules, r...)
+			tokens[i+1].raw = rest
+		}
+	}
+	if len(rules) == 0 {
+		return html
+	}
+	sort.SliceStable(rules, func(a, b int) bool {
+		if rules[a].specificity != rules[b].specificity {
+			return rules[a].specificity < rules[b].specificity
+		}
+		return rules[a].order < rules[b].order
+	})
+
+	stack := []*htmlToken{}
+	inBody := true
+	for i := range tokens {
+		t := &tokens[i]
+		switch t.t {
+		case htmlStartTagToken, htmlSelfClosingTagToken:
+			if t.tag == "head" {
+				inBody = false
+			} else if t.tag == "body" {
+				inBody = true
+			}
+			if inBody && t.tag != "style" && t.tag != "script" {
+				inlineRules(t, stack, rules)
+			}
+			if t.t == htmlStartTagToken && !isVoidElement(t.tag) {
+				stack = append(stack, t)
+			}
+		case htmlEndTagToken:
+			if t.tag == "head" {
+				inBody = true
+			}
+			for j := len(stack) - 1; j >= 0; j-- {
+				if stack[j].tag == t.tag {
+					stack = stack[:j]
+					break
+				}
+			}
+		}
+	}
+
+	// drop the style elements that have nothing left in them
+	removed := map[int]bool{}
+	for _, i := range styleElements {
+		if i+2 < len(tokens) && tokens[i+1].t == htmlTextToken &&
+			strings.TrimSpace(tokens[i+1].raw) == "" &&
+			tokens[i+2].t == htmlEndTagToken && tokens[i+2].tag == "style" {
+			removed[i] = true
+			removed[i+1] = true
+			removed[i+2] = true
+		}
+	}
+	var buf bytes.Buffer
+	for i := range tokens {
+		if !removed[i] {
+			buf.WriteString(tokens[i].String())
+		}
+	}
+	return buf.String()
+}
+
+// Applies \a rules (sorted by ascending precedence) to the element \a t.
+func inlineRules(t *htmlToken, stack []*htmlToken, rules []cssRule) {
+	decls := []cssDeclaration{}
+	for i := range rules {
+		if rules[i].matches(t, stack) {
+			decls = append(decls, rules[i].declarations...)
+		}
+	}
+	if len(decls) == 0 {
+		return
+	}
+	existing, _ := t.attr("style")
+	inline := parseCSSDeclarations(existing)
+
+	values := map[string]cssDeclaration{}
+	order := []string{}
+	for _, d := range append(decls, inline...) {
+		old, seen := values[d.property]
+		if !seen {
+			order = append(order, d.property)
+		} else if old.important && !d.important {
+			continue
+		}
+		values[d.property] = d
+	}
+
+	var buf bytes.Buffer
+	for _, p := range order {
+		if buf.Len() > 0 {
+			buf.WriteString("; ")
+		}
+		d := values[p]
+		buf.WriteString(d.property)
+		buf.WriteString(": ")
+		buf.WriteString(d.value)
+		if d.important {
+			buf.WriteString(" !important")
+		}
+	}
+	t.setAttr("style", buf.String())
+}
+
+// Inlines the style sheets of all text/html bodyparts in this Part (and its
+// children), as described for InlineCSS().
+func (p *Part) InlineCSS() {
+	p.walk(func(bp *Part) {
+		if !bp.hasText || bp.Header == nil {
+			return
+		}
+		ct := bp.Header.ContentType()
+		if ct != nil && ct.Type == "text" && ct.Subtype == "html" {
+			bp.setText(InlineCSS(bp.Text))
+		}
+	})
+}
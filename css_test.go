@@ -0,0 +1,64 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestInlineCSS(t *testing.T) {
+	for _, c := range []struct {
+		name, html, expected string
+	}{
+		{"specificity",
+			`<style>p { color: red } .note { color: blue } #x { color: green }</style>` +
+				`<p class="note" id="x">a</p><p class="note">b</p><p>c</p>`,
+			`<p class="note" id="x" style="color: green">a</p><p class="note" style="color: blue">b</p>` +
+				`<p style="color: red">c</p>`},
+		{"important",
+			`<style>p { color: red !important; margin: 0 } .note { color: blue }</style><p class="note">a</p>`,
+			`<p class="note" style="color: red !important; margin: 0">a</p>`},
+		{"style attribute",
+			`<style>p { color: red; margin: 0 } .note { font-weight: bold !important }</style>` +
+				`<p style="color: black; font-weight: normal">a</p><p class="note" style="font-weight: normal">b</p>`,
+			`<p style="color: black; margin: 0; font-weight: normal">a</p>` +
+				`<p class="note" style="color: red; margin: 0; font-weight: bold !important">b</p>`},
+		{"combinators and leftovers",
+			`<style>div > p { color: red } div p { margin: 0 } a:hover { color: blue }</style>` +
+				`<div><p>a</p></div><p>b</p>`,
+			`<style>a:hover { color: blue }</style><div><p style="color: red; margin: 0">a</p></div><p>b</p>`},
+		{"head",
+			`<html><head><style>td { padding: 4px }</style></head><body><table><tr><td>x</td></tr></table></body></html>`,
+			`<html><head></head><body><table><tr><td style="padding: 4px">x</td></tr></table></body></html>`},
+		{"no style sheet", `<p style="color: red">a</p>`, `<p style="color: red">a</p>`},
+	} {
+		testStringEquals(t, c.name, mail.InlineCSS(c.html), c.expected)
+	}
+
+	m, err := mail.ReadMessage("From: alice@example.com\r\nContent-Type: text/html\r\n\r\n" +
+		"<style>b { color: red }</style><b>Hi</b>\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.InlineCSS()
+	testStringEquals(t, "parsed", m.Text, "<b style=\"color: red\">Hi</b>\r\n")
+}
+
+func TestComposeInlineCSS(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "Hello"
+	c.HTML = `<html><head><style>.greeting { color: #333 }</style></head>` +
+		`<body><p class="greeting">Hello</p></body></html>`
+	c.InlineCSS = true
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := m.Parts[1].Text
+	if !strings.Contains(html, `<p class="greeting" style="color: #333">Hello</p>`) ||
+		strings.Contains(html, "<style>") {
+		t.Errorf("style sheet not inlined: %q", html)
+	}
+}
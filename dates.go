@@ -0,0 +1,154 @@
+package mail
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// The layout used when writing dates, as recommended by RFC 5322.
+const dateLayout = "Mon, 02 Jan 2006 15:04:05 -0700"
+
+// UnknownZone is the location of the dates ParseDate() returns when the
+// zone is unknown, i.e. given as "-0000" or as something treated as
+// "-0000". RFC 5322 section 3.3 defines such times as Universal Time
+// generated on a system whose local zone is not known; FormatDate() writes
+// them with "-0000" rather than "+0000", so that this is not lost.
+var UnknownZone = time.FixedZone("-0000", 0)
+
+// Offsets of the time zone names seen in mail. RFC 5322 defines UT, GMT
+// and the North American zones; the rest are common enough in practice.
+// Abbreviations that mean different things in different places (e.g. IST)
+// are not listed.
+var zoneOffsets = map[string]string{
+	"UT":   "+0000",
+	"UTC":  "+0000",
+	"GMT":  "+0000",
+	"Z":    "+0000",
+	"EST":  "-0500",
+	"EDT":  "-0400",
+	"CST":  "-0600",
+	"CDT":  "-0500",
+	"MST":  "-0700",
+	"MDT":  "-0600",
+	"PST":  "-0800",
+	"PDT":  "-0700",
+	"AKST": "-0900",
+	"AKDT": "-0800",
+	"HST":  "-1000",
+	"WET":  "+0000",
+	"WEST": "+0100",
+	"BST":  "+0100",
+	"CET":  "+0100",
+	"CEST": "+0200",
+	"MET":  "+0100",
+	"MEST": "+0200",
+	"EET":  "+0200",
+	"EEST": "+0300",
+	"MSK":  "+0300",
+	"HKT":  "+0800",
+	"SGT":  "+0800",
+	"JST":  "+0900",
+	"KST":  "+0900",
+	"AEST": "+1000",
+	"AEDT": "+1100",
+	"NZST": "+1200",
+	"NZDT": "+1300",
+}
+
+// Returns the date \a s with its time zone rewritten as a numeric offset, so
+// that time.Parse() does not have to guess.
+//
+// Named zones are looked up in zoneOffsets. Military zones other than Z, and
+// unknown names, become "-0000" (meaning "unknown local time"), as RFC 5322
+// section 4.3 advises, since RFC 822 got their signs wrong and senders never
+// agreed which way round they are. A numeric offset followed by a name, as in
+// "+0000 GMT", keeps the offset. A missing zone is treated as "-0000".
+func normalizeDateZone(s string) string {
+	words := strings.Fields(s)
+	if len(words) == 0 {
+		return s
+	}
+	last := words[len(words)-1]
+
+	numeric := func(w string) bool {
+		if len(w) != 5 || (w[0] != '+' && w[0] != '-') {
+			return false
+		}
+		for _, c := range w[1:] {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		return true
+	}
+	alpha := func(w string) bool {
+		for _, c := range w {
+			if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z') {
+				return false
+			}
+		}
+		return w != ""
+	}
+
+	switch {
+	case numeric(last):
+	case alpha(last) && len(words) > 1 && numeric(words[len(words)-2]):
+		words = words[:len(words)-1]
+	case alpha(last):
+		offset, ok := zoneOffsets[strings.ToUpper(last)]
+		if !ok {
+			offset = "-0000"
+		}
+		words[len(words)-1] = offset
+	case strings.Contains(last, ":"):
+		// no zone at all
+		words = append(words, "-0000")
+	}
+	return strings.Join(words, " ")
+}
+
+// Parses \a s as the value of a Date field, accepting the obsolete and
+// incorrect forms commonly found in mail, and returns the result in the time
+// zone given in \a s, or in UnknownZone if \a s gives none that can be
+// trusted. See normalizeDateZone() for how zone names are handled.
+func ParseDate(s string) (time.Time, error) {
+	t := parseDate(s)
+	if t == nil {
+		return time.Time{}, errors.New("mail: date could not be parsed")
+	}
+	return *t, nil
+}
+
+// Returns \a t formatted for use in a Date field, in the time zone \a loc.
+// If \a loc is nil, \a t's own zone is used; if that is UnknownZone, the
+// zone is written as "-0000".
+func FormatDate(t time.Time, loc *time.Location) string {
+	if loc != nil {
+		t = t.In(loc)
+	}
+	if t.Location() == UnknownZone {
+		return t.Format(dateLayout[:len(dateLayout)-len("-0700")]) + "-0000"
+	}
+	return t.Format(dateLayout)
+}
+
+// Returns the value of this field with the date shown in the time zone
+// \a loc, or the current value if the field has no valid date.
+func (f *DateField) In(loc *time.Location) string {
+	if f.Date == nil {
+		return f.Value()
+	}
+	return FormatDate(*f.Date, loc)
+}
+
+// Returns the age of the message at \a now, according to its Date field, and
+// true, or 0 and false if there is no valid Date field. The age is negative
+// if the Date field is in the future.
+func (h *Header) Age(now time.Time) (time.Duration, bool) {
+	d := h.Date()
+	if d == nil {
+		return 0, false
+	}
+	return now.Sub(*d), true
+}
@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDateZones(t *testing.T) {
+	tests := []struct {
+		in, out string
+	}{
+		{"Mon, 2 Jan 2006 15:04:05 +0000 (GMT)", "Mon, 02 Jan 2006 15:04:05 +0000"},
+		{"2 Jan 2006 15:04:05 UT", "Mon, 02 Jan 2006 15:04:05 +0000"},
+		{"Mon, 2 Jan 2006 15:04:05 EST", "Mon, 02 Jan 2006 15:04:05 -0500"},
+		{"Mon, 2 Jan 2006 15:04 pdt", "Mon, 02 Jan 2006 15:04:00 -0700"},
+		{"Mon, 2 Jan 2006 15:04:05 +0200 CEST", "Mon, 02 Jan 2006 15:04:05 +0200"},
+		{"Mon, 2 Jan 2006 15:04:05 Z", "Mon, 02 Jan 2006 15:04:05 +0000"},
+		{"Mon, 2 Jan 2006 15:04:05 A", "Mon, 02 Jan 2006 15:04:05 -0000"},
+		{"Mon, 2 Jan 2006 15:04:05 XYZ", "Mon, 02 Jan 2006 15:04:05 -0000"},
+		{"Mon, 2 Jan 2006 15:04:05 -0000", "Mon, 02 Jan 2006 15:04:05 -0000"},
+		{"Mon, 2 Jan 2006 15:04:05", "Mon, 02 Jan 2006 15:04:05 -0000"},
+	}
+	for _, test := range tests {
+		d, err := mail.ParseDate(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+			continue
+		}
+		testStringEquals(t, test.in, mail.FormatDate(d, nil), test.out)
+	}
+	if _, err := mail.ParseDate("yesterday"); err == nil {
+		t.Error("nonsense date parsed")
+	}
+
+	h, err := mail.ReadHeader("From: a@example.com\r\n"+
+		"Date: Mon, 2 Jan 2006 15:04:05 EST\r\n\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := h.Fields[1].(*mail.DateField)
+	testStringEquals(t, "date in Tokyo", f.In(time.FixedZone("JST", 9*3600)),
+		"Tue, 03 Jan 2006 05:04:05 +0900")
+	age, ok := h.Age(time.Date(2006, 1, 3, 20, 4, 5, 0, time.UTC))
+	if !ok || age != 24*time.Hour {
+		t.Errorf("unexpected age %v %v", age, ok)
+	}
+
+	h, err = mail.ReadHeader("From: a@example.com\r\n\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := h.Age(time.Now()); ok {
+		t.Error("age reported for header without Date")
+	}
+}
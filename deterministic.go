@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strconv"
+)
+
+// Makes the text RFC822() returns for this message depend only on its
+// content and \a seed, so that it can be hashed, diffed and cached: each
+// MIME boundary is replaced by one derived from \a seed and the bodypart's
+// position, and the parameters of each MIME field are sorted by name.
+//
+// Folding is already canonical, since RFC822() refolds each field instead of
+// reproducing its original text. Parsing two messages which differ only in
+// their boundaries, folding or parameter order and calling Canonicalize()
+// with the same seed on both yields the same text.
+func (m *Message) Canonicalize(seed string) {
+	if m.Part == nil {
+		return
+	}
+	m.Part.canonicalize(seed, "")
+}
+
+// Canonicalizes this bodypart, whose part number is \a number, and its
+// descendants, as described for Message.Canonicalize().
+func (p *Part) canonicalize(seed, number string) {
+	for i, c := range p.Parts {
+		c.canonicalize(seed, partNumber(number, i+1))
+	}
+	if p.message != nil && p.message.Header != nil {
+		// the children of a message/rfc822 part belong to the embedded
+		// message, whose header says how they are separated
+		canonicalizeHeader(p.message.Header, p.Parts, seed, partNumber(number, 0)+"TEXT")
+	}
+	canonicalizeHeader(p.Header, p.Parts, seed, number)
+}
+
+// Sorts the parameters of the MIME fields in \a h, and if \a h describes a
+// multipart whose children are \a children, gives it a boundary derived from
+// \a seed and \a number.
+func canonicalizeHeader(h *Header, children []*Part, seed, number string) {
+	if h == nil {
+		return
+	}
+	for _, f := range h.Fields {
+		var mf *MIMEField
+		switch f := f.(type) {
+		case *ContentType:
+			mf = &f.MIMEField
+		case *ContentDisposition:
+			mf = &f.MIMEField
+		case *ContentLanguage:
+			mf = &f.MIMEField
+		default:
+			continue
+		}
+		sort.SliceStable(mf.Parameters, func(i, j int) bool {
+			return mf.Parameters[i].Name < mf.Parameters[j].Name
+		})
+		mf.source = ""
+	}
+
+	ct := h.ContentType()
+	if ct == nil || ct.Type != "multipart" {
+		return
+	}
+	var buf bytes.Buffer
+	for _, c := range children {
+		buf.WriteString(c.Header.AsText(false))
+		buf.WriteString(crlf)
+		(&Part{}).appendAnyPart(&buf, c, ct, false)
+		buf.WriteString(crlf)
+	}
+	content := buf.Bytes()
+	for i := 0; ; i++ {
+		sum := sha256.Sum256([]byte(seed + "\x00" + number + "\x00" + strconv.Itoa(i)))
+		boundary := "=_" + hex.EncodeToString(sum[:12])
+		if !bytes.Contains(content, []byte(boundary)) {
+			ct.addParameter("boundary", boundary)
+			break
+		}
+	}
+	sort.SliceStable(ct.Parameters, func(i, j int) bool {
+		return ct.Parameters[i].Name < ct.Parameters[j].Name
+	})
+}
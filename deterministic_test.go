@@ -0,0 +1,47 @@
+package mail_test
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestCanonicalize(t *testing.T) {
+	b, err := ioutil.ReadFile("fixtures/apple.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	original := string(b)
+	// the same message, with other boundaries, parameter order and folding
+	variant := strings.NewReplacer("Apple-Mail=_OUTER", "b1", "Apple-Mail=_INNER", "b2",
+		"Apple-Mail=_DOUBLE", "b3",
+		"Content-Type: image/jpeg;\n\tx-unix-mode=0644;\n\tname=\"photo.jpg\"",
+		"Content-Type: image/jpeg; name=photo.jpg; x-unix-mode=0644",
+		"Subject: Photos", "Subject:\n Photos").Replace(original)
+
+	render := func(text, seed string) string {
+		m, err := mail.ReadMessage(text)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.Canonicalize(seed)
+		return m.RFC822(false)
+	}
+	a := render(original, "build-1")
+	testStringEquals(t, "variant", render(variant, "build-1"), a)
+	testStringEquals(t, "again", render(original, "build-1"), a)
+	if render(original, "build-2") == a {
+		t.Error("the seed does not affect the boundaries")
+	}
+	if strings.Contains(a, "Apple-Mail") || !strings.Contains(a, "name=photo.jpg; x-unix-mode=0644") {
+		t.Errorf("not canonical:\n%s", a)
+	}
+
+	m := loadFixture(t, "apple")
+	parsed, _ := mail.ReadMessage(a)
+	if !mail.Equal(m, parsed) {
+		t.Errorf("canonicalizing changed the message: %v", mail.Compare(m, parsed))
+	}
+}
@@ -0,0 +1,240 @@
+package mail
+
+import (
+	"fmt"
+	"time"
+)
+
+// Severity says how serious a Diagnostic is.
+type Severity int
+
+const (
+	// SeverityInfo is used for observations which need no action.
+	SeverityInfo Severity = iota
+	// SeverityWarning is used for oddities which often indicate a
+	// misconfigured sender or spam, but which do not make the message
+	// invalid.
+	SeverityWarning
+	// SeverityError is used for problems which made the parser guess or
+	// discard data.
+	SeverityError
+)
+
+// Returns "info", "warning" or "error".
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// Codes used in Diagnostic.Code.
+const (
+	// The Date field differs implausibly from the earliest Received
+	// timestamp.
+	DiagnosticDateSkew = "date-skew"
+	// The Content-MD5 field does not match the bodypart's content.
+	DiagnosticContentMD5Mismatch = "content-md5-mismatch"
+	// The X-Checksum field does not match the bodypart's content, or uses
+	// an unsupported algorithm.
+	DiagnosticChecksumMismatch = "checksum-mismatch"
+	// The header contains lines which end with CR alone.
+	DiagnosticLoneCR = "lone-cr"
+	// A header field name contains NULs or 8-bit bytes, which were removed.
+	DiagnosticInvalidFieldName = "invalid-field-name"
+	// A header field value contains NULs, which were replaced.
+	DiagnosticNULByte = "nul-byte"
+	// A header field value contains 8-bit bytes which are not UTF-8, which
+	// were replaced.
+	DiagnosticInvalidUTF8 = "invalid-utf8"
+	// A header field value has too many lines or bytes, and was cut.
+	DiagnosticFieldTruncated = "field-truncated"
+	// A text bodypart declares no charset, and the parser guessed one.
+	DiagnosticCharsetGuessed = "charset-guessed"
+	// The subject, a display name or a file name contains bidi controls
+	// which can disguise it.
+	DiagnosticBidiControl = "bidi-control"
+
+	// The codes below are used by Message.Lint().
+
+	// The HTML body uses CSS which common mail clients ignore.
+	DiagnosticUnsupportedCSS = "unsupported-css"
+	// An image in the HTML body has no alt attribute.
+	DiagnosticMissingAlt = "missing-alt"
+	// An element of the HTML body is wider than most clients display.
+	DiagnosticTooWide = "too-wide"
+	// A cid: URL in the HTML body refers to no part of the message.
+	DiagnosticBrokenCID = "broken-cid"
+	// The message has an HTML body, but no plain text alternative.
+	DiagnosticNoTextAlternative = "no-text-alternative"
+	// The HTML body does not say what language it is in.
+	DiagnosticMissingLang = "missing-lang"
+	// A heading in the HTML body skips a level.
+	DiagnosticHeadingOrder = "heading-order"
+	// Text in the HTML body contrasts too little with its background.
+	DiagnosticLowContrast = "low-contrast"
+	// The HTML body consists of images with hardly any text.
+	DiagnosticImageOnly = "image-only"
+	// The subject is longer than common clients show.
+	DiagnosticSubjectLength = "subject-length"
+	// The subject contains emoji which older clients cannot show.
+	DiagnosticSubjectEmoji = "subject-emoji"
+	// The subject contains words or capitals typical of spam.
+	DiagnosticSpamTrigger = "spam-trigger"
+
+	// The codes below are used by SendPolicy.Check().
+
+	// The message is larger than the policy allows.
+	DiagnosticTooLarge = "too-large"
+	// A bodypart has a blocked content type or file name extension.
+	DiagnosticBlockedAttachment = "blocked-attachment"
+	// A required header field is missing.
+	DiagnosticMissingField = "missing-field"
+	// A To or Cc address is not among the envelope recipients.
+	DiagnosticRecipientMismatch = "recipient-mismatch"
+)
+
+// A Diagnostic describes something noteworthy found while parsing or
+// analysing a message, which is not necessarily an error.
+//
+// Code is one of the Diagnostic* constants and is meant for programs;
+// Message is meant for people. Part is the part number ("" for the message
+// itself), Field the name of the header field concerned, if any, and Position
+// its position in the input, if known.
+type Diagnostic struct {
+	Code     string   `json:"code"`
+	Severity Severity `json:"severity"`
+	Part     string   `json:"part,omitempty"`
+	Field    string   `json:"field,omitempty"`
+	Position Position `json:"position"`
+	Message  string   `json:"message"`
+}
+
+// Returns a one-line description of this diagnostic, e.g.
+// "warning: line 3: Date: date-skew: ...".
+func (d Diagnostic) String() string {
+	r := d.Severity.String() + ": "
+	if d.Part != "" {
+		r += "part " + d.Part + ": "
+	}
+	if d.Position.IsValid() {
+		r += d.Position.String() + ": "
+	}
+	if d.Field != "" {
+		r += d.Field + ": "
+	}
+	return r + d.Code + ": " + d.Message
+}
+
+// Records a diagnostic about the field \a f (which may be nil) in this header.
+func (h *Header) addDiagnostic(code string, s Severity, f Field, format string, args ...interface{}) {
+	d := Diagnostic{Code: code, Severity: s, Message: fmt.Sprintf(format, args...)}
+	if f != nil {
+		d.Field = f.Name()
+		d.Position = f.Position()
+	}
+	h.diagnostics = append(h.diagnostics, d)
+}
+
+// Returns the diagnostics recorded for this header when it was read.
+func (h *Header) Diagnostics() []Diagnostic {
+	return h.diagnostics
+}
+
+// Returns the diagnostics recorded for the message and all its bodyparts,
+// including the headers of embedded messages, in order. The Part of each
+// diagnostic is set to the part number it concerns.
+func (m *Message) Diagnostics() []Diagnostic {
+	r := []Diagnostic{}
+	if m.Part == nil {
+		return r
+	}
+	return m.Part.appendDiagnostics(r, "")
+}
+
+// Appends the diagnostics of this part, whose number is \a number, and its
+// descendants to \a r and returns the result.
+func (p *Part) appendDiagnostics(r []Diagnostic, number string) []Diagnostic {
+	add := func(h *Header, number string) {
+		if h == nil {
+			return
+		}
+		for _, d := range h.diagnostics {
+			d.Part = number
+			r = append(r, d)
+		}
+	}
+	add(p.Header, number)
+	if p.message != nil {
+		add(p.message.Header, partNumber(number, 0)+"HEADER")
+	}
+	for i, c := range p.Parts {
+		r = c.appendDiagnostics(r, partNumber(number, i+1))
+	}
+	return r
+}
+
+// The largest plausible differences between the Date field and the earliest
+// Received timestamp. A message may legitimately sit in a queue for a few
+// days before it is first received, but should not be dated after it was
+// received, apart from small clock differences.
+const (
+	maxDateBeforeReceived = 4 * 24 * time.Hour
+	maxDateAfterReceived  = 2 * time.Hour
+)
+
+// Returns the earliest timestamp in the Received fields of this header, or
+// nil if there is no Received field with a valid timestamp.
+func (h *Header) EarliestReceived() *time.Time {
+	var r *time.Time
+	for _, f := range h.Fields {
+		if f.Name() != ReceivedFieldName {
+			continue
+		}
+		t := receivedTime(f.Value())
+		if t != nil && (r == nil || t.Before(*r)) {
+			r = t
+		}
+	}
+	return r
+}
+
+// Returns the difference between the Date field and the earliest Received
+// timestamp, and true, or 0 and false if either is missing. The result is
+// negative if the message is dated before it was first received, which is
+// normal, and positive if it is dated after.
+func (h *Header) DateSkew() (time.Duration, bool) {
+	d := h.Date()
+	r := h.EarliestReceived()
+	if d == nil || r == nil {
+		return 0, false
+	}
+	return d.Sub(*r), true
+}
+
+// Records a DiagnosticDateSkew warning if the Date field is implausibly far
+// from the earliest Received timestamp.
+func (h *Header) checkDateSkew() {
+	skew, ok := h.DateSkew()
+	if !ok {
+		return
+	}
+	f := h.field(DateFieldName, 0)
+	switch {
+	case skew > maxDateAfterReceived:
+		h.addDiagnostic(DiagnosticDateSkew, SeverityWarning, f,
+			"dated %v after it was first received", skew)
+	case skew < -maxDateBeforeReceived:
+		h.addDiagnostic(DiagnosticDateSkew, SeverityWarning, f,
+			"dated %v before it was first received", -skew)
+	}
+}
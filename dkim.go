@@ -0,0 +1,809 @@
+package mail
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Returns the header fields named in \a names, canonicalized as described in
+// RFC 6376 section 3.4, for use in computing or checking a DKIM signature.
+// If \a relaxed is true, the "relaxed" header canonicalization algorithm is
+// used, otherwise "simple".
+//
+// As RFC 6376 section 5.4.2 specifies, a name which occurs more than once in
+// \a names selects the fields of that name starting with the last one and
+// working upwards, and names with no (remaining) field contribute nothing.
+// Names are compared case-insensitively.
+//
+// Fields read from the input are canonicalized from their original text, even
+// if Repair() has changed them since. Other fields are canonicalized as
+// AsText() would write them.
+func (h *Header) Canonicalized(names []string, relaxed bool) string {
+	texts := make([]string, 0, len(h.Fields))
+	for _, f := range h.Fields {
+		text := f.sourceText()
+		if text == "" {
+			text = f.Name() + ": " + f.rfc822(false)
+		}
+		texts = append(texts, text)
+	}
+	return canonicalizeFields(texts, names, relaxed)
+}
+
+// Returns the fields in \a fields (each the complete text of a field,
+// without the trailing CRLF) selected by \a names and canonicalized, as
+// Header.Canonicalized() describes.
+func canonicalizeFields(fields, names []string, relaxed bool) string {
+	var buf bytes.Buffer
+	used := map[string]int{}
+	for _, name := range names {
+		key := strings.ToLower(strings.TrimSpace(name))
+		n := used[key]
+		used[key]++
+
+		// find the n'th field named key, counting from the bottom
+		text := ""
+		for i := len(fields) - 1; i >= 0 && text == ""; i-- {
+			if rawFieldName(fields[i]) == key {
+				if n == 0 {
+					text = fields[i]
+				}
+				n--
+			}
+		}
+		if text == "" {
+			continue
+		}
+
+		if relaxed {
+			buf.WriteString(relaxedHeaderField(text))
+		} else {
+			buf.WriteString(text)
+		}
+		buf.WriteString(crlf)
+	}
+	return buf.String()
+}
+
+// Returns the lower-cased name of the field whose text is \a text.
+func rawFieldName(text string) string {
+	colon := strings.IndexByte(text, ':')
+	if colon < 0 {
+		return ""
+	}
+	return strings.ToLower(strings.TrimRight(text[:colon], " \t"))
+}
+
+// Returns the field \a text canonicalized by the "relaxed" algorithm of RFC
+// 6376 section 3.4.2, without the trailing CRLF.
+func relaxedHeaderField(text string) string {
+	colon := strings.IndexByte(text, ':')
+	if colon < 0 {
+		return text
+	}
+	name := strings.ToLower(strings.TrimRight(text[:colon], " \t"))
+
+	// unfold, and reduce all whitespace to single spaces
+	var buf bytes.Buffer
+	space := false
+	for i := colon + 1; i < len(text); i++ {
+		c := text[i]
+		if c == '\r' || c == '\n' {
+			continue
+		}
+		if c == ' ' || c == '\t' {
+			space = true
+			continue
+		}
+		if space && buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		space = false
+		buf.WriteByte(c)
+	}
+	return name + ":" + buf.String()
+}
+
+// The fields a DKIMSigner signs by default, if present.
+var dkimDefaultFields = []string{
+	"From", "Reply-To", "Subject", "Date", "To", "Cc", "Message-ID",
+	"In-Reply-To", "References", "MIME-Version", "Content-Type",
+	"Content-Transfer-Encoding", "List-ID", "List-Unsubscribe",
+	"List-Unsubscribe-Post",
+}
+
+// A DKIMSigner signs messages with DKIM (RFC 6376), as Domain, using the
+// key published under Selector. Key is an *rsa.PrivateKey (the algorithm is
+// then rsa-sha256) or an ed25519.PrivateKey (ed25519-sha256, RFC 8463).
+//
+// Fields lists the fields to sign if present; if nil, the usual ones are
+// signed. Each name in Oversign is signed once more than it occurs, so
+// that a verifier rejects the message if another such field is added later;
+// this guards against e.g. a second From or Subject field being prepended.
+//
+// If BodyLength is true, the signature covers only the body as it is
+// (the l= tag), so that text may be appended, e.g. by a mailing list,
+// without breaking it. Since anyone may then append anything, this is
+// rarely advisable.
+//
+// Relaxed selects the "relaxed" canonicalization for both header and body,
+// which survives the whitespace changes some servers make, rather than
+// "simple". Expiry, if non-zero, adds an expiry time (x=) that long after
+// signing. Clock, if not nil, gives the signing time (t=) instead of the
+// system clock.
+type DKIMSigner struct {
+	Domain     string
+	Selector   string
+	Key        crypto.Signer
+	Fields     []string
+	Oversign   []string
+	BodyLength bool
+	Relaxed    bool
+	Expiry     time.Duration
+	Clock      Clock
+}
+
+// Returns a new DKIMSigner for \a domain and \a selector using \a key, with
+// relaxed canonicalization, and the From, Subject, To, Cc, Date and
+// Message-ID fields oversigned.
+func NewDKIMSigner(domain, selector string, key crypto.Signer) *DKIMSigner {
+	return &DKIMSigner{
+		Domain:   domain,
+		Selector: selector,
+		Key:      key,
+		Relaxed:  true,
+		Oversign: []string{"From", "Subject", "To", "Cc", "Date", "Message-ID"},
+	}
+}
+
+// Returns \a rfc5322 with a DKIM-Signature field prepended. Line endings in
+// \a rfc5322 are converted to CRLF first, as they would be when sending.
+func (s *DKIMSigner) Sign(rfc5322 string) (string, error) {
+	rfc5322 = NormalizeLineEndings(rfc5322, "\r\n")
+	fields, body := splitRawMessage(rfc5322)
+	field, err := s.signature("DKIM-Signature", "v=1", fields, body)
+	if err != nil {
+		return "", err
+	}
+	return field + crlf + rfc5322, nil
+}
+
+// Returns a signature field named \a name, whose tags start with \a first,
+// for the message whose fields are \a fields and whose body is \a body. The
+// field is returned without its final CRLF.
+func (s *DKIMSigner) signature(name, first string, fields []string, body string) (string, error) {
+	algorithm, err := dkimAlgorithm(s.Key)
+	if err != nil {
+		return "", err
+	}
+
+	// sign each field which is present, once per occurrence, and
+	// oversigned fields once more
+	present := map[string]int{}
+	for _, f := range fields {
+		present[rawFieldName(f)]++
+	}
+	names := s.Fields
+	if names == nil {
+		names = dkimDefaultFields
+	}
+	oversign := map[string]bool{}
+	for _, n := range s.Oversign {
+		oversign[strings.ToLower(n)] = true
+	}
+	signed := []string{}
+	seen := map[string]bool{}
+	for _, n := range append(append([]string{}, names...), s.Oversign...) {
+		key := strings.ToLower(n)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		count := present[key]
+		if oversign[key] {
+			count++
+		}
+		for i := 0; i < count; i++ {
+			signed = append(signed, n)
+		}
+	}
+	if present["from"] == 0 {
+		return "", errors.New("mail: cannot DKIM-sign a message without From")
+	}
+
+	canon := "simple/simple"
+	if s.Relaxed {
+		canon = "relaxed/relaxed"
+	}
+	cbody := dkimBody(body, s.Relaxed)
+	bh := sha256.Sum256([]byte(cbody))
+
+	now := clockNow(s.Clock)
+	var tags bytes.Buffer
+	tags.WriteString(first + "; a=" + algorithm + "; c=" + canon +
+		"; d=" + s.Domain + "; s=" + s.Selector + ";" + crlf +
+		"\tt=" + strconv.FormatInt(now.Unix(), 10) + ";")
+	if s.Expiry > 0 {
+		tags.WriteString(" x=" + strconv.FormatInt(now.Add(s.Expiry).Unix(), 10) + ";")
+	}
+	if s.BodyLength {
+		tags.WriteString(" l=" + strconv.Itoa(len(cbody)) + ";")
+	}
+	tags.WriteString(crlf + "\th=" + foldDKIMList(signed) + ";" + crlf +
+		"\tbh=" + base64.StdEncoding.EncodeToString(bh[:]) + ";" + crlf +
+		"\tb=")
+	field := name + ": " + tags.String()
+
+	data := canonicalizeFields(fields, signed, s.Relaxed)
+	if s.Relaxed {
+		data += relaxedHeaderField(field)
+	} else {
+		data += field
+	}
+	sig, err := dkimSign(s.Key, data)
+	if err != nil {
+		return "", err
+	}
+	return field + foldBase64(sig), nil
+}
+
+// Returns the DKIM name of the signing algorithm for \a key.
+func dkimAlgorithm(key crypto.Signer) (string, error) {
+	return dkimKeyAlgorithm(key.Public())
+}
+
+// Returns the DKIM name of the algorithm used with the public key \a key.
+func dkimKeyAlgorithm(key crypto.PublicKey) (string, error) {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "rsa-sha256", nil
+	case ed25519.PublicKey:
+		return "ed25519-sha256", nil
+	}
+	return "", errors.New("mail: unsupported DKIM key type")
+}
+
+// Signs the SHA-256 hash of \a data with \a key and returns the signature
+// in base64.
+func dkimSign(key crypto.Signer, data string) (string, error) {
+	h := sha256.Sum256([]byte(data))
+	var sig []byte
+	var err error
+	if _, ok := key.Public().(ed25519.PublicKey); ok {
+		// RFC 8463 signs the hash, not the data
+		sig, err = key.Sign(rand.Reader, h[:], crypto.Hash(0))
+	} else {
+		sig, err = key.Sign(rand.Reader, h[:], crypto.SHA256)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// Returns \a names joined by colons, folded to keep lines short.
+func foldDKIMList(names []string) string {
+	var buf bytes.Buffer
+	line := 4
+	for i, n := range names {
+		if i > 0 {
+			buf.WriteByte(':')
+			line++
+			if line+len(n) > 76 {
+				buf.WriteString(crlf + "\t ")
+				line = 2
+			}
+		}
+		buf.WriteString(n)
+		line += len(n)
+	}
+	return buf.String()
+}
+
+// Returns \a s folded into lines of at most 72 characters.
+func foldBase64(s string) string {
+	var buf bytes.Buffer
+	first := 72 - len("\tb=")
+	for len(s) > first {
+		buf.WriteString(s[:first] + crlf + "\t ")
+		s = s[first:]
+		first = 70
+	}
+	buf.WriteString(s)
+	return buf.String()
+}
+
+// Splits \a rfc5322, which uses CRLF line endings, into the text of its
+// header fields, each without its final CRLF, and its body.
+func splitRawMessage(rfc5322 string) ([]string, string) {
+	header, body := rfc5322, ""
+	if strings.HasPrefix(rfc5322, crlf) {
+		header, body = "", rfc5322[2:]
+	} else if i := strings.Index(rfc5322, crlf+crlf); i >= 0 {
+		header, body = rfc5322[:i+2], rfc5322[i+4:]
+	}
+	fields := []string{}
+	for _, l := range strings.SplitAfter(header, crlf) {
+		if l == "" {
+			continue
+		}
+		if (l[0] == ' ' || l[0] == '\t') && len(fields) > 0 {
+			fields[len(fields)-1] += l
+		} else {
+			fields = append(fields, l)
+		}
+	}
+	for i, f := range fields {
+		fields[i] = strings.TrimSuffix(f, crlf)
+	}
+	return fields, body
+}
+
+// Returns \a body, which uses CRLF line endings, canonicalized as described
+// in RFC 6376 section 3.4.3 (simple) or 3.4.4 (if \a relaxed).
+func dkimBody(body string, relaxed bool) string {
+	if relaxed {
+		var buf bytes.Buffer
+		lines := strings.SplitAfter(body, crlf)
+		for _, l := range lines {
+			eol := strings.HasSuffix(l, crlf)
+			l = strings.TrimSuffix(l, crlf)
+			space := false
+			var line bytes.Buffer
+			for i := 0; i < len(l); i++ {
+				if l[i] == ' ' || l[i] == '\t' {
+					space = true
+					continue
+				}
+				if space {
+					line.WriteByte(' ')
+					space = false
+				}
+				line.WriteByte(l[i])
+			}
+			buf.Write(line.Bytes())
+			if eol {
+				buf.WriteString(crlf)
+			}
+		}
+		body = buf.String()
+	}
+	for strings.HasSuffix(body, crlf+crlf) {
+		body = body[:len(body)-2]
+	}
+	if body == crlf && relaxed {
+		return ""
+	}
+	if body == "" && !relaxed {
+		return crlf
+	}
+	if body != "" && !strings.HasSuffix(body, crlf) {
+		body += crlf
+	}
+	return body
+}
+
+// A DKIMResult is the outcome of verifying one DKIM-Signature field.
+//
+// Result is "pass", "fail", "neutral", "temperror" or "permerror", as in
+// Authentication-Results (RFC 8601), and Err says why it is not "pass".
+// Domain, Selector and Identity are the d=, s= and i= tags; Fields lists
+// the signed fields (h=).
+//
+// BodyLength is the l= tag, or -1 if the whole body is signed. If the body
+// is longer than that, UnsignedBody is the number of bytes after it; those
+// were added or changed after signing, and are not vouched for by the
+// signature even if Result is "pass".
+//
+// UnsignedFields lists the names of signed fields which occur more often
+// than they were signed, i.e. at least one such field was added after
+// signing. Since readers typically see the topmost field, the message may
+// show something other than what was signed. Oversigned lists the fields
+// signed more often than they occur, which guards against that.
+type DKIMResult struct {
+	Result         string
+	Err            error
+	Domain         string
+	Selector       string
+	Identity       string
+	Algorithm      string
+	Fields         []string
+	BodyLength     int
+	UnsignedBody   int
+	UnsignedFields []string
+	Oversigned     []string
+}
+
+// Returns a description of this result in the form used in
+// Authentication-Results, e.g. "dkim=pass header.d=example.com
+// header.s=sel", with any caveats in a comment.
+func (r *DKIMResult) String() string {
+	s := "dkim=" + r.Result
+	notes := []string{}
+	if r.Err != nil && r.Result != "pass" {
+		notes = append(notes, r.Err.Error())
+	}
+	if r.UnsignedBody > 0 {
+		notes = append(notes, strconv.Itoa(r.UnsignedBody)+
+			" body bytes after l="+strconv.Itoa(r.BodyLength)+" are unsigned")
+	}
+	if len(r.UnsignedFields) > 0 {
+		notes = append(notes, "unsigned "+strings.Join(r.UnsignedFields, ", ")+" added")
+	}
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, "; ") + ")"
+	}
+	if r.Domain != "" {
+		s += " header.d=" + r.Domain
+	}
+	if r.Selector != "" {
+		s += " header.s=" + r.Selector
+	}
+	return s
+}
+
+// A DKIMVerifier verifies DKIM signatures.
+//
+// Resolver looks up the key records; if nil, DefaultResolver is used.
+// LookupTXT, if not nil, is used instead of Resolver. If
+// Strict is true, signatures which do not cover the whole body, or whose
+// signed fields have had other fields of the same name added, fail rather
+// than merely being reported. MinRSABits is the smallest RSA key accepted;
+// RFC 8301 requires at least 1024. Clock, if not nil, gives the time against
+// which expiry (x=) is checked instead of the system clock.
+type DKIMVerifier struct {
+	Resolver   Resolver
+	LookupTXT  func(name string) ([]string, error)
+	Strict     bool
+	MinRSABits int
+	Clock      Clock
+}
+
+// Verifies the DKIM signatures in \a rfc5322 with a default DKIMVerifier.
+func VerifyDKIM(rfc5322 string) []*DKIMResult {
+	v := &DKIMVerifier{}
+	return v.Verify(rfc5322)
+}
+
+// Verifies each DKIM-Signature field in \a rfc5322 and returns the results,
+// in the order of the fields. Returns an empty slice if there are none.
+func (v *DKIMVerifier) Verify(rfc5322 string) []*DKIMResult {
+	o := startOperation("mail.dkim.verify")
+	rfc5322 = NormalizeLineEndings(rfc5322, "\r\n")
+	fields, body := splitRawMessage(rfc5322)
+	results := []*DKIMResult{}
+	for _, f := range fields {
+		if rawFieldName(f) == "dkim-signature" {
+			r := v.verify(f, fields, body, false)
+			results = append(results, r)
+			DefaultMetrics.Record("mail.dkim.results", 1, map[string]string{"result": r.Result})
+		}
+	}
+	o.span.SetAttribute("mail.dkim.signatures", len(results))
+	if len(results) > 0 {
+		o.span.SetAttribute("mail.dkim.result", results[0].Result)
+	}
+	o.end(nil)
+	return results
+}
+
+// Parses a DKIM tag-list (RFC 6376 section 3.2). Whitespace around names
+// and values is removed, as is all whitespace in the b= and bh= values.
+func parseDKIMTags(s string) (map[string]string, error) {
+	tags := map[string]string{}
+	for _, t := range strings.Split(s, ";") {
+		if strings.TrimSpace(t) == "" {
+			continue
+		}
+		eq := strings.IndexByte(t, '=')
+		if eq < 0 {
+			return nil, fmt.Errorf("mail: bad DKIM tag %q", strings.TrimSpace(t))
+		}
+		name := strings.TrimSpace(t[:eq])
+		value := strings.TrimSpace(t[eq+1:])
+		if name == "b" || name == "bh" || name == "p" {
+			value = strings.Join(strings.Fields(value), "")
+		}
+		if _, ok := tags[name]; ok {
+			return nil, fmt.Errorf("mail: duplicate DKIM tag %q", name)
+		}
+		tags[name] = value
+	}
+	return tags, nil
+}
+
+// Returns the DKIM-Signature field \a field with the value of its b= tag
+// removed, as it was when it was signed.
+func withoutDKIMSignature(field string) string {
+	colon := strings.IndexByte(field, ':')
+	i := colon + 1
+	for i < len(field) {
+		end := strings.IndexByte(field[i:], ';')
+		if end < 0 {
+			end = len(field)
+		} else {
+			end += i
+		}
+		tag := field[i:end]
+		if eq := strings.IndexByte(tag, '='); eq >= 0 &&
+			strings.TrimSpace(tag[:eq]) == "b" {
+			return field[:i+eq+1] + field[end:]
+		}
+		i = end + 1
+	}
+	return field
+}
+
+// Verifies the DKIM-Signature field \a sig, which is one of \a fields. If
+// \a arc is true, \a sig is an ARC-Message-Signature field instead (RFC
+// 8617 section 4.1.2), which has no v= tag and whose i= tag is its
+// instance.
+func (v *DKIMVerifier) verify(sig string, fields []string, body string, arc bool) *DKIMResult {
+	r := &DKIMResult{Result: "permerror", BodyLength: -1}
+	tags, err := parseDKIMTags(sig[strings.IndexByte(sig, ':')+1:])
+	if err != nil {
+		r.Err = err
+		return r
+	}
+	r.Domain, r.Selector, r.Identity = tags["d"], tags["s"], tags["i"]
+	r.Algorithm = tags["a"]
+	required := []string{"v", "a", "b", "bh", "d", "h", "s"}
+	if arc {
+		required[0] = "i"
+	}
+	for _, t := range required {
+		if _, ok := tags[t]; !ok {
+			r.Err = fmt.Errorf("mail: DKIM signature lacks %s=", t)
+			return r
+		}
+	}
+	if !arc && tags["v"] != "1" {
+		r.Err = errors.New("mail: unknown DKIM version " + tags["v"])
+		return r
+	}
+	if r.Identity != "" && !arc {
+		at := strings.LastIndexByte(r.Identity, '@')
+		id := strings.ToLower(r.Identity[at+1:])
+		d := strings.ToLower(r.Domain)
+		if id != d && !strings.HasSuffix(id, "."+d) {
+			r.Err = errors.New("mail: DKIM i= is not within d=")
+			return r
+		}
+	}
+	for _, n := range strings.Split(tags["h"], ":") {
+		if n = strings.TrimSpace(n); n != "" {
+			r.Fields = append(r.Fields, n)
+		}
+	}
+	from := false
+	for _, n := range r.Fields {
+		from = from || strings.EqualFold(n, "From")
+	}
+	if !from {
+		r.Err = errors.New("mail: DKIM signature does not cover From")
+		return r
+	}
+	for _, n := range r.Fields {
+		if arc && strings.EqualFold(n, ARCSealFieldName) {
+			r.Err = errors.New("mail: ARC-Message-Signature covers ARC-Seal")
+			return r
+		}
+	}
+	if x, ok := tags["x"]; ok {
+		exp, err := strconv.ParseInt(x, 10, 64)
+		if err != nil {
+			r.Err = errors.New("mail: bad DKIM x= " + x)
+			return r
+		}
+		if clockNow(v.Clock).Unix() > exp {
+			r.Err = errors.New("mail: DKIM signature expired")
+			return r
+		}
+	}
+
+	headerRelaxed, bodyRelaxed := false, false
+	c := strings.ToLower(tags["c"])
+	if c == "" {
+		c = "simple"
+	}
+	hc, bc := c, "simple"
+	if slash := strings.IndexByte(c, '/'); slash >= 0 {
+		hc, bc = c[:slash], c[slash+1:]
+	}
+	for _, x := range []struct {
+		name    string
+		relaxed *bool
+	}{{hc, &headerRelaxed}, {bc, &bodyRelaxed}} {
+		switch x.name {
+		case "relaxed":
+			*x.relaxed = true
+		case "simple":
+		default:
+			r.Err = errors.New("mail: unknown DKIM canonicalization " + c)
+			return r
+		}
+	}
+
+	// how the signed fields relate to those present
+	present := map[string]int{}
+	for _, f := range fields {
+		present[rawFieldName(f)]++
+	}
+	signed := map[string]int{}
+	order := []string{}
+	for _, n := range r.Fields {
+		k := strings.ToLower(n)
+		if signed[k] == 0 {
+			order = append(order, n)
+		}
+		signed[k]++
+	}
+	for _, n := range order {
+		k := strings.ToLower(n)
+		if present[k] > signed[k] {
+			r.UnsignedFields = append(r.UnsignedFields, n)
+		} else if present[k] < signed[k] {
+			r.Oversigned = append(r.Oversigned, n)
+		}
+	}
+
+	cbody := dkimBody(body, bodyRelaxed)
+	if l, ok := tags["l"]; ok {
+		n, err := strconv.Atoi(l)
+		if err != nil || n < 0 {
+			r.Err = errors.New("mail: bad DKIM l= " + l)
+			return r
+		}
+		r.BodyLength = n
+		if n > len(cbody) {
+			r.Result = "fail"
+			r.Err = fmt.Errorf("mail: body is shorter (%d bytes) than DKIM l=%d",
+				len(cbody), n)
+			return r
+		}
+		r.UnsignedBody = len(cbody) - n
+		cbody = cbody[:n]
+	}
+
+	key, err := v.publicKey(r.Selector, r.Domain)
+	if err != nil {
+		r.Result = "permerror"
+		if e, ok := err.(*net.DNSError); ok && (e.Temporary() || e.IsTimeout) {
+			r.Result = "temperror"
+		}
+		r.Err = err
+		return r
+	}
+	if want, err := dkimKeyAlgorithm(key); err != nil || strings.ToLower(r.Algorithm) != want {
+		r.Err = errors.New("mail: DKIM algorithm " + r.Algorithm +
+			" is not supported or does not match the key")
+		return r
+	}
+
+	bh := sha256.Sum256([]byte(cbody))
+	if base64.StdEncoding.EncodeToString(bh[:]) != tags["bh"] {
+		r.Result = "fail"
+		r.Err = errors.New("mail: body hash does not match")
+		return r
+	}
+
+	data := canonicalizeFields(fields, r.Fields, headerRelaxed)
+	unsigned := withoutDKIMSignature(sig)
+	if headerRelaxed {
+		data += relaxedHeaderField(unsigned)
+	} else {
+		data += unsigned
+	}
+	b, err := base64.StdEncoding.DecodeString(tags["b"])
+	if err != nil {
+		r.Err = errors.New("mail: bad DKIM b=")
+		return r
+	}
+	if err := dkimCheck(key, data, b); err != nil {
+		r.Result = "fail"
+		r.Err = err
+		return r
+	}
+
+	r.Result = "pass"
+	if v.Strict && r.UnsignedBody > 0 {
+		r.Result = "fail"
+		r.Err = errors.New("mail: body has unsigned content after DKIM l=")
+	} else if v.Strict && len(r.UnsignedFields) > 0 {
+		r.Result = "fail"
+		r.Err = errors.New("mail: unsigned " + strings.Join(r.UnsignedFields, ", ") +
+			" added after DKIM signing")
+	}
+	return r
+}
+
+// Checks that \a sig is \a key's signature of the SHA-256 hash of \a data.
+func dkimCheck(key crypto.PublicKey, data string, sig []byte) error {
+	h := sha256.Sum256([]byte(data))
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if rsa.VerifyPKCS1v15(k, crypto.SHA256, h[:], sig) != nil {
+			return errors.New("mail: DKIM signature does not verify")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, h[:], sig) {
+			return errors.New("mail: DKIM signature does not verify")
+		}
+	}
+	return nil
+}
+
+// Looks up and returns the DKIM key published by \a domain under
+// \a selector.
+func (v *DKIMVerifier) publicKey(selector, domain string) (crypto.PublicKey, error) {
+	lookup := v.LookupTXT
+	if lookup == nil && v.Resolver != nil {
+		lookup = v.Resolver.LookupTXT
+	} else if lookup == nil {
+		lookup = DefaultResolver.LookupTXT
+	}
+	txts, err := lookup(selector + "._domainkey." + domain)
+	if err != nil {
+		return nil, err
+	}
+	if len(txts) != 1 {
+		return nil, fmt.Errorf("mail: %d DKIM key records for %s._domainkey.%s",
+			len(txts), selector, domain)
+	}
+	tags, err := parseDKIMTags(txts[0])
+	if err != nil {
+		return nil, err
+	}
+	if ver, ok := tags["v"]; ok && ver != "DKIM1" {
+		return nil, errors.New("mail: unknown DKIM key version " + ver)
+	}
+	p, ok := tags["p"]
+	if !ok {
+		return nil, errors.New("mail: DKIM key record lacks p=")
+	}
+	if p == "" {
+		return nil, errors.New("mail: DKIM key has been revoked")
+	}
+	der, err := base64.StdEncoding.DecodeString(p)
+	if err != nil {
+		return nil, errors.New("mail: bad DKIM key")
+	}
+	switch strings.ToLower(tags["k"]) {
+	case "", "rsa":
+		var key *rsa.PublicKey
+		if pub, err := x509.ParsePKIXPublicKey(der); err == nil {
+			key, _ = pub.(*rsa.PublicKey)
+		} else {
+			key, _ = x509.ParsePKCS1PublicKey(der)
+		}
+		if key == nil {
+			return nil, errors.New("mail: bad DKIM RSA key")
+		}
+		min := v.MinRSABits
+		if min == 0 {
+			min = 1024
+		}
+		if key.N.BitLen() < min {
+			return nil, fmt.Errorf("mail: DKIM RSA key has only %d bits", key.N.BitLen())
+		}
+		return key, nil
+	case "ed25519":
+		if len(der) != ed25519.PublicKeySize {
+			return nil, errors.New("mail: bad DKIM ed25519 key")
+		}
+		return ed25519.PublicKey(der), nil
+	}
+	return nil, errors.New("mail: unknown DKIM key type " + tags["k"])
+}
@@ -0,0 +1,108 @@
+package mail_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDKIM(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaPub, _ := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	edPub, edKey, _ := ed25519.GenerateKey(rand.Reader)
+	v := &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+		switch name {
+		case "rsa._domainkey.example.com":
+			return []string{"v=DKIM1; k=rsa; p=" + base64.StdEncoding.EncodeToString(rsaPub)}, nil
+		case "ed._domainkey.example.com":
+			return []string{"v=DKIM1; k=ed25519; p=" + base64.StdEncoding.EncodeToString(edPub)}, nil
+		case "revoked._domainkey.example.com":
+			return []string{"v=DKIM1; p="}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}}
+	msg := "From: Alice <alice@example.com>\n" +
+		"To: bob@example.org\n" +
+		"Subject: Quarterly figures\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\n" +
+		"\n" +
+		"The figures  are attached.\n" +
+		"\n\n"
+	check := func(what, signed string, want string) *mail.DKIMResult {
+		t.Helper()
+		results := v.Verify(signed)
+		if len(results) != 1 {
+			t.Fatalf("%s: %d results", what, len(results))
+		}
+		testStringEquals(t, what, results[0].Result, want)
+		return results[0]
+	}
+
+	s := mail.NewDKIMSigner("example.com", "rsa", rsaKey)
+	signed, err := s.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := check("rsa", signed, "pass")
+	testStringEquals(t, "string", r.String(), "dkim=pass header.d=example.com header.s=rsa")
+	testStringEquals(t, "oversigned", strings.Join(r.Oversigned, " "), "From Subject Date To Cc Message-ID")
+	check("whitespace", strings.Replace(signed, "figures  are", "figures are", 1), "pass")
+	check("changed body", strings.Replace(signed, "attached", "enclosed", 1), "fail")
+	check("added subject", "Subject: Urgent\r\n"+signed, "fail")
+
+	s.Oversign = nil
+	signed, _ = s.Sign(msg)
+	r = check("not oversigned", "Subject: Urgent\r\n"+signed, "pass")
+	testStringEquals(t, "unsigned fields", strings.Join(r.UnsignedFields, " "), "Subject")
+	testStringEquals(t, "unsigned string", r.String(),
+		"dkim=pass (unsigned Subject added) header.d=example.com header.s=rsa")
+
+	s.BodyLength = true
+	signed, _ = s.Sign(msg)
+	r = check("body length", signed+"-- \r\nFooter\r\n", "pass")
+	testIntegerEquals(t, "body length", r.BodyLength, len("The figures are attached.\r\n"))
+	testIntegerEquals(t, "unsigned body", r.UnsignedBody, len("\r\n\r\n--\r\nFooter\r\n"))
+	if !strings.Contains(r.String(), "body bytes after l=") {
+		t.Errorf("unsigned body not reported: %s", r)
+	}
+	r = check("truncated", strings.Replace(signed, "attached.", "", 1), "fail")
+	if !strings.Contains(r.Err.Error(), "shorter") {
+		t.Errorf("truncation not reported: %v", r.Err)
+	}
+	strict := *v
+	strict.Strict = true
+	if r := strict.Verify(signed + "Footer\r\n"); r[0].Result != "fail" {
+		t.Errorf("strict verifier accepted unsigned body: %s", r[0])
+	}
+
+	ed := &mail.DKIMSigner{Domain: "example.com", Selector: "ed", Key: edKey}
+	signed, err = ed.Sign(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(signed, "a=ed25519-sha256; c=simple/simple") {
+		t.Errorf("unexpected signature field:\n%s", signed)
+	}
+	check("ed25519", signed, "pass")
+	check("simple whitespace", strings.Replace(signed, "figures  are", "figures are", 1), "fail")
+
+	ed.Selector = "revoked"
+	signed, _ = ed.Sign(msg)
+	check("revoked", signed, "permerror")
+	ed.Selector = "missing"
+	signed, _ = ed.Sign(msg)
+	check("missing", signed, "permerror")
+	if len(v.Verify(msg)) != 0 {
+		t.Error("unsigned message has results")
+	}
+}
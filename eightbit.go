@@ -0,0 +1,150 @@
+package mail
+
+import (
+	"strings"
+)
+
+// Calls \a fn for each leaf bodypart of \a p, including those of embedded
+// messages.
+func (p *Part) walkLeaves(fn func(*Part)) {
+	switch {
+	case p.message != nil && p.message.Part != nil:
+		p.message.Part.walkLeaves(fn)
+	case len(p.Parts) > 0:
+		for _, c := range p.Parts {
+			c.walkLeaves(fn)
+		}
+	default:
+		fn(p)
+	}
+}
+
+// Returns the content of this bodypart as it is sent when it has no
+// Content-Transfer-Encoding.
+func (p *Part) rawContent() string {
+	if p.hasText {
+		return p.Text
+	}
+	s, _ := p.data()
+	return s
+}
+
+// Returns true if this message can only be sent to servers which support
+// 8BITMIME (RFC 6152) or BINARYMIME (RFC 3030), i.e. if a bodypart is sent
+// unencoded and is not 7-bit text. Downgrade() makes this false.
+//
+// Messages parsed by ReadMessage() and built by a Composer never require
+// 8BITMIME, since their bodyparts are encoded as needed; Upgrade() and
+// changes to the Content-Transfer-Encoding fields may make them do so.
+func (m *Message) Requires8BitMIME() bool {
+	if m.Part == nil {
+		return false
+	}
+	r := false
+	m.Part.walkLeaves(func(p *Part) {
+		if !r && p.unencoded() && !p.sevenBitSafe() {
+			r = true
+		}
+	})
+	return r
+}
+
+// Returns true if the content of this bodypart may be sent unencoded to a
+// server which supports only 7-bit data: it is ASCII, and fit for 8bit as
+// eightBitSafe() says. Line breaks in text are converted to CRLF when it is
+// sent, so bare LFs are harmless there.
+func (p *Part) sevenBitSafe() bool {
+	s := p.rawContent()
+	if p.hasText {
+		s = toCRLF(s)
+	}
+	return isAscii(s) && eightBitSafe(s)
+}
+
+// Returns true if this bodypart is sent without a Content-Transfer-Encoding
+// which makes it 7-bit safe.
+func (p *Part) unencoded() bool {
+	if p.Header == nil {
+		return true
+	}
+	cte := p.Header.ContentTransferEncoding()
+	return cte == nil || cte.Encoding == BinaryEncoding
+}
+
+// Converts this message to a form which may be sent to an SMTP server which
+// supports neither 8BITMIME nor BINARYMIME: each bodypart which is sent
+// unencoded but is not 7-bit text is given the Content-Transfer-Encoding
+// ChooseTransferEncoding() picks, quoted-printable or base64. Bodyparts
+// inside embedded messages are converted too. Returns true if anything was
+// changed.
+//
+// The header fields are not changed; RFC822() must be called with
+// avoidUTF8 set to encode any UTF-8 in them.
+func (m *Message) Downgrade() bool {
+	if m.Part == nil {
+		return false
+	}
+	changed := false
+	m.Part.walkLeaves(func(p *Part) {
+		if !p.unencoded() || p.Header == nil || p.sevenBitSafe() {
+			return
+		}
+		cte := ChooseTransferEncoding(p.rawContent(), p.hasText)
+		if cte == "7bit" {
+			// only the line length is at fault
+			cte = "quoted-printable"
+		}
+		if p.hasText {
+			p.Text = toCRLF(p.Text)
+		}
+		setTransferEncoding(p, cte)
+		changed = true
+	})
+	return changed
+}
+
+// Converts this message to a form which is smaller and easier to read, for
+// an SMTP server which supports 8BITMIME: text bodyparts encoded as
+// quoted-printable or base64 are sent as 8bit instead, if their lines are
+// short enough (RFC 5322 section 2.1.1) and they contain no NUL or bare CR.
+// ASCII text is sent as 7bit if nothing else requires encoding it. Other
+// bodyparts are left alone, since sending binary data unencoded needs
+// BINARYMIME and BDAT. Returns true if anything was changed.
+//
+// RFC822() must be called with avoidUTF8 false to keep the UTF-8 text.
+func (m *Message) Upgrade() bool {
+	if m.Part == nil {
+		return false
+	}
+	changed := false
+	m.Part.walkLeaves(func(p *Part) {
+		if !p.hasText || p.unencoded() || !eightBitSafe(p.Text) {
+			return
+		}
+		if !isAscii(p.Text) {
+			setTransferEncoding(p, "8bit")
+		} else if !needsQP(p.Text) {
+			setTransferEncoding(p, "7bit")
+		} else {
+			// encoded for a reason other than 8-bit content, e.g. a
+			// line starting with "From "
+			return
+		}
+		changed = true
+	})
+	return changed
+}
+
+// Returns true if \a s can be sent as 8bit: it has no NUL, bare CR or LF, or
+// line longer than 998 bytes.
+func eightBitSafe(s string) bool {
+	if strings.IndexByte(s, 0) >= 0 {
+		return false
+	}
+	for _, l := range strings.Split(s, "\r\n") {
+		if len(l) > 998 || strings.ContainsAny(l, "\r\n") {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,75 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDowngrade(t *testing.T) {
+	m, err := mail.ReadMessage("From: alice@example.com\r\n" +
+		"Subject: Lunch\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n" +
+		"--b\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Café au lait, s'il vous plaît.\r\n" +
+		"--b\r\n" +
+		"Content-Type: message/rfc822\r\n" +
+		"\r\n" +
+		"From: bob@example.com\r\n" +
+		"Subject: Re: Lunch\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"Content-Transfer-Encoding: 8bit\r\n" +
+		"\r\n" +
+		"Très bien.\r\n" +
+		"--b--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Requires8BitMIME() {
+		t.Error("parsed message requires 8BITMIME")
+	}
+
+	if !m.Upgrade() {
+		t.Fatal("Upgrade changed nothing")
+	}
+	testStringEquals(t, "upgraded encoding", m.Parts[0].Header.Get("Content-Transfer-Encoding"), "8bit")
+	if !m.Requires8BitMIME() {
+		t.Fatal("upgraded message does not require 8BITMIME")
+	}
+	upgraded, err := mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "upgraded text", upgraded.Parts[0].Text, "Café au lait, s'il vous plaît.\r\n")
+	if !strings.Contains(m.RFC822(false), "Très bien.\r\n") {
+		t.Error("embedded message not upgraded")
+	}
+
+	if !m.Downgrade() {
+		t.Fatal("Downgrade changed nothing")
+	}
+	if m.Requires8BitMIME() || m.Downgrade() {
+		t.Error("downgraded message still requires 8BITMIME")
+	}
+	rfc822 := m.RFC822(true)
+	for i := 0; i < len(rfc822); i++ {
+		if rfc822[i] >= 0x80 {
+			t.Fatalf("8-bit byte at %d in downgraded message:\n%s", i, rfc822)
+		}
+	}
+	downgraded, err := mail.ReadMessage(rfc822)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "encoding", m.Parts[0].Header.Get("Content-Transfer-Encoding"), "quoted-printable")
+	testStringEquals(t, "text", downgraded.Parts[0].Text, "Café au lait, s'il vous plaît.\r\n")
+	if !strings.Contains(rfc822, "Tr=C3=A8s bien.\r\n") {
+		t.Error("embedded message not downgraded")
+	}
+}
@@ -0,0 +1,181 @@
+package mail
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors which may be returned (possibly wrapped) by Header.Error() and
+// Field.Error(). Use errors.Is() to test for them.
+var (
+	// The header has no From field.
+	ErrMissingFrom = errors.New("mail: no From field")
+
+	// The header has no Date field.
+	ErrMissingDate = errors.New("mail: no Date field")
+
+	// A Content-Transfer-Encoding, an encoded-word's encoding or a
+	// character set is unknown or invalid.
+	ErrBadEncoding = errors.New("mail: bad encoding")
+
+	// A header field name, value or display name given to a Composer
+	// contains a line break or other control character.
+	ErrHeaderInjection = errors.New("mail: control character in header")
+
+	// A message is larger than a BDATReceiver's MaxSize. An SMTP server
+	// should reply 552.
+	ErrMessageTooLarge = errors.New("mail: message exceeds maximum size")
+
+	// A Quarantine does not hold a message with the given ID.
+	ErrNotQuarantined = errors.New("mail: no such quarantined message")
+
+	// A MessageStore does not hold a message with the given ID, or the ID
+	// is not valid for it.
+	ErrNotStored = errors.New("mail: no such stored message")
+
+	// A Scheduler does not hold a message with the given ID.
+	ErrNotScheduled = errors.New("mail: no such scheduled message")
+
+	// A message lacks the List-Unsubscribe or List-Unsubscribe-Post field
+	// needed for one-click unsubscription.
+	ErrMissingUnsubscribe = errors.New("mail: no one-click unsubscribe")
+
+	// A message may not be sent under a SendPolicy.
+	ErrPolicyViolation = errors.New("mail: message violates the send policy")
+
+	// A message has more bodyparts or deeper nesting than a Profile's
+	// Limits allow.
+	ErrTooComplex = errors.New("mail: message too complex")
+
+	// A message needed repairs which a Profile with RepairStrict does not
+	// accept.
+	ErrMalformed = errors.New("mail: malformed message")
+
+	// A message is from a domain its Profile may not send from.
+	ErrDomainNotAllowed = errors.New("mail: sender domain not allowed")
+
+	// A Composer's AMP document does not meet the requirements of AMP for
+	// Email, or has no HTML or plain text alternative.
+	ErrInvalidAMP = errors.New("mail: invalid AMP email")
+
+	// A domain has a null MX (RFC 7505), i.e. accepts no mail.
+	ErrNullMX = errors.New("mail: domain accepts no mail")
+
+	// A server does not satisfy a TLSPolicy, e.g. does not offer STARTTLS
+	// or has a certificate which cannot be verified.
+	ErrTLSPolicy = errors.New("mail: TLS policy not satisfied")
+
+	// Something needs a filesystem, network access or a program which this
+	// build lacks, e.g. one made with TinyGo or the mailcore build tag.
+	ErrUnsupported = errors.New("mail: not supported in this build")
+)
+
+// ErrTooManyFields is the error recorded when a header contains more fields
+// named Name than are permitted.
+type ErrTooManyFields struct {
+	Name  string
+	Count int
+	Max   int
+}
+
+func (e *ErrTooManyFields) Error() string {
+	return fmt.Sprintf("%d %s fields seen. At most %d may be present.",
+		e.Count, e.Name, e.Max)
+}
+
+// ErrTooFewFields is the error recorded when a header contains fewer fields
+// named Name than required. It matches ErrMissingFrom and ErrMissingDate.
+type ErrTooFewFields struct {
+	Name  string
+	Count int
+	Min   int
+}
+
+func (e *ErrTooFewFields) Error() string {
+	return fmt.Sprintf("%d %s fields seen. At least %d must be present.",
+		e.Count, e.Name, e.Min)
+}
+
+func (e *ErrTooFewFields) Is(target error) bool {
+	return e.Count == 0 &&
+		(target == ErrMissingFrom && e.Name == FromFieldName ||
+			target == ErrMissingDate && e.Name == DateFieldName)
+}
+
+// A HeaderInjectionError is returned by Composer.Compose() when Field, or
+// for an attachment, its file name, content type or ID, contains a control
+// character, such as a CR or LF which could start another field. Value is
+// the offending text. It matches ErrHeaderInjection.
+//
+// Header.Add() checks the values it is given in the same way, and makes a
+// field whose value contains a control character invalid with this error.
+type HeaderInjectionError struct {
+	Field string
+	Value string
+}
+
+func (e *HeaderInjectionError) Error() string {
+	return fmt.Sprintf("mail: control character in %s: %q", e.Field, e.Value)
+}
+
+func (e *HeaderInjectionError) Is(target error) bool {
+	return target == ErrHeaderInjection
+}
+
+// A SendPolicyError is returned by SendPolicy.Validate() when a message may
+// not be sent. Diagnostics holds all violations found, including those
+// which are only warnings. It matches ErrPolicyViolation.
+type SendPolicyError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *SendPolicyError) Error() string {
+	r := []string{}
+	for _, d := range e.Diagnostics {
+		if d.Severity == SeverityError {
+			r = append(r, d.Message)
+		}
+	}
+	return "mail: message may not be sent: " + strings.Join(r, "; ")
+}
+
+func (e *SendPolicyError) Is(target error) bool {
+	return target == ErrPolicyViolation
+}
+
+// A FieldError is the error recorded in a Header when one of its fields is
+// invalid. Err is the field's own error.
+type FieldError struct {
+	Name string
+	Err  error
+}
+
+func (e *FieldError) Error() string {
+	return e.Name + ": " + e.Err.Error()
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// An error with its own message which wraps a more general error, such as
+// ErrBadEncoding.
+type wrappedError struct {
+	msg string
+	err error
+}
+
+func (e *wrappedError) Error() string {
+	return e.msg
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// Returns an error whose message is formatted from \a format and \a args, and
+// which wraps \a err.
+func wrapError(err error, format string, args ...interface{}) error {
+	return &wrappedError{msg: fmt.Sprintf(format, args...), err: err}
+}
@@ -6,3 +6,5 @@ require (
 	github.com/jimexcel/excel v0.0.0-20200107012803-a94c2fcbaed7
 	github.com/jimexcel/mail v0.0.0-20200107012429-bed33ad3781b
 )
+
+replace github.com/jimexcel/mail => ../
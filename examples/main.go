@@ -3,29 +3,60 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
+	"log"
+	"os"
+	"strings"
 
 	"github.com/jimexcel/excel"
 	"github.com/jimexcel/mail"
 )
 
+// stdLogger is a mail.Logger writing to the standard logger, for programs
+// without log/slog.
+type stdLogger struct {
+	debug bool
+}
+
+func (l stdLogger) print(level, msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(level + " " + msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		fmt.Fprintf(&b, " %v=%q", args[i], fmt.Sprint(args[i+1]))
+	}
+	log.Print(b.String())
+}
+
+func (l stdLogger) Debug(msg string, args ...interface{}) {
+	if l.debug {
+		l.print("DEBUG", msg, args)
+	}
+}
+
+func (l stdLogger) Info(msg string, args ...interface{})  { l.print("INFO", msg, args) }
+func (l stdLogger) Warn(msg string, args ...interface{})  { l.print("WARN", msg, args) }
+func (l stdLogger) Error(msg string, args ...interface{}) { l.print("ERROR", msg, args) }
+
 func main() {
+	logger := stdLogger{debug: os.Getenv("DEBUG") != ""}
+	mail.DefaultLogger = logger
+
 	files, err := excel.GetDirAllFiles("../fixtures/", ".eml")
 	if err != nil {
-		fmt.Println(err)
-		return
+		logger.Error("cannot list fixtures", "error", err)
+		os.Exit(1)
 	}
 
 	for _, f := range files {
 		datas, err := ioutil.ReadFile(f)
 		if err != nil {
-			fmt.Println(err)
-			return
+			logger.Error("cannot read message", "file", f, "error", err)
+			os.Exit(1)
 		}
 
 		msg, err := mail.ReadMessage(string(datas))
 		if err != nil {
-			fmt.Println(err)
-			return
+			logger.Warn("cannot parse message", "file", f, "error", err)
+			continue
 		}
 
 		fmt.Println("Subject:", msg.Header.Subject())
@@ -0,0 +1,353 @@
+package mail
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	XMSHasAttachFieldName      = "X-Ms-Has-Attach"
+	XMSTNEFCorrelatorFieldName = "X-Ms-Tnef-Correlator"
+	ThreadTopicFieldName       = "Thread-Topic"
+	ThreadIndexFieldName       = "Thread-Index"
+
+	// The prefix of the fields Exchange uses to carry MAPI properties
+	// between its servers, e.g. X-MS-Exchange-Organization-SCL.
+	xmsExchangeOrganizationPrefix = "X-Ms-Exchange-Organization-"
+)
+
+// ExchangeInfo holds the information Microsoft Exchange and Outlook record in
+// the header of a message.
+//
+// HasAttach is true if X-MS-Has-Attach says the message has attachments.
+// Exchange sets it from the MAPI properties, so it may disagree with the MIME
+// structure, e.g. for inline images. SCL is the spam confidence level, from -1
+// (trusted) to 9, or -2 if unknown. Organization holds the
+// X-MS-Exchange-Organization-* fields, keyed by the rest of their names in
+// lower case, e.g. "authas".
+type ExchangeInfo struct {
+	HasAttach      bool              `json:"hasAttach"`
+	ThreadTopic    string            `json:"threadTopic,omitempty"`
+	ThreadIndex    string            `json:"threadIndex,omitempty"`
+	TNEFCorrelator string            `json:"tnefCorrelator,omitempty"`
+	SCL            int               `json:"scl"`
+	Organization   map[string]string `json:"organization,omitempty"`
+}
+
+// Returns the Exchange-specific information in this header, or nil if it
+// has none of the fields Exchange and Outlook add.
+func (h *Header) Exchange() *ExchangeInfo {
+	r := &ExchangeInfo{SCL: -2, Organization: map[string]string{}}
+	seen := false
+	for _, f := range h.Fields {
+		v := simplify(f.Value())
+		switch f.Name() {
+		case XMSHasAttachFieldName:
+			r.HasAttach = strings.ToLower(v) == "yes"
+		case ThreadTopicFieldName:
+			r.ThreadTopic = v
+		case ThreadIndexFieldName:
+			r.ThreadIndex = v
+		case XMSTNEFCorrelatorFieldName:
+			r.TNEFCorrelator = v
+		default:
+			if !strings.HasPrefix(f.Name(), xmsExchangeOrganizationPrefix) {
+				continue
+			}
+			key := strings.ToLower(f.Name()[len(xmsExchangeOrganizationPrefix):])
+			r.Organization[key] = v
+			if key == "scl" {
+				if n, err := strconv.Atoi(v); err == nil {
+					r.SCL = n
+				}
+			}
+		}
+		seen = true
+	}
+	if !seen {
+		return nil
+	}
+	return r
+}
+
+// An X500Resolver returns the SMTP address of the Exchange user whose
+// distinguished name (legacyExchangeDN) is \a dn, e.g.
+// "/O=ORG/OU=FIRST/CN=RECIPIENTS/CN=JSMITH", or an empty string if it does not
+// know.
+type X500Resolver func(dn string) string
+
+// Returns the X.500 distinguished name this address refers to, if it is an
+// Exchange-internal address: either a bare DN, as Exchange sometimes leaks
+// into the header, or a DN encapsulated as an "IMCEAEX-" address. Returns an
+// empty string otherwise.
+func (a Address) X500() string {
+	lp := a.Localpart
+	if a.Domain == "" && strings.HasPrefix(strings.ToUpper(lp), "/O=") {
+		return lp
+	}
+	if strings.HasPrefix(strings.ToUpper(lp), "IMCEAEX-") {
+		return decodeIMCEA(lp[len("IMCEAEX-"):])
+	}
+	return ""
+}
+
+// Returns the SMTP address for this address. IMCEA-encapsulated SMTP
+// addresses ("IMCEASMTP-user+40example+2Ecom@gateway") are decoded, and X.500
+// addresses are passed to \a resolve, if it is not nil. Returns the address
+// itself and true if it is already an SMTP address, and false if no SMTP
+// address is known.
+func (a Address) SMTP(resolve X500Resolver) (Address, bool) {
+	lp := a.Localpart
+	if strings.HasPrefix(strings.ToUpper(lp), "IMCEASMTP-") {
+		s := decodeIMCEA(lp[len("IMCEASMTP-"):])
+		if at := strings.LastIndexByte(s, '@'); at > 0 {
+			return NewAddress(a.name, s[:at], s[at+1:]), true
+		}
+		return a, false
+	}
+	if dn := a.X500(); dn != "" {
+		if resolve == nil {
+			return a, false
+		}
+		s := resolve(dn)
+		if at := strings.LastIndexByte(s, '@'); at > 0 {
+			return NewAddress(a.name, s[:at], s[at+1:]), true
+		}
+		return a, false
+	}
+	return a, a.Domain != ""
+}
+
+// Replaces the Exchange-internal addresses in the address fields of this
+// header with their SMTP addresses, where Address.SMTP() can find them.
+// Returns the number of addresses replaced.
+func (h *Header) MapExchangeAddresses(resolve X500Resolver) int {
+	n := 0
+	for _, f := range h.Fields {
+		af, ok := f.(*AddressField)
+		if !ok {
+			continue
+		}
+		for i, a := range af.Addresses {
+			if a.X500() == "" && !strings.HasPrefix(strings.ToUpper(a.Localpart), "IMCEASMTP-") {
+				continue
+			}
+			if s, ok := a.SMTP(resolve); ok {
+				af.Addresses[i] = s
+				af.source = ""
+				n++
+			}
+		}
+	}
+	if n > 0 {
+		h.verified = false
+	}
+	return n
+}
+
+// Decodes the IMCEA encoding of \a s, in which "/" is written as "_" and other
+// special characters as "+" followed by two hex digits.
+func decodeIMCEA(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '_':
+			buf.WriteByte('/')
+		case c == '+' && i+2 < len(s):
+			if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+				buf.WriteByte(byte(b))
+				i += 2
+			} else {
+				buf.WriteByte(c)
+			}
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return buf.String()
+}
+
+// Returns true if this bodypart contains RTF, whether or not it is labelled
+// as such. Exchange and Outlook sometimes send RTF bodies as text/plain.
+func (p *Part) IsRTF() bool {
+	switch p.contentType() {
+	case "", "text/plain", "text/rtf", "text/richtext", "application/rtf":
+	default:
+		return false
+	}
+	s, _ := p.data()
+	if p.hasText {
+		s = p.Text
+	}
+	return strings.HasPrefix(strings.TrimLeft(s, " \t\r\n"), "{\\rtf")
+}
+
+// Returns the text of this bodypart, converted from RTF if IsRTF() is true.
+func (p *Part) PlainText() string {
+	if !p.IsRTF() {
+		return p.Reflowed()
+	}
+	if p.hasText {
+		return rtfToText(p.Text)
+	}
+	s, _ := p.data()
+	return rtfToText(s)
+}
+
+// RTF destinations whose content is not text.
+var rtfIgnoredDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "object": true, "header": true, "footer": true,
+	"headerl": true, "headerr": true, "footerl": true, "footerr": true,
+	"listtable": true, "listoverridetable": true, "themedata": true,
+	"datastore": true, "latentstyles": true, "rsidtbl": true,
+	"generator": true, "xmlnstbl": true, "mmathPr": true,
+}
+
+// Returns the text of the RTF document \a s, with paragraphs separated by
+// newlines. Formatting, pictures and other embedded objects are dropped.
+// "\'hh" escapes are taken to be Windows-1252, which is what Outlook uses
+// for western languages.
+func rtfToText(s string) string {
+	type state struct {
+		skip bool
+		uc   int
+	}
+	var buf bytes.Buffer
+	stack := []state{}
+	cur := state{uc: 1}
+	pending := 0 // fallback characters to skip after \u
+
+	emit := func(r rune) {
+		if cur.skip {
+			return
+		}
+		if pending > 0 {
+			pending--
+			return
+		}
+		buf.WriteRune(r)
+	}
+
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		switch c {
+		case '{':
+			stack = append(stack, cur)
+			i++
+		case '}':
+			if len(stack) > 0 {
+				cur = stack[len(stack)-1]
+				stack = stack[:len(stack)-1]
+			}
+			i++
+		case '\r', '\n':
+			i++
+		case '\\':
+			i++
+			if i >= len(s) {
+				break
+			}
+			c = s[i]
+			switch {
+			case c == '\'' && i+2 < len(s):
+				if b, err := strconv.ParseUint(s[i+1:i+3], 16, 8); err == nil {
+					emit(cp1252Rune(byte(b)))
+				}
+				i += 3
+			case c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z':
+				w := i
+				for i < len(s) && (s[i] >= 'a' && s[i] <= 'z' || s[i] >= 'A' && s[i] <= 'Z') {
+					i++
+				}
+				word := s[w:i]
+				p := i
+				if i < len(s) && s[i] == '-' {
+					i++
+				}
+				for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+					i++
+				}
+				param, hasParam := 0, i > p
+				if hasParam {
+					param, _ = strconv.Atoi(s[p:i])
+				}
+				if i < len(s) && s[i] == ' ' {
+					i++
+				}
+				switch {
+				case word == "par" || word == "line" || word == "row":
+					emit('\n')
+				case word == "tab" || word == "cell":
+					emit('\t')
+				case word == "emdash":
+					emit('—')
+				case word == "endash":
+					emit('–')
+				case word == "bullet":
+					emit('•')
+				case word == "lquote":
+					emit('‘')
+				case word == "rquote":
+					emit('’')
+				case word == "ldblquote":
+					emit('“')
+				case word == "rdblquote":
+					emit('”')
+				case word == "u" && hasParam:
+					if param < 0 {
+						param += 65536
+					}
+					emit(rune(param))
+					pending = cur.uc
+				case word == "uc" && hasParam:
+					cur.uc = param
+				case rtfIgnoredDestinations[word]:
+					cur.skip = true
+				}
+			case c == '*':
+				// an optional destination we don't know
+				cur.skip = true
+				i++
+			case c == '~':
+				emit(' ')
+				i++
+			case c == '\\' || c == '{' || c == '}':
+				emit(rune(c))
+				i++
+			default:
+				// \- and \_ (optional and non-breaking hyphens) and
+				// other control symbols
+				if c == '_' {
+					emit('-')
+				}
+				i++
+			}
+		default:
+			r, n := utf8.DecodeRuneInString(s[i:])
+			emit(r)
+			i += n
+		}
+	}
+	return buf.String()
+}
+
+// The characters 0x80-0x9f of Windows-1252, which differ from ISO-8859-1.
+var cp1252High = [32]rune{
+	'€', 0x81, '‚', 'ƒ', '„', '…', '†', '‡',
+	'ˆ', '‰', 'Š', '‹', 'Œ', 0x8d, 'Ž', 0x8f,
+	0x90, '‘', '’', '“', '”', '•', '–', '—',
+	'˜', '™', 'š', '›', 'œ', 0x9d, 'ž', 'Ÿ',
+}
+
+// Returns the character \a b stands for in Windows-1252.
+func cp1252Rune(b byte) rune {
+	if b >= 0x80 && b < 0xa0 {
+		return cp1252High[b-0x80]
+	}
+	return rune(b)
+}
@@ -0,0 +1,52 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestExchangeQuirks(t *testing.T) {
+	msg, err := mail.ReadMessage("From: John Smith <IMCEAEX-_O=ORG_OU=FIRST_CN=RECIPIENTS_CN=JSMITH@example.com>\r\n" +
+		"To: IMCEASMTP-jane+2Edoe+40example+2Eorg@gw.example.com\r\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"Subject: Budget\r\n" +
+		"Thread-Topic: Budget\r\n" +
+		"X-MS-Has-Attach: yes\r\n" +
+		"X-MS-Exchange-Organization-SCL: -1\r\n" +
+		"X-MS-Exchange-Organization-AuthAs: Internal\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"{\\rtf1\\ansi\\deff0{\\fonttbl{\\f0 Calibri;}}\\f0 Caf\\'e9 at 10\\par\r\n" +
+		"Price: \\u8364?5{\\*\\generator Riched20;}\\par}\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := msg.Header.Exchange()
+	if x == nil {
+		t.Fatal("Exchange fields not found")
+	}
+	if !x.HasAttach || x.SCL != -1 || x.ThreadTopic != "Budget" ||
+		x.Organization["authas"] != "Internal" {
+		t.Errorf("unexpected Exchange info: %+v", x)
+	}
+
+	from := msg.Header.Addresses(mail.FromFieldName)[0]
+	testStringEquals(t, "X.500 address", from.X500(), "/O=ORG/OU=FIRST/CN=RECIPIENTS/CN=JSMITH")
+	n := msg.Header.MapExchangeAddresses(func(dn string) string {
+		if strings.HasSuffix(dn, "/CN=JSMITH") {
+			return "john.smith@example.com"
+		}
+		return ""
+	})
+	testIntegerEquals(t, "mapped addresses", n, 2)
+	testStringEquals(t, "From", msg.Header.Get("From"), "John Smith <john.smith@example.com>")
+	testStringEquals(t, "To", msg.Header.Get("To"), "jane.doe@example.org")
+
+	if !msg.IsRTF() {
+		t.Fatal("RTF body not detected")
+	}
+	testStringEquals(t, "RTF text", msg.PlainText(), "Café at 10\nPrice: €5\n")
+}
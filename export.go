@@ -0,0 +1,585 @@
+package mail
+
+import (
+	"bytes"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// ExportFormat is the kind of document Message.Export() produces.
+type ExportFormat int
+
+const (
+	// ExportText is a plain text document.
+	ExportText ExportFormat = iota
+	// ExportHTML is a self-contained HTML document, which refers to no
+	// external resources.
+	ExportHTML
+)
+
+// The header fields shown at the top of an exported message, in order.
+var exportFieldNames = []string{
+	FromFieldName, SenderFieldName, ToFieldName, CcFieldName,
+	DateFieldName, SubjectFieldName, MessageIDFieldName,
+}
+
+// Returns the message rendered as a document in the format \a f, suitable
+// for archiving or printing: a summary of the main header fields, the body,
+// and a list of the attachments with their sizes and SHA-256 hashes.
+//
+// The body is the message's first text/plain or text/html bodypart, or for
+// multipart/alternative, the alternative best suited to \a f. HTML bodies are
+// converted to text for ExportText, and for ExportHTML are stripped of
+// scripts, forms and references to external resources.
+//
+// The output depends only on the message, so exporting the same message
+// twice produces identical documents.
+func (m *Message) Export(f ExportFormat) string {
+	if m.Header == nil || m.Part == nil {
+		return ""
+	}
+	score := PreferPlain
+	if f == ExportHTML {
+		score = PreferHTML
+	}
+	body := m.Part.displayBody(score)
+	attachments := m.Part.appendAttachments(nil, body)
+
+	if f == ExportHTML {
+		return m.exportHTML(body, attachments)
+	}
+	return m.exportText(body, attachments)
+}
+
+// Returns the plain text rendering used by Export().
+func (m *Message) exportText(body *Part, attachments []*Part) string {
+	var buf bytes.Buffer
+	for _, name := range exportFieldNames {
+		for _, f := range m.Header.Fields {
+			if strings.EqualFold(f.Name(), name) {
+				buf.WriteString(name + ": " + simplify(f.Value()) + "\n")
+			}
+		}
+	}
+	buf.WriteString("\n")
+
+	if body != nil {
+		text := body.PlainText()
+		if body.contentType() == "text/html" {
+			text = htmlToText(text)
+		}
+		text = strings.Replace(text, "\r\n", "\n", -1)
+		buf.WriteString(text)
+		if !strings.HasSuffix(text, "\n") {
+			buf.WriteString("\n")
+		}
+	}
+
+	if len(attachments) > 0 {
+		buf.WriteString("\nAttachments:\n")
+		for i, p := range attachments {
+			buf.WriteString(strconv.Itoa(i+1) + ". " + p.attachmentSummary() + "\n")
+		}
+	}
+	return buf.String()
+}
+
+// Returns the HTML rendering used by Export().
+func (m *Message) exportHTML(body *Part, attachments []*Part) string {
+	var buf bytes.Buffer
+	buf.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	buf.WriteString("<title>" + htmlEscape(simplify(m.Header.Subject())) + "</title>\n")
+	buf.WriteString("</head>\n<body>\n<table class=\"header\">\n")
+	for _, name := range exportFieldNames {
+		for _, f := range m.Header.Fields {
+			if strings.EqualFold(f.Name(), name) {
+				buf.WriteString("<tr><th>" + name + ":</th><td>" +
+					htmlEscape(simplify(f.Value())) + "</td></tr>\n")
+			}
+		}
+	}
+	buf.WriteString("</table>\n<hr>\n")
+
+	if body != nil {
+		buf.WriteString("<div class=\"body\">\n")
+		if body.contentType() == "text/html" {
+			buf.WriteString(sanitizeHTML(body.Text, nil))
+		} else {
+			buf.WriteString("<pre>" + htmlEscape(strings.Replace(body.PlainText(), "\r\n", "\n", -1)) + "</pre>")
+		}
+		buf.WriteString("\n</div>\n")
+	}
+
+	if len(attachments) > 0 {
+		buf.WriteString("<hr>\n<ol class=\"attachments\">\n")
+		for _, p := range attachments {
+			buf.WriteString("<li>" + htmlEscape(p.attachmentSummary()) + "</li>\n")
+		}
+		buf.WriteString("</ol>\n")
+	}
+	buf.WriteString("</body>\n</html>\n")
+	return buf.String()
+}
+
+// Returns the body of this message as an HTML fragment, for display in a web
+// page: the HTML body sanitized as for Export(ExportHTML), or the text body
+// in a pre element. Returns an empty string if there is no body.
+//
+// If \a cidURL is not nil, each image referring to a part of the message
+// by "cid:" URL is kept, with the URL replaced by what \a cidURL returns for
+// the Content-ID, without angle brackets, so that a server can serve the part
+// itself. Other references to resources are removed.
+func (m *Message) SanitizedHTML(cidURL func(id string) string) string {
+	if m.Part == nil {
+		return ""
+	}
+	body := m.Part.displayBody(PreferHTML)
+	if body == nil {
+		return ""
+	}
+	if body.contentType() != "text/html" {
+		return "<pre>" + htmlEscape(strings.Replace(body.PlainText(), "\r\n", "\n", -1)) + "</pre>"
+	}
+	var rewrite func(string) string
+	if cidURL != nil {
+		rewrite = func(ref string) string {
+			ref = strings.TrimSpace(ref)
+			if !strings.HasPrefix(strings.ToLower(ref), "cid:") {
+				return ""
+			}
+			id, err := url.PathUnescape(ref[4:])
+			if err != nil {
+				id = ref[4:]
+			}
+			if m.PartByContentID(id) == nil {
+				return ""
+			}
+			return cidURL(strings.TrimSuffix(strings.TrimPrefix(id, "<"), ">"))
+		}
+	}
+	return sanitizeHTML(body.Text, rewrite)
+}
+
+// Returns the bodypart which should be displayed as the body of this part,
+// or nil if there is none. For multipart/alternative, the alternative
+// \a score rates highest among those which hold a body is used.
+func (p *Part) displayBody(score AlternativeScorer) *Part {
+	if len(p.Parts) == 0 {
+		if p.message != nil || p.isAttachment() {
+			return nil
+		}
+		switch p.contentType() {
+		case "", "text/plain", "text/html":
+			return p
+		}
+		return nil
+	}
+
+	ct := p.contentType()
+	if ct == "multipart/alternative" {
+		candidates := []*Part{}
+		for _, c := range p.Parts {
+			if c.displayBody(score) != nil {
+				candidates = append(candidates, c)
+			}
+		}
+		if best := bestAlternative(candidates, score); best != nil {
+			return best.displayBody(score)
+		}
+		return nil
+	}
+	for _, c := range p.Parts {
+		if b := c.displayBody(score); b != nil {
+			return b
+		}
+	}
+	return nil
+}
+
+// Returns a one-line description of this bodypart as an attachment, e.g.
+// "report.pdf (application/pdf, 1234 bytes, sha256 ab12...)".
+func (p *Part) attachmentSummary() string {
+	name := p.Filename()
+	if name == "" && p.message != nil && p.message.Header != nil {
+		name = simplify(p.message.Header.Subject())
+	}
+	if name == "" {
+		name = "(unnamed)"
+	}
+	ct := p.contentType()
+	if ct == "" {
+		ct = "text/plain"
+	}
+	return name + " (" + ct + ", " + strconv.Itoa(p.Size()) + " bytes, sha256 " +
+		p.contentHash() + ")"
+}
+
+// Elements whose content is dropped entirely by sanitizeHTML() and
+// htmlToText(). This includes the elements browsers parse unlike others,
+// e.g. xmp and plaintext, whose content is not meant to be read as text.
+func isHiddenElement(tag string) bool {
+	switch tag {
+	case "script", "style", "head", "title", "iframe", "object", "embed",
+		"applet", "form", "noscript", "template", "xmp", "noembed",
+		"noframes", "plaintext":
+		return true
+	}
+	return false
+}
+
+// The SVG and MathML elements sanitizeHTML() keeps. Anything else in svg or
+// math content is dropped, e.g. animate and set, which can change other
+// attributes to anything, and foreignObject, which contains HTML.
+var foreignElements = map[string]bool{
+	"svg": true, "g": true, "defs": true, "desc": true, "symbol": true,
+	"use": true, "image": true, "switch": true, "a": true, "path": true,
+	"rect": true, "circle": true, "ellipse": true, "line": true,
+	"polyline": true, "polygon": true, "text": true, "tspan": true,
+	"textpath": true, "lineargradient": true, "radialgradient": true,
+	"stop": true, "pattern": true, "clippath": true, "mask": true,
+	"marker": true,
+
+	"math": true, "mi": true, "mn": true, "mo": true, "ms": true,
+	"mtext": true, "mspace": true, "mrow": true, "mfrac": true,
+	"msqrt": true, "mroot": true, "mstyle": true, "merror": true,
+	"mpadded": true, "mphantom": true, "mfenced": true, "menclose": true,
+	"msub": true, "msup": true, "msubsup": true, "munder": true,
+	"mover": true, "munderover": true, "mmultiscripts": true,
+	"mprescripts": true, "none": true, "mtable": true, "mtr": true,
+	"mtd": true, "semantics": true, "annotation": true,
+}
+
+// The attributes sanitizeHTML() keeps on SVG and MathML elements. Those
+// which name other attributes or supply values for them, such as
+// attributename, values, from, to and by, are not among them.
+var foreignAttributes = map[string]bool{
+	"id": true, "class": true, "style": true, "lang": true, "dir": true,
+	"role": true, "aria-label": true, "xmlns": true, "version": true,
+	"width": true, "height": true, "x": true, "y": true, "x1": true,
+	"y1": true, "x2": true, "y2": true, "cx": true, "cy": true, "r": true,
+	"rx": true, "ry": true, "fx": true, "fy": true, "dx": true, "dy": true,
+	"d": true, "points": true, "rotate": true, "transform": true,
+	"viewbox": true, "preserveaspectratio": true, "offset": true,
+	"fill": true, "fill-opacity": true, "fill-rule": true, "stroke": true,
+	"stroke-width": true, "stroke-opacity": true, "stroke-linecap": true,
+	"stroke-linejoin": true, "stroke-dasharray": true,
+	"stroke-dashoffset": true, "stroke-miterlimit": true, "opacity": true,
+	"color": true, "visibility": true, "display": true, "font-family": true,
+	"font-size": true, "font-weight": true, "font-style": true,
+	"text-anchor": true, "dominant-baseline": true, "stop-color": true,
+	"stop-opacity": true, "gradientunits": true, "gradienttransform": true,
+	"spreadmethod": true, "patternunits": true, "patterncontentunits": true,
+	"patterntransform": true, "clip-path": true, "clip-rule": true,
+	"mask": true, "marker-start": true, "marker-mid": true,
+	"marker-end": true, "markerwidth": true, "markerheight": true,
+	"refx": true, "refy": true, "orient": true,
+
+	"mathvariant": true, "mathsize": true, "mathcolor": true,
+	"mathbackground": true, "displaystyle": true, "scriptlevel": true,
+	"fence": true, "separator": true, "separators": true, "stretchy": true,
+	"symmetric": true, "largeop": true, "movablelimits": true,
+	"accent": true, "accentunder": true, "lspace": true, "rspace": true,
+	"linethickness": true, "columnalign": true, "rowalign": true,
+	"columnspan": true, "rowspan": true, "columnlines": true,
+	"rowlines": true, "frame": true, "notation": true, "encoding": true,
+	"open": true, "close": true, "depth": true, "voffset": true,
+}
+
+// Returns the body content of the HTML document \a s without scripts, forms,
+// event handler attributes or references to external resources, so that it
+// can be embedded in another document and displayed without fetching
+// anything. Links are kept only if they are relative or use the http, https,
+// mailto or cid scheme; declarations which load or compute something, such as
+// url() and expression(), are removed from style attributes; and SVG and
+// MathML content keeps only the elements and attributes in foreignElements
+// and foreignAttributes, without links, since an SVG image or use element
+// fetches what it links to.
+//
+// If \a rewrite is not nil, it is called for each src or background
+// attribute which is not a data: URL, and if it returns a non-empty string,
+// the attribute is kept with that value.
+func sanitizeHTML(s string, rewrite func(ref string) string) string {
+	tokens := htmlTokenize(s)
+	r := []htmlToken{}
+	hidden := ""
+	foreign := 0 // the depth of svg and math elements
+	for _, t := range tokens {
+		if hidden != "" {
+			if t.t == htmlEndTagToken && t.tag == hidden {
+				hidden = ""
+			}
+			continue
+		}
+		switch t.t {
+		case htmlCommentToken, htmlDoctypeToken:
+			continue
+		case htmlTextToken:
+			// whatever the tokenizer did not read as a tag must not
+			// become one in a browser
+			t.raw = strings.Replace(t.raw, "<", "&lt;", -1)
+		case htmlStartTagToken, htmlSelfClosingTagToken, htmlEndTagToken:
+			if !isHTMLName(t.tag) {
+				continue
+			}
+			if isHiddenElement(t.tag) {
+				if t.t == htmlStartTagToken {
+					hidden = t.tag
+				}
+				continue
+			}
+			switch t.tag {
+			case "html", "body", "meta", "link", "base":
+				continue
+			case "svg", "math":
+				if t.t == htmlStartTagToken {
+					foreign++
+				} else if t.t == htmlEndTagToken && foreign > 0 {
+					foreign--
+				}
+			default:
+				if foreign > 0 && !foreignElements[t.tag] {
+					continue
+				}
+			}
+			if t.t != htmlEndTagToken {
+				sanitizeAttributes(&t, foreign > 0 || t.tag == "svg" || t.tag == "math", rewrite)
+			} else {
+				t.attrs = nil
+			}
+			// written from what was parsed, never from the input
+			t.modified = true
+		}
+		r = append(r, t)
+	}
+	return strings.TrimSpace(htmlRender(r))
+}
+
+// Removes the attributes of \a t which sanitizeHTML() does not allow, and
+// rewrites resource references using \a rewrite as described there.
+// \a foreign is true if \a t is an SVG or MathML element.
+func sanitizeAttributes(t *htmlToken, foreign bool, rewrite func(ref string) string) {
+	kept := make([]htmlAttr, 0, len(t.attrs))
+	changed := false
+	for _, a := range t.attrs {
+		if !isHTMLName(a.Name) || foreign && !foreignAttributes[a.Name] {
+			changed = true
+			continue
+		}
+		// presentation attributes such as fill take url() as CSS does
+		if foreign && a.Name != "style" && strings.Contains(normalizeCSS(a.Value), "url(") {
+			changed = true
+			continue
+		}
+		switch a.Name {
+		case "srcset", "xlink:href", "action", "formaction", "ping":
+			changed = true
+			continue
+		case "href":
+			if foreign || !isSafeLink(a.Value) {
+				changed = true
+				continue
+			}
+		case "src", "background", "poster", "lowsrc", "dynsrc":
+			if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Value)), "data:") {
+				v := ""
+				if rewrite != nil {
+					v = rewrite(a.Value)
+				}
+				changed = true
+				if v == "" {
+					continue
+				}
+				a.Value = v
+			}
+		case "style":
+			v := sanitizeStyle(a.Value)
+			if v != a.Value {
+				changed = true
+				if v == "" {
+					continue
+				}
+				a.Value = v
+			}
+		default:
+			if strings.HasPrefix(a.Name, "on") {
+				changed = true
+				continue
+			}
+		}
+		kept = append(kept, a)
+	}
+	if changed {
+		t.attrs = kept
+		t.modified = true
+	}
+}
+
+// Returns true if \a s is a plausible element or attribute name: ASCII
+// letters, digits, '-', '_', '.' and ':', starting with a letter.
+func isHTMLName(s string) bool {
+	if s == "" || !(s[0] >= 'a' && s[0] <= 'z') {
+		return false
+	}
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == ':') {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns true if the link \a ref is relative or uses one of the schemes
+// sanitizeHTML() allows. Browsers ignore whitespace and control characters
+// in the scheme, e.g. "java\tscript:", so they are ignored here too, and
+// since browsers know more character references than htmlUnescape(), a
+// scheme followed by one, e.g. "javascript&colon;", is refused.
+func isSafeLink(ref string) bool {
+	ref = strings.Map(func(r rune) rune {
+		if r <= ' ' || r == 0x7f {
+			return -1
+		}
+		return r
+	}, ref)
+	i := 0
+	for i < len(ref) && (ref[i] >= 'a' && ref[i] <= 'z' || ref[i] >= 'A' && ref[i] <= 'Z' ||
+		ref[i] >= '0' && ref[i] <= '9' || ref[i] == '+' || ref[i] == '-' || ref[i] == '.') {
+		i++
+	}
+	if i == len(ref) || ref[i] != ':' && ref[i] != '&' {
+		return true
+	}
+	if ref[i] == ':' {
+		switch strings.ToLower(ref[:i]) {
+		case "http", "https", "mailto", "cid":
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the style attribute \a style without the declarations which would
+// fetch or compute something, or \a style itself if there are none.
+func sanitizeStyle(style string) string {
+	decls := parseCSSDeclarations(style)
+	kept := decls[:0]
+	for _, d := range decls {
+		p := normalizeCSS(d.property)
+		v := normalizeCSS(d.value)
+		if p == "behavior" || p == "-moz-binding" || strings.Contains(v, "url(") ||
+			strings.Contains(v, "expression(") || strings.Contains(v, "image(") ||
+			strings.Contains(v, "image-set(") || strings.Contains(v, "javascript:") {
+			continue
+		}
+		kept = append(kept, d)
+	}
+	if len(kept) == len(decls) && !strings.Contains(style, "\\") &&
+		!strings.Contains(style, "/*") {
+		return style
+	}
+	var buf bytes.Buffer
+	for _, d := range kept {
+		if buf.Len() > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(d.property)
+		buf.WriteString(": ")
+		buf.WriteString(d.value)
+		if d.important {
+			buf.WriteString(" !important")
+		}
+	}
+	return buf.String()
+}
+
+// Returns the CSS text \a s as a browser would see it for the purpose of
+// finding functions in it: without comments, escapes or whitespace, and in
+// lower case.
+func normalizeCSS(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '/' && i+1 < len(s) && s[i+1] == '*':
+			end := strings.Index(s[i+2:], "*/")
+			if end < 0 {
+				i = len(s)
+			} else {
+				i += end + 3
+			}
+		case c == '\\' && i+1 < len(s):
+			j := i + 1
+			for j < len(s) && j < i+7 && strings.IndexByte("0123456789abcdefABCDEF", s[j]) >= 0 {
+				j++
+			}
+			if j == i+1 {
+				buf.WriteByte(s[j])
+				i = j
+				continue
+			}
+			n, _ := strconv.ParseUint(s[i+1:j], 16, 32)
+			buf.WriteRune(rune(n))
+			if j < len(s) && isHTMLSpace(s[j]) {
+				j++
+			}
+			i = j - 1
+		case isHTMLSpace(c):
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return strings.ToLower(buf.String())
+}
+
+// Returns the text content of the HTML document \a s, with line breaks where
+// block elements begin and end.
+func htmlToText(s string) string {
+	var buf bytes.Buffer
+	hidden := ""
+	space := false // whether the last text ended with whitespace
+	newline := func() {
+		if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteString("\n")
+		}
+	}
+	for _, t := range htmlTokenize(s) {
+		if hidden != "" {
+			if t.t == htmlEndTagToken && t.tag == hidden {
+				hidden = ""
+			}
+			continue
+		}
+		switch t.t {
+		case htmlTextToken:
+			text := strings.Join(strings.Fields(htmlUnescape(t.raw)), " ")
+			if text == "" {
+				space = space || t.raw != ""
+				continue
+			}
+			if buf.Len() > 0 && !bytes.HasSuffix(buf.Bytes(), []byte("\n")) &&
+				(space || isHTMLSpace(t.raw[0])) {
+				buf.WriteString(" ")
+			}
+			buf.WriteString(text)
+			space = isHTMLSpace(t.raw[len(t.raw)-1])
+		case htmlStartTagToken, htmlSelfClosingTagToken, htmlEndTagToken:
+			if isHiddenElement(t.tag) {
+				if t.t == htmlStartTagToken {
+					hidden = t.tag
+				}
+				continue
+			}
+			switch t.tag {
+			case "br":
+				buf.WriteString("\n")
+			case "p", "div", "table", "tr", "ul", "ol", "li", "blockquote",
+				"pre", "h1", "h2", "h3", "h4", "h5", "h6", "hr":
+				newline()
+			}
+		}
+	}
+	newline()
+	return buf.String()
+}
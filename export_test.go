@@ -0,0 +1,144 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestExport(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("To", "bob@example.com")
+	c.Header.Add("Date", "Mon, 02 Jan 2006 15:04:05 -0700")
+	c.Header.Add("Message-ID", "<1@example.com>")
+	c.Header.Add("Subject", "Minutes")
+	c.Text = "Plain minutes.\n"
+	c.HTML = "<html><head><script>alert(1)</script></head>" +
+		"<body><p onclick=\"x()\">HTML <b>minutes</b></p>" +
+		"<img src=\"https://tracker.example.com/t.gif\"></body></html>"
+	c.Attach("minutes.csv", "text/csv", "a,b\r\n")
+	composed, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(composed.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := msg.Export(mail.ExportText)
+	testStringEquals(t, "text export", text,
+		"From: alice@example.com\n"+
+			"To: bob@example.com\n"+
+			"Date: Mon, 02 Jan 2006 15:04:05 -0700\n"+
+			"Subject: Minutes\n"+
+			"Message-ID: <1@example.com>\n"+
+			"\n"+
+			"Plain minutes.\n"+
+			"\n"+
+			"Attachments:\n"+
+			"1. minutes.csv (text/csv, 5 bytes, sha256 "+
+			"fbf6b30113a4b6418c623a96ed6844f17ef5751b908a16abaa919d0bcd6b7784)\n")
+
+	html := msg.Export(mail.ExportHTML)
+	if !strings.Contains(html, "<p>HTML <b>minutes</b></p>") {
+		t.Errorf("HTML body missing from export: %s", html)
+	}
+	for _, bad := range []string{"script", "onclick", "tracker.example.com", "Plain minutes"} {
+		if strings.Contains(html, bad) {
+			t.Errorf("HTML export contains %q: %s", bad, html)
+		}
+	}
+	testStringEquals(t, "repeated export", msg.Export(mail.ExportHTML), html)
+}
+
+func TestSanitizedHTML(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.HTML = "<p>Hi <img src=\"cid:a%40example.com\"><img src=\"cid:missing@example.com\">" +
+		"<img src=\"http://example.com/x.png\"></p>"
+	c.Attach("a.png", "image/png", "png").ContentID = "a@example.com"
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p := m.PartByContentID("<a@example.com>"); p == nil || p.Filename() != "a.png" {
+		t.Error("PartByContentID did not find a.png")
+	}
+	testStringEquals(t, "rewritten", m.SanitizedHTML(func(id string) string {
+		return "/cid/" + id
+	}), "<p>Hi <img src=\"/cid/a@example.com\"><img><img></p>")
+	testStringEquals(t, "without cid URLs", m.SanitizedHTML(nil), "<p>Hi <img><img><img></p>")
+
+	c.HTML = ""
+	c.Text = "a < b\n"
+	m, err = c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "text", m.SanitizedHTML(nil), "<pre>a &lt; b\n</pre>")
+}
+
+func TestSanitizeActiveContent(t *testing.T) {
+	for _, c := range []struct {
+		name, html, expected string
+	}{
+		{"javascript link", `<a href="javascript:alert(1)">x</a>`, `<a>x</a>`},
+		{"obscured scheme", `<a href=" JaVa&#x09;Script&colon;alert(1)">x</a>`, `<a>x</a>`},
+		{"data link", `<a href="data:text/html;base64,PHNjcmlwdD4=">x</a>`, `<a>x</a>`},
+		{"allowed links",
+			`<a href="https://example.com/a?b=c:d">a</a><a href="mailto:bob@example.com">b</a>` +
+				`<a href="cid:x@example.com">c</a><a href="#top">d</a><a href="page.html">e</a>`,
+			`<a href="https://example.com/a?b=c:d">a</a><a href="mailto:bob@example.com">b</a>` +
+				`<a href="cid:x@example.com">c</a><a href="#top">d</a><a href="page.html">e</a>`},
+		{"duplicate href", `<a href="https://example.com" href="javascript:alert(1)">x</a>`,
+			`<a href="https://example.com">x</a>`},
+		{"tracking background", `<td style="color: red; background:url(https://tracker.example/t.gif)">x</td>`,
+			`<td style="color: red">x</td>`},
+		{"escaped url", `<p style="background-image: u\72 l(https://tracker.example/)">x</p>`, `<p>x</p>`},
+		{"expression", `<p style="width: expr/**/ession(alert(1)); margin: 0">x</p>`, `<p style="margin: 0">x</p>`},
+		{"harmless style", `<p style="color: red; margin: 0;">x</p>`, `<p style="color: red; margin: 0;">x</p>`},
+		{"svg image", `<svg><image href="https://tracker.example/t.png"/>` +
+			`<use xlink:href="https://example.com/s.svg#a"/><a href="https://example.com">y</a></svg>`,
+			`<svg><image /><use /><a>y</a></svg>`},
+		{"svg animate", `<svg><animate attributeName="href" values="javascript:alert(1)"/>` +
+			`<a><animateMotion /><animateTransform /><text>x</text></a></svg>`,
+			`<svg><a><text>x</text></a></svg>`},
+		{"svg set", `<svg><set attributeName="onmouseover" to="alert(1)"></set></svg>`, `<svg></svg>`},
+		{"svg animation attributes",
+			`<svg><rect attributeName="x" values="1" from="2" to="3" by="4" width="5"/></svg>`,
+			`<svg><rect width="5" /></svg>`},
+		{"svg url", `<svg><rect fill="url(https://tracker.example/t.svg#a)" stroke="red"/></svg>`,
+			`<svg><rect stroke="red" /></svg>`},
+		{"foreign object", `<svg><foreignObject><p>x</p></foreignObject></svg>`, `<svg>x</svg>`},
+		{"math", `<math><mi mathvariant="bold" href="https://example.com">x</mi><maction actiontype="toggle">y</maction></math>`,
+			`<math><mi mathvariant="bold">x</mi>y</math>`},
+		{"after svg", `<svg></svg><a href="https://example.com">z</a>`,
+			`<svg></svg><a href="https://example.com">z</a>`},
+		{"ping", `<a href="https://example.com" ping="https://tracker.example/">x</a>`,
+			`<a href="https://example.com">x</a>`},
+		{"poster", `<video poster="https://tracker.example/p.png"></video>`, `<video></video>`},
+		{"slash in unquoted value", `<img src=x/onerror=alert(1)>`, `<img>`},
+		{"slash before name", `<img/src/onerror=alert(1)>`, `<img>`},
+		{"slash after tag name", `<svg/onload=alert(1)>`, `<svg>`},
+		{"slash after value", `<a href="https://example.com"/onclick=alert(1)>x</a>`,
+			`<a href="https://example.com">x</a>`},
+		{"quotes in name", `<img """onerror=alert(1)>`, `<img>`},
+		{"rewritten tag", `<p class=x>a < b</p>`, `<p class="x">a &lt; b</p>`},
+		{"textarea", `<textarea><img src=x onerror=alert(1)></textarea>`,
+			`<textarea>&lt;img src=x onerror=alert(1)></textarea>`},
+		{"xmp", `<xmp><img src=x onerror=alert(1)></xmp>ok`, `ok`},
+		{"noembed", `<noembed><img src=x onerror=alert(1)></noembed>ok`, `ok`},
+		{"noframes", `<noframes><img src=x onerror=alert(1)></noframes>ok`, `ok`},
+		{"plaintext", `ok<plaintext><img src=x onerror=alert(1)>`, `ok`},
+		{"script end tag prefix", `<script>x</scriptx><img src=x onerror=alert(1)></script>ok`, `ok`},
+	} {
+		m, err := mail.ReadMessage("From: alice@example.com\r\nContent-Type: text/html\r\n\r\n" + c.html)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, c.name, m.SanitizedHTML(nil), c.expected)
+	}
+}
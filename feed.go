@@ -0,0 +1,320 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Written by FeedConverter, as by rss2email.
+	XRSSFeedFieldName = "X-Rss-Feed"
+	XRSSIDFieldName   = "X-Rss-Id"
+	XRSSURLFieldName  = "X-Rss-Url"
+)
+
+// A Feed is an RSS or Atom feed, as returned by ParseFeed().
+type Feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Entries []*FeedEntry
+}
+
+// A FeedEntry is one item of a Feed. Content is HTML. Published and Updated
+// are zero if the feed does not say.
+type FeedEntry struct {
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Content   string
+	Published time.Time
+	Updated   time.Time
+}
+
+// The elements of RSS 0.9x, 1.0 and 2.0 and Atom 1.0 which ParseFeed()
+// uses. RSS 1.0 puts its items beside the channel, the others inside.
+type xmlFeed struct {
+	XMLName xml.Name
+	Channel struct {
+		Title string       `xml:"title"`
+		Link  string       `xml:"link"`
+		Items []xmlRSSItem `xml:"item"`
+	} `xml:"channel"`
+	Items []xmlRSSItem `xml:"item"`
+
+	// Atom
+	ID      string        `xml:"id"`
+	Title   xmlAtomText   `xml:"title"`
+	Links   []xmlAtomLink `xml:"link"`
+	Entries []struct {
+		ID        string        `xml:"id"`
+		Title     xmlAtomText   `xml:"title"`
+		Links     []xmlAtomLink `xml:"link"`
+		Author    string        `xml:"author>name"`
+		Content   xmlAtomText   `xml:"content"`
+		Summary   xmlAtomText   `xml:"summary"`
+		Published string        `xml:"published"`
+		Updated   string        `xml:"updated"`
+	} `xml:"entry"`
+}
+
+type xmlRSSItem struct {
+	Title       string `xml:"title"`
+	Link        string `xml:"link"`
+	GUID        string `xml:"guid"`
+	About       string `xml:"about,attr"`
+	Author      string `xml:"author"`
+	Creator     string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Description string `xml:"description"`
+	Encoded     string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string `xml:"pubDate"`
+	DCDate      string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type xmlAtomLink struct {
+	Rel  string `xml:"rel,attr"`
+	Href string `xml:"href,attr"`
+}
+
+type xmlAtomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// Returns the text as HTML.
+func (t *xmlAtomText) html() string {
+	switch t.Type {
+	case "html":
+		return t.Text
+	case "xhtml":
+		return strings.TrimSpace(t.Inner)
+	}
+	return htmlEscape(t.Text)
+}
+
+// Returns the text as plain text.
+func (t *xmlAtomText) text() string {
+	if t.Type == "html" || t.Type == "xhtml" {
+		return strings.TrimSpace(htmlToText(t.html()))
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+// Returns the href of the alternate link in \a links.
+func atomLink(links []xmlAtomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+// Parses the RSS (0.9x, 1.0 or 2.0) or Atom feed \a data.
+func ParseFeed(data []byte) (*Feed, error) {
+	var x xmlFeed
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.Strict = false
+	d.CharsetReader = func(cs string, r io.Reader) (io.Reader, error) {
+		b, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		s, err := decode(string(b), cs)
+		if err != nil {
+			return nil, err
+		}
+		return strings.NewReader(s), nil
+	}
+	if err := d.Decode(&x); err != nil {
+		return nil, err
+	}
+
+	f := &Feed{}
+	switch x.XMLName.Local {
+	case "feed":
+		f.ID = strings.TrimSpace(x.ID)
+		f.Title = x.Title.text()
+		f.Link = atomLink(x.Links)
+		for _, e := range x.Entries {
+			content := e.Content.html()
+			if strings.TrimSpace(content) == "" {
+				content = e.Summary.html()
+			}
+			f.Entries = append(f.Entries, &FeedEntry{
+				ID:        strings.TrimSpace(e.ID),
+				Title:     e.Title.text(),
+				Link:      atomLink(e.Links),
+				Author:    strings.TrimSpace(e.Author),
+				Content:   content,
+				Published: parseFeedDate(e.Published),
+				Updated:   parseFeedDate(e.Updated),
+			})
+		}
+	case "rss", "RDF":
+		f.Title = strings.TrimSpace(x.Channel.Title)
+		f.Link = strings.TrimSpace(x.Channel.Link)
+		f.ID = f.Link
+		for _, i := range append(x.Channel.Items, x.Items...) {
+			e := &FeedEntry{
+				ID:      strings.TrimSpace(i.GUID),
+				Title:   strings.TrimSpace(htmlUnescape(i.Title)),
+				Link:    strings.TrimSpace(i.Link),
+				Author:  strings.TrimSpace(i.Creator),
+				Content: i.Encoded,
+			}
+			if e.ID == "" {
+				e.ID = strings.TrimSpace(i.About)
+			}
+			if e.ID == "" {
+				e.ID = e.Link
+			}
+			if e.Author == "" {
+				e.Author = strings.TrimSpace(i.Author)
+			}
+			if strings.TrimSpace(e.Content) == "" {
+				e.Content = i.Description
+			}
+			e.Published = parseFeedDate(i.PubDate)
+			if e.Published.IsZero() {
+				e.Published = parseFeedDate(i.DCDate)
+			}
+			f.Entries = append(f.Entries, e)
+		}
+	default:
+		return nil, errors.New("mail: not an RSS or Atom feed: " + x.XMLName.Local)
+	}
+	return f, nil
+}
+
+// Parses the RFC 822 or RFC 3339 date \a s, returning the zero time if it
+// is neither.
+func parseFeedDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t
+	}
+	if t := parseDate(s); t != nil {
+		return *t
+	}
+	return time.Time{}
+}
+
+// A FeedConverter turns feed entries into mail messages, as rss2email does.
+//
+// From and To are the addresses of the messages. If From has no display
+// name, the entry's author or the feed's title is used.
+type FeedConverter struct {
+	From string
+	To   string
+}
+
+// Returns a message for the entry \a e of the feed \a f.
+//
+// The Message-ID is derived from the IDs of the feed and entry, so that
+// converting the same entry again produces the same Message-ID and mail
+// clients can recognise duplicates. The List-ID identifies the feed, so that
+// messages from it can be filtered. The HTML content is stripped of scripts
+// and references to external resources, and a plain text version is
+// included as an alternative.
+func (c *FeedConverter) Message(f *Feed, e *FeedEntry) (*Message, error) {
+	comp := NewComposer()
+	h := comp.Header
+
+	from := c.From
+	ap := NewAddressParser(from)
+	if len(ap.Addresses) == 1 && ap.Addresses[0].name == "" {
+		name := simplify(e.Author)
+		if name == "" {
+			name = simplify(f.Title)
+		}
+		if name != "" {
+			a := ap.Addresses[0]
+			na := NewAddress(name, a.Localpart, a.Domain)
+			from = na.String()
+		}
+	}
+	h.Add(FromFieldName, from)
+	if c.To != "" {
+		h.Add(ToFieldName, c.To)
+	}
+	subject := e.Title
+	if subject == "" {
+		subject = f.Title
+	}
+	h.Add(SubjectFieldName, subject)
+
+	date := e.Published
+	if date.IsZero() {
+		date = e.Updated
+	}
+	if !date.IsZero() {
+		h.Add(DateFieldName, date.Format(dateLayout))
+	}
+
+	domain := feedDomain(f)
+	h.Add(MessageIDFieldName, "<"+feedHash(f.ID, e.ID, e.Link, e.Title)+"@"+domain+">")
+	h.Add(ListIdFieldName, quote(f.Title, '"', '\\')+" <"+feedListID(f, domain)+">")
+	h.Add(XRSSFeedFieldName, f.Link)
+	if e.ID != "" {
+		h.Add(XRSSIDFieldName, e.ID)
+	}
+	if e.Link != "" {
+		h.Add(XRSSURLFieldName, e.Link)
+	}
+
+	content := sanitizeHTML(e.Content, nil)
+	if e.Link != "" && isSafeLink(e.Link) {
+		content += "\r\n<p><a href=\"" + htmlEscape(e.Link) + "\">" +
+			htmlEscape(e.Link) + "</a></p>"
+	}
+	comp.HTML = content + "\r\n"
+	comp.Text = htmlToText(content)
+	return comp.Compose()
+}
+
+// Returns the host name of the feed's link, or "feed.invalid".
+func feedDomain(f *Feed) string {
+	for _, s := range []string{f.Link, f.ID} {
+		if u, err := url.Parse(s); err == nil && u.Hostname() != "" {
+			return strings.ToLower(u.Hostname())
+		}
+	}
+	return "feed.invalid"
+}
+
+// Returns a List-ID for the feed \a f, whose domain is \a domain.
+func feedListID(f *Feed, domain string) string {
+	id := f.ID
+	if id == "" {
+		id = f.Link
+	}
+	return feedHash(id)[:12] + ".feed." + domain
+}
+
+// Returns a hex hash of the first non-empty strings of \a parts after the
+// first, together with the first.
+func feedHash(parts ...string) string {
+	s := parts[0]
+	for _, p := range parts[1:] {
+		if p != "" {
+			s += "\x00" + p
+			break
+		}
+	}
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:16])
+}
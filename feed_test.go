@@ -0,0 +1,116 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestFeedConverter(t *testing.T) {
+	rss := `<?xml version="1.0" encoding="utf-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"
+     xmlns:dc="http://purl.org/dc/elements/1.1/">
+<channel>
+<title>Example Blog</title>
+<link>https://blog.example.com/</link>
+<item>
+<title>Hello &amp; welcome</title>
+<link>https://blog.example.com/hello</link>
+<guid>tag:blog.example.com,2020:1</guid>
+<dc:creator>Alice</dc:creator>
+<pubDate>Tue, 01 Sep 2020 10:00:00 GMT</pubDate>
+<description>Short</description>
+<content:encoded><![CDATA[<p>Hi <script>alert(1)</script>there</p>]]></content:encoded>
+</item>
+</channel>
+</rss>`
+	atom := `<feed xmlns="http://www.w3.org/2005/Atom">
+<id>urn:uuid:60a76c80</id>
+<title>Atom Feed</title>
+<link href="https://atom.example.org/"/>
+<entry>
+<id>urn:uuid:1225c695</id>
+<title type="html">A &lt;b&gt;bold&lt;/b&gt; move</title>
+<link rel="alternate" href="https://atom.example.org/2003/12/13"/>
+<updated>2003-12-13T18:30:02Z</updated>
+<summary>Some text.</summary>
+</entry>
+</feed>`
+
+	f, err := mail.ParseFeed([]byte(rss))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "rss entries", len(f.Entries), 1)
+	testStringEquals(t, "rss title", f.Entries[0].Title, "Hello & welcome")
+	testStringEquals(t, "rss author", f.Entries[0].Author, "Alice")
+
+	c := &mail.FeedConverter{From: "feeds@example.com", To: "reader@example.com"}
+	m, err := c.Message(f, f.Entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := c.Message(f, f.Entries[0])
+	testStringEquals(t, "stable message-id", again.Header.MessageID(), m.Header.MessageID())
+
+	msg, err := mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Header.Valid() {
+		t.Fatalf("converted entry is not valid: %v", msg.Header.Error())
+	}
+	testStringEquals(t, "subject", msg.Header.Subject(), "Hello & welcome")
+	testStringEquals(t, "from", msg.Header.Addresses("From")[0].Name(false), "Alice")
+	testStringEquals(t, "url", msg.Header.Get(mail.XRSSURLFieldName), "https://blog.example.com/hello")
+	if !strings.HasSuffix(msg.Header.MessageID(), "@blog.example.com>") {
+		t.Errorf("message-id %q not in the feed's domain", msg.Header.MessageID())
+	}
+	if !strings.HasSuffix(msg.Header.Get(mail.ListIdFieldName), ".feed.blog.example.com>") {
+		t.Errorf("unexpected list-id %q", msg.Header.Get(mail.ListIdFieldName))
+	}
+	testIntegerEquals(t, "alternatives", len(msg.Parts), 2)
+	html := msg.Parts[1].Text
+	if strings.Contains(html, "script") || !strings.Contains(html, "https://blog.example.com/hello") {
+		t.Errorf("unexpected html body %q", html)
+	}
+
+	f, err = mail.ParseFeed([]byte(atom))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "atom title", f.Entries[0].Title, "A bold move")
+	testStringEquals(t, "atom link", f.Entries[0].Link, "https://atom.example.org/2003/12/13")
+	m, err = c.Message(f, f.Entries[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "atom from", m.Header.Addresses("From")[0].Name(false), "Atom Feed")
+	testIntegerEquals(t, "atom date", int(m.Header.Date().Unix()), 1071340202)
+
+	if _, err := mail.ParseFeed([]byte("<html></html>")); err == nil {
+		t.Error("html accepted as a feed")
+	}
+}
+
+func TestFeedActiveContent(t *testing.T) {
+	f := &mail.Feed{ID: "https://blog.example.com/", Title: "Example Blog", Link: "https://blog.example.com/"}
+	e := &mail.FeedEntry{
+		ID:    "tag:blog.example.com,2020:2",
+		Title: "Payloads",
+		Link:  "javascript:alert(1)",
+		Content: `<p>Hi</p><img/src/onerror=alert(1)><svg/onload=alert(2)>` +
+			`<textarea><img src=x onerror=alert(3)></textarea>` +
+			`<xmp><img src=x onerror=alert(4)></xmp><noembed><script>alert(5)</script></noembed>`,
+	}
+	c := &mail.FeedConverter{From: "feeds@example.com", To: "reader@example.com"}
+	m, err := c.Message(f, e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the unsafe link is left out, too, and the textarea is in svg
+	// content, where it is not an element sanitizeHTML() keeps
+	testStringEquals(t, "html body", m.Parts[1].Text,
+		"<p>Hi</p><img><svg>&lt;img src=x onerror=alert(3)>\r\n")
+}
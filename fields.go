@@ -113,6 +113,7 @@ func init() {
 
 type Field interface {
 	Name() string
+	RawName() string
 	Value() string
 	Error() error
 
@@ -121,19 +122,66 @@ type Field interface {
 	UnparsedValue() string
 	SetUnparsedValue(value string)
 
+	Position() Position
+	setSource(p Position, text string)
+	sourceText() string
+	setError(err error)
+
 	rfc822(avoidUTF8 bool) string
 }
 
+// A Position is the location of a header field in the message it was read
+// from. Line is 1-based; a zero Position means that the field did not come
+// from the input, e.g. because Repair() added it.
+type Position struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+}
+
+// Returns true if this Position refers to a location in the input.
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+func (p Position) String() string {
+	if !p.IsValid() {
+		return "-"
+	}
+	return fmt.Sprintf("line %d (offset %d)", p.Line, p.Offset)
+}
+
+// Returns the Position \a n bytes into \a s, if \a s starts at this
+// Position.
+func (p Position) advance(s string, n int) Position {
+	if !p.IsValid() {
+		return p
+	}
+	return Position{Offset: p.Offset + n, Line: p.Line + strings.Count(s[:n], "\n")}
+}
+
 type HeaderField struct {
 	name, value   string
 	unparsedValue string
 	err           error
+	pos           Position
+	source        string
 }
 
 func (f *HeaderField) Name() string {
 	return f.name
 }
 
+// Returns the name of this field as it was written in the input, e.g.
+// "content-type" where Name() returns "Content-Type", or Name() if the field
+// was not read from the input. The text returned by sourceText() keeps this
+// spelling, so signatures over the original header can still be verified.
+func (f *HeaderField) RawName() string {
+	if i := strings.IndexByte(f.source, ':'); i > 0 {
+		return strings.TrimRight(f.source[:i], " \t")
+	}
+	return f.name
+}
+
 func (f *HeaderField) Value() string {
 	return f.value
 }
@@ -142,6 +190,30 @@ func (f *HeaderField) Error() error {
 	return f.err
 }
 
+// Marks this field as invalid because of \a err.
+func (f *HeaderField) setError(err error) {
+	f.err = err
+}
+
+// Returns the location of this field in the input, or a zero Position if it
+// was not read from the input.
+func (f *HeaderField) Position() Position {
+	return f.pos
+}
+
+// Records that this field was read from \a text (the entire field, including
+// the name and any folding, but not the final CRLF) at \a p in the input.
+func (f *HeaderField) setSource(p Position, text string) {
+	f.pos = p
+	f.source = text
+}
+
+// Returns the text this field was read from, or an empty string if it was not
+// read from the input.
+func (f *HeaderField) sourceText() string {
+	return f.source
+}
+
 // Every HeaderField subclass must define a parse() function that takes a
 // string \a s from a message and sets the field value(). This default function
 // handles fields that are not specially handled by subclasses using functions
@@ -154,15 +226,15 @@ func (f *HeaderField) Parse(s string) {
 		ContentIDFieldName, ResentMessageIDFieldName, ReferencesFieldName, DateFieldName,
 		OrigDateFieldName, ResentDateFieldName, ContentTypeFieldName,
 		ContentTransferEncodingFieldName, ContentDispositionFieldName,
-		ContentLanguageFieldName:
+		ContentLanguageFieldName, MIMEVersionFieldName:
 		// These should be handled by their own parse()
 	case ContentDescriptionFieldName, SubjectFieldName, CommentsFieldName:
 		f.parseText(s)
-	case MIMEVersionFieldName:
-		f.parseMIMEVersion(s)
 	case ContentLocationFieldName:
 		f.parseContentLocation(s)
-	case InReplyToFieldName, KeywordsFieldName, ReceivedFieldName, ContentMd5FieldName:
+	case InReplyToFieldName:
+		f.parseInReplyTo(s)
+	case KeywordsFieldName, ReceivedFieldName, ContentMd5FieldName:
 		f.parseOther(s)
 	case ContentBaseFieldName:
 		f.parseContentBase(s)
@@ -234,31 +306,6 @@ func (f *HeaderField) parseText(s string) {
 	}
 }
 
-// Parses the MIME-Version field from \a s and resolutely ignores all problems
-// seen.
-//
-// Only version 1.0 is legal. Since vast numbers of spammers send other version
-// numbers, we replace other version numbers with 1.0 and a comment. Bayesian
-// analysis tools will probably find the comment to be a sure spam sign.
-func (f *HeaderField) parseMIMEVersion(s string) {
-	p := newParser(s)
-	p.Comment()
-	v := p.DotAtom()
-	p.Comment()
-	c, err := decode(simplify(p.lc), "us-ascii")
-	if err != nil || strings.ContainsAny(c, "()\\") {
-		c = ""
-	}
-	if v != "1.0" || !p.AtEnd() {
-		c = "Note: Original mime-version had syntax problems"
-	}
-	result := "1.0"
-	if c != "" {
-		result += " (" + c + ")"
-	}
-	f.value = result
-}
-
 // Parses the Content-Location header field in \a s and records the first
 // problem found.
 func (f *HeaderField) parseContentLocation(s string) {
@@ -732,6 +779,8 @@ func references(r string) AddressParser {
 	return ap
 }
 
+// A DateField holds a date, e.g. the Date field. Date is nil if the value
+// could not be parsed, and in UnknownZone if it gives no usable zone.
 type DateField struct {
 	HeaderField
 	Date *time.Time
@@ -771,10 +820,19 @@ func init() {
 }
 
 func parseDate(s string) *time.Time {
-	s = simplify(stripcomments(s))
+	s = normalizeDateZone(simplify(stripcomments(s)))
+	unknown := strings.HasSuffix(s, " -0000")
 	for _, layout := range dateLayouts {
 		t, err := time.Parse(layout, s)
 		if err == nil {
+			// use a fixed zone rather than time.Local, even if
+			// their offsets happen to agree
+			_, offset := t.Zone()
+			loc := time.FixedZone("", offset)
+			if unknown {
+				loc = UnknownZone
+			}
+			t = t.In(loc)
 			return &t
 		}
 	}
@@ -785,7 +843,7 @@ func parseDate(s string) *time.Time {
 func (f *DateField) Parse(s string) {
 	t := parseDate(s)
 	if t != nil {
-		f.value = t.Format("Mon, 02 Jan 2006 15:04:05 -0700")
+		f.value = FormatDate(*t, nil)
 		f.Date = t
 		return
 	}
@@ -986,7 +1044,7 @@ func (f *MIMEField) rfc822(avoidUTF8 bool) string {
 	for _, p := range f.Parameters {
 		s := p.Value
 		if !isBoring(s, MIMEBoring) {
-			s = quote(s, '"', '\'')
+			s = quote(s, '"', '\\')
 		}
 		words = append(words, p.Name+"="+s)
 	}
@@ -1196,7 +1254,13 @@ func (f *ContentTransferEncoding) Parse(s string) {
 	p.Comment()
 	// FIXME: shouldn't we do p.end() here and record parse errors?
 
-	if t == "7bit" || t == "8bit" || t == "8bits" || t == "binary" || t == "unknown" {
+	if t == "8bit" || t == "8bits" {
+		f.Encoding = BinaryEncoding
+		f.baseValue = "8bit"
+	} else if t == "binary" {
+		f.Encoding = BinaryEncoding
+		f.baseValue = "binary"
+	} else if t == "7bit" || t == "unknown" {
 		f.Encoding = BinaryEncoding
 		f.baseValue = "7bit"
 	} else if t == "quoted-printable" {
@@ -1212,7 +1276,7 @@ func (f *ContentTransferEncoding) Parse(s string) {
 		f.Encoding = BinaryEncoding
 		f.baseValue = "7bit"
 	} else {
-		f.err = fmt.Errorf("Invalid c-t-e value: %q", t)
+		f.err = wrapError(ErrBadEncoding, "Invalid c-t-e value: %q", t)
 	}
 }
 
@@ -1253,6 +1317,57 @@ func (f *ContentDisposition) Parse(s string) {
 	f.baseValue = f.Disposition
 }
 
+// Returns the date of the creation-date parameter (RFC 2183) and true, or a
+// zero time and false if there is none or it cannot be parsed.
+func (f *ContentDisposition) CreationDate() (time.Time, bool) {
+	return f.dateParameter("creation-date")
+}
+
+// Returns the date of the modification-date parameter, as CreationDate()
+// does.
+func (f *ContentDisposition) ModificationDate() (time.Time, bool) {
+	return f.dateParameter("modification-date")
+}
+
+// Returns the date of the read-date parameter, as CreationDate() does.
+func (f *ContentDisposition) ReadDate() (time.Time, bool) {
+	return f.dateParameter("read-date")
+}
+
+// Returns the approximate size of the file in bytes, as given by the size
+// parameter, and true, or 0 and false if there is no valid size parameter.
+func (f *ContentDisposition) Size() (int, bool) {
+	n, err := strconv.Atoi(simplify(f.parameter("size")))
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return n, true
+}
+
+// Returns the date in the parameter named \a name and true, or a zero time
+// and false.
+func (f *ContentDisposition) dateParameter(name string) (time.Time, bool) {
+	v := f.parameter(name)
+	if v == "" {
+		return time.Time{}, false
+	}
+	t, err := ParseDate(v)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// Sets the parameter named \a name to \a t, formatted as RFC 2183 asks,
+// or removes it if \a t is zero.
+func (f *ContentDisposition) setDateParameter(name string, t time.Time) {
+	if t.IsZero() {
+		f.removeParameter(name)
+	} else {
+		f.addParameter(name, FormatDate(t, nil))
+	}
+}
+
 type ContentLanguage struct {
 	MIMEField
 	Languages []string
@@ -1285,13 +1400,67 @@ func (f *ContentLanguage) Parse(s string) {
 	f.baseValue = strings.Join(f.Languages, ", ")
 }
 
+// A MIMEVersionField is a MIME-Version field. Comment holds the text of its
+// comment, e.g. "produced by Example Mailer" for "1.0 (produced by Example
+// Mailer)", or an empty string if it has none.
+type MIMEVersionField struct {
+	HeaderField
+	Comment string
+}
+
+func NewMIMEVersionField() *MIMEVersionField {
+	return &MIMEVersionField{HeaderField: HeaderField{name: MIMEVersionFieldName}}
+}
+
+// Parses the MIME-Version field from \a s and resolutely ignores all problems
+// seen.
+//
+// Only version 1.0 is legal. Since vast numbers of spammers send other version
+// numbers, we replace other version numbers with 1.0 and a comment. Bayesian
+// analysis tools will probably find the comment to be a sure spam sign.
+//
+// Comments, including nested ones, are kept, as is the last comment if there
+// are several; 8-bit comments are dropped. The value is always one Parse()
+// accepts as it is, so a field written by Repair() reads back unchanged.
+func (f *MIMEVersionField) Parse(s string) {
+	p := newParser(s)
+	p.Comment()
+	v := p.DotAtom()
+	p.lc = ""
+	p.Comment()
+	c, err := decode(simplify(p.lc), "us-ascii")
+	if err != nil {
+		c = ""
+	}
+	if !isMIMEVersion1(v) || !p.AtEnd() {
+		c = "Note: Original mime-version had syntax problems"
+	}
+	f.Comment = c
+	f.value = "1.0"
+	if c != "" {
+		r := strings.NewReplacer("\\", "\\\\", "(", "\\(", ")", "\\)")
+		f.value += " (" + r.Replace(c) + ")"
+	}
+}
+
+// Returns true if \a v is "1.0", or another way to write it, e.g. "1.00".
+func isMIMEVersion1(v string) bool {
+	dot := strings.IndexByte(v, '.')
+	if dot < 1 || dot == len(v)-1 {
+		return false
+	}
+	major, err1 := strconv.Atoi(v[:dot])
+	minor, err2 := strconv.Atoi(v[dot+1:])
+	return err1 == nil && err2 == nil && major == 1 && minor == 0
+}
+
 func NewHeaderFieldNamed(name string) Field {
 	n := headerCase(name)
 
 	var hf Field
 	switch n {
-	case InReplyToFieldName, SubjectFieldName, CommentsFieldName, KeywordsFieldName,
-		ContentDescriptionFieldName, MIMEVersionFieldName, ReceivedFieldName,
+	case InReplyToFieldName, SubjectFieldName,
+		ContentDescriptionFieldName, ReceivedFieldName,
 		ContentLocationFieldName, ContentMd5FieldName, ListIdFieldName:
 		hf = &HeaderField{name: n}
 	case FromFieldName, ResentFromFieldName, SenderFieldName, ResentSenderFieldName,
@@ -1309,6 +1478,14 @@ func NewHeaderFieldNamed(name string) Field {
 		hf = NewContentDisposition()
 	case ContentLanguageFieldName:
 		hf = NewContentLanguage()
+	case MIMEVersionFieldName:
+		hf = NewMIMEVersionField()
+	case ContentDurationFieldName:
+		hf = NewContentDuration()
+	case KeywordsFieldName:
+		hf = NewKeywordsField()
+	case CommentsFieldName:
+		hf = NewCommentsField()
 	default:
 		hf = &HeaderField{name: n}
 	}
@@ -1324,7 +1501,7 @@ func NewHeaderField(name, value string) Field {
 	}
 
 	i := 0
-	for value[i] == ':' || value[i] == ' ' {
+	for i < len(value) && (value[i] == ':' || value[i] == ' ') {
 		i++
 	}
 	suf := NewHeaderFieldNamed(name)
@@ -0,0 +1,107 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A FileSuppressionList is a SuppressionList kept in a JSON file, which is
+// rewritten whenever the list changes. It may be used by several goroutines
+// at once, but not by several processes.
+type FileSuppressionList struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Suppression
+}
+
+// Returns a FileSuppressionList kept in the file \a path, which is read if
+// it exists and created when the first address is suppressed.
+func NewFileSuppressionList(path string) (*FileSuppressionList, error) {
+	l := &FileSuppressionList{path: path, entries: map[string]Suppression{}}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Suppression
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return nil, err
+	}
+	for _, s := range entries {
+		l.entries[strings.ToLower(s.Address)] = s
+	}
+	return l, nil
+}
+
+// Suppresses \a s.Address, as described for SuppressionList. If \a s.Time
+// is zero, the current time is used.
+func (l *FileSuppressionList) Suppress(s Suppression) error {
+	if s.Time.IsZero() {
+		s.Time = time.Now().UTC()
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.entries[strings.ToLower(s.Address)] = s
+	return l.save()
+}
+
+// Returns the entry for \a address, or nil if it is not suppressed.
+func (l *FileSuppressionList) Suppressed(address string) (*Suppression, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	s, ok := l.entries[strings.ToLower(address)]
+	if !ok {
+		return nil, nil
+	}
+	return &s, nil
+}
+
+// Removes \a address from the list, if it is there.
+func (l *FileSuppressionList) Remove(address string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	key := strings.ToLower(address)
+	if _, ok := l.entries[key]; !ok {
+		return nil
+	}
+	delete(l.entries, key)
+	return l.save()
+}
+
+// Returns all entries, sorted by address.
+func (l *FileSuppressionList) List() []Suppression {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.sorted()
+}
+
+// Returns all entries, sorted by address. The caller must hold l.mu.
+func (l *FileSuppressionList) sorted() []Suppression {
+	r := make([]Suppression, 0, len(l.entries))
+	for _, s := range l.entries {
+		r = append(r, s)
+	}
+	sort.Slice(r, func(i, j int) bool {
+		return strings.ToLower(r[i].Address) < strings.ToLower(r[j].Address)
+	})
+	return r
+}
+
+// Writes the list to its file. The caller must hold l.mu.
+func (l *FileSuppressionList) save() error {
+	b, err := json.MarshalIndent(l.sorted(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(l.path, b)
+}
@@ -0,0 +1,112 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSuppressionList(t *testing.T) {
+	dsn := "From: MAILER-DAEMON@mx.example.com\r\nTo: bounces@example.com\r\n" +
+		"Subject: Undelivered Mail\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=delivery-status; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nSorry.\r\n" +
+		"--b\r\nContent-Type: message/delivery-status\r\n\r\n" +
+		"Reporting-MTA: dns; mx.example.com\r\n\r\n" +
+		"Final-Recipient: rfc822; Bob@Example.org\r\nAction: failed\r\n" +
+		"Status: 5.1.1\r\nDiagnostic-Code: smtp; 550 5.1.1 No such\r\n user\r\n\r\n" +
+		"Final-Recipient: rfc822; carol@example.org\r\nAction: delayed\r\n" +
+		"Status: 4.4.1\r\n\r\n" +
+		"--b\r\nContent-Type: text/rfc822-headers\r\n\r\n" +
+		"From: news@example.com\r\nTo: bob@example.org\r\nSubject: News\r\n\r\n" +
+		"--b--\r\n"
+	arf := "From: fbl@isp.example\r\nTo: abuse@example.com\r\nSubject: FW: News\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/report; report-type=feedback-report; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nA complaint.\r\n" +
+		"--b\r\nContent-Type: message/feedback-report\r\n\r\n" +
+		"Feedback-Type: abuse\r\nUser-Agent: FBL/1.0\r\nVersion: 1\r\n" +
+		"--b\r\nContent-Type: message/rfc822\r\n\r\n" +
+		"From: news@example.com\r\nTo: dave@isp.example\r\nSubject: News\r\n\r\nNews\r\n" +
+		"--b--\r\n"
+
+	m, err := mail.ReadMessage(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reports := m.RecipientReports()
+	testIntegerEquals(t, "dsn reports", len(reports), 2)
+	if len(reports) == 2 {
+		testStringEquals(t, "recipient", reports[0].Recipient, "Bob@Example.org")
+		testStringEquals(t, "status", reports[0].Status, "5.1.1")
+		testStringEquals(t, "diagnostic", reports[0].Diagnostic, "550 5.1.1 No such user")
+		testStringEquals(t, "action", reports[1].Action, "delayed")
+		if !reports[0].HardBounce() || reports[1].HardBounce() {
+			t.Errorf("expected only the first report to be a hard bounce")
+		}
+	}
+
+	dir, err := ioutil.TempDir("", "suppression")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "suppressed.json")
+	l, err := mail.NewFileSuppressionList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err := mail.SuppressReported(l, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "bounces suppressed", len(added), 1)
+
+	m, err = mail.ReadMessage(arf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	added, err = mail.SuppressReported(l, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "complaints suppressed", len(added), 1)
+	if len(added) == 1 {
+		testStringEquals(t, "complaint", added[0].Address+" "+added[0].Reason,
+			"dave@isp.example complaint")
+	}
+	if err := l.Suppress(mail.Suppression{Address: "erin@example.org",
+		Reason: mail.SuppressionUnsubscribe}); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second list reads what the first wrote
+	l, err = mail.NewFileSuppressionList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := l.Suppressed("bob@example.org")
+	if err != nil || s == nil {
+		t.Fatalf("expected bob to be suppressed, got %v, %v", s, err)
+	}
+	testStringEquals(t, "reason", s.Reason, mail.SuppressionHardBounce)
+	testStringEquals(t, "detail", s.Detail, "550 5.1.1 No such user")
+	testIntegerEquals(t, "entries", len(l.List()), 3)
+
+	if err := l.Remove("ERIN@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	ok, err := mail.Unsuppressed(l, []string{"bob@example.org", "carol@example.org",
+		"dave@isp.example", "erin@example.org"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "unsuppressed", strings.Join(ok, " "), "carol@example.org erin@example.org")
+}
@@ -0,0 +1,186 @@
+package mail
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+)
+
+// A logical line of a format=flowed text, i.e. a paragraph which may have
+// been wrapped over several physical lines.
+type flowedLine struct {
+	depth int
+	text  string
+}
+
+// Splits \a s into lines, accepting CRLF as well as bare LF. A trailing line
+// break does not produce an empty line.
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := strings.Split(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	for i, l := range lines {
+		lines[i] = strings.TrimSuffix(l, "\r")
+	}
+	return lines
+}
+
+// Parses \a s as format=flowed text (RFC 3676 section 4) and returns its
+// logical lines. If \a delsp is true, the space preceding each soft line break
+// is deleted, as specified for DelSp=yes.
+func parseFlowed(s string, delsp bool) []flowedLine {
+	r := []flowedLine{}
+	open := false
+	for _, l := range splitLines(s) {
+		depth := 0
+		for depth < len(l) && l[depth] == '>' {
+			depth++
+		}
+		l = l[depth:]
+		if strings.HasPrefix(l, " ") {
+			// space-stuffed
+			l = l[1:]
+		}
+		flowed := strings.HasSuffix(l, " ") && l != "-- "
+		if flowed && delsp {
+			l = l[:len(l)-1]
+		}
+
+		if open && r[len(r)-1].depth == depth && l != "-- " {
+			r[len(r)-1].text += l
+		} else {
+			// a quote depth change ends a paragraph even if the
+			// previous line was (improperly) flowed.
+			r = append(r, flowedLine{depth: depth, text: l})
+		}
+		open = flowed
+	}
+	return r
+}
+
+// Returns the text \a s with the soft line breaks of RFC 3676 removed and
+// space-stuffing undone. Quoted lines are returned with their quote marks
+// followed by a single space. \a delsp controls the DelSp parameter.
+func UnflowText(s string, delsp bool) string {
+	var buf bytes.Buffer
+	for _, l := range parseFlowed(s, delsp) {
+		if l.depth > 0 {
+			buf.WriteString(strings.Repeat(">", l.depth))
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(l.text)
+		buf.WriteString(crlf)
+	}
+	return buf.String()
+}
+
+// Returns \a s encoded as format=flowed text (RFC 3676), with lines wrapped at
+// \a width characters (72 if \a width is 0 or less) where possible. Lines in
+// \a s starting with '>' are treated as quoted text and keep their quote
+// depth. The result uses CRLF line breaks.
+//
+// If \a delsp is true, the result must be labelled DelSp=yes; this allows
+// words longer than a line to be broken.
+func FormatFlowed(s string, width int, delsp bool) string {
+	if width <= 0 {
+		width = 72
+	}
+	var buf bytes.Buffer
+	for _, l := range splitLines(s) {
+		depth := 0
+		for depth < len(l) && l[depth] == '>' {
+			depth++
+		}
+		prefix := strings.Repeat(">", depth)
+		text := l[depth:]
+		if depth > 0 && strings.HasPrefix(text, " ") {
+			text = text[1:]
+		}
+		if text != "-- " {
+			// trailing spaces would make this a soft break
+			text = strings.TrimRight(text, " ")
+		}
+		avail := width - len(prefix)
+		if avail < 20 {
+			avail = 20
+		}
+		for _, line := range wrapFlowed(text, avail, delsp) {
+			buf.WriteString(prefix)
+			if (depth > 0 && line != "") || strings.HasPrefix(line, " ") ||
+				strings.HasPrefix(line, ">") || strings.HasPrefix(line, "From ") {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(line)
+			buf.WriteString(crlf)
+		}
+	}
+	return buf.String()
+}
+
+// Breaks the paragraph \a s into physical lines of at most \a width
+// characters where possible. Every line except the last ends with the space
+// that marks a soft line break.
+func wrapFlowed(s string, width int, delsp bool) []string {
+	r := []string{}
+	for len(s) > width {
+		// the space stays at the end of the line, so the break may go
+		// after a space at position width-1 at the latest
+		b := strings.LastIndexByte(s[:width], ' ')
+		if b > 0 {
+			if delsp {
+				r = append(r, s[:b+1]+" ")
+			} else {
+				r = append(r, s[:b+1])
+			}
+			s = s[b+1:]
+		} else if delsp {
+			// no space to break at; we can add one which the
+			// reader will delete, between two characters, not
+			// within one
+			cut := width - 1
+			for cut > 0 && !utf8.RuneStart(s[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				_, cut = utf8.DecodeRuneInString(s)
+			}
+			r = append(r, s[:cut]+" ")
+			s = s[cut:]
+		} else {
+			// a very long word. find the first space after it.
+			b = strings.IndexByte(s, ' ')
+			if b < 0 {
+				break
+			}
+			r = append(r, s[:b+1])
+			s = s[b+1:]
+		}
+	}
+	return append(r, s)
+}
+
+// Returns true if this bodypart is text/plain with format=flowed.
+func (p *Part) isFlowed() bool {
+	if p.Header == nil {
+		return false
+	}
+	ct := p.Header.ContentType()
+	return ct != nil && ct.Type == "text" && ct.Subtype == "plain" &&
+		strings.ToLower(ct.parameter("format")) == "flowed"
+}
+
+// Returns the text of this bodypart as it should be displayed. For
+// format=flowed text, soft line breaks are removed so that paragraphs can be
+// reflowed to the width of the display. For other text, this is the same as
+// Text.
+func (p *Part) Reflowed() string {
+	if !p.isFlowed() {
+		return p.Text
+	}
+	delsp := strings.ToLower(p.Header.ContentType().parameter("delsp")) == "yes"
+	return UnflowText(p.Text, delsp)
+}
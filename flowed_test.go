@@ -0,0 +1,100 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestFlowedBody(t *testing.T) {
+	msg := loadFixture(t, "flowed")
+
+	expected := "This is a long paragraph that was wrapped by the sender so that it fits within the usual line length limits.\r\n" +
+		"\r\n" +
+		"> This was quoted and also wrapped.\r\n" +
+		">> Deeper.\r\n" +
+		"From the top.\r\n" +
+		"-- \r\n" +
+		"Sig\r\n"
+	testStringEquals(t, "Reflowed text", msg.Reflowed(), expected)
+}
+
+func TestFormatFlowed(t *testing.T) {
+	text := strings.Repeat("word ", 40) + "end\n> quoted\nFrom here\n"
+	for _, delsp := range []bool{false, true} {
+		flowed := mail.FormatFlowed(text, 30, delsp)
+		for _, l := range strings.Split(strings.TrimSuffix(flowed, "\r\n"), "\r\n") {
+			if len(l) > 31 {
+				t.Errorf("line too long (delsp=%v): %q", delsp, l)
+			}
+			if strings.HasPrefix(l, "From ") {
+				t.Errorf("line not space-stuffed (delsp=%v): %q", delsp, l)
+			}
+		}
+		expected := strings.Replace(text, "\n", "\r\n", -1)
+		testStringEquals(t, "Unflowed text", mail.UnflowText(flowed, delsp), expected)
+	}
+}
+
+func TestFormatFlowedNonASCII(t *testing.T) {
+	text := strings.Repeat("日本語", 20) + "\n"
+	flowed := mail.FormatFlowed(text, 30, true)
+	for _, l := range strings.Split(strings.TrimSuffix(flowed, "\r\n"), "\r\n") {
+		if !utf8.ValidString(l) {
+			t.Errorf("line is not valid UTF-8: %q", l)
+		}
+		if len(l) > 31 {
+			t.Errorf("line too long: %q", l)
+		}
+	}
+	testStringEquals(t, "Unflowed text", mail.UnflowText(flowed, true),
+		strings.Replace(text, "\n", "\r\n", -1))
+}
+
+func TestQuotes(t *testing.T) {
+	q := mail.ParseQuotes("Hi\n> > deep\n> mid\nme\n", false, false)
+	if len(q.Blocks) != 3 {
+		t.Fatalf("expected 3 blocks, got %d", len(q.Blocks))
+	}
+	quote := q.Blocks[1]
+	if quote.Depth != 1 || quote.IsText() || len(quote.Blocks) != 2 {
+		t.Fatalf("unexpected quote block: %+v", quote)
+	}
+	testStringEquals(t, "Nested quote", quote.Blocks[0].Blocks[0].Lines[0], "deep")
+	testStringEquals(t, "Quote", quote.Blocks[1].Lines[0], "mid")
+	testStringEquals(t, "Reply", q.Blocks[2].Lines[0], "me")
+}
+
+func TestComposeFlowed(t *testing.T) {
+	text := strings.Repeat("A long paragraph of words. ", 10) + "The end.\n\n> a quote\nFrom here\n" +
+		strings.Repeat("x", 100) + "\n"
+	for _, delsp := range []bool{false, true} {
+		c := mail.NewComposer()
+		c.Header.Add("From", "alice@example.com")
+		c.Text = text
+		c.Flowed = true
+		c.DelSp = delsp
+		composed, err := c.Compose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m, err := mail.ReadMessage(composed.RFC822(false))
+		if err != nil {
+			t.Fatal(err)
+		}
+		ct := m.Header.ContentType()
+		expected := "text/plain; format=flowed"
+		if delsp {
+			expected += "; delsp=yes"
+		}
+		testStringEquals(t, "content type", ct.Value(), expected)
+		for _, l := range strings.Split(m.Text, "\r\n") {
+			if len(l) > 78 && (delsp || strings.Contains(l, " ")) {
+				t.Errorf("line not wrapped (delsp=%v): %q", delsp, l)
+			}
+		}
+		testStringEquals(t, "reflowed", m.Reflowed(), strings.Replace(text, "\n", "\r\n", -1))
+	}
+}
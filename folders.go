@@ -0,0 +1,298 @@
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// A SpecialUse is an RFC 6154 attribute marking a mailbox which holds
+// messages with a particular role, e.g. those which were sent.
+type SpecialUse string
+
+const (
+	SpecialUseNone    SpecialUse = ""
+	SpecialUseAll     SpecialUse = "\\All"
+	SpecialUseArchive SpecialUse = "\\Archive"
+	SpecialUseDrafts  SpecialUse = "\\Drafts"
+	SpecialUseFlagged SpecialUse = "\\Flagged"
+	SpecialUseJunk    SpecialUse = "\\Junk"
+	SpecialUseSent    SpecialUse = "\\Sent"
+	SpecialUseTrash   SpecialUse = "\\Trash"
+)
+
+// A Folder is a node in a folder hierarchy. Name is its full name, using
+// "/" as the hierarchy separator, as do MigrationTarget and TakeoutFolder().
+// Children are sorted by name, with INBOX first.
+type Folder struct {
+	Name       string
+	SpecialUse SpecialUse
+	Children   []*Folder
+}
+
+// Returns the last component of the folder's name, e.g. "Projects" for
+// "Work/Projects".
+func (f *Folder) Base() string {
+	return f.Name[strings.LastIndexByte(f.Name, '/')+1:]
+}
+
+// Returns the folder called \a name in the tree below and including \a f,
+// or nil.
+func (f *Folder) Find(name string) *Folder {
+	if f.Name == name {
+		return f
+	}
+	for _, c := range f.Children {
+		if strings.HasPrefix(name, c.Name) {
+			if r := c.Find(name); r != nil {
+				return r
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the hierarchy formed by the folders called \a names, as the
+// children of a root Folder whose name is empty. Folders which are not
+// named but are needed as parents are created. The special use of each
+// folder is taken from \a uses if it is there, e.g. because the IMAP server
+// said so in its LIST response, and otherwise guessed with
+// GuessSpecialUse().
+func NewFolderTree(names []string, uses map[string]SpecialUse) *Folder {
+	root := &Folder{}
+	all := map[string]*Folder{"": root}
+	var add func(name string) *Folder
+	add = func(name string) *Folder {
+		if f := all[name]; f != nil {
+			return f
+		}
+		f := &Folder{Name: name, SpecialUse: uses[name]}
+		if f.SpecialUse == SpecialUseNone {
+			f.SpecialUse = GuessSpecialUse(name)
+		}
+		all[name] = f
+		parent := ""
+		if i := strings.LastIndexByte(name, '/'); i >= 0 {
+			parent = name[:i]
+		}
+		p := add(parent)
+		p.Children = append(p.Children, f)
+		return f
+	}
+	for _, n := range names {
+		n = strings.Trim(n, "/")
+		if n != "" {
+			add(n)
+		}
+	}
+	for _, f := range all {
+		sort.Slice(f.Children, func(i, j int) bool {
+			a, b := f.Children[i].Name, f.Children[j].Name
+			if strings.EqualFold(a, "INBOX") != strings.EqualFold(b, "INBOX") {
+				return strings.EqualFold(a, "INBOX")
+			}
+			return a < b
+		})
+	}
+	return root
+}
+
+// The names various providers and clients give their special folders,
+// lower-cased.
+var specialUseNames = map[string]SpecialUse{
+	"all mail":         SpecialUseAll,
+	"archive":          SpecialUseArchive,
+	"archives":         SpecialUseArchive,
+	"drafts":           SpecialUseDrafts,
+	"draft":            SpecialUseDrafts,
+	"starred":          SpecialUseFlagged,
+	"flagged":          SpecialUseFlagged,
+	"junk":             SpecialUseJunk,
+	"junk e-mail":      SpecialUseJunk,
+	"junk email":       SpecialUseJunk,
+	"spam":             SpecialUseJunk,
+	"bulk mail":        SpecialUseJunk,
+	"sent":             SpecialUseSent,
+	"sent mail":        SpecialUseSent,
+	"sent items":       SpecialUseSent,
+	"sent messages":    SpecialUseSent,
+	"trash":            SpecialUseTrash,
+	"deleted items":    SpecialUseTrash,
+	"deleted messages": SpecialUseTrash,
+	"bin":              SpecialUseTrash,
+}
+
+// Returns the special use a folder called \a name probably has, judging by
+// its last component, or SpecialUseNone. Only top-level folders and those
+// in Gmail's "[Gmail]" and "[Google Mail]" folders are considered, since
+// e.g. "Projects/Archive" is an ordinary folder.
+func GuessSpecialUse(name string) SpecialUse {
+	lower := strings.ToLower(strings.Trim(name, "/"))
+	for _, prefix := range []string{"[gmail]/", "[google mail]/", "inbox/", "inbox."} {
+		lower = strings.TrimPrefix(lower, prefix)
+	}
+	if strings.ContainsAny(lower, "/") {
+		return SpecialUseNone
+	}
+	return specialUseNames[lower]
+}
+
+// FolderConventions maps the special uses to the names of the folders with
+// those uses at a provider.
+type FolderConventions map[SpecialUse]string
+
+var (
+	// The folders of Gmail, as seen over IMAP.
+	GmailFolders = FolderConventions{
+		SpecialUseAll:     "[Gmail]/All Mail",
+		SpecialUseDrafts:  "[Gmail]/Drafts",
+		SpecialUseFlagged: "[Gmail]/Starred",
+		SpecialUseJunk:    "[Gmail]/Spam",
+		SpecialUseSent:    "[Gmail]/Sent Mail",
+		SpecialUseTrash:   "[Gmail]/Trash",
+	}
+	// The folders of Exchange and Outlook.com.
+	ExchangeFolders = FolderConventions{
+		SpecialUseArchive: "Archive",
+		SpecialUseDrafts:  "Drafts",
+		SpecialUseJunk:    "Junk Email",
+		SpecialUseSent:    "Sent Items",
+		SpecialUseTrash:   "Deleted Items",
+	}
+	// The folders of iCloud Mail.
+	ICloudFolders = FolderConventions{
+		SpecialUseArchive: "Archive",
+		SpecialUseDrafts:  "Drafts",
+		SpecialUseJunk:    "Junk",
+		SpecialUseSent:    "Sent Messages",
+		SpecialUseTrash:   "Deleted Messages",
+	}
+	// The folders of Dovecot's and Thunderbird's defaults, and of the
+	// folder names TakeoutFolder() returns.
+	StandardFolders = FolderConventions{
+		SpecialUseArchive: "Archive",
+		SpecialUseDrafts:  "Drafts",
+		SpecialUseJunk:    "Junk",
+		SpecialUseSent:    "Sent",
+		SpecialUseTrash:   "Trash",
+	}
+)
+
+// Returns the special use of the folder called \a name under these
+// conventions, guessing with GuessSpecialUse() if the conventions do not
+// name it.
+func (c FolderConventions) SpecialUse(name string) SpecialUse {
+	for use, n := range c {
+		if strings.EqualFold(n, name) {
+			return use
+		}
+	}
+	return GuessSpecialUse(name)
+}
+
+// Returns the name under the conventions \a to of the folder called
+// \a name under these conventions: if it has a special use which \a to has
+// a folder for, that folder, and otherwise \a name, so that e.g. Gmail's
+// "[Gmail]/Sent Mail" becomes Exchange's "Sent Items" and "Work" stays
+// "Work". INBOX is always "INBOX".
+func (c FolderConventions) Map(name string, to FolderConventions) string {
+	if strings.EqualFold(name, "INBOX") {
+		return "INBOX"
+	}
+	if n, ok := to[c.SpecialUse(name)]; ok {
+		return n
+	}
+	return name
+}
+
+// The base64 alphabet of modified UTF-7 (RFC 3501 section 5.1.3).
+var modifiedBase64 = base64.NewEncoding(
+	"ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+,").
+	WithPadding(base64.NoPadding)
+
+// Returns the name an IMAP server with the hierarchy separator \a sep knows
+// the folder \a name by. If \a utf8Accept is true, because UTF8=ACCEPT
+// (RFC 6855) is enabled, the name is sent as UTF-8; otherwise it is encoded
+// in modified UTF-7.
+func EncodeFolderName(name string, sep byte, utf8Accept bool) string {
+	if sep != '/' && sep != 0 {
+		name = strings.Replace(name, "/", string(sep), -1)
+	}
+	if utf8Accept {
+		return name
+	}
+	var b strings.Builder
+	var run []rune
+	flush := func() {
+		if len(run) > 0 {
+			u := utf16.Encode(run)
+			buf := make([]byte, 2*len(u))
+			for i, c := range u {
+				buf[2*i], buf[2*i+1] = byte(c>>8), byte(c)
+			}
+			b.WriteString("&" + modifiedBase64.EncodeToString(buf) + "-")
+			run = nil
+		}
+	}
+	for _, c := range name {
+		if c >= 0x20 && c <= 0x7e {
+			flush()
+			if c == '&' {
+				b.WriteString("&-")
+			} else {
+				b.WriteRune(c)
+			}
+		} else {
+			run = append(run, c)
+		}
+	}
+	flush()
+	return b.String()
+}
+
+// Returns the folder name used by EncodeFolderName() for the IMAP name
+// \a s, or an error if \a s is not valid modified UTF-7. If \a utf8Accept
+// is true, \a s is taken to be UTF-8 and only the separator is changed.
+func DecodeFolderName(s string, sep byte, utf8Accept bool) (string, error) {
+	name := s
+	if !utf8Accept {
+		var b strings.Builder
+		for len(s) > 0 {
+			i := strings.IndexByte(s, '&')
+			if i < 0 {
+				b.WriteString(s)
+				break
+			}
+			b.WriteString(s[:i])
+			s = s[i+1:]
+			end := strings.IndexByte(s, '-')
+			if end < 0 {
+				return "", errors.New("mail: unterminated modified UTF-7 in folder name")
+			}
+			if end == 0 {
+				b.WriteByte('&')
+			} else {
+				buf, err := modifiedBase64.DecodeString(s[:end])
+				if err != nil || len(buf)%2 != 0 {
+					return "", errors.New("mail: invalid modified UTF-7 in folder name")
+				}
+				u := make([]uint16, len(buf)/2)
+				for j := range u {
+					u[j] = uint16(buf[2*j])<<8 | uint16(buf[2*j+1])
+				}
+				b.WriteString(string(utf16.Decode(u)))
+			}
+			s = s[end+1:]
+		}
+		name = b.String()
+	} else if !utf8.ValidString(name) {
+		return "", errors.New("mail: folder name is not valid UTF-8")
+	}
+	if sep != '/' && sep != 0 {
+		name = strings.Replace(name, string(sep), "/", -1)
+	}
+	return name, nil
+}
@@ -0,0 +1,48 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestFolders(t *testing.T) {
+	encoded := mail.EncodeFolderName("Entwürfe/Tom & Jerry/台北", '.', false)
+	testStringEquals(t, "utf-7", encoded, "Entw&APw-rfe.Tom &- Jerry.&U,BTFw-")
+	testStringEquals(t, "utf8=accept", mail.EncodeFolderName("Entwürfe/x", '.', true), "Entwürfe.x")
+	decoded, err := mail.DecodeFolderName(encoded, '.', false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "decoded", decoded, "Entwürfe/Tom & Jerry/台北")
+	emoji := mail.EncodeFolderName("📬", '/', false)
+	decoded, _ = mail.DecodeFolderName(emoji, '/', false)
+	testStringEquals(t, "surrogates", decoded, "📬")
+	if _, err := mail.DecodeFolderName("&AP", '/', false); err == nil {
+		t.Error("unterminated UTF-7 accepted")
+	}
+
+	root := mail.NewFolderTree([]string{"Work/Projects", "[Gmail]/Sent Mail",
+		"INBOX", "Archive", "Work/Archive", "Receipts"},
+		map[string]mail.SpecialUse{"Receipts": mail.SpecialUseFlagged})
+	names := []string{}
+	for _, f := range root.Children {
+		names = append(names, f.Name+string(f.SpecialUse))
+	}
+	testStringEquals(t, "tree", strings.Join(names, " "),
+		"INBOX Archive\\Archive Receipts\\Flagged Work [Gmail]")
+	testStringEquals(t, "gmail sent", string(root.Find("[Gmail]/Sent Mail").SpecialUse), "\\Sent")
+	testStringEquals(t, "nested archive", string(root.Find("Work/Archive").SpecialUse), "")
+	testStringEquals(t, "base", root.Find("Work/Projects").Base(), "Projects")
+
+	testStringEquals(t, "gmail to exchange",
+		mail.GmailFolders.Map("[Gmail]/Sent Mail", mail.ExchangeFolders), "Sent Items")
+	testStringEquals(t, "exchange to gmail",
+		mail.ExchangeFolders.Map("Junk Email", mail.GmailFolders), "[Gmail]/Spam")
+	testStringEquals(t, "guessed", mail.StandardFolders.Map("Deleted Messages", mail.ExchangeFolders),
+		"Deleted Items")
+	testStringEquals(t, "ordinary", mail.GmailFolders.Map("Work", mail.ICloudFolders), "Work")
+	testStringEquals(t, "no archive at gmail",
+		mail.ExchangeFolders.Map("Archive", mail.GmailFolders), "Archive")
+}
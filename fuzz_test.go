@@ -0,0 +1,128 @@
+//go:build go1.18
+// +build go1.18
+
+package mail_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// Returns the contents of the fixtures, for use as fuzzing seeds.
+func fuzzSeeds(f *testing.F) []string {
+	files, err := filepath.Glob("fixtures/*.eml")
+	if err != nil {
+		f.Fatal(err)
+	}
+	r := []string{}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		r = append(r, string(b))
+	}
+	return r
+}
+
+func FuzzReadHeader(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		f.Add(s)
+	}
+	// inputs which used to cause panics
+	f.Add("From foo@example.com")
+	f.Add("Subject:")
+	f.Add("0:0\nDAte::")
+	f.Add("From:0\"<>")
+	f.Add("From:@>0")
+	f.Add("From:%@")
+	f.Add("From:@00.0!@0")
+	f.Add("CC:000\xfe:;")
+	f.Add("From:\"\"@0(\"\"\"\"\"\"\"\")")
+	f.Fuzz(func(t *testing.T, s string) {
+		if h, err := mail.ReadHeader(s, mail.RFC5322Header); err == nil {
+			h.Valid()
+			h.Repair()
+			h.AsText(false)
+		}
+		if h, err := mail.ReadHeader(s, mail.MIMEHeader); err == nil {
+			h.Valid()
+			h.Repair()
+			h.AsText(false)
+		}
+	})
+}
+
+func FuzzReadMessage(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		f.Add(s)
+	}
+	// inputs which used to cause panics
+	f.Add("From: a@example.com")
+	f.Add("Subject: x\r")
+	f.Fuzz(func(t *testing.T, s string) {
+		if m, err := mail.ReadMessage(s); err == nil {
+			m.RFC822(false)
+		}
+	})
+}
+
+func FuzzParseAddress(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		h, err := mail.ReadHeader(s, mail.RFC5322Header)
+		if err != nil {
+			continue
+		}
+		for _, field := range h.Fields {
+			f.Add(field.UnparsedValue())
+		}
+	}
+	f.Add("\"a\" <b@c>, (d) e@f; g:h@i;")
+	f.Add(" ())")
+	f.Fuzz(func(t *testing.T, s string) {
+		p := mail.NewAddressParser(s)
+		for _, a := range p.Addresses {
+			_ = a.String()
+		}
+	})
+}
+
+func FuzzParseMultipart(f *testing.F) {
+	for _, s := range fuzzSeeds(f) {
+		m, err := mail.ReadMessage(s)
+		if err != nil {
+			continue
+		}
+		ct := m.Header.ContentType()
+		if ct == nil || ct.Type != "multipart" {
+			continue
+		}
+		// the fuzzer varies the body and boundary, and we supply
+		// the header
+		i := strings.Index(s, "\r\n\r\n")
+		if i < 0 {
+			i = strings.Index(s, "\n\n")
+		}
+		for _, p := range ct.Parameters {
+			if i >= 0 && strings.ToLower(p.Name) == "boundary" {
+				f.Add(p.Value, s[i:])
+			}
+		}
+	}
+	f.Add("b", "\r\n--b\r\n\r\n--b--")
+	f.Fuzz(func(t *testing.T, boundary, body string) {
+		if boundary == "" || strings.ContainsAny(boundary, "\"\r\n") {
+			return
+		}
+		s := "Content-Type: multipart/mixed; boundary=\"" + boundary + "\"\r\n" + body
+		m, err := mail.ReadMessage(s)
+		if err != nil {
+			return
+		}
+		m.RFC822(false)
+	})
+}
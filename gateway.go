@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A Transform modifies a message, e.g. as a gateway passes it on.
+type Transform func(m *Message) error
+
+// Returns a Transform which appends \a text to each text/plain bodypart of
+// a message which is not an attachment, and an HTML rendering of it to each
+// such text/html bodypart.
+func AddFooter(text string) Transform {
+	text = toCRLF(text)
+	html := "<p>" + strings.Replace(htmlEscape(strings.TrimSuffix(text, crlf)),
+		crlf, "<br>"+crlf, -1) + "</p>" + crlf
+	return func(m *Message) error {
+		if m.Part == nil {
+			return nil
+		}
+		m.Part.walkLeaves(func(p *Part) {
+			if !p.hasText || p.isAttachment() {
+				return
+			}
+			switch p.contentType() {
+			case "", "text/plain":
+				if p.Text != "" && !strings.HasSuffix(p.Text, crlf) {
+					p.Text += crlf
+				}
+				p.Text += crlf + text
+			case "text/html":
+				lower := strings.ToLower(p.Text)
+				if i := strings.LastIndex(lower, "</body>"); i >= 0 {
+					p.Text = p.Text[:i] + html + p.Text[i:]
+				} else {
+					p.Text += html
+				}
+			}
+		})
+		return nil
+	}
+}
+
+// A Gateway passes on messages it has received after modifying them, e.g.
+// as a mailing list or a filter which adds a footer, such that their
+// authentication survives: it verifies their DKIM signatures and ARC chain,
+// records the results, applies Transforms, and then seals the result with
+// Sealer (if not nil), and signs it with Signer (if not nil).
+//
+// AuthServID identifies the gateway in the Authentication-Results field it
+// adds; such fields with the same identifier in incoming messages are
+// removed, since they are forged. Verifier verifies signatures; if nil, a
+// default DKIMVerifier is used.
+//
+// The DKIM and ARC fields of incoming messages are passed on unchanged,
+// since the ARC chain depends on their exact text; other fields may be
+// reformatted.
+type Gateway struct {
+	AuthServID string
+	Verifier   *DKIMVerifier
+	Transforms []Transform
+	Sealer     *ARCSealer
+	Signer     *DKIMSigner
+}
+
+// A GatewayResult describes what a Gateway found on a message: the results
+// of verifying its DKIM signatures and ARC chain, and the value of the
+// Authentication-Results field added.
+type GatewayResult struct {
+	DKIM                  []*DKIMResult
+	ARC                   *ARCResult
+	AuthenticationResults string
+}
+
+// Processes \a rfc5322 as described for Gateway, and returns the message to
+// pass on and what was found. Returns an error if the message cannot be
+// parsed, or a Transform, sealing or signing fails.
+func (g *Gateway) Process(rfc5322 string) (string, *GatewayResult, error) {
+	v := g.Verifier
+	if v == nil {
+		v = &DKIMVerifier{}
+	}
+	rfc5322 = NormalizeLineEndings(rfc5322, "\r\n")
+	r := &GatewayResult{DKIM: v.Verify(rfc5322), ARC: v.VerifyARC(rfc5322)}
+
+	results := []string{}
+	for _, d := range r.DKIM {
+		results = append(results, d.String())
+	}
+	if len(results) == 0 {
+		results = append(results, "dkim=none")
+	}
+	results = append(results, r.ARC.String())
+	r.AuthenticationResults = g.AuthServID + ";" + crlf + "\t" +
+		strings.Join(results, ";"+crlf+"\t")
+
+	m, err := ReadMessage(rfc5322)
+	if err != nil {
+		return "", r, err
+	}
+
+	// keep the authentication fields as they are, and drop forged results
+	kept := []string{}
+	fields, _ := splitRawMessage(rfc5322)
+	for _, f := range fields {
+		switch rawFieldName(f) {
+		case "dkim-signature", "arc-seal", "arc-message-signature",
+			"arc-authentication-results":
+			kept = append(kept, f)
+		}
+	}
+	i := 0
+	for i < len(m.Header.Fields) {
+		switch strings.ToLower(m.Header.Fields[i].Name()) {
+		case "dkim-signature", "arc-seal", "arc-message-signature",
+			"arc-authentication-results":
+			m.Header.RemoveAt(i)
+			continue
+		case "authentication-results":
+			if authServID(m.Header.Fields[i].Value()) == strings.ToLower(g.AuthServID) {
+				m.Header.RemoveAt(i)
+				continue
+			}
+		}
+		i++
+	}
+
+	for _, t := range g.Transforms {
+		if err := t(m); err != nil {
+			return "", r, err
+		}
+	}
+	m.Downgrade()
+
+	kept = append([]string{AuthenticationResultsFieldName + ": " +
+		r.AuthenticationResults}, kept...)
+	// keep an ASCII header ASCII, with RFC 2047 encoding where needed
+	ascii := true
+	for _, f := range fields {
+		ascii = ascii && isAscii(f)
+	}
+	out := strings.Join(kept, crlf) + crlf + m.RFC822(ascii)
+	if g.Sealer != nil {
+		if out, err = g.Sealer.Seal(out, strings.Join(results, ";"+crlf+"\t"), r.ARC); err != nil {
+			return "", r, err
+		}
+	}
+	if g.Signer != nil {
+		if out, err = g.Signer.Sign(out); err != nil {
+			return "", r, err
+		}
+	}
+	return out, r, nil
+}
+
+// Returns the lower-cased authentication service identifier of the
+// Authentication-Results field value \a value.
+func authServID(value string) string {
+	if semi := strings.IndexByte(value, ';'); semi >= 0 {
+		value = value[:semi]
+	}
+	words := strings.Fields(value)
+	if len(words) == 0 {
+		return ""
+	}
+	return strings.ToLower(words[0])
+}
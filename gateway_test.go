@@ -0,0 +1,101 @@
+package mail_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestGatewayARC(t *testing.T) {
+	records := map[string]string{}
+	key := func(name string) *rsa.PrivateKey {
+		k, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pub, _ := x509.MarshalPKIXPublicKey(&k.PublicKey)
+		records[name] = "v=DKIM1; p=" + base64.StdEncoding.EncodeToString(pub)
+		return k
+	}
+	v := &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+		if r, ok := records[name]; ok {
+			return []string{r}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}}
+
+	origin := mail.NewDKIMSigner("example.com", "s1", key("s1._domainkey.example.com"))
+	signed, err := origin.Sign("From: Alice <alice@example.com>\r\n" +
+		"To: list@lists.example.org\r\n" +
+		"Subject: Meeting\r\n" +
+		"Authentication-Results: mx.lists.example.org; dkim=pass\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See you at ten.\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list := &mail.Gateway{
+		AuthServID: "mx.lists.example.org",
+		Verifier:   v,
+		Transforms: []mail.Transform{mail.AddFooter("Unsubscribe: https://lists.example.org/u")},
+		Sealer: mail.NewARCSealer("lists.example.org", "arc",
+			key("arc._domainkey.lists.example.org"), "mx.lists.example.org"),
+		Signer: mail.NewDKIMSigner("lists.example.org", "dk",
+			key("dk._domainkey.lists.example.org")),
+	}
+	out, r, err := list.Process(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "inbound dkim", r.DKIM[0].Result, "pass")
+	testStringEquals(t, "inbound arc", r.ARC.Result, "none")
+	if strings.Count(out, "mx.lists.example.org; dkim=pass\r\n") != 0 {
+		t.Error("forged Authentication-Results kept")
+	}
+	if !strings.Contains(out, "See you at ten.\r\n\r\nUnsubscribe: https://lists.example.org/u\r\n") {
+		t.Errorf("footer not added:\n%s", out)
+	}
+
+	results := v.Verify(out)
+	testIntegerEquals(t, "signatures", len(results), 2)
+	testStringEquals(t, "list signature", results[0].Result, "pass")
+	testStringEquals(t, "original signature", results[1].Result, "fail")
+	arc := v.VerifyARC(out)
+	testStringEquals(t, "arc", arc.String(), "arc=pass")
+	testIntegerEquals(t, "instances", arc.Instances, 1)
+
+	// a second hop seals again, over the first hop's ARC set
+	relay := &mail.Gateway{
+		AuthServID: "relay.example.net",
+		Verifier:   v,
+		Sealer: mail.NewARCSealer("example.net", "arc",
+			key("arc._domainkey.example.net"), "relay.example.net"),
+	}
+	out, r, err = relay.Process(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "relayed arc", r.ARC.Result, "pass")
+	if !strings.Contains(r.AuthenticationResults, "dkim=pass header.d=lists.example.org") {
+		t.Errorf("unexpected results: %s", r.AuthenticationResults)
+	}
+	arc = v.VerifyARC(out)
+	testStringEquals(t, "second arc", arc.String(), "arc=pass")
+	testStringEquals(t, "sealers", strings.Join(arc.Sealers, " "), "lists.example.org example.net")
+	if !strings.Contains(out, "ARC-Seal: i=2; a=rsa-sha256; cv=pass;") {
+		t.Errorf("second seal lacks cv=pass:\n%s", out)
+	}
+
+	tampered := strings.Replace(out, "ARC-Authentication-Results: i=1; mx.lists.example.org;",
+		"ARC-Authentication-Results: i=1; mx.lists.example.org; spf=pass;", 1)
+	testStringEquals(t, "tampered", v.VerifyARC(tampered).Result, "fail")
+}
@@ -0,0 +1,29 @@
+#!/bin/bash
+
+set -e
+
+# Regenerates domainlists.go from the community-maintained lists of
+# disposable and free mail domains. The role account list is maintained by
+# hand in classify.go.
+
+wget -O disposable.txt https://raw.githubusercontent.com/disposable-email-domains/disposable-email-domains/master/disposable_email_blocklist.conf
+wget -O freemail.txt https://raw.githubusercontent.com/willwhite/freemail/master/data/free.txt
+
+OUT=domainlists.go
+
+list() {
+        sed -e 's/#.*//' -e 's/[[:space:]]//g' < $1 | \
+                tr '[A-Z]' '[a-z]' | \
+                grep -v '^$' | \
+                sort -u | \
+                awk '{print "\"" $1 "\"," }'
+}
+
+printf "package mail\n\n// Generated by generate-domainlists.sh. Do not edit.\n\n" > $OUT
+printf "var disposableDomains = []string{\n" >> $OUT
+list disposable.txt >> $OUT
+printf "}\n\nvar freeMailDomains = []string{\n" >> $OUT
+list freemail.txt >> $OUT
+echo "}" >> $OUT
+gofmt -w $OUT
+rm disposable.txt freemail.txt
@@ -0,0 +1,31 @@
+#!/bin/bash
+
+set -e
+
+# Regenerates normtables.go, the Unicode Character Database tables used by
+# NormalizeString(), from the version of the database named below.
+
+VERSION=14.0.0
+
+wget -O UnicodeData.txt https://www.unicode.org/Public/$VERSION/ucd/UnicodeData.txt
+wget -O CompositionExclusions.txt https://www.unicode.org/Public/$VERSION/ucd/CompositionExclusions.txt
+
+OUT=normtables.go
+
+printf "package mail\n\n// Generated by generate-normtables.sh from Unicode $VERSION. Do not edit.\n\n" > $OUT
+printf "var canonicalDecompositions = map[rune][]rune{\n" >> $OUT
+awk -F';' '$6 != "" && $6 !~ /^</ {
+        n = split($6, d, " ")
+        s = "0x" $1 ": {"
+        for (i = 1; i <= n; i++)
+                s = s (i > 1 ? ", " : "") "0x" d[i]
+        print s "},"
+}' < UnicodeData.txt >> $OUT
+printf "}\n\nvar combiningClasses = map[rune]uint8{\n" >> $OUT
+awk -F';' '$4 != 0 { print "0x" $1 ": " $4 "," }' < UnicodeData.txt >> $OUT
+printf "}\n\nvar compositionExclusions = map[rune]bool{\n" >> $OUT
+sed -e 's/#.*//' < CompositionExclusions.txt | \
+        awk 'NF { print "0x" $1 ": true," }' >> $OUT
+echo "}" >> $OUT
+gofmt -w $OUT
+rm UnicodeData.txt CompositionExclusions.txt
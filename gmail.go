@@ -0,0 +1,143 @@
+package mail
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	// Written by Google Takeout in mbox exports.
+	XGmailLabelsFieldName = "X-Gmail-Labels"
+	XGMThreadIDFieldName  = "X-Gm-Thrid"
+	XGMMessageIDFieldName = "X-Gm-Msgid"
+)
+
+// Returns the Gmail labels of this message, from the X-Gmail-Labels field
+// Google Takeout writes, e.g. ["Inbox", "Important", "Work, Projects"].
+// System labels are returned as Takeout names them ("Inbox", "Sent",
+// "Opened", "Category Updates" and so on). Returns nil if there is no such
+// field.
+func (h *Header) GmailLabels() []string {
+	f := h.field(XGmailLabelsFieldName, 0)
+	if f == nil {
+		return nil
+	}
+	return parseGmailLabels(f.Value())
+}
+
+// Replaces the X-Gmail-Labels field of this header with one listing
+// \a labels, or removes it if \a labels is empty.
+func (h *Header) SetGmailLabels(labels []string) {
+	h.RemoveAllNamed(XGmailLabelsFieldName)
+	if len(labels) > 0 {
+		h.Add(XGmailLabelsFieldName, FormatGmailLabels(labels))
+	}
+}
+
+// Returns the Gmail thread ID of this message, from the X-GM-THRID field, and
+// true, or 0 and false if there is no valid such field.
+func (h *Header) GmailThreadID() (uint64, bool) {
+	return parseGmailID(h.Get(XGMThreadIDFieldName))
+}
+
+// Returns the Gmail message ID of this message, from the X-GM-MSGID field,
+// and true, or 0 and false if there is no valid such field.
+func (h *Header) GmailMessageID() (uint64, bool) {
+	return parseGmailID(h.Get(XGMMessageIDFieldName))
+}
+
+// Parses the decimal Gmail ID \a s.
+func parseGmailID(s string) (uint64, bool) {
+	n, err := strconv.ParseUint(simplify(s), 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+// Parses the value of an X-Gmail-Labels field: a comma-separated list in
+// which labels containing commas or quotes are quoted.
+func parseGmailLabels(s string) []string {
+	r := []string{}
+	s = strings.TrimSpace(unfold(s))
+	i := 0
+	for i < len(s) {
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		label := ""
+		if i < len(s) && s[i] == '"' {
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(s) {
+				j++
+			}
+			label = unquote(s[i:j], '"', '\\')
+			i = j
+			for i < len(s) && s[i] != ',' {
+				i++
+			}
+		} else {
+			j := i
+			for j < len(s) && s[j] != ',' {
+				j++
+			}
+			label = strings.TrimSpace(s[i:j])
+			i = j
+		}
+		if label != "" {
+			r = append(r, label)
+		}
+		i++ // the comma
+	}
+	return r
+}
+
+// Returns \a labels formatted as the value of an X-Gmail-Labels field.
+func FormatGmailLabels(labels []string) string {
+	r := make([]string, 0, len(labels))
+	for _, l := range labels {
+		if strings.ContainsAny(l, ",\"") {
+			l = quote(l, '"', '\\')
+		}
+		r = append(r, l)
+	}
+	return strings.Join(r, ",")
+}
+
+// Returns \a s with CRLF and LF line breaks removed, as in unfolding a field
+// value.
+func unfold(s string) string {
+	return strings.NewReplacer("\r\n", "", "\n", "").Replace(s)
+}
+
+// Returns the message text \a rfc5322 with its X-Gmail-Labels field, if any,
+// replaced by one listing \a labels. The field is put first, where Takeout
+// puts it.
+func withGmailLabels(rfc5322 string, labels []string) string {
+	end := strings.Index(rfc5322, "\r\n\r\n")
+	if end < 0 {
+		end = len(rfc5322)
+	}
+	var lines []string
+	skipping := false
+	for _, l := range strings.SplitAfter(rfc5322[:end], "\r\n") {
+		if skipping && (strings.HasPrefix(l, " ") || strings.HasPrefix(l, "\t")) {
+			continue
+		}
+		skipping = strings.HasPrefix(strings.ToLower(l), "x-gmail-labels:")
+		if !skipping {
+			lines = append(lines, l)
+		}
+	}
+	r := strings.Join(lines, "")
+	if len(labels) > 0 {
+		r = XGmailLabelsFieldName + ": " + FormatGmailLabels(labels) + crlf + r
+	}
+	return r + rfc5322[end:]
+}
@@ -1,8 +1,18 @@
 module github.com/jimexcel/mail
 
-go 1.13
+go 1.22
 
 require (
 	github.com/jimexcel/excel v0.0.0-20200106031653-ad9c12657f03
+	github.com/klauspost/compress v1.18.0
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/paulrosania/go-charset v0.0.0-20190326053356-55c9d7a5834c
 )
+
+require (
+	github.com/360EntSecGroup-Skylar/excelize v1.4.1 // indirect
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/mohae/deepcopy v0.0.0-20170929034955-c48cc78d4826 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	github.com/stretchr/testify v1.2.3-0.20181224173747-660f15d67dbb // indirect
+)
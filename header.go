@@ -5,15 +5,25 @@ import (
 	"fmt"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"encoding/json"
 )
 
 type headerMode int
 
+// The most lines and bytes a header field value may have. Longer values
+// are cut, so that a header bomb, e.g. a References field of several
+// megabytes, cannot make the field parsers use unbounded time and memory.
+const (
+	maxFieldLines  = 1000
+	maxFieldLength = 128 * 1024
+)
+
 const (
 	RFC5322Header headerMode = iota
 	MIMEHeader
+	NNTPHeader
 )
 
 type defaultContentType int
@@ -34,6 +44,8 @@ type Header struct {
 
 	err      error
 	verified bool
+
+	diagnostics []Diagnostic
 }
 
 func (h *Header) MarshalJSON() ([]byte, error) {
@@ -67,11 +79,20 @@ func (h *Header) UnmarshalJSON(data []byte) error {
 }
 
 func ReadHeader(rfc5322 string, m headerMode) (h *Header, err error) {
+	return readHeader(rfc5322, m, Position{Line: 1})
+}
+
+// Reads a header like ReadHeader(), recording field positions relative to
+// \a base, the position of \a rfc5322 in the input.
+func readHeader(rfc5322 string, m headerMode, base Position) (h *Header, err error) {
 	h = &Header{mode: m}
 	done := false
 
 	i := 0
 	end := len(rfc5322)
+	pos := base
+	seen := 0
+	loneCR := false
 
 	for !done {
 		if i >= end {
@@ -83,48 +104,93 @@ func ReadHeader(rfc5322 string, m headerMode) (h *Header, err error) {
 			i += 3
 		}
 
+		// NULs and 8-bit bytes do not belong in field names, but
+		// stopping at them would end the header early
 		j := i
-		for j < end && rfc5322[j] >= 33 && rfc5322[j] <= 127 && rfc5322[j] != ':' {
+		for j < end && (rfc5322[j] >= 33 || rfc5322[j] == 0) && rfc5322[j] != ':' {
 			j++
 		}
 
-		if j == i+4 && m == RFC5322Header && strings.ToLower(rfc5322[i:j+1]) == "from " {
+		if j == i+4 && j < end && m != MIMEHeader && strings.ToLower(rfc5322[i:j+1]) == "from " {
 			for i < end && rfc5322[i] != '\r' && rfc5322[i] != '\n' {
 				i++
 			}
-			for rfc5322[i] == '\r' {
+			for i < end && rfc5322[i] == '\r' {
 				i++
 			}
-			if rfc5322[i] == '\n' {
+			if i < end && rfc5322[i] == '\n' {
 				i++
 			}
-		} else if j > i && rfc5322[j] == ':' {
+		} else if j > i && j < end && rfc5322[j] == ':' {
+			pos = pos.advance(rfc5322[seen:], i-seen)
+			seen = i
 			name := rfc5322[i:j]
 			i = j
 			i++
-			for rfc5322[i] == ' ' || rfc5322[i] == '\t' {
+			for i < end && (rfc5322[i] == ' ' || rfc5322[i] == '\t') {
 				i++
 			}
 			j = i
 
-			// Find the end of the value, including multiline values
+			// Find the end of the value, including multiline values.
+			// A CR which is not followed by LF ends a line too. Values
+			// with more than maxFieldLines lines or maxFieldLength
+			// bytes are cut at that point, but the rest of the field
+			// is still skipped.
 			// NOTE: Deviates from https://github.com/aox/aox/blob/master/message/message.cpp#L224
-			for j < end && (rfc5322[j] != '\n' || (j+1 < end && (rfc5322[j+1] == ' ' || rfc5322[j+1] == '\t'))) {
-				j++
+			lines := 1
+			cut := -1
+			cutLine := false
+			for j < end {
+				c := rfc5322[j]
+				if c == '\r' && (j+1 >= end || rfc5322[j+1] != '\n') {
+					loneCR = true
+				} else if c != '\n' {
+					if cut < 0 && j-i >= maxFieldLength {
+						cut = j
+					}
+					j++
+					continue
+				}
+				if j+1 < end && (rfc5322[j+1] == ' ' || rfc5322[j+1] == '\t') {
+					lines++
+					if cut < 0 && lines > maxFieldLines {
+						// cut at the end of a line, which needs no
+						// further trimming
+						cut = j
+						cutLine = true
+					}
+					j++
+					continue
+				}
+				break
 			}
 			if j > 0 && rfc5322[j-1] == '\r' {
 				j--
 			}
 			value := rfc5322[i:j]
+			if cutLine {
+				value = strings.TrimRight(rfc5322[i:cut], "\r")
+			} else if cut >= 0 {
+				value = truncateFieldValue(rfc5322[i:cut])
+			}
 			//233-237
 			if simplify(value) != "" || strings.HasPrefix(strings.ToLower(name), "x-") {
-				h.Add(name, value)
+				f := h.addSanitizedField(name, value, pos, rfc5322[seen:j])
+				if f != nil && cut >= 0 {
+					h.addDiagnostic(DiagnosticFieldTruncated, SeverityError, f,
+						"the value has %d lines and %d bytes; kept the first %d bytes",
+						lines, j-i, len(value))
+				}
 			}
+			// a header which ends at EOF has no line end to skip
 			i = j
 			if i+1 < end && rfc5322[i] == '\r' && rfc5322[i+1] == '\n' {
 				i++
 			}
-			i++
+			if i < end {
+				i++
+			}
 		} else {
 			done = true
 		}
@@ -133,11 +199,20 @@ func ReadHeader(rfc5322 string, m headerMode) (h *Header, err error) {
 	// PR: chomped second newline at header end
 	if i+1 < len(rfc5322) && rfc5322[i] == '\r' && rfc5322[i+1] == '\n' {
 		i += 2
-	} else if i < len(rfc5322) && rfc5322[i] == '\n' {
+	} else if i < len(rfc5322) && (rfc5322[i] == '\n' || rfc5322[i] == '\r') {
 		i++
 	}
 
 	h.numBytes = i
+	if loneCR {
+		h.addDiagnostic(DiagnosticLoneCR, SeverityWarning, nil,
+			"the header contains lines ending with CR alone, which were treated as line ends")
+	}
+
+	h.checkBidiControls()
+	if m != MIMEHeader {
+		h.checkDateSkew()
+	}
 
 	return h, nil
 }
@@ -149,10 +224,139 @@ func (h *Header) Valid() bool {
 	return h.err == nil
 }
 
+// Returns the reason why this Header is not valid, or nil if it is. The
+// error can be examined with errors.Is() and errors.As(); see ErrMissingFrom,
+// ErrTooManyFields and FieldError.
+func (h *Header) Error() error {
+	h.verify()
+	return h.err
+}
+
 // Add adds the key, value pair to the header. It appends to any existing
 // values associated with the key.
+//
+// The value is text, not part of a message, so it may not contain control
+// characters such as CR and LF, which could start another field. If it
+// does, the field is added without a value and marked invalid with a
+// *HeaderInjectionError, which Error() and Composer.Compose() return. The
+// one exception is folding, i.e. CRLF followed by a space or tab, as in the
+// value of a parsed field, which is unfolded.
 func (h *Header) Add(key, value string) {
-	h.addField(NewHeaderField(key, value))
+	value = unfoldValue(value)
+	if hasControl(value) {
+		f := NewHeaderFieldNamed(key)
+		f.SetUnparsedValue(value)
+		f.setError(&HeaderInjectionError{Field: f.Name(), Value: value})
+		// not merged with an earlier field, so that the error stays
+		h.Fields = append(h.Fields, f)
+		h.verified = false
+		return
+	}
+	h.addField(h.newField(key, value))
+}
+
+// Returns \a s with each CRLF which is followed by a space or tab removed,
+// as in unfolding a field value. Any other CR or LF is kept, so that
+// hasControl() finds it.
+func unfoldValue(s string) string {
+	if !strings.Contains(s, "\r\n") {
+		return s
+	}
+	var buf strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\r' && i+2 < len(s) && s[i+1] == '\n' && (s[i+2] == ' ' || s[i+2] == '\t') {
+			i++
+			continue
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// Returns a field named \a name with value \a value, as NewHeaderField()
+// does, except that in a netnews header the fields RFC 5536 defines are
+// checked by its rules. Mail may carry those fields too, and there they are
+// only text.
+func (h *Header) newField(name, value string) Field {
+	if h.mode == NNTPHeader {
+		if f := newNewsField(name, value); f != nil {
+			return f
+		}
+	}
+	return NewHeaderField(name, value)
+}
+
+// Adds a field named \a name with value \a value, whose text \a source was
+// read at \a pos, after replacing what a field cannot hold: NULs and bytes
+// which are not UTF-8 in the value become U+FFFD, CRs not followed by LF
+// become CRLF, and NULs and 8-bit bytes in the name are removed. Each kind
+// of replacement is recorded as a diagnostic. Returns the field, or nil if
+// nothing is left of its name.
+func (h *Header) addSanitizedField(name, value string, pos Position, source string) Field {
+	clean := name
+	if !isAscii(name) || strings.IndexByte(name, 0) >= 0 {
+		b := make([]byte, 0, len(name))
+		for i := 0; i < len(name); i++ {
+			if name[i] != 0 && name[i] < 128 {
+				b = append(b, name[i])
+			}
+		}
+		clean = string(b)
+		if clean == "" {
+			return nil
+		}
+	}
+	nul := strings.Count(value, "\x00")
+	if nul > 0 {
+		value = strings.Replace(value, "\x00", "\uFFFD", -1)
+	}
+	invalid := !utf8.ValidString(value)
+	if invalid {
+		value = strings.ToValidUTF8(value, "\uFFFD")
+	}
+	if strings.Count(value, "\r") != strings.Count(value, "\r\n") {
+		value = strings.Replace(value, "\r\n", "\n", -1)
+		value = strings.Replace(strings.Replace(value, "\r", "\n", -1), "\n", "\r\n", -1)
+	}
+
+	f := h.newField(clean, value)
+	f.setSource(pos, source)
+	h.addField(f)
+	if clean != name {
+		h.addDiagnostic(DiagnosticInvalidFieldName, SeverityError, f,
+			"removed NULs or 8-bit bytes from the field name %q", name)
+	}
+	if nul > 0 {
+		h.addDiagnostic(DiagnosticNULByte, SeverityError, f,
+			"replaced %d NUL byte(s) with U+FFFD", nul)
+	}
+	if invalid {
+		h.addDiagnostic(DiagnosticInvalidUTF8, SeverityError, f,
+			"the value contains 8-bit bytes which are not UTF-8; replaced them with U+FFFD")
+	}
+	return f
+}
+
+// Returns \a v, the start of a field value which was cut in the middle of a
+// line because it is too long, without that partial line, or if it has only
+// one line, without its last partial word or character.
+func truncateFieldValue(v string) string {
+	v = strings.TrimRight(v, "\r")
+	if i := strings.LastIndexByte(v, '\n'); i > 0 {
+		return strings.TrimRight(v[:i], "\r")
+	}
+	if i := strings.LastIndexAny(v, " \t"); i > len(v)/2 {
+		return v[:i]
+	}
+	// do not leave half a UTF-8 sequence
+	i := len(v) - 1
+	for i > 0 && !utf8.RuneStart(v[i]) {
+		i--
+	}
+	if i >= 0 && !utf8.FullRuneInString(v[i:]) {
+		return v[:i]
+	}
+	return v
 }
 
 func (h *Header) addField(f Field) {
@@ -165,14 +369,85 @@ func (h *Header) addField(f Field) {
 			for _, a := range next.Addresses {
 				first.Addresses = append(first.Addresses, a)
 			}
+			// the merged field no longer looks like either source
+			first.source = ""
 			return
 		}
 	}
-	// TODO: aox implementation allows insertion at specified position
 	h.Fields = append(h.Fields, f)
 	h.verified = false
 }
 
+// Returns the number of fields in this header.
+func (h *Header) Len() int {
+	return len(h.Fields)
+}
+
+// Returns the field at index \a i, counting from 0, or nil if there is no
+// such field.
+func (h *Header) At(i int) Field {
+	if i < 0 || i >= len(h.Fields) {
+		return nil
+	}
+	return h.Fields[i]
+}
+
+// Calls \a fn with each field in turn, in the order they appear in the
+// header, until it returns false. \a fn may add, insert or remove fields;
+// the fields visited are those the header had when Each() was called.
+//
+// Each has the form of an iter.Seq[Field], so with Go 1.23 or later a
+// header can be ranged over with "for f := range h.Each".
+func (h *Header) Each(fn func(Field) bool) {
+	fields := make([]Field, len(h.Fields))
+	copy(fields, h.Fields)
+	for _, f := range fields {
+		if !fn(f) {
+			return
+		}
+	}
+}
+
+// Inserts \a f at index \a i, counting from 0, moving the field there and
+// those after it down. If \a i is out of range, \a f is appended. Unlike
+// Add(), InsertAt() never merges address fields, since the caller has said
+// where the field belongs.
+func (h *Header) InsertAt(i int, f Field) {
+	if i < 0 || i >= len(h.Fields) {
+		h.Fields = append(h.Fields, f)
+	} else {
+		h.Fields = append(h.Fields, nil)
+		copy(h.Fields[i+1:], h.Fields[i:])
+		h.Fields[i] = f
+	}
+	h.verified = false
+}
+
+// Inserts \a f before the first field named \a name, or at the start of
+// the header if there is none, e.g. to add a Received field above the
+// others.
+func (h *Header) InsertBefore(name string, f Field) {
+	for i, hf := range h.Fields {
+		if strings.EqualFold(hf.Name(), name) {
+			h.InsertAt(i, f)
+			return
+		}
+	}
+	h.InsertAt(0, f)
+}
+
+// Inserts \a f after the last field named \a name, or at the end of the
+// header if there is none.
+func (h *Header) InsertAfter(name string, f Field) {
+	for i := len(h.Fields) - 1; i >= 0; i-- {
+		if strings.EqualFold(h.Fields[i].Name(), name) {
+			h.InsertAt(i+1, f)
+			return
+		}
+	}
+	h.InsertAt(len(h.Fields), f)
+}
+
 func (h *Header) RemoveAt(i int) {
 	h.Fields = append(h.Fields[:i], h.Fields[i+1:]...)
 }
@@ -187,9 +462,8 @@ func (h *Header) Remove(r Field) {
 
 func (h *Header) RemoveAllNamed(name string) {
 	i := 0
-	name = strings.ToLower(name)
 	for i < len(h.Fields) {
-		if strings.ToLower(h.Fields[i].Name()) == name {
+		if strings.EqualFold(h.Fields[i].Name(), name) {
 			h.RemoveAt(i)
 		} else {
 			i++
@@ -198,7 +472,8 @@ func (h *Header) RemoveAllNamed(name string) {
 }
 
 // Get gets the first value associated with the given key. If there are no
-// values associated with the key, Get returns "".
+// values associated with the key, Get returns "". The key is compared
+// case-insensitively, so "content-type" finds the Content-Type field.
 func (h *Header) Get(key string) string {
 	f := h.field(key, 0)
 	if f == nil {
@@ -210,7 +485,7 @@ func (h *Header) Get(key string) string {
 
 func (h *Header) field(fn string, n int) Field {
 	for _, field := range h.Fields {
-		if field.Name() == fn {
+		if strings.EqualFold(field.Name(), fn) {
 			if n > 0 {
 				n--
 			} else {
@@ -222,6 +497,23 @@ func (h *Header) field(fn string, n int) Field {
 	return nil
 }
 
+// Returns every field named \a name, in the order they appear in the header,
+// or an empty slice if there are none. Names are compared as in Get().
+//
+// This suits fields which often occur more than once, such as Received,
+// the ARC fields and many X- fields; it looks at each field only once,
+// while calling field() with increasing indexes looks at the first fields
+// over and over.
+func (h *Header) All(name string) []Field {
+	r := []Field{}
+	for _, f := range h.Fields {
+		if strings.EqualFold(f.Name(), name) {
+			r = append(r, f)
+		}
+	}
+	return r
+}
+
 // Returns a pointer to the address field of type \a t at index \a n in this
 // header, or a null pointer if no such field exists.
 func (h *Header) addressField(fn string, n int) *AddressField {
@@ -240,7 +532,7 @@ func (h *Header) addressField(fn string, n int) *AddressField {
 // also be orig-date or resent-date. If there is no such field or \a t is
 // meaningless, date() returns a null pointer.
 func (h *Header) Date() *time.Time {
-	hf := h.field(DateFieldName, 0).(*DateField)
+	hf, _ := h.field(DateFieldName, 0).(*DateField)
 	if hf == nil {
 		return nil
 	}
@@ -377,6 +669,18 @@ var conditions = []HeaderFieldCondition{
 	HeaderFieldCondition{ContentTransferEncodingFieldName, 0, 1, RFC5322Header},
 	HeaderFieldCondition{ContentTransferEncodingFieldName, 0, 1, MIMEHeader},
 	HeaderFieldCondition{ReturnPathFieldName, 0, 1, RFC5322Header},
+	HeaderFieldCondition{FromFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{DateFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{MessageIDFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{NewsgroupsFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{PathFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{SubjectFieldName, 1, 1, NNTPHeader},
+	HeaderFieldCondition{FollowupToFieldName, 0, 1, NNTPHeader},
+	HeaderFieldCondition{XrefFieldName, 0, 1, NNTPHeader},
+	HeaderFieldCondition{ReferencesFieldName, 0, 1, NNTPHeader},
+	HeaderFieldCondition{MIMEVersionFieldName, 0, 1, NNTPHeader},
+	HeaderFieldCondition{ContentTypeFieldName, 0, 1, NNTPHeader},
+	HeaderFieldCondition{ContentTransferEncodingFieldName, 0, 1, NNTPHeader},
 }
 
 // This private function verifies that the entire header is consistent and
@@ -390,7 +694,7 @@ func (h *Header) verify() {
 
 	for _, f := range h.Fields {
 		if !f.Valid() {
-			h.err = fmt.Errorf("%s: %s", f.Name(), f.Error())
+			h.err = &FieldError{Name: f.Name(), Err: f.Error()}
 			return
 		}
 	}
@@ -406,11 +710,17 @@ func (h *Header) verify() {
 			occurrences[conditions[i].name] < conditions[i].min ||
 			occurrences[conditions[i].name] > conditions[i].max {
 			if conditions[i].max < occurrences[conditions[i].name] {
-				h.err = fmt.Errorf("%d %s fields seen. At most %d may be present.",
-					occurrences[conditions[i].name], conditions[i].name, conditions[i].max)
+				h.err = &ErrTooManyFields{
+					Name:  conditions[i].name,
+					Count: occurrences[conditions[i].name],
+					Max:   conditions[i].max,
+				}
 			} else {
-				h.err = fmt.Errorf("%d %s fields seen. At least %d must be present.",
-					occurrences[conditions[i].name], conditions[i].name, conditions[i].min)
+				h.err = &ErrTooFewFields{
+					Name:  conditions[i].name,
+					Count: occurrences[conditions[i].name],
+					Min:   conditions[i].min,
+				}
 			}
 		}
 		i++
@@ -727,7 +1037,7 @@ func (h *Header) Repair() {
 	// that error.
 	if occurrences[ContentTransferEncodingFieldName] > 0 {
 		ct := h.ContentType()
-		if ct != nil && ct.Type == "multipart" || ct.Type == "message" {
+		if ct != nil && (ct.Type == "multipart" || ct.Type == "message") {
 			h.RemoveAllNamed(ContentTransferEncodingFieldName)
 		}
 	}
@@ -1279,9 +1589,7 @@ func (h *Header) RepairWithBody(p *Part, body string) {
 		good := []*ContentType{}
 		bad := []*ContentType{}
 		neutral := []*ContentType{}
-		i := 0
-		hf := h.field(ContentTypeFieldName, 0)
-		for hf != nil {
+		for _, hf := range h.All(ContentTypeFieldName) {
 			ct := hf.(*ContentType)
 			if !hf.Valid() {
 				bad = append(bad, ct)
@@ -1310,8 +1618,6 @@ func (h *Header) RepairWithBody(p *Part, body string) {
 			} else {
 				neutral = append(neutral, ct)
 			}
-			i++
-			hf = h.field(ContentTypeFieldName, i)
 		}
 		if len(good) > 0 {
 			h.RemoveAllNamed(ContentTypeFieldName)
@@ -1378,7 +1684,7 @@ func (h *Header) RepairWithBody(p *Part, body string) {
 		h.ContentType().parameter("report-type") == "delivery-status" {
 		ct := h.ContentType()
 		tmp := &Part{}
-		tmp.parseMultipart(body, ct.parameter("boundary"), false)
+		tmp.parseMultipart(body, ct.parameter("boundary"), false, Position{})
 		for _, p := range tmp.Parts {
 			h := p.Header
 			var ct *ContentType
@@ -1,10 +1,16 @@
 package mail_test
 
 import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"regexp"
+	"strings"
 	"testing"
 	"time"
+	"unicode/utf8"
 
 	"io/ioutil"
 
@@ -213,6 +219,47 @@ func TestEncodedWords(t *testing.T) {
 	}
 }
 
+// In a Q-encoded word, "_" stands for a space (RFC 2047 section 4.2).
+func TestQEncodedUnderscore(t *testing.T) {
+	m, _ := mail.ReadMessage("From: =?us-ascii?q?Andre_Pirard?= <pirard@example.com>\r\n" +
+		"Subject: =?utf-8?q?Caf=C3=A9_au_lait?=\r\n\r\nHi\r\n")
+	testStringEquals(t, "subject", m.Header.Subject(), "Café au lait")
+	from := m.Header.Addresses("From")
+	if len(from) != 1 {
+		t.Fatalf("unexpected From: %v", from)
+	}
+	testStringEquals(t, "display name", from[0].Name(false), "Andre Pirard")
+}
+
+// Non-ASCII text is encoded as UTF-8 encoded-words, and words too long for
+// one are split between characters, so that each decodes on its own.
+func TestEncodeWords(t *testing.T) {
+	m, _ := mail.ReadMessage("From: alice@example.com\r\nSubject: =?utf-8?q?Caf=C3=A9?=\r\n\r\nHi\r\n")
+	if !strings.Contains(m.RFC822(true), "Subject: =?utf-8?q?Caf=C3=A9?=\r\n") {
+		t.Errorf("short word not Q-encoded:\n%s", m.RFC822(true))
+	}
+
+	long := strings.Repeat("Привет", 12)
+	m, _ = mail.ReadMessage("From: alice@example.com\r\nSubject: =?utf-8?b?" +
+		base64.StdEncoding.EncodeToString([]byte(long)) + "?=\r\n\r\nHi\r\n")
+	text := m.RFC822(true)
+	words := regexp.MustCompile(`=\?utf-8\?b\?([^?]*)\?=`).FindAllStringSubmatch(text, -1)
+	if len(words) < 2 {
+		t.Fatalf("long word not split:\n%s", text)
+	}
+	for _, w := range words {
+		if len(w[0]) > 75 {
+			t.Errorf("encoded-word longer than 75 characters: %s", w[0])
+		}
+		b, err := base64.StdEncoding.DecodeString(w[1])
+		if err != nil || !utf8.Valid(b) {
+			t.Errorf("encoded-word does not hold whole characters: %s", w[0])
+		}
+	}
+	reparsed, _ := mail.ReadMessage(text)
+	testStringEquals(t, "long subject", reparsed.Header.Subject(), long)
+}
+
 func TestMessageID(t *testing.T) {
 	msg := loadFixture(t, "message-id")
 
@@ -234,3 +281,365 @@ func TestMessageID(t *testing.T) {
 	testStringEquals(t, "Part 1 Content-ID", parts[0].Header.Get("Content-ID"), "<invalid-id-with-no-brackets>")
 	testStringEquals(t, "Part 2 Content-ID", parts[1].Header.Get("Content-ID"), "<valid-id@example>")
 }
+
+func TestHeaderErrors(t *testing.T) {
+	h, err := mail.ReadHeader("To: a@example.com\r\nDate: Fri, 20 Mar 2015 19:53:37 +0000\r\n\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(h.Error(), mail.ErrMissingFrom) {
+		t.Errorf("expected ErrMissingFrom, got %v", h.Error())
+	}
+
+	h, err = mail.ReadHeader("From: a@example.com\r\nDate: Fri, 20 Mar 2015 19:53:37 +0000\r\n"+
+		"Subject: one\r\nSubject: two\r\n\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tooMany *mail.ErrTooManyFields
+	if !errors.As(h.Error(), &tooMany) {
+		t.Fatalf("expected ErrTooManyFields, got %v", h.Error())
+	}
+	testStringEquals(t, "field name", tooMany.Name, "Subject")
+	testIntegerEquals(t, "field count", tooMany.Count, 2)
+
+	h, err = mail.ReadHeader("Content-Transfer-Encoding: bogus\r\n\r\n", mail.MIMEHeader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !errors.Is(h.Error(), mail.ErrBadEncoding) {
+		t.Errorf("expected ErrBadEncoding, got %v", h.Error())
+	}
+}
+
+func TestFieldPositions(t *testing.T) {
+	raw, err := ioutil.ReadFile("fixtures/multipart.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := loadFixture(t, "multipart")
+
+	// the image's Content-ID field, in the second part
+	f := msg.Parts[1].Header.Fields[3]
+	testStringEquals(t, "field name", f.Name(), "Content-ID")
+	pos := f.Position()
+	testIntegerEquals(t, "line", pos.Line, 33)
+	if !strings.HasPrefix(string(raw[pos.Offset:]), "Content-ID:") {
+		t.Errorf("offset %d does not point to the field", pos.Offset)
+	}
+}
+
+func TestCanonicalized(t *testing.T) {
+	h, err := mail.ReadHeader("A: X\r\nB:  Y\t\r\n\tZ  \r\nA: second\r\n\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{"a", "A", "b", "c"}
+	testStringEquals(t, "relaxed canonicalization", h.Canonicalized(names, true),
+		"a:second\r\na:X\r\nb:Y Z\r\n")
+	testStringEquals(t, "simple canonicalization", h.Canonicalized(names, false),
+		"A: second\r\nA: X\r\nB:  Y\t\r\n\tZ  \r\n")
+}
+
+func TestDateSkew(t *testing.T) {
+	msg, err := mail.ReadMessage("Received: from a.example.com by b.example.com;\r\n" +
+		" Tue, 3 Jan 2006 12:00:00 +0000\r\n" +
+		"Received: from c.example.com by a.example.com; Tue, 3 Jan 2006 11:00:00 +0000\r\n" +
+		"From: a@example.com\r\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"\r\n" +
+		"Hello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	skew, ok := msg.Header.DateSkew()
+	if !ok || skew != -(12*time.Hour+55*time.Minute+55*time.Second) {
+		t.Errorf("unexpected skew %v %v", skew, ok)
+	}
+	testIntegerEquals(t, "diagnostics", len(msg.Diagnostics()), 0)
+
+	msg, err = mail.ReadMessage("Received: from c.example.com by a.example.com; Tue, 3 Jan 2006 11:00:00 +0000\r\n" +
+		"From: a@example.com\r\n" +
+		"Date: Fri, 6 Jan 2006 15:04:05 -0700\r\n" +
+		"\r\n" +
+		"Hello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := msg.Diagnostics()
+	if len(d) != 1 {
+		t.Fatalf("expected one diagnostic, got %v", d)
+	}
+	testStringEquals(t, "code", d[0].Code, mail.DiagnosticDateSkew)
+	testStringEquals(t, "field", d[0].Field, "Date")
+	testIntegerEquals(t, "line", d[0].Position.Line, 3)
+}
+
+func TestHeaderGarbage(t *testing.T) {
+	codes := func(m *mail.Message) string {
+		r := []string{}
+		for _, d := range m.Diagnostics() {
+			r = append(r, d.Field+":"+d.Code)
+		}
+		return strings.Join(r, " ")
+	}
+
+	m, err := mail.ReadMessage("From: alice@example.com\r\nSubject: Gr\xfc\xdfe\x00!\r\n" +
+		"X-F\x00o\xe9o: bar\r\nTo: bob@example.com\r\n\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "subject", m.Header.Subject(), "Gr�e�!")
+	testStringEquals(t, "field name", m.Header.Get("X-Foo"), "bar")
+	testStringEquals(t, "to", m.Header.Get(mail.ToFieldName), "bob@example.com")
+	testStringEquals(t, "body", m.Text, "Body\r\n")
+	testStringEquals(t, "diagnostics", codes(m),
+		"Subject:nul-byte Subject:invalid-utf8 X-Foo:invalid-field-name")
+
+	m, err = mail.ReadMessage("From: alice@example.com\rSubject: Folded\r  subject\r" +
+		"To: bob@example.com\r\rBody\r")
+	if err != nil {
+		t.Fatal(err)
+	}
+	crlf, _ := mail.ReadMessage("Subject: Folded\r\n  subject\r\n\r\n")
+	testStringEquals(t, "subject", m.Header.Subject(), crlf.Header.Subject())
+	testStringEquals(t, "to", m.Header.Get(mail.ToFieldName), "bob@example.com")
+	testStringEquals(t, "diagnostics", codes(m), ":lone-cr")
+}
+
+func TestHeaderBomb(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("From: alice@example.com\r\nReferences: <0@example.com>")
+	for i := 1; i < 100000; i++ {
+		fmt.Fprintf(&b, "\r\n <%d@example.com>", i)
+	}
+	b.WriteString("\r\nX-Long: " + strings.Repeat("x", 200*1024) + "\r\n")
+	b.WriteString("Subject: After the bombs\r\n\r\nBody\r\n")
+
+	start := time.Now()
+	m, err := mail.ReadMessage(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(start); d > 10*time.Second {
+		t.Errorf("parsing took %v", d)
+	}
+	testStringEquals(t, "subject", m.Header.Subject(), "After the bombs")
+	testStringEquals(t, "body", m.Text, "Body\r\n")
+	refs := m.Header.Get(mail.ReferencesFieldName)
+	testIntegerEquals(t, "references", len(strings.Fields(refs)), 1000)
+	if !strings.HasSuffix(refs, "<999@example.com>") {
+		t.Errorf("unexpected end of References: %q", refs[len(refs)-40:])
+	}
+	testIntegerEquals(t, "long value", len(m.Header.Get("X-Long")), 128*1024)
+	truncated := []string{}
+	for _, d := range m.Diagnostics() {
+		if d.Code == mail.DiagnosticFieldTruncated {
+			truncated = append(truncated, d.Field)
+		}
+	}
+	testStringEquals(t, "truncated", strings.Join(truncated, " "), "References X-Long")
+}
+
+func TestHeaderAll(t *testing.T) {
+	m, err := mail.ReadMessage("Received: from a by b\r\n" +
+		"From: x@example.com\r\n" +
+		"X-Tag: one\r\n" +
+		"Received: from c by d\r\n" +
+		"X-Tag: two\r\n" +
+		"Received: from e by f\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	received := []string{}
+	for _, f := range m.Header.All(mail.ReceivedFieldName) {
+		received = append(received, f.Value())
+	}
+	testStringEquals(t, "received", strings.Join(received, "|"),
+		"from a by b|from c by d|from e by f")
+	tags := []string{}
+	for _, f := range m.Header.All("X-Tag") {
+		tags = append(tags, f.Value())
+	}
+	testStringEquals(t, "x-tag", strings.Join(tags, "|"), "one|two")
+	if r := m.Header.All("X-Missing"); r == nil || len(r) != 0 {
+		t.Errorf("expected an empty slice, got %v", r)
+	}
+}
+
+func TestHeaderCase(t *testing.T) {
+	m, err := mail.ReadMessage("from: x@example.com\r\n" +
+		"SUBJECT: Shouting\r\n" +
+		"content-type: text/html\r\n" +
+		"x-custom-header: one\r\n" +
+		"X-CUSTOM-HEADER: two\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "get", m.Header.Get("Subject"), "Shouting")
+	testStringEquals(t, "get lower", m.Header.Get("subject"), "Shouting")
+	testStringEquals(t, "get upper", m.Header.Get("CONTENT-TYPE"), "text/html")
+	testIntegerEquals(t, "all", len(m.Header.All("X-Custom-Header")), 2)
+
+	f := m.Header.All("content-type")[0]
+	testStringEquals(t, "name", f.Name(), mail.ContentTypeFieldName)
+	testStringEquals(t, "raw name", f.RawName(), "content-type")
+	testStringEquals(t, "new field", mail.NewHeaderFieldNamed("message-id").Name(),
+		mail.MessageIDFieldName)
+	testStringEquals(t, "new raw name", mail.NewHeaderFieldNamed("x-foo").RawName(), "X-Foo")
+
+	out := m.RFC822(false)
+	if !strings.Contains(out, "\r\nSubject: Shouting\r\n") ||
+		!strings.Contains(out, "\r\nX-Custom-Header: two\r\n") {
+		t.Errorf("field names were not canonicalized:\n%s", out)
+	}
+
+	m.Header.RemoveAllNamed("x-CUSTOM-header")
+	testIntegerEquals(t, "removed", len(m.Header.All("X-Custom-Header")), 0)
+}
+
+func TestHeaderCaseStandardSpellings(t *testing.T) {
+	m, err := mail.ReadMessage("ARC-Seal: i=1; a=rsa-sha256; cv=none\r\n" +
+		"arc-message-signature: i=1; a=rsa-sha256\r\n" +
+		"DKIM-SIGNATURE: v=1; a=rsa-sha256\r\n" +
+		"Received-Spf: pass\r\n" +
+		"From: x@example.com\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := m.RFC822(false)
+	for _, name := range []string{"ARC-Seal", "ARC-Message-Signature", "DKIM-Signature", "Received-SPF"} {
+		if !strings.Contains(out, name+": ") {
+			t.Errorf("%s was not kept:\n%s", name, out)
+		}
+	}
+}
+
+func TestHeaderJSONFolded(t *testing.T) {
+	m, err := mail.ReadMessage("Received: from a.example.com\r\n" +
+		"\tby b.example.com; Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(m.Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := &mail.Header{}
+	if err := json.Unmarshal(b, h); err != nil {
+		t.Fatal(err)
+	}
+	if !h.Valid() {
+		t.Errorf("round-tripped header is invalid: %v", h.Error())
+	}
+	testStringEquals(t, "Received", h.Get("Received"),
+		"from a.example.com\tby b.example.com; Mon, 5 Oct 2026 10:00:00 +0000")
+
+	h.Add("X-Folded", "a\r\nb")
+	if !errors.Is(h.Error(), mail.ErrHeaderInjection) {
+		t.Errorf("CRLF without folding was accepted: %v", h.Error())
+	}
+}
+
+func TestHeaderIteration(t *testing.T) {
+	m, err := mail.ReadMessage("Received: from b by c\r\n" +
+		"Received: from a by b\r\n" +
+		"From: x@example.com\r\n" +
+		"Subject: Iteration\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := m.Header
+	names := func() string {
+		r := []string{}
+		h.Each(func(f mail.Field) bool {
+			r = append(r, f.Name())
+			return true
+		})
+		return strings.Join(r, " ")
+	}
+	testStringEquals(t, "each", names(), "Received Received From Subject Date")
+
+	visited := 0
+	h.Each(func(f mail.Field) bool {
+		visited++
+		return f.Name() != mail.FromFieldName
+	})
+	testIntegerEquals(t, "stopped", visited, 3)
+
+	h.InsertBefore(mail.ReceivedFieldName, mail.NewHeaderField("Received", "from c by d"))
+	h.InsertAfter(mail.ReceivedFieldName, mail.NewHeaderField("X-Gateway", "checked"))
+	h.InsertAfter("X-Missing", mail.NewHeaderField("X-Last", "end"))
+	h.InsertBefore("X-Missing", mail.NewHeaderField("X-First", "start"))
+	testStringEquals(t, "inserted", names(),
+		"X-First Received Received Received X-Gateway From Subject Date X-Last")
+	testStringEquals(t, "first received", h.At(1).Value(), "from c by d")
+	testIntegerEquals(t, "len", h.Len(), 9)
+	if h.At(9) != nil || h.At(-1) != nil {
+		t.Error("At() returned a field out of range")
+	}
+
+	h.Each(func(f mail.Field) bool {
+		if strings.HasPrefix(f.Name(), "X-") {
+			h.Remove(f)
+		}
+		return true
+	})
+	testStringEquals(t, "removed", names(), "Received Received Received From Subject Date")
+}
+
+func TestMIMEVersion(t *testing.T) {
+	cases := []struct {
+		input, value, comment string
+	}{
+		{"1.0", "1.0", ""},
+		{"1.0\n", "1.0", ""},
+		{" 1.0 (produced by Example Mailer 2.1)", "1.0 (produced by Example Mailer 2.1)",
+			"produced by Example Mailer 2.1"},
+		{"(Generated) 1.0 (by (nested) tool)", "1.0 (by \\(nested\\) tool)", "by (nested) tool"},
+		{"1.00", "1.0", ""},
+		{"2.0", "1.0 (Note: Original mime-version had syntax problems)",
+			"Note: Original mime-version had syntax problems"},
+		{"1.0 trailing", "1.0 (Note: Original mime-version had syntax problems)",
+			"Note: Original mime-version had syntax problems"},
+	}
+	for _, c := range cases {
+		f, ok := mail.NewHeaderField(mail.MIMEVersionFieldName, c.input).(*mail.MIMEVersionField)
+		if !ok {
+			t.Fatalf("%q did not yield a MIMEVersionField", c.input)
+		}
+		testStringEquals(t, "value of "+c.input, f.Value(), c.value)
+		testStringEquals(t, "comment of "+c.input, f.Comment, c.comment)
+		again := mail.NewHeaderField(mail.MIMEVersionFieldName, f.Value()).(*mail.MIMEVersionField)
+		testStringEquals(t, "round trip of "+c.input, again.Value(), f.Value())
+		testStringEquals(t, "round trip comment of "+c.input, again.Comment, f.Comment)
+	}
+
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: text/html\r\n" +
+		"MIME-Version: 1.0 (again)\r\n" +
+		"\r\n<p>Body\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mv := m.Header.All(mail.MIMEVersionFieldName)
+	testIntegerEquals(t, "fields", len(mv), 1)
+	repaired := mv[0].Value()
+	testStringEquals(t, "repaired", repaired,
+		"1.0 (Note: original message contained 2 MIME-Version fields)")
+	again, err := mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "reread", again.Header.Get(mail.MIMEVersionFieldName), repaired)
+}
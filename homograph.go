@@ -0,0 +1,306 @@
+package mail
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Characters which look like ASCII letters or digits, and the ASCII they
+// look like. This is the part of the Unicode confusables table (UTS #39,
+// confusables.txt) which matters for spoofing addresses written in ASCII;
+// fullwidth forms are handled separately.
+var asciiConfusables = map[rune]string{
+	// Cyrillic
+	'а': "a", 'в': "b", 'е': "e", 'ё': "e", 'һ': "h", 'і': "i", 'ї': "i",
+	'ј': "j", 'к': "k", 'ӏ': "l", 'м': "m", 'н': "h", 'о': "o", 'р': "p",
+	'ԛ': "q", 'г': "r", 'ѕ': "s", 'т': "t", 'ц': "u", 'у': "y", 'ԝ': "w",
+	'х': "x", 'ԁ': "d", 'ь': "b", 'п': "n", 'з': "3", 'ч': "4",
+	'А': "A", 'В': "B", 'Е': "E", 'Н': "H", 'І': "I", 'Ј': "J", 'К': "K",
+	'М': "M", 'О': "O", 'Р': "P", 'С': "C", 'Ѕ': "S", 'Т': "T", 'Х': "X",
+	'У': "Y", 'Ԛ': "Q", 'Ԝ': "W", 'с': "c",
+	// Greek
+	'α': "a", 'β': "b", 'ε': "e", 'ι': "i", 'κ': "k", 'ν': "v", 'ο': "o",
+	'ρ': "p", 'τ': "t", 'υ': "u", 'χ': "x", 'γ': "y", 'ω': "w",
+	'Α': "A", 'Β': "B", 'Ε': "E", 'Ζ': "Z", 'Η': "H", 'Ι': "I", 'Κ': "K",
+	'Μ': "M", 'Ν': "N", 'Ο': "O", 'Ρ': "P", 'Τ': "T", 'Υ': "Y", 'Χ': "X",
+	// Armenian
+	'օ': "o", 'ս': "u", 'ց': "g", 'ո': "n", 'հ': "h", 'զ': "q",
+	// Latin letters which look like others
+	'ı': "i", 'ȷ': "j", 'ɑ': "a", 'ɡ': "g", 'ɩ': "i", 'ɪ': "i", 'ʟ': "l",
+	'ℓ': "l", 'ſ': "f", 'ƅ': "b", 'ɢ': "g", 'ᴅ': "d", 'ᴏ': "o", 'ᴜ': "u",
+	'ᴠ': "v", 'ᴡ': "w", 'ᴢ': "z",
+	// digits and symbols
+	'ǀ': "l", '∣': "l", '׀': "l", '।': "l",
+	'Ɩ': "l", '٠': ".", '۰': ".", '‐': "-", '‑': "-", '‒': "-",
+	'–': "-", '﹘': "-", '−': "-", '․': ".", '。': ".", '．': ".",
+}
+
+// Returns the ASCII \a r looks like, or an empty string if it does not look
+// like ASCII (or is ASCII).
+func confusableASCII(r rune) string {
+	if r >= 0xff01 && r <= 0xff5e {
+		// fullwidth forms of ASCII
+		return string(r - 0xff01 + '!')
+	}
+	return asciiConfusables[r]
+}
+
+// Returns the skeleton of \a s: \a s with each character which looks like
+// ASCII replaced by that ASCII, and lower-cased. Two strings with the same
+// skeleton are likely to be mistaken for each other.
+func skeleton(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		if a := confusableASCII(r); a != "" {
+			b.WriteString(a)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return strings.ToLower(b.String())
+}
+
+// Scripts in the order they are checked, most common first. Other scripts
+// are found by searching unicode.Scripts.
+var commonScripts = []string{
+	"Latin", "Cyrillic", "Greek", "Han", "Hiragana", "Katakana", "Hangul",
+	"Arabic", "Hebrew", "Armenian", "Thai", "Devanagari", "Georgian",
+}
+
+var otherScripts []string
+
+func init() {
+	common := map[string]bool{"Common": true, "Inherited": true}
+	for _, s := range commonScripts {
+		common[s] = true
+	}
+	for s := range unicode.Scripts {
+		if !common[s] {
+			otherScripts = append(otherScripts, s)
+		}
+	}
+	sort.Strings(otherScripts)
+}
+
+// Returns the name of the script \a r belongs to, or an empty string if it
+// is used with all scripts (as digits and punctuation are).
+func scriptOf(r rune) string {
+	if r < 0x80 {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' {
+			return "Latin"
+		}
+		return ""
+	}
+	if unicode.In(r, unicode.Common, unicode.Inherited) {
+		return ""
+	}
+	for _, s := range commonScripts {
+		if unicode.Is(unicode.Scripts[s], r) {
+			return s
+		}
+	}
+	for _, s := range otherScripts {
+		if unicode.Is(unicode.Scripts[s], r) {
+			return s
+		}
+	}
+	return ""
+}
+
+// Combinations of scripts which are normally written together (UTS #39
+// section 5.1, "Highly Restrictive"), keyed by the sorted script names.
+var allowedScriptMixes = map[string]bool{
+	"Han,Hiragana,Katakana,Latin": true,
+	"Han,Hiragana,Latin":          true,
+	"Han,Katakana,Latin":          true,
+	"Hiragana,Katakana,Latin":     true,
+	"Han,Latin":                   true,
+	"Hiragana,Latin":              true,
+	"Katakana,Latin":              true,
+	"Hangul,Latin":                true,
+	"Han,Hangul,Latin":            true,
+	"Bopomofo,Han,Latin":          true,
+	"Bopomofo,Latin":              true,
+	"Han,Hiragana,Katakana":       true,
+	"Han,Hiragana":                true,
+	"Han,Katakana":                true,
+	"Hiragana,Katakana":           true,
+	"Han,Hangul":                  true,
+	"Bopomofo,Han":                true,
+}
+
+// A Homograph describes why an address looks like a spoofing attempt.
+//
+// Part is "localpart" or "domain", and Label the part, or for domains the
+// label, which is suspicious, with any punycode decoded. Skeleton is what
+// the whole local part or domain looks like, e.g. "paypal.com" for
+// "pаypal.com" with a Cyrillic а. Scripts lists the scripts used in Label.
+//
+// Reason is "mixed-script" if Label mixes scripts which are not normally
+// written together, "whole-script" if it is written in a single non-Latin
+// script but looks entirely like ASCII, or "confusable" if it is Latin but
+// contains characters which look like other ASCII letters.
+type Homograph struct {
+	Part     string   `json:"part"`
+	Label    string   `json:"label"`
+	Skeleton string   `json:"skeleton"`
+	Scripts  []string `json:"scripts"`
+	Reason   string   `json:"reason"`
+}
+
+// Returns a description of why this address may be an attempt to pass
+// itself off as another (e.g. "pаypal.com" with a Cyrillic а for
+// "paypal.com"), or nil if it looks innocent. Addresses in ASCII never look
+// suspicious; punycode labels in the domain ("xn--...") are decoded first.
+func (a *Address) SuspiciousHomograph() *Homograph {
+	if h := checkHomograph(a.Localpart); h != nil {
+		h.Part = "localpart"
+		h.Skeleton = skeleton(a.Localpart)
+		return h
+	}
+	labels := strings.Split(a.Domain, ".")
+	for i, l := range labels {
+		if strings.HasPrefix(strings.ToLower(l), "xn--") {
+			if u, err := decodePunycode(l[4:]); err == nil {
+				labels[i] = u
+			}
+		}
+	}
+	for _, l := range labels {
+		if h := checkHomograph(l); h != nil {
+			h.Part = "domain"
+			h.Skeleton = skeleton(strings.Join(labels, "."))
+			return h
+		}
+	}
+	return nil
+}
+
+// Returns a Homograph describing what is suspicious about \a s, with Part
+// and Skeleton left empty, or nil.
+func checkHomograph(s string) *Homograph {
+	if isAscii(s) {
+		return nil
+	}
+	seen := map[string]bool{}
+	scripts := []string{}
+	confusable := false
+	onlyConfusable := true
+	for _, r := range s {
+		if sc := scriptOf(r); sc != "" && !seen[sc] {
+			seen[sc] = true
+			scripts = append(scripts, sc)
+		}
+		if r >= 0x80 {
+			if confusableASCII(r) != "" {
+				confusable = true
+			} else if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				onlyConfusable = false
+			}
+		}
+	}
+	sort.Strings(scripts)
+	h := &Homograph{Label: s, Scripts: scripts}
+	switch {
+	case len(scripts) > 1 && !allowedScriptMixes[strings.Join(scripts, ",")]:
+		h.Reason = "mixed-script"
+	case len(scripts) == 1 && scripts[0] != "Latin" && onlyConfusable && confusable:
+		h.Reason = "whole-script"
+	case len(scripts) <= 1 && confusable && (len(scripts) == 0 || scripts[0] == "Latin"):
+		// a Cyrillic word with a few letters which look Latin is fine,
+		// but Latin text with such letters is not
+		h.Reason = "confusable"
+	default:
+		return nil
+	}
+	return h
+}
+
+// Decodes the punycode (RFC 3492) \a s, e.g. the part of an IDNA A-label
+// after "xn--".
+func decodePunycode(s string) (string, error) {
+	const (
+		base        = 36
+		tmin        = 1
+		tmax        = 26
+		skew        = 38
+		damp        = 700
+		initialBias = 72
+		initialN    = 128
+	)
+	adapt := func(delta, numPoints int, first bool) int {
+		if first {
+			delta /= damp
+		} else {
+			delta /= 2
+		}
+		delta += delta / numPoints
+		k := 0
+		for delta > ((base-tmin)*tmax)/2 {
+			delta /= base - tmin
+			k += base
+		}
+		return k + (base-tmin+1)*delta/(delta+skew)
+	}
+
+	output := []rune{}
+	if i := strings.LastIndexByte(s, '-'); i >= 0 {
+		for _, r := range s[:i] {
+			if r >= 0x80 {
+				return "", errors.New("mail: non-ASCII in punycode")
+			}
+			output = append(output, r)
+		}
+		s = s[i+1:]
+	}
+
+	n, i, bias := initialN, 0, initialBias
+	for p := 0; p < len(s); {
+		oldi, w := i, 1
+		for k := base; ; k += base {
+			if p >= len(s) {
+				return "", errors.New("mail: truncated punycode")
+			}
+			c := s[p]
+			p++
+			digit := 0
+			switch {
+			case c >= 'a' && c <= 'z':
+				digit = int(c - 'a')
+			case c >= 'A' && c <= 'Z':
+				digit = int(c - 'A')
+			case c >= '0' && c <= '9':
+				digit = int(c-'0') + 26
+			default:
+				return "", errors.New("mail: invalid punycode")
+			}
+			i += digit * w
+			t := k - bias
+			if t < tmin {
+				t = tmin
+			} else if t > tmax {
+				t = tmax
+			}
+			if digit < t {
+				break
+			}
+			w *= base - t
+			if i > 0x10ffff*8 || w > 0x10ffff*8 {
+				return "", errors.New("mail: punycode overflow")
+			}
+		}
+		bias = adapt(i-oldi, len(output)+1, oldi == 0)
+		n += i / (len(output) + 1)
+		i %= len(output) + 1
+		if n > unicode.MaxRune {
+			return "", errors.New("mail: invalid punycode")
+		}
+		output = append(output, 0)
+		copy(output[i+1:], output[i:])
+		output[i] = rune(n)
+		i++
+	}
+	return string(output), nil
+}
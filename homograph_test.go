@@ -0,0 +1,33 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSuspiciousHomograph(t *testing.T) {
+	for _, c := range []struct {
+		address, reason, part, skeleton string
+	}{
+		{"info@pаypal.com", "mixed-script", "domain", "paypal.com"},
+		{"info@xn--80ak6aa92e.com", "whole-script", "domain", "apple.com"},
+		{"ɡoogle@example.com", "confusable", "localpart", "google"},
+		{"info@xn--e1afmkfd.xn--p1ai", "", "", ""},
+		{"café@example.com", "", "", ""},
+		{"info@例え.jp", "", "", ""},
+		{"info@paypal.com", "", "", ""},
+	} {
+		a := mail.NewAddressParser(c.address).Addresses[0]
+		h := a.SuspiciousHomograph()
+		if h == nil {
+			if c.reason != "" {
+				t.Errorf("%s: not flagged", c.address)
+			}
+			continue
+		}
+		testStringEquals(t, c.address+" reason", h.Reason, c.reason)
+		testStringEquals(t, c.address+" part", h.Part, c.part)
+		testStringEquals(t, c.address+" skeleton", h.Skeleton, c.skeleton)
+	}
+}
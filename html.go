@@ -0,0 +1,402 @@
+package mail
+
+import (
+	"bytes"
+	"strings"
+)
+
+type htmlTokenType int
+
+const (
+	htmlTextToken htmlTokenType = iota
+	htmlStartTagToken
+	htmlEndTagToken
+	htmlSelfClosingTagToken
+	htmlCommentToken
+	htmlDoctypeToken
+)
+
+type htmlAttr struct {
+	Name, Value string
+}
+
+// A single token of an HTML document, as produced by htmlTokenize(). Tags
+// keep their original text in raw, so that a document whose tokens have not
+// been modified is reproduced exactly by htmlRender().
+type htmlToken struct {
+	t     htmlTokenType
+	tag   string
+	attrs []htmlAttr
+	raw   string
+
+	modified bool
+}
+
+// Returns true if \a tag never has any content or end tag.
+func isVoidElement(tag string) bool {
+	switch tag {
+	case "area", "base", "br", "col", "embed", "hr", "img", "input",
+		"link", "meta", "param", "source", "track", "wbr":
+		return true
+	}
+	return false
+}
+
+// Splits \a s into a list of HTML tokens. This is not a conforming HTML5
+// tokenizer; it's a forgiving scanner that is good enough for the HTML found
+// in mail, and which never loses any input: text it cannot make sense of is
+// returned as text.
+//
+// The contents of the elements browsers do not parse for tags, such as
+// script, style and textarea, are returned as a single text token, as is
+// everything after a plaintext start tag.
+func htmlTokenize(s string) []htmlToken {
+	tokens := []htmlToken{}
+	i := 0
+	text := 0
+	flush := func(end int) {
+		if end > text {
+			tokens = append(tokens, htmlToken{t: htmlTextToken, raw: s[text:end]})
+		}
+	}
+	for i < len(s) {
+		if s[i] != '<' || i+1 >= len(s) {
+			i++
+			continue
+		}
+		c := s[i+1]
+		if strings.HasPrefix(s[i:], "<!--") {
+			flush(i)
+			end := strings.Index(s[i+4:], "-->")
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += i + 7
+			}
+			tokens = append(tokens, htmlToken{t: htmlCommentToken, raw: s[i:end]})
+			i = end
+			text = i
+		} else if c == '!' || c == '?' {
+			flush(i)
+			end := strings.IndexByte(s[i:], '>')
+			if end < 0 {
+				end = len(s)
+			} else {
+				end += i + 1
+			}
+			tokens = append(tokens, htmlToken{t: htmlDoctypeToken, raw: s[i:end]})
+			i = end
+			text = i
+		} else if c == '/' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') {
+			tok, end := htmlTag(s, i)
+			if end <= i {
+				i++
+				continue
+			}
+			flush(i)
+			tokens = append(tokens, tok)
+			i = end
+			text = i
+			if tok.t == htmlStartTagToken && isRawTextElement(tok.tag) {
+				// everything up to the end tag is text
+				close := len(s)
+				if tok.tag != "plaintext" {
+					close = htmlEndTag(s, i, tok.tag)
+				}
+				flush(close)
+				i = close
+				text = i
+			}
+		} else {
+			i++
+		}
+	}
+	flush(len(s))
+	return tokens
+}
+
+// Returns true if browsers treat the content of \a tag as text rather than
+// markup (the raw text and RCDATA elements, and plaintext, which has no end
+// tag). noscript is included, since browsers which run scripts treat it so.
+func isRawTextElement(tag string) bool {
+	switch tag {
+	case "script", "style", "textarea", "title", "xmp", "iframe", "noembed",
+		"noframes", "noscript", "plaintext":
+		return true
+	}
+	return false
+}
+
+// Returns the position of the end tag for \a tag in \a s at or after \a i,
+// or the length of \a s if there is none. As in browsers, the tag name must
+// be followed by whitespace, '/' or '>'.
+func htmlEndTag(s string, i int, tag string) int {
+	lower := strings.ToLower(s[i:])
+	j := 0
+	for {
+		k := strings.Index(lower[j:], "</"+tag)
+		if k < 0 {
+			return len(s)
+		}
+		j += k
+		e := j + 2 + len(tag)
+		if e == len(lower) || isHTMLSpace(lower[e]) || lower[e] == '/' || lower[e] == '>' {
+			return i + j
+		}
+		j = e
+	}
+}
+
+// Parses the tag starting at \a i in \a s, and returns it along with the
+// position of the first character after it. If there is no sensible tag at
+// \a i, the returned position is \a i.
+func htmlTag(s string, i int) (htmlToken, int) {
+	tok := htmlToken{t: htmlStartTagToken}
+	j := i + 1
+	if s[j] == '/' {
+		tok.t = htmlEndTagToken
+		j++
+	}
+	n := j
+	for j < len(s) && !isHTMLSpace(s[j]) && s[j] != '>' && s[j] != '/' {
+		j++
+	}
+	if j == n {
+		return tok, i
+	}
+	tok.tag = strings.ToLower(s[n:j])
+
+	for j < len(s) {
+		for j < len(s) && isHTMLSpace(s[j]) {
+			j++
+		}
+		if j >= len(s) {
+			break
+		}
+		if s[j] == '>' {
+			j++
+			tok.raw = s[i:j]
+			return tok, j
+		}
+		if s[j] == '/' {
+			j++
+			if j < len(s) && s[j] == '>' && tok.t == htmlStartTagToken {
+				tok.t = htmlSelfClosingTagToken
+			}
+			continue
+		}
+		// as in browsers, a name ends at '/', and one may start with '='
+		a := j
+		j++
+		for j < len(s) && !isHTMLSpace(s[j]) && s[j] != '>' && s[j] != '=' && s[j] != '/' {
+			j++
+		}
+		attr := htmlAttr{Name: strings.ToLower(s[a:j])}
+		for j < len(s) && isHTMLSpace(s[j]) {
+			j++
+		}
+		if j < len(s) && s[j] == '=' {
+			j++
+			for j < len(s) && isHTMLSpace(s[j]) {
+				j++
+			}
+			if j < len(s) && (s[j] == '"' || s[j] == '\'') {
+				q := s[j]
+				j++
+				v := j
+				for j < len(s) && s[j] != q {
+					j++
+				}
+				attr.Value = htmlUnescape(s[v:j])
+				if j < len(s) {
+					j++
+				}
+			} else {
+				v := j
+				for j < len(s) && !isHTMLSpace(s[j]) && s[j] != '>' {
+					j++
+				}
+				attr.Value = htmlUnescape(s[v:j])
+			}
+		}
+		if attr.Name != "" {
+			tok.attrs = append(tok.attrs, attr)
+		}
+	}
+
+	// unterminated tag: treat it as text
+	return tok, i
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f'
+}
+
+// Returns the value of the attribute named \a name, and whether it exists.
+func (t *htmlToken) attr(name string) (string, bool) {
+	for _, a := range t.attrs {
+		if a.Name == name {
+			return a.Value, true
+		}
+	}
+	return "", false
+}
+
+// Sets the attribute named \a name to \a value, adding it if necessary.
+func (t *htmlToken) setAttr(name, value string) {
+	t.modified = true
+	for i := range t.attrs {
+		if t.attrs[i].Name == name {
+			t.attrs[i].Value = value
+			return
+		}
+	}
+	t.attrs = append(t.attrs, htmlAttr{Name: name, Value: value})
+}
+
+// Removes the attribute named \a name, or does nothing if there is none.
+func (t *htmlToken) removeAttr(name string) {
+	for i := range t.attrs {
+		if t.attrs[i].Name == name {
+			t.attrs = append(t.attrs[:i], t.attrs[i+1:]...)
+			t.modified = true
+			return
+		}
+	}
+}
+
+// Returns true if the class attribute of this token contains \a c.
+func (t *htmlToken) hasClass(c string) bool {
+	v, _ := t.attr("class")
+	for _, w := range strings.Fields(v) {
+		if w == c {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns the HTML representation of this token. Unmodified tokens are
+// returned exactly as they were found in the input.
+func (t *htmlToken) String() string {
+	if !t.modified {
+		return t.raw
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('<')
+	if t.t == htmlEndTagToken {
+		buf.WriteByte('/')
+	}
+	buf.WriteString(t.tag)
+	for _, a := range t.attrs {
+		buf.WriteByte(' ')
+		buf.WriteString(a.Name)
+		buf.WriteString("=\"")
+		buf.WriteString(htmlEscape(a.Value))
+		buf.WriteByte('"')
+	}
+	if t.t == htmlSelfClosingTagToken {
+		buf.WriteString(" /")
+	}
+	buf.WriteByte('>')
+	return buf.String()
+}
+
+// Returns the HTML representation of \a tokens.
+func htmlRender(tokens []htmlToken) string {
+	var buf bytes.Buffer
+	for i := range tokens {
+		buf.WriteString(tokens[i].String())
+	}
+	return buf.String()
+}
+
+var htmlEntities = map[string]string{
+	"amp":  "&",
+	"lt":   "<",
+	"gt":   ">",
+	"quot": "\"",
+	"apos": "'",
+	"nbsp": "\u00a0",
+}
+
+// Returns \a s with the common character references replaced by the
+// characters they stand for. Unknown references are left alone.
+func htmlUnescape(s string) string {
+	if !strings.Contains(s, "&") {
+		return s
+	}
+	var buf bytes.Buffer
+	i := 0
+	for i < len(s) {
+		if s[i] != '&' {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		end := strings.IndexByte(s[i:], ';')
+		if end < 2 || end > 10 {
+			buf.WriteByte(s[i])
+			i++
+			continue
+		}
+		name := s[i+1 : i+end]
+		if r, ok := htmlEntities[strings.ToLower(name)]; ok {
+			buf.WriteString(r)
+		} else if name[0] == '#' {
+			n := 0
+			ok := len(name) > 1
+			if len(name) > 2 && (name[1] == 'x' || name[1] == 'X') {
+				for _, c := range name[2:] {
+					d := strings.IndexRune("0123456789abcdef", c|0x20)
+					if d < 0 {
+						ok = false
+						break
+					}
+					n = n*16 + d
+				}
+			} else {
+				for _, c := range name[1:] {
+					if c < '0' || c > '9' {
+						ok = false
+						break
+					}
+					n = n*10 + int(c-'0')
+				}
+			}
+			if !ok {
+				buf.WriteString(s[i : i+end+1])
+			} else {
+				buf.WriteRune(rune(n))
+			}
+		} else {
+			buf.WriteString(s[i : i+end+1])
+		}
+		i += end + 1
+	}
+	return buf.String()
+}
+
+// Returns \a s escaped so it can be used as text or as a double-quoted
+// attribute value.
+func htmlEscape(s string) string {
+	if !strings.ContainsAny(s, "&<>\"") {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '&':
+			buf.WriteString("&amp;")
+		case '<':
+			buf.WriteString("&lt;")
+		case '>':
+			buf.WriteString("&gt;")
+		case '"':
+			buf.WriteString("&quot;")
+		default:
+			buf.WriteByte(s[i])
+		}
+	}
+	return buf.String()
+}
@@ -0,0 +1,151 @@
+package mail
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A KeywordsField is a Keywords field, whose value is a comma-separated
+// list of phrases (RFC 5322 section 3.6.5), any of which may contain
+// encoded-words. Keywords holds the decoded phrases.
+type KeywordsField struct {
+	HeaderField
+	Keywords []string
+}
+
+func NewKeywordsField() *KeywordsField {
+	return &KeywordsField{HeaderField: HeaderField{name: KeywordsFieldName}}
+}
+
+// Parses \a s as a list of phrases. Empty elements are skipped, as the
+// obsolete syntax allows. If \a s is not a proper list, e.g. because a
+// keyword contains a bare "@", each comma-separated element is used as it
+// is, so that nothing is lost.
+func (f *KeywordsField) Parse(s string) {
+	f.Keywords = nil
+	p := newParser(s)
+	for {
+		if k := simplify(p.Phrase()); k != "" {
+			f.Keywords = append(f.Keywords, k)
+		}
+		p.Whitespace()
+		if !p.Present(",") {
+			break
+		}
+	}
+
+	if !p.AtEnd() {
+		f.Keywords = nil
+		for _, e := range strings.Split(s, ",") {
+			k := simplify(e)
+			if ep := newParser(k); strings.Contains(k, "=?") {
+				if d := ep.Phrase(); ep.AtEnd() {
+					k = simplify(d)
+				}
+			}
+			if k != "" {
+				f.Keywords = append(f.Keywords, k)
+			}
+		}
+	}
+	if len(f.Keywords) == 0 {
+		f.err = fmt.Errorf("Unparseable value: %q", s)
+	}
+	f.value = strings.Join(f.Keywords, ", ")
+}
+
+// Returns the keywords as a list of phrases, quoting those which contain
+// special characters and, if \a avoidUTF8 is true, encoding those which
+// contain non-ASCII characters.
+func (f *KeywordsField) rfc822(avoidUTF8 bool) string {
+	r := make([]string, 0, len(f.Keywords))
+	for _, k := range f.Keywords {
+		if avoidUTF8 && !isAscii(k) {
+			k = encodePhrase(k)
+		} else if strings.ContainsAny(k, "\",()<>@:;[]\\") {
+			k = quote(k, '"', '\\')
+		}
+		r = append(r, k)
+	}
+	return wrap(strings.Join(r, ", "), 78, "", " ", false)
+}
+
+// A CommentsField is a Comments field, whose value is unstructured text
+// (RFC 5322 section 3.6.5) which may contain encoded-words.
+type CommentsField struct {
+	HeaderField
+}
+
+func NewCommentsField() *CommentsField {
+	return &CommentsField{HeaderField: HeaderField{name: CommentsFieldName}}
+}
+
+// Parses \a s as text, decoding any encoded-words.
+func (f *CommentsField) Parse(s string) {
+	f.parseText(s)
+}
+
+// Returns the keywords of all Keywords fields in this header, in order,
+// each only once; keywords which differ only in case are considered equal.
+// A message may have any number of Keywords fields, and RFC 5322 gives
+// them no separate meaning. Returns an empty slice if there are none.
+func (h *Header) Keywords() []string {
+	r := []string{}
+	seen := map[string]bool{}
+	for _, hf := range h.All(KeywordsFieldName) {
+		f, ok := hf.(*KeywordsField)
+		if !ok {
+			continue
+		}
+		for _, k := range f.Keywords {
+			if lk := strings.ToLower(k); !seen[lk] {
+				seen[lk] = true
+				r = append(r, k)
+			}
+		}
+	}
+	return r
+}
+
+// Returns the text of each Comments field in this header, in order, or an
+// empty slice if there are none.
+func (h *Header) Comments() []string {
+	r := []string{}
+	for _, f := range h.All(CommentsFieldName) {
+		if v := f.Value(); v != "" {
+			r = append(r, v)
+		}
+	}
+	return r
+}
+
+// Adds \a keywords to this header's first Keywords field, or to a new one
+// if it has none, skipping those already present in any Keywords field.
+func (h *Header) AddKeywords(keywords ...string) {
+	seen := map[string]bool{}
+	for _, k := range h.Keywords() {
+		seen[strings.ToLower(k)] = true
+	}
+	var f *KeywordsField
+	for _, hf := range h.All(KeywordsFieldName) {
+		if kf, ok := hf.(*KeywordsField); ok {
+			f = kf
+			break
+		}
+	}
+	for _, k := range keywords {
+		k = simplify(k)
+		if k == "" || seen[strings.ToLower(k)] {
+			continue
+		}
+		seen[strings.ToLower(k)] = true
+		if f == nil {
+			f = NewKeywordsField()
+			h.addField(f)
+		}
+		f.Keywords = append(f.Keywords, k)
+		f.value = strings.Join(f.Keywords, ", ")
+		f.err = nil
+		f.source = ""
+	}
+}
@@ -0,0 +1,48 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestKeywordsAndComments(t *testing.T) {
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"Keywords: budget, \"Q3, final\", =?utf-8?q?r=C3=A9sum=C3=A9?=\r\n" +
+		"Comments: First =?utf-8?q?caf=C3=A9?= remark\r\n" +
+		"Keywords: Budget, planning,, v1.2\r\n" +
+		"Comments: Second remark\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "keywords", strings.Join(m.Header.Keywords(), "|"),
+		"budget|Q3, final|résumé|planning|v1.2")
+	testStringEquals(t, "comments", strings.Join(m.Header.Comments(), "|"),
+		"First café remark|Second remark")
+	f, ok := m.Header.All(mail.KeywordsFieldName)[0].(*mail.KeywordsField)
+	if !ok {
+		t.Fatal("Keywords is not a KeywordsField")
+	}
+	testIntegerEquals(t, "first field", len(f.Keywords), 3)
+	if _, ok := m.Header.All(mail.CommentsFieldName)[0].(*mail.CommentsField); !ok {
+		t.Error("Comments is not a CommentsField")
+	}
+
+	m.Header.AddKeywords("PLANNING", "travel")
+	testStringEquals(t, "added", strings.Join(f.Keywords, "|"),
+		"budget|Q3, final|résumé|travel")
+	out := m.RFC822(true)
+	if !strings.Contains(out, "\r\nKeywords: budget, \"Q3, final\", =?") ||
+		!strings.Contains(out, "?=, travel\r\n") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+	again, err := mail.ReadMessage(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "round trip", strings.Join(again.Header.Keywords(), "|"),
+		"budget|Q3, final|résumé|travel|planning|v1.2")
+}
@@ -0,0 +1,253 @@
+package mail
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A ReceivedHop is what one Received field says about a message's path: the
+// host it came From, the host which received it (By), the protocol it came
+// With, e.g. "ESMTPS", the ID the receiving host gave it, and the Time it
+// was received, which is nil if the field has no valid timestamp.
+type ReceivedHop struct {
+	From string     `json:"from,omitempty"`
+	By   string     `json:"by,omitempty"`
+	With string     `json:"with,omitempty"`
+	ID   string     `json:"id,omitempty"`
+	Time *time.Time `json:"time,omitempty"`
+}
+
+// Returns the hops recorded in the Received fields of this header, in the
+// order the message took them, i.e. the last field first. Returns an empty
+// slice if there are no Received fields.
+func (h *Header) ReceivedChain() []ReceivedHop {
+	r := []ReceivedHop{}
+	for _, f := range h.Fields {
+		if f.Name() == ReceivedFieldName {
+			r = append(r, parseReceived(f.Value()))
+		}
+	}
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return r
+}
+
+// Parses the value \a v of a Received field. Clauses this package does not
+// know, such as "via" and "for", are skipped, as are comments.
+func parseReceived(v string) ReceivedHop {
+	hop := ReceivedHop{Time: receivedTime(v)}
+	if semicolon := strings.LastIndexByte(v, ';'); semicolon >= 0 {
+		v = v[:semicolon]
+	}
+	words := strings.Fields(stripcomments(v))
+	for i := 0; i+1 < len(words); i++ {
+		var p *string
+		switch strings.ToLower(words[i]) {
+		case "from":
+			p = &hop.From
+		case "by":
+			p = &hop.By
+		case "with":
+			p = &hop.With
+		case "id":
+			p = &hop.ID
+		default:
+			continue
+		}
+		if *p == "" {
+			*p = words[i+1]
+		}
+		i++
+	}
+	return hop
+}
+
+// Returns the timestamp after the last semicolon in the Received field
+// value \a v, or nil if there is none.
+func receivedTime(v string) *time.Time {
+	semicolon := strings.LastIndexByte(v, ';')
+	if semicolon < 0 {
+		return nil
+	}
+	return parseDate(v[semicolon+1:])
+}
+
+// A HistogramBucket counts the values from Low up to, but not including,
+// High. The last bucket of a Histogram may be open-ended, in which case
+// High is zero. Label describes the range for display, e.g. "1m-5m" or "3".
+type HistogramBucket struct {
+	Label string  `json:"label"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high,omitempty"`
+	Count int     `json:"count"`
+}
+
+// A Histogram is the distribution of a set of values measured in Unit,
+// e.g. "hops" or "seconds", ready to be plotted as a bar chart. Its
+// Buckets are in ascending order and adjacent. Count is the number of
+// values, and the other statistics are zero if there are none. Median, P90
+// and P99 are nearest-rank percentiles.
+type Histogram struct {
+	Unit    string            `json:"unit"`
+	Buckets []HistogramBucket `json:"buckets"`
+	Count   int               `json:"count"`
+	Min     float64           `json:"min"`
+	Max     float64           `json:"max"`
+	Mean    float64           `json:"mean"`
+	Median  float64           `json:"median"`
+	P90     float64           `json:"p90"`
+	P99     float64           `json:"p99"`
+}
+
+// A LatencyReport describes how a batch of messages travelled, based on
+// their Received chains:
+//
+// HopCounts is the distribution of the number of Received fields per
+// message. TransitTimes is the distribution of the time from the first to
+// the last Received timestamp of each message with at least two. QueueDelays
+// is the distribution of the time between consecutive timestamped hops,
+// i.e. the time each relay took to pass a message on; a negative delay,
+// which means the relays' clocks disagree, counts as zero and is counted in
+// ClockSkews.
+//
+// Messages is the number of messages examined.
+type LatencyReport struct {
+	Messages     int       `json:"messages"`
+	HopCounts    Histogram `json:"hopCounts"`
+	TransitTimes Histogram `json:"transitTimes"`
+	QueueDelays  Histogram `json:"queueDelays"`
+	ClockSkews   int       `json:"clockSkews"`
+}
+
+// The upper bounds, in seconds, of the buckets used for TransitTimes and
+// QueueDelays, apart from the last, which is open-ended.
+var LatencyBounds = []float64{
+	1, 5, 15, 30, 60, 2 * 60, 5 * 60, 15 * 60, 30 * 60,
+	3600, 2 * 3600, 6 * 3600, 24 * 3600,
+}
+
+// Returns a LatencyReport for \a messages. Messages without a header are
+// counted, but contribute no values.
+func DeliveryLatency(messages []*Message) *LatencyReport {
+	r := &LatencyReport{Messages: len(messages)}
+	var hops, transit, delays []float64
+	for _, m := range messages {
+		if m == nil || m.Header == nil {
+			continue
+		}
+		chain := m.Header.ReceivedChain()
+		hops = append(hops, float64(len(chain)))
+		var first, previous *time.Time
+		for _, hop := range chain {
+			if hop.Time == nil {
+				continue
+			}
+			if previous != nil {
+				d := hop.Time.Sub(*previous).Seconds()
+				if d < 0 {
+					r.ClockSkews++
+					d = 0
+				}
+				delays = append(delays, d)
+			} else {
+				first = hop.Time
+			}
+			previous = hop.Time
+		}
+		if first != nil && previous != first {
+			transit = append(transit, math.Max(0, previous.Sub(*first).Seconds()))
+		}
+	}
+	r.HopCounts = hopHistogram(hops)
+	r.TransitTimes = newHistogram("seconds", durationBuckets(LatencyBounds), transit)
+	r.QueueDelays = newHistogram("seconds", durationBuckets(LatencyBounds), delays)
+	return r
+}
+
+// Returns a histogram of the hop counts \a values, with one bucket for each
+// count from zero to the largest.
+func hopHistogram(values []float64) Histogram {
+	max := 0
+	for _, v := range values {
+		if int(v) > max {
+			max = int(v)
+		}
+	}
+	buckets := make([]HistogramBucket, max+1)
+	for i := range buckets {
+		buckets[i] = HistogramBucket{
+			Label: strconv.Itoa(i),
+			Low:   float64(i),
+			High:  float64(i + 1),
+		}
+	}
+	return newHistogram("hops", buckets, values)
+}
+
+// Returns buckets for durations ending at each of \a bounds, in seconds,
+// followed by an open-ended one.
+func durationBuckets(bounds []float64) []HistogramBucket {
+	r := make([]HistogramBucket, 0, len(bounds)+1)
+	low := 0.0
+	for _, high := range bounds {
+		r = append(r, HistogramBucket{
+			Label: durationLabel(low) + "-" + durationLabel(high),
+			Low:   low,
+			High:  high,
+		})
+		low = high
+	}
+	return append(r, HistogramBucket{Label: ">" + durationLabel(low), Low: low})
+}
+
+// Returns \a seconds in the largest unit which divides it, e.g. "90s",
+// "5m", "6h" or "1d".
+func durationLabel(seconds float64) string {
+	s := int64(seconds)
+	switch {
+	case s != 0 && s%(24*3600) == 0:
+		return strconv.FormatInt(s/(24*3600), 10) + "d"
+	case s != 0 && s%3600 == 0:
+		return strconv.FormatInt(s/3600, 10) + "h"
+	case s != 0 && s%60 == 0:
+		return strconv.FormatInt(s/60, 10) + "m"
+	}
+	return strconv.FormatInt(s, 10) + "s"
+}
+
+// Returns a histogram of \a values, measured in \a unit, counted into
+// \a buckets. Values below the first bucket count in it, and values beyond
+// the last in the last.
+func newHistogram(unit string, buckets []HistogramBucket, values []float64) Histogram {
+	h := Histogram{Unit: unit, Buckets: buckets, Count: len(values)}
+	if len(values) == 0 {
+		return h
+	}
+	sorted := append([]float64{}, values...)
+	sort.Float64s(sorted)
+	sum := 0.0
+	for _, v := range sorted {
+		sum += v
+		i := sort.Search(len(buckets), func(i int) bool {
+			return v < buckets[i].High || buckets[i].High == 0
+		})
+		if i == len(buckets) {
+			i--
+		}
+		buckets[i].Count++
+	}
+	rank := func(p float64) float64 {
+		return sorted[int(math.Ceil(p*float64(len(sorted))))-1]
+	}
+	h.Min = sorted[0]
+	h.Max = sorted[len(sorted)-1]
+	h.Mean = sum / float64(len(sorted))
+	h.Median = rank(0.5)
+	h.P90 = rank(0.9)
+	h.P99 = rank(0.99)
+	return h
+}
@@ -0,0 +1,68 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestDeliveryLatency(t *testing.T) {
+	received := func(from, by string, at string) string {
+		return "Received: from " + from + " (" + from + " [192.0.2.1])\r\n" +
+			" by " + by + " with ESMTPS id abc123; " + at + "\r\n"
+	}
+	var messages []*mail.Message
+	for _, s := range []string{
+		// three hops, 30 seconds and then 10 minutes
+		received("b.example", "c.example", "Tue, 3 Jan 2006 11:10:30 +0000") +
+			received("a.example", "b.example", "Tue, 3 Jan 2006 11:00:30 +0000") +
+			received("client", "a.example", "Tue, 3 Jan 2006 12:00:00 +0100"),
+		// a clock running two minutes slow
+		received("a.example", "b.example", "Tue, 3 Jan 2006 10:58:00 +0000") +
+			received("client", "a.example", "Tue, 3 Jan 2006 11:00:00 +0000"),
+		"",
+	} {
+		m, err := mail.ReadMessage(s + "From: a@example.com\r\n\r\nHello\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+
+	chain := messages[0].Header.ReceivedChain()
+	testIntegerEquals(t, "hops", len(chain), 3)
+	testStringEquals(t, "from", chain[0].From, "client")
+	testStringEquals(t, "by", chain[2].By, "c.example")
+	testStringEquals(t, "with", chain[1].With, "ESMTPS")
+	testStringEquals(t, "id", chain[1].ID, "abc123")
+
+	r := mail.DeliveryLatency(messages)
+	testIntegerEquals(t, "messages", r.Messages, 3)
+	testIntegerEquals(t, "hop buckets", len(r.HopCounts.Buckets), 4)
+	for i, n := range []int{1, 0, 1, 1} {
+		testIntegerEquals(t, "hop count "+r.HopCounts.Buckets[i].Label,
+			r.HopCounts.Buckets[i].Count, n)
+	}
+	testIntegerEquals(t, "transit times", r.TransitTimes.Count, 2)
+	if r.TransitTimes.Max != 630 || r.TransitTimes.Min != 0 {
+		t.Errorf("transit times: %+v", r.TransitTimes)
+	}
+	testIntegerEquals(t, "queue delays", r.QueueDelays.Count, 3)
+	testIntegerEquals(t, "clock skews", r.ClockSkews, 1)
+	if r.QueueDelays.Median != 30 {
+		t.Errorf("median queue delay: %v", r.QueueDelays.Median)
+	}
+	count := func(label string) int {
+		for _, b := range r.QueueDelays.Buckets {
+			if b.Label == label {
+				return b.Count
+			}
+		}
+		t.Errorf("no bucket %s", label)
+		return 0
+	}
+	testIntegerEquals(t, "0s-1s", count("0s-1s"), 1)
+	testIntegerEquals(t, "30s-1m", count("30s-1m"), 1)
+	testIntegerEquals(t, "5m-15m", count("5m-15m"), 1)
+	testIntegerEquals(t, "open bucket", count(">1d"), 0)
+}
@@ -0,0 +1,219 @@
+package mail
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Returns \a s with each line ending, whether LF, CR or CRLF, replaced by
+// \a eol, which is normally "\r\n" or "\n". Unlike the conversion done when
+// parsing, nothing is added at the end, so the result's length is exactly
+// NormalizedLength(\a s, \a eol).
+func NormalizeLineEndings(s, eol string) string {
+	var b strings.Builder
+	b.Grow(NormalizedLength(s, eol))
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			b.WriteString(eol)
+		case '\n':
+			b.WriteString(eol)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return b.String()
+}
+
+// Returns the length NormalizeLineEndings(\a s, \a eol) would return,
+// without building it, e.g. to announce the size of an IMAP literal or to
+// count the body length for DKIM.
+func NormalizedLength(s, eol string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\r':
+			if i+1 < len(s) && s[i+1] == '\n' {
+				i++
+			}
+			n += len(eol)
+		case '\n':
+			n += len(eol)
+		default:
+			n++
+		}
+	}
+	return n
+}
+
+// A LineEndingWriter converts line endings as NormalizeLineEndings() does
+// while writing to another writer. A CRLF split between two calls to Write()
+// is still converted to a single line ending.
+//
+// In and Out count the bytes written to the LineEndingWriter and to the
+// underlying writer.
+type LineEndingWriter struct {
+	In  int64
+	Out int64
+
+	w   io.Writer
+	eol string
+	cr  bool // the last byte written was CR
+	buf []byte
+}
+
+// Returns a new LineEndingWriter writing to \a w with \a eol as line ending.
+func NewLineEndingWriter(w io.Writer, eol string) *LineEndingWriter {
+	return &LineEndingWriter{w: w, eol: eol}
+}
+
+func (w *LineEndingWriter) Write(p []byte) (int, error) {
+	buf := w.buf[:0]
+	for _, c := range p {
+		if c == '\n' && w.cr {
+			w.cr = false
+			continue
+		}
+		w.cr = c == '\r'
+		if c == '\r' || c == '\n' {
+			buf = append(buf, w.eol...)
+		} else {
+			buf = append(buf, c)
+		}
+	}
+	w.buf = buf
+	n, err := w.w.Write(buf)
+	w.Out += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	w.In += int64(len(p))
+	return len(p), nil
+}
+
+// Returns \a s dot-stuffed for the SMTP DATA command (RFC 5321 section
+// 4.5.2): each line starting with "." gets another. \a s should use CRLF
+// line endings; the terminating "." line is not added.
+func DotStuff(s string) string {
+	if strings.HasPrefix(s, ".") {
+		s = "." + s
+	}
+	return strings.Replace(s, "\n.", "\n..", -1)
+}
+
+// Returns \a s with the dot-stuffing done by DotStuff() removed.
+func DotUnstuff(s string) string {
+	if strings.HasPrefix(s, ".") {
+		s = s[1:]
+	}
+	return strings.Replace(s, "\n..", "\n.", -1)
+}
+
+// A DotStuffWriter dot-stuffs what is written to it, as DotStuff() does,
+// and writes it to another writer. Close() ends the data with the "." line.
+//
+// In and Out count the bytes written to the DotStuffWriter and to the
+// underlying writer, including the terminating line.
+type DotStuffWriter struct {
+	In  int64
+	Out int64
+
+	w   io.Writer
+	bol bool // at the beginning of a line
+	buf []byte
+}
+
+// Returns a new DotStuffWriter writing to \a w.
+func NewDotStuffWriter(w io.Writer) *DotStuffWriter {
+	return &DotStuffWriter{w: w, bol: true}
+}
+
+func (w *DotStuffWriter) Write(p []byte) (int, error) {
+	buf := w.buf[:0]
+	for _, c := range p {
+		if w.bol && c == '.' {
+			buf = append(buf, '.')
+		}
+		buf = append(buf, c)
+		w.bol = c == '\n'
+	}
+	w.buf = buf
+	n, err := w.w.Write(buf)
+	w.Out += int64(n)
+	if err != nil {
+		return 0, err
+	}
+	w.In += int64(len(p))
+	return len(p), nil
+}
+
+// Writes the "." line which ends the data, preceded by CRLF if the data did
+// not end with a line ending. The underlying writer is not closed.
+func (w *DotStuffWriter) Close() error {
+	end := ".\r\n"
+	if !w.bol {
+		end = "\r\n" + end
+	}
+	n, err := io.WriteString(w.w, end)
+	w.Out += int64(n)
+	w.bol = true
+	return err
+}
+
+// A DotUnstuffReader reads dot-stuffed data, as sent after the SMTP DATA
+// command, removes the dot-stuffing, and returns io.EOF at the terminating
+// "." line. If the data ends without that line, io.ErrUnexpectedEOF is
+// returned.
+//
+// Nothing after the "." line is read from a bufio.Reader given to
+// NewDotUnstuffReader(), so an SMTP server may go on reading commands from
+// it. In and Out count the bytes read from the underlying reader, including
+// the terminating line, and returned by Read().
+type DotUnstuffReader struct {
+	In  int64
+	Out int64
+
+	r    *bufio.Reader
+	line string // unstuffed, not yet returned
+	done bool
+}
+
+// Returns a new DotUnstuffReader reading from \a r.
+func NewDotUnstuffReader(r io.Reader) *DotUnstuffReader {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	return &DotUnstuffReader{r: br}
+}
+
+func (r *DotUnstuffReader) Read(p []byte) (int, error) {
+	for r.line == "" {
+		if r.done {
+			return 0, io.EOF
+		}
+		l, err := r.r.ReadString('\n')
+		r.In += int64(len(l))
+		if err == io.EOF {
+			return 0, io.ErrUnexpectedEOF
+		} else if err != nil {
+			return 0, err
+		}
+		if l == ".\r\n" || l == ".\n" {
+			r.done = true
+			return 0, io.EOF
+		}
+		if l[0] == '.' {
+			l = l[1:]
+		}
+		r.line = l
+	}
+	n := copy(p, r.line)
+	r.line = r.line[n:]
+	r.Out += int64(n)
+	return n, nil
+}
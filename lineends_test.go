@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestLineEndingsAndDotStuffing(t *testing.T) {
+	s := "one\rtwo\nthree\r\nfour\n\r"
+	testStringEquals(t, "crlf", mail.NormalizeLineEndings(s, "\r\n"), "one\r\ntwo\r\nthree\r\nfour\r\n\r\n")
+	testStringEquals(t, "lf", mail.NormalizeLineEndings(s, "\n"), "one\ntwo\nthree\nfour\n\n")
+	testIntegerEquals(t, "crlf length", mail.NormalizedLength(s, "\r\n"), 25)
+	testIntegerEquals(t, "lf length", mail.NormalizedLength(s, "\n"), 20)
+
+	var b bytes.Buffer
+	w := mail.NewLineEndingWriter(&b, "\r\n")
+	for _, chunk := range []string{"a\r", "\nb\n", "\r", "c"} {
+		w.Write([]byte(chunk))
+	}
+	testStringEquals(t, "split crlf", b.String(), "a\r\nb\r\n\r\nc")
+	testIntegerEquals(t, "in", int(w.In), 7)
+	testIntegerEquals(t, "out", int(w.Out), 9)
+
+	data := ".start\r\nmiddle\r\n.\r\n..two\r\nend"
+	stuffed := mail.DotStuff(data)
+	testStringEquals(t, "stuffed", stuffed, "..start\r\nmiddle\r\n..\r\n...two\r\nend")
+	testStringEquals(t, "unstuffed", mail.DotUnstuff(stuffed), data)
+
+	b.Reset()
+	dw := mail.NewDotStuffWriter(&b)
+	dw.Write([]byte(".start\r\nmiddle\r\n"))
+	dw.Write([]byte(".\r\n..two\r\nend"))
+	dw.Close()
+	testStringEquals(t, "written", b.String(), stuffed+"\r\n.\r\n")
+	testIntegerEquals(t, "written in", int(dw.In), len(data))
+	testIntegerEquals(t, "written out", int(dw.Out), b.Len())
+
+	br := bufio.NewReader(strings.NewReader(b.String() + "QUIT\r\n"))
+	dr := mail.NewDotUnstuffReader(br)
+	read, err := ioutil.ReadAll(dr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "read", string(read), data+"\r\n")
+	testIntegerEquals(t, "read in", int(dr.In), b.Len())
+	testIntegerEquals(t, "read out", int(dr.Out), len(data)+2)
+	rest, _ := br.ReadString('\n')
+	testStringEquals(t, "after", rest, "QUIT\r\n")
+
+	_, err = ioutil.ReadAll(mail.NewDotUnstuffReader(strings.NewReader("no end\r\n")))
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("unterminated data: %v", err)
+	}
+}
@@ -0,0 +1,249 @@
+package mail
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// The widest layout, in pixels, which common mail clients display without
+// scrolling or scaling.
+const maxLintWidth = 600
+
+// CSS properties which common mail clients ignore or strip, and why.
+var unsupportedCSS = map[string]string{
+	"position":   "is ignored by Gmail and Outlook",
+	"box-shadow": "is not supported by Outlook and many webmail clients",
+	"transform":  "is not supported by Outlook and many webmail clients",
+	"transition": "is not supported by Outlook and many webmail clients",
+	"animation":  "is not supported by Outlook and many webmail clients",
+	"filter":     "is not supported by Outlook and many webmail clients",
+}
+
+// A LintRule is an additional check for Message.Lint(), e.g. a
+// marketing tool's own style rules. It returns its findings, with Codes of
+// its own choosing.
+type LintRule func(m *Message) []Diagnostic
+
+// A lintContext holds what the rules applied by Message.Lint() look at: an
+// HTML bodypart of the message, its part number and its tokens, and the
+// diagnostics found so far.
+type lintContext struct {
+	message *Message
+	part    *Part
+	number  string
+	tokens  []htmlToken
+	seen    map[string]bool
+	r       []Diagnostic
+}
+
+// The rules Message.Lint() applies to each HTML bodypart.
+var htmlLintRules = []func(c *lintContext){
+	lintCSS,
+	lintImages,
+	lintWidth,
+	lintLanguage,
+	lintHeadings,
+	lintContrast,
+	lintImageOnly,
+}
+
+// Checks the HTML bodies of this message for common problems with mail
+// clients, such as CSS which Outlook ignores, images without alt text,
+// layouts wider than 600 pixels, cid: URLs which refer to no bodypart, and
+// the lack of a plain text alternative, and for problems with accessibility:
+// a missing lang attribute, skipped heading levels, text with too little
+// contrast and bodies which consist of images only. The subject is checked
+// with AnalyzeSubject() for its length in common clients, emoji which older
+// clients cannot show and words typical of spam. Finally, each of \a rules
+// is applied. Returns a diagnostic for each problem found, with the code,
+// the part number (empty for problems with the message as a whole) and a
+// message saying what to change, or an empty slice if there are none. A
+// problem which occurs more than once in a bodypart is reported once.
+//
+// Lint() is meant for composed messages, e.g. as a test of an application's
+// templates before they are sent.
+func (m *Message) Lint(rules ...LintRule) []Diagnostic {
+	c := &lintContext{message: m, r: []Diagnostic{}}
+	if m.Part == nil {
+		return c.r
+	}
+	m.Part.lintHTML(c, "")
+	c.part, c.number, c.seen = m.Part, "", nil
+	if body := m.Part.displayBody(PreferPlain); body != nil && body.contentType() == "text/html" {
+		c.add(DiagnosticNoTextAlternative, SeverityWarning,
+			"add a text/plain alternative in a multipart/alternative; "+
+				"some clients and many spam filters expect one")
+	}
+	lintSubject(c)
+	for _, rule := range rules {
+		c.r = append(c.r, rule(m)...)
+	}
+	return c.r
+}
+
+// Applies htmlLintRules to this bodypart, whose part number is \a number,
+// if it is an HTML body, or else to its descendants. Embedded messages are
+// not checked.
+func (p *Part) lintHTML(c *lintContext, number string) {
+	if p.message != nil {
+		return
+	}
+	if len(p.Parts) > 0 {
+		for i, child := range p.Parts {
+			child.lintHTML(c, partNumber(number, i+1))
+		}
+		return
+	}
+	if p.contentType() != "text/html" || p.isAttachment() {
+		return
+	}
+	c.part, c.number = p, number
+	c.tokens = htmlTokenize(p.Text)
+	c.seen = map[string]bool{}
+	for _, rule := range htmlLintRules {
+		rule(c)
+	}
+}
+
+// Records a diagnostic about the current bodypart, unless the same one has
+// been recorded for it already.
+func (c *lintContext) add(code string, s Severity, format string, args ...interface{}) {
+	d := Diagnostic{Code: code, Severity: s, Part: c.number, Message: fmt.Sprintf(format, args...)}
+	key := d.Code + "\x00" + d.Message
+	if c.seen[key] {
+		return
+	}
+	if c.seen != nil {
+		c.seen[key] = true
+	}
+	c.r = append(c.r, d)
+}
+
+// Reports CSS which common clients ignore, in style attributes and style
+// elements, and external style sheets.
+func lintCSS(c *lintContext) {
+	check := func(declarations []cssDeclaration) {
+		for _, d := range declarations {
+			value := strings.ToLower(d.value)
+			if why, ok := unsupportedCSS[d.property]; ok {
+				c.add(DiagnosticUnsupportedCSS, SeverityWarning, "%s %s", d.property, why)
+			}
+			switch {
+			case d.property == "display" && strings.Contains(value, "flex") ||
+				d.property == "display" && strings.Contains(value, "grid") ||
+				strings.HasPrefix(d.property, "flex") || strings.HasPrefix(d.property, "grid"):
+				c.add(DiagnosticUnsupportedCSS, SeverityWarning,
+					"flexbox and grid layouts are not supported by Outlook; use tables")
+			case strings.HasPrefix(d.property, "background") && strings.Contains(value, "url("):
+				c.add(DiagnosticUnsupportedCSS, SeverityWarning,
+					"background images are not shown by Outlook; give the element a background color too")
+			case strings.Contains(value, "var("):
+				c.add(DiagnosticUnsupportedCSS, SeverityWarning,
+					"CSS variables are not supported by most clients")
+			}
+		}
+	}
+	for i, t := range c.tokens {
+		if t.t != htmlStartTagToken && t.t != htmlSelfClosingTagToken {
+			continue
+		}
+		if style, ok := t.attr("style"); ok {
+			check(parseCSSDeclarations(style))
+		}
+		if t.tag == "link" {
+			if rel, _ := t.attr("rel"); strings.EqualFold(rel, "stylesheet") {
+				c.add(DiagnosticUnsupportedCSS, SeverityWarning,
+					"external style sheets are removed by most clients; use a style element or inline styles")
+			}
+		}
+		if t.tag != "style" || i+1 >= len(c.tokens) || c.tokens[i+1].t != htmlTextToken {
+			continue
+		}
+		sheet := strings.ToLower(c.tokens[i+1].raw)
+		if strings.Contains(sheet, "@import") {
+			c.add(DiagnosticUnsupportedCSS, SeverityWarning,
+				"@import is not supported by most clients")
+		}
+		if strings.Contains(sheet, "@font-face") {
+			c.add(DiagnosticUnsupportedCSS, SeverityInfo,
+				"web fonts are only shown by a few clients; make sure the fallback fonts look right")
+		}
+		for _, block := range strings.Split(sheet, "{")[1:] {
+			if end := strings.IndexByte(block, '}'); end >= 0 {
+				block = block[:end]
+			}
+			check(parseCSSDeclarations(block))
+		}
+	}
+}
+
+// Reports images without alt attributes and cid: URLs which refer to no
+// bodypart.
+func lintImages(c *lintContext) {
+	for _, t := range c.tokens {
+		if t.t != htmlStartTagToken && t.t != htmlSelfClosingTagToken {
+			continue
+		}
+		if t.tag == "img" {
+			if _, ok := t.attr("alt"); !ok {
+				src, _ := t.attr("src")
+				c.add(DiagnosticMissingAlt, SeverityWarning,
+					"image %s has no alt attribute; many clients block images, "+
+						"so describe it, or use alt=\"\" if it is decorative", strconv.Quote(src))
+			}
+		}
+		for _, name := range []string{"src", "background"} {
+			ref, _ := t.attr(name)
+			ref = strings.TrimSpace(ref)
+			if !strings.HasPrefix(strings.ToLower(ref), "cid:") {
+				continue
+			}
+			id, err := url.PathUnescape(ref[4:])
+			if err != nil {
+				id = ref[4:]
+			}
+			if c.message.PartByContentID(id) == nil {
+				c.add(DiagnosticBrokenCID, SeverityError,
+					"%s refers to no part of the message; attach it with Content-ID <%s>", ref, id)
+			}
+		}
+	}
+}
+
+// Reports elements which are wider than maxLintWidth pixels.
+func lintWidth(c *lintContext) {
+	for _, t := range c.tokens {
+		if t.t != htmlStartTagToken && t.t != htmlSelfClosingTagToken {
+			continue
+		}
+		width := 0
+		if w, ok := t.attr("width"); ok {
+			width = cssPixels(w)
+		}
+		if style, ok := t.attr("style"); ok {
+			for _, d := range parseCSSDeclarations(style) {
+				if (d.property == "width" || d.property == "min-width") && cssPixels(d.value) > width {
+					width = cssPixels(d.value)
+				}
+			}
+		}
+		if width > maxLintWidth {
+			c.add(DiagnosticTooWide, SeverityWarning,
+				"%s is %d pixels wide; keep the layout within %d pixels, or it will "+
+					"be cut off or scaled down on narrow screens", t.tag, width, maxLintWidth)
+		}
+	}
+}
+
+// Returns the number of pixels in the length \a s, e.g. "700px" or "700",
+// or 0 if it is in another unit.
+func cssPixels(s string) int {
+	s = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "px")
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil {
+		return 0
+	}
+	return n
+}
@@ -0,0 +1,54 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestLint(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.HTML = "<html><head><style>@import url(x.css); .box { display: flex; box-shadow: 1px 1px #000 }</style>" +
+		"<link rel=\"stylesheet\" href=\"https://example.com/a.css\"></head><body>" +
+		"<table width=\"800\"><tr><td style=\"position: relative; width: 300px\">" +
+		"<img src=\"cid:logo@example.com\"><img src=\"cid:gone@example.com\" alt=\"\">" +
+		"<img src=\"cid:logo@example.com\">" +
+		"</td></tr></table></body></html>"
+	c.Attach("logo.png", "image/png", "png").ContentID = "logo@example.com"
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes := []string{}
+	for _, d := range m.Lint() {
+		if d.Code != mail.DiagnosticNoTextAlternative {
+			testStringEquals(t, "part of "+d.Code, d.Part, "1")
+		}
+		codes = append(codes, d.Code+": "+d.Message)
+	}
+	testStringEquals(t, "diagnostics", strings.Join(codes, "\n"),
+		"unsupported-css: @import is not supported by most clients\n"+
+			"unsupported-css: flexbox and grid layouts are not supported by Outlook; use tables\n"+
+			"unsupported-css: box-shadow is not supported by Outlook and many webmail clients\n"+
+			"unsupported-css: external style sheets are removed by most clients; use a style element or inline styles\n"+
+			"unsupported-css: position is ignored by Gmail and Outlook\n"+
+			"missing-alt: image \"cid:logo@example.com\" has no alt attribute; many clients block images, so describe it, or use alt=\"\" if it is decorative\n"+
+			"broken-cid: cid:gone@example.com refers to no part of the message; attach it with Content-ID <gone@example.com>\n"+
+			"too-wide: table is 800 pixels wide; keep the layout within 600 pixels, or it will be cut off or scaled down on narrow screens\n"+
+			"missing-lang: add a lang attribute to the html element, e.g. <html lang=\"en\">, so that screen readers pronounce the text correctly\n"+
+			"image-only: the body consists of 3 image(s) and only 0 characters of text; put the message in text, since many readers will not see the images\n"+
+			"no-text-alternative: add a text/plain alternative in a multipart/alternative; some clients and many spam filters expect one")
+
+	c.Text = "Hello"
+	c.HTML = "<html lang=\"en\"><h1>Hello</h1><h2>News</h2>" +
+		"<p style=\"color: navy\">There is news, and it is good. <img src=\"cid:logo@example.com\" alt=\"Logo\"></p>"
+	m, err = c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := m.Lint(); len(d) != 0 {
+		t.Errorf("unexpected diagnostics %v", d)
+	}
+}
@@ -0,0 +1,204 @@
+package mail
+
+import (
+	"strings"
+)
+
+const (
+	ListPostFieldName        = "List-Post"
+	ListArchiveFieldName     = "List-Archive"
+	ListUnsubscribeFieldName = "List-Unsubscribe"
+	PrecedenceFieldName      = "Precedence"
+	MailingListFieldName     = "Mailing-List"
+	XMailmanVersionFieldName = "X-Mailman-Version"
+	XGoogleGroupIDFieldName  = "X-Google-Group-ID"
+	XBeenThereFieldName      = "X-Beenthere"
+)
+
+// A ListInfo describes the mailing list a message was sent through, as far as
+// it can be determined from the header.
+//
+// ID is the list identifier (RFC 2919), e.g. "announce.example.com", or if
+// there is none, the list's address. Name is the description given in
+// List-Id, if any. Post is the address to which contributions are sent, and
+// is empty if posting is not allowed or not known. Archive and Unsubscribe
+// are URLs. Software is the list manager, if known: "mailman", "google",
+// "ezmlm", "sympa", "listserv", "majordomo" or "mlmmj".
+type ListInfo struct {
+	ID          string `json:"id"`
+	Name        string `json:"name,omitempty"`
+	Post        string `json:"post,omitempty"`
+	Archive     string `json:"archive,omitempty"`
+	Unsubscribe string `json:"unsubscribe,omitempty"`
+	Software    string `json:"software,omitempty"`
+}
+
+// Returns information about the mailing list this message was sent through,
+// or nil if it does not seem to come from a mailing list.
+//
+// The List-* fields of RFC 2369 and RFC 2919 are used if present. Otherwise,
+// Precedence: list, the Sender address conventions of the common list
+// managers ("owner-x", "x-bounces", "x-request") and software-specific
+// fields such as X-Mailman-Version and X-Google-Group-Id are used.
+func (m *Message) ListInfo() *ListInfo {
+	if m.Header == nil {
+		return nil
+	}
+	return m.Header.ListInfo()
+}
+
+// Returns information about the mailing list of this header, as described
+// for Message.ListInfo().
+func (h *Header) ListInfo() *ListInfo {
+	r := &ListInfo{}
+	list := false
+
+	if v := h.Get(ListIdFieldName); v != "" {
+		list = true
+		r.ID, r.Name = parseListID(v)
+	}
+	if v := h.Get(ListPostFieldName); v != "" {
+		list = true
+		if u := firstListURL(v); strings.HasPrefix(strings.ToLower(u), "mailto:") {
+			r.Post = mailtoAddress(u)
+		}
+	}
+	if v := h.Get(ListArchiveFieldName); v != "" {
+		list = true
+		r.Archive = firstListURL(v)
+	}
+	if v := h.Get(ListUnsubscribeFieldName); v != "" {
+		list = true
+		r.Unsubscribe = firstListURL(v)
+	}
+
+	switch {
+	case h.Get(XMailmanVersionFieldName) != "":
+		r.Software = "mailman"
+	case h.Get(XGoogleGroupIDFieldName) != "":
+		r.Software = "google"
+	case strings.Contains(strings.ToLower(h.Get(MailingListFieldName)), "ezmlm"):
+		r.Software = "ezmlm"
+	case h.Get("X-Sympa-To") != "" || h.Get("X-Loop") != "" &&
+		strings.Contains(strings.ToLower(h.Get("X-Loop")), "sympa"):
+		r.Software = "sympa"
+	case h.Get("X-Listserver") != "" || h.Get("X-Listprocessor-Version") != "":
+		r.Software = "listserv"
+	case h.Get("X-Mlmmj-Version") != "" || h.Get("X-Mailinglist") != "":
+		r.Software = "mlmmj"
+	}
+	if r.Software != "" {
+		list = true
+	}
+
+	// the address the list sends from tells us something even if
+	// there are no list fields.
+	listAddress := ""
+	if v := h.Get(MailingListFieldName); v != "" {
+		// ezmlm and google: "list foo@example.com; contact ..."
+		w := strings.Fields(v)
+		if len(w) >= 2 && strings.ToLower(w[0]) == "list" {
+			listAddress = strings.TrimRight(w[1], ";")
+		}
+	}
+	if listAddress == "" {
+		listAddress = simplify(h.Get(XBeenThereFieldName))
+	}
+	if listAddress == "" {
+		for _, a := range h.Addresses(SenderFieldName) {
+			if l, software := listAddressFromSender(a.lpdomain()); l != "" {
+				listAddress = l
+				if r.Software == "" {
+					r.Software = software
+				}
+			}
+		}
+	}
+	if listAddress != "" {
+		list = true
+	}
+	if strings.ToLower(strings.TrimSpace(h.Get(PrecedenceFieldName))) == "list" {
+		list = true
+	}
+
+	if !list {
+		return nil
+	}
+	if r.ID == "" {
+		r.ID = strings.ToLower(listAddress)
+	}
+	if r.Post == "" && h.Get(ListPostFieldName) == "" {
+		r.Post = listAddress
+	}
+	return r
+}
+
+// Parses the value of a List-Id field, e.g. "Announcements
+// <announce.example.com>", and returns the identifier and the description.
+func parseListID(v string) (string, string) {
+	v = simplify(v)
+	open := strings.LastIndexByte(v, '<')
+	end := strings.LastIndexByte(v, '>')
+	if open < 0 || end < open {
+		return strings.ToLower(v), ""
+	}
+	name := strings.TrimSpace(v[:open])
+	name = unquote(name, '"', '\\')
+	return strings.ToLower(strings.TrimSpace(v[open+1 : end])), name
+}
+
+// Returns the first URL in the RFC 2369 field value \a v, e.g. "<mailto:
+// list@example.com> (Postings are moderated)", or an empty string if there is
+// none.
+func firstListURL(v string) string {
+	open := strings.IndexByte(v, '<')
+	if open < 0 {
+		return ""
+	}
+	end := strings.IndexByte(v[open:], '>')
+	if end < 0 {
+		return ""
+	}
+	// URLs may be folded
+	return strings.Join(strings.Fields(v[open+1:open+end]), "")
+}
+
+// Returns the address of the mailto: URL \a u, without any query.
+func mailtoAddress(u string) string {
+	a := u[len("mailto:"):]
+	if q := strings.IndexByte(a, '?'); q >= 0 {
+		a = a[:q]
+	}
+	return a
+}
+
+// If the Sender address \a a follows a list manager's naming convention,
+// returns the list's address and the software which uses the convention.
+func listAddressFromSender(a string) (string, string) {
+	at := strings.LastIndexByte(a, '@')
+	if at < 0 {
+		return "", ""
+	}
+	lp := strings.ToLower(a[:at])
+	domain := a[at:]
+	if i := strings.Index(lp, "-bounces"); i > 0 {
+		return lp[:i] + domain, "mailman"
+	}
+	if strings.HasPrefix(lp, "owner-") && len(lp) > 6 {
+		return lp[6:] + domain, "majordomo"
+	}
+	if strings.HasSuffix(lp, "-owner") && len(lp) > 6 {
+		return lp[:len(lp)-6] + domain, ""
+	}
+	if strings.HasSuffix(lp, "-request") && len(lp) > 8 {
+		return lp[:len(lp)-8] + domain, ""
+	}
+	if i := strings.Index(lp, "-return"); i > 0 {
+		return lp[:i] + domain, "ezmlm"
+	}
+	if i := strings.Index(lp, "+bnc"); i > 0 {
+		// google groups' bounce addresses
+		return lp[:i] + domain, "google"
+	}
+	return "", ""
+}
@@ -0,0 +1,48 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestListInfo(t *testing.T) {
+	msg, err := mail.ReadMessage("From: a@example.com\r\n" +
+		"Sender: announce-bounces@lists.example.com\r\n" +
+		"List-Id: Announcements <announce.lists.example.com>\r\n" +
+		"List-Post: <mailto:announce@lists.example.com>\r\n" +
+		"List-Archive: <https://lists.example.com/archives/\r\n announce/>\r\n" +
+		"X-Mailman-Version: 2.1.29\r\n" +
+		"\r\n" +
+		"Hello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l := msg.ListInfo()
+	if l == nil {
+		t.Fatal("mailing list not detected")
+	}
+	testStringEquals(t, "list id", l.ID, "announce.lists.example.com")
+	testStringEquals(t, "list name", l.Name, "Announcements")
+	testStringEquals(t, "post address", l.Post, "announce@lists.example.com")
+	testStringEquals(t, "archive", l.Archive, "https://lists.example.com/archives/announce/")
+	testStringEquals(t, "software", l.Software, "mailman")
+
+	msg, err = mail.ReadMessage("From: a@example.com\r\n" +
+		"Sender: owner-users@example.org\r\n" +
+		"\r\n" +
+		"Hello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l = msg.ListInfo()
+	if l == nil {
+		t.Fatal("mailing list not detected from Sender")
+	}
+	testStringEquals(t, "list id", l.ID, "users@example.org")
+	testStringEquals(t, "software", l.Software, "majordomo")
+
+	if loadFixture(t, "plain").ListInfo() != nil {
+		t.Error("plain message detected as list message")
+	}
+}
@@ -0,0 +1,135 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A SendmailTransport delivers mail by running the local sendmail program,
+// or a compatible one such as Exim's or Postfix's, at Path
+// ("/usr/sbin/sendmail" if empty), with the arguments "-i", "-f" and the
+// envelope sender, Args, "--" and the recipients. The message is written
+// to its standard input with LF line endings, as such programs expect.
+type SendmailTransport struct {
+	Path string
+	Args []string
+}
+
+// Runs sendmail to deliver \a rfc5322. Returns an error including
+// sendmail's output if it fails.
+func (t *SendmailTransport) Send(env Envelope, rfc5322 string) error {
+	if len(env.To) == 0 {
+		return errors.New("mail: no recipients")
+	}
+	path := t.Path
+	if path == "" {
+		path = "/usr/sbin/sendmail"
+	}
+	args := []string{"-i"}
+	if env.From != "" {
+		args = append(args, "-f", env.From)
+	}
+	args = append(args, t.Args...)
+	args = append(args, "--")
+	args = append(args, env.To...)
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(strings.Replace(rfc5322, "\r\n", "\n", -1))
+	var out bytes.Buffer
+	cmd.Stdout = &out
+	cmd.Stderr = &out
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("mail: %s failed: %w: %s", path, err, strings.TrimSpace(out.String()))
+	}
+	return nil
+}
+
+// A MaildirTransport delivers mail into the Maildir at Dir, creating its
+// tmp, new and cur directories if necessary. Each message is written to
+// tmp and then moved to new, so that readers never see a partial message.
+// The recipients are not used; all mail goes into the one Maildir.
+type MaildirTransport struct {
+	Dir string
+}
+
+// The number of messages delivered by this process to any Maildir, used to
+// make file names unique.
+var maildirDeliveries uint64
+
+// Writes \a rfc5322 to a new file in the Maildir, with a Return-Path field
+// naming the envelope sender and LF line endings, as Maildir readers expect.
+func (t *MaildirTransport) Send(env Envelope, rfc5322 string) error {
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(t.Dir, sub), 0700); err != nil {
+			return err
+		}
+	}
+	host, _ := os.Hostname()
+	host = strings.NewReplacer("/", "\\057", ":", "\\072").Replace(host)
+	now := time.Now()
+	name := strconv.FormatInt(now.Unix(), 10) + ".M" + strconv.Itoa(now.Nanosecond()/1000) +
+		"P" + strconv.Itoa(os.Getpid()) + "Q" +
+		strconv.FormatUint(atomic.AddUint64(&maildirDeliveries, 1), 10) + "." + host
+
+	tmp := filepath.Join(t.Dir, "tmp", name)
+	if err := ioutil.WriteFile(tmp, []byte(strings.Replace(withReturnPath(env.From, rfc5322), "\r\n", "\n", -1)), 0600); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(t.Dir, "new", name)); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// An MboxTransport delivers mail by appending it to the mbox file at Path,
+// which is created if necessary, using an MboxWriter. Deliveries by one
+// MboxTransport are serialized, but other programs writing to the same file
+// are not locked out, so the file should belong to this program.
+type MboxTransport struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// Appends \a rfc5322 to the mbox, with a "From " line naming the envelope
+// sender.
+func (t *MboxTransport) Send(env Envelope, rfc5322 string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	f, err := os.OpenFile(t.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	w := NewMboxWriter(f)
+	w.WriteRaw(env.From, time.Now(), withReturnPath(env.From, rfc5322))
+	err = w.Flush()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Returns \a rfc5322 with a Return-Path field naming \a from prepended, as
+// the final delivery agent adds it (RFC 5321 section 4.4), unless \a from is
+// empty.
+func withReturnPath(from, rfc5322 string) string {
+	if from == "" {
+		return rfc5322
+	}
+	return ReturnPathFieldName + ": <" + strings.Trim(from, "<>") + ">\r\n" + rfc5322
+}
@@ -0,0 +1,87 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestLocalTransports(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	text := "From: alice@example.com\r\nTo: bob@example.com\r\nSubject: Hi\r\n\r\nHello\r\n"
+	env := mail.Envelope{From: "alice@example.com", To: []string{"bob@example.com", "carol@example.com"}}
+
+	maildir := &mail.MaildirTransport{Dir: filepath.Join(dir, "Maildir")}
+	for i := 0; i < 2; i++ {
+		if err := maildir.Send(env, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files, err := ioutil.ReadDir(filepath.Join(dir, "Maildir", "new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "maildir files", len(files), 2)
+	b, _ := ioutil.ReadFile(filepath.Join(dir, "Maildir", "new", files[0].Name()))
+	testStringEquals(t, "maildir", string(b), "Return-Path: <alice@example.com>\n"+
+		strings.Replace(text, "\r\n", "\n", -1))
+	if tmp, _ := ioutil.ReadDir(filepath.Join(dir, "Maildir", "tmp")); len(tmp) != 0 {
+		t.Errorf("%d files left in tmp", len(tmp))
+	}
+
+	mbox := &mail.MboxTransport{Path: filepath.Join(dir, "mbox")}
+	for i := 0; i < 2; i++ {
+		if err := mbox.Send(env, text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f, err := os.Open(mbox.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r := mail.NewMboxReader(f)
+	n := 0
+	for {
+		m, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		n++
+		testStringEquals(t, "mbox subject", m.Header.Subject(), "Hi")
+	}
+	testIntegerEquals(t, "mbox messages", n, 2)
+
+	script := filepath.Join(dir, "sendmail")
+	ioutil.WriteFile(script, []byte("#!/bin/sh\necho \"$@\" > \""+dir+"/args\"\ncat > \""+dir+
+		"/stdin\"\n"), 0755)
+	sendmail := &mail.SendmailTransport{Path: script, Args: []string{"-oi"}}
+	if err := sendmail.Send(env, text); err != nil {
+		t.Fatal(err)
+	}
+	args, _ := ioutil.ReadFile(filepath.Join(dir, "args"))
+	testStringEquals(t, "sendmail args", string(args),
+		"-i -f alice@example.com -oi -- bob@example.com carol@example.com\n")
+	stdin, _ := ioutil.ReadFile(filepath.Join(dir, "stdin"))
+	testStringEquals(t, "sendmail input", string(stdin), strings.Replace(text, "\r\n", "\n", -1))
+
+	failing := &mail.SendmailTransport{Path: "/bin/false"}
+	if err := failing.Send(env, text); err == nil {
+		t.Error("a failing sendmail was not reported")
+	}
+}
@@ -0,0 +1,85 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A Logger receives log entries from this package: messages sent by SMTP
+// and received with a BDATReceiver (Info), failures to send (Warn), and the
+// repairs and other diagnostics of the parser (Debug, or Warn for those with
+// SeverityError).
+//
+// Its methods take a message and alternating keys and values, as those of
+// log/slog do, so a *slog.Logger may be used as it is. The keys used include
+// LogMessageID, LogEnvelopeFrom, LogEnvelopeTo and LogQueueID.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// The keys of the values common to many log entries.
+const (
+	LogMessageID    = "message_id"
+	LogEnvelopeFrom = "envelope_from"
+	LogEnvelopeTo   = "envelope_to"
+	LogQueueID      = "queue_id"
+)
+
+// The Logger used by this package. It discards everything unless replaced;
+// like DefaultTracer, it should be replaced before any mail is processed.
+var DefaultLogger Logger = noopLogger{}
+
+type noopLogger struct{}
+
+func (noopLogger) Debug(msg string, args ...interface{}) {}
+func (noopLogger) Info(msg string, args ...interface{})  {}
+func (noopLogger) Warn(msg string, args ...interface{})  {}
+func (noopLogger) Error(msg string, args ...interface{}) {}
+
+// Logs the diagnostics the parser recorded for \a m.
+func logDiagnostics(m *Message) {
+	if _, ok := DefaultLogger.(noopLogger); ok {
+		return
+	}
+	id := ""
+	if m.Header != nil {
+		id = m.Header.MessageID()
+	}
+	for _, d := range m.Diagnostics() {
+		args := []interface{}{LogMessageID, id, "code", d.Code, "part", d.Part,
+			"field", d.Field, "detail", d.Message}
+		if d.Severity == SeverityError {
+			DefaultLogger.Warn("mail: repaired message", args...)
+		} else {
+			DefaultLogger.Debug("mail: repaired message", args...)
+		}
+	}
+}
+
+// Returns the value of the Message-ID field in the unparsed message
+// \a rfc5322, or an empty string if there is none.
+func rawMessageID(rfc5322 string) string {
+	fields, _ := splitRawMessage(rfc5322)
+	for _, f := range fields {
+		if rawFieldName(f) == "message-id" {
+			return strings.TrimSpace(simplify(f[strings.IndexByte(f, ':')+1:]))
+		}
+	}
+	return ""
+}
+
+// Returns the queue ID in the SMTP reply text \a reply, e.g. "ABC123" in
+// "2.0.0 Ok: queued as ABC123", or an empty string if there is none.
+func replyQueueID(reply string) string {
+	lower := strings.ToLower(reply)
+	i := strings.Index(lower, "queued as ")
+	if i < 0 {
+		return ""
+	}
+	if f := strings.Fields(reply[i+len("queued as "):]); len(f) > 0 {
+		return strings.TrimRight(f[0], ".,;)")
+	}
+	return ""
+}
@@ -0,0 +1,46 @@
+package mail_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+type recordingLogger struct {
+	entries []string
+}
+
+func (l *recordingLogger) log(level, msg string, args []interface{}) {
+	s := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		s += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	l.entries = append(l.entries, s)
+}
+
+func (l *recordingLogger) Debug(msg string, args ...interface{}) { l.log("DEBUG", msg, args) }
+func (l *recordingLogger) Info(msg string, args ...interface{})  { l.log("INFO", msg, args) }
+func (l *recordingLogger) Warn(msg string, args ...interface{})  { l.log("WARN", msg, args) }
+func (l *recordingLogger) Error(msg string, args ...interface{}) { l.log("ERROR", msg, args) }
+
+func TestLogger(t *testing.T) {
+	logger := &recordingLogger{}
+	old := mail.DefaultLogger
+	mail.DefaultLogger = logger
+	defer func() {
+		mail.DefaultLogger = old
+	}()
+
+	text := "From: alice@example.com\r\nMessage-ID: <1@example.com>\r\n" +
+		"Content-MD5: AAAAAAAAAAAAAAAAAAAAAA==\r\n\r\nHello\r\n"
+	if _, err := mail.ReadMessage(text); err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "entries", len(logger.entries), 1)
+	if len(logger.entries) == 1 && !strings.HasPrefix(logger.entries[0],
+		"WARN mail: repaired message message_id=<1@example.com> code=content-md5-mismatch") {
+		t.Errorf("unexpected entry %q", logger.entries[0])
+	}
+}
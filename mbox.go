@@ -0,0 +1,200 @@
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"time"
+)
+
+// The layout of the date in an mbox "From " line, as written by ctime(3).
+const mboxDateLayout = "Mon Jan _2 15:04:05 2006"
+
+// An MboxReader reads messages from an mbox file, such as a Google Takeout
+// export, one at a time. Lines quoted as ">From " (or ">>From " and so on,
+// as in the mboxrd format) are unquoted.
+type MboxReader struct {
+	r      *bufio.Reader
+	next   string // the "From " line of the next message, if read
+	offset int64  // of the next line to be read
+	start  int64  // of the current message's "From " line
+	err    error
+}
+
+// Returns a new MboxReader reading from \a r.
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{r: bufio.NewReaderSize(r, 64*1024)}
+}
+
+// Reads a line, including its line ending.
+func (r *MboxReader) readLine() (string, error) {
+	l, err := r.r.ReadString('\n')
+	r.offset += int64(len(l))
+	return l, err
+}
+
+// Returns the next message in the mbox, or io.EOF if there are no more
+// messages. The message is parsed as by ReadMessage().
+func (r *MboxReader) Next() (*Message, error) {
+	raw, err := r.NextRaw()
+	if err != nil {
+		return nil, err
+	}
+	return ReadMessage(raw)
+}
+
+// Returns the text of the next message in the mbox, without its "From "
+// line, or io.EOF if there are no more messages.
+func (r *MboxReader) NextRaw() (string, error) {
+	if r.err != nil {
+		return "", r.err
+	}
+	for r.next == "" {
+		start := r.offset
+		l, err := r.readLine()
+		if strings.HasPrefix(l, "From ") {
+			r.next = l
+			r.start = start
+			break
+		}
+		if err != nil {
+			// a file without any "From " line, or trailing junk
+			r.err = err
+			return "", err
+		}
+	}
+
+	var buf bytes.Buffer
+	for {
+		start := r.offset
+		l, err := r.readLine()
+		if strings.HasPrefix(l, "From ") {
+			r.next = l
+			r.start = start
+			break
+		}
+		r.next = ""
+		if q := strings.TrimLeft(l, ">"); len(q) < len(l) && strings.HasPrefix(q, "From ") {
+			l = l[1:]
+		}
+		buf.WriteString(l)
+		if err != nil {
+			if err != io.EOF {
+				return "", err
+			}
+			r.err = io.EOF
+			break
+		}
+	}
+
+	// the blank line before the next "From " belongs to the mbox
+	s := buf.String()
+	if strings.HasSuffix(s, "\r\n\r\n") {
+		s = s[:len(s)-2]
+	} else if strings.HasSuffix(s, "\n\n") {
+		s = s[:len(s)-1]
+	}
+	return s, nil
+}
+
+// Returns the byte offset in the input of the "From " line of the message
+// the next call to Next() or NextRaw() will return. This may be used to
+// resume reading later by seeking to the offset.
+func (r *MboxReader) Offset() int64 {
+	if r.next != "" {
+		return r.start
+	}
+	return r.offset
+}
+
+// An MboxWriter writes messages to an mbox file, quoting lines which begin
+// with "From " as the mboxrd format does.
+type MboxWriter struct {
+	w   *bufio.Writer
+	err error
+}
+
+// Returns a new MboxWriter writing to \a w. Flush() must be called after the
+// last message is written.
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{w: bufio.NewWriter(w)}
+}
+
+// Writes \a m to the mbox. If \a labels is not nil, the message is written
+// with an X-Gmail-Labels field listing them, replacing any such field it
+// already has, so that Google Takeout exports can be reproduced; \a m itself
+// is not modified.
+//
+// The envelope sender in the "From " line is taken from the Return-Path or
+// From field, and the date from the Date field.
+func (w *MboxWriter) Write(m *Message, labels []string) error {
+	if w.err != nil {
+		return w.err
+	}
+	text := m.RFC822(false)
+	if labels != nil {
+		text = withGmailLabels(text, labels)
+	}
+	return w.WriteRaw(mboxSender(m.Header), mboxDate(m.Header), text)
+}
+
+// Writes the message text \a rfc5322 to the mbox with a "From " line naming
+// \a sender and \a date.
+func (w *MboxWriter) WriteRaw(sender string, date time.Time, rfc5322 string) error {
+	if w.err != nil {
+		return w.err
+	}
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+	w.w.WriteString("From " + sender + " " + date.UTC().Format(mboxDateLayout) + "\n")
+	for len(rfc5322) > 0 {
+		l := rfc5322
+		if i := strings.IndexByte(l, '\n'); i >= 0 {
+			l = l[:i+1]
+		}
+		rfc5322 = rfc5322[len(l):]
+		if strings.HasPrefix(strings.TrimLeft(l, ">"), "From ") {
+			w.w.WriteByte('>')
+		}
+		w.w.WriteString(strings.TrimSuffix(strings.TrimSuffix(l, "\n"), "\r"))
+		w.w.WriteByte('\n')
+	}
+	_, w.err = w.w.WriteString("\n")
+	return w.err
+}
+
+// Writes any buffered data to the underlying writer.
+func (w *MboxWriter) Flush() error {
+	if w.err != nil {
+		return w.err
+	}
+	w.err = w.w.Flush()
+	return w.err
+}
+
+// Returns the envelope sender to use for a message with header \a h.
+func mboxSender(h *Header) string {
+	if h == nil {
+		return ""
+	}
+	for _, name := range []string{ReturnPathFieldName, FromFieldName} {
+		for _, a := range h.Addresses(name) {
+			if a.Domain != "" {
+				return a.lpdomain()
+			}
+		}
+	}
+	return ""
+}
+
+// Returns the date to use for a message with header \a h.
+func mboxDate(h *Header) time.Time {
+	if h != nil {
+		if d := h.Date(); d != nil {
+			return *d
+		}
+	}
+	return time.Now()
+}
@@ -0,0 +1,87 @@
+package mail_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestMboxGmailLabels(t *testing.T) {
+	takeout := "From 1587395616227283459@xxx Mon Jan 02 22:04:05 +0000 2006\n" +
+		"X-GM-THRID: 1587395616227283459\n" +
+		"X-Gmail-Labels: Inbox,Important,\"Work, Projects\",Category Updates\n" +
+		"From: alice@example.com\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\n" +
+		"Subject: One\n" +
+		"\n" +
+		"First\n" +
+		">From the archives\n" +
+		"\n" +
+		"From bob@example.com Tue Jan 03 10:00:00 2006\n" +
+		"From: bob@example.com\n" +
+		"Date: Tue, 3 Jan 2006 10:00:00 +0000\n" +
+		"Subject: Two\n" +
+		"\n" +
+		"Second\n"
+
+	r := mail.NewMboxReader(strings.NewReader(takeout))
+	first, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels := first.Header.GmailLabels()
+	if len(labels) != 4 || labels[2] != "Work, Projects" || labels[3] != "Category Updates" {
+		t.Errorf("unexpected labels %q", labels)
+	}
+	thread, ok := first.Header.GmailThreadID()
+	if !ok || thread != 1587395616227283459 {
+		t.Errorf("unexpected thread id %d", thread)
+	}
+	testStringEquals(t, "unquoted body", first.Text, "First\r\nFrom the archives\r\n")
+	if int(r.Offset()) != strings.Index(takeout, "From bob") {
+		t.Errorf("unexpected offset %d", r.Offset())
+	}
+	second, err := r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "second subject", second.Header.Subject(), "Two")
+	if _, err := r.Next(); err != io.EOF {
+		t.Errorf("expected EOF, got %v", err)
+	}
+
+	var buf bytes.Buffer
+	w := mail.NewMboxWriter(&buf)
+	if err := w.Write(first, []string{"Archived", "Work, Projects"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(second, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(buf.String(), "From alice@example.com Mon Jan  2 22:04:05 2006\n") {
+		t.Errorf("unexpected From line: %q", buf.String())
+	}
+
+	r = mail.NewMboxReader(&buf)
+	first, err = r.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	labels = first.Header.GmailLabels()
+	if len(labels) != 2 || labels[1] != "Work, Projects" {
+		t.Errorf("labels not written: %q", labels)
+	}
+	if !strings.Contains(first.Text, "\nFrom the archives") {
+		t.Errorf("From line not round-tripped: %q", first.Text)
+	}
+	second, err = r.Next()
+	if err != nil || second.Header.GmailLabels() != nil {
+		t.Errorf("unexpected second message: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package mail
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// RFC 3803: the length of audio or video content, in seconds.
+	ContentDurationFieldName = "Content-Duration"
+	// RFC 2912: the media features of the content, e.g. "(& (dpi=200)
+	// (color=grey))" for a fax.
+	ContentFeaturesFieldName = "Content-Features"
+)
+
+// A ContentDuration is a Content-Duration field, which gives the length of
+// audio or video content as a number of seconds.
+type ContentDuration struct {
+	HeaderField
+	Duration time.Duration
+}
+
+func NewContentDuration() *ContentDuration {
+	return &ContentDuration{HeaderField: HeaderField{name: ContentDurationFieldName}}
+}
+
+// Parses \a s, which must be a number of seconds, possibly surrounded by
+// comments.
+func (f *ContentDuration) Parse(s string) {
+	p := newParser(s)
+	p.Comment()
+	start := p.Pos()
+	for !p.AtEnd() && p.NextChar() >= '0' && p.NextChar() <= '9' {
+		p.Step(1)
+	}
+	digits := s[start:p.Pos()]
+	p.Comment()
+	n, err := strconv.Atoi(digits)
+	if err != nil || !p.AtEnd() {
+		f.err = fmt.Errorf("Unparseable value: %q", s)
+		return
+	}
+	f.Duration = time.Duration(n) * time.Second
+	f.value = digits
+}
+
+// Returns the duration given by the Content-Duration field and true, or 0
+// and false if there is no valid Content-Duration field.
+func (h *Header) ContentDuration() (time.Duration, bool) {
+	f, ok := h.field(ContentDurationFieldName, 0).(*ContentDuration)
+	if !ok || !f.Valid() {
+		return 0, false
+	}
+	return f.Duration, true
+}
+
+// An AttachmentInfo describes an attachment without its content, e.g. for
+// a list of attachments shown before any is downloaded.
+//
+// Duration is the length of audio or video content according to its
+// Content-Duration field, and Features the text of its Content-Features
+// field. Width and Height are the dimensions of an image in pixels, which
+// are only known if they were asked for. Each is zero if unknown.
+type AttachmentInfo struct {
+	Filename    string        `json:"filename"`
+	ContentType string        `json:"contentType"`
+	Size        int           `json:"size"`
+	ContentID   string        `json:"contentId,omitempty"`
+	Duration    time.Duration `json:"duration,omitempty"`
+	Features    string        `json:"features,omitempty"`
+	Width       int           `json:"width,omitempty"`
+	Height      int           `json:"height,omitempty"`
+}
+
+// Returns a description of this bodypart as an attachment. If \a images is
+// true and this is a GIF, JPEG or PNG image, its dimensions are read from
+// its content with image.DecodeConfig(), which only reads as far as the
+// image's header.
+func (p *Part) AttachmentInfo(images bool) AttachmentInfo {
+	ct := p.contentType()
+	if ct == "" {
+		ct = p.defaultContentType()
+	}
+	a := AttachmentInfo{Filename: p.Filename(), ContentType: ct, Size: p.Size()}
+	if p.Header != nil {
+		if id := p.Header.Addresses(ContentIDFieldName); len(id) == 1 {
+			a.ContentID = id[0].lpdomain()
+		}
+		if d, ok := p.Header.ContentDuration(); ok &&
+			(strings.HasPrefix(ct, "audio/") || strings.HasPrefix(ct, "video/")) {
+			a.Duration = d
+		}
+		a.Features = simplify(p.Header.Get(ContentFeaturesFieldName))
+	}
+	if images && strings.HasPrefix(ct, "image/") {
+		if r, err := p.Open(); err == nil {
+			if c, _, err := image.DecodeConfig(r); err == nil {
+				a.Width, a.Height = c.Width, c.Height
+			}
+			r.Close()
+		}
+	}
+	return a
+}
+
+// Returns the AttachmentInfo of each of this message's Attachments(),
+// reading the dimensions of images if \a images is true.
+func (m *Message) AttachmentInfos(images bool) []AttachmentInfo {
+	r := []AttachmentInfo{}
+	for _, p := range m.Attachments() {
+		r = append(r, p.AttachmentInfo(images))
+	}
+	return r
+}
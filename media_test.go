@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"image"
+	pngenc "image/png"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAttachmentInfo(t *testing.T) {
+	var png bytes.Buffer
+	img := image.NewGray(image.Rect(0, 0, 40, 30))
+	if err := pngenc.Encode(&png, img); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=b\r\n" +
+		"\r\n--b\r\n" +
+		"Content-Type: text/plain\r\n\r\nHi\r\n" +
+		"--b\r\n" +
+		"Content-Type: audio/ogg\r\n" +
+		"Content-Disposition: attachment; filename=memo.ogg\r\n" +
+		"Content-Duration: 95 (about a minute and a half)\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"T2dnUwACAAAA\r\n" +
+		"--b\r\n" +
+		"Content-Type: image/png\r\n" +
+		"Content-Disposition: inline; filename=chart.png\r\n" +
+		"Content-ID: <chart@example.com>\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		base64.StdEncoding.EncodeToString(png.Bytes()) + "\r\n" +
+		"--b--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	infos := m.AttachmentInfos(true)
+	testIntegerEquals(t, "attachments", len(infos), 2)
+	testStringEquals(t, "audio", infos[0].Filename+" "+infos[0].ContentType, "memo.ogg audio/ogg")
+	testStringEquals(t, "duration", infos[0].Duration.String(), "1m35s")
+	testStringEquals(t, "image", infos[1].Filename+" "+infos[1].ContentID, "chart.png chart@example.com")
+	testIntegerEquals(t, "width", infos[1].Width, 40)
+	testIntegerEquals(t, "height", infos[1].Height, 30)
+	testIntegerEquals(t, "size", infos[1].Size, png.Len())
+
+	infos = m.AttachmentInfos(false)
+	testIntegerEquals(t, "unread width", infos[1].Width, 0)
+
+	f := mail.NewHeaderField(mail.ContentDurationFieldName, "ninety")
+	if f.Valid() {
+		t.Error("an invalid Content-Duration was accepted")
+	}
+}
@@ -2,6 +2,7 @@ package mail
 
 import (
 	"bytes"
+	"io"
 	"strconv"
 )
 
@@ -23,8 +24,24 @@ func ReadMessage(rfc5322 string) (*Message, error) {
 	return m, err
 }
 
-func (m *Message) Parse(rfc5322 string) error {
-	h, err := ReadHeader(rfc5322, RFC5322Header)
+func (m *Message) Parse(rfc5322 string) (err error) {
+	o := startOperation("mail.parse")
+	o.size(len(rfc5322))
+	defer func() {
+		if err == nil && m.Part != nil {
+			parts, _ := m.Part.complexity()
+			o.span.SetAttribute("mail.message.parts", parts)
+			logDiagnostics(m)
+		}
+		o.end(err)
+	}()
+	return m.parse(rfc5322, RFC5322Header, Position{Line: 1})
+}
+
+// Parses \a rfc5322, whose header is of kind \a mode and which is at \a base
+// in the input.
+func (m *Message) parse(rfc5322 string, mode headerMode, base Position) error {
+	h, err := readHeader(rfc5322, mode, base)
 	if err != nil {
 		return err
 	}
@@ -35,9 +52,9 @@ func (m *Message) Parse(rfc5322 string) error {
 
 	ct := h.ContentType()
 	if ct != nil && ct.Type == "multipart" {
-		m.parseMultipart(rfc5322, ct.parameter("boundary"), ct.Subtype == "digest")
+		m.parseMultipart(rfc5322, ct.parameter("boundary"), ct.Subtype == "digest", base)
 	} else {
-		bp := m.parseBodypart(rfc5322[h.numBytes:], h)
+		bp := m.parseBodypart(rfc5322[h.numBytes:], h, base.advance(rfc5322, h.numBytes))
 		m.Part = bp
 	}
 
@@ -52,6 +69,10 @@ func (m *Message) Parse(rfc5322 string) error {
 //
 // If \a avoidUTF8 is true, this function loses information rather than
 // including UTF-8 in the result.
+//
+// The content of bodyparts spilled by a SpillStorage is read back through
+// Part.Open(). If that fails, e.g. after Close(), the content is left out;
+// WriteTo() returns the error instead.
 func (m *Message) RFC822(avoidUTF8 bool) string {
 	var buf *bytes.Buffer
 	if m.RFC822Size > 0 {
@@ -59,31 +80,52 @@ func (m *Message) RFC822(avoidUTF8 bool) string {
 	} else {
 		buf = bytes.NewBuffer(make([]byte, 0, 50000))
 	}
+	m.appendRFC822(buf, avoidUTF8)
+	return buf.String()
+}
+
+// Writes the message to \a w as RFC822(false) formats it, and returns the
+// number of bytes written. Unlike RFC822(), WriteTo() returns an error if
+// the content of a spilled bodypart cannot be read back.
+func (m *Message) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	if err := m.appendRFC822(&buf, false); err != nil {
+		return 0, err
+	}
+	return buf.WriteTo(w)
+}
 
+// Appends the message to \a buf as RFC822() formats it. Returns the first
+// error met while reading spilled content, after appending the rest.
+func (m *Message) appendRFC822(buf *bytes.Buffer, avoidUTF8 bool) error {
 	buf.WriteString(m.Header.AsText(avoidUTF8))
 	buf.WriteString(crlf)
-	buf.WriteString(m.Body(avoidUTF8))
-
-	return buf.String()
+	return m.appendBody(buf, avoidUTF8)
 }
 
 // Returns the text representation of the body of this message.
 func (m *Message) Body(avoidUTF8 bool) string {
 	buf := new(bytes.Buffer)
+	m.appendBody(buf, avoidUTF8)
+	return buf.String()
+}
 
+// Appends the text representation of the body of this message to \a buf.
+func (m *Message) appendBody(buf *bytes.Buffer, avoidUTF8 bool) error {
 	ct := m.Header.ContentType()
 	if ct != nil && ct.Type == "multipart" {
-		m.appendMultipart(buf, avoidUTF8)
-	} else {
-		// FIXME: Is this the right place to restore this linkage?
-		if len(m.Parts) > 0 {
-			firstChild := m.Parts[0]
-			firstChild.Header = m.Header
-			m.appendAnyPart(buf, firstChild, ct, avoidUTF8)
-		}
+		return m.appendMultipart(buf, avoidUTF8)
 	}
-
-	return buf.String()
+	// FIXME: Is this the right place to restore this linkage?
+	if len(m.Parts) > 0 {
+		firstChild := m.Parts[0]
+		firstChild.Header = m.Header
+		return m.appendAnyPart(buf, firstChild, ct, avoidUTF8)
+	} else if m.Header != nil {
+		// a single-part message is its own bodypart
+		return m.appendAnyPart(buf, m.Part, ct, avoidUTF8)
+	}
+	return nil
 }
 
 // Returns a pointer to the Bodypart whose IMAP part number is \a s and
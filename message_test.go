@@ -2,6 +2,8 @@ package mail_test
 
 import (
 	"testing"
+
+	"github.com/jimexcel/mail"
 )
 
 func TestPlainBody(t *testing.T) {
@@ -121,3 +123,19 @@ func TestMalformedMultipartTerminator(t *testing.T) {
 	// 32756 = byte length of original file
 	testIntegerEquals(t, "Part 2 data size", len(parts[1].Data), 32756)
 }
+
+func TestHeaderOnlyMessage(t *testing.T) {
+	for _, s := range []string{
+		"From: a@example.com",
+		"From: a@example.com\r",
+		"From: a@example.com\r\nSubject: x",
+	} {
+		msg, err := mail.ReadMessage(s)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		if len(msg.Header.All("From")) != 1 {
+			t.Errorf("%q: From field is missing", s)
+		}
+	}
+}
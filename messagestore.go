@@ -0,0 +1,191 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// A MessageStore keeps the text of messages, e.g. an archive of all mail
+// received, under IDs chosen by its user. If the store's Compression is not
+// nil, messages are stored compressed, and Open() decompresses them as they
+// are read, so ReadStoredMessage() streams them into the parser. DirStore
+// keeps messages in files and SQLStore in an SQLite table.
+//
+// Put stores \a rfc5322 as \a id, replacing any message stored as \a id.
+// Open returns a reader of the message stored as \a id, which the caller
+// must close, and Delete removes it; both return ErrNotStored if there is
+// no such message.
+type MessageStore interface {
+	Put(id, rfc5322 string) error
+	Open(id string) (io.ReadCloser, error)
+	Delete(id string) error
+}
+
+// Reads the message \a id from \a s and parses it.
+func ReadStoredMessage(s MessageStore, id string) (*Message, error) {
+	r, err := s.Open(id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	return ReadMessage(string(b))
+}
+
+// A DirStore is a MessageStore keeping each message in Dir, in a file named
+// after its ID with the suffix ".eml", and if Compression is not nil, the
+// additional suffix ".gz", ".z" or ".zst". Messages are read whether
+// compressed or not, so Compression may be set for an existing store; it
+// must keep the same Dictionary as long as messages compressed with it
+// remain.
+//
+// IDs may contain ASCII letters, digits, '-', '_' and '.', but may not
+// begin with '.'.
+type DirStore struct {
+	Dir         string
+	Compression *Compression
+}
+
+// Returns a DirStore keeping messages in \a dir, which is created if
+// necessary.
+func NewDirStore(dir string) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DirStore{Dir: dir}, nil
+}
+
+func (s *DirStore) Put(id, rfc5322 string) error {
+	if !validStoreID(id) {
+		return ErrNotStored
+	}
+	return writeCompressed(s.path(id), []byte(rfc5322), s.Compression)
+}
+
+func (s *DirStore) Open(id string) (io.ReadCloser, error) {
+	if !validStoreID(id) {
+		return nil, ErrNotStored
+	}
+	r, err := openCompressed(s.path(id), s.Compression)
+	if os.IsNotExist(err) {
+		return nil, ErrNotStored
+	}
+	return r, err
+}
+
+func (s *DirStore) Delete(id string) error {
+	if !validStoreID(id) {
+		return ErrNotStored
+	}
+	err := removeCompressed(s.path(id))
+	if os.IsNotExist(err) {
+		return ErrNotStored
+	}
+	return err
+}
+
+// Returns the name of the file holding the message \a id, without the
+// suffix of its compression.
+func (s *DirStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".eml")
+}
+
+// Returns true if \a id may name a message in a DirStore, i.e. cannot name
+// a file outside it.
+func validStoreID(id string) bool {
+	if id == "" || id[0] == '.' {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' ||
+			c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes \a b, compressed with \a c if it is not nil, to the file \a path
+// with the suffix c.suffix(), and removes any copy with another suffix.
+func writeCompressed(path string, b []byte, c *Compression) error {
+	suffix := ""
+	if c != nil {
+		var err error
+		if b, err = c.compress(b); err != nil {
+			return err
+		}
+		suffix = c.suffix()
+	}
+	if err := writeFileAtomically(path+suffix, b); err != nil {
+		return err
+	}
+	for _, other := range compressionSuffixes {
+		if other != suffix {
+			os.Remove(path + other)
+		}
+	}
+	return nil
+}
+
+// Opens the file \a path, with whichever suffix writeCompressed() gave it,
+// and returns a reader which decompresses it using \a c as
+// Compression.NewReader() does. Returns an error satisfying os.IsNotExist()
+// if there is no such file.
+func openCompressed(path string, c *Compression) (io.ReadCloser, error) {
+	for _, suffix := range compressionSuffixes {
+		f, err := os.Open(path + suffix)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if suffix == "" {
+			return f, nil
+		}
+		r, err := c.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		return &closeBoth{r, f}, nil
+	}
+	return nil, os.ErrNotExist
+}
+
+// Removes the file \a path, with whichever suffix writeCompressed() gave
+// it. Returns an error satisfying os.IsNotExist() if there is none.
+func removeCompressed(path string) error {
+	for _, suffix := range compressionSuffixes {
+		if err := os.Remove(path + suffix); err == nil {
+			return nil
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return os.ErrNotExist
+}
+
+// A closeBoth reads from a decompressing reader, and closes both it and the
+// file it reads.
+type closeBoth struct {
+	io.ReadCloser
+	f *os.File
+}
+
+func (c *closeBoth) Close() error {
+	err := c.ReadCloser.Close()
+	if ferr := c.f.Close(); err == nil {
+		err = ferr
+	}
+	return err
+}
@@ -0,0 +1,79 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// Stores, reads, replaces and deletes a message in \a s.
+func testMessageStore(t *testing.T, name string, s mail.MessageStore) {
+	text := "From: alice@example.com\r\nSubject: Stored\r\n\r\nHello\r\n"
+	if err := s.Put("a-1", text); err != nil {
+		t.Fatal(err)
+	}
+	m, err := mail.ReadStoredMessage(s, "a-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, name+" subject", m.Header.Subject(), "Stored")
+
+	if err := s.Put("a-1", text+"Again\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := s.Open("a-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, name+" replaced", string(b), text+"Again\r\n")
+
+	if err := s.Delete("a-1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open("a-1"); err != mail.ErrNotStored {
+		t.Errorf("%s: deleted message: %v", name, err)
+	}
+	if err := s.Delete("a-1"); err != mail.ErrNotStored {
+		t.Errorf("%s: deleted twice: %v", name, err)
+	}
+}
+
+func TestDirStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, c := range []*mail.Compression{nil, {}, {Format: mail.CompressZstd}} {
+		s, err := mail.NewDirStore(dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s.Compression = c
+		testMessageStore(t, "dir", s)
+	}
+
+	// changing the compression leaves one copy of a message
+	s, _ := mail.NewDirStore(dir)
+	s.Put("b", "From: bob@example.com\r\n\r\nHi\r\n")
+	s.Compression = &mail.Compression{Format: mail.CompressZstd}
+	s.Put("b", "From: bob@example.com\r\n\r\nHi again\r\n")
+	files, _ := filepath.Glob(filepath.Join(dir, "b.eml*"))
+	if len(files) != 1 || filepath.Ext(files[0]) != ".zst" {
+		t.Errorf("files: %v", files)
+	}
+	if err := s.Put("../escape", "From: x@example.com\r\n\r\n"); err != mail.ErrNotStored {
+		t.Errorf("invalid ID: %v", err)
+	}
+}
@@ -0,0 +1,239 @@
+package mail
+
+import (
+	"net/url"
+	"strings"
+)
+
+const (
+	// Written by Chrome and other Blink-based browsers: the URL of the
+	// page saved.
+	SnapshotContentLocationFieldName = "Snapshot-Content-Location"
+)
+
+// Returns true if this message is an MHTML web archive (RFC 2557), such as
+// the .mht and .mhtml files saved by browsers and Outlook: a
+// multipart/related message whose root part is HTML.
+func (m *Message) IsMHTML() bool {
+	if m.Header == nil {
+		return false
+	}
+	ct := m.Header.ContentType()
+	if ct == nil || ct.Type != "multipart" || ct.Subtype != "related" {
+		return false
+	}
+	root := m.Part.RelatedRoot()
+	return root != nil && root.contentType() == "text/html"
+}
+
+// Returns the root of this multipart/related part, i.e. the child named by
+// the start parameter, or the first child if there is no start parameter.
+// Returns nil if this is not a multipart/related part, or has no children.
+func (p *Part) RelatedRoot() *Part {
+	if p.Header == nil || p.contentType() != "multipart/related" || len(p.Parts) == 0 {
+		return nil
+	}
+	start := p.Header.ContentType().parameter("start")
+	if start != "" {
+		for _, c := range p.Parts {
+			if c.Header != nil && sameContentID(c.Header.Get(ContentIDFieldName), start) {
+				return c
+			}
+		}
+	}
+	return p.Parts[0]
+}
+
+// Returns the child of this multipart/related part which \a ref, a URL found
+// in the child \a from, refers to, or nil if there is none.
+//
+// "cid:" URLs are matched against the Content-ID fields of the children.
+// Other URLs are resolved against the Content-Base or Content-Location of
+// \a from, the multipart itself or the message (including Blink's
+// Snapshot-Content-Location), as described in RFC 2557 section 5, and
+// matched against the children's Content-Location fields.
+func (p *Part) Resolve(ref string, from *Part) *Part {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	if strings.HasPrefix(strings.ToLower(ref), "cid:") {
+		id, err := url.PathUnescape(ref[4:])
+		if err != nil {
+			id = ref[4:]
+		}
+		for _, c := range p.Parts {
+			if c.Header != nil && sameContentID(c.Header.Get(ContentIDFieldName), id) {
+				return c
+			}
+		}
+		return nil
+	}
+
+	base := p.relatedBase("")
+	target := resolveURL(from.relatedBase(base), ref)
+	if target == "" {
+		return nil
+	}
+	for _, c := range p.Parts {
+		if c == from || c.Header == nil {
+			continue
+		}
+		if l := c.Header.ContentLocation(); l != "" && resolveURL(base, l) == target {
+			return c
+		}
+	}
+	return nil
+}
+
+// Returns the bodypart of this message whose Content-ID is \a id, with or
+// without angle brackets, or nil if there is none. The parts of embedded
+// messages are not searched.
+func (m *Message) PartByContentID(id string) *Part {
+	if m.Part == nil {
+		return nil
+	}
+	return m.Part.partByContentID(id)
+}
+
+// Returns this part or the first of its descendants outside embedded
+// messages whose Content-ID is \a id, or nil.
+func (p *Part) partByContentID(id string) *Part {
+	if p.Header != nil && sameContentID(p.Header.Get(ContentIDFieldName), id) {
+		return p
+	}
+	if p.message != nil {
+		return nil
+	}
+	for _, c := range p.Parts {
+		if r := c.partByContentID(id); r != nil {
+			return r
+		}
+	}
+	return nil
+}
+
+// Returns the base URL for URLs in this part: its Content-Base or absolute
+// Content-Location, or \a parent if it has neither. For a message, the
+// Snapshot-Content-Location field is also considered.
+func (p *Part) relatedBase(parent string) string {
+	base := parent
+	if p == nil || p.Header == nil {
+		return base
+	}
+	for _, name := range []string{ContentBaseFieldName, ContentLocationFieldName,
+		SnapshotContentLocationFieldName} {
+		v := simplify(p.Header.Get(name))
+		if v == "" {
+			continue
+		}
+		if u, err := url.Parse(v); err == nil && u.IsAbs() {
+			return v
+		}
+		if base != "" {
+			return resolveURL(base, v)
+		}
+	}
+	return base
+}
+
+// Returns \a ref resolved against \a base, without any fragment, or an empty
+// string if either cannot be parsed.
+func resolveURL(base, ref string) string {
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	if base != "" {
+		b, err := url.Parse(base)
+		if err != nil {
+			return ""
+		}
+		r = b.ResolveReference(r)
+	}
+	r.Fragment = ""
+	return r.String()
+}
+
+// Returns true if the Content-ID field value \a a and the (possibly
+// bracketless) id \a b refer to the same id.
+func sameContentID(a, b string) bool {
+	trim := func(s string) string {
+		return strings.TrimSuffix(strings.TrimPrefix(simplify(s), "<"), ">")
+	}
+	return trim(a) != "" && trim(a) == trim(b)
+}
+
+// Attributes which refer to resources to be embedded in a page.
+var resourceAttributes = []string{"src", "background", "poster", "data"}
+
+// Returns the HTML of the page archived in this MHTML message, with each
+// reference to another part of the archive (images, style sheets, frames and
+// so on) replaced by a data: URL holding that part, so that the page can be
+// displayed without the archive. Links to other pages (a href) are made
+// absolute instead. Returns an empty string if this is not an MHTML message.
+func (m *Message) ReconstructHTML() string {
+	if !m.IsMHTML() {
+		return ""
+	}
+	return m.Part.embedRelated(m.Part.RelatedRoot(), 0)
+}
+
+// Returns the text of \a root, a child of this multipart/related part, with
+// references to its siblings replaced by data: URLs. \a depth limits the
+// recursion into embedded frames.
+func (p *Part) embedRelated(root *Part, depth int) string {
+	tokens := htmlTokenize(root.Text)
+	base := root.relatedBase(p.relatedBase(""))
+	for i := range tokens {
+		t := &tokens[i]
+		if t.t != htmlStartTagToken && t.t != htmlSelfClosingTagToken {
+			continue
+		}
+		if v, ok := t.attr("href"); ok {
+			if t.tag == "link" {
+				if c := p.Resolve(v, root); c != nil {
+					t.setAttr("href", dataURL(c, ""))
+				}
+			} else if strings.HasPrefix(v, "#") {
+				// within the page
+			} else if abs := resolveURL(base, v); abs != "" && abs != v {
+				t.setAttr("href", abs)
+			}
+		}
+		for _, name := range resourceAttributes {
+			v, ok := t.attr(name)
+			if !ok {
+				continue
+			}
+			c := p.Resolve(v, root)
+			if c == nil {
+				continue
+			}
+			if c.contentType() == "text/html" && depth < 4 && c != root {
+				// a frame, which may have resources of its own
+				t.setAttr(name, dataURL(c, p.embedRelated(c, depth+1)))
+			} else {
+				t.setAttr(name, dataURL(c, ""))
+			}
+		}
+	}
+	return htmlRender(tokens)
+}
+
+// Returns a data: URL holding the content of \a c, or \a text if it is not
+// empty.
+func dataURL(c *Part, text string) string {
+	s := text
+	if s == "" {
+		s, _ = c.data()
+		if c.hasText {
+			s = c.Text
+		}
+	}
+	ct := c.contentType()
+	if ct == "" {
+		ct = "text/plain"
+	}
+	return "data:" + ct + ";base64," + e64(s, 0)
+}
@@ -0,0 +1,41 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMHTML(t *testing.T) {
+	msg := loadFixture(t, "mhtml")
+	if !msg.IsMHTML() {
+		t.Fatal("MHTML archive not recognised")
+	}
+	root := msg.RelatedRoot()
+	if root == nil || root != msg.Parts[0] {
+		t.Fatal("wrong root part")
+	}
+	if c := msg.Resolve("images/logo.png", root); c != msg.Parts[2] {
+		t.Error("relative image URL not resolved")
+	}
+	if c := msg.Resolve("https://www.example.com/docs/style.css#x", root); c != msg.Parts[1] {
+		t.Error("absolute style sheet URL not resolved")
+	}
+	if msg.Resolve("missing.png", root) != nil {
+		t.Error("missing resource resolved")
+	}
+
+	html := msg.ReconstructHTML()
+	for _, s := range []string{
+		"href=\"data:text/css;base64,Ym9keSB7IGNvbG9yOiByZWQ7IH0NCg==\"",
+		"src=\"data:image/png;base64,iVBORw0KGgo=\"",
+		"href=\"https://www.example.com/about.html\"",
+	} {
+		if !strings.Contains(html, s) {
+			t.Errorf("reconstructed page lacks %s: %s", s, html)
+		}
+	}
+
+	if loadFixture(t, "multipart").IsMHTML() {
+		t.Error("multipart message taken for MHTML")
+	}
+}
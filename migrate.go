@@ -0,0 +1,57 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A MigrationTarget receives the messages of a Migration, e.g. a Store or a
+// wrapper around an IMAP client which APPENDs them.
+//
+// Append is called with the folder the message belongs in, using "/" as the
+// hierarchy separator, and the message's labels (for sources which have
+// them; otherwise nil). If Append returns an error, the migration stops, and
+// can be resumed from that message.
+type MigrationTarget interface {
+	Append(folder string, m *Message, labels []string) error
+}
+
+// Gmail's system labels, as Takeout names them, and the folders they
+// correspond to. Labels mapped to "" say nothing about the folder.
+var takeoutSystemLabels = map[string]string{
+	"Inbox":     "INBOX",
+	"Sent":      "Sent",
+	"Drafts":    "Drafts",
+	"Spam":      "Junk",
+	"Trash":     "Trash",
+	"Chat":      "Chats",
+	"Archived":  "",
+	"Important": "",
+	"Starred":   "",
+	"Opened":    "",
+	"Unread":    "",
+}
+
+// Returns the folder a message with the Gmail \a labels belongs in: the
+// folder corresponding to Trash, Spam, Drafts, Sent or Inbox if it has one of
+// those labels, in that order of precedence, otherwise its first user label,
+// otherwise "Archive". Category labels ("Category Promotions" etc.) are not
+// used as folders.
+func TakeoutFolder(labels []string) string {
+	for _, l := range []string{"Trash", "Spam", "Drafts", "Sent", "Inbox"} {
+		for _, label := range labels {
+			if label == l {
+				return takeoutSystemLabels[l]
+			}
+		}
+	}
+	for _, label := range labels {
+		if _, system := takeoutSystemLabels[label]; system {
+			continue
+		}
+		if strings.HasPrefix(label, "Category ") {
+			continue
+		}
+		return label
+	}
+	return "Archive"
+}
@@ -0,0 +1,145 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+type memoryTarget struct {
+	folders map[string][]string
+}
+
+func (t *memoryTarget) Append(folder string, m *mail.Message, labels []string) error {
+	t.folders[folder] = append(t.folders[folder], m.Header.Subject())
+	return nil
+}
+
+func TestMigrateReadpst(t *testing.T) {
+	dir, err := ioutil.TempDir("", "readpst")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	message := func(subject string) string {
+		return "From: alice@example.com\nDate: Mon, 2 Jan 2006 15:04:05 -0700\n" +
+			"Subject: " + subject + "\n\nHello\n"
+	}
+	files := map[string]string{
+		"Inbox/mbox": "From alice@example.com Mon Jan  2 22:04:05 2006\n" + message("one") + "\n" +
+			"From alice@example.com Mon Jan  2 22:04:05 2006\n" + message("two") + "\n",
+		"Sent Items/mbox":       "From alice@example.com Mon Jan  2 22:04:05 2006\n" + message("three"),
+		"Projects/Budget/1.eml": message("four"),
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, "pst", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the third message fails; a second run must resume with it
+	target := &memoryTarget{folders: map[string][]string{}}
+	progress := 0
+	mg := mail.NewMigration(&failAfter{t: target, n: 2})
+	mg.StatePath = filepath.Join(dir, "state.json")
+	mg.Progress = func(p mail.MigrationProgress) { progress = p.Messages }
+	if err := mg.MigrateReadpst(filepath.Join(dir, "pst")); err == nil {
+		t.Fatal("expected the migration to stop")
+	}
+	testIntegerEquals(t, "messages before failure", progress, 2)
+
+	mg = mail.NewMigration(target)
+	mg.StatePath = filepath.Join(dir, "state.json")
+	if err := mg.MigrateReadpst(filepath.Join(dir, "pst")); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "Inbox", strings.Join(target.folders["Inbox"], ","), "one,two")
+	testStringEquals(t, "Sent Items", strings.Join(target.folders["Sent Items"], ","), "three")
+	testStringEquals(t, "Projects/Budget", strings.Join(target.folders["Projects/Budget"], ","), "four")
+}
+
+// A MigrationTarget which fails after \a n messages.
+type failAfter struct {
+	t mail.MigrationTarget
+	n int
+}
+
+func (f *failAfter) Append(folder string, m *mail.Message, labels []string) error {
+	if f.n == 0 {
+		return errors.New("target unavailable")
+	}
+	f.n--
+	return f.t.Append(folder, m, labels)
+}
+
+func TestTakeoutFolder(t *testing.T) {
+	testStringEquals(t, "inbox", mail.TakeoutFolder([]string{"Important", "Inbox", "Work"}), "INBOX")
+	testStringEquals(t, "user label", mail.TakeoutFolder([]string{"Archived", "Category Updates", "Work"}), "Work")
+	testStringEquals(t, "spam", mail.TakeoutFolder([]string{"Spam", "Inbox"}), "Junk")
+	testStringEquals(t, "archive", mail.TakeoutFolder([]string{"Opened"}), "Archive")
+}
+
+func TestMigrationFailures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "takeout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	from := "From alice@example.com Mon Jan  2 22:04:05 2006\n"
+	message := func(subject string) string {
+		return "From: alice@example.com\nSubject: " + subject + "\n\nHello\n"
+	}
+	mbox := from + message("one") + "\n" + from + message("bad") + "\n" + from + message("three")
+	path := filepath.Join(dir, "All mail.mbox")
+	if err := ioutil.WriteFile(path, []byte(mbox), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	target := &memoryTarget{folders: map[string][]string{}}
+	var progress mail.MigrationProgress
+	mg := mail.NewMigration(target)
+	mg.StatePath = filepath.Join(dir, "state.json")
+	mg.Progress = func(p mail.MigrationProgress) { progress = p }
+	mg.Parse = func(rfc5322 string) (*mail.Message, error) {
+		if strings.Contains(rfc5322, "Subject: bad") {
+			return nil, errors.New("unparseable")
+		}
+		return mail.ReadMessage(rfc5322)
+	}
+	if err := mg.MigrateTakeout(path); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "migrated", strings.Join(target.folders["Archive"], ","), "one,three")
+	testIntegerEquals(t, "messages", progress.Messages, 2)
+	testIntegerEquals(t, "failures", len(progress.Failures), 1)
+	if len(progress.Failures) == 1 {
+		f := progress.Failures[0]
+		testStringEquals(t, "failure", f.Error, "unparseable")
+		testIntegerEquals(t, "failure offset", int(f.Offset), strings.Index(mbox, from+message("bad")))
+	}
+
+	// a resumed migration does not try the failed message again
+	mg = mail.NewMigration(target)
+	mg.StatePath = filepath.Join(dir, "state.json")
+	mg.Parse = func(rfc5322 string) (*mail.Message, error) {
+		t.Errorf("message parsed again: %q", rfc5322)
+		return mail.ReadMessage(rfc5322)
+	}
+	if err := mg.MigrateTakeout(path); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "after resuming", strings.Join(target.folders["Archive"], ","), "one,three")
+}
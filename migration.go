@@ -0,0 +1,325 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// MigrationProgress describes how far a Migration has got. Source is the file
+// being read, Bytes how much of it has been read, and Size its size. Messages
+// counts the messages appended so far in this run, and Skipped those passed
+// over because an earlier run had appended them. Failures lists the messages
+// which could not be parsed in this run, and which were passed over.
+type MigrationProgress struct {
+	Source   string             `json:"source"`
+	Bytes    int64              `json:"bytes"`
+	Size     int64              `json:"size"`
+	Messages int                `json:"messages"`
+	Skipped  int                `json:"skipped"`
+	Failures []MigrationFailure `json:"failures,omitempty"`
+}
+
+// A MigrationFailure describes a message a Migration could not parse: the
+// file it is in, its offset in that file, and the error.
+type MigrationFailure struct {
+	Source string `json:"source"`
+	Offset int64  `json:"offset"`
+	Error  string `json:"error"`
+}
+
+// A Migration copies messages from a Google Takeout mbox file or from the
+// output of readpst (which converts Outlook PST files) into a
+// MigrationTarget.
+//
+// Each message is parsed, and thereby repaired and converted to UTF-8, by
+// Parse, or if Parse is nil, by ReadMessage(), before being appended. A
+// message which cannot be parsed is recorded in the progress's Failures and
+// passed over, so that one bad message neither stops the migration nor
+// stops it again when it is resumed; a failure to read a source or to
+// append to Target stops the migration.
+//
+// If StatePath is not empty, the migration records in that file how far it
+// has got in each source, and a later migration with the same StatePath
+// continues where the earlier one stopped instead of appending the same
+// messages again. Progress, if not nil, is called after each message.
+//
+// Folder chooses the folder for a Takeout message from its Gmail labels. If
+// it is nil, TakeoutFolder() is used.
+type Migration struct {
+	Target    MigrationTarget
+	StatePath string
+	Progress  func(MigrationProgress)
+	Folder    func(labels []string) string
+	Parse     func(rfc5322 string) (*Message, error)
+
+	state    map[string]int64
+	progress MigrationProgress
+}
+
+// Returns a new Migration to \a target.
+func NewMigration(target MigrationTarget) *Migration {
+	return &Migration{Target: target}
+}
+
+// Migrates the messages in the Google Takeout mbox file at \a path. Each
+// message is appended to the folder chosen by Folder, with its labels.
+func (mg *Migration) MigrateTakeout(path string) error {
+	if err := mg.loadState(); err != nil {
+		return err
+	}
+	return mg.migrateMbox(path, "")
+}
+
+// Migrates the output of readpst in the directory \a dir. Both the mbox
+// files of "readpst -r" and the separate message files of "readpst -e" or
+// "readpst -S" are understood. The folder of each message is the directory
+// (or for mbox files not called "mbox", the file) it was found in, relative
+// to \a dir.
+func (mg *Migration) MigrateReadpst(dir string) error {
+	if err := mg.loadState(); err != nil {
+		return err
+	}
+	paths := []string{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Mode().IsRegular() {
+			paths = append(paths, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		folder := ""
+		if i := strings.LastIndexByte(rel, '/'); i >= 0 {
+			folder = rel[:i]
+		}
+		isMbox, err := looksLikeMbox(path)
+		if err != nil {
+			return err
+		}
+		if isMbox {
+			if base := filepath.Base(path); base != "mbox" {
+				folder = strings.TrimPrefix(folder+"/"+base, "/")
+			}
+			if folder == "" {
+				folder = "INBOX"
+			}
+			err = mg.migrateMbox(path, folder)
+		} else if strings.HasSuffix(strings.ToLower(path), ".eml") ||
+			isAllDigits(filepath.Base(path)) {
+			if folder == "" {
+				folder = "INBOX"
+			}
+			err = mg.migrateFile(path, folder)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Migrates the mbox file at \a path into \a folder, or if \a folder is empty,
+// into the folders chosen by the messages' Gmail labels.
+func (mg *Migration) migrateMbox(path, folder string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	done := mg.state[path]
+	if done > 0 {
+		if _, err := f.Seek(done, io.SeekStart); err != nil {
+			return err
+		}
+	}
+	mg.progress.Source = path
+	mg.progress.Size = info.Size()
+	mg.progress.Bytes = done
+
+	r := NewMboxReader(f)
+	for {
+		start := done + r.Offset()
+		raw, err := r.NextRaw()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		m, err := mg.parse(raw)
+		if err != nil {
+			if err := mg.fail(path, start, done+r.Offset(), err); err != nil {
+				return err
+			}
+			continue
+		}
+		var labels []string
+		target := folder
+		if folder == "" {
+			labels = m.Header.GmailLabels()
+			if mg.Folder != nil {
+				target = mg.Folder(labels)
+			} else {
+				target = TakeoutFolder(labels)
+			}
+		}
+		if err := mg.Target.Append(target, m, labels); err != nil {
+			return err
+		}
+		if err := mg.advance(path, done+r.Offset()); err != nil {
+			return err
+		}
+	}
+}
+
+// Migrates the single message in the file at \a path into \a folder.
+func (mg *Migration) migrateFile(path, folder string) error {
+	mg.progress.Source = path
+	if mg.state[path] > 0 {
+		mg.progress.Skipped++
+		mg.report()
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	mg.progress.Size = int64(len(b))
+	m, err := mg.parse(string(b))
+	if err != nil {
+		return mg.fail(path, 0, int64(len(b)), err)
+	}
+	if err := mg.Target.Append(folder, m, nil); err != nil {
+		return err
+	}
+	return mg.advance(path, int64(len(b)))
+}
+
+// Parses \a rfc5322 using Parse or ReadMessage().
+func (mg *Migration) parse(rfc5322 string) (*Message, error) {
+	if mg.Parse != nil {
+		return mg.Parse(rfc5322)
+	}
+	return ReadMessage(rfc5322)
+}
+
+// Records that \a source has been read up to \a offset, and reports
+// progress.
+func (mg *Migration) advance(source string, offset int64) error {
+	mg.progress.Messages++
+	return mg.record(source, offset)
+}
+
+// Records that the message at \a start in \a source could not be parsed
+// because of \a err, and that \a source has been read up to \a offset.
+func (mg *Migration) fail(source string, start, offset int64, err error) error {
+	mg.progress.Failures = append(mg.progress.Failures,
+		MigrationFailure{Source: source, Offset: start, Error: err.Error()})
+	return mg.record(source, offset)
+}
+
+// Saves the state with \a source read up to \a offset, and reports
+// progress.
+func (mg *Migration) record(source string, offset int64) error {
+	mg.state[source] = offset
+	mg.progress.Bytes = offset
+	if err := mg.saveState(); err != nil {
+		return err
+	}
+	mg.report()
+	return nil
+}
+
+// Calls Progress, if set.
+func (mg *Migration) report() {
+	if mg.Progress != nil {
+		mg.Progress(mg.progress)
+	}
+}
+
+// Reads the state saved by an earlier migration, if there is any.
+func (mg *Migration) loadState() error {
+	if mg.state != nil {
+		return nil
+	}
+	mg.state = map[string]int64{}
+	if mg.StatePath == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(mg.StatePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &mg.state)
+}
+
+// Saves the state, so that a later migration can resume. The file is
+// replaced atomically, so that a crash cannot leave a truncated state.
+func (mg *Migration) saveState() error {
+	if mg.StatePath == "" {
+		return nil
+	}
+	b, err := json.Marshal(mg.state)
+	if err != nil {
+		return err
+	}
+	tmp := mg.StatePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, mg.StatePath)
+}
+
+// Returns true if the file at \a path starts with an mbox "From " line.
+func looksLikeMbox(path string) (bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	b := make([]byte, 5)
+	n, err := io.ReadFull(f, b)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return string(b[:n]) == "From ", nil
+}
+
+// Returns true if \a s is a non-empty string of digits, as readpst names
+// the files it writes with -S.
+func isAllDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
@@ -0,0 +1,256 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+// An MXDialer connects to the servers which receive mail for a domain, as
+// a mail transfer agent does: it tries the domain's MX hosts in order of
+// preference, or the domain itself if it has no MX records, and each
+// host's IPv6 and IPv4 addresses with Happy Eyeballs (RFC 8305), so that
+// a broken IPv6 route does not hold up delivery.
+//
+// Resolver looks up MX records; if nil, DefaultResolver is used. LookupIP
+// looks up the addresses of a host; if nil, net.LookupIP() is used. Dial
+// connects to an address; if nil, net.Dial() is used. Port is the port
+// connected to, "25" if empty.
+//
+// AttemptTimeout limits each attempt to connect to one address, 30 seconds
+// if zero. Addresses of a host alternate between IPv6 and IPv4, starting
+// with IPv6; if an attempt has not succeeded or failed after
+// FallbackDelay (250ms if zero), the next one starts alongside it, and
+// the first connection made is used.
+type MXDialer struct {
+	Resolver       Resolver
+	LookupIP       func(host string) ([]net.IP, error)
+	Dial           DialFunc
+	Port           string
+	AttemptTimeout time.Duration
+	FallbackDelay  time.Duration
+}
+
+// An MXFailure says why connecting to Host, one of a domain's MX hosts,
+// failed. Address is the address tried, e.g. "192.0.2.1:25", or empty if
+// the host's addresses could not be looked up.
+type MXFailure struct {
+	Host    string
+	Address string
+	Err     error
+}
+
+func (f MXFailure) String() string {
+	if f.Address == "" {
+		return f.Host + ": " + f.Err.Error()
+	}
+	return f.Host + " (" + f.Address + "): " + f.Err.Error()
+}
+
+// An MXError is returned by MXDialer.DialDomain() when no server receiving
+// mail for Domain could be reached. Failures lists each attempt in the order
+// in which it failed.
+type MXError struct {
+	Domain   string
+	Failures []MXFailure
+}
+
+func (e *MXError) Error() string {
+	r := []string{}
+	for _, f := range e.Failures {
+		r = append(r, f.String())
+	}
+	return "mail: could not connect to any server for " + e.Domain + ": " + strings.Join(r, "; ")
+}
+
+// Connects to a server receiving mail for \a domain, as described for
+// MXDialer, and returns the connection and the name of the MX host it is
+// to, which should be used in STARTTLS and in reports.
+//
+// Returns an error matching ErrNullMX if the domain has a null MX (RFC
+// 7505), i.e. accepts no mail, and an *MXError listing each failed attempt
+// if no attempt succeeded.
+func (d *MXDialer) DialDomain(domain string) (net.Conn, string, error) {
+	resolver := d.Resolver
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	hosts, err := lookupMXHosts(resolver.LookupMX, domain)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(hosts) == 0 {
+		return nil, "", wrapError(ErrNullMX, "mail: %s accepts no mail (null MX)", domain)
+	}
+
+	lookupIP := d.LookupIP
+	if lookupIP == nil {
+		lookupIP = net.LookupIP
+	}
+	e := &MXError{Domain: domain}
+	for _, host := range hosts {
+		ips, err := lookupIP(host)
+		if err == nil && len(ips) == 0 {
+			err = fmt.Errorf("no addresses")
+		}
+		if err != nil {
+			e.Failures = append(e.Failures, MXFailure{Host: host, Err: err})
+			continue
+		}
+		if conn := d.dialHost(host, interleaveAddresses(ips), e); conn != nil {
+			return conn, host, nil
+		}
+	}
+	return nil, "", e
+}
+
+// The result of one attempt to connect.
+type dialResult struct {
+	address string
+	conn    net.Conn
+	err     error
+}
+
+// Connects to one of \a ips, the addresses of \a host, with Happy Eyeballs,
+// and returns the connection, or nil after recording each failure in \a e.
+func (d *MXDialer) dialHost(host string, ips []net.IP, e *MXError) net.Conn {
+	port := d.Port
+	if port == "" {
+		port = "25"
+	}
+	delay := d.FallbackDelay
+	if delay <= 0 {
+		delay = 250 * time.Millisecond
+	}
+	results := make(chan dialResult, len(ips))
+	next, pending := 0, 0
+	start := func() {
+		address := net.JoinHostPort(ips[next].String(), port)
+		next++
+		pending++
+		go func() {
+			conn, err := d.dialAddress(address)
+			results <- dialResult{address, conn, err}
+		}()
+	}
+
+	start()
+	for pending > 0 {
+		var fallback <-chan time.Time
+		if next < len(ips) {
+			fallback = time.After(delay)
+		}
+		select {
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				// close the connections which lost the race
+				go func(n int) {
+					for ; n > 0; n-- {
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
+						}
+					}
+				}(pending)
+				return r.conn
+			}
+			e.Failures = append(e.Failures, MXFailure{Host: host, Address: r.address, Err: r.err})
+			if next < len(ips) {
+				start()
+			}
+		case <-fallback:
+			start()
+		}
+	}
+	return nil
+}
+
+// Connects to \a address, giving up after AttemptTimeout.
+func (d *MXDialer) dialAddress(address string) (net.Conn, error) {
+	timeout := d.AttemptTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	dial := d.Dial
+	if dial == nil {
+		dial = (&net.Dialer{Timeout: timeout}).Dial
+	}
+	results := make(chan dialResult, 1)
+	go func() {
+		conn, err := dial("tcp", address)
+		results <- dialResult{address, conn, err}
+	}()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-results:
+		return r.conn, r.err
+	case <-timer.C:
+		go func() {
+			if r := <-results; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("timed out after %v", timeout)
+	}
+}
+
+// Returns \a ips with IPv6 and IPv4 addresses alternating, starting with
+// IPv6, and otherwise in the order given.
+func interleaveAddresses(ips []net.IP) []net.IP {
+	var v6, v4 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	r := make([]net.IP, 0, len(ips))
+	for i := 0; i < len(v6) || i < len(v4); i++ {
+		if i < len(v6) {
+			r = append(r, v6[i])
+		}
+		if i < len(v4) {
+			r = append(r, v4[i])
+		}
+	}
+	return r
+}
+
+// Returns the hosts which receive mail for \a domain according to the MX
+// records \a lookup returns, most preferred first, or the domain itself if
+// it has none. Returns an empty list if the domain has a null MX.
+func lookupMXHosts(lookup func(string) ([]*net.MX, error), domain string) ([]string, error) {
+	mxs, err := lookup(domain)
+	if err != nil {
+		if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			// no MX records: the domain itself is the implicit MX
+			return []string{domain}, nil
+		}
+		if len(mxs) == 0 {
+			return nil, err
+		}
+	}
+	if len(mxs) == 0 {
+		return []string{domain}, nil
+	}
+	sort.SliceStable(mxs, func(i, j int) bool { return mxs[i].Pref < mxs[j].Pref })
+	hosts := []string{}
+	for _, mx := range mxs {
+		h := strings.TrimSuffix(mx.Host, ".")
+		if h == "" {
+			if len(mxs) == 1 {
+				return nil, nil
+			}
+			continue
+		}
+		hosts = append(hosts, h)
+	}
+	return hosts, nil
+}
@@ -0,0 +1,105 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// A Resolver answering MX lookups from a map.
+type mxResolver map[string][]*net.MX
+
+func (r mxResolver) LookupTXT(name string) ([]string, error) {
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func (r mxResolver) LookupMX(name string) ([]*net.MX, error) {
+	if mx, ok := r[name]; ok {
+		return mx, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestMXDialer(t *testing.T) {
+	d := &mail.MXDialer{
+		Resolver: mxResolver{
+			"example.com":    {{Host: "mx2.example.com.", Pref: 20}, {Host: "mx1.example.com.", Pref: 10}},
+			"eyeballs.com":   {{Host: "mx.eyeballs.com.", Pref: 10}},
+			"nomail.example": {{Host: ".", Pref: 0}},
+		},
+		LookupIP: func(host string) ([]net.IP, error) {
+			switch host {
+			case "mx1.example.com":
+				return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}, nil
+			case "mx2.example.com":
+				return []net.IP{net.ParseIP("2001:db8::2")}, nil
+			case "mx.eyeballs.com":
+				return []net.IP{net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.2")}, nil
+			}
+			return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+		},
+		// 2001:db8::1 does not answer, 192.0.2.1 refuses, and the others
+		// accept
+		Dial: func(network, address string) (net.Conn, error) {
+			switch address {
+			case "[2001:db8::1]:25":
+				time.Sleep(time.Second)
+				return nil, errors.New("unreachable")
+			case "192.0.2.1:25":
+				return nil, errors.New("connection refused")
+			}
+			client, server := net.Pipe()
+			server.Close()
+			return client, nil
+		},
+		AttemptTimeout: 100 * time.Millisecond,
+		FallbackDelay:  10 * time.Millisecond,
+	}
+
+	conn, host, err := d.DialDomain("example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	testStringEquals(t, "host", host, "mx2.example.com")
+
+	start := time.Now()
+	conn, host, err = d.DialDomain("eyeballs.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	testStringEquals(t, "fallback host", host, "mx.eyeballs.com")
+	if time.Since(start) >= d.AttemptTimeout {
+		t.Error("IPv4 was not tried while IPv6 hung")
+	}
+
+	_, _, err = d.DialDomain("nomail.example")
+	if !errors.Is(err, mail.ErrNullMX) {
+		t.Errorf("expected ErrNullMX, got %v", err)
+	}
+
+	// no MX records: the domain itself is tried
+	_, _, err = d.DialDomain("nowhere.example")
+	var e *mail.MXError
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an MXError, got %v", err)
+	}
+	testIntegerEquals(t, "failures", len(e.Failures), 1)
+	testStringEquals(t, "failure host", e.Failures[0].Host, "nowhere.example")
+
+	d.Resolver = mxResolver{"example.com": {{Host: "mx1.example.com.", Pref: 10}}}
+	_, _, err = d.DialDomain("example.com")
+	if !errors.As(err, &e) {
+		t.Fatalf("expected an MXError, got %v", err)
+	}
+	testStringEquals(t, "error", err.Error(), "mail: could not connect to any server for example.com: "+
+		"mx1.example.com (192.0.2.1:25): connection refused; "+
+		"mx1.example.com ([2001:db8::1]:25): timed out after 100ms")
+}
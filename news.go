@@ -0,0 +1,286 @@
+package mail
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const (
+	NewsgroupsFieldName = "Newsgroups"
+	FollowupToFieldName = "Followup-To"
+	PathFieldName       = "Path"
+	XrefFieldName       = "Xref"
+)
+
+// Fields which only make sense in transit by mail, and which MailToNews()
+// does not copy.
+var mailOnlyFieldNames = map[string]bool{
+	ToFieldName: true, CcFieldName: true, BccFieldName: true,
+	ReceivedFieldName: true, ReturnPathFieldName: true,
+	ResentFromFieldName: true, ResentSenderFieldName: true,
+	ResentToFieldName: true, ResentCcFieldName: true, ResentBccFieldName: true,
+	ResentDateFieldName: true, ResentMessageIDFieldName: true,
+	"Delivered-To": true, "X-Original-To": true,
+	NewsgroupsFieldName: true, PathFieldName: true, XrefFieldName: true,
+}
+
+// Fields which only make sense in transit by NNTP, and which NewsToMail()
+// does not copy.
+var newsOnlyFieldNames = map[string]bool{
+	PathFieldName: true, XrefFieldName: true, "Lines": true,
+	"Nntp-Posting-Host": true, "Nntp-Posting-Date": true,
+	"Injection-Info": true, "Injection-Date": true, "X-Trace": true,
+	"X-Complaints-To": true,
+}
+
+// Reads a netnews article (RFC 5536), e.g. as retrieved by the NNTP ARTICLE
+// command. This is like ReadMessage(), except that the header is verified
+// by the rules for articles: Newsgroups, Path, Message-ID and Subject are
+// required, and To and Cc are not special.
+func ReadArticle(rfc5536 string) (*Message, error) {
+	m := NewMessage()
+	err := m.parse(rfc5536, NNTPHeader, Position{Line: 1})
+	return m, err
+}
+
+// Returns true if \a s is a valid newsgroup name (RFC 5536 section 3.1.4):
+// dot-separated components of letters, digits, "+", "-" and "_".
+func isNewsgroupName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range strings.Split(s, ".") {
+		if c == "" {
+			return false
+		}
+		for i := 0; i < len(c); i++ {
+			b := c[i]
+			if !(b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' ||
+				b >= '0' && b <= '9' || b == '+' || b == '-' || b == '_') {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Returns a field named \a name with value \a value, parsed by the syntax
+// rules of RFC 5536, or nil if \a name is not one of the fields which those
+// rules cover.
+func newNewsField(name, value string) Field {
+	f := &HeaderField{name: headerCase(name)}
+	switch f.name {
+	case NewsgroupsFieldName, FollowupToFieldName:
+		f.parseNewsgroups(value)
+	case PathFieldName:
+		f.parsePath(value)
+	case XrefFieldName:
+		f.parseXref(value)
+	default:
+		return nil
+	}
+	if !f.Valid() {
+		f.SetUnparsedValue(value)
+	}
+	return f
+}
+
+// Parses the Newsgroups or Followup-To field \a s, a comma-separated list of
+// newsgroup names. Followup-To may also be "poster".
+func (f *HeaderField) parseNewsgroups(s string) {
+	groups := splitNewsgroups(s)
+	if len(groups) == 0 {
+		f.err = errors.New("No newsgroups")
+		return
+	}
+	for _, g := range groups {
+		if f.name == FollowupToFieldName && g == "poster" && len(groups) == 1 {
+			continue
+		}
+		if !isNewsgroupName(g) {
+			f.err = errors.New("Invalid newsgroup name: " + g)
+			return
+		}
+	}
+	f.value = strings.Join(groups, ",")
+}
+
+// Returns the newsgroup names in \a s, without whitespace.
+func splitNewsgroups(s string) []string {
+	r := []string{}
+	for _, g := range strings.Split(stripcomments(s), ",") {
+		g = strings.Join(strings.Fields(g), "")
+		if g != "" {
+			r = append(r, g)
+		}
+	}
+	return r
+}
+
+// Parses the Path field \a s (RFC 5536 section 3.1.5): a list of path
+// identities separated by "!", ending with a tail entry such as
+// "not-for-mail".
+func (f *HeaderField) parsePath(s string) {
+	v := strings.Join(strings.Fields(s), "")
+	if v == "" {
+		f.err = errors.New("Empty path")
+		return
+	}
+	for _, e := range strings.Split(v, "!") {
+		// "!!" marks where the article was verified, so empty
+		// elements are fine
+		for i := 0; i < len(e); i++ {
+			c := e[i]
+			if c <= ' ' || c >= 127 || c == '"' || c == ',' || c == '(' || c == ')' {
+				f.err = errors.New("Invalid path identity: " + e)
+				return
+			}
+		}
+	}
+	f.value = v
+}
+
+// Parses the Xref field \a s (RFC 5536 section 3.2.14): the name of the
+// server followed by one or more "newsgroup:number" locations.
+func (f *HeaderField) parseXref(s string) {
+	w := strings.Fields(s)
+	if len(w) < 2 {
+		f.err = errors.New("Xref needs a server name and a location")
+		return
+	}
+	for _, l := range w[1:] {
+		colon := strings.LastIndexByte(l, ':')
+		if colon < 0 || !isNewsgroupName(l[:colon]) {
+			f.err = errors.New("Invalid Xref location: " + l)
+			return
+		}
+		if _, err := strconv.ParseUint(l[colon+1:], 10, 32); err != nil {
+			f.err = errors.New("Invalid Xref article number: " + l)
+			return
+		}
+	}
+	f.value = strings.Join(w, " ")
+}
+
+// Returns the newsgroups this article is posted to, or nil if there is no
+// Newsgroups field.
+func (h *Header) Newsgroups() []string {
+	return h.newsgroups(NewsgroupsFieldName)
+}
+
+// Returns the newsgroups followups to this article should go to, or nil if
+// there is no Followup-To field. The single entry "poster" means that
+// followups should be sent by mail to the author.
+func (h *Header) FollowupTo() []string {
+	return h.newsgroups(FollowupToFieldName)
+}
+
+func (h *Header) newsgroups(name string) []string {
+	f := h.field(name, 0)
+	if f == nil || f.Value() == "" {
+		return nil
+	}
+	return splitNewsgroups(f.Value())
+}
+
+// Returns the path identities in the Path field, most recent first, or nil
+// if there is none. The last element is the tail entry, e.g.
+// "not-for-mail".
+func (h *Header) Path() []string {
+	f := h.field(PathFieldName, 0)
+	if f == nil || f.Value() == "" {
+		return nil
+	}
+	return strings.Split(strings.Join(strings.Fields(f.Value()), ""), "!")
+}
+
+// An XrefLocation is where a server has stored an article: the article
+// number in a newsgroup.
+type XrefLocation struct {
+	Newsgroup string `json:"newsgroup"`
+	Number    uint32 `json:"number"`
+}
+
+// Returns the server named in the Xref field and the locations it lists, or
+// an empty string and nil if there is no valid Xref field.
+func (h *Header) Xref() (string, []XrefLocation) {
+	f := h.field(XrefFieldName, 0)
+	if f == nil || f.Value() == "" {
+		return "", nil
+	}
+	// in mail, Xref is only text, so check it here
+	if !newNewsField(XrefFieldName, f.Value()).Valid() {
+		return "", nil
+	}
+	w := strings.Fields(f.Value())
+	r := []XrefLocation{}
+	for _, l := range w[1:] {
+		colon := strings.LastIndexByte(l, ':')
+		n, _ := strconv.ParseUint(l[colon+1:], 10, 32)
+		r = append(r, XrefLocation{Newsgroup: l[:colon], Number: uint32(n)})
+	}
+	return w[0], r
+}
+
+// Returns a copy of this message, sharing its bodyparts, with the header
+// \a h.
+func (m *Message) withHeader(h *Header) *Message {
+	p := *m.Part
+	p.Header = h
+	return &Message{Part: &p, RFC822Size: m.RFC822Size, InternalDate: m.InternalDate}
+}
+
+// Returns a copy of \a f for this header, made by parsing its value again,
+// so that the copy follows the rules of this header's mode and changing it
+// does not change \a f.
+func (h *Header) copyField(f Field) Field {
+	v := f.UnparsedValue()
+	if f.Valid() {
+		v = f.rfc822(false)
+	}
+	c := h.newField(f.Name(), v)
+	c.setSource(f.Position(), f.sourceText())
+	return c
+}
+
+// Returns a netnews article posting this mail message to \a newsgroups, as a
+// mail-to-news gateway would. \a pathIdentity is the name of the gateway,
+// which starts the Path field.
+//
+// Recipient, trace and resent fields are left out, a Message-ID is added if
+// the message has none, and the article's header is verified as by
+// ReadArticle(). The article shares its bodyparts with this message.
+func (m *Message) MailToNews(newsgroups []string, pathIdentity string) *Message {
+	h := &Header{mode: NNTPHeader}
+	for _, f := range m.Header.Fields {
+		if !mailOnlyFieldNames[f.Name()] {
+			h.Fields = append(h.Fields, h.copyField(f))
+		}
+	}
+	h.Add(PathFieldName, pathIdentity+"!not-for-mail")
+	h.Add(NewsgroupsFieldName, strings.Join(newsgroups, ","))
+	if h.field(MessageIDFieldName, 0) == nil {
+		h.Add(MessageIDFieldName, newMessageID(h, nil, nil))
+	}
+	return m.withHeader(h)
+}
+
+// Returns a mail message delivering this netnews article to \a to, as a
+// news-to-mail gateway would. Transport fields such as Path and Xref are
+// left out; Newsgroups is kept, so that recipients can see where the article
+// was posted. The message shares its bodyparts with this article.
+func (m *Message) NewsToMail(to []Address) *Message {
+	h := &Header{mode: RFC5322Header}
+	for _, f := range m.Header.Fields {
+		if !newsOnlyFieldNames[f.Name()] {
+			h.Fields = append(h.Fields, h.copyField(f))
+		}
+	}
+	if len(to) > 0 {
+		af := NewAddressField(ToFieldName)
+		af.Addresses = append(af.Addresses, to...)
+		h.addField(af)
+	}
+	return m.withHeader(h)
+}
@@ -0,0 +1,106 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestNewsArticles(t *testing.T) {
+	article := "Path: news.example.com!feeder.example.net!not-for-mail\r\n" +
+		"From: Alice <alice@example.com>\r\n" +
+		"Newsgroups: comp.lang.go, comp.misc\r\n" +
+		"Followup-To: comp.lang.go\r\n" +
+		"Subject: Generics\r\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"Message-ID: <g1@example.com>\r\n" +
+		"Xref: news.example.com comp.lang.go:1234 comp.misc:56\r\n" +
+		"Lines: 1\r\n" +
+		"\r\n" +
+		"Discuss.\r\n"
+	msg, err := mail.ReadArticle(article)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !msg.Header.Valid() {
+		t.Fatalf("article not valid: %v", msg.Header.Error())
+	}
+	testStringEquals(t, "newsgroups", strings.Join(msg.Header.Newsgroups(), " "), "comp.lang.go comp.misc")
+	testStringEquals(t, "followup-to", strings.Join(msg.Header.FollowupTo(), " "), "comp.lang.go")
+	testIntegerEquals(t, "path length", len(msg.Header.Path()), 3)
+	server, locations := msg.Header.Xref()
+	testStringEquals(t, "xref server", server, "news.example.com")
+	if len(locations) != 2 || locations[0].Number != 1234 {
+		t.Errorf("unexpected Xref locations: %+v", locations)
+	}
+
+	// as mail, the same text is valid, but as news it needs a Path
+	noPath := article[strings.Index(article, "From:"):]
+	if m, _ := mail.ReadMessage(noPath); !m.Header.Valid() {
+		t.Errorf("article without Path not valid as mail: %v", m.Header.Error())
+	}
+	if a, _ := mail.ReadArticle(noPath); a.Header.Valid() {
+		t.Error("article without Path accepted")
+	}
+	if a, _ := mail.ReadArticle(strings.Replace(article, "comp.misc\r\n", "comp..misc\r\n", 1)); a.Header.Valid() {
+		t.Error("invalid newsgroup name accepted")
+	}
+
+	mailed := msg.NewsToMail([]mail.Address{mail.NewAddress("", "bob", "example.org")})
+	if !mailed.Header.Valid() {
+		t.Errorf("gatewayed mail not valid: %v", mailed.Header.Error())
+	}
+	if mailed.Header.Get("Path") != "" || mailed.Header.Get("Xref") != "" {
+		t.Error("news transport fields copied to mail")
+	}
+	testStringEquals(t, "mail recipient", mailed.Header.Get("To"), "bob@example.org")
+
+	posted := mailed.MailToNews([]string{"example.test"}, "gateway.example.com")
+	if !posted.Header.Valid() {
+		t.Errorf("gatewayed article not valid: %v", posted.Header.Error())
+	}
+	testStringEquals(t, "gateway path", posted.Header.Get("Path"), "gateway.example.com!not-for-mail")
+	if posted.Header.Get("To") != "" {
+		t.Error("mail recipients copied to article")
+	}
+	testStringEquals(t, "body", posted.Text, "Discuss.\r\n")
+}
+
+func TestNewsFieldsInMail(t *testing.T) {
+	message := "From: Alice <alice@example.com>\r\n" +
+		"To: bob@example.org\r\n" +
+		"Newsgroups: not a newsgroup!\r\n" +
+		"Followup-To: comp.lang.go\r\n" +
+		"Subject: Generics\r\n" +
+		"Date: Mon, 2 Jan 2006 15:04:05 -0700\r\n" +
+		"Message-ID: <g2@example.com>\r\n" +
+		"Path: news.example.com!not-for-mail\r\n" +
+		"\r\n" +
+		"Discuss.\r\n"
+	msg, _ := mail.ReadMessage(message)
+	if !msg.Header.Valid() {
+		t.Errorf("malformed Newsgroups makes mail invalid: %v", msg.Header.Error())
+	}
+	if a, _ := mail.ReadArticle(message); a.Header.Valid() {
+		t.Error("malformed Newsgroups accepted in an article")
+	}
+
+	posted := msg.MailToNews([]string{"comp.lang.go"}, "gateway.example.com")
+	newsField(posted.Header, "Subject").Parse("Changed")
+	testStringEquals(t, "source subject", msg.Header.Get("Subject"), "Generics")
+	testStringEquals(t, "article subject", posted.Header.Get("Subject"), "Changed")
+
+	mailed := posted.NewsToMail(nil)
+	newsField(mailed.Header, "Followup-To").Parse("comp.misc")
+	testStringEquals(t, "article followup-to", posted.Header.Get("Followup-To"), "comp.lang.go")
+}
+
+func newsField(h *mail.Header, name string) mail.Field {
+	for _, f := range h.Fields {
+		if f.Name() == name {
+			return f
+		}
+	}
+	return nil
+}
@@ -0,0 +1,230 @@
+package mail
+
+import (
+	"sort"
+	"strings"
+)
+
+// A Normalization says how NormalizeString() and Message.Normalize() change
+// decoded text, so that text which looks the same also compares the same
+// when it is searched, compared or displayed.
+type Normalization int
+
+const (
+	// NormalizeNFC converts text to Unicode Normalization Form C, i.e.
+	// composes each letter and its accents into one character where
+	// possible, as most software writes text.
+	NormalizeNFC Normalization = 1 << iota
+	// StripInvisible removes zero width characters and the controls which
+	// override the direction of bidirectional text. Zero width joiners
+	// which join emoji into one are kept.
+	StripInvisible
+)
+
+// Returns \a s normalized as \a n says.
+func NormalizeString(s string, n Normalization) string {
+	if n&StripInvisible != 0 {
+		s = stripInvisible(s)
+	}
+	if n&NormalizeNFC != 0 {
+		s = nfc(s)
+	}
+	return s
+}
+
+// Normalizes the text of this message as \a n says: the text of each text
+// bodypart, the unstructured header fields such as Subject, display names
+// in address fields, and MIME parameters such as filenames, including
+// those of embedded messages.
+func (m *Message) Normalize(n Normalization) {
+	if m.Part == nil || n == 0 {
+		return
+	}
+	m.Part.walk(func(p *Part) {
+		p.Header.normalize(n)
+		if p.message != nil && p.message.Header != p.Header {
+			p.message.Header.normalize(n)
+		}
+		if p.hasText {
+			if t := NormalizeString(p.Text, n); t != p.Text {
+				p.setText(t)
+			}
+		}
+	})
+}
+
+// Normalizes the decoded text of the fields in this header as \a n says.
+func (h *Header) normalize(n Normalization) {
+	if h == nil {
+		return
+	}
+	params := func(ps []MIMEParameter) {
+		for i := range ps {
+			ps[i].Value = NormalizeString(ps[i].Value, n)
+		}
+	}
+	for _, f := range h.Fields {
+		switch f := f.(type) {
+		case *HeaderField:
+			f.value = NormalizeString(f.value, n)
+		case *AddressField:
+			for i := range f.Addresses {
+				f.Addresses[i].name = NormalizeString(f.Addresses[i].name, n)
+			}
+		case *ContentType:
+			params(f.Parameters)
+		case *ContentDisposition:
+			params(f.Parameters)
+		}
+	}
+}
+
+// Returns true if \a c is a bidi control character: an embedding,
+// override or isolate, or a mark.
+func isBidiControl(c rune) bool {
+	return isBidiFormatting(c) || c == 0x200e || c == 0x200f || c == 0x061c
+}
+
+// Returns \a s without zero width characters and bidi controls, except for
+// zero width joiners between emoji.
+func stripInvisible(s string) string {
+	if !strings.ContainsAny(s, "\u200b\u200c\u200d\u2060\ufeff") &&
+		strings.IndexFunc(s, isBidiControl) < 0 {
+		return s
+	}
+	runes := []rune(s)
+	var b strings.Builder
+	for i, c := range runes {
+		switch {
+		case c == '\u200d':
+			// a joiner follows an emoji, possibly modified by a skin
+			// tone or variation selector, and precedes another
+			if i > 0 && i+1 < len(runes) && isEmoji(runes[i+1]) &&
+				(isEmoji(runes[i-1]) || isSkinTone(runes[i-1]) || runes[i-1] == '\ufe0f') {
+				b.WriteRune(c)
+			}
+		case c == '\u200b' || c == '\u200c' || c == '\u2060' || c == '\ufeff' ||
+			isBidiControl(c):
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// The constants of the algorithmic composition of Hangul syllables.
+const (
+	hangulSBase  = 0xac00
+	hangulLBase  = 0x1100
+	hangulVBase  = 0x1161
+	hangulTBase  = 0x11a7
+	hangulLCount = 19
+	hangulVCount = 21
+	hangulTCount = 28
+	hangulNCount = hangulVCount * hangulTCount
+	hangulSCount = hangulLCount * hangulNCount
+)
+
+// The canonical composition of each pair of characters which composes,
+// derived from canonicalDecompositions.
+var canonicalCompositions map[[2]rune]rune
+
+func init() {
+	canonicalCompositions = map[[2]rune]rune{}
+	for c, d := range canonicalDecompositions {
+		if len(d) == 2 && !compositionExclusions[c] &&
+			combiningClasses[c] == 0 && combiningClasses[d[0]] == 0 {
+			canonicalCompositions[[2]rune{d[0], d[1]}] = c
+		}
+	}
+}
+
+// Appends the full canonical decomposition of \a c to \a r and returns the
+// result.
+func appendDecomposition(r []rune, c rune) []rune {
+	if c >= hangulSBase && c < hangulSBase+hangulSCount {
+		i := c - hangulSBase
+		r = append(r, hangulLBase+i/hangulNCount, hangulVBase+i%hangulNCount/hangulTCount)
+		if t := i % hangulTCount; t != 0 {
+			r = append(r, hangulTBase+t)
+		}
+		return r
+	}
+	d, ok := canonicalDecompositions[c]
+	if !ok {
+		return append(r, c)
+	}
+	for _, c := range d {
+		r = appendDecomposition(r, c)
+	}
+	return r
+}
+
+// Returns the canonical composition of \a a and \a b, or 0 if they do not
+// compose.
+func compose(a, b rune) rune {
+	if a >= hangulLBase && a < hangulLBase+hangulLCount &&
+		b >= hangulVBase && b < hangulVBase+hangulVCount {
+		return hangulSBase + ((a-hangulLBase)*hangulVCount+b-hangulVBase)*hangulTCount
+	}
+	if a >= hangulSBase && a < hangulSBase+hangulSCount && (a-hangulSBase)%hangulTCount == 0 &&
+		b > hangulTBase && b < hangulTBase+hangulTCount {
+		return a + b - hangulTBase
+	}
+	return canonicalCompositions[[2]rune{a, b}]
+}
+
+// Returns \a s in Normalization Form C, as described in Unicode Standard
+// Annex #15: fully decomposed, with combining marks in canonical order, and
+// then composed.
+func nfc(s string) string {
+	simple := true
+	for i := 0; i < len(s) && simple; i++ {
+		simple = s[i] < 0xcc
+	}
+	if simple {
+		// nothing below U+0300, where the combining marks begin,
+		// decomposes differently
+		return s
+	}
+	var r []rune
+	for _, c := range s {
+		r = appendDecomposition(r, c)
+	}
+	for i := 0; i < len(r); {
+		if combiningClasses[r[i]] == 0 {
+			i++
+			continue
+		}
+		j := i
+		for j < len(r) && combiningClasses[r[j]] != 0 {
+			j++
+		}
+		marks := r[i:j]
+		sort.SliceStable(marks, func(a, b int) bool {
+			return combiningClasses[marks[a]] < combiningClasses[marks[b]]
+		})
+		i = j
+	}
+
+	starter := -1
+	lastClass := -1
+	out := r[:0]
+	for _, c := range r {
+		class := int(combiningClasses[c])
+		if starter >= 0 && lastClass < class {
+			if composed := compose(out[starter], c); composed != 0 {
+				out[starter] = composed
+				continue
+			}
+		}
+		if class == 0 {
+			starter = len(out)
+			lastClass = -1
+		} else {
+			lastClass = class
+		}
+		out = append(out, c)
+	}
+	return string(out)
+}
@@ -0,0 +1,42 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		in, out string
+	}{
+		{"cafe\u0301", "caf\u00e9"},
+		{"A\u030a", "\u00c5"},
+		{"\u212b", "\u00c5"},
+		{"s\u0323\u0307", "\u1e69"},
+		{"s\u0307\u0323", "\u1e69"},
+		{"a\u0328\u0301", "\u0105\u0301"},
+		{"\u1100\u1161\u11a8", "\uac01"},
+		{"\u0958", "\u0915\u093c"},
+		{"plain ascii", "plain ascii"},
+	}
+	for _, c := range cases {
+		testStringEquals(t, "NFC of "+c.in, mail.NormalizeString(c.in, mail.NormalizeNFC), c.out)
+	}
+	testStringEquals(t, "stripped",
+		mail.NormalizeString("pay\u200bpal \u202egpj.exe\u202c \U0001f468\u200d\U0001f469 a\u200db",
+			mail.StripInvisible),
+		"paypal gpj.exe \U0001f468\u200d\U0001f469 ab")
+
+	m, err := mail.ReadMessage("From: zoe@example.com\r\n" +
+		"Subject: =?utf-8?q?Re=CC=81sume=CC=81=E2=80=8B?=\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n" +
+		"\r\n" +
+		"Cafe\xcc\x81 \xe2\x80\x8e\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Normalize(mail.NormalizeNFC | mail.StripInvisible)
+	testStringEquals(t, "Subject", m.Header.Subject(), "Résumé")
+	testStringEquals(t, "text", m.Text, "Café \r\n")
+}
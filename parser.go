@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/paulrosania/go-charset/charset"
 	_ "github.com/paulrosania/go-charset/data"
@@ -282,7 +283,7 @@ func (p *parser) encodedWord(t EncodedTextType) string {
 	} else if p.Present("b") {
 		encoding = Base64Encoding
 	} else {
-		p.err = fmt.Errorf("Unknown encoding: %c", p.NextChar())
+		p.err = wrapError(ErrBadEncoding, "Unknown encoding: %c", p.NextChar())
 	}
 
 	p.require("?")
@@ -325,7 +326,7 @@ func (p *parser) encodedWord(t EncodedTextType) string {
 
 	text := buf.String()
 	if encoding == QPEncoding {
-		text = deQP(text, false)
+		text = deQP(text, true)
 	} else {
 		text = de64(text)
 	}
@@ -333,7 +334,7 @@ func (p *parser) encodedWord(t EncodedTextType) string {
 	cr, err := charset.NewReader(cs, r)
 	if err != nil {
 		// XXX: Should we treat unknown charsets as us-ascii?
-		p.err = fmt.Errorf("Unknown character set: %s", cs)
+		p.err = wrapError(ErrBadEncoding, "Unknown character set: %s", cs)
 		p.restore(m)
 		return ""
 	}
@@ -417,12 +418,17 @@ func (p *parser) Text() string {
 		if !encodedWord {
 			var buf bytes.Buffer
 			c := p.NextChar()
-			for !p.AtEnd() && c < 128 && c != ' ' && c != 9 && c != 10 && c != 13 {
+			for !p.AtEnd() && c != ' ' && c != 9 && c != 10 && c != 13 {
 				buf.WriteByte(c)
 				p.Step(1)
 				c = p.NextChar()
 			}
 			word = buf.String()
+			if !utf8.ValidString(word) {
+				// 8-bit text is only permitted as UTF-8 (RFC 6532)
+				p.restore(m)
+				word = ""
+			}
 		}
 
 		if p.Pos() == start {
@@ -433,7 +439,12 @@ func (p *parser) Text() string {
 
 			space = p.Whitespace()
 			if strings.ContainsAny(space, "\r\n") {
-				space = " "
+				// unfold, keeping any spaces beyond the one which
+				// follows the line break
+				space = strings.NewReplacer("\r", "", "\n", "", "\t", " ").Replace(space)
+				if space == "" {
+					space = " "
+				}
 			}
 		}
 	}
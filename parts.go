@@ -2,7 +2,6 @@ package mail
 
 import (
 	"bytes"
-	"errors"
 	"strings"
 
 	"github.com/paulrosania/go-charset/charset"
@@ -20,6 +19,9 @@ type Part struct {
 	Text    string `json:"text,omitempty"`
 	Data    string `json:"data,omitempty"`
 
+	spill    *spillFile // the content, if a SpillStorage moved it
+	spilling *spilling  // set on the root while a SpillStorage reads
+
 	numBytes        int
 	numEncodedBytes int
 	numEncodedLines int
@@ -27,8 +29,41 @@ type Part struct {
 	err error
 }
 
+// Calls \a fn for this Part and each of its descendants, parents before
+// children.
+func (p *Part) walk(fn func(*Part)) {
+	fn(p)
+	for _, c := range p.Parts {
+		c.walk(fn)
+	}
+}
+
+// Replaces the text of this bodypart with \a s, and adjusts the
+// Content-Transfer-Encoding field so that it can represent the new text.
+func (p *Part) setText(s string) {
+	p.Text = s
+	h := p.Header
+	if h == nil {
+		return
+	}
+	qp := needsQP(s)
+	cte := h.ContentTransferEncoding()
+	if cte != nil {
+		if !qp {
+			h.RemoveAllNamed(ContentTransferEncodingFieldName)
+		} else if cte.Encoding != QPEncoding {
+			cte.Encoding = QPEncoding
+			cte.baseValue = "quoted-printable"
+		}
+	} else if qp {
+		h.Add(ContentTransferEncodingFieldName, "quoted-printable")
+	}
+}
+
 // Appends the text of this multipart MIME entity to the buffer \a buf.
-func (p *Part) appendMultipart(buf *bytes.Buffer, avoidUTF8 bool) {
+// Returns the first error met while reading spilled content.
+func (p *Part) appendMultipart(buf *bytes.Buffer, avoidUTF8 bool) error {
+	var err error
 	ct := p.Header.ContentType()
 	delim := ct.parameter("boundary")
 	buf.WriteString("--" + delim)
@@ -37,7 +72,9 @@ func (p *Part) appendMultipart(buf *bytes.Buffer, avoidUTF8 bool) {
 
 		buf.WriteString(c.Header.AsText(avoidUTF8))
 		buf.WriteString(crlf)
-		p.appendAnyPart(buf, c, ct, avoidUTF8)
+		if e := p.appendAnyPart(buf, c, ct, avoidUTF8); err == nil {
+			err = e
+		}
 
 		buf.WriteString(crlf)
 		buf.WriteString("--")
@@ -45,13 +82,15 @@ func (p *Part) appendMultipart(buf *bytes.Buffer, avoidUTF8 bool) {
 	}
 	buf.WriteString("--")
 	buf.WriteString(crlf)
+	return err
 }
 
 // This function appends the text of the MIME bodypart \a bp with Content-Type
-// \a ct to the buffer \a buf.
+// \a ct to the buffer \a buf. Returns an error if \a bp, or a bodypart in
+// it, was spilled and its content cannot be read back.
 //
 // The details of this function are certain to change.
-func (p *Part) appendAnyPart(buf *bytes.Buffer, bp *Part, ct *ContentType, avoidUTF8 bool) {
+func (p *Part) appendAnyPart(buf *bytes.Buffer, bp *Part, ct *ContentType, avoidUTF8 bool) error {
 	childct := bp.Header.ContentType()
 	e := BinaryEncoding
 	cte := bp.Header.ContentTransferEncoding()
@@ -64,15 +103,18 @@ func (p *Part) appendAnyPart(buf *bytes.Buffer, bp *Part, ct *ContentType, avoid
 		if childct != nil && childct.Subtype != "rfc822" {
 			p.appendTextPart(buf, bp, childct)
 		} else {
-			buf.WriteString(bp.message.RFC822(avoidUTF8))
+			return bp.message.appendRFC822(buf, avoidUTF8)
 		}
 	} else if childct == nil || strings.ToLower(childct.Type) == "text" {
 		p.appendTextPart(buf, bp, childct)
 	} else if childct.Type == "multipart" {
-		bp.appendMultipart(buf, avoidUTF8)
+		return bp.appendMultipart(buf, avoidUTF8)
 	} else {
-		buf.WriteString(encodeCTE(bp.Data, e, 72))
+		data, err := bp.data()
+		buf.WriteString(encodeCTE(data, e, 72))
+		return err
 	}
+	return nil
 }
 
 // This function appends the text of the MIME bodypart \a bp with Content-Type
@@ -131,7 +173,8 @@ func (p *Part) AsText(avoidUTF8 bool) string {
 		p.Header.ContentType().Type == "text" {
 		r, _ = decode(p.Text, c.Name)
 	} else {
-		r = e64(p.Data, 72)
+		data, _ := p.data()
+		r = e64(data, 72)
 	}
 
 	return r
@@ -141,8 +184,9 @@ func (p *Part) AsText(avoidUTF8 bool) string {
 // dividing the part into bodyparts wherever the boundary \a divider occurs and
 // adding each bodypart to \a children, and setting the correct \a parent. \a
 // divider does not contain the leading or trailing hyphens. \a digest is true
-// for multipart/digest and false for other types.
-func (p *Part) parseMultipart(rfc5322, divider string, digest bool) {
+// for multipart/digest and false for other types. \a base is the position of
+// \a rfc5322 in the input.
+func (p *Part) parseMultipart(rfc5322, divider string, digest bool, base Position) {
 	i := 0
 	start := 0
 	last := false
@@ -150,17 +194,15 @@ func (p *Part) parseMultipart(rfc5322, divider string, digest bool) {
 	end := len(rfc5322)
 	for !last && i <= end {
 		if i >= end ||
-			rfc5322[i] == '-' && rfc5322[i+1] == '-' &&
-				(i == 0 || rfc5322[i-1] == 31 || rfc5322[i-1] == 10) &&
-				rfc5322[i+2] == divider[0] &&
-				rfc5322[i+2:i+2+len(divider)] == divider {
+			(i == 0 || rfc5322[i-1] == 13 || rfc5322[i-1] == 10) &&
+				strings.HasPrefix(rfc5322[i:], "--"+divider) {
 			j := i
 			l := false
 			if i >= end {
 				l = true
 			} else {
 				j = i + 2 + len(divider)
-				if rfc5322[j] == '-' && rfc5322[j+1] == '-' {
+				if strings.HasPrefix(rfc5322[j:], "--") {
 					j += 2
 					l = true
 				}
@@ -177,8 +219,12 @@ func (p *Part) parseMultipart(rfc5322, divider string, digest bool) {
 					j++
 				}
 				if start > 0 && start < len(rfc5322) {
-					h, _ := ReadHeader(rfc5322[start:j], MIMEHeader)
+					h, _ := readHeader(rfc5322[start:j], MIMEHeader, base.advance(rfc5322, start))
 					start += h.numBytes
+					if start > i {
+						// the header ended at the boundary
+						start = i
+					}
 					if digest {
 						h.defaultType = MessageRFC822ContentType
 					}
@@ -186,14 +232,14 @@ func (p *Part) parseMultipart(rfc5322, divider string, digest bool) {
 					h.Repair()
 
 					// Strip the [CR]LF that belongs to the boundary.
-					if rfc5322[i-1] == 10 {
+					if i > start && rfc5322[i-1] == 10 {
 						i--
-						if rfc5322[i-1] == 13 {
+						if i > start && rfc5322[i-1] == 13 {
 							i--
 						}
 					}
 
-					bp := p.parseBodypart(rfc5322[start:i], h)
+					bp := p.parseBodypart(rfc5322[start:i], h, base.advance(rfc5322, start))
 					bp.Number = pn
 					p.Parts = append(p.Parts, bp)
 					pn++
@@ -214,48 +260,14 @@ func (p *Part) parseMultipart(rfc5322, divider string, digest bool) {
 	}
 }
 
+// Returns the character set DetectCharset() finds \a body most likely
+// uses, or nil if none is plausible or the charset package lacks it.
 func guessTextCodec(body string) *charset.Charset {
-	// step 1. try iso-2022-jp. this goes first because it's so
-	// restrictive, and because 2022 strings also match the ascii and
-	// utf-8 tests.
-	if body[0] == 0x1B &&
-		(body[1] == '(' || body[1] == '$') &&
-		(body[2] == 'B' || body[2] == 'J' || body[2] == '@') {
-		_, err := decode(body, "iso-2022-jp")
-		if err != nil {
-			return charset.Info("iso-2022-jp")
-		}
+	name, _ := DetectCharset(body)
+	if name == "" {
+		return nil
 	}
-
-	// step 2. could it be pure ascii?
-	_, err := decode(body, "us-ascii")
-	if err != nil {
-		return charset.Info("us-ascii")
-	}
-
-	// some multibyte encodings have to go before utf-8, or else utf-8
-	// will match. this applies at least to iso-2002-jp, but may also
-	// apply to other encodings that use octet values 0x01-0x07f
-	// exclusively.
-
-	// step 3. does it look good as utf-8?
-	_, err = decode(body, "utf8")
-	if err != nil {
-		// FIXME: skipped a check for ascii
-		return charset.Info("utf8")
-	}
-
-	// step 4. guess a codec based on the bodypart content.
-	// TODO: implement codec guesser
-
-	// step 5. is utf-8 at all plausible?
-	// FIXME: not reachable since we don't yet discriminate between valid and well-formed
-	if err != nil {
-		return charset.Info("utf8")
-	}
-	// should we use g here if valid()?
-
-	return nil
+	return charset.Info(name)
 }
 
 func guessHtmlCodec(body string) *charset.Charset {
@@ -330,20 +342,21 @@ func guessHtmlCodec(body string) *charset.Charset {
 }
 
 // Parses the part of \a rfc2822 from \a start to \a end (not including \a end)
-// as a single bodypart with MIME/RFC 822 header \a h.
+// as a single bodypart with MIME/RFC 822 header \a h. \a base is the position
+// of \a rfc5322 in the input.
 //
 // This removes the "charset" argument from the Content-Type field in \a h.
 //
 // The \a parent argument is provided so that nested message/rfc822 bodyparts
 // without a Date field may be fixed with reference to the Date field in the
 // enclosing bodypart.
-func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
+func (p *Part) parseBodypart(rfc5322 string, h *Header, base Position) *Part {
 	start := 0
 	end := len(rfc5322)
-	if rfc5322[start] == 13 {
+	if start < end && rfc5322[start] == 13 {
 		start++
 	}
-	if rfc5322[start] == 10 {
+	if start < end && rfc5322[start] == 10 {
 		start++
 	}
 
@@ -359,17 +372,14 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 	if !strings.Contains(body, "=") {
 		// sometimes people send c-t-e: q-p _and_ c-t-e: 7bit or 8bit.
 		// if they are equivalent we can accept it.
-		i := 0
 		any := false
-		f := h.field(ContentTransferEncodingFieldName, i)
-		for f != nil {
+		all := h.All(ContentTransferEncodingFieldName)
+		for _, f := range all {
 			if f.(*ContentTransferEncoding).Encoding == QPEncoding {
 				any = true
 			}
-			i++
-			f = h.field(ContentTransferEncodingFieldName, i)
 		}
-		if any && i > 1 {
+		if any && len(all) > 1 {
 			h.RemoveAllNamed(ContentTransferEncodingFieldName)
 		}
 	}
@@ -388,6 +398,9 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 	}
 
 	ct := h.ContentType()
+	if ct == nil || ct.Type != "multipart" && ct.Type != "message" {
+		h.checkChecksums(body)
+	}
 	if ct == nil {
 		switch h.defaultType {
 		case TextPlainContentType:
@@ -434,6 +447,21 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 		t, decodeErr := decode(toCRLF(body), c.Name)
 		bp.Text = t
 
+		if !specified {
+			// rather than assume US-ASCII, see what the text looks like
+			g, confidence := DetectCharset(body)
+			if g != "" && g != "us-ascii" {
+				if t, err := toUnicode(body, g); err == nil {
+					c = charset.Info(g)
+					bp.Text = toCRLF(t)
+					decodeErr = nil
+					h.addDiagnostic(DiagnosticCharsetGuessed, SeverityInfo, nil,
+						"no charset declared; the text looks like %s (%d%% confidence)",
+						g, confidence)
+				}
+			}
+		}
+
 		if c.Name == "GB2312" || c.Name == "ISO-2022-JP" ||
 			c.Name == "KS_C_5601-1987" {
 			// undefined code point usage in GB2312 spam is much too
@@ -532,7 +560,7 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 			} else if decodeErr != nil {
 				errmsg += ": " + decodeErr.Error()
 			}
-			bp.err = errors.New(errmsg)
+			bp.err = wrapError(ErrBadEncoding, "%s", errmsg)
 		}
 
 		if strings.ToLower(c.Name) != "us-ascii" {
@@ -550,6 +578,7 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 				cte = nil
 			} else if cte.Encoding != QPEncoding {
 				cte.Encoding = QPEncoding
+				cte.baseValue = "quoted-printable"
 			}
 		} else if qp {
 			h.Add("Content-Transfer-Encoding", "quoted-printable")
@@ -577,6 +606,7 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 				cte = nil
 			} else if cte != nil {
 				cte.Encoding = e
+				cte.baseValue = "base64"
 			} else {
 				h.Add("Content-Transfer-Encoding", "base64")
 				cte = h.ContentTransferEncoding()
@@ -585,7 +615,8 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 	}
 
 	if ct.Type == "multipart" {
-		bp.parseMultipart(rfc5322[start:end], ct.parameter("boundary"), ct.Subtype == "digest")
+		bp.parseMultipart(rfc5322[start:end], ct.parameter("boundary"), ct.Subtype == "digest",
+			base.advance(rfc5322, start))
 	} else if ct.Type == "message" && ct.Subtype == "rfc822" {
 		// There are sometimes blank lines before the message.
 		for rfc5322[start] == 13 || rfc5322[start] == 10 {
@@ -593,7 +624,7 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 		}
 		m := NewMessage()
 		m.parent = bp
-		m.Parse(rfc5322[start:end])
+		m.parse(rfc5322[start:end], RFC5322Header, base.advance(rfc5322, start))
 		for _, p := range m.Parts {
 			bp.Parts = append(bp.Parts, p)
 			p.parent = bp
@@ -624,6 +655,7 @@ func (p *Part) parseBodypart(rfc5322 string, h *Header) *Part {
 	}
 
 	h.Simplify()
+	p.spillDecoded(bp)
 
 	return bp
 }
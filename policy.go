@@ -0,0 +1,376 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A Verdict collects what is known about a message, for a Policy to act on.
+//
+// NewVerdict() fills it in from the message: the verdicts of spam filters
+// which have seen it, recorded in its header, the topmost Received-SPF
+// field, the parser's diagnostics, any homograph in the From address and
+// the AttachmentWarnings(). DKIM and ARC are left for the caller, e.g. from
+// a GatewayResult, since they require DNS lookups. Score is the spam score,
+// from SpamAssassin if present and otherwise Rspamd, and HasScore says
+// whether there is one.
+type Verdict struct {
+	Message      *Message
+	Score        float64
+	HasScore     bool
+	SpamAssassin *SpamStatus
+	Rspamd       *RspamdResult
+	SPF          *SPFResult
+	DKIM         []*DKIMResult
+	ARC          *ARCResult
+	Diagnostics  []Diagnostic
+	Homograph    *Homograph
+	Attachments  []AttachmentWarning
+}
+
+// Returns a Verdict on \a m, as described for Verdict.
+func NewVerdict(m *Message) *Verdict {
+	v := &Verdict{Message: m, Diagnostics: m.Diagnostics(),
+		Attachments: m.AttachmentWarnings()}
+	h := m.Header
+	if h == nil {
+		return v
+	}
+	v.SpamAssassin = h.SpamAssassin()
+	v.Rspamd = h.Rspamd()
+	if v.SpamAssassin != nil {
+		v.Score, v.HasScore = v.SpamAssassin.Score, true
+	} else if v.Rspamd != nil {
+		v.Score, v.HasScore = v.Rspamd.Score, true
+	}
+	if spf := h.ReceivedSPF(); len(spf) > 0 {
+		v.SPF = spf[0]
+	}
+	for _, a := range h.Addresses(FromFieldName) {
+		if hg := a.SuspiciousHomograph(); hg != nil {
+			v.Homograph = hg
+			break
+		}
+	}
+	return v
+}
+
+// A Condition decides whether a Rule applies to a Verdict.
+type Condition func(v *Verdict) bool
+
+// Returns a Condition which holds if the spam score is at least \a min.
+func ScoreAtLeast(min float64) Condition {
+	return func(v *Verdict) bool {
+		return v.HasScore && v.Score >= min
+	}
+}
+
+// Returns a Condition which holds if SpamAssassin or Rspamd considers the
+// message spam.
+func FlaggedAsSpam() Condition {
+	return func(v *Verdict) bool {
+		return v.SpamAssassin != nil && v.SpamAssassin.Spam ||
+			v.Rspamd != nil && v.Rspamd.Spam
+	}
+}
+
+// Returns a Condition which holds if Rspamd recommended one of \a actions,
+// e.g. "reject" or "add header".
+func RspamdActionIs(actions ...string) Condition {
+	return func(v *Verdict) bool {
+		if v.Rspamd == nil {
+			return false
+		}
+		for _, a := range actions {
+			if strings.EqualFold(v.Rspamd.Action, a) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a Condition which holds if the SPF result is one of \a results,
+// e.g. "fail" or "softfail".
+func SPFResultIs(results ...string) Condition {
+	return func(v *Verdict) bool {
+		if v.SPF == nil {
+			return false
+		}
+		for _, r := range results {
+			if strings.EqualFold(v.SPF.Result, r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a Condition which holds if the message has DKIM signatures and
+// none of them passes.
+func DKIMFailed() Condition {
+	return func(v *Verdict) bool {
+		for _, r := range v.DKIM {
+			if r.Result == "pass" {
+				return false
+			}
+		}
+		return len(v.DKIM) > 0
+	}
+}
+
+// Returns a Condition which holds if the parser recorded a diagnostic with
+// one of \a codes.
+func HasDiagnostic(codes ...string) Condition {
+	return func(v *Verdict) bool {
+		for _, d := range v.Diagnostics {
+			for _, c := range codes {
+				if d.Code == c {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// Returns a Condition which holds if the From address looks like an
+// attempt to pass itself off as another.
+func SuspiciousFrom() Condition {
+	return func(v *Verdict) bool {
+		return v.Homograph != nil
+	}
+}
+
+// Returns a Condition which holds if an attachment may be disguised as
+// another kind of file, e.g. a program as a document.
+func SuspiciousAttachment() Condition {
+	return func(v *Verdict) bool {
+		return len(v.Attachments) > 0
+	}
+}
+
+// Returns a Condition which holds if the header field \a name contains
+// \a substring, compared case-insensitively.
+func HeaderContains(name, substring string) Condition {
+	substring = strings.ToLower(substring)
+	return func(v *Verdict) bool {
+		if v.Message == nil || v.Message.Header == nil {
+			return false
+		}
+		for _, f := range v.Message.Header.Fields {
+			if strings.EqualFold(f.Name(), name) &&
+				strings.Contains(strings.ToLower(f.Value()), substring) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a Condition which holds if all of \a conditions hold.
+func All(conditions ...Condition) Condition {
+	return func(v *Verdict) bool {
+		for _, c := range conditions {
+			if !c(v) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// Returns a Condition which holds if any of \a conditions holds.
+func Any(conditions ...Condition) Condition {
+	return func(v *Verdict) bool {
+		for _, c := range conditions {
+			if c(v) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Returns a Condition which holds if \a c does not.
+func Not(c Condition) Condition {
+	return func(v *Verdict) bool {
+		return !c(v)
+	}
+}
+
+// An Action is what a Rule does to a message: add a header field, tag the
+// subject, file it into a folder, or reject it. The constructors below make
+// each kind.
+type Action struct {
+	Kind   ActionKind
+	Name   string // of the field to add
+	Value  string // of the field to add
+	Tag    string // to prepend to the subject
+	Folder string // to file into
+	Reject *Rejection
+}
+
+// ActionKind says what an Action does.
+type ActionKind int
+
+const (
+	// Adds a header field.
+	ActionAddHeader ActionKind = iota
+	// Prepends a tag to the subject.
+	ActionTagSubject
+	// Files the message into a folder.
+	ActionFileInto
+	// Rejects the message during the SMTP transaction.
+	ActionReject
+)
+
+// A Rejection is the SMTP reply with which a message is rejected, e.g. 550
+// with enhanced status code 5.7.1.
+type Rejection struct {
+	Code     int
+	Enhanced string
+	Text     string
+}
+
+// Returns the reply as it is sent, e.g. "550 5.7.1 Message rejected as
+// spam".
+func (r *Rejection) String() string {
+	return r.SMTPStatus().String()
+}
+
+// Returns the reply as an SMTPStatus.
+func (r *Rejection) SMTPStatus() SMTPStatus {
+	return SMTPStatus{Code: r.Code, Enhanced: r.Enhanced, Lines: []string{r.Text}}
+}
+
+// Returns an Action which adds a field named \a name with value \a value.
+func AddHeaderAction(name, value string) Action {
+	return Action{Kind: ActionAddHeader, Name: name, Value: value}
+}
+
+// Returns an Action which prepends \a tag to the subject, as TagSubject()
+// does.
+func TagSubjectAction(tag string) Action {
+	return Action{Kind: ActionTagSubject, Tag: tag}
+}
+
+// Returns an Action which files the message into \a folder, e.g. "Junk".
+func FileIntoAction(folder string) Action {
+	return Action{Kind: ActionFileInto, Folder: folder}
+}
+
+// Returns an Action which rejects the message with the SMTP reply \a code,
+// enhanced status code \a enhanced (which may be empty) and \a text.
+func RejectAction(code int, enhanced, text string) Action {
+	return Action{Kind: ActionReject, Reject: &Rejection{Code: code, Enhanced: enhanced, Text: text}}
+}
+
+// A Rule applies Actions to messages whose Verdict satisfies When. If Stop
+// is true, no later rules are considered once this one has applied. A
+// Rule which rejects always stops.
+type Rule struct {
+	Name    string
+	When    Condition
+	Actions []Action
+	Stop    bool
+}
+
+// A Policy is a list of Rules, which are considered in order.
+type Policy struct {
+	Rules []Rule
+}
+
+// Returns a Policy for a receiving server which trusts the spam filter that
+// added the X-Spam-* or X-Spamd-Result fields: messages scoring at least
+// \a tagAt get an X-Spam-Flag field and "[SPAM]" subject tag, those scoring
+// at least \a junkAt are also filed into "Junk", and those scoring at least
+// \a rejectAt are rejected with 550 5.7.1. A threshold of 0 disables that
+// step.
+func NewSpamPolicy(tagAt, junkAt, rejectAt float64) *Policy {
+	p := &Policy{}
+	if rejectAt > 0 {
+		p.Rules = append(p.Rules, Rule{Name: "reject", When: ScoreAtLeast(rejectAt),
+			Actions: []Action{RejectAction(550, "5.7.1", "Message rejected as spam")}})
+	}
+	if tagAt > 0 {
+		p.Rules = append(p.Rules, Rule{Name: "tag", When: ScoreAtLeast(tagAt),
+			Actions: []Action{AddHeaderAction("X-Spam-Flag", "YES"), TagSubjectAction("[SPAM]")}})
+	}
+	if junkAt > 0 {
+		p.Rules = append(p.Rules, Rule{Name: "junk", When: ScoreAtLeast(junkAt),
+			Actions: []Action{FileIntoAction("Junk")}})
+	}
+	return p
+}
+
+// A Decision is the outcome of applying a Policy to a Verdict: the names of
+// the Rules which applied, the fields to add, the subject tags to add, the
+// folder to file into (the last one given, or "" for the inbox), and the
+// rejection, if any.
+type Decision struct {
+	Rules  []string
+	Fields [][2]string
+	Tags   []string
+	Folder string
+	Reject *Rejection
+}
+
+// Considers each rule of this Policy in turn for \a v, and returns what
+// should be done.
+func (p *Policy) Evaluate(v *Verdict) *Decision {
+	d := &Decision{}
+	for _, r := range p.Rules {
+		if r.When != nil && !r.When(v) {
+			continue
+		}
+		d.Rules = append(d.Rules, r.Name)
+		stop := r.Stop
+		for _, a := range r.Actions {
+			switch a.Kind {
+			case ActionAddHeader:
+				d.Fields = append(d.Fields, [2]string{a.Name, a.Value})
+			case ActionTagSubject:
+				d.Tags = append(d.Tags, a.Tag)
+			case ActionFileInto:
+				d.Folder = a.Folder
+			case ActionReject:
+				d.Reject = a.Reject
+				stop = true
+			}
+		}
+		if stop {
+			break
+		}
+	}
+	return d
+}
+
+// Returns the Transforms which carry out this Decision's changes to the
+// message: adding fields and tagging the subject. Filing and rejecting are
+// left to the caller.
+func (d *Decision) Transforms() []Transform {
+	r := []Transform{}
+	if len(d.Fields) > 0 {
+		fields := d.Fields
+		r = append(r, func(m *Message) error {
+			for _, f := range fields {
+				m.Header.Add(f[0], f[1])
+			}
+			return nil
+		})
+	}
+	for _, t := range d.Tags {
+		r = append(r, TagSubject(t))
+	}
+	return r
+}
+
+// Applies this Decision's Transforms to \a m.
+func (d *Decision) Apply(m *Message) error {
+	for _, t := range d.Transforms() {
+		if err := t(m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSpamPolicy(t *testing.T) {
+	read := func(header string) *mail.Message {
+		m, err := mail.ReadMessage("From: alice@example.com\r\n" +
+			"Subject: Offer\r\n" + header + "\r\nBuy now\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	p := mail.NewSpamPolicy(5, 8, 15)
+
+	m := read("X-Spam-Status: No, score=1.2 required=5.0\r\n")
+	d := p.Evaluate(mail.NewVerdict(m))
+	testIntegerEquals(t, "ham rules", len(d.Rules), 0)
+
+	m = read("X-Spam-Status: Yes, score=9.5 required=5.0 tests=BAYES_99\r\n")
+	d = p.Evaluate(mail.NewVerdict(m))
+	testStringEquals(t, "spam rules", strings.Join(d.Rules, " "), "tag junk")
+	testStringEquals(t, "folder", d.Folder, "Junk")
+	if d.Reject != nil {
+		t.Error("spam rejected")
+	}
+	if err := d.Apply(m); err != nil {
+		t.Fatal(err)
+	}
+	d.Apply(m)
+	testStringEquals(t, "subject", m.Header.Subject(), "[SPAM] Offer")
+	testStringEquals(t, "flag", m.Header.Get("X-Spam-Flag"), "YES")
+
+	m = read("X-Spamd-Result: default: True [21.50 / 15.00]; BAYES_SPAM(5.10)[99.99%]\r\n")
+	d = p.Evaluate(mail.NewVerdict(m))
+	testStringEquals(t, "rejected rules", strings.Join(d.Rules, " "), "reject")
+	testStringEquals(t, "rejection", d.Reject.String(), "550 5.7.1 Message rejected as spam")
+
+	custom := &mail.Policy{Rules: []mail.Rule{
+		{Name: "spf", When: mail.All(mail.SPFResultIs("fail", "softfail"), mail.Not(mail.FlaggedAsSpam())),
+			Actions: []mail.Action{mail.AddHeaderAction("X-Policy", "spf-fail")}},
+		{Name: "external", When: mail.Not(mail.HeaderContains("From", "@example.net")),
+			Actions: []mail.Action{mail.TagSubjectAction("[EXTERNAL]")}, Stop: true},
+		{Name: "never", Actions: []mail.Action{mail.FileIntoAction("Other")}},
+	}}
+	m = read("Received-SPF: softfail (example.com: domain of transitioning alice@example.com) client-ip=192.0.2.1;\r\n")
+	d = custom.Evaluate(mail.NewVerdict(m))
+	testStringEquals(t, "custom rules", strings.Join(d.Rules, " "), "spf external")
+	testStringEquals(t, "custom folder", d.Folder, "")
+	d.Apply(m)
+	testStringEquals(t, "custom subject", m.Header.Subject(), "[EXTERNAL] Offer")
+	testStringEquals(t, "custom field", m.Header.Get("X-Policy"), "spf-fail")
+}
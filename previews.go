@@ -0,0 +1,187 @@
+package mail
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A Preview is a small representation of an attachment for display before
+// it is opened: an image (ContentType and Data), e.g. a thumbnail or the
+// first page of a document, and/or a snippet of its Text.
+type Preview struct {
+	ContentType string `json:"contentType,omitempty"`
+	Data        []byte `json:"data,omitempty"`
+	Text        string `json:"text,omitempty"`
+}
+
+// A PreviewProvider makes previews of some kinds of attachment. Name
+// identifies the provider and its settings in a PreviewCache, so two
+// providers making different previews must have different names.
+//
+// Preview returns the preview of \a p, whose decoded content is \a data,
+// or nil and no error if it does not handle such attachments.
+type PreviewProvider interface {
+	Name() string
+	Preview(p *Part, data []byte) (*Preview, error)
+}
+
+// A PreviewCache keeps previews so that they need not be made again, e.g.
+// next to the messages in a store. Keys are made by Previews() from the
+// provider's name and a hash of the attachment's content, so an attachment
+// found in many messages is previewed once.
+type PreviewCache interface {
+	Get(key string) (*Preview, bool)
+	Put(key string, p *Preview)
+}
+
+// A MemoryPreviewCache is a PreviewCache keeping previews in memory. It is
+// safe for concurrent use.
+type MemoryPreviewCache struct {
+	mu       sync.Mutex
+	previews map[string]*Preview
+}
+
+// Returns a new, empty MemoryPreviewCache.
+func NewMemoryPreviewCache() *MemoryPreviewCache {
+	return &MemoryPreviewCache{previews: map[string]*Preview{}}
+}
+
+func (c *MemoryPreviewCache) Get(key string) (*Preview, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	p, ok := c.previews[key]
+	return p, ok
+}
+
+func (c *MemoryPreviewCache) Put(key string, p *Preview) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.previews[key] = p
+}
+
+// Returns a preview of each of Attachments(), in the same order, made by
+// the first of \a providers which handles it, or nil for attachments which
+// none handles or whose preview failed. If \a cache is not nil, previews
+// are looked up there first, and those made are added to it; failures are
+// not cached.
+func (m *Message) Previews(providers []PreviewProvider, cache PreviewCache) []*Preview {
+	attachments := m.Attachments()
+	r := make([]*Preview, len(attachments))
+	for i, p := range attachments {
+		rc, err := p.Open()
+		if err != nil {
+			continue
+		}
+		data, err := ioutil.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		hash := hex.EncodeToString(sum[:])
+		for _, pp := range providers {
+			key := pp.Name() + ":" + hash
+			if cache != nil {
+				if cached, ok := cache.Get(key); ok {
+					if cached == nil {
+						continue
+					}
+					r[i] = cached
+					break
+				}
+			}
+			preview, err := pp.Preview(p, data)
+			if err != nil {
+				continue
+			}
+			if cache != nil {
+				// nil is cached too, so that the next provider is
+				// asked directly next time
+				cache.Put(key, preview)
+			}
+			if preview != nil {
+				r[i] = preview
+				break
+			}
+		}
+	}
+	return r
+}
+
+// A Thumbnailer previews GIF, JPEG and PNG images as PNG thumbnails no
+// larger than Width by Height pixels, keeping the aspect ratio.
+type Thumbnailer struct {
+	Width  int
+	Height int
+}
+
+func (t *Thumbnailer) Name() string {
+	return "thumbnail/" + strconv.Itoa(t.Width) + "x" + strconv.Itoa(t.Height)
+}
+
+// Decodes the image \a data and returns its thumbnail.
+func (t *Thumbnailer) Preview(p *Part, data []byte) (*Preview, error) {
+	if !strings.HasPrefix(p.AttachmentInfo(false).ContentType, "image/") {
+		return nil, nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w > t.Width {
+		w, h = t.Width, h*t.Width/w
+	}
+	if h > t.Height {
+		w, h = w*t.Height/h, t.Height
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			dst.Set(x, y, src.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
+		return nil, err
+	}
+	return &Preview{ContentType: "image/png", Data: buf.Bytes()}, nil
+}
+
+// A TextSnippet previews text attachments, e.g. text/plain, text/csv and
+// text/html, with their first Length characters of text, with whitespace
+// simplified. HTML is converted to text first.
+type TextSnippet struct {
+	Length int
+}
+
+func (t *TextSnippet) Name() string {
+	return "text/" + strconv.Itoa(t.Length)
+}
+
+// Returns the snippet of \a p, whose text is decoded from \a data as the
+// parser decoded it.
+func (t *TextSnippet) Preview(p *Part, data []byte) (*Preview, error) {
+	if !p.hasText || !strings.HasPrefix(p.AttachmentInfo(false).ContentType, "text/") {
+		return nil, nil
+	}
+	text := p.Text
+	if p.contentType() == "text/html" {
+		text = htmlToText(text)
+	}
+	return &Preview{Text: truncateRunes(strings.Join(strings.Fields(text), " "), t.Length)}, nil
+}
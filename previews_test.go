@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	pngenc "image/png"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// A PreviewProvider which counts its calls.
+type countingPreviewer struct {
+	calls int
+}
+
+func (c *countingPreviewer) Name() string { return "counting" }
+
+func (c *countingPreviewer) Preview(p *mail.Part, data []byte) (*mail.Preview, error) {
+	c.calls++
+	return &mail.Preview{Text: fmt.Sprintf("%d bytes", len(data))}, nil
+}
+
+func TestPreviews(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 100))
+	var buf bytes.Buffer
+	pngenc.Encode(&buf, img)
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("To", "bob@example.com")
+	c.Text = "Files attached.\n"
+	c.Attach("wide.png", "image/png", buf.String())
+	c.Attach("notes.txt", "text/plain", "First   line\nsecond line of the notes\n")
+	c.Attach("data.bin", "application/octet-stream", "\x00\x01\x02")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	counting := &countingPreviewer{}
+	providers := []mail.PreviewProvider{&mail.Thumbnailer{Width: 100, Height: 100},
+		&mail.TextSnippet{Length: 17}, counting}
+	cache := mail.NewMemoryPreviewCache()
+	previews := m.Previews(providers, cache)
+	testIntegerEquals(t, "previews", len(previews), 3)
+	thumb, _, err := image.DecodeConfig(bytes.NewReader(previews[0].Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "thumbnail", fmt.Sprintf("%dx%d", thumb.Width, thumb.Height), "100x25")
+	testStringEquals(t, "snippet", previews[1].Text, "First line second")
+	testStringEquals(t, "fallback", previews[2].Text, "3 bytes")
+
+	m.Previews(providers, cache)
+	testIntegerEquals(t, "cached", counting.calls, 1)
+}
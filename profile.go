@@ -0,0 +1,215 @@
+package mail
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// RepairPolicy says what a Profile does with messages the parser had to
+// repair.
+type RepairPolicy int
+
+const (
+	// RepairLenient accepts whatever the parser can make sense of, as
+	// ReadMessage() does.
+	RepairLenient RepairPolicy = iota
+	// RepairStrict rejects messages whose header is invalid even after
+	// repair, and those for which the parser recorded a diagnostic with
+	// SeverityError, i.e. had to guess or discard data.
+	RepairStrict
+)
+
+// Limits bounds the messages a Profile accepts. MaxSize is the largest
+// message, in bytes, MaxParts the most bodyparts (counting those of embedded
+// messages) and MaxDepth the deepest nesting of multiparts and embedded
+// messages; a single-part message has depth 0. A zero field means no limit.
+type Limits struct {
+	MaxSize  int
+	MaxParts int
+	MaxDepth int
+}
+
+// A Profile bundles the configuration used to process mail for one tenant
+// of a multi-tenant service, so that each tenant's mail is handled with its
+// own settings, and a tenant's settings can be replaced without affecting
+// the others.
+//
+// Limits and Repair govern ReadMessage(), which also normalizes the text of
+// each message it reads as Normalize says. Signer signs and Verifier
+// verifies DKIM signatures; if Verifier is nil, a default DKIMVerifier is
+// used. AllowedDomains lists the domains the tenant may send from; a domain
+// starting with "." allows its subdomains, e.g. ".example.com" allows
+// "news.example.com". If AllowedDomains is empty, any domain is allowed.
+// Transforms are applied to each outgoing message, and SendPolicy, if not
+// nil, checks it.
+//
+// A Profile must not be modified while it is in use; to change a tenant's
+// settings, make a new Profile and replace the old one, e.g. with
+// Profiles.Set().
+type Profile struct {
+	Name           string
+	Limits         Limits
+	Repair         RepairPolicy
+	Normalize      Normalization
+	Signer         *DKIMSigner
+	Verifier       *DKIMVerifier
+	AllowedDomains []string
+	Transforms     []Transform
+	SendPolicy     *SendPolicy
+}
+
+// Parses \a rfc5322 as ReadMessage() does, normalizes it as Normalize says,
+// and returns the message, or an error if it does not satisfy this profile's
+// Limits (ErrMessageTooLarge or ErrTooComplex) or Repair policy
+// (ErrMalformed).
+func (p *Profile) ReadMessage(rfc5322 string) (*Message, error) {
+	if p.Limits.MaxSize > 0 && len(rfc5322) > p.Limits.MaxSize {
+		return nil, wrapError(ErrMessageTooLarge, "mail: message is %d bytes, more than %d",
+			len(rfc5322), p.Limits.MaxSize)
+	}
+	m, err := ReadMessage(rfc5322)
+	if err != nil {
+		return nil, err
+	}
+	if m.Part != nil {
+		parts, depth := m.Part.complexity()
+		if p.Limits.MaxParts > 0 && parts > p.Limits.MaxParts {
+			return nil, wrapError(ErrTooComplex, "mail: message has %d bodyparts, more than %d",
+				parts, p.Limits.MaxParts)
+		}
+		if p.Limits.MaxDepth > 0 && depth > p.Limits.MaxDepth {
+			return nil, wrapError(ErrTooComplex, "mail: message is nested %d deep, more than %d",
+				depth, p.Limits.MaxDepth)
+		}
+	}
+	if p.Repair == RepairStrict {
+		if err := m.Header.Error(); err != nil {
+			return nil, wrapError(ErrMalformed, "mail: %v", err)
+		}
+		for _, d := range m.Diagnostics() {
+			if d.Severity == SeverityError {
+				return nil, wrapError(ErrMalformed, "mail: %s", d)
+			}
+		}
+	}
+	m.Normalize(p.Normalize)
+	return m, nil
+}
+
+// Returns the number of bodyparts below this one, including those of
+// embedded messages, and the depth of the deepest.
+func (p *Part) complexity() (int, int) {
+	parts, depth := 0, 0
+	for _, c := range p.Parts {
+		n, d := c.complexity()
+		parts += n + 1
+		if d+1 > depth {
+			depth = d + 1
+		}
+	}
+	return parts, depth
+}
+
+// Returns true if the tenant may send from \a domain, as described for
+// Profile.AllowedDomains.
+func (p *Profile) AllowsDomain(domain string) bool {
+	if len(p.AllowedDomains) == 0 {
+		return true
+	}
+	domain = strings.ToLower(strings.TrimSuffix(domain, "."))
+	for _, d := range p.AllowedDomains {
+		d = strings.ToLower(d)
+		if d == domain || strings.HasPrefix(d, ".") && strings.HasSuffix(domain, d) {
+			return true
+		}
+	}
+	return false
+}
+
+// Prepares \a m for sending with the envelope \a env: checks that its From
+// addresses are in the allowed domains, applies the Transforms, checks the
+// result against the SendPolicy, and returns it signed with Signer (if not
+// nil). Returns an error matching ErrDomainNotAllowed or ErrPolicyViolation
+// if the message may not be sent, or the error of a Transform or of
+// signing.
+func (p *Profile) Prepare(m *Message, env Envelope) (string, error) {
+	for _, a := range m.Header.Addresses(FromFieldName) {
+		if !p.AllowsDomain(a.Domain) {
+			return "", wrapError(ErrDomainNotAllowed,
+				"mail: profile %s may not send from %s", p.Name, a.lpdomain())
+		}
+	}
+	for _, t := range p.Transforms {
+		if err := t(m); err != nil {
+			return "", err
+		}
+	}
+	if p.SendPolicy != nil {
+		if err := p.SendPolicy.Validate(m, env); err != nil {
+			return "", err
+		}
+	}
+	out := m.RFC822(false)
+	if p.Signer == nil {
+		return out, nil
+	}
+	return p.Signer.Sign(out)
+}
+
+// Returns a Gateway which uses this profile's Verifier, Transforms and
+// Signer, and identifies itself as \a authServID.
+func (p *Profile) Gateway(authServID string) *Gateway {
+	return &Gateway{
+		AuthServID: authServID,
+		Verifier:   p.Verifier,
+		Transforms: p.Transforms,
+		Signer:     p.Signer,
+	}
+}
+
+// Profiles holds the Profile of each tenant, by name. It may be used by
+// several goroutines at once, so that profiles can be replaced while mail
+// is being processed with them.
+type Profiles struct {
+	mu       sync.RWMutex
+	profiles map[string]*Profile
+}
+
+// Returns an empty Profiles.
+func NewProfiles() *Profiles {
+	return &Profiles{profiles: map[string]*Profile{}}
+}
+
+// Adds \a p, replacing any profile with the same name.
+func (ps *Profiles) Set(p *Profile) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.profiles[p.Name] = p
+}
+
+// Returns the profile named \a name, or nil if there is none.
+func (ps *Profiles) Get(name string) *Profile {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	return ps.profiles[name]
+}
+
+// Removes the profile named \a name, if there is one.
+func (ps *Profiles) Remove(name string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(ps.profiles, name)
+}
+
+// Returns the names of all profiles, sorted.
+func (ps *Profiles) Names() []string {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+	r := make([]string, 0, len(ps.profiles))
+	for name := range ps.profiles {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
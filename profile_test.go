@@ -0,0 +1,78 @@
+package mail_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestProfile(t *testing.T) {
+	nested := "From: alice@example.com\r\nTo: bob@example.org\r\nSubject: Nested\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\nMIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=a\r\n\r\n" +
+		"--a\r\nContent-Type: text/plain\r\n\r\nOuter\r\n" +
+		"--a\r\nContent-Type: multipart/alternative; boundary=b\r\n\r\n" +
+		"--b\r\nContent-Type: text/plain\r\n\r\nInner\r\n" +
+		"--b\r\nContent-Type: text/html\r\n\r\n<p>Inner</p>\r\n" +
+		"--b--\r\n--a--\r\n"
+	p := &mail.Profile{Name: "acme", Limits: mail.Limits{MaxParts: 4, MaxDepth: 2}}
+	if _, err := p.ReadMessage(nested); err != nil {
+		t.Errorf("expected the message to be within the limits, got %v", err)
+	}
+	p.Limits.MaxDepth = 1
+	if _, err := p.ReadMessage(nested); !errors.Is(err, mail.ErrTooComplex) {
+		t.Errorf("expected ErrTooComplex for depth 2, got %v", err)
+	}
+	p.Limits = mail.Limits{MaxParts: 3}
+	if _, err := p.ReadMessage(nested); !errors.Is(err, mail.ErrTooComplex) {
+		t.Errorf("expected ErrTooComplex for 4 parts, got %v", err)
+	}
+	p.Limits = mail.Limits{MaxSize: 100}
+	if _, err := p.ReadMessage(nested); !errors.Is(err, mail.ErrMessageTooLarge) {
+		t.Errorf("expected ErrMessageTooLarge, got %v", err)
+	}
+
+	corrupt := "From: alice@example.com\r\nDate: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"Content-MD5: AAAAAAAAAAAAAAAAAAAAAA==\r\n\r\nHello\r\n"
+	p.Limits = mail.Limits{}
+	if _, err := p.ReadMessage(corrupt); err != nil {
+		t.Errorf("expected the lenient profile to accept the message, got %v", err)
+	}
+	p.Repair = mail.RepairStrict
+	if _, err := p.ReadMessage(corrupt); !errors.Is(err, mail.ErrMalformed) {
+		t.Errorf("expected ErrMalformed, got %v", err)
+	}
+
+	p = &mail.Profile{Name: "acme", AllowedDomains: []string{"acme.example", ".mail.acme.example"},
+		Transforms: []mail.Transform{mail.AddFooter("Sent by Acme")}}
+	ps := mail.NewProfiles()
+	ps.Set(p)
+	ps.Set(&mail.Profile{Name: "globex"})
+	testStringEquals(t, "names", strings.Join(ps.Names(), " "), "acme globex")
+	p = ps.Get("acme")
+	for domain, allowed := range map[string]bool{"acme.example": true, "ACME.example.": true,
+		"news.mail.acme.example": true, "mail.acme.example": false, "globex.example": false} {
+		if p.AllowsDomain(domain) != allowed {
+			t.Errorf("AllowsDomain(%s): expected %v", domain, allowed)
+		}
+	}
+	env := mail.Envelope{To: []string{"bob@example.org"}}
+	m, _ := mail.ReadMessage("From: news@acme.example\r\nTo: bob@example.org\r\n\r\nHello\r\n")
+	out, err := p.Prepare(m, env)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(out, "Hello\r\n\r\nSent by Acme\r\n") {
+		t.Errorf("expected the footer to be added, got %q", out)
+	}
+	m, _ = mail.ReadMessage("From: news@globex.example\r\n\r\nHello\r\n")
+	if _, err := p.Prepare(m, env); !errors.Is(err, mail.ErrDomainNotAllowed) {
+		t.Errorf("expected ErrDomainNotAllowed, got %v", err)
+	}
+	ps.Remove("acme")
+	if ps.Get("acme") != nil {
+		t.Errorf("expected acme to be removed")
+	}
+}
@@ -0,0 +1,203 @@
+package mail
+
+import (
+	"bufio"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A PrometheusMetrics is a Metrics which keeps what it is given in memory
+// and writes it in the Prometheus text exposition format, so that a server
+// can offer its metrics to Prometheus without further code:
+//
+//	m := mail.NewPrometheusMetrics()
+//	mail.DefaultMetrics = m
+//	http.Handle("/metrics", m)
+//
+// Durations and message sizes become histograms, e.g.
+// mail_parse_duration_seconds and mail_message_size_bytes, whose _count is
+// the number of operations; errors and DKIM results become counters, e.g.
+// mail_send_errors_total and mail_dkim_results_total{result="pass"}; and
+// the queue depth becomes the gauge mail_queue_depth. Other names become
+// counters. Attributes become labels.
+//
+// A PrometheusMetrics is safe for concurrent use.
+type PrometheusMetrics struct {
+	mu     sync.Mutex
+	series map[string]*prometheusSeries
+}
+
+// The kinds of Prometheus metrics.
+const (
+	prometheusCounter   = "counter"
+	prometheusGauge     = "gauge"
+	prometheusHistogram = "histogram"
+)
+
+// The bucket bounds of the histograms: seconds for durations, bytes for
+// sizes.
+var (
+	prometheusDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60}
+	prometheusSizeBuckets     = []float64{1 << 10, 4 << 10, 16 << 10, 64 << 10, 256 << 10,
+		1 << 20, 4 << 20, 16 << 20, 64 << 20}
+)
+
+// The values recorded for one metric name and set of labels.
+type prometheusSeries struct {
+	name    string
+	kind    string
+	labels  string
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+// Returns a new, empty PrometheusMetrics.
+func NewPrometheusMetrics() *PrometheusMetrics {
+	return &PrometheusMetrics{series: map[string]*prometheusSeries{}}
+}
+
+// Records \a value for the metric \a name (as Metrics describes) with
+// \a attributes as labels.
+func (p *PrometheusMetrics) Record(name string, value float64, attributes map[string]string) {
+	labels := prometheusLabels(attributes)
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	key := name + labels
+	s := p.series[key]
+	if s == nil {
+		s = newPrometheusSeries(name, labels)
+		p.series[key] = s
+	}
+	switch s.kind {
+	case prometheusGauge:
+		s.sum = value
+	case prometheusCounter:
+		s.sum += value
+	case prometheusHistogram:
+		s.count++
+		s.sum += value
+		for i, b := range s.buckets {
+			if value <= b {
+				s.counts[i]++
+			}
+		}
+	}
+}
+
+// Returns a new series for the metric \a name with \a labels, named and
+// typed as described for PrometheusMetrics.
+func newPrometheusSeries(name, labels string) *prometheusSeries {
+	s := &prometheusSeries{labels: labels, kind: prometheusCounter}
+	base := strings.Replace(name, ".", "_", -1)
+	switch {
+	case strings.HasSuffix(name, ".duration"):
+		s.name, s.kind, s.buckets = base+"_seconds", prometheusHistogram, prometheusDurationBuckets
+	case strings.HasSuffix(name, ".size"):
+		s.name, s.kind, s.buckets = base+"_bytes", prometheusHistogram, prometheusSizeBuckets
+	case strings.HasSuffix(name, ".depth"):
+		s.name, s.kind = base, prometheusGauge
+	default:
+		s.name = base + "_total"
+	}
+	s.counts = make([]uint64, len(s.buckets))
+	return s
+}
+
+// Returns \a attributes as Prometheus labels, e.g. `{result="pass"}`,
+// sorted by name, or an empty string if there are none.
+func prometheusLabels(attributes map[string]string) string {
+	if len(attributes) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(attributes))
+	for n := range attributes {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	r := make([]string, 0, len(names))
+	for _, n := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(attributes[n])
+		r = append(r, strings.Replace(n, ".", "_", -1)+`="`+v+`"`)
+	}
+	return "{" + strings.Join(r, ",") + "}"
+}
+
+// Writes all metrics to \a w in the Prometheus text exposition format
+// (version 0.0.4), sorted by name, and returns the number of bytes written.
+func (p *PrometheusMetrics) WriteTo(w io.Writer) (int64, error) {
+	p.mu.Lock()
+	series := make([]prometheusSeries, 0, len(p.series))
+	for _, s := range p.series {
+		c := *s
+		c.counts = append([]uint64(nil), s.counts...)
+		series = append(series, c)
+	}
+	p.mu.Unlock()
+	sort.Slice(series, func(i, j int) bool {
+		if series[i].name != series[j].name {
+			return series[i].name < series[j].name
+		}
+		return series[i].labels < series[j].labels
+	})
+
+	cw := &countingWriter{w: w}
+	b := bufio.NewWriter(cw)
+	for i, s := range series {
+		if i == 0 || series[i-1].name != s.name {
+			b.WriteString("# TYPE " + s.name + " " + s.kind + "\n")
+		}
+		if s.kind != prometheusHistogram {
+			b.WriteString(s.name + s.labels + " " + formatPrometheusValue(s.sum) + "\n")
+			continue
+		}
+		for j, bound := range s.buckets {
+			b.WriteString(s.name + "_bucket" + withLabel(s.labels, "le", formatPrometheusValue(bound)) +
+				" " + strconv.FormatUint(s.counts[j], 10) + "\n")
+		}
+		b.WriteString(s.name + "_bucket" + withLabel(s.labels, "le", "+Inf") +
+			" " + strconv.FormatUint(s.count, 10) + "\n")
+		b.WriteString(s.name + "_sum" + s.labels + " " + formatPrometheusValue(s.sum) + "\n")
+		b.WriteString(s.name + "_count" + s.labels + " " + strconv.FormatUint(s.count, 10) + "\n")
+	}
+	err := b.Flush()
+	return cw.n, err
+}
+
+// Returns \a labels, as prometheusLabels() returns them, with the label
+// \a name="\a value" added at the end.
+func withLabel(labels, name, value string) string {
+	l := name + `="` + value + `"`
+	if labels == "" {
+		return "{" + l + "}"
+	}
+	return labels[:len(labels)-1] + "," + l + "}"
+}
+
+// Returns \a v as Prometheus writes numbers.
+func formatPrometheusValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// A countingWriter counts the bytes written through it.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
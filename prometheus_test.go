@@ -0,0 +1,57 @@
+package mail_test
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	metrics := mail.NewPrometheusMetrics()
+	oldMetrics := mail.DefaultMetrics
+	mail.DefaultMetrics = metrics
+	defer func() {
+		mail.DefaultMetrics = oldMetrics
+	}()
+
+	text := "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello\r\n"
+	for i := 0; i < 2; i++ {
+		if _, err := mail.ReadMessage(text); err != nil {
+			t.Fatal(err)
+		}
+	}
+	v := &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}}
+	v.Verify("DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=s1; h=from;\r\n" +
+		" bh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=AAAA\r\n" + text)
+	s := mail.NewMemoryScheduler()
+	s.Schedule(text, mail.Envelope{To: []string{"bob@example.com"}}, time.Now().Add(time.Hour))
+	metrics.Record("custom", 1, map[string]string{"note": "a \"quoted\" value"})
+
+	var b bytes.Buffer
+	n, err := metrics.WriteTo(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "length", int(n), b.Len())
+	out := b.String()
+	for _, line := range []string{
+		"# TYPE mail_parse_duration_seconds histogram\n",
+		"\nmail_parse_duration_seconds_count 2\n",
+		"# TYPE mail_dkim_results_total counter\n",
+		"\nmail_dkim_results_total{result=\"permerror\"} 1\n",
+		"# TYPE mail_queue_depth gauge\nmail_queue_depth 1\n",
+		"\nmail_message_size_bytes_bucket{operation=\"mail.parse\",le=\"1024\"} 2\n",
+		"\nmail_message_size_bytes_bucket{operation=\"mail.parse\",le=\"+Inf\"} 2\n",
+		"\ncustom_total{note=\"a \\\"quoted\\\" value\"} 1\n",
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("missing %q in:\n%s", line, out)
+		}
+	}
+}
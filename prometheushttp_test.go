@@ -0,0 +1,53 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"net"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestPrometheusHandler(t *testing.T) {
+	metrics := mail.NewPrometheusMetrics()
+	oldMetrics := mail.DefaultMetrics
+	mail.DefaultMetrics = metrics
+	defer func() {
+		mail.DefaultMetrics = oldMetrics
+	}()
+
+	m, err := mail.ReadMessage("From: alice@example.com\r\nSubject: Hi\r\n\r\nHello\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, server := net.Pipe()
+	go fakeDataSink(server, make(chan []string, 1))
+	c, err := smtp.NewClient(client, "sink.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Hello("metrics.example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := mail.SendBDAT(c, "bad\r\nsender@example.com", []string{"bob@example.com"}, m, 0); err == nil {
+		t.Error("bad sender accepted")
+	}
+	c.Quit()
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	testStringEquals(t, "content type", w.Header().Get("Content-Type"), "text/plain; version=0.0.4; charset=utf-8")
+	for _, line := range []string{
+		"\nmail_parse_duration_seconds_count 1\n",
+		"\nmail_send_errors_total 1\n",
+	} {
+		if !strings.Contains(w.Body.String(), line) {
+			t.Errorf("missing %q in:\n%s", line, w.Body)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package mail
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	formdata "mime/multipart"
+	"net/textproto"
+	"strings"
+)
+
+// Fields the send APIs set from their own parameters, or set themselves,
+// and which are therefore not passed on as custom headers.
+var providerOwnFieldNames = map[string]bool{
+	FromFieldName: true, SenderFieldName: true, ToFieldName: true,
+	CcFieldName: true, BccFieldName: true, ReplyToFieldName: true,
+	SubjectFieldName: true, DateFieldName: true, MIMEVersionFieldName: true,
+	ReturnPathFieldName: true, ReceivedFieldName: true,
+	"DKIM-Signature": true,
+}
+
+// The body and attachments of a message, as the send APIs want them.
+type providerContent struct {
+	text        string
+	html        string
+	attachments []*Attachment
+	headers     [][2]string
+}
+
+// Returns the content of this message split up as the send APIs want it:
+// the plain text and HTML bodies, the attachments, and the fields other
+// than those the APIs set themselves.
+func (m *Message) providerContent() (*providerContent, error) {
+	if m.Part == nil || m.Header == nil {
+		return nil, errors.New("mail: message has no content")
+	}
+	c := &providerContent{}
+	if b := m.Part.displayBody(PreferPlain); b != nil && b.contentType() != "text/html" {
+		c.text = b.Text
+	}
+	if b := m.Part.displayBody(PreferHTML); b != nil && b.contentType() == "text/html" {
+		c.html = b.Text
+	}
+	for _, p := range m.Attachments() {
+		data, err := p.data()
+		if err != nil {
+			return nil, err
+		}
+		a := &Attachment{Filename: p.Filename(), ContentType: p.contentType(), Data: data}
+		if p.message != nil {
+			a.Data = p.message.RFC822(false)
+			a.ContentType = "message/rfc822"
+		} else if p.hasText {
+			a.Data = p.Text
+		}
+		if a.ContentType == "" {
+			a.ContentType = "text/plain"
+		}
+		if p.Header != nil {
+			if cid := p.Header.field(ContentIDFieldName, 0); cid != nil {
+				a.ContentID = strings.Trim(cid.Value(), "<>")
+			}
+			if cd := p.Header.ContentDisposition(); cd != nil {
+				a.Inline = strings.ToLower(cd.Disposition) == "inline"
+			}
+		}
+		if a.Filename == "" {
+			a.Filename = "attachment"
+			if a.ContentType == "message/rfc822" {
+				a.Filename = "message.eml"
+			}
+		}
+		c.attachments = append(c.attachments, a)
+	}
+	for _, f := range m.Header.Fields {
+		n := f.Name()
+		if providerOwnFieldNames[n] || strings.HasPrefix(n, "Content-") {
+			continue
+		}
+		c.headers = append(c.headers, [2]string{n, f.Value()})
+	}
+	return c, nil
+}
+
+type sendGridAddress struct {
+	Email string `json:"email"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Returns the addresses in the field \a name of \a h, as SendGrid wants them.
+func sendGridAddresses(h *Header, name string) []sendGridAddress {
+	r := []sendGridAddress{}
+	for _, a := range h.Addresses(name) {
+		if a.Domain != "" {
+			r = append(r, sendGridAddress{Email: a.lpdomain(), Name: a.Name(false)})
+		}
+	}
+	return r
+}
+
+// Returns the JSON body of a SendGrid v3 mail/send API request which sends
+// this message.
+//
+// The recipients are taken from To, Cc and Bcc. Fields which SendGrid does
+// not set itself are passed on as custom headers, e.g. Message-Id,
+// In-Reply-To and List-Unsubscribe.
+func (m *Message) SendGridPayload() ([]byte, error) {
+	c, err := m.providerContent()
+	if err != nil {
+		return nil, err
+	}
+	type personalization struct {
+		To  []sendGridAddress `json:"to"`
+		Cc  []sendGridAddress `json:"cc,omitempty"`
+		Bcc []sendGridAddress `json:"bcc,omitempty"`
+	}
+	type content struct {
+		Type  string `json:"type"`
+		Value string `json:"value"`
+	}
+	type attachment struct {
+		Content     string `json:"content"`
+		Type        string `json:"type"`
+		Filename    string `json:"filename"`
+		Disposition string `json:"disposition"`
+		ContentID   string `json:"content_id,omitempty"`
+	}
+	var p struct {
+		Personalizations []personalization `json:"personalizations"`
+		From             *sendGridAddress  `json:"from"`
+		ReplyTo          *sendGridAddress  `json:"reply_to,omitempty"`
+		Subject          string            `json:"subject"`
+		Content          []content         `json:"content"`
+		Attachments      []attachment      `json:"attachments,omitempty"`
+		Headers          map[string]string `json:"headers,omitempty"`
+	}
+
+	h := m.Header
+	from := sendGridAddresses(h, FromFieldName)
+	if len(from) == 0 {
+		return nil, errors.New("mail: message has no From address")
+	}
+	p.From = &from[0]
+	if r := sendGridAddresses(h, ReplyToFieldName); len(r) > 0 {
+		p.ReplyTo = &r[0]
+	}
+	p.Personalizations = []personalization{{
+		To:  sendGridAddresses(h, ToFieldName),
+		Cc:  sendGridAddresses(h, CcFieldName),
+		Bcc: sendGridAddresses(h, BccFieldName),
+	}}
+	p.Subject = h.Subject()
+	// SendGrid requires text/plain to come first
+	if c.text != "" || c.html == "" {
+		p.Content = append(p.Content, content{"text/plain", c.text})
+	}
+	if c.html != "" {
+		p.Content = append(p.Content, content{"text/html", c.html})
+	}
+	for _, a := range c.attachments {
+		d := "attachment"
+		if a.Inline {
+			d = "inline"
+		}
+		p.Attachments = append(p.Attachments, attachment{
+			Content:     base64.StdEncoding.EncodeToString([]byte(a.Data)),
+			Type:        a.ContentType,
+			Filename:    a.Filename,
+			Disposition: d,
+			ContentID:   a.ContentID,
+		})
+	}
+	if len(c.headers) > 0 {
+		p.Headers = map[string]string{}
+		for _, f := range c.headers {
+			p.Headers[f[0]] = f[1]
+		}
+	}
+	return json.Marshal(&p)
+}
+
+// Returns the multipart/form-data body of a Mailgun messages API request
+// which sends this message, and the Content-Type to send it with.
+//
+// Inline attachments are sent with their Content-ID as file name, since
+// that is what Mailgun uses for the Content-ID. Other fields are passed on
+// as "h:" parameters.
+func (m *Message) MailgunPayload() (string, []byte, error) {
+	c, err := m.providerContent()
+	if err != nil {
+		return "", nil, err
+	}
+	h := m.Header
+	var buf bytes.Buffer
+	w := formdata.NewWriter(&buf)
+	for _, name := range []string{FromFieldName, ToFieldName, CcFieldName, BccFieldName} {
+		for _, a := range h.Addresses(name) {
+			if a.Domain != "" {
+				w.WriteField(strings.ToLower(name), a.String())
+			}
+		}
+	}
+	if r := h.Addresses(ReplyToFieldName); len(r) > 0 {
+		w.WriteField("h:Reply-To", r[0].String())
+	}
+	w.WriteField("subject", h.Subject())
+	if c.text != "" {
+		w.WriteField("text", c.text)
+	}
+	if c.html != "" {
+		w.WriteField("html", c.html)
+	}
+	for _, f := range c.headers {
+		w.WriteField("h:"+f[0], f[1])
+	}
+	for _, a := range c.attachments {
+		field, name := "attachment", a.Filename
+		if a.Inline && a.ContentID != "" {
+			field, name = "inline", a.ContentID
+		}
+		ph := textproto.MIMEHeader{}
+		ph.Set("Content-Disposition", "form-data; name="+quote(field, '"', '\\')+
+			"; filename="+quote(name, '"', '\\'))
+		ph.Set("Content-Type", a.ContentType)
+		pw, err := w.CreatePart(ph)
+		if err != nil {
+			return "", nil, err
+		}
+		pw.Write([]byte(a.Data))
+	}
+	if err := w.Close(); err != nil {
+		return "", nil, err
+	}
+	return w.FormDataContentType(), buf.Bytes(), nil
+}
+
+// Returns the JSON body of an Amazon SES v2 SendEmail API request which
+// sends this message.
+//
+// SES accepts the whole message, so it is sent as it is, except that the Bcc
+// field is removed and its addresses are only given as recipients.
+func (m *Message) SESPayload() ([]byte, error) {
+	if m.Part == nil || m.Header == nil {
+		return nil, errors.New("mail: message has no content")
+	}
+	h := &Header{mode: m.Header.mode}
+	for _, f := range m.Header.Fields {
+		if f.Name() != BccFieldName {
+			h.Fields = append(h.Fields, f)
+		}
+	}
+
+	addresses := func(name string) []string {
+		r := []string{}
+		for _, a := range m.Header.Addresses(name) {
+			if a.Domain != "" {
+				r = append(r, a.String())
+			}
+		}
+		return r
+	}
+	var p struct {
+		FromEmailAddress string
+		Destination      struct {
+			ToAddresses  []string `json:",omitempty"`
+			CcAddresses  []string `json:",omitempty"`
+			BccAddresses []string `json:",omitempty"`
+		}
+		Content struct {
+			Raw struct {
+				Data []byte
+			}
+		}
+	}
+	from := addresses(FromFieldName)
+	if len(from) == 0 {
+		return nil, errors.New("mail: message has no From address")
+	}
+	p.FromEmailAddress = from[0]
+	p.Destination.ToAddresses = addresses(ToFieldName)
+	p.Destination.CcAddresses = addresses(CcFieldName)
+	p.Destination.BccAddresses = addresses(BccFieldName)
+	p.Content.Raw.Data = []byte(m.withHeader(h).RFC822(false))
+	return json.Marshal(&p)
+}
@@ -0,0 +1,95 @@
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestProviderPayloads(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "Alice <alice@example.com>")
+	c.Header.Add("To", "Bob <bob@example.com>")
+	c.Header.Add("Bcc", "carol@example.com")
+	c.Header.Add("Subject", "Payloads")
+	c.Header.Add("X-Campaign", "spring")
+	c.Text = "Hello\n"
+	c.HTML = "<p>Hello</p>\n"
+	c.Attach("a.txt", "text/plain", "attached\r\n")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := m.SendGridPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var sg struct {
+		Personalizations []struct {
+			To  []struct{ Email, Name string }
+			Bcc []struct{ Email string }
+		}
+		From        struct{ Email, Name string }
+		Subject     string
+		Content     []struct{ Type, Value string }
+		Attachments []struct {
+			Content, Type, Filename, Disposition string
+		}
+		Headers map[string]string
+	}
+	if err := json.Unmarshal(b, &sg); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "sendgrid from", sg.From.Email+" "+sg.From.Name, "alice@example.com Alice")
+	testStringEquals(t, "sendgrid to", sg.Personalizations[0].To[0].Email, "bob@example.com")
+	testStringEquals(t, "sendgrid bcc", sg.Personalizations[0].Bcc[0].Email, "carol@example.com")
+	testIntegerEquals(t, "sendgrid content", len(sg.Content), 2)
+	testStringEquals(t, "sendgrid first content", sg.Content[0].Type, "text/plain")
+	testStringEquals(t, "sendgrid attachment", sg.Attachments[0].Content,
+		base64.StdEncoding.EncodeToString([]byte("attached\r\n")))
+	testStringEquals(t, "sendgrid header", sg.Headers["X-Campaign"], "spring")
+	if sg.Headers["Message-ID"] == "" {
+		t.Error("sendgrid payload lacks the Message-ID")
+	}
+
+	ct, body, err := m.MailgunPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest("POST", "/messages", bytes.NewReader(body))
+	r.Header.Set("Content-Type", ct)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "mailgun to", r.FormValue("to"), "Bob <bob@example.com>")
+	testStringEquals(t, "mailgun html", r.FormValue("html"), "<p>Hello</p>\r\n")
+	testStringEquals(t, "mailgun header", r.FormValue("h:X-Campaign"), "spring")
+	testIntegerEquals(t, "mailgun attachments", len(r.MultipartForm.File["attachment"]), 1)
+
+	b, err = m.SESPayload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ses struct {
+		Destination struct{ BccAddresses []string }
+		Content     struct{ Raw struct{ Data []byte } }
+	}
+	if err := json.Unmarshal(b, &ses); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "ses bcc", strings.Join(ses.Destination.BccAddresses, ","), "carol@example.com")
+	raw, err := mail.ReadMessage(string(ses.Content.Raw.Data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(raw.Header.Addresses("Bcc")) != 0 {
+		t.Error("ses raw message still has Bcc")
+	}
+	testStringEquals(t, "ses subject", raw.Header.Subject(), "Payloads")
+}
@@ -0,0 +1,328 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// A DialFunc connects to \a address on \a network, as net.Dial() does. It
+// may be used as SMTPTransport.Dial or Verifier.Dial.
+type DialFunc func(network, address string) (net.Conn, error)
+
+// Returns a DialFunc which connects through the SOCKS5 proxy (RFC 1928) at
+// \a proxy, e.g. "127.0.0.1:1080", authenticating with \a username and \a
+// password (RFC 1929) if \a username is not empty. The proxy is reached with
+// \a dial, or net.Dial() if \a dial is nil, and resolves the host name
+// itself, so that DNS lookups happen where the connection is made.
+func SOCKS5Dialer(proxy, username, password string, dial DialFunc) DialFunc {
+	if dial == nil {
+		dial = net.Dial
+	}
+	return func(network, address string) (net.Conn, error) {
+		host, port, err := splitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dial(network, proxy)
+		if err != nil {
+			return nil, err
+		}
+		if err := socks5Connect(conn, host, port, username, password); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("mail: SOCKS5 proxy %s: %w", proxy, err)
+		}
+		return conn, nil
+	}
+}
+
+// Asks the SOCKS5 proxy at the other end of \a conn to connect to \a host
+// and \a port.
+func socks5Connect(conn net.Conn, host string, port int, username, password string) error {
+	method := byte(0)
+	if username != "" {
+		method = 2
+	}
+	if _, err := conn.Write([]byte{5, 1, method}); err != nil {
+		return err
+	}
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return err
+	}
+	if reply[0] != 5 || reply[1] != method {
+		return errors.New("no acceptable authentication method")
+	}
+	if method == 2 {
+		if len(username) > 255 || len(password) > 255 {
+			return errors.New("user name or password too long")
+		}
+		req := append([]byte{1, byte(len(username))}, username...)
+		req = append(append(req, byte(len(password))), password...)
+		if _, err := conn.Write(req); err != nil {
+			return err
+		}
+		if _, err := io.ReadFull(conn, reply); err != nil {
+			return err
+		}
+		if reply[1] != 0 {
+			return errors.New("authentication failed")
+		}
+	}
+
+	req := []byte{5, 1, 0}
+	if ip := net.ParseIP(host); ip == nil {
+		if len(host) > 255 {
+			return errors.New("host name too long")
+		}
+		req = append(append(req, 3, byte(len(host))), host...)
+	} else if ip4 := ip.To4(); ip4 != nil {
+		req = append(append(req, 1), ip4...)
+	} else {
+		req = append(append(req, 4), ip...)
+	}
+	req = append(req, byte(port>>8), byte(port))
+	if _, err := conn.Write(req); err != nil {
+		return err
+	}
+	head := make([]byte, 4)
+	if _, err := io.ReadFull(conn, head); err != nil {
+		return err
+	}
+	if head[1] != 0 {
+		return fmt.Errorf("connection refused with code %d", head[1])
+	}
+	// skip the address the proxy bound, which is of no interest
+	n := 0
+	switch head[3] {
+	case 1:
+		n = 4
+	case 4:
+		n = 16
+	case 3:
+		if _, err := io.ReadFull(conn, head[:1]); err != nil {
+			return err
+		}
+		n = int(head[0])
+	default:
+		return fmt.Errorf("unknown address type %d", head[3])
+	}
+	_, err := io.ReadFull(conn, make([]byte, n+2))
+	return err
+}
+
+// Returns a DialFunc which connects through the HTTP proxy at \a proxy,
+// e.g. "proxy.example.com:3128", using the CONNECT method, and
+// authenticating with \a username and \a password (Basic authentication)
+// if \a username is not empty. The proxy is reached with \a dial, or
+// net.Dial() if \a dial is nil.
+func HTTPConnectDialer(proxy, username, password string, dial DialFunc) DialFunc {
+	if dial == nil {
+		dial = net.Dial
+	}
+	return func(network, address string) (net.Conn, error) {
+		conn, err := dial(network, proxy)
+		if err != nil {
+			return nil, err
+		}
+		req := "CONNECT " + address + " HTTP/1.1\r\nHost: " + address + "\r\n"
+		if username != "" {
+			req += "Proxy-Authorization: Basic " +
+				base64.StdEncoding.EncodeToString([]byte(username+":"+password)) + "\r\n"
+		}
+		if _, err := io.WriteString(conn, req+"\r\n"); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		// read the response a byte at a time, so that nothing the server
+		// says after it is lost in a buffer
+		r := bufio.NewReaderSize(&byteReader{conn}, 16)
+		resp, err := http.ReadResponse(r, nil)
+		if err == nil && resp.StatusCode != http.StatusOK {
+			err = errors.New(resp.Status)
+		}
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("mail: HTTP proxy %s: %w", proxy, err)
+		}
+		return conn, nil
+	}
+}
+
+// A byteReader reads at most one byte at a time from R.
+type byteReader struct {
+	R io.Reader
+}
+
+func (r *byteReader) Read(b []byte) (int, error) {
+	if len(b) > 1 {
+		b = b[:1]
+	}
+	return r.R.Read(b)
+}
+
+// Returns the host and port in \a address, e.g. "mx.example.com:25".
+func splitHostPort(address string) (string, int, error) {
+	host, p, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", 0, err
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil || port < 0 || port > 65535 {
+		return "", 0, fmt.Errorf("mail: invalid port in %s", address)
+	}
+	return host, port, nil
+}
+
+// A ProxyHeader is the header of the PROXY protocol, which a proxy or load
+// balancer sends at the start of a connection to tell the server behind it
+// whom the connection is really from. Source is the client's address and
+// Destination the address it connected to; if either is nil, the header
+// says nothing about the connection, as a proxy's own health checks do.
+// Version is 1 for the text form of the header, and 2 for the binary form.
+type ProxyHeader struct {
+	Version     int
+	Source      *net.TCPAddr
+	Destination *net.TCPAddr
+}
+
+// The signature with which version 2 of the PROXY protocol begins.
+const proxySignature = "\r\n\r\n\x00\r\nQUIT\n"
+
+// Returns the PROXY protocol header as it is sent, in version 2 if Version
+// is 2, and otherwise in version 1.
+func (h *ProxyHeader) Bytes() []byte {
+	known := h.Source != nil && h.Destination != nil
+	src, dst := net.IP(nil), net.IP(nil)
+	if known {
+		src, dst = h.Source.IP.To4(), h.Destination.IP.To4()
+		if src == nil || dst == nil {
+			src, dst = h.Source.IP.To16(), h.Destination.IP.To16()
+		}
+	}
+
+	if h.Version != 2 {
+		if !known {
+			return []byte("PROXY UNKNOWN\r\n")
+		}
+		family := "TCP4"
+		if len(src) == net.IPv6len {
+			family = "TCP6"
+		}
+		return []byte(fmt.Sprintf("PROXY %s %s %s %d %d\r\n",
+			family, src, dst, h.Source.Port, h.Destination.Port))
+	}
+
+	var b bytes.Buffer
+	b.WriteString(proxySignature)
+	if !known {
+		b.Write([]byte{0x20, 0, 0, 0})
+		return b.Bytes()
+	}
+	family := byte(0x11)
+	if len(src) == net.IPv6len {
+		family = 0x21
+	}
+	b.Write([]byte{0x21, family})
+	binary.Write(&b, binary.BigEndian, uint16(2*len(src)+4))
+	b.Write(src)
+	b.Write(dst)
+	binary.Write(&b, binary.BigEndian, uint16(h.Source.Port))
+	binary.Write(&b, binary.BigEndian, uint16(h.Destination.Port))
+	return b.Bytes()
+}
+
+// Reads a PROXY protocol header of either version from \a r and returns
+// it. Returns nil and no error, without reading anything, if \a r does not
+// begin with a header, so that a server may accept connections with and
+// without one; a server behind a proxy should reject those without.
+//
+// Extensions (TLVs) in a version 2 header are skipped, and so are addresses
+// of families other than TCP over IPv4 and IPv6.
+func ReadProxyHeader(r *bufio.Reader) (*ProxyHeader, error) {
+	if b, _ := r.Peek(len(proxySignature)); string(b) == proxySignature {
+		return readProxyHeaderV2(r)
+	}
+	if b, _ := r.Peek(6); string(b) != "PROXY " {
+		return nil, nil
+	}
+
+	line := ""
+	for !strings.HasSuffix(line, "\r\n") {
+		if len(line) >= 107 {
+			return nil, errors.New("mail: PROXY header too long")
+		}
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		line += string(c)
+	}
+	h := &ProxyHeader{Version: 1}
+	f := strings.Fields(line)
+	if len(f) >= 2 && f[1] == "UNKNOWN" {
+		return h, nil
+	}
+	if len(f) != 6 || f[1] != "TCP4" && f[1] != "TCP6" {
+		return nil, fmt.Errorf("mail: invalid PROXY header %q", strings.TrimSpace(line))
+	}
+	src, dst := net.ParseIP(f[2]), net.ParseIP(f[3])
+	sport, serr := strconv.ParseUint(f[4], 10, 16)
+	dport, derr := strconv.ParseUint(f[5], 10, 16)
+	if src == nil || dst == nil || serr != nil || derr != nil {
+		return nil, fmt.Errorf("mail: invalid PROXY header %q", strings.TrimSpace(line))
+	}
+	h.Source = &net.TCPAddr{IP: src, Port: int(sport)}
+	h.Destination = &net.TCPAddr{IP: dst, Port: int(dport)}
+	return h, nil
+}
+
+// Reads a version 2 PROXY protocol header from \a r, which begins with its
+// signature.
+func readProxyHeaderV2(r *bufio.Reader) (*ProxyHeader, error) {
+	head := make([]byte, len(proxySignature)+4)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, err
+	}
+	body := make([]byte, binary.BigEndian.Uint16(head[len(head)-2:]))
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	command, family := head[len(proxySignature)], head[len(proxySignature)+1]
+	if command>>4 != 2 {
+		return nil, fmt.Errorf("mail: unknown PROXY protocol version %d", command>>4)
+	}
+	h := &ProxyHeader{Version: 2}
+	if command&0xf == 0 {
+		// LOCAL, e.g. a health check
+		return h, nil
+	}
+	n := 0
+	switch family {
+	case 0x11:
+		n = net.IPv4len
+	case 0x21:
+		n = net.IPv6len
+	default:
+		return h, nil
+	}
+	if len(body) < 2*n+4 {
+		return nil, errors.New("mail: PROXY header too short")
+	}
+	h.Source = &net.TCPAddr{IP: net.IP(body[:n]),
+		Port: int(binary.BigEndian.Uint16(body[2*n:]))}
+	h.Destination = &net.TCPAddr{IP: net.IP(body[n : 2*n]),
+		Port: int(binary.BigEndian.Uint16(body[2*n+2:]))}
+	return h, nil
+}
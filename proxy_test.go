@@ -0,0 +1,133 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestProxies(t *testing.T) {
+	for _, h := range []*mail.ProxyHeader{
+		{Version: 1, Source: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 25}},
+		{Version: 2, Source: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 25}},
+		{Version: 1, Source: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 587}},
+		{Version: 2, Source: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 56324},
+			Destination: &net.TCPAddr{IP: net.ParseIP("2001:db8::2"), Port: 587}},
+		{Version: 1},
+		{Version: 2},
+	} {
+		r := bufio.NewReader(io.MultiReader(bytes.NewReader(h.Bytes()), strings.NewReader("EHLO x\r\n")))
+		got, err := mail.ReadProxyHeader(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testIntegerEquals(t, "version", got.Version, h.Version)
+		testStringEquals(t, "addresses", fmt.Sprint(got.Source, got.Destination),
+			fmt.Sprint(h.Source, h.Destination))
+		rest, _ := r.ReadString('\n')
+		testStringEquals(t, "rest", rest, "EHLO x\r\n")
+	}
+	v1 := &mail.ProxyHeader{Source: &net.TCPAddr{IP: net.ParseIP("192.0.2.1"), Port: 56324},
+		Destination: &net.TCPAddr{IP: net.ParseIP("198.51.100.2"), Port: 25}}
+	testStringEquals(t, "v1", string(v1.Bytes()), "PROXY TCP4 192.0.2.1 198.51.100.2 56324 25\r\n")
+	if h, err := mail.ReadProxyHeader(bufio.NewReader(strings.NewReader("EHLO x\r\n"))); h != nil || err != nil {
+		t.Errorf("ReadProxyHeader without a header = %v, %v", h, err)
+	}
+	if _, err := mail.ReadProxyHeader(bufio.NewReader(strings.NewReader("PROXY TCP4 x y 1 2\r\n"))); err == nil {
+		t.Error("expected an error for an invalid header")
+	}
+
+	// each proxy hands the connection to a fake server, which expects a
+	// PROXY header
+	got := make(chan []string, 1)
+	headers := make(chan *mail.ProxyHeader, 1)
+	relay := func(conn net.Conn, r *bufio.Reader) {
+		defer conn.Close()
+		h, _ := mail.ReadProxyHeader(r)
+		headers <- h
+		a, b := net.Pipe()
+		go fakeDataSink(b, got)
+		go io.Copy(a, r)
+		io.Copy(conn, a)
+	}
+	proxy := func(handshake func(net.Conn, *bufio.Reader) string) (string, <-chan string) {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		requests := make(chan string, 1)
+		go func() {
+			defer l.Close()
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			r := bufio.NewReader(conn)
+			requests <- handshake(conn, r)
+			relay(conn, r)
+		}()
+		return l.Addr().String(), requests
+	}
+
+	socks, socksRequests := proxy(func(conn net.Conn, r *bufio.Reader) string {
+		read := func(n int) []byte {
+			b := make([]byte, n)
+			io.ReadFull(r, b)
+			return b
+		}
+		methods := read(2)
+		read(int(methods[1]))
+		conn.Write([]byte{5, 2})
+		auth := read(2)
+		user := string(read(int(auth[1])))
+		password := string(read(int(read(1)[0])))
+		conn.Write([]byte{1, 0})
+		req := read(5)
+		host := string(read(int(req[4])))
+		port := read(2)
+		conn.Write([]byte{5, 0, 0, 1, 0, 0, 0, 0, 0, 0})
+		return fmt.Sprintf("%s:%s %s:%d", user, password, host, int(port[0])<<8|int(port[1]))
+	})
+	httpProxy, httpRequests := proxy(func(conn net.Conn, r *bufio.Reader) string {
+		req, err := http.ReadRequest(r)
+		if err != nil {
+			return err.Error()
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+		return req.Method + " " + req.Host + " " + req.Header.Get("Proxy-Authorization")
+	})
+
+	env := mail.Envelope{From: "alice@example.com", To: []string{"bob@example.com"}}
+	for _, c := range []struct {
+		dial     mail.DialFunc
+		requests <-chan string
+		request  string
+	}{
+		{mail.SOCKS5Dialer(socks, "alice", "secret", nil), socksRequests,
+			"alice:secret mx.example:25"},
+		{mail.HTTPConnectDialer(httpProxy, "alice", "secret", nil), httpRequests,
+			"CONNECT mx.example:25 Basic YWxpY2U6c2VjcmV0"},
+	} {
+		tr := &mail.SMTPTransport{Addr: "mx.example:25", Dial: c.dial, ProxyHeader: v1}
+		if err := tr.Send(env, "Subject: hi\r\n\r\nHello\r\n"); err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, "request", <-c.requests, c.request)
+		testStringEquals(t, "header", fmt.Sprint((<-headers).Source), "192.0.2.1:56324")
+		testStringEquals(t, "message", strings.Join(<-got, "\n"),
+			"MAIL FROM:<alice@example.com> BODY=8BITMIME\nRCPT TO:<bob@example.com>\nSubject: hi\r\n\r\nHello\r\n")
+	}
+}
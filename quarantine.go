@@ -0,0 +1,353 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A Quarantine keeps messages which were rejected or held as suspicious, so
+// that an administrator can look at them and release those which should
+// have been delivered.
+//
+// Each message is kept in Dir exactly as it was received, in a file named
+// after its ID with the suffix ".eml", next to a ".json" file holding its
+// QuarantineEntry.
+//
+// If Compression is not nil, messages are added compressed, with the
+// additional suffix ".gz", ".z" or ".zst". Messages are read whether
+// compressed or not, so Compression may be set for an existing quarantine;
+// it must keep the same Dictionary as long as messages compressed with it
+// remain.
+type Quarantine struct {
+	Dir         string
+	Compression *Compression
+}
+
+// A QuarantineEntry describes a quarantined message: why it was held, the
+// envelope with which it arrived, and the verdicts on it, summarized as
+// lower-case names such as "spam", "spf", "dkim" and "arc" mapped to their
+// results. From and Subject are copied from the message's header for
+// listing, and Size is its size in bytes. Released is the time the message
+// was released, or nil.
+type QuarantineEntry struct {
+	ID          string            `json:"id"`
+	Reason      string            `json:"reason"`
+	Quarantined time.Time         `json:"quarantined"`
+	Envelope    Envelope          `json:"envelope"`
+	Verdicts    map[string]string `json:"verdicts,omitempty"`
+	From        string            `json:"from,omitempty"`
+	Subject     string            `json:"subject,omitempty"`
+	Size        int               `json:"size"`
+	Released    *time.Time        `json:"released,omitempty"`
+}
+
+// A QuarantineQuery selects entries for Quarantine.Search(). Text, if not
+// empty, must occur in the entry's From, Subject, Reason, envelope sender or
+// one of its envelope recipients, compared case-insensitively. Since and
+// Before, if not zero, limit the time the message was quarantined. Released
+// entries are included only if IncludeReleased is true.
+type QuarantineQuery struct {
+	Text            string
+	Since           time.Time
+	Before          time.Time
+	IncludeReleased bool
+}
+
+// Returns a Quarantine keeping messages in \a dir, which is created if
+// necessary.
+func NewQuarantine(dir string) (*Quarantine, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Quarantine{Dir: dir}, nil
+}
+
+// Quarantines \a rfc5322, which arrived with the envelope \a env, for
+// \a reason, e.g. the Rejection of a Decision. \a v, if not nil, is the
+// Verdict on the message, which is summarized in the entry. The message
+// need not be parseable.
+func (q *Quarantine) Add(rfc5322 string, env Envelope, reason string, v *Verdict) (*QuarantineEntry, error) {
+	now := time.Now()
+	if env.Received.IsZero() {
+		env.Received = now
+	}
+	e := &QuarantineEntry{
+		ID:          strconv.FormatInt(now.UnixNano(), 36) + "-" + randomHex(4),
+		Reason:      reason,
+		Quarantined: now,
+		Envelope:    env,
+		Verdicts:    v.summary(),
+		Size:        len(rfc5322),
+	}
+	e.describe(rfc5322)
+	// the message is written first, so that an entry is never listed
+	// without it
+	if err := writeCompressed(q.path(e.ID, ".eml"), []byte(rfc5322), q.Compression); err != nil {
+		return nil, err
+	}
+	if err := q.save(e); err != nil {
+		removeCompressed(q.path(e.ID, ".eml"))
+		return nil, err
+	}
+	return e, nil
+}
+
+// Sets the From and Subject of \a e from the header of \a rfc5322, if it
+// can be read. Only the header is parsed, and a message which cannot be
+// parsed, or whose parsing panics, is quarantined all the same.
+func (e *QuarantineEntry) describe(rfc5322 string) {
+	defer func() {
+		recover()
+	}()
+	if h, err := ReadHeader(rfc5322, RFC5322Header); err == nil {
+		e.From = h.Get(FromFieldName)
+		e.Subject = h.Subject()
+	}
+}
+
+// Returns the entry for the message \a id, or ErrNotQuarantined.
+func (q *Quarantine) Get(id string) (*QuarantineEntry, error) {
+	if !validQuarantineID(id) {
+		return nil, ErrNotQuarantined
+	}
+	b, err := ioutil.ReadFile(q.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotQuarantined
+	}
+	if err != nil {
+		return nil, err
+	}
+	e := &QuarantineEntry{}
+	if err := json.Unmarshal(b, e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Returns the message \a id exactly as it was received, or
+// ErrNotQuarantined.
+func (q *Quarantine) Message(id string) (string, error) {
+	r, err := q.Open(id)
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+// Returns a reader of the message  id exactly as it was received,
+// decompressing it as it is read, or ErrNotQuarantined. The caller must
+// close it.
+func (q *Quarantine) Open(id string) (io.ReadCloser, error) {
+	if !validQuarantineID(id) {
+		return nil, ErrNotQuarantined
+	}
+	r, err := openCompressed(q.path(id, ".eml"), q.Compression)
+	if os.IsNotExist(err) {
+		return nil, ErrNotQuarantined
+	}
+	return r, err
+}
+
+// Returns all entries, including released ones, oldest first.
+func (q *Quarantine) List() ([]*QuarantineEntry, error) {
+	names, err := filepath.Glob(filepath.Join(q.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	r := []*QuarantineEntry{}
+	for _, n := range names {
+		e, err := q.Get(strings.TrimSuffix(filepath.Base(n), ".json"))
+		if err == ErrNotQuarantined {
+			// removed meanwhile
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, e)
+	}
+	sort.SliceStable(r, func(i, j int) bool {
+		return r[i].Quarantined.Before(r[j].Quarantined)
+	})
+	return r, nil
+}
+
+// Returns the entries matching \a query, oldest first.
+func (q *Quarantine) Search(query QuarantineQuery) ([]*QuarantineEntry, error) {
+	all, err := q.List()
+	if err != nil {
+		return nil, err
+	}
+	text := strings.ToLower(query.Text)
+	r := []*QuarantineEntry{}
+	for _, e := range all {
+		if e.Released != nil && !query.IncludeReleased ||
+			!query.Since.IsZero() && e.Quarantined.Before(query.Since) ||
+			!query.Before.IsZero() && !e.Quarantined.Before(query.Before) {
+			continue
+		}
+		if text != "" {
+			s := append([]string{e.From, e.Subject, e.Reason, e.Envelope.From},
+				e.Envelope.To...)
+			if !strings.Contains(strings.ToLower(strings.Join(s, "\n")), text) {
+				continue
+			}
+		}
+		r = append(r, e)
+	}
+	return r, nil
+}
+
+// Releases the message \a id by calling \a deliver with its entry and its
+// original text, and records the release if \a deliver succeeds. A message
+// may be released more than once.
+func (q *Quarantine) Release(id string, deliver func(e *QuarantineEntry, rfc5322 string) error) error {
+	e, err := q.Get(id)
+	if err != nil {
+		return err
+	}
+	rfc5322, err := q.Message(id)
+	if err != nil {
+		return err
+	}
+	if err := deliver(e, rfc5322); err != nil {
+		return err
+	}
+	now := time.Now()
+	e.Released = &now
+	return q.save(e)
+}
+
+// Releases the message \a id by sending it as it was received, with only
+// its line endings converted to CRLF, to its envelope recipients using the
+// client \a c, which must have greeted the server already. BDAT is used if
+// the server supports it. Returns an error without sending anything if the
+// message contains 8-bit data and the server does not support 8BITMIME.
+func (q *Quarantine) ReleaseSMTP(id string, c *smtp.Client) error {
+	return q.Release(id, func(e *QuarantineEntry, rfc5322 string) error {
+		if eight, _ := c.Extension("8BITMIME"); !eight && !isAscii(rfc5322) {
+			return errors.New("mail: server does not support 8BITMIME")
+		}
+		chunking, _ := c.Extension("CHUNKING")
+		return sendRaw(c, e.Envelope.From, e.Envelope.To,
+			NormalizeLineEndings(rfc5322, "\r\n"), chunking, 0)
+	})
+}
+
+// Releases the message \a id by appending it to \a folder in \a target,
+// e.g. a Store. Since a MigrationTarget takes a parsed Message, the text it
+// stores may differ from the original; use Release() with a function which
+// stores the text itself to keep it byte for byte.
+func (q *Quarantine) ReleaseTo(id string, target MigrationTarget, folder string) error {
+	return q.Release(id, func(e *QuarantineEntry, rfc5322 string) error {
+		m, err := ReadMessage(rfc5322)
+		if err != nil {
+			return err
+		}
+		return target.Append(folder, m, nil)
+	})
+}
+
+// Removes the message \a id from the quarantine.
+func (q *Quarantine) Delete(id string) error {
+	if !validQuarantineID(id) {
+		return ErrNotQuarantined
+	}
+	err := os.Remove(q.path(id, ".json"))
+	if os.IsNotExist(err) {
+		return ErrNotQuarantined
+	}
+	if err != nil {
+		return err
+	}
+	if err := removeCompressed(q.path(id, ".eml")); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Writes the entry \a e.
+func (q *Quarantine) save(e *QuarantineEntry) error {
+	b, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomically(q.path(e.ID, ".json"), b)
+}
+
+// Returns the name of the file holding \a id with the suffix \a suffix.
+func (q *Quarantine) path(id, suffix string) string {
+	return filepath.Join(q.Dir, id+suffix)
+}
+
+// Returns true if \a id could have been made by Quarantine.Add(), so that
+// it cannot name a file outside the quarantine.
+func validQuarantineID(id string) bool {
+	if id == "" {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// Writes \a b to the file at \a path, replacing it atomically, so that a
+// crash cannot leave it truncated.
+func writeFileAtomically(path string, b []byte) error {
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// Returns the results recorded in this Verdict, keyed as for
+// QuarantineEntry.Verdicts, or nil if there are none.
+func (v *Verdict) summary() map[string]string {
+	if v == nil {
+		return nil
+	}
+	r := map[string]string{}
+	if v.HasScore {
+		r["spam"] = strconv.FormatFloat(v.Score, 'f', -1, 64)
+	}
+	if v.SPF != nil {
+		r["spf"] = strings.ToLower(v.SPF.Result)
+	}
+	if len(v.DKIM) > 0 {
+		r["dkim"] = v.DKIM[0].Result
+		for _, d := range v.DKIM {
+			if d.Result == "pass" {
+				r["dkim"] = "pass"
+			}
+		}
+	}
+	if v.ARC != nil {
+		r["arc"] = v.ARC.Result
+	}
+	if v.Homograph != nil {
+		r["homograph"] = "suspicious"
+	}
+	if len(r) == 0 {
+		return nil
+	}
+	return r
+}
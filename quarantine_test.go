@@ -0,0 +1,153 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bufio"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// Accepts one message on \a conn by DATA, and sends its envelope and text
+// to \a got.
+func fakeDataSink(conn net.Conn, got chan<- []string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("220 sink.example ESMTP\r\n"))
+	envelope := []string{}
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		l = strings.TrimSpace(l)
+		switch {
+		case strings.HasPrefix(l, "EHLO"):
+			conn.Write([]byte("250-sink.example\r\n250 8BITMIME\r\n"))
+		case strings.HasPrefix(l, "MAIL"), strings.HasPrefix(l, "RCPT"):
+			envelope = append(envelope, l)
+			conn.Write([]byte("250 ok\r\n"))
+		case l == "DATA":
+			conn.Write([]byte("354 go ahead\r\n"))
+			b, _ := ioutil.ReadAll(mail.NewDotUnstuffReader(r))
+			got <- append(envelope, string(b))
+			conn.Write([]byte("250 queued\r\n"))
+		case l == "QUIT":
+			conn.Write([]byte("221 bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("502 unimplemented\r\n"))
+		}
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	q, err := mail.NewQuarantine(filepath.Join(dir, "quarantine"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// odd formatting which parsing and rendering would change
+	spam := "From:   mallory@spam.example\r\nSubject: Cheap   pills\r\n" +
+		"X-Spam-Status: Yes, score=12.0 required=5.0\r\n\r\n.Buy now\r\n"
+	m, _ := mail.ReadMessage(spam)
+	env := mail.Envelope{From: "mallory@spam.example", To: []string{"alice@example.com"}}
+	e, err := q.Add(spam, env, "550 5.7.1 Message rejected as spam", mail.NewVerdict(m))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "spam verdict", e.Verdicts["spam"], "12")
+	testStringEquals(t, "subject", e.Subject, "Cheap   pills")
+	phish := "From: paypal@examp1e.com\r\nSubject: Verify\r\n\r\nClick\r\n"
+	env.From = "paypal@examp1e.com"
+	if _, err := q.Add(phish, env, "suspicious sender", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := q.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testIntegerEquals(t, "listed", len(all), 2)
+	testStringEquals(t, "first", all[0].ID, e.ID)
+	found, _ := q.Search(mail.QuarantineQuery{Text: "PILLS"})
+	testIntegerEquals(t, "found", len(found), 1)
+	found, _ = q.Search(mail.QuarantineQuery{Text: "alice@"})
+	testIntegerEquals(t, "found by recipient", len(found), 2)
+	if _, err := q.Get("../etc/passwd"); err != mail.ErrNotQuarantined {
+		t.Errorf("bad ID: %v", err)
+	}
+
+	client, server := net.Pipe()
+	got := make(chan []string, 1)
+	go fakeDataSink(server, got)
+	c, err := smtp.NewClient(client, "sink.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Hello("quarantine.example"); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.ReleaseSMTP(e.ID, c); err != nil {
+		t.Fatal(err)
+	}
+	sent := <-got
+	c.Quit()
+	testStringEquals(t, "envelope", strings.Join(sent[:2], " "),
+		"MAIL FROM:<mallory@spam.example> BODY=8BITMIME RCPT TO:<alice@example.com>")
+	testStringEquals(t, "released text", sent[2], spam)
+
+	found, _ = q.Search(mail.QuarantineQuery{Text: "pills"})
+	testIntegerEquals(t, "released hidden", len(found), 0)
+	found, _ = q.Search(mail.QuarantineQuery{Text: "pills", IncludeReleased: true})
+	if len(found) != 1 || found[0].Released == nil {
+		t.Error("release not recorded")
+	}
+	if err := q.Delete(e.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Message(e.ID); err != mail.ErrNotQuarantined {
+		t.Errorf("deleted message: %v", err)
+	}
+}
+
+func TestQuarantineTruncated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "quarantine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	q, err := mail.NewQuarantine(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := mail.Envelope{From: "mallory@spam.example", To: []string{"alice@example.com"}}
+	for _, s := range []string{
+		"From: mallory@spam.example",
+		"From: mallory@spam.example\r\nSubject: Cut",
+		"From: mallory@spam.example\r\nContent-Type: multipart/mixed; boundary=x\r\n\r\n--x\r\nContent-Type: text/pl",
+	} {
+		e, err := q.Add(s, env, "truncated", nil)
+		if err != nil {
+			t.Fatalf("%q: %v", s, err)
+		}
+		testStringEquals(t, "from", e.From, "mallory@spam.example")
+		stored, err := q.Message(e.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, "stored", stored, s)
+	}
+}
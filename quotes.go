@@ -0,0 +1,101 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A QuoteBlock is a node in the quote structure of a text body. A block
+// either holds a run of Lines at a single quote Depth, or, if it's a quote,
+// the Blocks quoted at Depth, in order. Depth 0 is the author's own text.
+//
+// The structure is meant for display: each quote container can be rendered
+// indented or colored according to its depth.
+type QuoteBlock struct {
+	Depth  int          `json:"depth"`
+	Lines  []string     `json:"lines,omitempty"`
+	Blocks []QuoteBlock `json:"blocks,omitempty"`
+}
+
+// Returns true if this block contains text rather than other blocks.
+func (b *QuoteBlock) IsText() bool {
+	return len(b.Blocks) == 0
+}
+
+// Returns the quote depth of the plain text line \a l and the text after the
+// quote marks. The traditional "> > " style, with a space between quote
+// marks, is accepted as well as ">>".
+func quoteDepth(l string) (int, string) {
+	depth := 0
+	i := 0
+	for i < len(l) && l[i] == '>' {
+		depth++
+		i++
+		if i+1 < len(l) && l[i] == ' ' && l[i+1] == '>' {
+			i++
+		}
+	}
+	if depth > 0 && i < len(l) && l[i] == ' ' {
+		i++
+	}
+	return depth, l[i:]
+}
+
+// Builds the quote structure of \a lines, which have been paired with their
+// quote depths.
+func buildQuoteTree(lines []flowedLine) *QuoteBlock {
+	root := &QuoteBlock{}
+	for _, l := range lines {
+		// descend along the last container of each depth, creating
+		// containers where the depth jumps.
+		b := root
+		for b.Depth < l.depth {
+			n := len(b.Blocks)
+			if n == 0 || b.Blocks[n-1].Depth == b.Depth {
+				b.Blocks = append(b.Blocks, QuoteBlock{Depth: b.Depth + 1})
+				n++
+			}
+			b = &b.Blocks[n-1]
+		}
+		n := len(b.Blocks)
+		if n > 0 && b.Blocks[n-1].Depth == b.Depth {
+			b.Blocks[n-1].Lines = append(b.Blocks[n-1].Lines, l.text)
+		} else {
+			b.Blocks = append(b.Blocks, QuoteBlock{Depth: b.Depth, Lines: []string{l.text}})
+		}
+	}
+	return root
+}
+
+// Returns the quote structure of \a text. If \a flowed is true, \a text is
+// parsed as RFC 3676 format=flowed text (with \a delsp as DelSp), where quote
+// depth is the number of leading '>' characters. Otherwise quote marks are
+// counted as people and programs commonly write them.
+//
+// The returned block has depth 0 and contains the text and quotes of \a text
+// in order.
+func ParseQuotes(text string, flowed, delsp bool) *QuoteBlock {
+	var lines []flowedLine
+	if flowed {
+		lines = parseFlowed(text, delsp)
+	} else {
+		for _, l := range splitLines(text) {
+			d, t := quoteDepth(l)
+			lines = append(lines, flowedLine{depth: d, text: t})
+		}
+	}
+	return buildQuoteTree(lines)
+}
+
+// Returns the quote structure of the text of this bodypart, as described for
+// ParseQuotes(). Returns nil if the bodypart does not contain plain text.
+func (p *Part) Quotes() *QuoteBlock {
+	if !p.hasText || p.Header == nil {
+		return nil
+	}
+	ct := p.Header.ContentType()
+	if ct != nil && (ct.Type != "text" || ct.Subtype != "plain") {
+		return nil
+	}
+	delsp := ct != nil && strings.ToLower(ct.parameter("delsp")) == "yes"
+	return ParseQuotes(p.Text, p.isFlowed(), delsp)
+}
@@ -0,0 +1,216 @@
+package mail
+
+import (
+	"strings"
+)
+
+// A RecipientReport is what a delivery status notification (RFC 3464) or a
+// feedback report (ARF, RFC 5965) says about one recipient of a message sent
+// earlier.
+//
+// For a delivery status notification, Action is "failed", "delayed",
+// "delivered", "relayed" or "expanded", Status the enhanced status code
+// (RFC 3463), e.g. "5.1.1", and Diagnostic the remote server's reply, if
+// given. For a feedback report, FeedbackType is the type of feedback, e.g.
+// "abuse" for a recipient who marked the message as spam.
+type RecipientReport struct {
+	Recipient    string `json:"recipient"`
+	Action       string `json:"action,omitempty"`
+	Status       string `json:"status,omitempty"`
+	Diagnostic   string `json:"diagnostic,omitempty"`
+	FeedbackType string `json:"feedbackType,omitempty"`
+}
+
+// Returns the status this report gives: the remote server's reply quoted in
+// Diagnostic, with the enhanced status code in Status, which is
+// authoritative. If Diagnostic is not an SMTP reply, e.g. "host not found",
+// it is the text.
+func (r *RecipientReport) SMTPStatus() SMTPStatus {
+	s := ParseSMTPStatus(r.Diagnostic)
+	if enhancedStatus.MatchString(r.Status) {
+		s.Enhanced = r.Status
+	}
+	return s
+}
+
+// Returns true if this report says the message could not be delivered and
+// will not be, e.g. because the mailbox does not exist.
+func (r *RecipientReport) HardBounce() bool {
+	return r.Action == "failed" && r.SMTPStatus().Permanent()
+}
+
+// Returns true if this report says the recipient complained about the
+// message, e.g. by marking it as spam.
+func (r *RecipientReport) Complaint() bool {
+	return r.FeedbackType == "abuse"
+}
+
+// Returns what this message says about the recipients of a message sent
+// earlier, if it is a delivery status notification or a feedback report
+// (i.e. a multipart/report containing a message/delivery-status or
+// message/feedback-report part), or an empty slice if it is neither.
+//
+// The recipient of a feedback report is taken from its Original-Rcpt-To
+// fields, or if there are none, from the To field of the original message,
+// if the report includes it. Feedback reports whose recipient is redacted
+// or missing are ignored.
+func (m *Message) RecipientReports() []RecipientReport {
+	r := []RecipientReport{}
+	if m.Part == nil {
+		return r
+	}
+	var parts []*Part
+	m.Part.walk(func(p *Part) {
+		if p.parent == nil || p.parent.contentType() == "multipart/report" {
+			parts = append(parts, p)
+		}
+	})
+	for i, p := range parts {
+		switch p.contentType() {
+		case "message/delivery-status", "message/global-delivery-status":
+			r = append(r, deliveryStatusReports(p.rawContent())...)
+		case "message/feedback-report":
+			var original *Header
+			if i+1 < len(parts) {
+				original = parts[i+1].originalHeader()
+			}
+			r = append(r, feedbackReports(p.rawContent(), original)...)
+		}
+	}
+	return r
+}
+
+// Returns the header of the original message included in a report as this
+// bodypart, or nil if this bodypart is not one.
+func (p *Part) originalHeader() *Header {
+	switch p.contentType() {
+	case "message/rfc822", "message/global":
+		if p.message != nil {
+			return p.message.Header
+		}
+	case "text/rfc822-headers", "message/global-headers":
+		if m, err := ReadMessage(p.rawContent()); err == nil {
+			return m.Header
+		}
+	}
+	return nil
+}
+
+// Returns the per-recipient reports in the message/delivery-status body
+// \a s.
+func deliveryStatusReports(s string) []RecipientReport {
+	var r []RecipientReport
+	// the first block holds the per-message fields
+	for _, block := range reportBlocks(s)[1:] {
+		fields := parseReportFields(block)
+		rcpt := reportValue(fields, "final-recipient")
+		if rcpt == "" {
+			rcpt = reportValue(fields, "original-recipient")
+		}
+		if rcpt == "" {
+			continue
+		}
+		status := ""
+		if v := fields["status"]; len(v) > 0 {
+			status = strings.Fields(v[0] + " ")[0]
+		}
+		r = append(r, RecipientReport{
+			Recipient:  rcpt,
+			Action:     strings.ToLower(strings.TrimSpace(firstReportField(fields, "action"))),
+			Status:     status,
+			Diagnostic: reportValue(fields, "diagnostic-code"),
+		})
+	}
+	return r
+}
+
+// Returns the reports in the message/feedback-report body \a s, one per
+// recipient, using \a original, the header of the reported message (or nil),
+// if the report does not name the recipients.
+func feedbackReports(s string, original *Header) []RecipientReport {
+	fields := parseReportFields(s)
+	feedbackType := strings.ToLower(strings.TrimSpace(firstReportField(fields, "feedback-type")))
+	var recipients []string
+	for _, v := range fields["original-rcpt-to"] {
+		recipients = append(recipients, strings.Trim(strings.TrimSpace(v), "<>"))
+	}
+	if len(recipients) == 0 && original != nil {
+		for _, a := range original.Addresses(ToFieldName) {
+			recipients = append(recipients, a.lpdomain())
+		}
+	}
+	var r []RecipientReport
+	for _, rcpt := range recipients {
+		if strings.IndexByte(rcpt, '@') > 0 {
+			r = append(r, RecipientReport{Recipient: rcpt, FeedbackType: feedbackType})
+		}
+	}
+	return r
+}
+
+// Splits \a s, the body of a message/delivery-status part, into its blocks
+// of fields, which are separated by blank lines. There is always at least
+// one block.
+func reportBlocks(s string) []string {
+	s = strings.Replace(s, "\r\n", "\n", -1)
+	var r []string
+	for _, block := range strings.Split(s, "\n\n") {
+		if strings.TrimSpace(block) != "" {
+			r = append(r, block)
+		}
+	}
+	if len(r) == 0 {
+		r = append(r, "")
+	}
+	return r
+}
+
+// Parses the fields in \a block, and returns their unfolded values keyed by
+// the lower-cased field names.
+func parseReportFields(block string) map[string][]string {
+	r := map[string][]string{}
+	name := ""
+	for _, line := range strings.Split(strings.Replace(block, "\r\n", "\n", -1), "\n") {
+		if line == "" {
+			continue
+		}
+		if (line[0] == ' ' || line[0] == '\t') && name != "" {
+			values := r[name]
+			values[len(values)-1] += " " + strings.TrimSpace(line)
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			name = ""
+			continue
+		}
+		name = strings.ToLower(strings.TrimSpace(line[:colon]))
+		r[name] = append(r[name], strings.TrimSpace(line[colon+1:]))
+	}
+	return r
+}
+
+// Returns the first value of the field \a name in \a fields, or an empty
+// string.
+func firstReportField(fields map[string][]string, name string) string {
+	if v := fields[name]; len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
+
+// Returns the value of the typed field \a name in \a fields without its
+// type, e.g. "bob@example.com" for "Final-Recipient: rfc822; bob@example.com"
+// or "550 5.1.1 No such user" for "Diagnostic-Code: smtp; 550 5.1.1 No such
+// user".
+func reportValue(fields map[string][]string, name string) string {
+	v := firstReportField(fields, name)
+	if semi := strings.IndexByte(v, ';'); semi >= 0 {
+		v = v[semi+1:]
+	}
+	v = strings.TrimSpace(v)
+	if name == "final-recipient" || name == "original-recipient" {
+		v = strings.Trim(v, "<>")
+	}
+	return v
+}
@@ -0,0 +1,119 @@
+package mail
+
+import (
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Resolver looks up DNS records. It is used by everything which needs DNS,
+// such as DKIMVerifier and Verifier, so that tests can supply records of
+// their own and servers can use a resolver of their choice.
+//
+// Both functions return a *net.DNSError with IsNotFound set if the name has
+// no such records, as the functions of package net do.
+type Resolver interface {
+	LookupTXT(name string) ([]string, error)
+	LookupMX(name string) ([]*net.MX, error)
+}
+
+// The Resolver used when none is given: a CachingResolver using the
+// system's resolver.
+var DefaultResolver Resolver = NewCachingResolver(nil)
+
+// A CachingResolver passes lookups to Upstream, or if it is nil, to the
+// system's resolver, and keeps the answers for TTL, and the answers that a
+// name does not exist for NegativeTTL. Other errors, e.g. timeouts, are
+// not kept. Since package net does not say how long records may be kept,
+// the same TTL is used for all.
+//
+// A CachingResolver is safe for concurrent use.
+type CachingResolver struct {
+	Upstream    Resolver
+	TTL         time.Duration
+	NegativeTTL time.Duration
+
+	mu    sync.Mutex
+	cache map[string]resolverEntry
+}
+
+type resolverEntry struct {
+	txt     []string
+	mx      []*net.MX
+	err     error
+	expires time.Time
+}
+
+// Returns a new CachingResolver using \a upstream (which may be nil, for
+// the system's resolver), which keeps answers for five minutes, and
+// answers that a name does not exist for one minute.
+func NewCachingResolver(upstream Resolver) *CachingResolver {
+	return &CachingResolver{
+		Upstream:    upstream,
+		TTL:         5 * time.Minute,
+		NegativeTTL: time.Minute,
+	}
+}
+
+// Looks up the TXT records of \a name, as described for Resolver.
+func (r *CachingResolver) LookupTXT(name string) ([]string, error) {
+	e := r.lookup("txt", name, func(u Resolver) resolverEntry {
+		txt, err := u.LookupTXT(name)
+		return resolverEntry{txt: txt, err: err}
+	})
+	return e.txt, e.err
+}
+
+// Looks up the MX records of \a name, as described for Resolver.
+func (r *CachingResolver) LookupMX(name string) ([]*net.MX, error) {
+	e := r.lookup("mx", name, func(u Resolver) resolverEntry {
+		mx, err := u.LookupMX(name)
+		return resolverEntry{mx: mx, err: err}
+	})
+	return e.mx, e.err
+}
+
+// Returns the cached answer for the records of type \a kind of \a name,
+// or if there is none, the answer \a lookup gets from the upstream
+// resolver, which is cached if appropriate.
+func (r *CachingResolver) lookup(kind, name string, lookup func(u Resolver) resolverEntry) resolverEntry {
+	key := kind + " " + strings.ToLower(strings.TrimSuffix(name, "."))
+	now := time.Now()
+	r.mu.Lock()
+	e, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e
+	}
+
+	upstream := r.Upstream
+	if upstream == nil {
+		upstream = systemResolver{}
+	}
+	e = lookup(upstream)
+	ttl := r.TTL
+	if e.err != nil {
+		ttl = 0
+		if dnsErr, ok := e.err.(*net.DNSError); ok && dnsErr.IsNotFound {
+			ttl = r.NegativeTTL
+		}
+	}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+		r.mu.Lock()
+		if r.cache == nil {
+			r.cache = map[string]resolverEntry{}
+		}
+		r.cache[key] = e
+		r.mu.Unlock()
+	}
+	return e
+}
+
+// Removes all cached answers.
+func (r *CachingResolver) Flush() {
+	r.mu.Lock()
+	r.cache = nil
+	r.mu.Unlock()
+}
@@ -0,0 +1,130 @@
+package mail
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Strategies of a RetryAdvice.
+const (
+	// The server greylists: it defers mail from unknown senders once, and
+	// accepts it when it is retried after a few minutes.
+	RetryGreylisted = "greylisted"
+	// The server limits how much mail it accepts from the sender, so
+	// retrying soon only prolongs the limit.
+	RetryRateLimited = "rate-limited"
+	// A DNS lookup, typically of the sender's domain, failed temporarily.
+	RetryDNS = "dns"
+	// The recipient's mailbox is full, which takes its owner a while to
+	// fix.
+	RetryMailboxFull = "mailbox-full"
+	// Any other temporary failure.
+	RetryTemporary = "temporary"
+)
+
+// A RetryAdvice says how to retry a message which an SMTP server deferred
+// with a 4xx reply. Strategy is one of the Retry* constants above, and
+// Delay how long to wait before retrying.
+type RetryAdvice struct {
+	Strategy string
+	Delay    time.Duration
+}
+
+// The delay recommended for each strategy, unless the server asks for
+// another. RFC 5321 recommends waiting at least 30 minutes in general, but
+// greylisting servers accept a retry after a few minutes.
+var retryDelays = map[string]time.Duration{
+	RetryGreylisted:  5 * time.Minute,
+	RetryRateLimited: 30 * time.Minute,
+	RetryDNS:         15 * time.Minute,
+	RetryMailboxFull: 2 * time.Hour,
+	RetryTemporary:   30 * time.Minute,
+}
+
+// The patterns which identify each strategy in the text of a reply, in the
+// order in which they are tried, and the enhanced status codes (RFC 3463)
+// which do.
+var retryPatterns = []struct {
+	strategy string
+	text     *regexp.Regexp
+	enhanced []string
+}{
+	{RetryGreylisted,
+		regexp.MustCompile(`(?i)gr[ae]y-?list|postgrey|sqlgrey`), nil},
+	{RetryMailboxFull,
+		regexp.MustCompile(`(?i)mailbox (is )?full|over ?quota|quota exceeded|insufficient (disk )?(space|storage)`),
+		[]string{"4.2.2", "4.3.1"}},
+	{RetryRateLimited,
+		regexp.MustCompile(`(?i)rate ?limit|too many|throttl|slow down|(connection|sending|message) limit|unusual rate`),
+		[]string{"4.7.28", "4.4.5", "4.3.2"}},
+	{RetryDNS,
+		regexp.MustCompile(`(?i)\bdns\b|name resolution|name server|lookup|resolve|domain not found`),
+		[]string{"4.1.8", "4.4.3", "4.1.2"}},
+}
+
+// A delay the server asks for, e.g. "please try again in 300 seconds".
+var requestedDelay = regexp.MustCompile(`(?i)\b(?:in|after|wait)\s+(\d+)\s*(s|secs?|seconds?|m|mins?|minutes?)\b`)
+
+// Classifies the SMTP reply with code \a code and text \a text (which may
+// begin with an enhanced status code) as SMTPStatus.Retry() does.
+func ClassifyReply(code int, text string) (RetryAdvice, bool) {
+	s := ParseSMTPStatus(text)
+	s.Code = code
+	return s.Retry()
+}
+
+// Classifies the SMTP reply in \a err, e.g. as returned by
+// SMTPTransport.Send(), as SMTPStatus.Retry() does. Returns false if \a err
+// does not hold an SMTP reply, e.g. if the connection failed, or the reply
+// is not a temporary failure.
+func ClassifyError(err error) (RetryAdvice, bool) {
+	s, ok := SMTPStatusFromError(err)
+	if !ok {
+		return RetryAdvice{}, false
+	}
+	return s.Retry()
+}
+
+// Returns how to retry the message which this status deferred, or false if
+// it is not a temporary failure.
+//
+// Greylisting is recognised by its name in the text, or a 450 or 451 reply
+// with enhanced status code 4.7.1 asking to try again later, which is how
+// most greylisting servers phrase it. If the text asks for a delay, e.g.
+// "try again in 300 seconds", that delay is recommended.
+func (s SMTPStatus) Retry() (RetryAdvice, bool) {
+	if !s.Temporary() {
+		return RetryAdvice{}, false
+	}
+	text := s.Text()
+	strategy := RetryTemporary
+	for _, p := range retryPatterns {
+		matches := p.text.MatchString(text)
+		for _, e := range p.enhanced {
+			matches = matches || e == s.Enhanced
+		}
+		if matches {
+			strategy = p.strategy
+			break
+		}
+	}
+	if strategy == RetryTemporary && (s.Code == 450 || s.Code == 451) && s.Enhanced == "4.7.1" &&
+		strings.Contains(strings.ToLower(text), "try again later") {
+		strategy = RetryGreylisted
+	}
+
+	a := RetryAdvice{Strategy: strategy, Delay: retryDelays[strategy]}
+	if m := requestedDelay.FindStringSubmatch(text); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		unit := time.Second
+		if strings.HasPrefix(strings.ToLower(m[2]), "m") {
+			unit = time.Minute
+		}
+		if n > 0 {
+			a.Delay = time.Duration(n) * unit
+		}
+	}
+	return a, true
+}
@@ -0,0 +1,62 @@
+package mail_test
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// A Transport which fails with Err.
+type failingTransport struct {
+	Err error
+}
+
+func (t *failingTransport) Send(env mail.Envelope, rfc5322 string) error {
+	return t.Err
+}
+
+func TestClassifyReply(t *testing.T) {
+	for _, c := range []struct {
+		code     int
+		text     string
+		strategy string
+		delay    time.Duration
+	}{
+		{450, "4.2.0 <bob@example.com>: Recipient address rejected: Greylisted, see http://postgrey.schweikert.ch/",
+			mail.RetryGreylisted, 5 * time.Minute},
+		{451, "4.7.1 Please try again later", mail.RetryGreylisted, 5 * time.Minute},
+		{451, "Greylisted, please try again in 120 seconds", mail.RetryGreylisted, 2 * time.Minute},
+		{421, "4.7.28 Our system has detected an unusual rate of unsolicited mail", mail.RetryRateLimited, 30 * time.Minute},
+		{421, "Too many concurrent connections from your IP", mail.RetryRateLimited, 30 * time.Minute},
+		{450, "4.7.0 Sending rate limit exceeded, wait 10 minutes", mail.RetryRateLimited, 10 * time.Minute},
+		{451, "4.1.8 <alice@example.com>: Sender address rejected: Domain not found", mail.RetryDNS, 15 * time.Minute},
+		{451, "Temporary failure in name resolution", mail.RetryDNS, 15 * time.Minute},
+		{452, "4.2.2 Mailbox full", mail.RetryMailboxFull, 2 * time.Hour},
+		{452, "Recipient is over quota", mail.RetryMailboxFull, 2 * time.Hour},
+		{451, "4.3.0 Local error in processing", mail.RetryTemporary, 30 * time.Minute},
+	} {
+		a, ok := mail.ClassifyReply(c.code, c.text)
+		if !ok || a.Strategy != c.strategy || a.Delay != c.delay {
+			t.Errorf("ClassifyReply(%d, %q) = %v, %v, want %s %v", c.code, c.text, a, ok, c.strategy, c.delay)
+		}
+	}
+	if _, ok := mail.ClassifyReply(550, "5.7.1 Greylisted forever"); ok {
+		t.Error("a permanent failure was classified")
+	}
+	if _, ok := mail.ClassifyError(errors.New("connection refused")); ok {
+		t.Error("a network error was classified")
+	}
+
+	s := mail.NewMemoryScheduler()
+	now := time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+	s.Schedule("Subject: hi\r\n\r\n", mail.Envelope{To: []string{"bob@example.com"}}, now)
+	greylisted := fmt.Errorf("mail: %w", &textproto.Error{Code: 451, Msg: "4.7.1 Greylisted"})
+	if err := mail.SendDue(s, &failingTransport{greylisted}, now); err == nil {
+		t.Error("failure not reported")
+	}
+	testStringEquals(t, "greylisted retry", s.Pending()[0].At.Format(time.RFC3339), "2026-10-05T10:05:00Z")
+}
@@ -0,0 +1,362 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// A SASLMechanism is the client side of one authentication exchange using
+// a SASL mechanism (RFC 4422), independent of the protocol carrying it, so
+// that SMTP, IMAP and POP3 clients can share mechanisms.
+//
+// Name returns the name of the mechanism, e.g. "PLAIN". Start returns the
+// initial response, or nil if the mechanism has none, in which case the
+// server begins with a challenge. Next returns the response to each
+// challenge. Both return an error to abort the exchange, e.g. if the
+// server's proof of its identity is wrong.
+type SASLMechanism interface {
+	Name() string
+	Start() ([]byte, error)
+	Next(challenge []byte) ([]byte, error)
+}
+
+// A saslFinalChecker is a SASLMechanism which, once the server reports
+// success, still has to check the server's final message, as SCRAM checks
+// the server's signature.
+type saslFinalChecker interface {
+	awaitingFinal() bool
+}
+
+// SASLCredentials is what a SASLMechanism needs to authenticate. Username
+// is the identity whose credentials are used, Password its password and
+// Token an OAuth 2.0 access token, used instead of Password by XOAUTH2.
+// Identity, if not empty, is the identity to act as (the authorization
+// identity), which may differ from Username, e.g. for an administrator.
+// Rand is the source of the nonces mechanisms such as SCRAM use, or
+// crypto/rand if nil.
+type SASLCredentials struct {
+	Identity string
+	Username string
+	Password string
+	Token    string
+	Rand     RandSource
+}
+
+// The mechanisms which RegisterSASL() has registered, by upper-case name.
+var saslMechanisms = struct {
+	sync.RWMutex
+	m map[string]func(SASLCredentials) SASLMechanism
+}{m: map[string]func(SASLCredentials) SASLMechanism{}}
+
+// Registers the SASL mechanism \a name, e.g. "PLAIN", so that NewSASL()
+// uses \a f to make it, replacing any mechanism registered with that name.
+// PLAIN, LOGIN, CRAM-MD5, SCRAM-SHA-256, XOAUTH2 and EXTERNAL are
+// registered by this package.
+func RegisterSASL(name string, f func(SASLCredentials) SASLMechanism) {
+	saslMechanisms.Lock()
+	defer saslMechanisms.Unlock()
+	saslMechanisms.m[strings.ToUpper(name)] = f
+}
+
+// Returns a new exchange using the registered SASL mechanism \a name with
+// the credentials \a c, or an error if no mechanism with that name is
+// registered.
+func NewSASL(name string, c SASLCredentials) (SASLMechanism, error) {
+	saslMechanisms.RLock()
+	f := saslMechanisms.m[strings.ToUpper(name)]
+	saslMechanisms.RUnlock()
+	if f == nil {
+		return nil, fmt.Errorf("mail: unknown SASL mechanism %s", name)
+	}
+	return f(c), nil
+}
+
+// Returns the names of the registered SASL mechanisms, sorted.
+func SASLMechanisms() []string {
+	saslMechanisms.RLock()
+	defer saslMechanisms.RUnlock()
+	r := make([]string, 0, len(saslMechanisms.m))
+	for name := range saslMechanisms.m {
+		r = append(r, name)
+	}
+	sort.Strings(r)
+	return r
+}
+
+func init() {
+	RegisterSASL("PLAIN", func(c SASLCredentials) SASLMechanism { return &plainSASL{c} })
+	RegisterSASL("LOGIN", func(c SASLCredentials) SASLMechanism { return &loginSASL{c: c} })
+	RegisterSASL("CRAM-MD5", func(c SASLCredentials) SASLMechanism { return &cramMD5SASL{c} })
+	RegisterSASL("SCRAM-SHA-256", func(c SASLCredentials) SASLMechanism {
+		return &scramSASL{name: "SCRAM-SHA-256", hash: sha256.New, c: c}
+	})
+	RegisterSASL("XOAUTH2", func(c SASLCredentials) SASLMechanism { return &xoauth2SASL{c} })
+	RegisterSASL("EXTERNAL", func(c SASLCredentials) SASLMechanism { return &externalSASL{c} })
+}
+
+// Returns the argument of a command which starts the exchange \a m with its
+// initial response, as IMAP's AUTHENTICATE (with SASL-IR, RFC 4959) and
+// POP3's AUTH (RFC 5034) take it: the name of the mechanism, followed by
+// the base64-encoded initial response if there is one, or "=" if it is
+// empty.
+func SASLCommand(m SASLMechanism) (string, error) {
+	ir, err := m.Start()
+	if err != nil || ir == nil {
+		return m.Name(), err
+	}
+	return m.Name() + " " + encodeSASL(ir), nil
+}
+
+// Returns the response of the exchange \a m to \a challenge, the text
+// following "+ " in an IMAP or POP3 continuation, both base64-encoded as
+// those protocols send them.
+func SASLResponse(m SASLMechanism, challenge string) (string, error) {
+	c, err := base64.StdEncoding.DecodeString(strings.TrimSpace(challenge))
+	if err != nil {
+		return "", fmt.Errorf("mail: invalid SASL challenge: %w", err)
+	}
+	r, err := m.Next(c)
+	if err != nil {
+		return "", err
+	}
+	return encodeSASL(r), nil
+}
+
+// Returns \a b base64-encoded, or "=" if it is empty.
+func encodeSASL(b []byte) string {
+	if len(b) == 0 {
+		return "="
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+// PLAIN (RFC 4616).
+type plainSASL struct {
+	c SASLCredentials
+}
+
+func (m *plainSASL) Name() string {
+	return "PLAIN"
+}
+
+func (m *plainSASL) Start() ([]byte, error) {
+	return []byte(m.c.Identity + "\x00" + m.c.Username + "\x00" + m.c.Password), nil
+}
+
+func (m *plainSASL) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("mail: unexpected challenge to PLAIN")
+}
+
+// LOGIN, which is obsolete but still widely used, e.g. by Microsoft's
+// servers: the server asks for the user name and then for the password.
+type loginSASL struct {
+	c    SASLCredentials
+	step int
+}
+
+func (m *loginSASL) Name() string {
+	return "LOGIN"
+}
+
+func (m *loginSASL) Start() ([]byte, error) {
+	return nil, nil
+}
+
+func (m *loginSASL) Next(challenge []byte) ([]byte, error) {
+	m.step++
+	switch m.step {
+	case 1:
+		return []byte(m.c.Username), nil
+	case 2:
+		return []byte(m.c.Password), nil
+	}
+	return nil, errors.New("mail: unexpected challenge to LOGIN")
+}
+
+// CRAM-MD5 (RFC 2195).
+type cramMD5SASL struct {
+	c SASLCredentials
+}
+
+func (m *cramMD5SASL) Name() string {
+	return "CRAM-MD5"
+}
+
+func (m *cramMD5SASL) Start() ([]byte, error) {
+	return nil, nil
+}
+
+func (m *cramMD5SASL) Next(challenge []byte) ([]byte, error) {
+	d := hmac.New(md5.New, []byte(m.c.Password))
+	d.Write(challenge)
+	return []byte(m.c.Username + " " + hex.EncodeToString(d.Sum(nil))), nil
+}
+
+// XOAUTH2, as Google's and Microsoft's servers accept OAuth 2.0 tokens.
+type xoauth2SASL struct {
+	c SASLCredentials
+}
+
+func (m *xoauth2SASL) Name() string {
+	return "XOAUTH2"
+}
+
+func (m *xoauth2SASL) Start() ([]byte, error) {
+	return []byte("user=" + m.c.Username + "\x01auth=Bearer " + m.c.Token + "\x01\x01"), nil
+}
+
+// The server describes why the token was refused in a challenge, to which
+// the client responds with nothing to end the exchange.
+func (m *xoauth2SASL) Next(challenge []byte) ([]byte, error) {
+	return []byte{}, nil
+}
+
+// EXTERNAL (RFC 4422 appendix A), which relies on authentication outside
+// SASL, typically a TLS client certificate.
+type externalSASL struct {
+	c SASLCredentials
+}
+
+func (m *externalSASL) Name() string {
+	return "EXTERNAL"
+}
+
+func (m *externalSASL) Start() ([]byte, error) {
+	return []byte(m.c.Identity), nil
+}
+
+func (m *externalSASL) Next(challenge []byte) ([]byte, error) {
+	return nil, errors.New("mail: unexpected challenge to EXTERNAL")
+}
+
+// The number of random bytes in a SCRAM client nonce.
+const scramNonceSize = 15
+
+// The iteration counts a SCRAM client accepts. RFC 7677 asks for at least
+// 4096, and the maximum stops a hostile server from tying up the client.
+const (
+	scramMinIterations = 4096
+	scramMaxIterations = 1 << 20
+)
+
+// SCRAM (RFC 5802), without channel binding, using \a hash, e.g.
+// SCRAM-SHA-256 (RFC 7677). The password is used as it is, without
+// SASLprep, which only matters for passwords with unusual characters.
+type scramSASL struct {
+	name string
+	hash func() hash.Hash
+	c    SASLCredentials
+
+	step            int
+	gs2, clientBare string
+	nonce           string
+	serverSignature []byte
+}
+
+func (m *scramSASL) Name() string {
+	return m.name
+}
+
+func (m *scramSASL) Start() ([]byte, error) {
+	b := make([]byte, scramNonceSize)
+	if _, err := io.ReadFull(randReader(m.c.Rand), b); err != nil {
+		return nil, err
+	}
+	m.nonce = base64.StdEncoding.EncodeToString(b)
+	m.gs2 = "n,,"
+	if m.c.Identity != "" {
+		m.gs2 = "n,a=" + scramName(m.c.Identity) + ","
+	}
+	m.clientBare = "n=" + scramName(m.c.Username) + ",r=" + m.nonce
+	return []byte(m.gs2 + m.clientBare), nil
+}
+
+func (m *scramSASL) Next(challenge []byte) ([]byte, error) {
+	m.step++
+	attrs := map[byte]string{}
+	for _, a := range strings.Split(string(challenge), ",") {
+		if len(a) >= 2 && a[1] == '=' {
+			attrs[a[0]] = a[2:]
+		}
+	}
+	if e, ok := attrs['e']; ok {
+		return nil, errors.New("mail: " + m.name + " failed: " + e)
+	}
+
+	switch m.step {
+	case 1:
+		nonce, salt64, iterations := attrs['r'], attrs['s'], attrs['i']
+		salt, err := base64.StdEncoding.DecodeString(salt64)
+		n, nerr := strconv.Atoi(iterations)
+		if !strings.HasPrefix(nonce, m.nonce) || err != nil || nerr != nil ||
+			n < scramMinIterations || n > scramMaxIterations {
+			return nil, errors.New("mail: invalid " + m.name + " challenge")
+		}
+		mac := func(key []byte, s string) []byte {
+			d := hmac.New(m.hash, key)
+			d.Write([]byte(s))
+			return d.Sum(nil)
+		}
+		salted := pbkdf2(m.hash, []byte(m.c.Password), salt, n)
+		clientKey := mac(salted, "Client Key")
+		d := m.hash()
+		d.Write(clientKey)
+		storedKey := d.Sum(nil)
+		final := "c=" + base64.StdEncoding.EncodeToString([]byte(m.gs2)) + ",r=" + nonce
+		authMessage := m.clientBare + "," + string(challenge) + "," + final
+		proof := mac(storedKey, authMessage)
+		for i := range proof {
+			proof[i] ^= clientKey[i]
+		}
+		m.serverSignature = mac(mac(salted, "Server Key"), authMessage)
+		return []byte(final + ",p=" + base64.StdEncoding.EncodeToString(proof)), nil
+	case 2:
+		v, err := base64.StdEncoding.DecodeString(attrs['v'])
+		if err != nil || !hmac.Equal(v, m.serverSignature) {
+			return nil, errors.New("mail: the server's " + m.name + " signature is wrong")
+		}
+		return []byte{}, nil
+	}
+	return nil, errors.New("mail: unexpected challenge to " + m.name)
+}
+
+// Returns true if the server has sent its challenge but not yet its
+// signature.
+func (m *scramSASL) awaitingFinal() bool {
+	return m.step == 1
+}
+
+// Returns \a name with "=" and "," escaped, as SCRAM requires.
+func scramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
+
+// Returns the key PBKDF2 (RFC 8018) derives from \a password and \a salt
+// with \a iterations iterations of HMAC using \a h, as long as the hash.
+func pbkdf2(h func() hash.Hash, password, salt []byte, iterations int) []byte {
+	prf := hmac.New(h, password)
+	prf.Write(salt)
+	prf.Write([]byte{0, 0, 0, 1})
+	u := prf.Sum(nil)
+	r := append([]byte{}, u...)
+	for i := 1; i < iterations; i++ {
+		prf.Reset()
+		prf.Write(u)
+		u = prf.Sum(u[:0])
+		for j := range r {
+			r[j] ^= u[j]
+		}
+	}
+	return r
+}
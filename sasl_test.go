@@ -0,0 +1,103 @@
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// A SASL mechanism which sends a fixed response, for registering.
+type echoSASL struct {
+	response string
+}
+
+func (m *echoSASL) Name() string {
+	return "X-ECHO"
+}
+
+func (m *echoSASL) Start() ([]byte, error) {
+	return nil, nil
+}
+
+func (m *echoSASL) Next(challenge []byte) ([]byte, error) {
+	return []byte(m.response + " " + string(challenge)), nil
+}
+
+func TestSASL(t *testing.T) {
+	// RFC 7677 section 3
+	nonce, _ := base64.StdEncoding.DecodeString("rOprNGfwEbeRWgbNEkqO")
+	scram, err := mail.NewSASL("scram-sha-256",
+		mail.SASLCredentials{Username: "user", Password: "pencil", Rand: bytes.NewReader(nonce)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := scram.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "client-first", string(first), "n,,n=user,r=rOprNGfwEbeRWgbNEkqO")
+	final, err := scram.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0," +
+		"s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "client-final", string(final),
+		"c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,"+
+			"p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=")
+	if _, err := scram.Next([]byte("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")); err != nil {
+		t.Errorf("server signature refused: %v", err)
+	}
+
+	for _, i := range []string{"1", "100000000"} {
+		scram, _ = mail.NewSASL("SCRAM-SHA-256",
+			mail.SASLCredentials{Username: "user", Password: "pencil", Rand: bytes.NewReader(nonce)})
+		scram.Start()
+		if _, err := scram.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0," +
+			"s=W22ZaJ0SNY7soEsUEjb6gQ==,i=" + i)); err == nil {
+			t.Errorf("iteration count %s accepted", i)
+		}
+	}
+
+	// RFC 2195 section 2
+	cram, _ := mail.NewSASL("CRAM-MD5", mail.SASLCredentials{Username: "tim", Password: "tanstaaftanstaaf"})
+	r, err := mail.SASLResponse(cram, base64.StdEncoding.EncodeToString(
+		[]byte("<1896.697170952@postoffice.reston.mci.net>")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "cram-md5", r, base64.StdEncoding.EncodeToString(
+		[]byte("tim b913a602c7eda7a495b4e6e7334d3890")))
+
+	plain, _ := mail.NewSASL("PLAIN", mail.SASLCredentials{Username: "alice", Password: "secret"})
+	cmd, _ := mail.SASLCommand(plain)
+	testStringEquals(t, "plain", cmd, "PLAIN AGFsaWNlAHNlY3JldA==")
+	external, _ := mail.NewSASL("EXTERNAL", mail.SASLCredentials{})
+	cmd, _ = mail.SASLCommand(external)
+	testStringEquals(t, "external", cmd, "EXTERNAL =")
+	login, _ := mail.NewSASL("LOGIN", mail.SASLCredentials{Username: "alice", Password: "secret"})
+	cmd, _ = mail.SASLCommand(login)
+	testStringEquals(t, "login", cmd, "LOGIN")
+	r, _ = mail.SASLResponse(login, "VXNlcm5hbWU6")
+	testStringEquals(t, "login user", r, "YWxpY2U=")
+	xoauth2, _ := mail.NewSASL("XOAUTH2", mail.SASLCredentials{Username: "alice@example.com", Token: "t0ken"})
+	ir, _ := xoauth2.Start()
+	testStringEquals(t, "xoauth2", string(ir), "user=alice@example.com\x01auth=Bearer t0ken\x01\x01")
+
+	if _, err := mail.NewSASL("X-ECHO", mail.SASLCredentials{}); err == nil {
+		t.Error("an unregistered mechanism was made")
+	}
+	mail.RegisterSASL("x-echo", func(c mail.SASLCredentials) mail.SASLMechanism {
+		return &echoSASL{c.Username}
+	})
+	echo, err := mail.NewSASL("X-ECHO", mail.SASLCredentials{Username: "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _ = mail.SASLResponse(echo, base64.StdEncoding.EncodeToString([]byte("hi")))
+	testStringEquals(t, "custom", r, base64.StdEncoding.EncodeToString([]byte("alice hi")))
+	testStringEquals(t, "mechanisms", strings.Join(mail.SASLMechanisms(), " "),
+		"CRAM-MD5 EXTERNAL LOGIN PLAIN SCRAM-SHA-256 X-ECHO XOAUTH2")
+}
@@ -0,0 +1,64 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/smtp"
+	"strings"
+)
+
+// Returns \a m as an smtp.Auth, e.g. for SMTPTransport.Auth. As with
+// smtp.PlainAuth(), mechanisms which send a secret in the clear, i.e. all
+// but the challenge-response mechanisms CRAM-MD5 and SCRAM and EXTERNAL,
+// which sends none, are refused unless the connection is encrypted or to
+// localhost.
+func SMTPAuth(m SASLMechanism) smtp.Auth {
+	return &saslSMTPAuth{m}
+}
+
+type saslSMTPAuth struct {
+	m SASLMechanism
+}
+
+func (a *saslSMTPAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	name := a.m.Name()
+	if !isChallengeResponse(name) && !server.TLS &&
+		server.Name != "localhost" && server.Name != "127.0.0.1" && server.Name != "::1" {
+		return "", nil, errors.New("mail: " + name + " needs an encrypted connection")
+	}
+	ir, err := a.m.Start()
+	return name, ir, err
+}
+
+// Returns true if the mechanism \a name sends nothing an eavesdropper
+// could use to authenticate.
+func isChallengeResponse(name string) bool {
+	return name == "CRAM-MD5" || name == "EXTERNAL" || strings.HasPrefix(name, "SCRAM-")
+}
+
+func (a *saslSMTPAuth) Next(challenge []byte, more bool) ([]byte, error) {
+	if more {
+		return a.m.Next(challenge)
+	}
+	// net/smtp passes the text of the 235 reply, which may carry the
+	// server's final message, e.g. SCRAM's signature, in base64
+	if f, ok := a.m.(saslFinalChecker); ok && f.awaitingFinal() {
+		_, err := a.m.Next(successData(challenge))
+		return nil, err
+	}
+	return nil, nil
+}
+
+// Returns the additional data in the text \a reply of a 235 reply: the
+// first word which is base64, decoded, or \a reply itself if none is.
+func successData(reply []byte) []byte {
+	for _, w := range strings.Fields(string(reply)) {
+		if b, err := base64.StdEncoding.DecodeString(w); err == nil && len(b) > 0 {
+			return b
+		}
+	}
+	return reply
+}
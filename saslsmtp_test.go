@@ -0,0 +1,70 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/smtp"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSMTPAuth(t *testing.T) {
+	plain, _ := mail.NewSASL("PLAIN", mail.SASLCredentials{Username: "alice", Password: "secret"})
+	auth := mail.SMTPAuth(plain)
+	if _, _, err := auth.Start(&smtp.ServerInfo{Name: "mx.example.com"}); err == nil {
+		t.Error("PLAIN was used without TLS")
+	}
+	name, ir, err := auth.Start(&smtp.ServerInfo{Name: "mx.example.com", TLS: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "smtp", name+" "+string(ir), "PLAIN \x00alice\x00secret")
+}
+
+func TestSMTPAuthCleartext(t *testing.T) {
+	xoauth2, _ := mail.NewSASL("XOAUTH2", mail.SASLCredentials{Username: "alice@example.com", Token: "t0ken"})
+	if _, _, err := mail.SMTPAuth(xoauth2).Start(&smtp.ServerInfo{Name: "mx.example.com"}); err == nil {
+		t.Error("XOAUTH2 was used without TLS")
+	}
+	cram, _ := mail.NewSASL("CRAM-MD5", mail.SASLCredentials{Username: "tim", Password: "tanstaaftanstaaf"})
+	if _, _, err := mail.SMTPAuth(cram).Start(&smtp.ServerInfo{Name: "mx.example.com"}); err != nil {
+		t.Errorf("CRAM-MD5 was refused without TLS: %v", err)
+	}
+}
+
+func TestSMTPAuthSCRAMFinal(t *testing.T) {
+	// RFC 7677 section 3, with the server's signature in the 235 reply
+	scram := func() smtp.Auth {
+		nonce, _ := base64.StdEncoding.DecodeString("rOprNGfwEbeRWgbNEkqO")
+		m, err := mail.NewSASL("SCRAM-SHA-256",
+			mail.SASLCredentials{Username: "user", Password: "pencil", Rand: bytes.NewReader(nonce)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		a := mail.SMTPAuth(m)
+		if _, _, err := a.Start(&smtp.ServerInfo{Name: "mx.example.com"}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := a.Next([]byte("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,"+
+			"s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096"), true); err != nil {
+			t.Fatal(err)
+		}
+		return a
+	}
+	final := func(v string) []byte {
+		return []byte("2.7.0 " + base64.StdEncoding.EncodeToString([]byte("v="+v)))
+	}
+	if _, err := scram().Next(final("6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), false); err != nil {
+		t.Errorf("server signature refused: %v", err)
+	}
+	if _, err := scram().Next(final("AAAATRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4="), false); err == nil {
+		t.Error("wrong server signature accepted")
+	}
+	if _, err := scram().Next([]byte("2.7.0 Authentication successful"), false); err == nil {
+		t.Error("missing server signature accepted")
+	}
+}
@@ -0,0 +1,213 @@
+package mail
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RFC 2156: the time before which the message should not be delivered,
+	// as Exchange and Outlook write it for deferred delivery.
+	DeferredDeliveryFieldName = "Deferred-Delivery"
+	// The delay, in seconds, after the Date field before the message should
+	// be delivered, as some submission agents accept it. A date is accepted
+	// too.
+	XDelayFieldName = "X-Delay"
+)
+
+// Returns the time before which this message should not be delivered, and
+// true, or the zero time and false if it may be delivered at once.
+//
+// A Deferred-Delivery field is used if there is a valid one; otherwise an
+// X-Delay field holding a number of seconds after the Date field (or a
+// date) is.
+func (h *Header) DeferredUntil() (time.Time, bool) {
+	if v := simplify(h.Get(DeferredDeliveryFieldName)); v != "" {
+		if t, err := ParseDate(v); err == nil {
+			return t, true
+		}
+	}
+	v := simplify(h.Get(XDelayFieldName))
+	if v == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		if d := h.Date(); d != nil {
+			return d.Add(time.Duration(n) * time.Second), true
+		}
+		return time.Time{}, false
+	}
+	if t, err := ParseDate(v); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+// Replaces the Deferred-Delivery and X-Delay fields of this header with a
+// Deferred-Delivery field holding \a t, or removes them if \a t is zero.
+func (h *Header) SetDeferredDelivery(t time.Time) {
+	h.RemoveAllNamed(DeferredDeliveryFieldName)
+	h.RemoveAllNamed(XDelayFieldName)
+	if !t.IsZero() {
+		h.Add(DeferredDeliveryFieldName, FormatDate(t, nil))
+	}
+}
+
+// A ScheduledMessage is a message held by a Scheduler until At: a message
+// to be sent later (scheduled send), or a message taken out of view until
+// then (snooze), in which case the Envelope may be empty and the caller
+// puts the message back when it is due. ID is chosen by the Scheduler.
+type ScheduledMessage struct {
+	ID       string    `json:"id"`
+	At       time.Time `json:"at"`
+	Envelope Envelope  `json:"envelope"`
+	Message  string    `json:"message"`
+}
+
+// A Scheduler holds messages until a time.
+//
+// Schedule() adds a message and returns its ID. Cancel() removes a message
+// which has not been taken yet, and returns ErrNotScheduled if there is
+// none with that ID. Due() removes and returns the messages whose time has
+// come by \a now, earliest first.
+//
+// MemoryScheduler is a simple implementation; one persisting messages, e.g.
+// in a database, lets them survive a restart.
+type Scheduler interface {
+	Schedule(rfc5322 string, env Envelope, at time.Time) (string, error)
+	Cancel(id string) error
+	Due(now time.Time) ([]ScheduledMessage, error)
+}
+
+// Holds \a m until it is due according to its DeferredUntil(), or until
+// now if it has no deferral, in \a s, and returns its ID in \a s. If \a s
+// is also a Clock, as a MemoryScheduler is, it says what time it is. The
+// Deferred-Delivery and X-Delay fields are removed from the text held, so
+// that the recipients' servers do not defer it again.
+func ScheduleMessage(s Scheduler, m *Message, env Envelope) (string, error) {
+	at, ok := m.Header.DeferredUntil()
+	if !ok {
+		at = time.Now()
+		if c, isClock := s.(Clock); isClock {
+			at = c.Now()
+		}
+	}
+	fields := m.Header.Fields
+	m.Header.Fields = nil
+	for _, f := range fields {
+		if !strings.EqualFold(f.Name(), DeferredDeliveryFieldName) &&
+			!strings.EqualFold(f.Name(), XDelayFieldName) {
+			m.Header.Fields = append(m.Header.Fields, f)
+		}
+	}
+	text := m.RFC822(false)
+	m.Header.Fields = fields
+	return s.Schedule(text, env, at)
+}
+
+// Sends the messages in \a s which are due by \a now using \a t. If
+// sending one fails, the others are sent nonetheless, and the first error is
+// returned. A failed message is scheduled again after the delay
+// ClassifyError() recommends if the server deferred it, e.g. five minutes
+// if it greylists, and otherwise a minute later.
+func SendDue(s Scheduler, t Transport, now time.Time) error {
+	due, err := s.Due(now)
+	if err != nil {
+		return err
+	}
+	var first error
+	for _, sm := range due {
+		if err := t.Send(sm.Envelope, sm.Message); err != nil {
+			if first == nil {
+				first = err
+			}
+			delay := time.Minute
+			if a, ok := ClassifyError(err); ok {
+				delay = a.Delay
+			}
+			s.Schedule(sm.Message, sm.Envelope, now.Add(delay))
+		}
+	}
+	return first
+}
+
+// A MemoryScheduler is a Scheduler keeping messages in memory. It is safe
+// for concurrent use. Clock, if not nil, is the clock its Now() reads
+// instead of the system clock.
+type MemoryScheduler struct {
+	Clock Clock
+
+	mu       sync.Mutex
+	messages []ScheduledMessage
+	next     int
+}
+
+// Returns a new, empty MemoryScheduler.
+func NewMemoryScheduler() *MemoryScheduler {
+	return &MemoryScheduler{}
+}
+
+// Returns the current time according to the scheduler's Clock.
+func (s *MemoryScheduler) Now() time.Time {
+	return clockNow(s.Clock)
+}
+
+// Holds \a rfc5322 with the envelope \a env until \a at.
+func (s *MemoryScheduler) Schedule(rfc5322 string, env Envelope, at time.Time) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.messages = append(s.messages, ScheduledMessage{ID: id, At: at, Envelope: env, Message: rfc5322})
+	sort.SliceStable(s.messages, func(i, j int) bool {
+		return s.messages[i].At.Before(s.messages[j].At)
+	})
+	s.recordDepth()
+	return id, nil
+}
+
+// Removes the message \a id, or returns ErrNotScheduled.
+func (s *MemoryScheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, sm := range s.messages {
+		if sm.ID == id {
+			s.messages = append(s.messages[:i], s.messages[i+1:]...)
+			s.recordDepth()
+			return nil
+		}
+	}
+	return ErrNotScheduled
+}
+
+// Removes and returns the messages due by \a now, earliest first.
+func (s *MemoryScheduler) Due(now time.Time) ([]ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := sort.Search(len(s.messages), func(i int) bool {
+		return s.messages[i].At.After(now)
+	})
+	due := append([]ScheduledMessage{}, s.messages[:n]...)
+	s.messages = append(s.messages[:0], s.messages[n:]...)
+	if n > 0 {
+		s.recordDepth()
+	}
+	return due, nil
+}
+
+// Records the number of messages held as "mail.queue.depth". The caller
+// must hold s.mu.
+func (s *MemoryScheduler) recordDepth() {
+	DefaultMetrics.Record("mail.queue.depth", float64(len(s.messages)), nil)
+}
+
+// Returns the messages held, earliest first, without removing them, e.g.
+// for a list of scheduled or snoozed messages.
+func (s *MemoryScheduler) Pending() []ScheduledMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]ScheduledMessage{}, s.messages...)
+}
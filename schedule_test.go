@@ -0,0 +1,74 @@
+package mail_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// A Transport which records what it sends, and fails for recipients at
+// fail.example.
+type recordingTransport struct {
+	sent []string
+}
+
+func (t *recordingTransport) Send(env mail.Envelope, rfc5322 string) error {
+	if strings.HasSuffix(env.To[0], "@fail.example") {
+		return errors.New("failed")
+	}
+	t.sent = append(t.sent, env.To[0])
+	return nil
+}
+
+func TestScheduler(t *testing.T) {
+	h := &mail.Header{}
+	h.Add("Date", "Mon, 5 Oct 2026 10:00:00 +0000")
+	h.Add("X-Delay", "3600")
+	at, ok := h.DeferredUntil()
+	testStringEquals(t, "x-delay", at.UTC().Format(time.RFC3339), "2026-10-05T11:00:00Z")
+	h.Add("Deferred-Delivery", "Tue, 6 Oct 2026 08:00:00 +0200")
+	at, ok = h.DeferredUntil()
+	testStringEquals(t, "deferred-delivery", at.UTC().Format(time.RFC3339), "2026-10-06T06:00:00Z")
+	h.SetDeferredDelivery(time.Time{})
+	if _, ok = h.DeferredUntil(); ok || h.Get("X-Delay") != "" {
+		t.Error("deferral not removed")
+	}
+
+	s := mail.NewMemoryScheduler()
+	base := time.Date(2026, 10, 5, 10, 0, 0, 0, time.UTC)
+	m, err := mail.ReadMessage("From: alice@example.com\r\nDate: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"Deferred-Delivery: Mon, 5 Oct 2026 12:00:00 +0000\r\nSubject: Later\r\n\r\nHi\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := mail.ScheduleMessage(s, m, mail.Envelope{To: []string{"late@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "original kept", m.Header.Get("Deferred-Delivery"), "Mon, 5 Oct 2026 12:00:00 +0000")
+	s.Schedule("Subject: soon\r\n\r\n", mail.Envelope{To: []string{"soon@example.com"}}, base.Add(time.Minute))
+	s.Schedule("Subject: bad\r\n\r\n", mail.Envelope{To: []string{"x@fail.example"}}, base.Add(time.Minute))
+	id, _ := s.Schedule("Subject: never\r\n\r\n", mail.Envelope{To: []string{"never@example.com"}}, base)
+	if err := s.Cancel(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Cancel(id); err != mail.ErrNotScheduled {
+		t.Errorf("cancelled twice: %v", err)
+	}
+
+	tr := &recordingTransport{}
+	if err := mail.SendDue(s, tr, base.Add(time.Hour)); err == nil {
+		t.Error("failure not reported")
+	}
+	testStringEquals(t, "sent", strings.Join(tr.sent, " "), "soon@example.com")
+	pending := s.Pending()
+	testIntegerEquals(t, "pending", len(pending), 2)
+	testStringEquals(t, "retry", pending[0].Envelope.To[0], "x@fail.example")
+	if strings.Contains(pending[1].Message, "Deferred-Delivery") {
+		t.Error("Deferred-Delivery was kept in the scheduled text")
+	}
+	mail.SendDue(s, tr, base.Add(3*time.Hour))
+	testStringEquals(t, "sent later", strings.Join(tr.sent, " "), "soon@example.com late@example.com")
+}
@@ -0,0 +1,167 @@
+package mail
+
+import (
+	"fmt"
+	"path"
+	"strings"
+)
+
+// A SendPolicy decides whether an outgoing message may be sent, so that a
+// deployment can stop messages which its relay or the recipients' servers
+// would reject, or which it does not want to send.
+//
+// MaxSize is the largest message allowed, in bytes, or 0 for no limit.
+// BlockedTypes lists the content types of bodyparts which may not be sent,
+// e.g. "application/x-msdownload"; "application/*" blocks all application
+// types. BlockedExtensions lists file name extensions which may not be
+// sent, e.g. ".exe". RequiredFields lists the header fields each message
+// must have. If CheckRecipients is true, each To and Cc address must be
+// among the envelope recipients, so that no one is listed as a recipient who
+// will not receive the message.
+//
+// Each violation is reported as a Diagnostic with SeverityError, which
+// blocks the message, unless its code is in Warn, in which case it is
+// reported with SeverityWarning and the message may be sent.
+type SendPolicy struct {
+	MaxSize           int
+	BlockedTypes      []string
+	BlockedExtensions []string
+	RequiredFields    []string
+	CheckRecipients   bool
+	Warn              map[string]bool
+}
+
+// The extensions of programs and scripts which run when opened, which mail
+// providers commonly refuse to transmit.
+var executableExtensions = []string{
+	".ade", ".adp", ".apk", ".appx", ".bat", ".cab", ".chm", ".cmd",
+	".com", ".cpl", ".dll", ".dmg", ".exe", ".hta", ".ins", ".isp",
+	".jar", ".js", ".jse", ".lib", ".lnk", ".mde", ".msc", ".msi",
+	".msp", ".mst", ".pif", ".scr", ".sct", ".shb", ".sys", ".vb",
+	".vbe", ".vbs", ".vxd", ".wsc", ".wsf", ".wsh",
+}
+
+// Returns a SendPolicy with the limits most providers impose: messages of
+// at most 25MB, no executable attachments, the From, Date and Message-ID
+// fields, and To and Cc addresses which are envelope recipients.
+func DefaultSendPolicy() *SendPolicy {
+	return &SendPolicy{
+		MaxSize: 25 * 1024 * 1024,
+		BlockedTypes: []string{
+			"application/x-msdownload", "application/x-msdos-program",
+			"application/x-ms-installer", "application/java-archive",
+		},
+		BlockedExtensions: append([]string{}, executableExtensions...),
+		RequiredFields:    []string{FromFieldName, DateFieldName, MessageIDFieldName},
+		CheckRecipients:   true,
+	}
+}
+
+// Checks \a m, which is to be sent with the envelope \a env, against this
+// policy, and returns a diagnostic for each violation, or an empty slice if
+// there are none. Only the envelope's recipients are used.
+func (p *SendPolicy) Check(m *Message, env Envelope) []Diagnostic {
+	r := []Diagnostic{}
+	add := func(code, part, field, format string, args ...interface{}) {
+		s := SeverityError
+		if p.Warn[code] {
+			s = SeverityWarning
+		}
+		r = append(r, Diagnostic{Code: code, Severity: s, Part: part, Field: field,
+			Message: fmt.Sprintf(format, args...)})
+	}
+
+	if p.MaxSize > 0 {
+		if size := len(m.RFC822(false)); size > p.MaxSize {
+			add(DiagnosticTooLarge, "", "",
+				"the message is %d bytes, more than the %d allowed", size, p.MaxSize)
+		}
+	}
+
+	for _, name := range p.RequiredFields {
+		if !m.Header.hasField(name) {
+			add(DiagnosticMissingField, "", name, "the message has no %s field", name)
+		}
+	}
+
+	if m.Part != nil && (len(p.BlockedTypes) > 0 || len(p.BlockedExtensions) > 0) {
+		var check func(part *Part, number string)
+		check = func(part *Part, number string) {
+			if len(part.Parts) > 0 {
+				for i, child := range part.Parts {
+					check(child, partNumber(number, i+1))
+				}
+				return
+			}
+			name := part.Filename()
+			if ct := part.contentType(); p.blockedType(ct) {
+				add(DiagnosticBlockedAttachment, number, "",
+					"%s %s may not be sent", ct, strings.TrimSpace("attachment "+name))
+			} else if ext := strings.ToLower(path.Ext(name)); ext != "" && p.blockedExtension(ext) {
+				add(DiagnosticBlockedAttachment, number, "",
+					"attachment %s may not be sent: %s files are blocked", name, ext)
+			}
+		}
+		check(m.Part, "")
+	}
+
+	if p.CheckRecipients {
+		envelope := map[string]bool{}
+		for _, a := range env.To {
+			envelope[strings.ToLower(strings.Trim(a, "<>"))] = true
+		}
+		if len(envelope) == 0 {
+			add(DiagnosticRecipientMismatch, "", "", "the envelope has no recipients")
+		}
+		for _, name := range []string{ToFieldName, CcFieldName} {
+			for _, a := range m.Header.Addresses(name) {
+				if lp := a.lpdomain(); len(envelope) > 0 && !envelope[strings.ToLower(lp)] {
+					add(DiagnosticRecipientMismatch, "", name,
+						"%s is not an envelope recipient and will not receive the message", lp)
+				}
+			}
+		}
+	}
+	return r
+}
+
+// Returns nil if \a m may be sent with the envelope \a env, and a
+// *SendPolicyError holding the diagnostics returned by Check() if it may
+// not, i.e. if any of them has SeverityError.
+func (p *SendPolicy) Validate(m *Message, env Envelope) error {
+	r := p.Check(m, env)
+	for _, d := range r {
+		if d.Severity == SeverityError {
+			return &SendPolicyError{Diagnostics: r}
+		}
+	}
+	return nil
+}
+
+// Returns true if the content type \a ct, e.g. "application/x-msdownload",
+// is blocked.
+func (p *SendPolicy) blockedType(ct string) bool {
+	for _, t := range p.BlockedTypes {
+		t = strings.ToLower(t)
+		if t == ct || strings.HasSuffix(t, "/*") && strings.HasPrefix(ct, t[:len(t)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if the lower-case file name extension \a ext, e.g. ".exe",
+// is blocked.
+func (p *SendPolicy) blockedExtension(ext string) bool {
+	for _, e := range p.BlockedExtensions {
+		if strings.ToLower(e) == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if this header has a field named \a name.
+func (h *Header) hasField(name string) bool {
+	return h != nil && h.field(name, 0) != nil
+}
@@ -0,0 +1,55 @@
+package mail_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSendPolicy(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("To", "bob@example.com, carol@example.com")
+	c.Text = "Here it is."
+	c.Attach("setup.EXE", "application/octet-stream", "MZ")
+	c.Attach("tool", "application/x-msdownload", "MZ")
+	c.Attach("notes.txt", "text/plain", "notes")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Header.RemoveAllNamed(mail.DateFieldName)
+	env := mail.Envelope{From: "alice@example.com", To: []string{"<Bob@example.com>"}}
+
+	p := mail.DefaultSendPolicy()
+	p.MaxSize = 100
+	var r []string
+	for _, d := range p.Check(m, env) {
+		r = append(r, d.String())
+	}
+	testStringEquals(t, "diagnostics", strings.Join(r, "\n"),
+		fmt.Sprintf("error: too-large: the message is %d bytes, more than the 100 allowed\n", len(m.RFC822(false)))+
+			"error: Date: missing-field: the message has no Date field\n"+
+			"error: part 2: blocked-attachment: attachment setup.EXE may not be sent: .exe files are blocked\n"+
+			"error: part 3: blocked-attachment: application/x-msdownload attachment tool may not be sent\n"+
+			"error: To: recipient-mismatch: carol@example.com is not an envelope recipient and will not receive the message")
+
+	err = p.Validate(m, env)
+	if !errors.Is(err, mail.ErrPolicyViolation) {
+		t.Errorf("expected ErrPolicyViolation, got %v", err)
+	}
+
+	p = &mail.SendPolicy{CheckRecipients: true,
+		Warn: map[string]bool{mail.DiagnosticRecipientMismatch: true}}
+	if err := p.Validate(m, env); err != nil {
+		t.Errorf("expected the mismatch only to warn, got %v", err)
+	}
+	d := p.Check(m, env)
+	testIntegerEquals(t, "warnings", len(d), 1)
+	if len(d) == 1 {
+		testStringEquals(t, "severity", d[0].Severity.String(), "warning")
+	}
+}
@@ -0,0 +1,117 @@
+package mail
+
+import (
+	"errors"
+	"net/textproto"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// An SMTPStatus is an SMTP reply, or what a delivery status notification
+// says about one: Code is the basic reply code (RFC 5321), e.g. 550, or 0
+// if unknown, Enhanced the enhanced status code (RFC 3463), e.g. "5.1.1",
+// or empty if none was given, and Lines the text of each line of the
+// reply, without codes.
+type SMTPStatus struct {
+	Code     int      `json:"code,omitempty"`
+	Enhanced string   `json:"enhanced,omitempty"`
+	Lines    []string `json:"lines,omitempty"`
+}
+
+// An enhanced status code, e.g. "4.7.1".
+var enhancedStatus = regexp.MustCompile(`^[245]\.\d{1,3}\.\d{1,3}$`)
+
+// Parses \a reply, an SMTP reply of one or more lines as it is sent, e.g.
+// "550-5.1.1 No such user\r\n550 5.1.1 Check the address", or as it is
+// quoted in a bounce, e.g. "550 5.1.1 No such user". Lines may lack the
+// basic code, as the text of a textproto.Error does, and the enhanced
+// status code. Codes which are not valid are taken to be part of the text,
+// and empty lines are left out.
+func ParseSMTPStatus(reply string) SMTPStatus {
+	var s SMTPStatus
+	for _, line := range strings.Split(strings.TrimRight(reply, "\r\n"), "\n") {
+		line = strings.TrimRight(line, "\r")
+		if len(line) >= 3 && (len(line) == 3 || line[3] == ' ' || line[3] == '-') {
+			if code, err := strconv.Atoi(line[:3]); err == nil && code >= 200 && code < 600 {
+				if s.Code == 0 {
+					s.Code = code
+				}
+				line = line[3:]
+				if line != "" {
+					line = line[1:]
+				}
+			}
+		}
+		if f := strings.Fields(line); len(f) > 0 && enhancedStatus.MatchString(f[0]) {
+			if s.Enhanced == "" {
+				s.Enhanced = f[0]
+			}
+			line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), f[0]))
+		}
+		if line != "" {
+			s.Lines = append(s.Lines, line)
+		}
+	}
+	return s
+}
+
+// Returns the SMTP reply held in \a err, e.g. an error returned by
+// SMTPTransport.Send() or by the methods of smtp.Client, and true, or false
+// if \a err does not hold one, e.g. because the connection failed.
+func SMTPStatusFromError(err error) (SMTPStatus, bool) {
+	var reply *textproto.Error
+	if !errors.As(err, &reply) {
+		return SMTPStatus{}, false
+	}
+	s := ParseSMTPStatus(reply.Msg)
+	s.Code = reply.Code
+	return s, true
+}
+
+// Returns the class of this status: 2 for success, 4 for a temporary
+// failure and 5 for a permanent one, or 0 if unknown. The enhanced status
+// code is preferred, since a delivery status notification's Status field
+// is authoritative.
+func (s SMTPStatus) Class() int {
+	if s.Enhanced != "" {
+		return int(s.Enhanced[0] - '0')
+	}
+	return s.Code / 100
+}
+
+// Returns true if this status says the message was accepted.
+func (s SMTPStatus) Success() bool {
+	return s.Class() == 2
+}
+
+// Returns true if this status is a temporary failure, i.e. if sending the
+// message again later may succeed.
+func (s SMTPStatus) Temporary() bool {
+	return s.Class() == 4
+}
+
+// Returns true if this status is a permanent failure.
+func (s SMTPStatus) Permanent() bool {
+	return s.Class() == 5
+}
+
+// Returns the text of the reply, its lines joined by spaces.
+func (s SMTPStatus) Text() string {
+	return strings.Join(s.Lines, " ")
+}
+
+// Returns the status as a one-line reply, e.g. "550 5.1.1 No such user".
+func (s SMTPStatus) String() string {
+	var r []string
+	if s.Code != 0 {
+		r = append(r, strconv.Itoa(s.Code))
+	}
+	if s.Enhanced != "" {
+		r = append(r, s.Enhanced)
+	}
+	if t := s.Text(); t != "" {
+		r = append(r, t)
+	}
+	return strings.Join(r, " ")
+}
@@ -0,0 +1,54 @@
+package mail_test
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSMTPStatus(t *testing.T) {
+	for _, c := range []struct {
+		reply  string
+		status string
+		lines  int
+		class  int
+	}{
+		{"550-5.1.1 No such user\r\n550 5.1.1 Check the address\r\n", "550 5.1.1 No such user Check the address", 2, 5},
+		{"550 5.1.1 No such user", "550 5.1.1 No such user", 1, 5},
+		{"451 Try again later", "451 Try again later", 1, 4},
+		{"4.4.1", "4.4.1", 0, 4},
+		{"250", "250", 0, 2},
+		{"999 5.1.1 odd", "999 5.1.1 odd", 1, 0},
+		{"host not found", "host not found", 1, 0},
+	} {
+		s := mail.ParseSMTPStatus(c.reply)
+		testStringEquals(t, c.reply, s.String(), c.status)
+		testIntegerEquals(t, c.reply+" lines", len(s.Lines), c.lines)
+		testIntegerEquals(t, c.reply+" class", s.Class(), c.class)
+	}
+
+	s, ok := mail.SMTPStatusFromError(fmt.Errorf("sending: %w",
+		&textproto.Error{Code: 550, Msg: "5.7.1 Rejected\n5.7.1 See https://example.com/policy"}))
+	if !ok || !s.Permanent() || s.Temporary() {
+		t.Errorf("SMTPStatusFromError = %v, %v", s, ok)
+	}
+	testStringEquals(t, "from error", s.String(), "550 5.7.1 Rejected See https://example.com/policy")
+	if _, ok := mail.SMTPStatusFromError(errors.New("connection refused")); ok {
+		t.Error("a network error has a status")
+	}
+
+	// the enhanced status code of a delivery status notification wins
+	r := mail.RecipientReport{Action: "failed", Status: "4.2.2", Diagnostic: "552 5.2.2 Mailbox full"}
+	testStringEquals(t, "report", r.SMTPStatus().String(), "552 4.2.2 Mailbox full")
+	if r.HardBounce() {
+		t.Error("a temporary failure is a hard bounce")
+	}
+	r = mail.RecipientReport{Action: "failed", Status: "5.4.4", Diagnostic: "host not found"}
+	testStringEquals(t, "not smtp", r.SMTPStatus().String(), "5.4.4 host not found")
+	if !r.HardBounce() {
+		t.Error("a permanent failure is not a hard bounce")
+	}
+}
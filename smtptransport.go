@@ -0,0 +1,138 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+)
+
+// An SMTPTransport sends mail to the SMTP server at Addr, e.g.
+// "smtp.example.com:587". If the server offers STARTTLS, it is used with
+// TLSConfig, or a configuration checking the server's certificate for the
+// host in Addr if TLSConfig is nil. If TLSPolicy is not nil, it decides
+// instead whether TLS is required and how the certificate is verified,
+// based on TLSConfig. If Auth is not nil, the client
+// authenticates. HelloName is the name given in EHLO, "localhost" if
+// empty. Messages are sent with BDAT if the server supports CHUNKING, as
+// SendBDAT() does.
+//
+// Dial connects to the server, net.Dial() if nil; SOCKS5Dialer() and
+// HTTPConnectDialer() connect through proxies. If ProxyHeader is not nil,
+// it is sent first on each connection, as a proxy speaking the PROXY
+// protocol would, e.g. to tell a server in a relay chain whom the message
+// came from.
+//
+// If Transcript is true, each session is recorded, and if sending fails,
+// the error is a TranscriptError holding the transcript, which shows why
+// without a packet capture.
+type SMTPTransport struct {
+	Addr        string
+	HelloName   string
+	TLSConfig   *tls.Config
+	TLSPolicy   *TLSPolicy
+	Auth        smtp.Auth
+	ChunkSize   int
+	Dial        DialFunc
+	ProxyHeader *ProxyHeader
+	Transcript  bool
+}
+
+// Connects to the server, sends \a rfc5322 and disconnects.
+func (t *SMTPTransport) Send(env Envelope, rfc5322 string) error {
+	if !t.Transcript {
+		return t.send(env, rfc5322, nil)
+	}
+	transcript, err := t.SendWithTranscript(env, rfc5322)
+	if err != nil {
+		return &TranscriptError{Err: err, Transcript: transcript}
+	}
+	return nil
+}
+
+// Sends \a rfc5322 as Send() does, and returns the transcript of the SMTP
+// session along with the error, if any. The transcript has one line for each
+// command and reply, prefixed with "C: " or "S: " respectively, and
+// "[TLS started]" where STARTTLS takes effect, so that the rest is in the
+// clear. Credentials given with AUTH are replaced with "[redacted]", and the
+// message itself with its size.
+func (t *SMTPTransport) SendWithTranscript(env Envelope, rfc5322 string) (string, error) {
+	r := &transcriptConn{}
+	err := t.send(env, rfc5322, r)
+	return r.String(), err
+}
+
+// Sends \a rfc5322 as Send() does. If \a r is not nil, the session is
+// recorded in it.
+func (t *SMTPTransport) send(env Envelope, rfc5322 string, r *transcriptConn) error {
+	host, portText, _ := net.SplitHostPort(t.Addr)
+	dial := t.Dial
+	if dial == nil {
+		dial = net.Dial
+	}
+	conn, err := dial("tcp", t.Addr)
+	if err != nil {
+		return err
+	}
+	if t.ProxyHeader != nil {
+		if _, err := conn.Write(t.ProxyHeader.Bytes()); err != nil {
+			conn.Close()
+			return err
+		}
+	}
+	if r != nil {
+		r.Conn = conn
+		conn = r
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer func() { c.Close() }()
+	hello := t.HelloName
+	if hello != "" {
+		if err := c.Hello(hello); err != nil {
+			return err
+		}
+	} else {
+		hello = "localhost"
+	}
+	offered, _ := c.Extension("STARTTLS")
+	config := t.TLSConfig
+	if t.TLSPolicy != nil {
+		port, _ := strconv.Atoi(portText)
+		if config, err = t.TLSPolicy.Config(config, host, port, offered); err != nil {
+			return err
+		}
+	} else if offered && config == nil {
+		config = &tls.Config{ServerName: host}
+	}
+	if offered && config != nil {
+		if r == nil {
+			err = c.StartTLS(config)
+		} else {
+			c, err = r.startTLS(c, config, host, hello)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if t.Auth != nil {
+		auth := t.Auth
+		if r != nil && r.tls {
+			auth = tlsAuth{auth}
+		}
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	chunking, _ := c.Extension("CHUNKING")
+	if err := sendRaw(c, env.From, env.To, rfc5322, chunking, t.ChunkSize); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,111 @@
+package mail
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Matches the first line of legal footers and of the advertisements mail
+// apps append, e.g. "CONFIDENTIALITY NOTICE: This email..." or "Sent from
+// my iPhone".
+var footerLine = regexp.MustCompile(`(?i)^\s*(confidentiality notice|disclaimer\s*:|` +
+	`this (e-?mail|message|communication)( and any (files|attachments)[^.]*)? (is|are|may|contains?) (confidential|privileged|intended)|` +
+	`the information (contained )?in this (e-?mail|message)|` +
+	`sent from my |get outlook for |sent from (mail|yahoo mail) for )`)
+
+// Returns the first \a n characters of the text the author of this message
+// wrote, as a mailbox list shows below the subject, with whitespace
+// simplified. Quoted text and its attribution line, signatures, legal
+// footers, "Sent from my iPhone" and the like are skipped, as are the
+// hidden preheader and other invisible elements of HTML messages, and
+// forwarded or original messages quoted without quote marks.
+//
+// Returns an empty string if the message has no text body.
+func (m *Message) Snippet(n int) string {
+	body := m.DisplayBody(PreferPlain)
+	if body == nil {
+		return ""
+	}
+	var words []string
+	for _, l := range authoredLines(body) {
+		if footerLine.MatchString(l) {
+			break
+		}
+		words = append(words, strings.Fields(l)...)
+	}
+	return truncateRunes(strings.Join(words, " "), n)
+}
+
+// Returns the text of the HTML document \a s which a reader sees, as
+// htmlToText() returns it, but without hidden elements (such as the
+// preheader of a newsletter), quoted messages (blockquotes, and the quotes
+// of Gmail, Yahoo and Thunderbird) or the original message Outlook quotes
+// below a reply.
+func visibleHTMLText(s string) string {
+	var kept []htmlToken
+	skip := ""
+	depth := 0
+	for _, t := range htmlTokenize(s) {
+		if skip != "" {
+			switch {
+			case t.t == htmlStartTagToken && t.tag == skip:
+				depth++
+			case t.t == htmlEndTagToken && t.tag == skip:
+				depth--
+				if depth == 0 {
+					skip = ""
+				}
+			}
+			continue
+		}
+		if t.t == htmlStartTagToken || t.t == htmlSelfClosingTagToken {
+			id, _ := t.attr("id")
+			if id == "divRplyFwdMsg" || id == "appendonsend" {
+				// everything after Outlook's reply header is the
+				// original message
+				break
+			}
+			if t.tag == "blockquote" || t.hasClass("gmail_quote") ||
+				t.hasClass("yahoo_quoted") || t.hasClass("moz-cite-prefix") ||
+				isHiddenHTMLElement(&t) {
+				if t.t == htmlStartTagToken && !isVoidElement(t.tag) {
+					skip, depth = t.tag, 1
+				}
+				continue
+			}
+		}
+		kept = append(kept, t)
+	}
+	return htmlToText(htmlRender(kept))
+}
+
+// Returns true if the element begun by \a t is styled or marked so that
+// it is not displayed, as preheaders are.
+func isHiddenHTMLElement(t *htmlToken) bool {
+	if _, hidden := t.attr("hidden"); hidden {
+		return true
+	}
+	style, _ := t.attr("style")
+	for _, d := range parseCSSDeclarations(style) {
+		v := strings.ToLower(d.value)
+		switch d.property {
+		case "display":
+			if v == "none" {
+				return true
+			}
+		case "visibility":
+			if v == "hidden" {
+				return true
+			}
+		case "mso-hide":
+			if v == "all" {
+				return true
+			}
+		case "opacity", "max-height", "font-size":
+			if strings.TrimRight(v, "px%em") == "0" {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,30 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSnippet(t *testing.T) {
+	plain, _ := mail.ReadMessage("From: bob@example.com\r\nSubject: Re: Lunch\r\n\r\n" +
+		"Sure,   noon works.\r\nSee you there.\r\n\r\nOn Mon, 5 Oct 2026, Alice wrote:\r\n" +
+		"> Lunch?\r\n\r\nSent from my iPhone\r\n")
+	testStringEquals(t, "plain", plain.Snippet(100), "Sure, noon works. See you there.")
+	testStringEquals(t, "truncated", plain.Snippet(10), "Sure, noon")
+
+	html, _ := mail.ReadMessage("From: news@example.com\r\nSubject: News\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<html><head><title>News</title></head><body>" +
+		"<div style=\"display:none;max-height:0;overflow:hidden\">Preheader <b>text</b></div>" +
+		"<p>Big sale on élan vital</p><p>Today only.</p>" +
+		"<div class=\"gmail_quote\"><div class=\"gmail_attr\">On Mon, Bob wrote:</div>" +
+		"<blockquote>old <blockquote>older</blockquote></blockquote></div>" +
+		"<p>This email and any attachments are confidential.</p></body></html>\r\n")
+	testStringEquals(t, "html", html.Snippet(100), "Big sale on élan vital Today only.")
+
+	outlook, _ := mail.ReadMessage("From: carol@example.com\r\n" +
+		"Content-Type: text/html\r\n\r\n<p>Approved.</p><hr><div id=\"divRplyFwdMsg\">" +
+		"<b>From:</b> Dave</div><div>Please approve</div>\r\n")
+	testStringEquals(t, "outlook", outlook.Snippet(100), "Approved.")
+}
@@ -0,0 +1,148 @@
+package mail
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// A SpillStorage moves the decoded content of large bodyparts out of memory
+// into temporary files, so that a service which scans many large messages
+// at once does not run out of memory.
+//
+// The files are encrypted with a random key which is only held in memory,
+// so the content cannot be read from disk, even if the process crashes
+// before removing them. They are removed by Message.Close(), or failing
+// that, when the bodypart is garbage collected.
+//
+// Bodyparts whose decoded content is larger than Threshold bytes are
+// spilled; embedded messages and text parts are not. Dir is the directory
+// for the files; if empty, the system's temporary directory is used.
+type SpillStorage struct {
+	Threshold int
+	Dir       string
+}
+
+// Returns a new SpillStorage which spills bodyparts larger than
+// \a threshold bytes to the system's temporary directory.
+func NewSpillStorage(threshold int) *SpillStorage {
+	return &SpillStorage{Threshold: threshold}
+}
+
+// Parses \a rfc5322 as ReadMessage() does, spilling each large bodypart
+// as soon as it has been decoded, so that at most one decoded bodypart is
+// held in memory at a time.
+func (s *SpillStorage) ReadMessage(rfc5322 string) (*Message, error) {
+	m := NewMessage()
+	state := &spilling{s: s}
+	root := m.Part
+	root.spilling = state
+	err := m.Parse(rfc5322)
+	root.spilling = nil
+	if err != nil {
+		return m, err
+	}
+	if state.err != nil {
+		m.Close()
+		return nil, state.err
+	}
+	return m, nil
+}
+
+// Moves the content of the large bodyparts of \a m to encrypted temporary
+// files. Afterwards their Data is empty, and Part.Open() must be used to
+// read it.
+func (s *SpillStorage) Spill(m *Message) error {
+	if m.Part == nil {
+		return nil
+	}
+	var err error
+	m.Part.walk(func(p *Part) {
+		if err == nil {
+			err = s.spill(p)
+		}
+	})
+	return err
+}
+
+// Moves the content of \a p to an encrypted temporary file, if it is large
+// enough and neither text, multipart nor an embedded message.
+func (s *SpillStorage) spill(p *Part) error {
+	if p.spill != nil || p.message != nil || p.hasText ||
+		len(p.Parts) > 0 || len(p.Data) <= s.Threshold {
+		return nil
+	}
+	f, err := newSpillFile(s.Dir, p.Data)
+	if err != nil {
+		return err
+	}
+	p.spill = f
+	p.Data = ""
+	return nil
+}
+
+// The state of SpillStorage.ReadMessage() while it parses a message: the
+// storage, and the first error it met.
+type spilling struct {
+	s   *SpillStorage
+	err error
+}
+
+// Spills \a bp, which parseBodypart() has just decoded, if the message is
+// being read by a SpillStorage.
+func (p *Part) spillDecoded(bp *Part) {
+	for q := p; q != nil; q = q.parent {
+		if q.spilling != nil {
+			if q.spilling.err == nil {
+				q.spilling.err = q.spilling.s.spill(bp)
+			}
+			return
+		}
+	}
+}
+
+// Returns the decoded content of this bodypart, reading it through Open()
+// if it was spilled.
+func (p *Part) data() (string, error) {
+	if p.spill == nil {
+		return p.Data, nil
+	}
+	r, err := p.Open()
+	if err != nil {
+		return "", err
+	}
+	defer r.Close()
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
+// Returns a reader for the decoded content of this bodypart, whether it is
+// held in memory or has been spilled to a file by a SpillStorage. For text
+// parts, this is the text in UTF-8. The reader must be closed.
+func (p *Part) Open() (io.ReadCloser, error) {
+	if p.spill != nil {
+		return p.spill.open()
+	}
+	if p.hasText {
+		return ioutil.NopCloser(strings.NewReader(p.Text)), nil
+	}
+	return ioutil.NopCloser(strings.NewReader(p.Data)), nil
+}
+
+// Removes the temporary files holding the content of this message's
+// bodyparts, if any were spilled. The bodyparts' content cannot be read
+// afterwards.
+func (m *Message) Close() error {
+	if m.Part == nil {
+		return nil
+	}
+	var err error
+	m.Part.walk(func(p *Part) {
+		if p.spill != nil {
+			if e := p.spill.remove(); e != nil && err == nil {
+				err = e
+			}
+		}
+	})
+	return err
+}
@@ -0,0 +1,158 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSpillStorage(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "See attached.\n"
+	big := strings.Repeat("0123456789abcdef", 10000)
+	c.Attach("big.bin", "application/octet-stream", big)
+	c.Attach("small.bin", "application/octet-stream", "small")
+	composed, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := mail.NewSpillStorage(1024)
+	s.Dir = dir
+	msg, err := s.ReadMessage(composed.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, _ := ioutil.ReadDir(dir)
+	testIntegerEquals(t, "spill files", len(files), 1)
+	onDisk, _ := ioutil.ReadFile(filepath.Join(dir, files[0].Name()))
+	if bytes.Contains(onDisk, []byte("0123456789abcdef")) {
+		t.Error("spilled content is stored in plaintext")
+	}
+
+	part := msg.Parts[1]
+	testStringEquals(t, "data in memory", part.Data, "")
+	testIntegerEquals(t, "size", part.Size(), len(big))
+	r, err := part.Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != big {
+		t.Errorf("spilled content read back wrongly (%d bytes)", len(b))
+	}
+	testStringEquals(t, "small part", msg.Parts[2].Data, "small")
+
+	// serializing reads the spilled content back
+	parsed, _ := mail.ReadMessage(composed.RFC822(false))
+	testStringEquals(t, "rfc822", msg.RFC822(false), parsed.RFC822(false))
+	var out bytes.Buffer
+	if _, err := msg.WriteTo(&out); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "written", out.String(), parsed.RFC822(false))
+
+	// as does an embedded message whose attachment was spilled
+	outer := mail.NewComposer()
+	outer.Header.Add("From", "carol@example.com")
+	outer.Text = "Forwarded.\n"
+	outer.Attach("fwd.eml", "message/rfc822", composed.RFC822(false))
+	forward, err := outer.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fwd, err := s.ReadMessage(forward.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, _ = ioutil.ReadDir(dir)
+	testIntegerEquals(t, "spill files with forward", len(files), 2)
+	parsed, _ = mail.ReadMessage(forward.RFC822(false))
+	testStringEquals(t, "forwarded", fwd.RFC822(false), parsed.RFC822(false))
+	fwd.Close()
+
+	if err := msg.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files, _ = ioutil.ReadDir(dir)
+	testIntegerEquals(t, "spill files after close", len(files), 0)
+	if _, err := part.Open(); err == nil {
+		t.Error("spilled part readable after Close")
+	}
+	if _, err := msg.WriteTo(ioutil.Discard); err == nil {
+		t.Error("message written without its spilled content")
+	}
+}
+
+func TestSpilledContent(t *testing.T) {
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "See attached.\n"
+	rtf := "{\\rtf1 " + strings.Repeat("Quarterly figures. ", 200) + "}"
+	c.Attach("report.rtf", "application/rtf", rtf)
+	composed, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := composed.RFC822(false)
+
+	dir, err := ioutil.TempDir("", "spill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := mail.NewSpillStorage(1024)
+	s.Dir = dir
+	msg, err := s.ReadMessage(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer msg.Close()
+	parsed, _ := mail.ReadMessage(text)
+
+	// everything which reads the content sees the spilled content
+	part := msg.Parts[1]
+	testStringEquals(t, "data in memory", part.Data, "")
+	testStringEquals(t, "checksum", part.Checksum(), parsed.Parts[1].Checksum())
+	if changes := mail.Compare(msg, parsed); len(changes) != 0 {
+		t.Errorf("spilled message differs: %v", changes)
+	}
+	if !part.IsRTF() {
+		t.Error("spilled RTF not recognised")
+	}
+	testStringEquals(t, "plain text", part.PlainText(), parsed.Parts[1].PlainText())
+
+	// moving it into a blob store removes the spill file
+	blobs, err := mail.NewBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := blobs.Store(msg, 1024); err != nil {
+		t.Fatal(err)
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "mail-spill-*"))
+	testIntegerEquals(t, "spill files after Store", len(files), 0)
+	if err := blobs.Load(msg); err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "loaded", msg.Parts[1].Data, rtf)
+}
@@ -0,0 +1,170 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"runtime"
+	"sync"
+)
+
+// The amount of plaintext encrypted as one unit in a spill file.
+const spillChunkSize = 64 * 1024
+
+// A spillFile is the encrypted content of one bodypart. The content is
+// encrypted in chunks of spillChunkSize bytes with AES-256-GCM, each with
+// its index as nonce, and the last marked as such, so that chunks cannot be
+// reordered or truncated unnoticed.
+type spillFile struct {
+	mu      sync.Mutex
+	path    string
+	aead    cipher.AEAD
+	size    int
+	removed bool
+}
+
+// Returns a new spillFile in \a dir holding \a data.
+func newSpillFile(dir, data string) (*spillFile, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	tmp, err := ioutil.TempFile(dir, "mail-spill-")
+	if err != nil {
+		return nil, err
+	}
+	f := &spillFile{path: tmp.Name(), aead: aead, size: len(data)}
+	runtime.SetFinalizer(f, func(f *spillFile) { f.remove() })
+
+	buf := make([]byte, 0, spillChunkSize+aead.Overhead())
+	for i := 0; i*spillChunkSize < len(data) || i == 0; i++ {
+		end := (i + 1) * spillChunkSize
+		if end > len(data) {
+			end = len(data)
+		}
+		chunk := []byte(data[i*spillChunkSize : end])
+		buf = aead.Seal(buf[:0], f.nonce(i), chunk, f.additionalData(i))
+		if _, err = tmp.Write(buf); err != nil {
+			break
+		}
+	}
+	if e := tmp.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		f.remove()
+		return nil, err
+	}
+	return f, nil
+}
+
+// Returns the number of chunks in the file.
+func (f *spillFile) chunks() int {
+	if f.size == 0 {
+		return 1
+	}
+	return (f.size + spillChunkSize - 1) / spillChunkSize
+}
+
+// Returns the nonce for chunk \a i.
+func (f *spillFile) nonce(i int) []byte {
+	n := make([]byte, f.aead.NonceSize())
+	binary.BigEndian.PutUint64(n[len(n)-8:], uint64(i))
+	return n
+}
+
+// Returns the additional data for chunk \a i, which marks the last chunk.
+func (f *spillFile) additionalData(i int) []byte {
+	if i == f.chunks()-1 {
+		return []byte{1}
+	}
+	return []byte{0}
+}
+
+// Returns a reader for the decrypted content.
+func (f *spillFile) open() (io.ReadCloser, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.removed {
+		return nil, errors.New("mail: spilled bodypart was closed")
+	}
+	file, err := os.Open(f.path)
+	if err != nil {
+		return nil, err
+	}
+	return &spillReader{f: f, file: file}, nil
+}
+
+// Removes the file. It is safe to call remove() more than once.
+func (f *spillFile) remove() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.removed {
+		return nil
+	}
+	f.removed = true
+	runtime.SetFinalizer(f, nil)
+	err := os.Remove(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// A spillReader decrypts a spillFile one chunk at a time.
+type spillReader struct {
+	f     *spillFile
+	file  *os.File
+	chunk int
+	buf   []byte // decrypted, not yet returned
+	raw   []byte
+}
+
+func (r *spillReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.chunk >= r.f.chunks() {
+			return 0, io.EOF
+		}
+		n := spillChunkSize
+		if rest := r.f.size - r.chunk*spillChunkSize; rest < n {
+			n = rest
+		}
+		if cap(r.raw) < n+r.f.aead.Overhead() {
+			r.raw = make([]byte, spillChunkSize+r.f.aead.Overhead())
+		}
+		raw := r.raw[:n+r.f.aead.Overhead()]
+		if _, err := io.ReadFull(r.file, raw); err != nil {
+			return 0, errors.New("mail: spill file truncated: " + err.Error())
+		}
+		plain, err := r.f.aead.Open(raw[:0], r.f.nonce(r.chunk), raw, r.f.additionalData(r.chunk))
+		if err != nil {
+			return 0, errors.New("mail: spill file corrupted")
+		}
+		r.buf = plain
+		r.chunk++
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *spillReader) Close() error {
+	return r.file.Close()
+}
@@ -0,0 +1,229 @@
+package mail
+
+import (
+	"bytes"
+	"io"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Kinds of AttachmentWarning.
+const (
+	// The name hides an executable's extension behind a harmless one, e.g.
+	// "invoice.pdf.exe" or "invoice.pdf      .exe".
+	AttachmentDoubleExtension = "double-extension"
+	// The name contains bidi controls which make it display with another
+	// extension, e.g. "invoice" U+202E "fdp.exe", which displays as
+	// "invoiceexe.pdf".
+	AttachmentBidiOverride = "bidi-override"
+	// The declared content type belongs to another kind of file than the
+	// extension, e.g. "invoice.pdf" declared as application/x-msdownload.
+	AttachmentTypeMismatch = "type-mismatch"
+	// The content is another kind of file than the extension says, e.g. a
+	// Windows program named "invoice.pdf".
+	AttachmentContentMismatch = "content-mismatch"
+)
+
+// An AttachmentWarning says why an attachment may be disguised as another
+// kind of file than it is, typically a program as a document.
+//
+// Part is the part number of the attachment and Filename its name. Kind is
+// one of the Attachment* constants above and is meant for programs; Message
+// is meant for people.
+type AttachmentWarning struct {
+	Part     string `json:"part"`
+	Filename string `json:"filename"`
+	Kind     string `json:"kind"`
+	Message  string `json:"message"`
+}
+
+// The content types of common kinds of file, by extension. A content type
+// listed for no extension here is not compared with extensions, and
+// application/octet-stream, used for any file, is listed for none.
+var extensionTypes = map[string][]string{
+	".pdf":  {"application/pdf"},
+	".doc":  {"application/msword"},
+	".docx": {"application/vnd.openxmlformats-officedocument.wordprocessingml.document"},
+	".xls":  {"application/vnd.ms-excel"},
+	".xlsx": {"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"},
+	".ppt":  {"application/vnd.ms-powerpoint"},
+	".pptx": {"application/vnd.openxmlformats-officedocument.presentationml.presentation"},
+	".odt":  {"application/vnd.oasis.opendocument.text"},
+	".ods":  {"application/vnd.oasis.opendocument.spreadsheet"},
+	".rtf":  {"application/rtf", "text/rtf"},
+	".txt":  {"text/plain"},
+	".csv":  {"text/csv", "text/plain"},
+	".htm":  {"text/html"},
+	".html": {"text/html"},
+	".jpg":  {"image/jpeg"},
+	".jpeg": {"image/jpeg"},
+	".png":  {"image/png"},
+	".gif":  {"image/gif"},
+	".zip":  {"application/zip", "application/x-zip-compressed"},
+	".mp3":  {"audio/mpeg"},
+	".mp4":  {"video/mp4"},
+	".exe": {"application/x-msdownload", "application/x-msdos-program",
+		"application/x-dosexec", "application/vnd.microsoft.portable-executable"},
+	".msi": {"application/x-msi", "application/x-ms-installer"},
+	".jar": {"application/java-archive"},
+	".js":  {"application/javascript", "text/javascript"},
+}
+
+// The signatures with which files of some kinds begin, what they are, and
+// the extensions of those kinds of file.
+var fileSignatures = []struct {
+	signature  string
+	kind       string
+	program    bool
+	extensions []string
+}{
+	{"%PDF-", "a PDF document", false, []string{".pdf"}},
+	{"\x89PNG\r\n\x1a\n", "a PNG image", false, []string{".png"}},
+	{"\xff\xd8\xff", "a JPEG image", false, []string{".jpg", ".jpeg"}},
+	{"GIF8", "a GIF image", false, []string{".gif"}},
+	{"PK\x03\x04", "a ZIP archive", false, []string{".zip", ".docx", ".xlsx", ".pptx",
+		".odt", ".ods", ".jar", ".apk", ".appx"}},
+	{"\xd0\xcf\x11\xe0\xa1\xb1\x1a\xe1", "an OLE compound file", false,
+		[]string{".doc", ".xls", ".ppt", ".msi", ".msg"}},
+	{"MZ", "a Windows program", true, []string{".exe", ".dll", ".scr", ".com", ".cpl",
+		".sys", ".pif", ".vxd"}},
+	{"\x7fELF", "a Linux program", true, nil},
+	{"\xcf\xfa\xed\xfe", "a macOS program", true, nil},
+}
+
+// Returns the warnings about each attachment of this message which may be
+// disguised, in part number order, or an empty slice if there are none.
+// Embedded messages are checked too.
+func (m *Message) AttachmentWarnings() []AttachmentWarning {
+	r := []AttachmentWarning{}
+	if m.Part == nil {
+		return r
+	}
+	var check func(p *Part, number string)
+	check = func(p *Part, number string) {
+		if len(p.Parts) > 0 {
+			for i, c := range p.Parts {
+				check(c, partNumber(number, i+1))
+			}
+			return
+		}
+		r = append(r, p.attachmentWarnings(number)...)
+	}
+	check(m.Part, "")
+	return r
+}
+
+// Returns the warnings about this bodypart, whose part number is \a
+// number, as described for Message.AttachmentWarnings().
+func (p *Part) attachmentWarnings(number string) []AttachmentWarning {
+	var r []AttachmentWarning
+	name := p.Filename()
+	if name == "" {
+		return r
+	}
+	add := func(kind, message string) {
+		r = append(r, AttachmentWarning{Part: number, Filename: name, Kind: kind, Message: message})
+	}
+
+	// the name as it is, rather than as it displays
+	real := strings.Map(func(c rune) rune {
+		if isBidiFormatting(c) || c == 0x200e || c == 0x200f {
+			return -1
+		}
+		return c
+	}, name)
+	ext := strings.ToLower(path.Ext(real))
+	if real != name {
+		add(AttachmentBidiOverride,
+			"the name contains bidi controls which change how it displays; it is really "+
+				real+", a "+ext+" file")
+	}
+
+	if executableExtension(ext) {
+		base := strings.TrimSuffix(real, path.Ext(real))
+		padded := strings.TrimRight(base, " .")
+		inner := strings.ToLower(path.Ext(padded))
+		switch {
+		case extensionTypes[inner] != nil && !executableExtension(inner):
+			add(AttachmentDoubleExtension,
+				"the name "+real+" hides the "+ext+" extension of a program behind "+inner)
+		case len(base)-len(padded) >= 5:
+			add(AttachmentDoubleExtension,
+				"the name "+real+" pushes the "+ext+" extension of a program out of sight with spaces")
+		}
+	}
+
+	if ct := p.contentType(); extensionTypes[ext] != nil {
+		var owners []string
+		matches := false
+		for e, types := range extensionTypes {
+			for _, t := range types {
+				if t == ct {
+					owners = append(owners, e)
+					matches = matches || e == ext
+				}
+			}
+		}
+		sort.Strings(owners)
+		if len(owners) > 0 && !matches {
+			add(AttachmentTypeMismatch, "the name ends in "+ext+", but the content type is "+
+				ct+", which is used for "+strings.Join(owners, ", ")+" files")
+		}
+	}
+
+	if ext != "" {
+		head := p.contentStart(16)
+		for _, s := range fileSignatures {
+			if !strings.HasPrefix(head, s.signature) {
+				continue
+			}
+			matches := false
+			for _, e := range s.extensions {
+				matches = matches || e == ext
+			}
+			if !matches && (s.program || knownSignature(ext)) {
+				add(AttachmentContentMismatch, "the name ends in "+ext+", but the content is "+s.kind)
+			}
+			break
+		}
+	}
+	return r
+}
+
+// Returns true if \a ext, e.g. ".exe", is the lower-case extension of
+// programs or scripts which run when opened.
+func executableExtension(ext string) bool {
+	for _, e := range executableExtensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if files with the extension \a ext begin with one of the
+// fileSignatures.
+func knownSignature(ext string) bool {
+	for _, s := range fileSignatures {
+		for _, e := range s.extensions {
+			if e == ext {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns the first \a n bytes of the decoded content of this bodypart, or
+// less if it is shorter.
+func (p *Part) contentStart(n int) string {
+	rc, err := p.Open()
+	if err != nil {
+		return ""
+	}
+	defer rc.Close()
+	var b bytes.Buffer
+	io.CopyN(&b, rc, int64(n))
+	return b.String()
+}
@@ -0,0 +1,48 @@
+package mail_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestAttachmentWarnings(t *testing.T) {
+	attachment := func(ct, name, content string) string {
+		return "--x\r\n" +
+			"Content-Type: " + ct + "\r\n" +
+			"Content-Disposition: attachment; filename=\"" + name + "\"\r\n" +
+			"Content-Transfer-Encoding: base64\r\n" +
+			"\r\n" +
+			base64.StdEncoding.EncodeToString([]byte(content)) + "\r\n"
+	}
+	m, err := mail.ReadMessage("From: alice@example.com\r\n" +
+		"Subject: Invoices\r\n" +
+		"MIME-Version: 1.0\r\n" +
+		"Content-Type: multipart/mixed; boundary=x\r\n" +
+		"\r\n" +
+		"--x\r\n" +
+		"Content-Type: text/plain\r\n" +
+		"\r\n" +
+		"See attached.\r\n" +
+		attachment("application/pdf", "report.pdf", "%PDF-1.7") +
+		attachment("application/octet-stream", "invoice.pdf.exe", "MZ\x90\x00") +
+		attachment("application/octet-stream", "invoice\u202efdp.exe", "MZ\x90\x00") +
+		attachment("application/x-msdownload", "invoice.pdf", "%PDF-1.7") +
+		attachment("application/pdf", "statement.pdf", "MZ\x90\x00") +
+		attachment("application/octet-stream", "scan.pdf          .scr", "MZ\x90\x00") +
+		"--x--\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	warnings := []string{}
+	for _, w := range m.AttachmentWarnings() {
+		warnings = append(warnings, w.Part+" "+w.Kind)
+	}
+	testStringEquals(t, "warnings", strings.Join(warnings, ", "),
+		"3 double-extension, 4 bidi-override, 5 type-mismatch, 6 content-mismatch, 7 double-extension")
+	if !mail.SuspiciousAttachment()(mail.NewVerdict(m)) {
+		t.Error("expected SuspiciousAttachment() to hold")
+	}
+}
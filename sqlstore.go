@@ -0,0 +1,101 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"io"
+)
+
+// An SQLStore is a MessageStore keeping messages in the table Table
+// ("messages" if empty) of the SQLite database DB, which CreateTable()
+// creates, one row per message holding its ID and its text, compressed as
+// Compression says if it is not nil. Messages are read whether compressed
+// or not, as for a DirStore.
+//
+// The caller opens DB with an SQLite driver of its choice, e.g.
+// github.com/mattn/go-sqlite3 or modernc.org/sqlite; this package imports
+// none.
+type SQLStore struct {
+	DB          *sql.DB
+	Table       string
+	Compression *Compression
+}
+
+// Creates the table of this store if it does not exist yet.
+func (s *SQLStore) CreateTable() error {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	_, err = s.DB.Exec("CREATE TABLE IF NOT EXISTS " + t +
+		" (id TEXT PRIMARY KEY, data BLOB NOT NULL)")
+	return err
+}
+
+func (s *SQLStore) Put(id, rfc5322 string) error {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	b := []byte(rfc5322)
+	if s.Compression != nil {
+		if b, err = s.Compression.compress(b); err != nil {
+			return err
+		}
+	}
+	_, err = s.DB.Exec("INSERT OR REPLACE INTO "+t+" (id, data) VALUES (?, ?)", id, b)
+	return err
+}
+
+// Returns a reader of the message \a id. The compressed text is read into
+// memory, but is decompressed as the reader is read.
+func (s *SQLStore) Open(id string) (io.ReadCloser, error) {
+	t, err := s.table()
+	if err != nil {
+		return nil, err
+	}
+	var b []byte
+	err = s.DB.QueryRow("SELECT data FROM "+t+" WHERE id = ?", id).Scan(&b)
+	if err == sql.ErrNoRows {
+		return nil, ErrNotStored
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s.Compression.NewReader(bytes.NewReader(b))
+}
+
+func (s *SQLStore) Delete(id string) error {
+	t, err := s.table()
+	if err != nil {
+		return err
+	}
+	res, err := s.DB.Exec("DELETE FROM "+t+" WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return ErrNotStored
+	}
+	return nil
+}
+
+// Returns the name of the table, or an error if it is not a plain
+// identifier, which could not be used in a statement as it is.
+func (s *SQLStore) table() (string, error) {
+	t := s.Table
+	if t == "" {
+		return "messages", nil
+	}
+	for i := 0; i < len(t); i++ {
+		c := t[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || i > 0 && c >= '0' && c <= '9') {
+			return "", errors.New("mail: invalid table name " + t)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,55 @@
+//go:build cgo && !tinygo && !mailcore
+// +build cgo,!tinygo,!mailcore
+
+package mail_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSQLStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sqlstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite3", filepath.Join(dir, "mail.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	for _, c := range []*mail.Compression{nil, {}, {Format: mail.CompressZstd}} {
+		s := &mail.SQLStore{DB: db, Compression: c}
+		if err := s.CreateTable(); err != nil {
+			t.Fatal(err)
+		}
+		testMessageStore(t, "sql", s)
+	}
+
+	// rows written uncompressed are still read after compression is set
+	s := &mail.SQLStore{DB: db, Table: "archive"}
+	if err := s.CreateTable(); err != nil {
+		t.Fatal(err)
+	}
+	s.Put("old", "From: alice@example.com\r\nSubject: Old\r\n\r\nHi\r\n")
+	s.Compression = &mail.Compression{Format: mail.CompressZstd}
+	m, err := mail.ReadStoredMessage(s, "old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "old", m.Header.Subject(), "Old")
+
+	bad := &mail.SQLStore{DB: db, Table: "x; DROP TABLE messages"}
+	if err := bad.CreateTable(); err == nil {
+		t.Error("invalid table name accepted")
+	}
+}
@@ -0,0 +1,179 @@
+package mail
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	XMailerFieldName   = "X-Mailer"
+	UserAgentFieldName = "User-Agent"
+)
+
+// A Tally is a value and the number of times it was seen.
+type Tally struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// CorpusStats aggregates header statistics across a corpus of messages,
+// for postmasters who want to know what their mail looks like. Add()
+// counts each message.
+//
+// Senders counts the From addresses, lower-cased, and SenderDomains their
+// domains. Mailers counts the mail programs named in X-Mailer or User-Agent
+// fields, without version numbers, so that e.g. "Microsoft Outlook 16.0"
+// and "Microsoft Outlook 15.0" count as one. Charsets counts the charsets of
+// text bodyparts, and ContentTypes the types of all bodyparts which are
+// neither multiparts nor embedded messages, including those in embedded
+// messages.
+//
+// DKIMEvaluated counts the messages whose topmost Authentication-Results
+// field reports a DKIM result, and DKIMPassed those whose result is "pass".
+// No signatures are verified, so the rates reflect what the receiving
+// server found. TotalSize is the sum of the messages' sizes in bytes.
+type CorpusStats struct {
+	Messages      int            `json:"messages"`
+	TotalSize     int            `json:"totalSize"`
+	Senders       map[string]int `json:"senders"`
+	SenderDomains map[string]int `json:"senderDomains"`
+	Mailers       map[string]int `json:"mailers"`
+	Charsets      map[string]int `json:"charsets"`
+	ContentTypes  map[string]int `json:"contentTypes"`
+	DKIMEvaluated int            `json:"dkimEvaluated"`
+	DKIMPassed    int            `json:"dkimPassed"`
+}
+
+// Returns a new, empty CorpusStats.
+func NewCorpusStats() *CorpusStats {
+	return &CorpusStats{
+		Senders:       map[string]int{},
+		SenderDomains: map[string]int{},
+		Mailers:       map[string]int{},
+		Charsets:      map[string]int{},
+		ContentTypes:  map[string]int{},
+	}
+}
+
+// Returns the statistics for \a messages.
+func CorpusStatistics(messages []*Message) *CorpusStats {
+	s := NewCorpusStats()
+	for _, m := range messages {
+		s.Add(m)
+	}
+	return s
+}
+
+// Counts \a m. Its size is the size of the text it was parsed from, or if it
+// was not parsed, the size of the text RFC822() returns.
+func (s *CorpusStats) Add(m *Message) {
+	if m == nil || m.Header == nil {
+		return
+	}
+	s.Messages++
+	if m.RFC822Size > 0 {
+		s.TotalSize += m.RFC822Size
+	} else {
+		s.TotalSize += len(m.RFC822(false))
+	}
+
+	h := m.Header
+	for _, a := range h.Addresses(FromFieldName) {
+		if a.Domain == "" {
+			continue
+		}
+		s.Senders[strings.ToLower(a.lpdomain())]++
+		s.SenderDomains[strings.ToLower(a.Domain)]++
+	}
+	mailer := h.Get(XMailerFieldName)
+	if mailer == "" {
+		mailer = h.Get(UserAgentFieldName)
+	}
+	if f := mailerFingerprint(mailer); f != "" {
+		s.Mailers[f]++
+	}
+	if ar := h.Get(AuthenticationResultsFieldName); ar != "" {
+		if r := strings.Fields(parseKeyValues(ar)["dkim"]); len(r) > 0 {
+			s.DKIMEvaluated++
+			if strings.ToLower(r[0]) == "pass" {
+				s.DKIMPassed++
+			}
+		}
+	}
+
+	if m.Part == nil {
+		return
+	}
+	m.Part.walkLeaves(func(p *Part) {
+		ct := "text/plain"
+		charset := ""
+		if t := p.Header.ContentType(); t != nil {
+			ct = t.Type + "/" + t.Subtype
+			charset = t.parameter("charset")
+		}
+		s.ContentTypes[ct]++
+		if strings.HasPrefix(ct, "text/") {
+			if charset == "" {
+				charset = "us-ascii"
+			}
+			s.Charsets[strings.ToLower(charset)]++
+		}
+	})
+}
+
+// Returns the average size of the messages counted, in bytes, or 0 if there
+// are none.
+func (s *CorpusStats) AverageSize() float64 {
+	if s.Messages == 0 {
+		return 0
+	}
+	return float64(s.TotalSize) / float64(s.Messages)
+}
+
+// Returns the proportion of DKIMEvaluated messages whose DKIM result was
+// "pass", from 0 to 1, or 0 if there are none.
+func (s *CorpusStats) DKIMPassRate() float64 {
+	if s.DKIMEvaluated == 0 {
+		return 0
+	}
+	return float64(s.DKIMPassed) / float64(s.DKIMEvaluated)
+}
+
+// Returns the \a n most common values in \a counts, e.g. CorpusStats.Senders,
+// most common first and in alphabetical order if equally common. Returns all
+// values if \a n is 0 or negative.
+func Top(counts map[string]int, n int) []Tally {
+	r := make([]Tally, 0, len(counts))
+	for v, c := range counts {
+		r = append(r, Tally{Value: v, Count: c})
+	}
+	sort.Slice(r, func(i, j int) bool {
+		if r[i].Count != r[j].Count {
+			return r[i].Count > r[j].Count
+		}
+		return r[i].Value < r[j].Value
+	})
+	if n > 0 && len(r) > n {
+		r = r[:n]
+	}
+	return r
+}
+
+// Returns the name of the mail program in the X-Mailer or User-Agent value
+// \a v, without comments and version numbers, e.g. "Apple Mail" for
+// "Apple Mail (2.3654.120.0.1.13)" or "Mozilla Thunderbird" for
+// "Mozilla/5.0 Thunderbird/91.4.0".
+func mailerFingerprint(v string) string {
+	words := []string{}
+	for _, w := range strings.Fields(stripcomments(v)) {
+		if slash := strings.IndexByte(w, '/'); slash >= 0 {
+			w = w[:slash]
+		}
+		version := strings.TrimPrefix(strings.ToLower(w), "v")
+		if version == "" || strings.Trim(version, "0123456789.-") == "" {
+			continue
+		}
+		words = append(words, w)
+	}
+	return strings.Join(words, " ")
+}
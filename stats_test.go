@@ -0,0 +1,60 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestCorpusStats(t *testing.T) {
+	var messages []*mail.Message
+	for _, s := range []string{
+		"From: Alice <Alice@Example.com>\r\n" +
+			"X-Mailer: Microsoft Outlook 16.0\r\n" +
+			"Authentication-Results: mx.example.net; dkim=pass header.d=example.com; spf=pass\r\n" +
+			"\r\nHello\r\n",
+		"From: alice@example.com\r\n" +
+			"X-Mailer: Microsoft Outlook 15.0 (build 4711)\r\n" +
+			"Authentication-Results: mx.example.net; dkim=fail (bad signature) header.d=example.com\r\n" +
+			"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+			"\r\nHello\r\n",
+		"From: bob@example.org\r\n" +
+			"User-Agent: Mozilla/5.0 (X11; Linux x86_64) Thunderbird/91.4.0\r\n" +
+			"Authentication-Results: mx.example.net; spf=pass\r\n" +
+			"MIME-Version: 1.0\r\n" +
+			"Content-Type: multipart/mixed; boundary=b\r\n" +
+			"\r\n--b\r\nContent-Type: text/plain; charset=utf-8\r\n\r\nHall\xc3\xa5\r\n" +
+			"--b\r\nContent-Type: image/png\r\nContent-Transfer-Encoding: base64\r\n\r\niVBORw==\r\n" +
+			"--b--\r\n",
+	} {
+		m, err := mail.ReadMessage(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, m)
+	}
+	s := mail.CorpusStatistics(messages)
+	testIntegerEquals(t, "messages", s.Messages, 3)
+	top := mail.Top(s.Senders, 1)
+	testIntegerEquals(t, "top senders", len(top), 1)
+	testStringEquals(t, "top sender", top[0].Value, "alice@example.com")
+	testIntegerEquals(t, "top sender count", top[0].Count, 2)
+	testIntegerEquals(t, "example.org", s.SenderDomains["example.org"], 1)
+	testIntegerEquals(t, "outlook", s.Mailers["Microsoft Outlook"], 2)
+	testIntegerEquals(t, "thunderbird", s.Mailers["Mozilla Thunderbird"], 1)
+	testIntegerEquals(t, "us-ascii", s.Charsets["us-ascii"], 1)
+	testIntegerEquals(t, "iso-8859-1", s.Charsets["iso-8859-1"], 1)
+	testIntegerEquals(t, "utf-8", s.Charsets["utf-8"], 1)
+	testIntegerEquals(t, "image/png", s.ContentTypes["image/png"], 1)
+	testIntegerEquals(t, "dkim evaluated", s.DKIMEvaluated, 2)
+	if s.DKIMPassRate() != 0.5 {
+		t.Errorf("dkim pass rate %v", s.DKIMPassRate())
+	}
+	total := 0
+	for _, m := range messages {
+		total += m.RFC822Size
+	}
+	if s.AverageSize() != float64(total)/3 {
+		t.Errorf("average size %v", s.AverageSize())
+	}
+}
@@ -2,8 +2,10 @@ package mail
 
 import (
 	"bytes"
+	"io/ioutil"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 
 	"github.com/paulrosania/go-charset/charset"
 	_ "github.com/paulrosania/go-charset/data"
@@ -96,6 +98,9 @@ func simplify(str string) string {
 		}
 		i++
 	}
+	if first == len(str) {
+		return ""
+	}
 
 	// scan on to find the last nonwhitespace character and detect any
 	// sequences of two or more whitespace characters within the
@@ -173,7 +178,60 @@ func stripcomments(s string) string {
 // to typical mail header practice: Letters following digits and other letters
 // are lower-cased. Other letters are upper-cased (notably including the very
 // first character).
+//
+// The names of common fields are looked up in canonicalNames, so that
+// parsing a header allocates no new string for them, and every field with
+// the same name shares one.
 func headerCase(str string) string {
+	if c, ok := canonicalNames[str]; ok {
+		return c
+	}
+	c := makeHeaderCase(str)
+	if s, ok := canonicalNames[c]; ok {
+		return s
+	}
+	return c
+}
+
+// The canonical form of the names of common fields, keyed by that form, its
+// lower-case form and the spelling of the FieldName constant. It is filled
+// in once and only read after that, so it needs no lock.
+var canonicalNames map[string]string
+
+// Names whose standard spelling is not what makeHeaderCase() makes of them,
+// e.g. DKIM-Signature rather than Dkim-Signature. They are written as
+// spelled here, since some receivers match them case-sensitively.
+var spelledNames = []string{
+	ARCSealFieldName, ARCMessageSignatureFieldName,
+	ARCAuthenticationResultsFieldName, ReceivedSPFFieldName, "DKIM-Signature",
+}
+
+func init() {
+	names := append([]string{
+		AuthenticationResultsFieldName,
+		ListPostFieldName, ListArchiveFieldName, ListUnsubscribeFieldName,
+		ListUnsubscribePostFieldName, PrecedenceFieldName, XMailerFieldName,
+		UserAgentFieldName, XSpamStatusFieldName,
+		XSpamFlagFieldName, XSpamScoreFieldName,
+		ThreadTopicFieldName, ThreadIndexFieldName, "Delivered-To", "X-Original-To",
+		"X-Priority", "Importance", "Auto-Submitted",
+	}, fieldNames...)
+	canonicalNames = make(map[string]string, 3*(len(names)+len(spelledNames)))
+	for _, n := range names {
+		c := makeHeaderCase(n)
+		canonicalNames[n] = c
+		canonicalNames[c] = c
+		canonicalNames[strings.ToLower(n)] = c
+	}
+	for _, n := range spelledNames {
+		canonicalNames[n] = n
+		canonicalNames[makeHeaderCase(n)] = n
+		canonicalNames[strings.ToLower(n)] = n
+	}
+}
+
+// Does the work of headerCase() for names which are not in canonicalNames.
+func makeHeaderCase(str string) string {
 	var buf bytes.Buffer
 	i := 0
 	u := true
@@ -736,6 +794,17 @@ func decode(s string, enc string) (string, error) {
 	return buf.String(), err
 }
 
+// Returns \a s, which is text in the character set \a cs, converted to
+// UTF-8.
+func toUnicode(s string, cs string) (string, error) {
+	r, err := charset.NewReader(cs, strings.NewReader(s))
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	return string(b), err
+}
+
 // Do RFC 2047 decoding of \a s, totally ignoring what the encoded-text in \a s
 // contains.
 //
@@ -805,10 +874,12 @@ func encodePhrase(s string) string {
 	buf := bytes.NewBuffer(make([]byte, 0, len(s)))
 	words := strings.Split(simplify(s), " ")
 
-	for i := 0; i < len(words); i++ {
+	i := 0
+	for i < len(words) {
 		w := words[i]
+		i++
 
-		if i > 0 {
+		if buf.Len() > 0 {
 			buf.WriteByte(' ')
 		}
 
@@ -819,7 +890,7 @@ func encodePhrase(s string) string {
 				w += " " + words[i]
 				i++
 			}
-			buf.WriteString(encodeWord(words[i]))
+			buf.WriteString(encodeWord(w))
 		}
 	}
 
@@ -830,11 +901,25 @@ func encodePhrase(s string) string {
 func encodeText(s string) string {
 	r := []string{}
 	ws := strings.Split(s, " ")
-	for i := 0; i < len(ws); i++ {
+	for i := 0; i < len(ws); {
 		l := []string{}
-		for i < len(ws) && !isAscii(ws[i]) {
-			l = append(l, ws[i])
-			i++
+		for i < len(ws) {
+			if !isAscii(ws[i]) {
+				l = append(l, ws[i])
+				i++
+				continue
+			}
+			// whitespace between encoded-words is ignored, so extra
+			// spaces between two of them must go inside
+			j := i
+			for j < len(ws) && ws[j] == "" {
+				j++
+			}
+			if len(l) == 0 || j == i || j == len(ws) || isAscii(ws[j]) {
+				break
+			}
+			l = append(l, ws[i:j]...)
+			i = j
 		}
 		if len(l) > 0 {
 			r = append(r, encodeWord(strings.Join(l, " ")))
@@ -847,51 +932,37 @@ func encodeText(s string) string {
 	return strings.Join(r, " ")
 }
 
-// This static function returns an RFC 2047 encoded-word representing \a w.
+// This static function returns an RFC 2047 encoded-word representing \a w,
+// or several separated by spaces if one would be too long. Text is always
+// encoded as UTF-8; base64 encoded-words are split between characters.
 func encodeWord(w string) string {
 	if w == "" {
 		return ""
 	}
 
-	return w
-	/*
-		// FIXME: encode properly
-		//Codec * c = Codec::byString( w );
-		//EString cw( c->fromUnicode( w ) );
-		cw := w
-
-		buf := bytes.NewBuffer(make([]byte, 0, len(w)))
-		buf.WriteString("=?")
-		buf.WriteString(c.name())
-		buf.WriteString("?")
-		t := buf.String()
-		qp := eQP(cw, true)
-		b64 := e64(cw)
-		if len(qp) <= len(b64)+3 &&
-			len(t)+len(qp) <= 73 {
-			buf.WriteString("q?")
-			buf.WriteString(qp)
-			buf.WriteString("?=")
-			t += buf.String() // FIXME: verify append is correct here, first half of buffer should already be in `t`
-		} else {
-			prefix := t + "b?"
-			t = ""
-			for b64 != "" {
-				allowed := 73 - len(prefix)
-				allowed = 4 * (allowed / 4)
-				word := prefix
-				word += b64[:allowed]
-				word += "?="
-				b64 = b64[allowed:]
-				t += word
-				if b64 != "" {
-					t += " "
-				}
+	t := "=?utf-8?"
+	qp := eQP(w, true, false)
+	b64 := e64(w, 0)
+	if len(qp) <= len(b64)+3 && len(t)+len(qp) <= 73 {
+		return t + "q?" + qp + "?="
+	}
+
+	prefix := t + "b?"
+	// at most this many bytes fit in each encoded-word
+	allowed := 3 * ((73 - len(prefix)) / 4)
+	words := []string{}
+	for w != "" {
+		n := len(w)
+		if n > allowed {
+			n = allowed
+			for n > 0 && !utf8.RuneStart(w[n]) {
+				n--
 			}
 		}
-
-		return t
-	*/
+		words = append(words, prefix+e64(w[:n], 0)+"?=")
+		w = w[n:]
+	}
+	return strings.Join(words, " ")
 }
 
 // Returns true if this string contains only tab, cr, lf and printable ASCII
@@ -1063,8 +1134,9 @@ func containsWord(s, w string) bool {
 // space is not.
 //
 // Only space (ASCII 32) is a line-break opportunity. If there are multiple
-// spaces where a line is broken, all the spaces are replaced by a single CRLF.
-// Linefeeds added use CRLF.
+// spaces where a line is broken, the first is replaced by CRLF and the others
+// start the next line, after \a otherPrefix, so that unfolding a header field
+// wrapped with a prefix of " " restores them. Linefeeds added use CRLF.
 func wrap(s string, linelength int, firstPrefix, otherPrefix string, spaceAtEOL bool) string {
 	buf := bytes.NewBuffer(make([]byte, 0, len(s)))
 	buf.WriteString(firstPrefix)
@@ -1089,10 +1161,9 @@ func wrap(s string, linelength int, firstPrefix, otherPrefix string, spaceAtEOL
 			for space > 0 && buf.String()[space-1] == ' ' {
 				space--
 			}
+			// the first space becomes the line break, the others
+			// move to the next line
 			linestart = space + 1
-			for linestart < buf.Len() && buf.String()[linestart] == ' ' {
-				linestart++
-			}
 			move.Truncate(0)
 			if buf.Len() > linestart {
 				move.WriteString(buf.String()[linestart:])
@@ -1109,3 +1180,15 @@ func wrap(s string, linelength int, firstPrefix, otherPrefix string, spaceAtEOL
 	}
 	return buf.String()
 }
+
+// Returns the first \a n characters of \a s, or all of \a s if it is no
+// longer than that.
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
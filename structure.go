@@ -0,0 +1,135 @@
+package mail
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+)
+
+// Returns the MIME structure of this message as an indented tree, one line
+// per bodypart, for debugging. Each line gives the part number, the
+// content type and, where present, the charset, filename,
+// Content-Transfer-Encoding, decoded size and Content-Id, e.g.:
+//
+//	multipart/mixed
+//	|-- 1 text/plain; charset=utf-8, quoted-printable, 120 bytes
+//	`-- 2 message/rfc822, "Re: Lunch"
+//	    `-- 2.1 image/png, "map.png", base64, 4711 bytes, <map@example.com>
+//
+// The parts of embedded messages are numbered as in IMAP.
+func (m *Message) StructureString() string {
+	if m.Part == nil {
+		return ""
+	}
+	var buf bytes.Buffer
+	buf.WriteString(m.Part.structureLabel(", "))
+	buf.WriteString("\n")
+	m.Part.appendStructure(&buf, "", "")
+	return buf.String()
+}
+
+// Returns the MIME structure of this message as a graph in the DOT language
+// of graphviz, with one node per bodypart, labelled as by StructureString().
+// "dot -Tsvg" renders it.
+func (m *Message) StructureDot() string {
+	var buf bytes.Buffer
+	buf.WriteString("digraph message {\n")
+	buf.WriteString("\tnode [shape=box, fontname=\"monospace\"];\n")
+	if m.Part != nil {
+		m.Part.appendDot(&buf, "")
+	}
+	buf.WriteString("}\n")
+	return buf.String()
+}
+
+// Returns the children of this bodypart as shown by StructureString(): its
+// own, or if it is an embedded message with a single-part body, that body.
+func (p *Part) structureChildren() []*Part {
+	if len(p.Parts) > 0 {
+		return p.Parts
+	}
+	if p.message != nil && p.message.Part != nil {
+		return []*Part{p.message.Part}
+	}
+	return nil
+}
+
+// Appends a line to \a buf for each descendant of this bodypart, whose part
+// number is \a number, with each line starting with \a indent.
+func (p *Part) appendStructure(buf *bytes.Buffer, number, indent string) {
+	children := p.structureChildren()
+	for i, c := range children {
+		n := partNumber(number, i+1)
+		branch, next := "|-- ", "|   "
+		if i == len(children)-1 {
+			branch, next = "`-- ", "    "
+		}
+		buf.WriteString(indent + branch + n + " " + c.structureLabel(", ") + "\n")
+		c.appendStructure(buf, n, indent+next)
+	}
+}
+
+// Appends a node for this bodypart, whose part number is \a number, and its
+// descendants to \a buf, with an edge from each part to its children.
+func (p *Part) appendDot(buf *bytes.Buffer, number string) {
+	node := dotNode(number)
+	label := p.structureLabel("\n")
+	if number != "" {
+		label = number + "\n" + label
+	}
+	buf.WriteString("\t" + node + " [label=" + dotQuote(label) + "];\n")
+	for i, c := range p.structureChildren() {
+		n := partNumber(number, i+1)
+		c.appendDot(buf, n)
+		buf.WriteString("\t" + node + " -> " + dotNode(n) + ";\n")
+	}
+}
+
+// Returns a description of this bodypart, whose items are separated by
+// \a separator.
+func (p *Part) structureLabel(separator string) string {
+	h := p.Header
+	if h == nil {
+		h = &Header{}
+	}
+	items := []string{"text/plain"}
+	if ct := h.ContentType(); ct != nil {
+		items[0] = ct.Type + "/" + ct.Subtype
+		if cs := ct.parameter("charset"); cs != "" {
+			items[0] += "; charset=" + cs
+		}
+	}
+	if n := p.Filename(); n != "" {
+		items = append(items, strconv.Quote(n))
+	} else if p.message != nil && p.message.Header != nil {
+		if s := p.message.Header.Subject(); s != "" {
+			items = append(items, strconv.Quote(s))
+		}
+	}
+	if cte := h.ContentTransferEncoding(); cte != nil {
+		items = append(items, cte.baseValue)
+	}
+	if len(p.structureChildren()) == 0 {
+		items = append(items, strconv.Itoa(p.Size())+" bytes")
+	}
+	if id := h.Get(ContentIDFieldName); id != "" {
+		items = append(items, id)
+	}
+	return strings.Join(items, separator)
+}
+
+// Returns the DOT node name for part number \a number.
+func dotNode(number string) string {
+	if number == "" {
+		return "message"
+	}
+	return "part_" + strings.Replace(number, ".", "_", -1)
+}
+
+// Returns \a s as a DOT string literal.
+func dotQuote(s string) string {
+	s = strings.Replace(s, "\\", "\\\\", -1)
+	s = strings.Replace(s, "\"", "\\\"", -1)
+	s = strings.Replace(s, "\n", "\\n", -1)
+	return "\"" + s + "\""
+}
@@ -0,0 +1,54 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestStructureString(t *testing.T) {
+	inner := mail.NewComposer()
+	inner.Header.Add("From", "bob@example.com")
+	inner.Header.Add("Subject", "Lunch")
+	inner.Text = "Where?"
+	inner.Attach("map.png", "image/png", "\x89PNG\r\n").ContentID = "map@example.com"
+	im, err := inner.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Text = "See below."
+	c.Attach("lunch.eml", "message/rfc822", im.RFC822(false))
+	c.Attach("", "message/rfc822", "From: bob@example.com\r\nSubject: Dinner\r\n\r\nHi\r\n")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err = mail.ReadMessage(m.RFC822(false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "structure", m.StructureString(),
+		"multipart/mixed\n"+
+			"|-- 1 text/plain, 12 bytes\n"+
+			"|-- 2 message/rfc822, \"lunch.eml\"\n"+
+			"|   |-- 2.1 text/plain, 8 bytes\n"+
+			"|   `-- 2.2 image/png, \"map.png\", base64, 6 bytes, <map@example.com>\n"+
+			"`-- 3 message/rfc822, \"Dinner\"\n"+
+			"    `-- 3.1 text/plain, 4 bytes\n")
+
+	dot := m.StructureDot()
+	for _, s := range []string{
+		"digraph message {\n",
+		"\tmessage [label=\"multipart/mixed\"];\n",
+		"\tpart_2_2 [label=\"2.2\\nimage/png\\n\\\"map.png\\\"\\nbase64\\n6 bytes\\n<map@example.com>\"];\n",
+		"\tpart_2 -> part_2_2;\n",
+		"\tmessage -> part_3;\n",
+	} {
+		if !strings.Contains(dot, s) {
+			t.Errorf("graph does not contain %q:\n%s", s, dot)
+		}
+	}
+}
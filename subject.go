@@ -0,0 +1,148 @@
+package mail
+
+import (
+	"strings"
+)
+
+// Returns the base subject of \a subject, as described in RFC 5256 section
+// 2.1, for grouping messages into threads: \a subject without reply and
+// forward markers such as "Re:", "Fwd:" and "(fwd)", tags in brackets such
+// as "[EXTERNAL]" or "[list-name]", and redundant whitespace. \a subject
+// should be decoded, as Header.Subject() returns it. The result is not
+// lower-cased.
+func BaseSubject(subject string) string {
+	s := strings.Join(strings.Fields(subject), " ")
+	for {
+		// remove trailers
+		for {
+			t := strings.TrimRight(s, " ")
+			if strings.HasSuffix(strings.ToLower(t), "(fwd)") {
+				t = t[:len(t)-5]
+			}
+			if t == s {
+				break
+			}
+			s = t
+		}
+
+		// remove leaders and blobs until none is left
+		for {
+			t := strings.TrimLeft(s, " ")
+			if n := subjectRefwd(t); n > 0 {
+				t = t[n:]
+			} else if n := subjectBlob(t); n > 0 && strings.TrimSpace(t[n:]) != "" {
+				t = t[n:]
+			}
+			if t == s {
+				break
+			}
+			s = t
+		}
+
+		// unwrap "[fwd: ...]"
+		if len(s) > 6 && strings.EqualFold(s[:5], "[fwd:") && s[len(s)-1] == ']' {
+			s = strings.TrimSpace(s[5 : len(s)-1])
+			continue
+		}
+		return s
+	}
+}
+
+// Returns the length of the subj-blob (RFC 5256) at the start of \a s, e.g.
+// "[SPAM] ", including any following whitespace, or 0.
+func subjectBlob(s string) int {
+	if !strings.HasPrefix(s, "[") {
+		return 0
+	}
+	end := strings.IndexAny(s[1:], "[]")
+	if end < 0 || s[1+end] != ']' {
+		return 0
+	}
+	n := end + 2
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// Returns the length of the subj-refwd (RFC 5256) at the start of \a s,
+// e.g. "Re: ", "Fwd[2]:" or "Re: [list] Re: ", including any following
+// whitespace, or 0.
+func subjectRefwd(s string) int {
+	l := strings.ToLower(s)
+	n := 0
+	switch {
+	case strings.HasPrefix(l, "re"):
+		n = 2
+	case strings.HasPrefix(l, "fwd"):
+		n = 3
+	case strings.HasPrefix(l, "fw"):
+		n = 2
+	default:
+		return 0
+	}
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	n += subjectBlob(s[n:])
+	if n >= len(s) || s[n] != ':' {
+		return 0
+	}
+	n++
+	for n < len(s) && s[n] == ' ' {
+		n++
+	}
+	return n
+}
+
+// Returns true if \a tag occurs among the leading reply markers and tags
+// of \a subject, compared case-insensitively, so that e.g. "[EXTERNAL]" is
+// found in "Re: [external] Lunch" but not in "Lunch [EXTERNAL]".
+func hasSubjectTag(subject, tag string) bool {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	s := strings.ToLower(strings.Join(strings.Fields(subject), " "))
+	for s != "" {
+		if strings.HasPrefix(s, tag) {
+			return true
+		}
+		if n := subjectRefwd(s); n > 0 {
+			s = s[n:]
+		} else if n := subjectBlob(s); n > 0 {
+			s = s[n:]
+		} else {
+			return false
+		}
+	}
+	return false
+}
+
+// Returns a Transform which prepends \a tag, e.g. "[EXTERNAL]" or "[SPAM]",
+// to the Subject of a message, unless the tag is already among its leading
+// reply markers and tags. The comparison is made on the decoded subject, so
+// a tag inside an RFC 2047 encoded-word is found, and applying the
+// Transform twice changes nothing. Since tags in brackets are not part of
+// the BaseSubject(), tagging does not affect threading.
+//
+// A message without a Subject gets one consisting of the tag.
+func TagSubject(tag string) Transform {
+	tag = strings.TrimSpace(tag)
+	return func(m *Message) error {
+		f := m.Header.field(SubjectFieldName, 0)
+		if f == nil {
+			m.Header.addField(&HeaderField{name: SubjectFieldName, value: tag})
+			return nil
+		}
+		hf, ok := f.(*HeaderField)
+		if !ok || hasSubjectTag(hf.value, tag) {
+			return nil
+		}
+		if hf.value == "" {
+			hf.value = tag
+		} else {
+			hf.value = tag + " " + hf.value
+		}
+		// the field no longer looks like its source
+		hf.source = ""
+		return nil
+	}
+}
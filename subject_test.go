@@ -0,0 +1,68 @@
+package mail_test
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestBaseSubject(t *testing.T) {
+	for _, c := range [][2]string{
+		{"Hello", "Hello"},
+		{"Re: Hello", "Hello"},
+		{"RE: Fwd: re:  Hello  world (fwd)", "Hello world"},
+		{"Re[2]: [EXTERNAL] Re: [list] Hello", "Hello"},
+		{"[fwd: Re: Hello]", "Hello"},
+		{"[SPAM]", "[SPAM]"},
+		{"Hello [SPAM]", "Hello [SPAM]"},
+		{"Fw: Report", "Report"},
+		{"Review", "Review"},
+	} {
+		testStringEquals(t, c[0], mail.BaseSubject(c[0]), c[1])
+	}
+}
+
+func TestTagSubject(t *testing.T) {
+	tag := mail.TagSubject("[EXTERNAL]")
+	for _, c := range [][2]string{
+		{"Lunch", "[EXTERNAL] Lunch"},
+		{"[EXTERNAL] Lunch", "[EXTERNAL] Lunch"},
+		{"Re: [external] Lunch", "Re: [external] Lunch"},
+		{"Re: [list] [EXTERNAL] Lunch", "Re: [list] [EXTERNAL] Lunch"},
+		{"Lunch [EXTERNAL]", "[EXTERNAL] Lunch [EXTERNAL]"},
+		{"=?utf-8?q?=5BEXTERNAL=5D_Caf=C3=A9?=", "[EXTERNAL] Café"},
+		{"=?utf-8?q?Caf=C3=A9?=", "[EXTERNAL] Café"},
+	} {
+		m, err := mail.ReadMessage("From: alice@example.com\r\nSubject: " + c[0] + "\r\n\r\nHi\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		tag(m)
+		tag(m)
+		testStringEquals(t, c[0], m.Header.Subject(), c[1])
+		testStringEquals(t, c[0]+" base", mail.BaseSubject(m.Header.Subject()),
+			mail.BaseSubject(c[1]))
+	}
+
+	m, _ := mail.ReadMessage("From: alice@example.com\r\nSubject: =?utf-8?q?Caf=C3=A9?=\r\n\r\nHi\r\n")
+	tag(m)
+	if !strings.Contains(m.RFC822(true), "Subject: [EXTERNAL] =?utf-8?") {
+		t.Errorf("tagged subject not encoded:\n%s", m.RFC822(true))
+	}
+
+	long := strings.Repeat("Привет, как дела? ", 6) + "Café_au lait"
+	m, _ = mail.ReadMessage("From: alice@example.com\r\nSubject: =?utf-8?b?" +
+		base64.StdEncoding.EncodeToString([]byte(long)) + "?=\r\n\r\nHi\r\n")
+	tag(m)
+	reparsed, err := mail.ReadMessage(m.RFC822(true))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "long subject", reparsed.Header.Subject(), "[EXTERNAL] "+long)
+
+	m, _ = mail.ReadMessage("From: alice@example.com\r\n\r\nHi\r\n")
+	tag(m)
+	testStringEquals(t, "no subject", m.Header.Subject(), "[EXTERNAL]")
+}
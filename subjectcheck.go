@@ -0,0 +1,166 @@
+package mail
+
+import (
+	"strings"
+	"unicode"
+)
+
+// A SubjectClient is a mail client and the number of characters of a
+// subject it shows in its message list before cutting it off.
+type SubjectClient struct {
+	Name  string
+	Width int
+}
+
+// The clients whose display of subjects AnalyzeSubject() reports, with
+// typical widths at their default settings. Programs may change it.
+var SubjectClients = []SubjectClient{
+	{"Gmail (web)", 70},
+	{"Outlook (desktop)", 55},
+	{"Apple Mail (iPhone)", 41},
+	{"Gmail (Android)", 33},
+}
+
+// Words and phrases which spam filters and recipients commonly take as a
+// sign of spam when they occur in a subject, lower-cased. Programs may
+// change it.
+var SpamTriggerWords = []string{
+	"100% free", "act now", "apply now", "as seen on", "buy now", "cash",
+	"click here", "congratulations", "double your", "earn money", "free",
+	"guarantee", "limited time", "lowest price", "make money", "million",
+	"no cost", "no obligation", "once in a lifetime", "order now",
+	"risk-free", "risk free", "special promotion", "urgent", "winner",
+	"you have been selected", "$$$",
+}
+
+// A SubjectAnalysis describes how a subject will look to recipients and to
+// spam filters, as AnalyzeSubject() finds it.
+//
+// Length is the number of characters as displayed, counting an emoji
+// sequence such as a flag or a family as one. Truncated lists the
+// SubjectClients which cut the subject off. Emoji lists the emoji in the
+// subject, and UnsupportedEmoji those which older clients, such as Outlook
+// on Windows 10, show as empty boxes or as several separate emoji: those
+// added in Unicode 12 or later, and sequences joined with a zero width
+// joiner or modified with a skin tone. TriggerWords lists the
+// SpamTriggerWords found, and Shouting is true if most of the subject's
+// letters are capitals or it has several exclamation marks.
+type SubjectAnalysis struct {
+	Length           int      `json:"length"`
+	Truncated        []string `json:"truncated,omitempty"`
+	Emoji            []string `json:"emoji,omitempty"`
+	UnsupportedEmoji []string `json:"unsupportedEmoji,omitempty"`
+	TriggerWords     []string `json:"triggerWords,omitempty"`
+	Shouting         bool     `json:"shouting,omitempty"`
+}
+
+// Returns an analysis of the decoded subject \a subject.
+func AnalyzeSubject(subject string) SubjectAnalysis {
+	a := SubjectAnalysis{}
+	for _, g := range graphemes(subject) {
+		a.Length++
+		first := []rune(g)[0]
+		if !isEmoji(first) {
+			continue
+		}
+		a.Emoji = append(a.Emoji, g)
+		if strings.ContainsRune(g, '\u200d') || first >= 0x1fa70 ||
+			strings.IndexFunc(g, isSkinTone) >= 0 {
+			a.UnsupportedEmoji = append(a.UnsupportedEmoji, g)
+		}
+	}
+	for _, c := range SubjectClients {
+		if a.Length > c.Width {
+			a.Truncated = append(a.Truncated, c.Name)
+		}
+	}
+	lower := strings.ToLower(subject)
+	for _, w := range SpamTriggerWords {
+		if containsWord(lower, w) {
+			a.TriggerWords = append(a.TriggerWords, w)
+		}
+	}
+	upper, letters := 0, 0
+	for _, r := range subject {
+		if unicode.IsLetter(r) {
+			letters++
+			if unicode.IsUpper(r) {
+				upper++
+			}
+		}
+	}
+	a.Shouting = letters >= 8 && upper*4 > letters*3 ||
+		strings.Count(subject, "!") >= 3
+	return a
+}
+
+// Returns \a s split into the characters a reader sees: a character with
+// the combining marks, variation selectors and skin tone modifiers which
+// follow it, emoji joined by zero width joiners, and pairs of regional
+// indicators (flags) each count as one.
+func graphemes(s string) []string {
+	var r []string
+	joined := false
+	for _, c := range s {
+		n := len(r)
+		switch {
+		case n > 0 && (joined || unicode.Is(unicode.Mn, c) || unicode.Is(unicode.Me, c) ||
+			c >= 0xfe00 && c <= 0xfe0f || isSkinTone(c) || c == '\u200d' ||
+			c >= 0xe0020 && c <= 0xe007f):
+			r[n-1] += string(c)
+		case n > 0 && isRegionalIndicator(c) && len([]rune(r[n-1])) == 1 &&
+			isRegionalIndicator([]rune(r[n-1])[0]):
+			r[n-1] += string(c)
+		default:
+			r = append(r, string(c))
+		}
+		joined = c == '\u200d'
+	}
+	return r
+}
+
+// Returns true if \a c is an emoji skin tone modifier.
+func isSkinTone(c rune) bool {
+	return c >= 0x1f3fb && c <= 0x1f3ff
+}
+
+// Returns true if \a c is a regional indicator, two of which make a flag.
+func isRegionalIndicator(c rune) bool {
+	return c >= 0x1f1e6 && c <= 0x1f1ff
+}
+
+// Returns true if \a c is an emoji, or a symbol which clients commonly
+// show as one.
+func isEmoji(c rune) bool {
+	return c >= 0x1f000 && c <= 0x1faff || c >= 0x2600 && c <= 0x27bf ||
+		c >= 0x2b00 && c <= 0x2bff || c >= 0x2300 && c <= 0x23ff ||
+		c == 0x00a9 || c == 0x00ae || c == 0x203c || c == 0x2049 || c == 0x2122
+}
+
+// Reports problems AnalyzeSubject() finds with the subject of the message.
+func lintSubject(c *lintContext) {
+	h := c.message.Header
+	if h == nil || h.field(SubjectFieldName, 0) == nil {
+		return
+	}
+	a := AnalyzeSubject(h.Subject())
+	if len(a.Truncated) > 0 {
+		c.add(DiagnosticSubjectLength, SeverityInfo,
+			"the subject is %d characters long; %s cut it off",
+			a.Length, strings.Join(a.Truncated, ", "))
+	}
+	if len(a.UnsupportedEmoji) > 0 {
+		c.add(DiagnosticSubjectEmoji, SeverityWarning,
+			"older clients, e.g. Outlook on Windows 10, cannot show %s in the subject",
+			strings.Join(a.UnsupportedEmoji, " "))
+	}
+	if len(a.TriggerWords) > 0 {
+		c.add(DiagnosticSpamTrigger, SeverityWarning,
+			"the subject contains %q, which spam filters count against a message",
+			a.TriggerWords)
+	}
+	if a.Shouting {
+		c.add(DiagnosticSpamTrigger, SeverityWarning,
+			"the subject is mostly capitals or has several exclamation marks")
+	}
+}
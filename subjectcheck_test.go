@@ -0,0 +1,44 @@
+package mail_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSubjectAnalysis(t *testing.T) {
+	a := mail.AnalyzeSubject("Family day 👨‍👩‍👧 in 🇩🇪 – 👍🏽 FREE entry, act now")
+	testIntegerEquals(t, "length", a.Length, 41)
+	testStringEquals(t, "emoji", strings.Join(a.Emoji, " "), "👨‍👩‍👧 🇩🇪 👍🏽")
+	testStringEquals(t, "unsupported", strings.Join(a.UnsupportedEmoji, " "), "👨‍👩‍👧 👍🏽")
+	testStringEquals(t, "triggers", strings.Join(a.TriggerWords, ","), "act now,free")
+	testStringEquals(t, "truncated", strings.Join(a.Truncated, ","), "Gmail (Android)")
+	if a.Shouting {
+		t.Error("not shouting")
+	}
+	if !mail.AnalyzeSubject("LAST CHANCE TO SAVE").Shouting {
+		t.Error("shouting not noticed")
+	}
+	if len(mail.AnalyzeSubject("Freedom of information request").TriggerWords) != 0 {
+		t.Error("trigger word found inside another word")
+	}
+
+	c := mail.NewComposer()
+	c.Header.Add("From", "news@example.com")
+	c.Header.Add("To", "reader@example.com")
+	c.Header.Add("Subject", "Winner! 🫠")
+	c.Text = "Hello\n"
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	custom := func(m *mail.Message) []mail.Diagnostic {
+		return []mail.Diagnostic{{Code: "house-style", Message: "say hi"}}
+	}
+	codes := []string{}
+	for _, d := range m.Lint(custom) {
+		codes = append(codes, d.Code)
+	}
+	testStringEquals(t, "lint", strings.Join(codes, " "), "subject-emoji spam-trigger house-style")
+}
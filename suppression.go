@@ -0,0 +1,81 @@
+package mail
+
+import (
+	"time"
+)
+
+// The reasons for which an address may be suppressed.
+const (
+	SuppressionHardBounce  = "hard-bounce"
+	SuppressionComplaint   = "complaint"
+	SuppressionUnsubscribe = "unsubscribe"
+)
+
+// A Suppression records that mail must no longer be sent to Address, for
+// Reason, which is SuppressionHardBounce, SuppressionComplaint or
+// SuppressionUnsubscribe, since Time. Detail says more, e.g. the status code
+// and the remote server's reply for a bounce.
+type Suppression struct {
+	Address string    `json:"address"`
+	Reason  string    `json:"reason"`
+	Time    time.Time `json:"time"`
+	Detail  string    `json:"detail,omitempty"`
+}
+
+// A SuppressionList holds the addresses to which bulk mail must not be
+// sent: those which bounced permanently, those whose owners complained, and
+// those which unsubscribed. Addresses are compared case-insensitively.
+//
+// Suppress() adds an address, or replaces its entry. Suppressed() returns
+// the entry for an address, or nil if it is not suppressed. Remove() removes
+// an address, e.g. after its owner subscribed again, and does nothing if it
+// is not suppressed.
+type SuppressionList interface {
+	Suppress(s Suppression) error
+	Suppressed(address string) (*Suppression, error)
+	Remove(address string) error
+}
+
+// Records in \a list what \a m, a delivery status notification or feedback
+// report as understood by Message.RecipientReports(), says about hard
+// bounces and complaints, and returns the suppressions added. Other reports,
+// e.g. of delayed delivery, are ignored, so any message received at the
+// bounce address may be passed.
+func SuppressReported(list SuppressionList, m *Message) ([]Suppression, error) {
+	var r []Suppression
+	for _, report := range m.RecipientReports() {
+		s := Suppression{Address: report.Recipient, Time: time.Now().UTC()}
+		switch {
+		case report.HardBounce():
+			s.Reason = SuppressionHardBounce
+			s.Detail = report.SMTPStatus().String()
+		case report.Complaint():
+			s.Reason = SuppressionComplaint
+			s.Detail = "feedback-type " + report.FeedbackType
+		default:
+			continue
+		}
+		if err := list.Suppress(s); err != nil {
+			return r, err
+		}
+		r = append(r, s)
+	}
+	return r, nil
+}
+
+// Returns those of \a recipients which are not suppressed in \a list, in
+// order. A sender of bulk mail should pass the recipients of each message
+// through this first.
+func Unsuppressed(list SuppressionList, recipients []string) ([]string, error) {
+	r := []string{}
+	for _, rcpt := range recipients {
+		s, err := list.Suppressed(rcpt)
+		if err != nil {
+			return nil, err
+		}
+		if s == nil {
+			r = append(r, rcpt)
+		}
+	}
+	return r, nil
+}
@@ -0,0 +1,19 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"net"
+)
+
+// The system's resolver, as used by the functions of package net.
+type systemResolver struct{}
+
+func (systemResolver) LookupTXT(name string) ([]string, error) {
+	return net.LookupTXT(name)
+}
+
+func (systemResolver) LookupMX(name string) ([]*net.MX, error) {
+	return net.LookupMX(name)
+}
@@ -0,0 +1,89 @@
+package mail
+
+import (
+	"time"
+)
+
+// A Tracer starts a Span for each major operation of this package: parsing
+// a message ("mail.parse"), verifying its DKIM signatures
+// ("mail.dkim.verify") and sending it over SMTP ("mail.send"). It is meant
+// to be implemented by an adapter to a tracing system such as OpenTelemetry,
+// and installed as DefaultTracer when the program starts.
+type Tracer interface {
+	Start(operation string) Span
+}
+
+// A Span is an operation in progress. SetAttribute() records e.g. the size
+// of the message, End() finishes it; \a err is the error the operation
+// failed with, or nil.
+type Span interface {
+	SetAttribute(key string, value interface{})
+	End(err error)
+}
+
+// Metrics receives measurements: the duration of each operation in
+// seconds ("mail.parse.duration", "mail.dkim.verify.duration" and
+// "mail.send.duration"), one "mail.parse.errors" etc. of 1 for each
+// operation which failed, the size of each message parsed or sent in bytes
+// ("mail.message.size", with the attribute "operation"), one
+// "mail.dkim.results" of 1 per signature verified, with the attribute
+// "result", e.g. "pass", and the number of messages a MemoryScheduler
+// holds whenever it changes ("mail.queue.depth"). Like Tracer, it is meant
+// to be implemented by an adapter and installed as DefaultMetrics;
+// PrometheusMetrics is one.
+type Metrics interface {
+	Record(name string, value float64, attributes map[string]string)
+}
+
+// The Tracer and Metrics used by this package. Both do nothing unless
+// replaced; they should be replaced before any mail is processed, since they
+// are not protected against concurrent changes.
+var (
+	DefaultTracer  Tracer  = noopTracer{}
+	DefaultMetrics Metrics = noopMetrics{}
+)
+
+type noopTracer struct{}
+
+func (noopTracer) Start(operation string) Span {
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{}) {}
+
+func (noopSpan) End(err error) {}
+
+type noopMetrics struct{}
+
+func (noopMetrics) Record(name string, value float64, attributes map[string]string) {}
+
+// An operation is a traced and measured operation in progress.
+type operation struct {
+	name  string
+	span  Span
+	start time.Time
+}
+
+// Starts the operation \a name, e.g. "mail.parse".
+func startOperation(name string) *operation {
+	return &operation{name: name, span: DefaultTracer.Start(name), start: time.Now()}
+}
+
+// Records that the operation concerns a message of \a size bytes.
+func (o *operation) size(size int) {
+	o.span.SetAttribute("mail.message.size", size)
+	DefaultMetrics.Record("mail.message.size", float64(size),
+		map[string]string{"operation": o.name})
+}
+
+// Ends the operation, which failed with \a err if it is not nil, and
+// records its duration and whether it failed.
+func (o *operation) end(err error) {
+	DefaultMetrics.Record(o.name+".duration", time.Since(o.start).Seconds(), nil)
+	if err != nil {
+		DefaultMetrics.Record(o.name+".errors", 1, nil)
+	}
+	o.span.End(err)
+}
@@ -0,0 +1,80 @@
+package mail_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+type recordingTracer struct {
+	spans []*recordingSpan
+}
+
+type recordingSpan struct {
+	operation  string
+	attributes map[string]interface{}
+	ended      bool
+	err        error
+}
+
+func (t *recordingTracer) Start(operation string) mail.Span {
+	s := &recordingSpan{operation: operation, attributes: map[string]interface{}{}}
+	t.spans = append(t.spans, s)
+	return s
+}
+
+func (s *recordingSpan) SetAttribute(key string, value interface{}) {
+	s.attributes[key] = value
+}
+
+func (s *recordingSpan) End(err error) {
+	s.ended, s.err = true, err
+}
+
+type recordingMetrics map[string]float64
+
+func (m recordingMetrics) Record(name string, value float64, attributes map[string]string) {
+	if r, ok := attributes["result"]; ok {
+		name += "/" + r
+	}
+	m[name] += value
+}
+
+func TestTelemetry(t *testing.T) {
+	tracer := &recordingTracer{}
+	metrics := recordingMetrics{}
+	oldTracer, oldMetrics := mail.DefaultTracer, mail.DefaultMetrics
+	mail.DefaultTracer, mail.DefaultMetrics = tracer, metrics
+	defer func() {
+		mail.DefaultTracer, mail.DefaultMetrics = oldTracer, oldMetrics
+	}()
+
+	text := "From: alice@example.com\r\nSubject: Hi\r\n\r\nHello\r\n"
+	if _, err := mail.ReadMessage(text); err != nil {
+		t.Fatal(err)
+	}
+	v := &mail.DKIMVerifier{LookupTXT: func(name string) ([]string, error) {
+		return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}}
+	v.Verify("DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=s1; h=from;\r\n" +
+		" bh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=AAAA\r\n" + text)
+
+	testIntegerEquals(t, "spans", len(tracer.spans), 2)
+	if len(tracer.spans) == 2 {
+		parse, verify := tracer.spans[0], tracer.spans[1]
+		testStringEquals(t, "parse span", parse.operation, "mail.parse")
+		if !parse.ended || parse.err != nil || parse.attributes["mail.message.size"] != len(text) {
+			t.Errorf("unexpected parse span %+v", parse)
+		}
+		testStringEquals(t, "verify span", verify.operation, "mail.dkim.verify")
+		if verify.attributes["mail.dkim.result"] != "permerror" {
+			t.Errorf("unexpected verify span %+v", verify)
+		}
+	}
+	testIntegerEquals(t, "size", int(metrics["mail.message.size"]), len(text))
+	testIntegerEquals(t, "dkim results", int(metrics["mail.dkim.results/permerror"]), 1)
+	if _, ok := metrics["mail.parse.duration"]; !ok {
+		t.Errorf("expected the parse duration to be recorded")
+	}
+}
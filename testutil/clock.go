@@ -0,0 +1,52 @@
+package testutil
+
+import (
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// A FakeClock is a mail.Clock which stands still until it is told to
+// move, so that dates, DKIM timestamps and retry times come out the same
+// in every test run. It is safe for concurrent use.
+type FakeClock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// Returns a new FakeClock showing \a t, or GoldenDate if \a t is zero.
+func NewFakeClock(t time.Time) *FakeClock {
+	if t.IsZero() {
+		t = GoldenDate
+	}
+	return &FakeClock{now: t}
+}
+
+// Returns the time the clock shows.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Moves the clock forward by \a d, or backward if \a d is negative.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Sets the clock to \a t.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Returns a mail.RandSource which yields the same bytes every time for the
+// same \a seed. It is not safe for concurrent use.
+func NewRandSource(seed int64) mail.RandSource {
+	return rand.New(rand.NewSource(seed))
+}
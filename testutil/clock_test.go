@@ -0,0 +1,61 @@
+package testutil_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestFakeClock(t *testing.T) {
+	clock := testutil.NewFakeClock(time.Time{})
+	compose := func() string {
+		c := mail.NewComposer()
+		c.Clock = clock
+		c.Rand = testutil.NewRandSource(7)
+		c.Header.Add(mail.FromFieldName, "alice@example.com")
+		c.Text = "Hello"
+		c.HTML = "<p>Hello</p>"
+		m, err := c.Compose()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.RFC822(false)
+	}
+	first := compose()
+	if second := compose(); second != first {
+		t.Errorf("composed twice:\n%s\n%s", first, second)
+	}
+	m, err := mail.ReadMessage(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := m.Header.Date(); d == nil || !d.Equal(testutil.GoldenDate) {
+		t.Errorf("Date = %v", d)
+	}
+
+	clock.Advance(time.Hour)
+	if got := clock.Now().Sub(testutil.GoldenDate); got != time.Hour {
+		t.Errorf("advanced by %v", got)
+	}
+	if compose() == first {
+		t.Error("the Date did not follow the clock")
+	}
+	clock.Set(testutil.GoldenDate)
+	if compose() != first {
+		t.Error("the clock was not set back")
+	}
+
+	s := mail.NewMemoryScheduler()
+	s.Clock = clock
+	if _, err := mail.ScheduleMessage(s, m, mail.Envelope{To: []string{"bob@example.com"}}); err != nil {
+		t.Fatal(err)
+	}
+	if due, _ := s.Due(testutil.GoldenDate.Add(-time.Second)); len(due) != 0 {
+		t.Errorf("due before the clock's time: %v", due)
+	}
+	if due, _ := s.Due(testutil.GoldenDate); len(due) != 1 {
+		t.Errorf("not due at the clock's time: %v", due)
+	}
+}
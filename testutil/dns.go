@@ -0,0 +1,55 @@
+package testutil
+
+import (
+	"net"
+	"strings"
+	"sync"
+)
+
+// A Resolver is a mail.Resolver which answers from its maps instead of
+// DNS, e.g. with the DKIM key records of a test. Names are compared
+// case-insensitively and without a trailing dot. Names which are not in a
+// map do not exist. Lookups counts the lookups made, by "TXT name" or
+// "MX name"; it should be read only while no lookups are being made.
+type Resolver struct {
+	TXT map[string][]string
+	MX  map[string][]*net.MX
+
+	mu      sync.Mutex
+	Lookups map[string]int
+}
+
+// Returns the TXT records of \a name.
+func (r *Resolver) LookupTXT(name string) ([]string, error) {
+	key := r.count("TXT", name)
+	for n, txt := range r.TXT {
+		if strings.ToLower(strings.TrimSuffix(n, ".")) == key {
+			return txt, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// Returns the MX records of \a name.
+func (r *Resolver) LookupMX(name string) ([]*net.MX, error) {
+	key := r.count("MX", name)
+	for n, mx := range r.MX {
+		if strings.ToLower(strings.TrimSuffix(n, ".")) == key {
+			return mx, nil
+		}
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+// Records a lookup of type \a kind of \a name, and returns the name as
+// it is compared.
+func (r *Resolver) count(kind, name string) string {
+	name = strings.ToLower(strings.TrimSuffix(name, "."))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.Lookups == nil {
+		r.Lookups = map[string]int{}
+	}
+	r.Lookups[kind+" "+name]++
+	return name
+}
@@ -0,0 +1,48 @@
+package testutil_test
+
+import (
+	"net"
+	"testing"
+
+	"github.com/jimexcel/mail"
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestResolver(t *testing.T) {
+	stub := &testutil.Resolver{
+		TXT: map[string][]string{"s1._domainkey.example.com.": {"v=DKIM1; p="}},
+		MX:  map[string][]*net.MX{"example.com": {{Host: "mx.example.com.", Pref: 10}}},
+	}
+	r := mail.NewCachingResolver(stub)
+	for i := 0; i < 3; i++ {
+		txt, err := r.LookupTXT("S1._domainkey.example.com")
+		if err != nil || len(txt) != 1 {
+			t.Fatalf("expected one TXT record, got %v, %v", txt, err)
+		}
+		if _, err := r.LookupMX("missing.example.com"); err == nil {
+			t.Fatal("expected missing.example.com not to exist")
+		}
+	}
+	mx, err := r.LookupMX("example.com.")
+	if err != nil || len(mx) != 1 {
+		t.Fatalf("expected one MX record, got %v, %v", mx, err)
+	}
+	testutilEquals(t, "TXT lookups", stub.Lookups["TXT s1._domainkey.example.com"], 1)
+	testutilEquals(t, "negative lookups", stub.Lookups["MX missing.example.com"], 1)
+	r.Flush()
+	r.LookupTXT("s1._domainkey.example.com")
+	testutilEquals(t, "lookups after flush", stub.Lookups["TXT s1._domainkey.example.com"], 2)
+
+	// the key record above is revoked, which the verifier finds in the
+	// cache
+	v := &mail.DKIMVerifier{Resolver: r}
+	signed := "DKIM-Signature: v=1; a=rsa-sha256; d=example.com; s=s1; c=relaxed/relaxed;\r\n" +
+		" h=from; bh=47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU=; b=AAAA\r\n" +
+		"From: alice@example.com\r\n\r\n"
+	results := v.Verify(signed)
+	if len(results) != 1 {
+		t.Fatalf("expected one result, got %d", len(results))
+	}
+	testutilEquals(t, "revoked key", results[0].Result, "permerror")
+	testutilEquals(t, "lookups after verifying", stub.Lookups["TXT s1._domainkey.example.com"], 2)
+}
@@ -0,0 +1,202 @@
+package testutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// The Date of built messages unless another is given.
+var GoldenDate = time.Date(2020, time.January, 2, 3, 4, 5, 0, time.UTC)
+
+// A MessageBuilder builds messages for tests. The messages are
+// deterministic: the same calls with the same seed always produce the same
+// text, boundaries and Message-Id included, so they can be compared with
+// golden files.
+//
+// Each method returns the builder, so that calls can be chained:
+//
+//	m := testutil.NewMessageBuilder(1).Subject("Hi").Text("Hello").Build(t)
+//
+// Messages are from alice@example.com to bob@example.com with the subject
+// "Test message" and GoldenDate as date, unless other values are given.
+type MessageBuilder struct {
+	seed        int64
+	from        string
+	to          []string
+	cc          []string
+	subject     string
+	date        time.Time
+	fields      [][2]string
+	text        string
+	html        string
+	attachments []*mail.Attachment
+}
+
+// Returns a new MessageBuilder whose randomness is seeded with \a seed.
+func NewMessageBuilder(seed int64) *MessageBuilder {
+	return &MessageBuilder{
+		seed:    seed,
+		from:    "alice@example.com",
+		to:      []string{"bob@example.com"},
+		subject: "Test message",
+		date:    GoldenDate,
+	}
+}
+
+// Sets the From address to \a from.
+func (b *MessageBuilder) From(from string) *MessageBuilder {
+	b.from = from
+	return b
+}
+
+// Sets the To addresses to \a to.
+func (b *MessageBuilder) To(to ...string) *MessageBuilder {
+	b.to = to
+	return b
+}
+
+// Sets the Cc addresses to \a cc.
+func (b *MessageBuilder) Cc(cc ...string) *MessageBuilder {
+	b.cc = cc
+	return b
+}
+
+// Sets the subject to \a subject.
+func (b *MessageBuilder) Subject(subject string) *MessageBuilder {
+	b.subject = subject
+	return b
+}
+
+// Sets the date to \a date.
+func (b *MessageBuilder) Date(date time.Time) *MessageBuilder {
+	b.date = date
+	return b
+}
+
+// Adds a header field named \a name with value \a value.
+func (b *MessageBuilder) Header(name, value string) *MessageBuilder {
+	b.fields = append(b.fields, [2]string{name, value})
+	return b
+}
+
+// Sets the text/plain body to \a text.
+func (b *MessageBuilder) Text(text string) *MessageBuilder {
+	b.text = text
+	return b
+}
+
+// Sets the text/html body to \a html. With a text body as well, the message
+// has a multipart/alternative body.
+func (b *MessageBuilder) HTML(html string) *MessageBuilder {
+	b.html = html
+	return b
+}
+
+// Attaches \a data as a file named \a filename of type \a contentType.
+func (b *MessageBuilder) Attach(filename, contentType, data string) *MessageBuilder {
+	b.attachments = append(b.attachments,
+		&mail.Attachment{Filename: filename, ContentType: contentType, Data: data})
+	return b
+}
+
+// Attaches \a m as a forwarded message/rfc822 part.
+func (b *MessageBuilder) Forward(m *mail.Message) *MessageBuilder {
+	b.attachments = append(b.attachments, &mail.Attachment{
+		Filename:    "forwarded.eml",
+		ContentType: "message/rfc822",
+		Data:        m.RFC822(false),
+	})
+	return b
+}
+
+// Returns the message's text, or an error if it cannot be composed, e.g.
+// because an address is invalid.
+func (b *MessageBuilder) RFC822() (string, error) {
+	c := mail.NewComposer()
+	c.Rand = NewRandSource(b.seed)
+	h := c.Header
+	h.Add(mail.FromFieldName, b.from)
+	if len(b.to) > 0 {
+		h.Add(mail.ToFieldName, strings.Join(b.to, ", "))
+	}
+	if len(b.cc) > 0 {
+		h.Add(mail.CcFieldName, strings.Join(b.cc, ", "))
+	}
+	h.Add(mail.SubjectFieldName, b.subject)
+	h.Add(mail.DateFieldName, b.date.Format(time.RFC1123Z))
+	for _, f := range b.fields {
+		h.Add(f[0], f[1])
+	}
+	c.Text = b.text
+	c.HTML = b.html
+	c.Attachments = b.attachments
+	m, err := c.Compose()
+	if err != nil {
+		return "", err
+	}
+	return m.RFC822(false), nil
+}
+
+// Returns the message as ReadMessage() parses it, or fails \a t.
+func (b *MessageBuilder) Build(t testing.TB) *mail.Message {
+	t.Helper()
+	s, err := b.RFC822()
+	if err != nil {
+		t.Fatalf("testutil: cannot compose message: %v", err)
+	}
+	m, err := mail.ReadMessage(s)
+	if err != nil {
+		t.Fatalf("testutil: cannot parse composed message: %v", err)
+	}
+	return m
+}
+
+// Returns a builder for a text/plain message.
+func PlainMessage(seed int64) *MessageBuilder {
+	return NewMessageBuilder(seed).Text("Hello Bob,\n\nHow are you?\n\nAlice\n")
+}
+
+// Returns a builder for a multipart/alternative message with text and HTML
+// bodies.
+func AlternativeMessage(seed int64) *MessageBuilder {
+	return PlainMessage(seed).
+		HTML("<p>Hello Bob,</p>\n<p>How are you?</p>\n<p>Alice</p>\n")
+}
+
+// Returns a builder for a multipart/mixed message with a text body, a PDF
+// and a CSV attachment.
+func MixedMessage(seed int64) *MessageBuilder {
+	return PlainMessage(seed).
+		Subject("Quarterly report").
+		Attach("report.pdf", "application/pdf", "%PDF-1.4\n\x00\x01\x02binary\n%%EOF\n").
+		Attach("figures.csv", "text/csv", "quarter,revenue\nQ1,100\nQ2,120\n")
+}
+
+// Returns a builder for a message forwarding a message which forwards
+// another, and so on, \a depth levels deep, with a MixedMessage innermost.
+func ForwardedMessage(seed int64, depth int) (*MessageBuilder, error) {
+	inner, err := MixedMessage(seed).RFC822()
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i <= depth; i++ {
+		m, err := mail.ReadMessage(inner)
+		if err != nil {
+			return nil, err
+		}
+		b := NewMessageBuilder(seed + int64(i)).
+			Subject(strings.Repeat("Fwd: ", i) + "Quarterly report").
+			Text("See below.\n").
+			Forward(m)
+		if i == depth {
+			return b, nil
+		}
+		if inner, err = b.RFC822(); err != nil {
+			return nil, err
+		}
+	}
+	return MixedMessage(seed), nil
+}
@@ -0,0 +1,53 @@
+package testutil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestMessageBuilder(t *testing.T) {
+	a, err := testutil.MixedMessage(7).RFC822()
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := testutil.MixedMessage(7).RFC822()
+	c, _ := testutil.MixedMessage(8).RFC822()
+	testutilEquals(t, "same seed", a, b)
+	if a == c {
+		t.Error("different seeds gave the same message")
+	}
+
+	m := testutil.AlternativeMessage(1).Cc("carol@example.com").Build(t)
+	testutilEquals(t, "alternative", m.Header.Get("Content-Type"),
+		"multipart/alternative; boundary=\"=_9566c74d10037c4d7bbb0407\"")
+	testutilEquals(t, "message-id", m.Header.MessageID(),
+		"<52fdfc072182654f163f5f0f9a621d72@example.com>")
+	testutilEquals(t, "date", m.Header.Get("Date"), "Thu, 02 Jan 2020 03:04:05 +0000")
+	testutilEquals(t, "cc", m.Header.Get("Cc"), "carol@example.com")
+
+	fb, err := testutil.ForwardedMessage(1, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m = fb.Build(t)
+	testutilEquals(t, "outer subject", m.Header.Subject(), "Fwd: Fwd: Quarterly report")
+	attachments := m.Attachments()
+	testutilEquals(t, "outer attachments", len(attachments), 1)
+	text := m.RFC822(false)
+	for _, s := range []string{"Subject: Fwd: Quarterly report\r\n",
+		"Subject: Quarterly report\r\n", "filename=report.pdf"} {
+		if !strings.Contains(text, s) {
+			t.Errorf("forwarded message lacks %q", s)
+		}
+	}
+	testutilEquals(t, "embedded", strings.Count(text, "Content-Type: message/rfc822"), 2)
+}
+
+func testutilEquals(t *testing.T, what string, got, want interface{}) {
+	t.Helper()
+	if got != want {
+		t.Errorf("incorrect %s:\nexpected %#v,\n     got %#v", what, want, got)
+	}
+}
@@ -0,0 +1,332 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+// Package testutil helps applications test code which sends mail, by
+// receiving it in a Sink instead of a real server.
+package testutil
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+)
+
+// A Delivery is a message received by a Sink: its envelope, its text as
+// sent, and the text parsed by mail.ReadMessage().
+type Delivery struct {
+	From    string
+	To      []string
+	Text    string
+	Message *mail.Message
+}
+
+// A Sink is an SMTP or LMTP server listening on a local port, which accepts
+// every message sent to it and keeps it in memory, for integration tests.
+// It supports 8BITMIME, SMTPUTF8 and CHUNKING, but neither authentication
+// nor TLS.
+//
+// Addr is the address to connect to, e.g. with smtp.SendMail(). Reject, if
+// not nil, is called for each recipient; if it returns a non-empty reply,
+// e.g. "550 5.1.1 No such user", the recipient is rejected with it.
+type Sink struct {
+	Addr   string
+	LMTP   bool
+	Reject func(rcpt string) string
+
+	l          net.Listener
+	mu         sync.Mutex
+	cond       *sync.Cond
+	deliveries []*Delivery
+	conns      sync.WaitGroup
+}
+
+// Returns a new SMTP Sink, already listening, or fails \a t.
+func NewSink(t testing.TB) *Sink {
+	return newSink(t, false)
+}
+
+// Returns a new LMTP Sink, already listening, or fails \a t. It replies
+// to the end of each message once per accepted recipient, as LMTP requires.
+func NewLMTPSink(t testing.TB) *Sink {
+	return newSink(t, true)
+}
+
+func newSink(t testing.TB, lmtp bool) *Sink {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("testutil: cannot listen: %v", err)
+	}
+	s := &Sink{Addr: l.Addr().String(), LMTP: lmtp, l: l}
+	s.cond = sync.NewCond(&s.mu)
+	go s.serve()
+	return s
+}
+
+// Stops listening and waits until the connections have been closed.
+func (s *Sink) Close() error {
+	err := s.l.Close()
+	s.conns.Wait()
+	return err
+}
+
+// Returns the messages received so far, oldest first.
+func (s *Sink) Deliveries() []*Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*Delivery{}, s.deliveries...)
+}
+
+// Forgets the messages received so far.
+func (s *Sink) Reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deliveries = nil
+}
+
+// Waits until at least \a n messages have been received, or \a timeout has
+// passed, and returns the messages received.
+func (s *Sink) Wait(n int, timeout time.Duration) []*Delivery {
+	timer := time.AfterFunc(timeout, func() {
+		s.mu.Lock()
+		s.cond.Broadcast()
+		s.mu.Unlock()
+	})
+	defer timer.Stop()
+	deadline := time.Now().Add(timeout)
+	s.mu.Lock()
+	for len(s.deliveries) < n && time.Now().Before(deadline) {
+		s.cond.Wait()
+	}
+	s.mu.Unlock()
+	return s.Deliveries()
+}
+
+// Returns the first message received for \a rcpt, compared
+// case-insensitively, or fails \a t and returns nil.
+func (s *Sink) WasSentTo(t testing.TB, rcpt string) *Delivery {
+	t.Helper()
+	for _, d := range s.Deliveries() {
+		for _, to := range d.To {
+			if strings.EqualFold(to, rcpt) {
+				return d
+			}
+		}
+	}
+	t.Errorf("testutil: no message was sent to %s", rcpt)
+	return nil
+}
+
+// Returns the first message whose decoded subject contains \a substring,
+// or fails \a t and returns nil.
+func (s *Sink) SubjectContains(t testing.TB, substring string) *Delivery {
+	t.Helper()
+	for _, d := range s.Deliveries() {
+		if strings.Contains(d.Subject(), substring) {
+			return d
+		}
+	}
+	t.Errorf("testutil: no message has a subject containing %q", substring)
+	return nil
+}
+
+// Returns the attachment named \a filename of the first message which has
+// one, or fails \a t and returns nil.
+func (s *Sink) AttachmentNamed(t testing.TB, filename string) *mail.Part {
+	t.Helper()
+	for _, d := range s.Deliveries() {
+		if a := d.Attachment(filename); a != nil {
+			return a
+		}
+	}
+	t.Errorf("testutil: no message has an attachment named %q", filename)
+	return nil
+}
+
+// Returns the decoded subject of this message, or an empty string.
+func (d *Delivery) Subject() string {
+	if d.Message == nil || d.Message.Header == nil {
+		return ""
+	}
+	return d.Message.Header.Subject()
+}
+
+// Returns the attachment of this message named \a filename, or nil.
+func (d *Delivery) Attachment(filename string) *mail.Part {
+	if d.Message == nil {
+		return nil
+	}
+	for _, a := range d.Message.Attachments() {
+		if a.Filename() == filename {
+			return a
+		}
+	}
+	return nil
+}
+
+// Accepts connections until the listener is closed.
+func (s *Sink) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.conns.Add(1)
+		go func() {
+			defer s.conns.Done()
+			s.session(conn)
+		}()
+	}
+}
+
+// Records a message received from \a from for \a to.
+func (s *Sink) deliver(from string, to []string, text string) {
+	m, _ := mail.ReadMessage(text)
+	s.mu.Lock()
+	s.deliveries = append(s.deliveries, &Delivery{From: from, To: to, Text: text, Message: m})
+	s.cond.Broadcast()
+	s.mu.Unlock()
+}
+
+// Talks SMTP or LMTP on \a conn until the client quits or disconnects.
+func (s *Sink) session(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	reply := func(lines ...string) {
+		for _, l := range lines {
+			w.WriteString(l + "\r\n")
+		}
+		w.Flush()
+	}
+	// replies once, or in LMTP once per recipient
+	accepted := func(to []string) {
+		if !s.LMTP {
+			reply("250 2.0.0 Ok: queued")
+			return
+		}
+		for range to {
+			reply("250 2.0.0 Ok: delivered")
+		}
+	}
+
+	greeting := "EHLO"
+	if s.LMTP {
+		greeting = "LHLO"
+	}
+	reply("220 sink.test ESMTP testutil")
+	from := ""
+	var to []string
+	inTransaction := false
+	var chunks strings.Builder
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		l = strings.TrimRight(l, "\r\n")
+		verb, args := l, ""
+		if sp := strings.IndexByte(l, ' '); sp >= 0 {
+			verb, args = l[:sp], l[sp+1:]
+		}
+		switch strings.ToUpper(verb) {
+		case greeting:
+			reply("250-sink.test", "250-8BITMIME", "250-SMTPUTF8",
+				"250-CHUNKING", "250 PIPELINING")
+		case "HELO":
+			if s.LMTP {
+				reply("500 5.5.1 Use LHLO")
+			} else {
+				reply("250 sink.test")
+			}
+		case "MAIL":
+			from = path(args, "FROM:")
+			to = nil
+			inTransaction = true
+			chunks.Reset()
+			reply("250 2.1.0 Ok")
+		case "RCPT":
+			rcpt := path(args, "TO:")
+			if !inTransaction {
+				reply("503 5.5.1 MAIL first")
+			} else if rejection := s.rejection(rcpt); rejection != "" {
+				reply(rejection)
+			} else {
+				to = append(to, rcpt)
+				reply("250 2.1.5 Ok")
+			}
+		case "DATA":
+			if len(to) == 0 {
+				reply("503 5.5.1 RCPT first")
+				continue
+			}
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			b, err := ioutil.ReadAll(mail.NewDotUnstuffReader(r))
+			if err != nil {
+				return
+			}
+			s.deliver(from, to, string(b))
+			accepted(to)
+			inTransaction, to = false, nil
+		case "BDAT":
+			size, last, err := mail.ParseBDAT(args)
+			if err != nil {
+				reply("501 5.5.4 " + err.Error())
+				return
+			}
+			if _, err := io.CopyN(&chunks, r, int64(size)); err != nil {
+				return
+			}
+			if len(to) == 0 {
+				reply("503 5.5.1 RCPT first")
+				continue
+			}
+			if !last {
+				reply("250 2.0.0 Ok")
+				continue
+			}
+			s.deliver(from, to, chunks.String())
+			chunks.Reset()
+			accepted(to)
+			inTransaction, to = false, nil
+		case "RSET":
+			inTransaction, to = false, nil
+			chunks.Reset()
+			reply("250 2.0.0 Ok")
+		case "NOOP":
+			reply("250 2.0.0 Ok")
+		case "QUIT":
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not implemented")
+		}
+	}
+}
+
+// Returns the reply with which \a rcpt is rejected, or an empty string.
+func (s *Sink) rejection(rcpt string) string {
+	if s.Reject == nil {
+		return ""
+	}
+	return s.Reject(rcpt)
+}
+
+// Returns the address in the MAIL or RCPT arguments \a args, which start
+// with \a prefix, without angle brackets and ignoring any parameters.
+func path(args, prefix string) string {
+	if len(args) >= len(prefix) && strings.EqualFold(args[:len(prefix)], prefix) {
+		args = args[len(prefix):]
+	}
+	args = strings.TrimSpace(args)
+	if sp := strings.IndexByte(args, ' '); sp >= 0 {
+		args = args[:sp]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(args, "<"), ">")
+}
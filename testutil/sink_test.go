@@ -0,0 +1,186 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package testutil_test
+
+import (
+	"fmt"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jimexcel/mail"
+	"github.com/jimexcel/mail/testutil"
+)
+
+func TestSink(t *testing.T) {
+	s := testutil.NewSink(t)
+	defer s.Close()
+	s.Reject = func(rcpt string) string {
+		if strings.HasPrefix(rcpt, "nobody@") {
+			return "550 5.1.1 No such user"
+		}
+		return ""
+	}
+
+	text := "From: alice@example.com\r\nTo: bob@example.com\r\n" +
+		"Subject: =?utf-8?q?Caf=C3=A9?=\r\n\r\n.Hello\r\n"
+	if err := smtp.SendMail(s.Addr, nil, "alice@example.com",
+		[]string{"bob@example.com"}, []byte(text)); err != nil {
+		t.Fatal(err)
+	}
+	err := smtp.SendMail(s.Addr, nil, "alice@example.com",
+		[]string{"nobody@example.com"}, []byte(text))
+	if err == nil || !strings.Contains(err.Error(), "No such user") {
+		t.Errorf("rejected recipient: %v", err)
+	}
+
+	c := mail.NewComposer()
+	c.Header.Add("From", "alice@example.com")
+	c.Header.Add("Subject", "Report")
+	c.Text = "See attached."
+	c.Attach("report.csv", "text/csv", "a,b\n1,2\n")
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := smtp.Dial(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := mail.SendBDAT(client, "alice@example.com",
+		[]string{"carol@example.com", "dave@example.com"}, m, 50); err != nil {
+		t.Fatal(err)
+	}
+	client.Quit()
+
+	d := s.Wait(2, time.Second)
+	testutilEquals(t, "deliveries", len(d), 2)
+	testutilEquals(t, "text", s.WasSentTo(t, "BOB@example.com").Text, text)
+	testutilEquals(t, "subject", s.SubjectContains(t, "Caf").Subject(), "Café")
+	testutilEquals(t, "recipients", strings.Join(s.WasSentTo(t, "dave@example.com").To, " "),
+		"carol@example.com dave@example.com")
+	a := s.AttachmentNamed(t, "report.csv")
+	if a == nil || !strings.Contains(a.Text, "1,2") {
+		t.Error("attachment not received")
+	}
+
+	// the assertions fail a test when nothing matches
+	ft := &fakeT{TB: t}
+	if s.WasSentTo(ft, "eve@example.com") != nil || !ft.failed {
+		t.Error("WasSentTo did not fail")
+	}
+	s.Reset()
+	testutilEquals(t, "after reset", len(s.Deliveries()), 0)
+}
+
+func TestLMTPSink(t *testing.T) {
+	s := testutil.NewLMTPSink(t)
+	defer s.Close()
+	c, err := textproto.Dial("tcp", s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	expect := func(code int, format string, args ...interface{}) {
+		t.Helper()
+		if format != "" {
+			if err := c.PrintfLine(format, args...); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, _, err := c.ReadResponse(code); err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+	}
+	expect(220, "")
+	expect(500, "HELO client.example")
+	expect(250, "LHLO client.example")
+	expect(250, "MAIL FROM:<alice@example.com>")
+	expect(250, "RCPT TO:<bob@example.com>")
+	expect(250, "RCPT TO:<carol@example.com>")
+	expect(354, "DATA")
+	w := c.DotWriter()
+	w.Write([]byte("Subject: Local\r\n\r\nHi\r\n"))
+	w.Close()
+	// one reply per recipient
+	expect(250, "")
+	expect(250, "")
+	expect(221, "QUIT")
+
+	d := s.WasSentTo(t, "carol@example.com")
+	testutilEquals(t, "subject", d.Subject(), "Local")
+}
+
+// A testing.TB which records failures instead of failing the test.
+type fakeT struct {
+	testing.TB
+	failed bool
+}
+
+func (t *fakeT) Helper() {}
+
+func (t *fakeT) Errorf(format string, args ...interface{}) {
+	t.failed = true
+}
+
+type entries []string
+
+func (e *entries) add(level, msg string, args []interface{}) {
+	s := level + " " + msg
+	for i := 0; i+1 < len(args); i += 2 {
+		s += fmt.Sprintf(" %v=%v", args[i], args[i+1])
+	}
+	*e = append(*e, s)
+}
+
+func (e *entries) Debug(msg string, args ...interface{}) { e.add("DEBUG", msg, args) }
+func (e *entries) Info(msg string, args ...interface{})  { e.add("INFO", msg, args) }
+func (e *entries) Warn(msg string, args ...interface{})  { e.add("WARN", msg, args) }
+func (e *entries) Error(msg string, args ...interface{}) { e.add("ERROR", msg, args) }
+
+func TestSendLogging(t *testing.T) {
+	log := &entries{}
+	old := mail.DefaultLogger
+	mail.DefaultLogger = log
+	defer func() {
+		mail.DefaultLogger = old
+	}()
+
+	s := testutil.NewSink(t)
+	defer s.Close()
+	s.Reject = func(rcpt string) string {
+		return "550 5.1.1 No such user"
+	}
+	client, err := smtp.Dial(s.Addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	m, _ := mail.ReadMessage("From: alice@example.com\r\nMessage-ID: <2@example.com>\r\n\r\nHi\r\n")
+	if err := mail.SendBDAT(client, "alice@example.com", []string{"nobody@example.com"}, m, 0); err == nil {
+		t.Fatal("expected the recipient to be rejected")
+	}
+	testutilEquals(t, "entries", len(*log), 1)
+	if len(*log) == 1 {
+		testutilEquals(t, "entry", (*log)[0], "WARN mail: sending failed message_id=<2@example.com> "+
+			"envelope_from=alice@example.com envelope_to=nobody@example.com error=550 \"5.1.1 No such user\"")
+	}
+}
+
+func TestSMTPTransport(t *testing.T) {
+	s := testutil.NewSink(t)
+	defer s.Close()
+
+	m := testutil.PlainMessage(7).From("alice@example.com").To("bob@example.com").Build(t)
+	tr := &mail.SMTPTransport{Addr: s.Addr, HelloName: "client.example.com"}
+	env := mail.Envelope{From: "alice@example.com", To: []string{"bob@example.com"}}
+	if err := mail.Deliver(tr, m, env); err != nil {
+		t.Fatal(err)
+	}
+	d := s.WasSentTo(t, "bob@example.com")
+	testutilEquals(t, "from", d.From, "alice@example.com")
+	testutilEquals(t, "text", d.Text, m.RFC822(false))
+}
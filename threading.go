@@ -0,0 +1,165 @@
+package mail
+
+import (
+	"strings"
+)
+
+// The longest References field SetParent() writes, in bytes, including the
+// field name. RFC 5537 section 3.4.4 asks that References be trimmed to fit
+// in 998 bytes, and that the first message-id be kept when trimming.
+const maxReferencesLength = 998
+
+// Returns the message-ids in the References field, in order (oldest first),
+// each enclosed in angle brackets, or an empty slice if there are none.
+// Malformed message-ids are skipped.
+func (h *Header) References() []string {
+	r := []string{}
+	for _, a := range h.Addresses(ReferencesFieldName) {
+		if a.t == NormalAddressType {
+			r = append(r, "<"+a.Localpart+"@"+a.Domain+">")
+		}
+	}
+	return r
+}
+
+// Returns the message-id of the first message in this message's thread:
+// the first message-id in References, or if there is none, the Parent(), or
+// this message's own Message-ID if it has no parent. Returns an empty
+// string if none of them exists.
+//
+// Unlike References(), ThreadRoot() does not look past the first
+// message-id, so it is cheap even for long threads.
+func (h *Header) ThreadRoot() string {
+	if f := h.addressField(ReferencesFieldName, 0); f != nil {
+		for _, a := range f.Addresses {
+			if a.t == NormalAddressType {
+				return "<" + a.Localpart + "@" + a.Domain + ">"
+			}
+		}
+	}
+	if p := h.Parent(); p != "" {
+		return p
+	}
+	return h.MessageID()
+}
+
+// Returns the message-ids in the In-Reply-To field, in order, each enclosed
+// in angle brackets, or an empty slice if there are none.
+//
+// RFC 5322 allows several message-ids, and some clients add text, e.g.
+// "<id@example.com> (Your message of Mon, 5 Oct 2026)" or "Your message
+// <id@example.com>"; every message-id which can be recovered is returned,
+// and the rest is ignored.
+func (h *Header) InReplyTo() []string {
+	r := []string{}
+	for _, f := range h.All(InReplyToFieldName) {
+		r = append(r, messageIDs(f.Value())...)
+	}
+	return r
+}
+
+// Returns the message-id of the message this one replies to, as threading
+// should use it, or an empty string if it cannot be determined.
+//
+// If In-Reply-To holds one message-id, that is the parent. If it holds
+// several, the one mentioned last in References is preferred, since
+// References lists the thread in order, and the first otherwise. If
+// In-Reply-To holds none, the last message-id in References is used.
+func (h *Header) Parent() string {
+	ids := h.InReplyTo()
+	refs := h.References()
+	if len(ids) == 1 {
+		return ids[0]
+	}
+	if len(ids) > 1 {
+		for i := len(refs) - 1; i >= 0; i-- {
+			for _, id := range ids {
+				if id == refs[i] {
+					return id
+				}
+			}
+		}
+		return ids[0]
+	}
+	if len(refs) > 0 {
+		return refs[len(refs)-1]
+	}
+	return ""
+}
+
+// Returns the message-ids which can be recovered from \a s, in order, each
+// enclosed in angle brackets.
+func messageIDs(s string) []string {
+	r := []string{}
+	for _, a := range references(s).Addresses {
+		if a.t == NormalAddressType {
+			r = append(r, "<"+a.Localpart+"@"+a.Domain+">")
+		}
+	}
+	return r
+}
+
+// Parses the In-Reply-To field \a s like any unstructured field, except
+// that if \a s cannot be decoded, e.g. because it contains 8-bit text, the
+// field holds the message-ids which can be recovered from it instead of
+// being invalid.
+func (f *HeaderField) parseInReplyTo(s string) {
+	f.parseOther(s)
+	if f.err != nil {
+		if ids := messageIDs(s); len(ids) > 0 {
+			f.value = strings.Join(ids, " ")
+			f.err = nil
+		}
+	}
+}
+
+// Returns the References a reply to the message whose header is \a parent
+// should have: the parent's References followed by its Message-ID, without
+// malformed or repeated message-ids, and trimmed as RFC 5537 asks by
+// dropping the oldest message-ids except the first until the field fits in
+// 998 bytes.
+func ReplyReferences(parent *Header) []string {
+	r := []string{}
+	seen := map[string]bool{}
+	ids := parent.References()
+	if id := parent.MessageID(); id != "" {
+		ids = append(ids, id)
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			r = append(r, id)
+		}
+	}
+	return trimReferences(r)
+}
+
+// Returns \a ids without the second, third etc. message-id, until a
+// References field holding them fits in maxReferencesLength.
+func trimReferences(ids []string) []string {
+	length := len(ReferencesFieldName) + 2 + len(strings.Join(ids, " "))
+	drop := 0
+	for length > maxReferencesLength && len(ids)-drop > 2 {
+		length -= len(ids[1+drop]) + 1
+		drop++
+	}
+	if drop == 0 {
+		return ids
+	}
+	return append(ids[:1:1], ids[1+drop:]...)
+}
+
+// Makes this header that of a reply to the message whose header is \a
+// parent, by setting In-Reply-To to the parent's Message-ID and References
+// as returned by ReplyReferences(). Fields are removed if there is nothing
+// to put in them.
+func (h *Header) SetParent(parent *Header) {
+	h.RemoveAllNamed(InReplyToFieldName)
+	h.RemoveAllNamed(ReferencesFieldName)
+	if id := parent.MessageID(); id != "" {
+		h.Add(InReplyToFieldName, id)
+	}
+	if refs := ReplyReferences(parent); len(refs) > 0 {
+		h.Add(ReferencesFieldName, strings.Join(refs, " "))
+	}
+}
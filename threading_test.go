@@ -0,0 +1,91 @@
+package mail_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestReferences(t *testing.T) {
+	m, err := mail.ReadMessage("From: x@example.com\r\n" +
+		"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" +
+		"Message-ID: <c@example.com>\r\n" +
+		"References: <a@example.com> <garbage <b@example.com> <a@example.com>\r\n" +
+		"\r\nBody\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "references", strings.Join(m.Header.References(), " "),
+		"<a@example.com> <b@example.com> <a@example.com>")
+	testStringEquals(t, "root", m.Header.ThreadRoot(), "<a@example.com>")
+	testStringEquals(t, "reply", strings.Join(mail.ReplyReferences(m.Header), " "),
+		"<a@example.com> <b@example.com> <c@example.com>")
+
+	reply := &mail.Header{}
+	reply.SetParent(m.Header)
+	testStringEquals(t, "in-reply-to", reply.Get(mail.InReplyToFieldName), "<c@example.com>")
+	testStringEquals(t, "reply references", strings.Join(reply.References(), " "),
+		"<a@example.com> <b@example.com> <c@example.com>")
+
+	var b strings.Builder
+	b.WriteString("From: x@example.com\r\nDate: Mon, 5 Oct 2026 10:00:00 +0000\r\n")
+	b.WriteString("Message-ID: <last@example.com>\r\nReferences:")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&b, " <%d@example.com>", i)
+	}
+	b.WriteString("\r\n\r\nBody\r\n")
+	long, err := mail.ReadMessage(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	refs := mail.ReplyReferences(long.Header)
+	testStringEquals(t, "long root", refs[0], "<0@example.com>")
+	testStringEquals(t, "long last", refs[len(refs)-1], "<last@example.com>")
+	testStringEquals(t, "long before last", refs[len(refs)-2], "<99@example.com>")
+	if l := len("References: " + strings.Join(refs, " ")); l > 998 || l < 980 {
+		t.Errorf("trimmed References is %d bytes", l)
+	}
+
+	root := &mail.Header{}
+	root.Add(mail.MessageIDFieldName, "<root@example.com>")
+	testStringEquals(t, "own root", root.ThreadRoot(), "<root@example.com>")
+}
+
+func TestInReplyTo(t *testing.T) {
+	parse := func(fields string) *mail.Header {
+		m, err := mail.ReadMessage("From: x@example.com\r\n" +
+			"Date: Mon, 5 Oct 2026 10:00:00 +0000\r\n" + fields + "\r\nBody\r\n")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m.Header
+	}
+
+	h := parse("In-Reply-To: <a@example.com> (Your message of Mon, 5 Oct 2026)\r\n")
+	testStringEquals(t, "comment", strings.Join(h.InReplyTo(), " "), "<a@example.com>")
+	testStringEquals(t, "comment parent", h.Parent(), "<a@example.com>")
+	testStringEquals(t, "comment root", h.ThreadRoot(), "<a@example.com>")
+
+	h = parse("In-Reply-To: Your message <b@example.com> of yesterday\r\n")
+	testStringEquals(t, "text", strings.Join(h.InReplyTo(), " "), "<b@example.com>")
+
+	h = parse("In-Reply-To: <a@example.com> <c@example.com>\r\n" +
+		"References: <a@example.com> <b@example.com> <c@example.com> <d@example.com>\r\n")
+	testStringEquals(t, "several", strings.Join(h.InReplyTo(), " "),
+		"<a@example.com> <c@example.com>")
+	testStringEquals(t, "preferred parent", h.Parent(), "<c@example.com>")
+
+	h = parse("In-Reply-To: <x@example.com> <y@example.com>\r\n")
+	testStringEquals(t, "first parent", h.Parent(), "<x@example.com>")
+
+	h = parse("References: <a@example.com> <b@example.com>\r\n")
+	testStringEquals(t, "references parent", h.Parent(), "<b@example.com>")
+
+	h = parse("In-Reply-To: Deine Nachricht vom M\xc3\xa4rz <m@example.com>\r\n")
+	testStringEquals(t, "8-bit", strings.Join(h.InReplyTo(), " "), "<m@example.com>")
+	if err := h.All(mail.InReplyToFieldName)[0].Error(); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
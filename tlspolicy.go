@@ -0,0 +1,451 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A TLSMode says when a client must use TLS and what it must verify.
+type TLSMode int
+
+const (
+	// TLSOpportunistic uses STARTTLS if the server offers it, without
+	// verifying the server's certificate, as mail servers usually do, since
+	// many MX hosts have self-signed certificates.
+	TLSOpportunistic TLSMode = iota
+	// TLSRequired requires STARTTLS and a certificate valid for the host.
+	TLSRequired
+	// TLSDANE verifies the certificate against the host's TLSA records
+	// (RFC 7672), and requires STARTTLS if it has usable ones. Without
+	// them, TLS is opportunistic.
+	TLSDANE
+	// TLSMTASTS applies the recipient domain's MTA-STS policy (RFC 8461):
+	// if its mode is "enforce", the MX host must be listed in the policy and
+	// TLS with a valid certificate is required; if it is "testing", failures
+	// are reported but mail is delivered nonetheless.
+	TLSMTASTS
+)
+
+// The results of a failed verification, as named by SMTP TLS Reporting (RFC
+// 8460).
+const (
+	TLSResultStartTLSNotSupported = "starttls-not-supported"
+	TLSResultHostMismatch         = "certificate-host-mismatch"
+	TLSResultExpired              = "certificate-expired"
+	TLSResultNotTrusted           = "certificate-not-trusted"
+	TLSResultValidationFailure    = "validation-failure"
+	TLSResultTLSAInvalid          = "tlsa-invalid"
+)
+
+// A TLSARecord is a DNS TLSA record (RFC 6698): Usage 2 (DANE-TA) names a
+// trust anchor and 3 (DANE-EE) the server's own certificate; Selector is 0
+// for the whole certificate and 1 for its public key; MatchingType is 0 if
+// Data is the selected data itself, and 1 or 2 if it is its SHA-256 or
+// SHA-512 digest.
+type TLSARecord struct {
+	Usage        uint8
+	Selector     uint8
+	MatchingType uint8
+	Data         []byte
+}
+
+// A TLSPolicy says how a network client, such as SMTPTransport or
+// Verifier, uses TLS with a server.
+//
+// Mode is one of the TLSMode constants above. MinVersion is the lowest TLS
+// version accepted, e.g. tls.VersionTLS12, or the crypto/tls default if
+// zero. Pins, if not empty, lists base64-encoded SHA-256 digests of public
+// keys (SubjectPublicKeyInfo), one of which one of the server's certificates
+// must have, whatever the Mode.
+//
+// LookupTLSA looks up the TLSA records of a host and port for TLSDANE; the
+// standard library cannot, so a DNSSEC-validating resolver must be
+// supplied, and without one, TLSDANE is opportunistic. MTASTS is the
+// recipient domain's policy for TLSMTASTS, e.g. from FetchMTASTS(). Report,
+// if not nil, is called with each failure which does not stop the client,
+// e.g. under an MTA-STS policy in testing mode.
+type TLSPolicy struct {
+	Mode       TLSMode
+	MinVersion uint16
+	Pins       []string
+	LookupTLSA func(host string, port int) ([]TLSARecord, error)
+	MTASTS     *MTASTSPolicy
+	Report     func(err *TLSPolicyError)
+}
+
+// A TLSPolicyError says why a server does not satisfy a TLSPolicy. Result
+// is one of the TLSResult* constants above, and Err the underlying error,
+// if any. It matches ErrTLSPolicy, so that policy failures can be told
+// apart from network errors.
+type TLSPolicyError struct {
+	Host   string
+	Result string
+	Err    error
+}
+
+func (e *TLSPolicyError) Error() string {
+	s := "mail: " + e.Host + " fails the TLS policy: " + e.Result
+	if e.Err != nil {
+		s += ": " + e.Err.Error()
+	}
+	return s
+}
+
+func (e *TLSPolicyError) Is(target error) bool {
+	return target == ErrTLSPolicy
+}
+
+func (e *TLSPolicyError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the configuration with which to start TLS with \a host on \a
+// port, based on \a base (which may be nil), or nil if TLS is not to be
+// used. \a offered is true if the server offers TLS, e.g. STARTTLS.
+// Returns a *TLSPolicyError if this policy requires TLS and the server does
+// not offer it.
+//
+// The configuration verifies the server's certificate as this policy says,
+// and makes the handshake fail with a *TLSPolicyError if it does not
+// satisfy it.
+func (p *TLSPolicy) Config(base *tls.Config, host string, port int, offered bool) (*tls.Config, error) {
+	verify := func(certs [][]byte) error { return nil }
+	required := false
+	switch p.Mode {
+	case TLSRequired:
+		required = true
+		verify = func(certs [][]byte) error { return p.verifyWebPKI(base, host, certs) }
+	case TLSDANE:
+		if p.LookupTLSA != nil {
+			records, err := p.LookupTLSA(host, port)
+			if err != nil {
+				return nil, &TLSPolicyError{Host: host, Result: TLSResultTLSAInvalid, Err: err}
+			}
+			if usable := usableTLSA(records); len(usable) > 0 {
+				required = true
+				verify = func(certs [][]byte) error { return verifyDANE(host, usable, certs) }
+			}
+		}
+	case TLSMTASTS:
+		if s := p.MTASTS; s != nil && s.Mode != "none" {
+			enforce := s.Mode == "enforce"
+			if !s.Matches(host) {
+				err := &TLSPolicyError{Host: host, Result: TLSResultValidationFailure,
+					Err: errors.New("host not listed in the MTA-STS policy")}
+				if enforce {
+					return nil, err
+				}
+				p.report(err)
+			}
+			required = enforce
+			verify = func(certs [][]byte) error {
+				err := p.verifyWebPKI(base, host, certs)
+				if err != nil && !enforce {
+					p.report(err.(*TLSPolicyError))
+					return nil
+				}
+				return err
+			}
+		}
+	}
+
+	if !offered {
+		if required || len(p.Pins) > 0 {
+			return nil, &TLSPolicyError{Host: host, Result: TLSResultStartTLSNotSupported}
+		}
+		return nil, nil
+	}
+
+	config := &tls.Config{}
+	if base != nil {
+		config = base.Clone()
+	}
+	if config.ServerName == "" {
+		config.ServerName = host
+	}
+	if p.MinVersion != 0 {
+		config.MinVersion = p.MinVersion
+	}
+	// the checks are made here instead of by crypto/tls, since they depend
+	// on the mode
+	config.InsecureSkipVerify = true
+	config.VerifyPeerCertificate = func(certs [][]byte, _ [][]*x509.Certificate) error {
+		if err := p.verifyPins(host, certs); err != nil {
+			return err
+		}
+		return verify(certs)
+	}
+	return config, nil
+}
+
+// Calls Report with \a err, if it is not nil.
+func (p *TLSPolicy) report(err *TLSPolicyError) {
+	if p.Report != nil {
+		p.Report(err)
+	}
+}
+
+// Returns an error unless one of \a certs, the server's certificates in
+// DER, has a public key listed in Pins.
+func (p *TLSPolicy) verifyPins(host string, certs [][]byte) error {
+	if len(p.Pins) == 0 {
+		return nil
+	}
+	for _, der := range certs {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			continue
+		}
+		sum := sha256.Sum256(c.RawSubjectPublicKeyInfo)
+		pin := base64.StdEncoding.EncodeToString(sum[:])
+		for _, pinned := range p.Pins {
+			if pinned == pin {
+				return nil
+			}
+		}
+	}
+	return &TLSPolicyError{Host: host, Result: TLSResultValidationFailure,
+		Err: errors.New("no certificate matches a pinned public key")}
+}
+
+// Returns an error unless \a certs, the server's certificates in DER, are
+// valid for \a host and chain to one of the roots in \a base, or the
+// system's.
+func (p *TLSPolicy) verifyWebPKI(base *tls.Config, host string, certs [][]byte) error {
+	parsed, err := parseCertificates(certs)
+	if err != nil {
+		return &TLSPolicyError{Host: host, Result: TLSResultValidationFailure, Err: err}
+	}
+	opts := x509.VerifyOptions{DNSName: host, Intermediates: x509.NewCertPool()}
+	if base != nil {
+		opts.Roots = base.RootCAs
+		if base.Time != nil {
+			opts.CurrentTime = base.Time()
+		}
+	}
+	for _, c := range parsed[1:] {
+		opts.Intermediates.AddCert(c)
+	}
+	if _, err := parsed[0].Verify(opts); err != nil {
+		result := TLSResultValidationFailure
+		switch e := err.(type) {
+		case x509.HostnameError:
+			result = TLSResultHostMismatch
+		case x509.UnknownAuthorityError:
+			result = TLSResultNotTrusted
+		case x509.CertificateInvalidError:
+			if e.Reason == x509.Expired {
+				result = TLSResultExpired
+			}
+		}
+		return &TLSPolicyError{Host: host, Result: result, Err: err}
+	}
+	return nil
+}
+
+// Returns the certificates in \a certs, which are in DER, or an error if
+// there are none or one is invalid.
+func parseCertificates(certs [][]byte) ([]*x509.Certificate, error) {
+	if len(certs) == 0 {
+		return nil, errors.New("no certificate")
+	}
+	r := make([]*x509.Certificate, 0, len(certs))
+	for _, der := range certs {
+		c, err := x509.ParseCertificate(der)
+		if err != nil {
+			return nil, err
+		}
+		r = append(r, c)
+	}
+	return r, nil
+}
+
+// Returns those of \a records which SMTP clients use: DANE-TA and DANE-EE
+// records (RFC 7672 section 3.1) with known selectors and matching types.
+func usableTLSA(records []TLSARecord) []TLSARecord {
+	var r []TLSARecord
+	for _, t := range records {
+		if (t.Usage == 2 || t.Usage == 3) && t.Selector <= 1 && t.MatchingType <= 2 {
+			r = append(r, t)
+		}
+	}
+	return r
+}
+
+// Returns true if \a c matches \a t, ignoring its usage.
+func (t TLSARecord) matches(c *x509.Certificate) bool {
+	data := c.Raw
+	if t.Selector == 1 {
+		data = c.RawSubjectPublicKeyInfo
+	}
+	switch t.MatchingType {
+	case 1:
+		sum := sha256.Sum256(data)
+		data = sum[:]
+	case 2:
+		sum := sha512.Sum512(data)
+		data = sum[:]
+	}
+	return string(data) == string(t.Data)
+}
+
+// Returns an error unless \a certs, the server's certificates in DER,
+// satisfy one of the usable TLSA \a records of \a host: a DANE-EE record
+// matching the server's own certificate, whatever its name or expiry, or
+// a DANE-TA record matching a certificate to which the server's chains,
+// and which is valid for \a host.
+func verifyDANE(host string, records []TLSARecord, certs [][]byte) error {
+	parsed, err := parseCertificates(certs)
+	if err != nil {
+		return &TLSPolicyError{Host: host, Result: TLSResultValidationFailure, Err: err}
+	}
+	for _, t := range records {
+		if t.Usage == 3 {
+			if t.matches(parsed[0]) {
+				return nil
+			}
+			continue
+		}
+		for _, anchor := range parsed[1:] {
+			if !t.matches(anchor) {
+				continue
+			}
+			opts := x509.VerifyOptions{DNSName: host, Roots: x509.NewCertPool(),
+				Intermediates: x509.NewCertPool()}
+			opts.Roots.AddCert(anchor)
+			for _, c := range parsed[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			if _, err := parsed[0].Verify(opts); err == nil {
+				return nil
+			}
+		}
+	}
+	return &TLSPolicyError{Host: host, Result: TLSResultValidationFailure,
+		Err: errors.New("no certificate matches a TLSA record")}
+}
+
+// An MTASTSPolicy is a domain's MTA-STS policy (RFC 8461): Mode is
+// "enforce", "testing" or "none", MX lists the patterns of the MX hosts
+// which may receive the domain's mail, e.g. "mail.example.com" or
+// "*.example.net", and MaxAge says how long the policy may be cached.
+type MTASTSPolicy struct {
+	Mode   string
+	MX     []string
+	MaxAge time.Duration
+}
+
+// Parses \a text, the policy file served at
+// https://mta-sts.<domain>/.well-known/mta-sts.txt.
+func ParseMTASTS(text string) (*MTASTSPolicy, error) {
+	p := &MTASTSPolicy{}
+	version := ""
+	s := bufio.NewScanner(strings.NewReader(text))
+	for s.Scan() {
+		colon := strings.IndexByte(s.Text(), ':')
+		if colon < 0 {
+			continue
+		}
+		value := strings.TrimSpace(s.Text()[colon+1:])
+		switch strings.TrimSpace(s.Text()[:colon]) {
+		case "version":
+			version = value
+		case "mode":
+			p.Mode = value
+		case "mx":
+			p.MX = append(p.MX, strings.ToLower(value))
+		case "max_age":
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				return nil, fmt.Errorf("mail: invalid MTA-STS max_age %q", value)
+			}
+			p.MaxAge = time.Duration(n) * time.Second
+		}
+	}
+	if version != "STSv1" {
+		return nil, fmt.Errorf("mail: unknown MTA-STS version %q", version)
+	}
+	if p.Mode != "enforce" && p.Mode != "testing" && p.Mode != "none" {
+		return nil, fmt.Errorf("mail: unknown MTA-STS mode %q", p.Mode)
+	}
+	if p.Mode != "none" && len(p.MX) == 0 {
+		return nil, errors.New("mail: MTA-STS policy lists no MX host")
+	}
+	return p, nil
+}
+
+// Returns true if \a host may receive mail under this policy, i.e. matches
+// one of its MX patterns. A wildcard matches one label only.
+func (p *MTASTSPolicy) Matches(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	for _, mx := range p.MX {
+		if mx == host {
+			return true
+		}
+		if strings.HasPrefix(mx, "*.") {
+			if dot := strings.IndexByte(host, '.'); dot > 0 && host[dot:] == mx[1:] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Fetches the MTA-STS policy of \a domain: checks that its _mta-sts TXT
+// record, looked up with \a resolver (DefaultResolver if nil), announces
+// one, and fetches it over HTTPS with \a client (a client with a one minute
+// timeout if nil). Returns nil and no error if the domain has no policy.
+func FetchMTASTS(domain string, resolver Resolver, client *http.Client) (*MTASTSPolicy, error) {
+	if resolver == nil {
+		resolver = DefaultResolver
+	}
+	txt, err := resolver.LookupTXT("_mta-sts." + domain)
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	announced := false
+	for _, t := range txt {
+		announced = announced || strings.HasPrefix(t, "v=STSv1")
+	}
+	if !announced {
+		return nil, nil
+	}
+
+	if client == nil {
+		client = &http.Client{Timeout: time.Minute}
+	}
+	// redirects are not followed (RFC 8461 section 3.3)
+	c := *client
+	c.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := c.Get("https://mta-sts." + domain + "/.well-known/mta-sts.txt")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("mail: fetching the MTA-STS policy of %s: %s", domain, resp.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return nil, err
+	}
+	return ParseMTASTS(string(b))
+}
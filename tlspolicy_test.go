@@ -0,0 +1,114 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestTLSPolicy(t *testing.T) {
+	certs := httptest.NewTLSServer(nil)
+	defer certs.Close()
+	roots := x509.NewCertPool()
+	roots.AddCert(certs.Certificate())
+	spki := sha256.Sum256(certs.Certificate().RawSubjectPublicKeyInfo)
+
+	handshake := func(p *mail.TLSPolicy, base *tls.Config, host string) error {
+		config, err := p.Config(base, host, 25, true)
+		if err != nil {
+			return err
+		}
+		client, server := net.Pipe()
+		go func() {
+			tls.Server(server, certs.TLS).Handshake()
+			server.Close()
+		}()
+		defer client.Close()
+		return tls.Client(client, config).Handshake()
+	}
+	result := func(err error) string {
+		var e *mail.TLSPolicyError
+		if !errors.As(err, &e) || !errors.Is(err, mail.ErrTLSPolicy) {
+			return fmt.Sprint(err)
+		}
+		return e.Result
+	}
+
+	var reported []string
+	for _, c := range []struct {
+		name   string
+		policy *mail.TLSPolicy
+		base   *tls.Config
+		host   string
+		result string
+	}{
+		{"opportunistic", &mail.TLSPolicy{}, nil, "mx.example.org", "<nil>"},
+		{"required", &mail.TLSPolicy{Mode: mail.TLSRequired}, &tls.Config{RootCAs: roots},
+			"mx.example.com", "<nil>"},
+		{"required, wrong host", &mail.TLSPolicy{Mode: mail.TLSRequired}, &tls.Config{RootCAs: roots},
+			"mx.example.org", mail.TLSResultHostMismatch},
+		{"required, untrusted", &mail.TLSPolicy{Mode: mail.TLSRequired}, nil,
+			"mx.example.com", mail.TLSResultNotTrusted},
+		{"pinned", &mail.TLSPolicy{Pins: []string{base64.StdEncoding.EncodeToString(spki[:])}}, nil,
+			"mx.example.org", "<nil>"},
+		{"wrong pin", &mail.TLSPolicy{Pins: []string{"AAAA"}}, nil,
+			"mx.example.org", mail.TLSResultValidationFailure},
+		{"dane-ee", &mail.TLSPolicy{Mode: mail.TLSDANE,
+			LookupTLSA: func(host string, port int) ([]mail.TLSARecord, error) {
+				return []mail.TLSARecord{{Usage: 3, Selector: 1, MatchingType: 1, Data: spki[:]}}, nil
+			}}, nil, "mx.example.org", "<nil>"},
+		{"dane-ee mismatch", &mail.TLSPolicy{Mode: mail.TLSDANE,
+			LookupTLSA: func(host string, port int) ([]mail.TLSARecord, error) {
+				return []mail.TLSARecord{{Usage: 3, Selector: 1, MatchingType: 1, Data: []byte("x")}}, nil
+			}}, nil, "mx.example.org", mail.TLSResultValidationFailure},
+		{"mta-sts testing", &mail.TLSPolicy{Mode: mail.TLSMTASTS,
+			MTASTS: &mail.MTASTSPolicy{Mode: "testing", MX: []string{"*.example.com"}},
+			Report: func(err *mail.TLSPolicyError) { reported = append(reported, err.Result) }},
+			nil, "mx.example.org", "<nil>"},
+		{"mta-sts enforce", &mail.TLSPolicy{Mode: mail.TLSMTASTS,
+			MTASTS: &mail.MTASTSPolicy{Mode: "enforce", MX: []string{"*.example.com"}}},
+			&tls.Config{RootCAs: roots}, "mx.example.com", "<nil>"},
+		{"mta-sts enforce, unlisted host", &mail.TLSPolicy{Mode: mail.TLSMTASTS,
+			MTASTS: &mail.MTASTSPolicy{Mode: "enforce", MX: []string{"*.example.com"}}},
+			&tls.Config{RootCAs: roots}, "mx.example.org", mail.TLSResultValidationFailure},
+	} {
+		testStringEquals(t, c.name, result(handshake(c.policy, c.base, c.host)), c.result)
+	}
+	testStringEquals(t, "reported", strings.Join(reported, " "),
+		mail.TLSResultValidationFailure+" "+mail.TLSResultHostMismatch)
+
+	// a server which does not offer TLS
+	if config, err := (&mail.TLSPolicy{}).Config(nil, "mx.example.com", 25, false); config != nil || err != nil {
+		t.Errorf("opportunistic without STARTTLS = %v, %v", config, err)
+	}
+	_, err := (&mail.TLSPolicy{Mode: mail.TLSRequired}).Config(nil, "mx.example.com", 25, false)
+	testStringEquals(t, "not offered", result(err), mail.TLSResultStartTLSNotSupported)
+
+	p, err := mail.ParseMTASTS("version: STSv1\r\nmode: enforce\r\nmx: mail.example.com\r\n" +
+		"mx: *.example.net\r\nmax_age: 604800\r\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "max_age", p.MaxAge.String(), "168h0m0s")
+	for host, ok := range map[string]bool{"mail.example.com": true, "MX1.example.net.": true,
+		"a.b.example.net": false, "example.net": false, "other.example.com": false} {
+		if p.Matches(host) != ok {
+			t.Errorf("Matches(%q) = %v", host, !ok)
+		}
+	}
+	if _, err := mail.ParseMTASTS("version: STSv1\nmode: enforce\n"); err == nil {
+		t.Error("a policy without MX hosts was accepted")
+	}
+}
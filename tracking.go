@@ -0,0 +1,90 @@
+package mail
+
+import (
+	"net/url"
+	"strings"
+)
+
+// A LinkTracker rewrites the links in HTML bodies to go through a tracking
+// redirector, and adds an open-tracking pixel, as bulk mail services do.
+//
+// If RedirectURL is not empty, each http and https link is replaced by
+// RedirectURL with the parameters "t", the recipient's token, and "u", the
+// original URL. The redirector is expected to record the click and redirect
+// to the original URL. Links which already point to RedirectURL, and links
+// whose a element has a data-notrack attribute, e.g. unsubscribe links, are
+// left alone. If PixelURL is not empty, an invisible image loaded from
+// PixelURL with the parameter "t" is added at the end of each HTML body.
+//
+// Token returns the token identifying \a recipient, e.g. a signed ID; it
+// is called once per message. Plain text bodies are left alone, since the
+// rewritten links would be visible there.
+type LinkTracker struct {
+	RedirectURL string
+	PixelURL    string
+	Token       func(recipient string) (string, error)
+}
+
+// Returns a Transform which rewrites the links in a message for
+// \a recipient, as described for LinkTracker, e.g. for use in
+// Composer.Transforms.
+func (lt *LinkTracker) Transform(recipient string) Transform {
+	return func(m *Message) error {
+		if m.Part == nil {
+			return nil
+		}
+		token, err := lt.Token(recipient)
+		if err != nil {
+			return err
+		}
+		m.Part.walkLeaves(func(p *Part) {
+			if p.hasText && !p.isAttachment() && p.contentType() == "text/html" {
+				p.setText(lt.rewrite(p.Text, token))
+			}
+		})
+		return nil
+	}
+}
+
+// Returns the HTML document \a html with its links rewritten and the pixel
+// added for the recipient identified by \a token.
+func (lt *LinkTracker) rewrite(html, token string) string {
+	tokens := htmlTokenize(html)
+	for i := range tokens {
+		t := &tokens[i]
+		if t.t != htmlStartTagToken || t.tag != "a" {
+			continue
+		}
+		if _, ok := t.attr("data-notrack"); ok {
+			t.removeAttr("data-notrack")
+			continue
+		}
+		href, _ := t.attr("href")
+		href = strings.TrimSpace(href)
+		scheme := strings.ToLower(href)
+		if lt.RedirectURL == "" || strings.HasPrefix(href, lt.RedirectURL) ||
+			!strings.HasPrefix(scheme, "http://") && !strings.HasPrefix(scheme, "https://") {
+			continue
+		}
+		t.setAttr("href", withQuery(lt.RedirectURL, url.Values{"t": {token}, "u": {href}}))
+	}
+	r := htmlRender(tokens)
+	if lt.PixelURL == "" {
+		return r
+	}
+	pixel := "<img src=\"" + htmlEscape(withQuery(lt.PixelURL, url.Values{"t": {token}})) +
+		"\" width=\"1\" height=\"1\" alt=\"\" style=\"display: block; border: 0\">"
+	if i := strings.LastIndex(strings.ToLower(r), "</body>"); i >= 0 {
+		return r[:i] + pixel + r[i:]
+	}
+	return r + pixel
+}
+
+// Returns \a base with the parameters \a v added to its query.
+func withQuery(base string, v url.Values) string {
+	separator := "?"
+	if strings.Contains(base, "?") {
+		separator = "&"
+	}
+	return base + separator + v.Encode()
+}
@@ -0,0 +1,45 @@
+package mail_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestLinkTracker(t *testing.T) {
+	lt := &mail.LinkTracker{
+		RedirectURL: "https://t.example.com/c",
+		PixelURL:    "https://t.example.com/o.gif?v=1",
+		Token: func(rcpt string) (string, error) {
+			if rcpt == "" {
+				return "", errors.New("no recipient")
+			}
+			return "tok-" + strings.Split(rcpt, "@")[0], nil
+		},
+	}
+	c := mail.NewComposer()
+	c.Header.Add("From", "news@example.com")
+	c.Text = "Read it at https://example.com/a?x=1&y=2"
+	c.HTML = "<html><body><p><a href=\"https://example.com/a?x=1&amp;y=2\">Read</a> " +
+		"<a href=\"mailto:news@example.com\">Reply</a> " +
+		"<a href=\"https://example.com/unsubscribe\" data-notrack>Unsubscribe</a></p></body></html>"
+	c.Transforms = []mail.Transform{lt.Transform("bob@example.com")}
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "text", m.Parts[0].Text, "Read it at https://example.com/a?x=1&y=2\r\n")
+	testStringEquals(t, "html", m.Parts[1].Text,
+		"<html><body><p><a href=\"https://t.example.com/c?t=tok-bob&amp;u=https%3A%2F%2Fexample.com%2Fa%3Fx%3D1%26y%3D2\">Read</a> "+
+			"<a href=\"mailto:news@example.com\">Reply</a> "+
+			"<a href=\"https://example.com/unsubscribe\">Unsubscribe</a></p>"+
+			"<img src=\"https://t.example.com/o.gif?v=1&amp;t=tok-bob\" width=\"1\" height=\"1\" alt=\"\" style=\"display: block; border: 0\">"+
+			"</body></html>\r\n")
+
+	c.Transforms = []mail.Transform{lt.Transform("")}
+	if _, err := c.Compose(); err == nil || err.Error() != "no recipient" {
+		t.Errorf("expected the token error, got %v", err)
+	}
+}
@@ -0,0 +1,200 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"crypto/tls"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+)
+
+// A transcriptConn is a connection to an SMTP server which records the
+// commands and replies passing through it, one line each, prefixed with
+// "C: " for the client and "S: " for the server.
+//
+// Credentials are redacted: the arguments of AUTH and the client's
+// responses to the server's challenges are replaced with "[redacted]". The
+// message itself is recorded as its size only.
+type transcriptConn struct {
+	net.Conn
+	lines []string
+
+	client, server []byte
+	greeting       string
+	tls            bool
+	authenticating bool
+	dataPending    bool
+	data           bool
+	dataSize       int
+	chunk          int
+}
+
+// Returns the transcript recorded so far.
+func (c *transcriptConn) String() string {
+	if len(c.lines) == 0 {
+		return ""
+	}
+	return strings.Join(c.lines, "\n") + "\n"
+}
+
+func (c *transcriptConn) Read(b []byte) (int, error) {
+	if c.greeting != "" {
+		n := copy(b, c.greeting)
+		c.greeting = c.greeting[n:]
+		return n, nil
+	}
+	n, err := c.Conn.Read(b)
+	c.server = append(c.server, b[:n]...)
+	for {
+		i := strings.Index(string(c.server), "\n")
+		if i < 0 {
+			break
+		}
+		c.reply(strings.TrimRight(string(c.server[:i]), "\r"))
+		c.server = c.server[i+1:]
+	}
+	return n, err
+}
+
+func (c *transcriptConn) Write(b []byte) (int, error) {
+	c.client = append(c.client, b...)
+	for len(c.client) > 0 {
+		if c.chunk > 0 {
+			n := c.chunk
+			if n > len(c.client) {
+				n = len(c.client)
+			}
+			c.chunk -= n
+			c.dataSize += n
+			c.client = c.client[n:]
+			if c.chunk == 0 {
+				c.recordData()
+			}
+			continue
+		}
+		i := strings.Index(string(c.client), "\n")
+		if i < 0 {
+			break
+		}
+		c.command(strings.TrimRight(string(c.client[:i]), "\r"), i+1)
+		c.client = c.client[i+1:]
+	}
+	return c.Conn.Write(b)
+}
+
+// Records the line \a line, which the client sent as \a n bytes.
+func (c *transcriptConn) command(line string, n int) {
+	if c.data {
+		if line != "." {
+			c.dataSize += n
+			return
+		}
+		c.data = false
+		c.recordData()
+	}
+	word := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+	switch {
+	case c.authenticating:
+		line = "[redacted]"
+	case word == "AUTH":
+		c.authenticating = true
+		if f := strings.Fields(line); len(f) > 2 {
+			line = f[0] + " " + f[1] + " [redacted]"
+		}
+	case word == "DATA":
+		c.dataPending = true
+	case word == "BDAT":
+		if f := strings.Fields(line); len(f) > 1 {
+			c.chunk, _ = strconv.Atoi(f[1])
+		}
+	}
+	c.lines = append(c.lines, "C: "+line)
+}
+
+// Records \a line, which the server sent.
+func (c *transcriptConn) reply(line string) {
+	c.lines = append(c.lines, "S: "+line)
+	if len(line) > 3 && line[3] == '-' {
+		return
+	}
+	if c.authenticating && !strings.HasPrefix(line, "334") {
+		c.authenticating = false
+	}
+	if c.dataPending {
+		c.dataPending = false
+		c.data = strings.HasPrefix(line, "354")
+	}
+}
+
+// Records the size of the message data sent since the last DATA or BDAT.
+func (c *transcriptConn) recordData() {
+	c.lines = append(c.lines, "C: ["+strconv.Itoa(c.dataSize)+" bytes of message data]")
+	c.dataSize = 0
+}
+
+// Starts TLS on the connection of \a client as Client.StartTLS() does, using
+// \a config, and returns a new client which uses it and has greeted the
+// server as \a hello. The returned client records the commands and replies
+// in the clear, whereas \a client must no longer be used. If an error is
+// returned, so is a client which can be closed.
+//
+// net/smtp wraps its connection in TLS itself, so that this connection
+// would only see the encrypted data; instead, the TLS connection is made
+// below this one, and the server's greeting, which a new client expects,
+// is supplied here.
+func (c *transcriptConn) startTLS(client *smtp.Client, config *tls.Config, host, hello string) (*smtp.Client, error) {
+	id, err := client.Text.Cmd("STARTTLS")
+	if err != nil {
+		return client, err
+	}
+	client.Text.StartResponse(id)
+	_, _, err = client.Text.ReadResponse(220)
+	client.Text.EndResponse(id)
+	if err != nil {
+		return client, err
+	}
+	conn := tls.Client(c.Conn, config)
+	if err := conn.Handshake(); err != nil {
+		return client, err
+	}
+	c.Conn = conn
+	c.tls = true
+	c.lines = append(c.lines, "[TLS started]")
+	c.greeting = "220 " + host + "\r\n"
+	next, err := smtp.NewClient(c, host)
+	if err != nil {
+		return client, err
+	}
+	return next, next.Hello(hello)
+}
+
+// An smtp.Auth which tells the one it wraps that the connection is
+// encrypted, since a client using a transcriptConn does not know.
+type tlsAuth struct {
+	smtp.Auth
+}
+
+func (a tlsAuth) Start(server *smtp.ServerInfo) (string, []byte, error) {
+	s := *server
+	s.TLS = true
+	return a.Auth.Start(&s)
+}
+
+// A TranscriptError is returned by SMTPTransport.Send() when sending fails
+// and the transport records transcripts. Err is the error and Transcript the
+// SMTP session up to it, as SMTPTransport.SendWithTranscript() returns it.
+type TranscriptError struct {
+	Err        error
+	Transcript string
+}
+
+func (e *TranscriptError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TranscriptError) Unwrap() error {
+	return e.Err
+}
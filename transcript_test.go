@@ -0,0 +1,114 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"net"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSMTPTranscript(t *testing.T) {
+	certs := httptest.NewTLSServer(nil)
+	defer certs.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer func() { conn.Close() }()
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("220 mx.example ESMTP\r\n"))
+		data := false
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimSpace(line)
+			switch {
+			case data:
+				if line == "." {
+					data = false
+					conn.Write([]byte("554 5.7.1 Message rejected as spam\r\n"))
+				}
+			case strings.HasPrefix(line, "EHLO"):
+				if _, ok := conn.(*tls.Conn); ok {
+					conn.Write([]byte("250-mx.example\r\n250 AUTH PLAIN\r\n"))
+				} else {
+					conn.Write([]byte("250-mx.example\r\n250 STARTTLS\r\n"))
+				}
+			case line == "STARTTLS":
+				conn.Write([]byte("220 go ahead\r\n"))
+				conn = tls.Server(conn, certs.TLS)
+				r = bufio.NewReader(conn)
+			case strings.HasPrefix(line, "AUTH"):
+				conn.Write([]byte("235 2.7.0 ok\r\n"))
+			case line == "DATA":
+				data = true
+				conn.Write([]byte("354 go ahead\r\n"))
+			case line == "QUIT":
+				conn.Write([]byte("221 bye\r\n"))
+				return
+			default:
+				conn.Write([]byte("250 ok\r\n"))
+			}
+		}
+	}()
+
+	tr := &mail.SMTPTransport{
+		Addr:       l.Addr().String(),
+		HelloName:  "client.example",
+		TLSConfig:  &tls.Config{InsecureSkipVerify: true},
+		Auth:       smtp.PlainAuth("", "alice", "secret", "127.0.0.1"),
+		Transcript: true,
+	}
+	env := mail.Envelope{From: "alice@example.com", To: []string{"bob@example.com"}}
+	err = tr.Send(env, "Subject: hi\r\n\r\nHello\r\n")
+	var te *mail.TranscriptError
+	if !errors.As(err, &te) {
+		t.Fatalf("expected a TranscriptError, got %v", err)
+	}
+	testStringEquals(t, "transcript", te.Transcript,
+		"S: 220 mx.example ESMTP\n"+
+			"C: EHLO client.example\n"+
+			"S: 250-mx.example\n"+
+			"S: 250 STARTTLS\n"+
+			"C: STARTTLS\n"+
+			"S: 220 go ahead\n"+
+			"[TLS started]\n"+
+			"C: EHLO client.example\n"+
+			"S: 250-mx.example\n"+
+			"S: 250 AUTH PLAIN\n"+
+			"C: AUTH PLAIN [redacted]\n"+
+			"S: 235 2.7.0 ok\n"+
+			"C: MAIL FROM:<alice@example.com>\n"+
+			"S: 250 ok\n"+
+			"C: RCPT TO:<bob@example.com>\n"+
+			"S: 250 ok\n"+
+			"C: DATA\n"+
+			"S: 354 go ahead\n"+
+			"C: [22 bytes of message data]\n"+
+			"C: .\n"+
+			"S: 554 5.7.1 Message rejected as spam\n")
+	if strings.Contains(te.Transcript, base64.StdEncoding.EncodeToString([]byte("\x00alice\x00secret"))) {
+		t.Error("the transcript contains the credentials")
+	}
+	if s, ok := mail.SMTPStatusFromError(err); !ok || s.Code != 554 {
+		t.Errorf("status behind the transcript: %v, %v", s, ok)
+	}
+}
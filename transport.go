@@ -0,0 +1,16 @@
+package mail
+
+// A Transport delivers a message to the recipients of its envelope, so
+// that a program can send mail through whatever its host offers: an SMTP
+// relay, the local sendmail binary, or a mailbox on disk.
+//
+// Only the envelope's From and To are used. \a rfc5322 is sent as it is;
+// it should use CRLF line endings, as Message.RFC822() does.
+type Transport interface {
+	Send(env Envelope, rfc5322 string) error
+}
+
+// Sends \a m to the recipients of \a env using \a t.
+func Deliver(t Transport, m *Message, env Envelope) error {
+	return t.Send(env, m.RFC822(false))
+}
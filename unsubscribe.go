@@ -0,0 +1,110 @@
+package mail
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+)
+
+const ListUnsubscribePostFieldName = "List-Unsubscribe-Post"
+
+// The only value RFC 8058 allows in List-Unsubscribe-Post.
+const oneClickUnsubscribe = "List-Unsubscribe=One-Click"
+
+// An Unsubscriber adds the List-Unsubscribe (RFC 2369) and
+// List-Unsubscribe-Post (RFC 8058) fields which the large mailbox providers
+// require of bulk mail, so that recipients can unsubscribe with one click.
+//
+// Mailto is the address to which unsubscribe requests may be mailed, e.g.
+// "unsubscribe@example.com", and URL the https URL of the handler which
+// unsubscribes on a POST request. Either may be empty, but without URL there
+// is no one-click unsubscription. Token returns the token identifying
+// \a recipient, e.g. a signed ID; it is passed as the subject of the mailto:
+// URL and as the parameter "t" of URL, and is called once per message.
+type Unsubscriber struct {
+	Mailto string
+	URL    string
+	Token  func(recipient string) (string, error)
+}
+
+// Returns a Transform which replaces the List-Unsubscribe and
+// List-Unsubscribe-Post fields of a message with ones for \a recipient, as
+// described for Unsubscriber, e.g. for use in Composer.Transforms. The
+// Transform returns an error if the Unsubscriber's URL is not an https URL.
+func (u *Unsubscriber) Transform(recipient string) Transform {
+	return func(m *Message) error {
+		if u.URL != "" && !strings.HasPrefix(strings.ToLower(u.URL), "https://") {
+			return errors.New("mail: unsubscribe URL is not https: " + u.URL)
+		}
+		if u.Mailto == "" && u.URL == "" {
+			return errors.New("mail: no unsubscribe address or URL")
+		}
+		token, err := u.Token(recipient)
+		if err != nil {
+			return err
+		}
+		var urls []string
+		if u.Mailto != "" {
+			subject := strings.Replace(url.QueryEscape("unsubscribe "+token), "+", "%20", -1)
+			urls = append(urls, "<mailto:"+u.Mailto+"?subject="+subject+">")
+		}
+		if u.URL != "" {
+			urls = append(urls, "<"+withQuery(u.URL, url.Values{"t": {token}})+">")
+		}
+		m.Header.RemoveAllNamed(ListUnsubscribeFieldName)
+		m.Header.RemoveAllNamed(ListUnsubscribePostFieldName)
+		m.Header.Add(ListUnsubscribeFieldName, strings.Join(urls, ", "))
+		if u.URL != "" {
+			m.Header.Add(ListUnsubscribePostFieldName, oneClickUnsubscribe)
+		}
+		return nil
+	}
+}
+
+// Returns nil if this message offers one-click unsubscription as RFC 8058
+// describes it, and an error matching ErrMissingUnsubscribe saying what is
+// wrong otherwise: List-Unsubscribe must contain an https URL, and
+// List-Unsubscribe-Post must be "List-Unsubscribe=One-Click".
+//
+// CheckUnsubscribe() is meant as a check before bulk mail is sent. Since its
+// type is that of a Transform, (*Message).CheckUnsubscribe may be added to
+// Composer.Transforms after an Unsubscriber's Transform().
+func (m *Message) CheckUnsubscribe() error {
+	h := m.Header
+	if h == nil || h.Get(ListUnsubscribeFieldName) == "" {
+		return wrapError(ErrMissingUnsubscribe, "mail: no List-Unsubscribe field")
+	}
+	https := false
+	for _, u := range listURLs(h.Get(ListUnsubscribeFieldName)) {
+		if strings.HasPrefix(strings.ToLower(u), "https://") {
+			https = true
+		}
+	}
+	if !https {
+		return wrapError(ErrMissingUnsubscribe,
+			"mail: List-Unsubscribe contains no https URL")
+	}
+	post := h.Get(ListUnsubscribePostFieldName)
+	if post == "" {
+		return wrapError(ErrMissingUnsubscribe, "mail: no List-Unsubscribe-Post field")
+	}
+	if strings.TrimSpace(post) != oneClickUnsubscribe {
+		return wrapError(ErrMissingUnsubscribe,
+			"mail: List-Unsubscribe-Post is %q, not %q", post, oneClickUnsubscribe)
+	}
+	return nil
+}
+
+// Returns all URLs in the RFC 2369 field value \a v, in order.
+func listURLs(v string) []string {
+	var r []string
+	for {
+		u := firstListURL(v)
+		if u == "" {
+			return r
+		}
+		r = append(r, u)
+		open := strings.IndexByte(v, '<')
+		v = v[open+strings.IndexByte(v[open:], '>')+1:]
+	}
+}
@@ -0,0 +1,61 @@
+package mail_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestUnsubscriber(t *testing.T) {
+	u := &mail.Unsubscriber{
+		Mailto: "unsubscribe@example.com",
+		URL:    "https://example.com/unsubscribe",
+		Token: func(rcpt string) (string, error) {
+			return "tok-" + strings.Split(rcpt, "@")[0], nil
+		},
+	}
+	c := mail.NewComposer()
+	c.Header.Add("From", "news@example.com")
+	c.Header.Add(mail.ListUnsubscribeFieldName, "<mailto:old@example.com>")
+	c.Text = "News"
+	c.Transforms = []mail.Transform{u.Transform("bob@example.com"), (*mail.Message).CheckUnsubscribe}
+	m, err := c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "List-Unsubscribe", m.Header.Get(mail.ListUnsubscribeFieldName),
+		"<mailto:unsubscribe@example.com?subject=unsubscribe%20tok-bob>, "+
+			"<https://example.com/unsubscribe?t=tok-bob>")
+	testStringEquals(t, "List-Unsubscribe-Post", m.Header.Get(mail.ListUnsubscribePostFieldName),
+		"List-Unsubscribe=One-Click")
+	n := 0
+	for _, f := range m.Header.Fields {
+		if f.Name() == mail.ListUnsubscribeFieldName {
+			n++
+		}
+	}
+	testIntegerEquals(t, "List-Unsubscribe fields", n, 1)
+
+	u.URL = ""
+	_, err = c.Compose()
+	if !errors.Is(err, mail.ErrMissingUnsubscribe) {
+		t.Errorf("expected ErrMissingUnsubscribe without an https URL, got %v", err)
+	}
+	u.URL = "http://example.com/unsubscribe"
+	if _, err = c.Compose(); err == nil || errors.Is(err, mail.ErrMissingUnsubscribe) {
+		t.Errorf("expected an error about the http URL, got %v", err)
+	}
+
+	c.Transforms = nil
+	m, err = c.Compose()
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.Header.Add(mail.ListUnsubscribeFieldName, "<https://example.com/u?t=1>")
+	m.Header.Add(mail.ListUnsubscribePostFieldName, "List-Unsubscribe=Yes")
+	if err := m.CheckUnsubscribe(); !errors.Is(err, mail.ErrMissingUnsubscribe) {
+		t.Errorf("expected ErrMissingUnsubscribe for a wrong Post value, got %v", err)
+	}
+}
@@ -0,0 +1,405 @@
+package mail
+
+import (
+	"strconv"
+	"strings"
+)
+
+const (
+	ReceivedSPFFieldName   = "Received-SPF"
+	XSpamStatusFieldName   = "X-Spam-Status"
+	XSpamFlagFieldName     = "X-Spam-Flag"
+	XSpamScoreFieldName    = "X-Spam-Score"
+	XSpamReportFieldName   = "X-Spam-Report"
+	XSpamdResultFieldName  = "X-Spamd-Result"
+	XRspamdActionFieldName = "X-Rspamd-Action"
+)
+
+// An SPFResult is the content of a Received-SPF field (RFC 7208 section
+// 9.1).
+//
+// Result is the lower-cased result, e.g. "pass" or "softfail". Params
+// contains all key-value pairs with lower-cased keys; the common ones are
+// also available as struct fields.
+type SPFResult struct {
+	Result       string            `json:"result"`
+	Comment      string            `json:"comment,omitempty"`
+	ClientIP     string            `json:"clientIP,omitempty"`
+	EnvelopeFrom string            `json:"envelopeFrom,omitempty"`
+	Helo         string            `json:"helo,omitempty"`
+	Receiver     string            `json:"receiver,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+}
+
+// Parses the value of a Received-SPF field. Returns nil if \a s does not
+// start with a result.
+func ParseReceivedSPF(s string) *SPFResult {
+	s = simplify(s)
+	i := 0
+	for i < len(s) && s[i] != ' ' && s[i] != '(' && s[i] != ';' {
+		i++
+	}
+	if i == 0 {
+		return nil
+	}
+	r := &SPFResult{Result: strings.ToLower(s[:i]), Params: map[string]string{}}
+	s = strings.TrimSpace(s[i:])
+
+	if strings.HasPrefix(s, "(") {
+		depth := 0
+		i = 0
+		for i < len(s) {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '(' {
+				depth++
+			} else if s[i] == ')' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+			i++
+		}
+		if i >= len(s) {
+			r.Comment = s[1:]
+			s = ""
+		} else {
+			r.Comment = s[1:i]
+			s = s[i+1:]
+		}
+	}
+
+	for k, v := range parseKeyValues(s) {
+		r.Params[k] = v
+	}
+	r.ClientIP = r.Params["client-ip"]
+	r.EnvelopeFrom = r.Params["envelope-from"]
+	r.Helo = r.Params["helo"]
+	r.Receiver = r.Params["receiver"]
+	return r
+}
+
+// Parses a semicolon-separated list of key=value pairs, where values may be
+// quoted strings. Keys are lower-cased.
+func parseKeyValues(s string) map[string]string {
+	r := map[string]string{}
+	i := 0
+	for i < len(s) {
+		for i < len(s) && (s[i] == ' ' || s[i] == ';') {
+			i++
+		}
+		k := i
+		for i < len(s) && s[i] != '=' && s[i] != ';' {
+			i++
+		}
+		if i >= len(s) || s[i] != '=' {
+			continue
+		}
+		key := strings.ToLower(strings.TrimSpace(s[k:i]))
+		i++
+		for i < len(s) && s[i] == ' ' {
+			i++
+		}
+		value := ""
+		if i < len(s) && s[i] == '"' {
+			v := i
+			i++
+			for i < len(s) && s[i] != '"' {
+				if s[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			if i < len(s) {
+				i++
+			}
+			value = unquote(s[v:i], '"', '\\')
+		} else {
+			v := i
+			for i < len(s) && s[i] != ';' {
+				i++
+			}
+			value = strings.TrimSpace(s[v:i])
+		}
+		if key != "" {
+			r[key] = value
+		}
+	}
+	return r
+}
+
+// Returns the Received-SPF fields in this Header, parsed, most recent (i.e.
+// topmost) first. Unparseable fields are skipped.
+func (h *Header) ReceivedSPF() []*SPFResult {
+	r := []*SPFResult{}
+	for _, f := range h.Fields {
+		if strings.EqualFold(f.Name(), ReceivedSPFFieldName) {
+			if spf := ParseReceivedSPF(f.Value()); spf != nil {
+				r = append(r, spf)
+			}
+		}
+	}
+	return r
+}
+
+// A SpamTest is a single rule which matched, as reported by a spam filter.
+type SpamTest struct {
+	Name        string  `json:"name"`
+	Score       float64 `json:"score"`
+	Description string  `json:"description,omitempty"`
+}
+
+// A SpamStatus is SpamAssassin's verdict, as recorded in the X-Spam-Status,
+// X-Spam-Flag, X-Spam-Score and X-Spam-Report fields.
+//
+// Test scores are only known if SpamAssassin was configured to include them
+// in X-Spam-Status or added an X-Spam-Report field.
+type SpamStatus struct {
+	Spam      bool       `json:"spam"`
+	Score     float64    `json:"score"`
+	Required  float64    `json:"required"`
+	Tests     []SpamTest `json:"tests,omitempty"`
+	Autolearn string     `json:"autolearn,omitempty"`
+	Version   string     `json:"version,omitempty"`
+}
+
+// Parses the value of an X-Spam-Status field, e.g. "Yes, score=7.3
+// required=5.0 tests=BAYES_99,HTML_MESSAGE autolearn=no version=3.4.2".
+// Returns nil if \a s does not start with "yes" or "no".
+func ParseSpamStatus(s string) *SpamStatus {
+	s = simplify(s)
+	comma := strings.IndexByte(s, ',')
+	if comma < 0 {
+		comma = len(s)
+	}
+	r := &SpamStatus{}
+	switch strings.ToLower(strings.TrimSpace(s[:comma])) {
+	case "yes":
+		r.Spam = true
+	case "no":
+	default:
+		return nil
+	}
+	if comma == len(s) {
+		return r
+	}
+
+	words := strings.Fields(s[comma+1:])
+	for i := 0; i < len(words); i++ {
+		eq := strings.IndexByte(words[i], '=')
+		if eq < 0 {
+			continue
+		}
+		key := strings.ToLower(words[i][:eq])
+		value := words[i][eq+1:]
+		switch key {
+		case "score", "hits":
+			r.Score, _ = strconv.ParseFloat(value, 64)
+		case "required":
+			r.Required, _ = strconv.ParseFloat(value, 64)
+		case "autolearn":
+			r.Autolearn = value
+		case "version":
+			r.Version = value
+		case "tests":
+			// folding may have put spaces after the commas
+			for i+1 < len(words) && (strings.HasSuffix(value, ",") ||
+				strings.HasPrefix(words[i+1], ",")) {
+				i++
+				value += words[i]
+			}
+			value = strings.Trim(value, "[]")
+			for _, t := range strings.Split(value, ",") {
+				if t == "" || t == "none" {
+					continue
+				}
+				test := SpamTest{Name: t}
+				if eq := strings.IndexByte(t, '='); eq > 0 {
+					test.Name = t[:eq]
+					test.Score, _ = strconv.ParseFloat(t[eq+1:], 64)
+				}
+				r.Tests = append(r.Tests, test)
+			}
+		}
+	}
+	return r
+}
+
+// Adds the scores and descriptions in the X-Spam-Report text \a report to
+// this SpamStatus.
+//
+// A report contains one line per test, e.g.
+// " *  0.8 BAYES_50 BODY: Bayes spam probability is 40 to 60%", where long
+// descriptions continue on the following lines.
+func (s *SpamStatus) addReport(report string) {
+	var last *SpamTest
+	for _, l := range splitLines(report) {
+		l = strings.TrimSpace(l)
+		l = strings.TrimSpace(strings.TrimPrefix(l, "*"))
+		words := strings.Fields(l)
+		score := 0.0
+		var err error
+		if len(words) >= 2 {
+			score, err = strconv.ParseFloat(words[0], 64)
+		}
+		if len(words) < 2 || err != nil || !isSpamTestName(words[1]) {
+			if last != nil && l != "" && !strings.HasPrefix(l, "---") {
+				last.Description += " " + l
+			}
+			continue
+		}
+		description := strings.TrimSpace(strings.Join(words[2:], " "))
+		last = nil
+		for i := range s.Tests {
+			if s.Tests[i].Name == words[1] {
+				last = &s.Tests[i]
+			}
+		}
+		if last == nil {
+			s.Tests = append(s.Tests, SpamTest{Name: words[1]})
+			last = &s.Tests[len(s.Tests)-1]
+		}
+		last.Score = score
+		last.Description = description
+	}
+}
+
+// Returns true if \a s looks like the name of a SpamAssassin rule.
+func isSpamTestName(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !(c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Returns SpamAssassin's verdict on this message, or nil if there is no
+// X-Spam-Status or X-Spam-Flag field.
+func (h *Header) SpamAssassin() *SpamStatus {
+	var r *SpamStatus
+	if f := h.field(XSpamStatusFieldName, 0); f != nil {
+		r = ParseSpamStatus(f.Value())
+	}
+	if r == nil {
+		f := h.field(XSpamFlagFieldName, 0)
+		if f == nil {
+			return nil
+		}
+		r = &SpamStatus{Spam: strings.ToLower(strings.TrimSpace(f.Value())) == "yes"}
+		if f := h.field(XSpamScoreFieldName, 0); f != nil {
+			r.Score, _ = strconv.ParseFloat(strings.TrimSpace(f.Value()), 64)
+		}
+	}
+	if f := h.field(XSpamReportFieldName, 0); f != nil {
+		// the line structure matters here, so use the text as read
+		report := f.sourceText()
+		if colon := strings.IndexByte(report, ':'); colon >= 0 {
+			report = report[colon+1:]
+		} else {
+			report = f.Value()
+		}
+		r.addReport(report)
+	}
+	return r
+}
+
+// An RspamdSymbol is a single rule which matched, as reported by Rspamd.
+type RspamdSymbol struct {
+	Name    string   `json:"name"`
+	Score   float64  `json:"score"`
+	Options []string `json:"options,omitempty"`
+}
+
+// An RspamdResult is Rspamd's verdict, as recorded in the X-Spamd-Result
+// and X-Rspamd-Action fields.
+type RspamdResult struct {
+	Metric    string         `json:"metric"`
+	Spam      bool           `json:"spam"`
+	Score     float64        `json:"score"`
+	Threshold float64        `json:"threshold"`
+	Action    string         `json:"action,omitempty"`
+	Symbols   []RspamdSymbol `json:"symbols,omitempty"`
+}
+
+// Parses the value of an X-Spamd-Result field, e.g. "default: False
+// [-0.10 / 15.00]; R_SPF_ALLOW(-0.20)[+ip4:192.0.2.1]; ARC_NA(0.00)[]".
+// Returns nil if \a s does not start with a metric.
+func ParseSpamdResult(s string) *RspamdResult {
+	s = simplify(s)
+	semicolon := strings.IndexByte(s, ';')
+	if semicolon < 0 {
+		semicolon = len(s)
+	}
+	first := s[:semicolon]
+	colon := strings.IndexByte(first, ':')
+	open := strings.IndexByte(first, '[')
+	if colon < 0 || open < colon {
+		return nil
+	}
+	r := &RspamdResult{Metric: strings.TrimSpace(first[:colon])}
+	r.Spam = strings.ToLower(strings.TrimSpace(first[colon+1:open])) == "true"
+	scores := strings.Split(strings.Trim(first[open:], "[] "), "/")
+	r.Score, _ = strconv.ParseFloat(strings.TrimSpace(scores[0]), 64)
+	if len(scores) > 1 {
+		r.Threshold, _ = strconv.ParseFloat(strings.TrimSpace(scores[1]), 64)
+	}
+
+	rest := ""
+	if semicolon < len(s) {
+		rest = s[semicolon+1:]
+	}
+	for len(rest) > 0 {
+		rest = strings.TrimLeft(rest, " ;")
+		paren := strings.IndexByte(rest, '(')
+		if paren <= 0 {
+			break
+		}
+		sym := RspamdSymbol{Name: strings.TrimSpace(rest[:paren])}
+		end := strings.IndexByte(rest[paren:], ')')
+		if end < 0 {
+			break
+		}
+		end += paren
+		sym.Score, _ = strconv.ParseFloat(rest[paren+1:end], 64)
+		rest = rest[end+1:]
+		if strings.HasPrefix(rest, "[") {
+			// options are separated by commas, and the list ends
+			// with ']'
+			end = strings.IndexByte(rest, ']')
+			if end < 0 {
+				end = len(rest)
+			}
+			for _, o := range strings.Split(rest[1:end], ",") {
+				if o = strings.TrimSpace(o); o != "" {
+					sym.Options = append(sym.Options, o)
+				}
+			}
+			if end < len(rest) {
+				end++
+			}
+			rest = rest[end:]
+		}
+		r.Symbols = append(r.Symbols, sym)
+	}
+	return r
+}
+
+// Returns Rspamd's verdict on this message, or nil if there is no
+// X-Spamd-Result field.
+func (h *Header) Rspamd() *RspamdResult {
+	f := h.field(XSpamdResultFieldName, 0)
+	if f == nil {
+		return nil
+	}
+	r := ParseSpamdResult(f.Value())
+	if r == nil {
+		return nil
+	}
+	if f := h.field(XRspamdActionFieldName, 0); f != nil {
+		r.Action = strings.TrimSpace(f.Value())
+	}
+	return r
+}
@@ -0,0 +1,70 @@
+package mail_test
+
+import (
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestFilterVerdicts(t *testing.T) {
+	h, err := mail.ReadHeader("Received-SPF: pass (mybox.example.org: domain of\r\n"+
+		" myname@example.com designates 192.0.2.1 as permitted sender)\r\n"+
+		" receiver=mybox.example.org; client-ip=192.0.2.1;\r\n"+
+		" envelope-from=\"myname@example.com\"; helo=foo.example.com;\r\n"+
+		"X-Spam-Status: Yes, score=7.3 required=5.0 tests=BAYES_99,\r\n"+
+		"\tHTML_MESSAGE autolearn=no version=3.4.2\r\n"+
+		"X-Spam-Report:\r\n"+
+		"\t*  3.5 BAYES_99 BODY: Bayes spam probability is 99 to\r\n"+
+		"\t*      100%\r\n"+
+		"\t*  0.0 HTML_MESSAGE BODY: HTML included in message\r\n"+
+		"X-Spamd-Result: default: False [-0.10 / 15.00];\r\n"+
+		"\tR_SPF_ALLOW(-0.20)[+ip4:192.0.2.1]; ARC_NA(0.00)[]\r\n"+
+		"\r\n", mail.RFC5322Header)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spf := h.ReceivedSPF()
+	if len(spf) != 1 {
+		t.Fatalf("expected one Received-SPF result, got %d", len(spf))
+	}
+	testStringEquals(t, "SPF result", spf[0].Result, "pass")
+	testStringEquals(t, "SPF client-ip", spf[0].ClientIP, "192.0.2.1")
+	testStringEquals(t, "SPF envelope-from", spf[0].EnvelopeFrom, "myname@example.com")
+
+	sa := h.SpamAssassin()
+	if sa == nil || !sa.Spam || sa.Score != 7.3 || sa.Required != 5.0 {
+		t.Fatalf("unexpected SpamAssassin status: %+v", sa)
+	}
+	if len(sa.Tests) != 2 {
+		t.Fatalf("expected 2 tests, got %+v", sa.Tests)
+	}
+	testStringEquals(t, "test description", sa.Tests[0].Description,
+		"BODY: Bayes spam probability is 99 to 100%")
+	if sa.Tests[0].Score != 3.5 {
+		t.Errorf("incorrect BAYES_99 score: %v", sa.Tests[0].Score)
+	}
+
+	rs := h.Rspamd()
+	if rs == nil || rs.Spam || rs.Score != -0.1 || rs.Threshold != 15 {
+		t.Fatalf("unexpected Rspamd result: %+v", rs)
+	}
+	if len(rs.Symbols) != 2 || rs.Symbols[0].Name != "R_SPF_ALLOW" ||
+		rs.Symbols[0].Score != -0.2 || len(rs.Symbols[0].Options) != 1 {
+		t.Errorf("unexpected Rspamd symbols: %+v", rs.Symbols)
+	}
+}
+
+func TestReceivedSPFSpelling(t *testing.T) {
+	for _, name := range []string{"Received-SPF", "received-spf", "RECEIVED-SPF", "Received-Spf"} {
+		h, err := mail.ReadHeader(name+": fail client-ip=192.0.2.1;\r\n\r\n", mail.RFC5322Header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		spf := h.ReceivedSPF()
+		if len(spf) != 1 {
+			t.Fatalf("%s: expected one Received-SPF result, got %d", name, len(spf))
+		}
+		testStringEquals(t, name, spf[0].Result, "fail")
+	}
+}
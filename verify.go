@@ -0,0 +1,326 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"errors"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Deliverability is the outcome of verifying an address with a Verifier.
+type Deliverability int
+
+const (
+	// The server could not be reached, or gave a temporary failure
+	// (e.g. because of greylisting).
+	DeliverabilityUnknown Deliverability = iota
+	// The server accepted the address.
+	Deliverable
+	// The server rejected the address, or the domain does not accept mail.
+	Undeliverable
+	// The server accepts any address in the domain, so acceptance says
+	// nothing about this one.
+	CatchAll
+)
+
+func (d Deliverability) String() string {
+	switch d {
+	case Deliverable:
+		return "deliverable"
+	case Undeliverable:
+		return "undeliverable"
+	case CatchAll:
+		return "catch-all"
+	}
+	return "unknown"
+}
+
+func (d Deliverability) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// A Verification is the result of verifying one address. MX is the server
+// which answered, and Code and Message its reply to RCPT TO, if it got that
+// far.
+type Verification struct {
+	Address        string         `json:"address"`
+	Deliverability Deliverability `json:"deliverability"`
+	MX             string         `json:"mx,omitempty"`
+	Code           int            `json:"code,omitempty"`
+	Message        string         `json:"message,omitempty"`
+	Cached         bool           `json:"cached,omitempty"`
+}
+
+// A Verifier checks whether addresses can receive mail, by looking up the
+// MX records of their domains and asking the servers whether they would
+// accept mail for them ("SMTP callouts"), without sending any. It is meant
+// for cleaning mailing lists; many servers regard frequent callouts as
+// abuse, so results are cached and callouts to each domain are spaced out.
+//
+// HeloName is the name given in EHLO, and MailFrom the envelope sender
+// (which may be empty, for the null sender). Each callout to a domain waits
+// until MinInterval has passed since the previous one. Results other than
+// DeliverabilityUnknown are kept for CacheTTL. Timeout limits each
+// conversation.
+//
+// To detect catch-all domains, the verifier also asks for a random address
+// in the domain, once per domain per CacheTTL.
+//
+// Resolver looks up MX records; if nil, DefaultResolver is used. LookupMX,
+// if not nil, is used instead of Resolver. Dial defaults to a dialer with
+// Timeout, and may be replaced, e.g. to use a SOCKS proxy. If TLSPolicy is
+// not nil, callouts use STARTTLS as it says; otherwise they do not.
+// A Verifier is safe for concurrent use.
+type Verifier struct {
+	HeloName    string
+	MailFrom    string
+	Timeout     time.Duration
+	MinInterval time.Duration
+	CacheTTL    time.Duration
+
+	Resolver Resolver
+	LookupMX func(domain string) ([]*net.MX, error)
+	Dial     func(network, address string) (net.Conn, error)
+
+	TLSPolicy *TLSPolicy
+
+	mu       sync.Mutex
+	cache    map[string]verifierEntry
+	catchAll map[string]verifierEntry
+	next     map[string]time.Time
+}
+
+type verifierEntry struct {
+	v       Verification
+	expires time.Time
+}
+
+// Returns a new Verifier which introduces itself as \a heloName and uses
+// \a mailFrom as envelope sender, with conservative defaults: one callout
+// per domain every two seconds, results cached for a day, and a timeout of
+// 30 seconds.
+func NewVerifier(heloName, mailFrom string) *Verifier {
+	return &Verifier{
+		HeloName:    heloName,
+		MailFrom:    mailFrom,
+		Timeout:     30 * time.Second,
+		MinInterval: 2 * time.Second,
+		CacheTTL:    24 * time.Hour,
+	}
+}
+
+// Verifies \a a. Returns an error only if \a a is not a complete address;
+// network and protocol failures result in DeliverabilityUnknown.
+func (v *Verifier) Verify(a Address) (*Verification, error) {
+	if a.Localpart == "" || a.Domain == "" {
+		return nil, errors.New("mail: cannot verify an address without a domain")
+	}
+	addr := a.lpdomain()
+	key := strings.ToLower(addr)
+	domain := strings.ToLower(a.Domain)
+
+	if r, ok := v.cached(false, key); ok {
+		return r, nil
+	}
+
+	hosts, err := v.mxHosts(domain)
+	if err != nil {
+		return &Verification{Address: addr, Message: err.Error()}, nil
+	}
+	if len(hosts) == 0 {
+		// a null MX (RFC 7505): the domain accepts no mail
+		r := &Verification{Address: addr, Deliverability: Undeliverable,
+			Message: "domain does not accept mail"}
+		v.store(false, key, r)
+		return r, nil
+	}
+
+	_, knowCatchAll := v.cached(true, domain)
+	probe := ""
+	if !knowCatchAll {
+		probe = "verify-" + randomHex(8) + "@" + a.Domain
+	}
+
+	v.wait(domain)
+	r, probeAccepted := v.callout(hosts, addr, probe)
+	if probe != "" && r.Deliverability != DeliverabilityUnknown {
+		c := Verification{Address: domain}
+		if probeAccepted {
+			c.Deliverability = CatchAll
+		}
+		v.store(true, domain, &c)
+	}
+	if r.Deliverability == Deliverable {
+		if c, ok := v.cached(true, domain); ok && c.Deliverability == CatchAll {
+			r.Deliverability = CatchAll
+		}
+	}
+	if r.Deliverability != DeliverabilityUnknown {
+		v.store(false, key, r)
+	}
+	return r, nil
+}
+
+// Returns the hosts which receive mail for \a domain, most preferred first.
+// Returns an empty list if the domain has a null MX.
+func (v *Verifier) mxHosts(domain string) ([]string, error) {
+	lookup := v.LookupMX
+	if lookup == nil && v.Resolver != nil {
+		lookup = v.Resolver.LookupMX
+	} else if lookup == nil {
+		lookup = DefaultResolver.LookupMX
+	}
+	return lookupMXHosts(lookup, domain)
+}
+
+// Asks the first of \a hosts which answers whether it accepts \a addr and,
+// if \a probe is not empty, \a probe. Returns the result for \a addr and
+// whether \a probe was accepted.
+func (v *Verifier) callout(hosts []string, addr, probe string) (*Verification, bool) {
+	r := &Verification{Address: addr}
+	for _, host := range hosts {
+		r.MX = host
+		c, err := v.connect(host)
+		if err != nil {
+			r.Message = err.Error()
+			continue
+		}
+		defer c.Close()
+
+		// a rejection before RCPT TO says nothing about the address
+		if err := c.Hello(v.HeloName); err != nil {
+			r.Message = err.Error()
+			return r, false
+		}
+		if err := v.startTLS(c, host); err != nil {
+			r.Message = err.Error()
+			return r, false
+		}
+		if err := c.Mail(v.MailFrom); err != nil {
+			r.Message = err.Error()
+			return r, false
+		}
+		r = replyResult(r, c.Rcpt(addr))
+		accepted := false
+		if probe != "" && r.Deliverability != DeliverabilityUnknown {
+			accepted = c.Rcpt(probe) == nil
+		}
+		c.Quit()
+		return r, accepted
+	}
+	return r, false
+}
+
+// Connects to the SMTP server at \a host.
+func (v *Verifier) connect(host string) (*smtp.Client, error) {
+	dial := v.Dial
+	if dial == nil {
+		d := &net.Dialer{Timeout: v.Timeout}
+		dial = d.Dial
+	}
+	conn, err := dial("tcp", net.JoinHostPort(host, "25"))
+	if err != nil {
+		return nil, err
+	}
+	if v.Timeout > 0 {
+		conn.SetDeadline(time.Now().Add(v.Timeout))
+	}
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// Starts TLS on \a c, a connection to \a host, as TLSPolicy says, if it is
+// not nil.
+func (v *Verifier) startTLS(c *smtp.Client, host string) error {
+	if v.TLSPolicy == nil {
+		return nil
+	}
+	offered, _ := c.Extension("STARTTLS")
+	config, err := v.TLSPolicy.Config(nil, host, 25, offered)
+	if err != nil || config == nil {
+		return err
+	}
+	return c.StartTLS(config)
+}
+
+// Records the server's reply \a err (nil for success) in \a r, and returns
+// \a r.
+func replyResult(r *Verification, err error) *Verification {
+	if err == nil {
+		r.Deliverability = Deliverable
+		r.Code = 250
+		r.Message = ""
+		return r
+	}
+	r.Message = err.Error()
+	if te, ok := err.(*textproto.Error); ok {
+		r.Code = te.Code
+		r.Message = te.Msg
+		if s, _ := SMTPStatusFromError(err); s.Permanent() {
+			r.Deliverability = Undeliverable
+		}
+	}
+	return r
+}
+
+// Waits until a callout to \a domain is permitted by MinInterval.
+func (v *Verifier) wait(domain string) {
+	v.mu.Lock()
+	if v.next == nil {
+		v.next = map[string]time.Time{}
+	}
+	now := time.Now()
+	t := v.next[domain]
+	if t.Before(now) {
+		t = now
+	}
+	v.next[domain] = t.Add(v.MinInterval)
+	v.mu.Unlock()
+	if d := t.Sub(now); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Returns the cache of addresses, or if \a domains is true, the cache of
+// catch-all domains. Must be called with mu held.
+func (v *Verifier) entries(domains bool) map[string]verifierEntry {
+	if v.cache == nil {
+		v.cache = map[string]verifierEntry{}
+		v.catchAll = map[string]verifierEntry{}
+	}
+	if domains {
+		return v.catchAll
+	}
+	return v.cache
+}
+
+// Returns a copy of the unexpired cache entry for \a key, if there is one.
+// \a domains is as for entries().
+func (v *Verifier) cached(domains bool, key string) (*Verification, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	e, ok := v.entries(domains)[key]
+	if !ok || time.Now().After(e.expires) {
+		return nil, false
+	}
+	r := e.v
+	r.Cached = true
+	return &r, true
+}
+
+// Caches a copy of \a r for \a key. \a domains is as for entries().
+func (v *Verifier) store(domains bool, key string, r *Verification) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.entries(domains)[key] = verifierEntry{v: *r, expires: time.Now().Add(v.CacheTTL)}
+}
@@ -0,0 +1,90 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+// Answers SMTP commands on \a conn, accepting RCPT TO only for the
+// addresses in \a accept, or for any address if \a accept is nil.
+func fakeMX(conn net.Conn, accept map[string]bool) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	conn.Write([]byte("220 mx.example ESMTP\r\n"))
+	for {
+		l, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		l = strings.TrimSpace(l)
+		switch {
+		case strings.HasPrefix(l, "EHLO"), strings.HasPrefix(l, "MAIL"):
+			conn.Write([]byte("250 ok\r\n"))
+		case strings.HasPrefix(l, "RCPT TO:<"):
+			addr := strings.TrimSuffix(l[len("RCPT TO:<"):], ">")
+			if accept == nil || accept[addr] {
+				conn.Write([]byte("250 ok\r\n"))
+			} else {
+				conn.Write([]byte("550 5.1.1 no such user\r\n"))
+			}
+		case l == "QUIT":
+			conn.Write([]byte("221 bye\r\n"))
+			return
+		default:
+			conn.Write([]byte("502 unimplemented\r\n"))
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	v := mail.NewVerifier("verifier.example", "")
+	v.MinInterval = 0
+	v.LookupMX = func(domain string) ([]*net.MX, error) {
+		if domain == "null.example" {
+			return []*net.MX{{Host: ".", Pref: 0}}, nil
+		}
+		return []*net.MX{{Host: "mx2." + domain + ".", Pref: 20},
+			{Host: "mx1." + domain + ".", Pref: 10}}, nil
+	}
+	dials := []string{}
+	v.Dial = func(network, address string) (net.Conn, error) {
+		dials = append(dials, address)
+		if strings.HasPrefix(address, "mx1.") {
+			return nil, errors.New("connection refused")
+		}
+		client, server := net.Pipe()
+		if strings.Contains(address, "all.example") {
+			go fakeMX(server, nil)
+		} else {
+			go fakeMX(server, map[string]bool{"alice@good.example": true})
+		}
+		return client, nil
+	}
+
+	check := func(addr string, want mail.Deliverability, cached bool) {
+		ap := mail.NewAddressParser(addr)
+		r, err := v.Verify(ap.Addresses[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		testStringEquals(t, addr, r.Deliverability.String(), want.String())
+		if r.Cached != cached {
+			t.Errorf("%s: cached is %v", addr, r.Cached)
+		}
+	}
+	check("alice@good.example", mail.Deliverable, false)
+	testStringEquals(t, "fallback", strings.Join(dials, " "), "mx1.good.example:25 mx2.good.example:25")
+	check("bob@good.example", mail.Undeliverable, false)
+	check("Alice@Good.Example", mail.Deliverable, true)
+	check("anyone@all.example", mail.CatchAll, false)
+	check("someone@null.example", mail.Undeliverable, false)
+	testIntegerEquals(t, "dials", len(dials), 6)
+}
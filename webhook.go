@@ -0,0 +1,297 @@
+package mail
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// An Envelope holds what the receiving server knew about a message besides
+// its text: the SMTP envelope and the server's own verdicts.
+//
+// Provider names the service which received the message, e.g. "sendgrid",
+// or is empty for messages received directly by SMTP. ID is that service's
+// identifier for the message. Verdicts holds the service's checks, keyed by
+// lower-case names such as "spf", "dkim" and "spam", with the values it
+// reports, e.g. "pass".
+type Envelope struct {
+	Provider string            `json:"provider,omitempty"`
+	ID       string            `json:"id,omitempty"`
+	From     string            `json:"from"`
+	To       []string          `json:"to"`
+	RemoteIP string            `json:"remoteIP,omitempty"`
+	Received time.Time         `json:"received"`
+	Verdicts map[string]string `json:"verdicts,omitempty"`
+}
+
+// An InboundMessage is a message received by SMTP or through a provider's
+// webhook, together with its envelope.
+type InboundMessage struct {
+	Message  *Message `json:"message"`
+	Envelope Envelope `json:"envelope"`
+}
+
+// Returns an InboundMessage for the message \a rfc5322, received by SMTP
+// with the envelope \a env. The webhook parsers below return the same as
+// this would, had the message been delivered directly.
+func ReadInboundMessage(rfc5322 string, env Envelope) (*InboundMessage, error) {
+	m, err := ReadMessage(rfc5322)
+	if err != nil {
+		return nil, err
+	}
+	if env.Received.IsZero() {
+		env.Received = time.Now()
+	}
+	return &InboundMessage{Message: m, Envelope: env}, nil
+}
+
+// Returns a message with the fields of \a src and a body built from \a text,
+// \a html and \a attachments, for providers which split messages up. The
+// fields describing the original MIME structure are dropped, since the body
+// is rebuilt. The message is then parsed again, so that it is repaired as
+// ReadMessage() would repair the original.
+func inboundMessage(src *Header, text, html string, attachments []*Attachment) (*Message, error) {
+	c := &Composer{Text: text, HTML: html, Attachments: attachments}
+	root, err := c.root()
+	if err != nil {
+		return nil, err
+	}
+	h := &Header{mode: RFC5322Header}
+	for _, f := range src.Fields {
+		switch f.Name() {
+		case MIMEVersionFieldName, ContentTypeFieldName,
+			ContentTransferEncodingFieldName, ContentDispositionFieldName:
+			continue
+		}
+		h.Fields = append(h.Fields, f)
+	}
+	h.Add(MIMEVersionFieldName, "1.0")
+	return ReadMessage(withRoot(h, root).RFC822(false))
+}
+
+// Returns true if \a signature is the signature Mailgun computes with the
+// webhook signing key \a key for \a timestamp and \a token, i.e. if a request
+// carrying these values came from Mailgun. Callers should also reject old
+// timestamps and tokens they have seen before.
+func VerifyMailgunSignature(key, timestamp, token, signature string) bool {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(timestamp + token))
+	want := hex.EncodeToString(mac.Sum(nil))
+	return hmac.Equal([]byte(want), []byte(strings.ToLower(signature)))
+}
+
+// The parts of the JSON body of Postmark's inbound webhook which
+// ParsePostmarkInbound() uses.
+type postmarkInbound struct {
+	From              string
+	To                string
+	Cc                string
+	ReplyTo           string
+	OriginalRecipient string
+	Subject           string
+	MessageID         string
+	Date              string
+	TextBody          string
+	HtmlBody          string
+	RawEmail          string
+	Headers           []struct {
+		Name  string
+		Value string
+	}
+	Attachments []struct {
+		Name        string
+		Content     string
+		ContentType string
+		ContentID   string
+	}
+}
+
+// Parses the JSON \a body of a request made by Postmark's inbound webhook.
+// If the webhook is configured to include the raw message, that is used;
+// otherwise the message is rebuilt from the parsed fields.
+func ParsePostmarkInbound(body []byte) (*InboundMessage, error) {
+	var p postmarkInbound
+	if err := json.Unmarshal(body, &p); err != nil {
+		return nil, err
+	}
+	env := Envelope{
+		Provider: "postmark",
+		ID:       p.MessageID,
+		Received: time.Now(),
+	}
+	if p.OriginalRecipient != "" {
+		env.To = []string{p.OriginalRecipient}
+	}
+
+	src := &Header{mode: RFC5322Header}
+	for _, f := range p.Headers {
+		src.Add(f.Name, f.Value)
+	}
+	// Postmark reports the main fields separately from the others
+	for _, f := range []struct{ name, value string }{
+		{FromFieldName, p.From}, {ToFieldName, p.To}, {CcFieldName, p.Cc},
+		{ReplyToFieldName, p.ReplyTo}, {SubjectFieldName, p.Subject},
+		{DateFieldName, p.Date},
+	} {
+		if f.value != "" && src.field(f.name, 0) == nil {
+			src.Add(f.name, f.value)
+		}
+	}
+	for _, a := range src.Addresses(ReturnPathFieldName) {
+		env.From = a.lpdomain()
+	}
+	if env.From == "" {
+		for _, a := range src.Addresses(FromFieldName) {
+			env.From = a.lpdomain()
+		}
+	}
+
+	if p.RawEmail != "" {
+		return ReadInboundMessage(p.RawEmail, env)
+	}
+
+	attachments := []*Attachment{}
+	for _, a := range p.Attachments {
+		data, err := base64.StdEncoding.DecodeString(a.Content)
+		if err != nil {
+			return nil, errors.New("mail: bad Postmark attachment " + a.Name + ": " + err.Error())
+		}
+		cid := strings.Trim(a.ContentID, "<>")
+		attachments = append(attachments, &Attachment{
+			Filename:    a.Name,
+			ContentType: a.ContentType,
+			Data:        string(data),
+			ContentID:   cid,
+			Inline:      cid != "",
+		})
+	}
+
+	m, err := inboundMessage(src, p.TextBody, p.HtmlBody, attachments)
+	if err != nil {
+		return nil, err
+	}
+	return &InboundMessage{Message: m, Envelope: env}, nil
+}
+
+// An SNSSubscriptionError is returned by ParseSESInbound() when the request
+// is not a notification but asks for an SNS subscription to be confirmed.
+// The subscription is confirmed by fetching URL.
+type SNSSubscriptionError struct {
+	TopicARN string
+	URL      string
+}
+
+func (e *SNSSubscriptionError) Error() string {
+	return "mail: SNS subscription to " + e.TopicARN + " needs confirmation"
+}
+
+// The parts of an SES receipt notification which ParseSESInbound() uses.
+type sesNotification struct {
+	NotificationType string `json:"notificationType"`
+	Mail             struct {
+		Timestamp   time.Time `json:"timestamp"`
+		Source      string    `json:"source"`
+		MessageID   string    `json:"messageId"`
+		Destination []string  `json:"destination"`
+	} `json:"mail"`
+	Receipt struct {
+		Recipients   []string   `json:"recipients"`
+		SpamVerdict  sesVerdict `json:"spamVerdict"`
+		VirusVerdict sesVerdict `json:"virusVerdict"`
+		SPFVerdict   sesVerdict `json:"spfVerdict"`
+		DKIMVerdict  sesVerdict `json:"dkimVerdict"`
+		DMARCVerdict sesVerdict `json:"dmarcVerdict"`
+		Action       struct {
+			Type       string `json:"type"`
+			Encoding   string `json:"encoding"`
+			BucketName string `json:"bucketName"`
+			ObjectKey  string `json:"objectKey"`
+		} `json:"action"`
+	} `json:"receipt"`
+	Content string `json:"content"`
+}
+
+type sesVerdict struct {
+	Status string `json:"status"`
+}
+
+// Parses the JSON \a body of an Amazon SES receipt notification, either as
+// delivered by an SNS HTTP subscription or on its own (e.g. as passed to a
+// Lambda function). Only notifications from an SNS receipt action contain the
+// message; for others, e.g. from an S3 action, an error naming the bucket and
+// key is returned.
+//
+// If \a body asks for a subscription to be confirmed, an
+// *SNSSubscriptionError is returned. The SNS message signature is not
+// checked.
+func ParseSESInbound(body []byte) (*InboundMessage, error) {
+	var sns struct {
+		Type         string
+		TopicArn     string
+		Message      string
+		SubscribeURL string
+	}
+	if err := json.Unmarshal(body, &sns); err != nil {
+		return nil, err
+	}
+	switch sns.Type {
+	case "":
+	case "Notification":
+		body = []byte(sns.Message)
+	case "SubscriptionConfirmation":
+		return nil, &SNSSubscriptionError{TopicARN: sns.TopicArn, URL: sns.SubscribeURL}
+	default:
+		return nil, errors.New("mail: unexpected SNS message type " + sns.Type)
+	}
+
+	var n sesNotification
+	if err := json.Unmarshal(body, &n); err != nil {
+		return nil, err
+	}
+	if n.NotificationType != "Received" {
+		return nil, errors.New("mail: not an SES receipt notification: " + n.NotificationType)
+	}
+	env := Envelope{
+		Provider: "ses",
+		ID:       n.Mail.MessageID,
+		From:     n.Mail.Source,
+		To:       n.Receipt.Recipients,
+		Received: n.Mail.Timestamp,
+		Verdicts: map[string]string{},
+	}
+	if len(env.To) == 0 {
+		env.To = n.Mail.Destination
+	}
+	for name, v := range map[string]sesVerdict{
+		"spam": n.Receipt.SpamVerdict, "virus": n.Receipt.VirusVerdict,
+		"spf": n.Receipt.SPFVerdict, "dkim": n.Receipt.DKIMVerdict,
+		"dmarc": n.Receipt.DMARCVerdict,
+	} {
+		if v.Status != "" {
+			env.Verdicts[name] = strings.ToLower(v.Status)
+		}
+	}
+
+	a := n.Receipt.Action
+	if n.Content == "" {
+		if a.BucketName != "" {
+			return nil, errors.New("mail: SES stored the message in s3://" +
+				a.BucketName + "/" + a.ObjectKey)
+		}
+		return nil, errors.New("mail: SES notification has no content")
+	}
+	raw := n.Content
+	if strings.EqualFold(a.Encoding, "BASE64") {
+		b, err := base64.StdEncoding.DecodeString(n.Content)
+		if err != nil {
+			return nil, errors.New("mail: bad SES content: " + err.Error())
+		}
+		raw = string(b)
+	}
+	return ReadInboundMessage(raw, env)
+}
@@ -0,0 +1,68 @@
+package mail_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestInboundWebhooks(t *testing.T) {
+	postmark := `{"From":"alice@example.com","To":"inbox@example.net",
+		"OriginalRecipient":"inbox@example.net","Subject":"Postmark",
+		"MessageID":"pm-1","Date":"Tue, 1 Sep 2020 10:00:00 +0000",
+		"TextBody":"Hello","HtmlBody":"<p>Hello</p>",
+		"Headers":[{"Name":"Return-Path","Value":"<bounce@example.com>"},
+		           {"Name":"Message-ID","Value":"<2@example.com>"}],
+		"Attachments":[{"Name":"b.bin","Content":"AAEC","ContentType":"application/octet-stream"}]}`
+	in, err := mail.ParsePostmarkInbound([]byte(postmark))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !in.Message.Header.Valid() {
+		t.Fatalf("postmark message is not valid: %v", in.Message.Header.Error())
+	}
+	testStringEquals(t, "postmark from", in.Envelope.From, "bounce@example.com")
+	testStringEquals(t, "postmark id", in.Envelope.ID, "pm-1")
+	testStringEquals(t, "postmark message-id", in.Message.Header.MessageID(), "<2@example.com>")
+	testIntegerEquals(t, "postmark parts", len(in.Message.Parts), 2)
+	testStringEquals(t, "postmark attachment", in.Message.Parts[1].Data, "\x00\x01\x02")
+
+	raw := "From: alice@example.com\r\nTo: inbox@example.net\r\nSubject: SES\r\n" +
+		"Date: Tue, 1 Sep 2020 10:00:00 +0000\r\nMessage-ID: <3@example.com>\r\n\r\nHi\r\n"
+	ses := `{"notificationType":"Received",
+		"mail":{"timestamp":"2020-09-01T10:00:01.000Z","source":"bounce@example.com",
+		        "messageId":"ses-1","destination":["inbox@example.net"]},
+		"receipt":{"recipients":["inbox@example.net"],"spfVerdict":{"status":"PASS"},
+		           "action":{"type":"SNS","encoding":"BASE64"}},
+		"content":"` + base64.StdEncoding.EncodeToString([]byte(raw)) + `"}`
+	sns, _ := json.Marshal(map[string]string{"Type": "Notification", "Message": ses})
+	in, err = mail.ParseSESInbound(sns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct, err := mail.ReadInboundMessage(raw, in.Envelope)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "ses message", in.Message.RFC822(false), direct.Message.RFC822(false))
+	testStringEquals(t, "ses spf", in.Envelope.Verdicts["spf"], "pass")
+	testIntegerEquals(t, "ses received", int(in.Envelope.Received.Unix()), 1598954401)
+
+	confirm := []byte(`{"Type":"SubscriptionConfirmation","TopicArn":"arn:t","SubscribeURL":"https://sns.example/confirm"}`)
+	_, err = mail.ParseSESInbound(confirm)
+	var se *mail.SNSSubscriptionError
+	if !errors.As(err, &se) || se.URL != "https://sns.example/confirm" {
+		t.Errorf("unexpected error for subscription confirmation: %v", err)
+	}
+
+	signature := "6e58d600a4455acec22e2708938c55a46a8ef43c086a60bb43f48d1baef5ea20"
+	if !mail.VerifyMailgunSignature("key", "1598954401", "token", signature) {
+		t.Error("rejected a correct Mailgun signature")
+	}
+	if mail.VerifyMailgunSignature("key", "1598954402", "token", signature) {
+		t.Error("accepted a wrong Mailgun signature")
+	}
+}
@@ -0,0 +1,209 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The most memory ParseSendGridInbound() and ParseMailgunInbound() use for
+// form data before storing it in temporary files.
+const maxWebhookMemory = 32 << 20
+
+// Returns the file uploaded as \a name in \a r, or nil if there is none.
+func formFile(r *http.Request, name string) (*Attachment, error) {
+	if r.MultipartForm == nil || len(r.MultipartForm.File[name]) == 0 {
+		return nil, nil
+	}
+	fh := r.MultipartForm.File[name][0]
+	f, err := fh.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return &Attachment{
+		Filename:    fh.Filename,
+		ContentType: fh.Header.Get("Content-Type"),
+		Data:        string(b),
+	}, nil
+}
+
+// Parses a request made by SendGrid's Inbound Parse webhook, in either its
+// default form (with the message split into fields and attachments) or its
+// raw form (with the whole message in the "email" field).
+func ParseSendGridInbound(r *http.Request) (*InboundMessage, error) {
+	if err := r.ParseMultipartForm(maxWebhookMemory); err != nil {
+		return nil, err
+	}
+	env := Envelope{
+		Provider: "sendgrid",
+		RemoteIP: r.FormValue("sender_ip"),
+		Verdicts: map[string]string{},
+	}
+	var e struct {
+		From string   `json:"from"`
+		To   []string `json:"to"`
+	}
+	if s := r.FormValue("envelope"); s != "" {
+		if err := json.Unmarshal([]byte(s), &e); err != nil {
+			return nil, errors.New("mail: bad SendGrid envelope: " + err.Error())
+		}
+	}
+	env.From, env.To = e.From, e.To
+	if v := r.FormValue("SPF"); v != "" {
+		env.Verdicts["spf"] = strings.ToLower(v)
+	}
+	if v := r.FormValue("dkim"); v != "" {
+		env.Verdicts["dkim"] = v
+	}
+	if v := r.FormValue("spam_score"); v != "" {
+		env.Verdicts["spam"] = v
+	}
+
+	if raw := r.FormValue("email"); raw != "" {
+		return ReadInboundMessage(raw, env)
+	}
+
+	charsets := map[string]string{}
+	if s := r.FormValue("charsets"); s != "" {
+		json.Unmarshal([]byte(s), &charsets)
+	}
+	text := sendGridText(r.FormValue("text"), charsets["text"])
+	html := sendGridText(r.FormValue("html"), charsets["html"])
+
+	info := map[string]struct {
+		Filename  string `json:"filename"`
+		Type      string `json:"type"`
+		ContentID string `json:"content-id"`
+	}{}
+	if s := r.FormValue("attachment-info"); s != "" {
+		json.Unmarshal([]byte(s), &info)
+	}
+	n, _ := strconv.Atoi(r.FormValue("attachments"))
+	attachments := []*Attachment{}
+	for i := 1; i <= n; i++ {
+		name := "attachment" + strconv.Itoa(i)
+		a, err := formFile(r, name)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			continue
+		}
+		if ai, ok := info[name]; ok {
+			if ai.Filename != "" {
+				a.Filename = ai.Filename
+			}
+			if ai.Type != "" {
+				a.ContentType = ai.Type
+			}
+			a.ContentID = strings.Trim(ai.ContentID, "<>")
+			a.Inline = a.ContentID != ""
+		}
+		attachments = append(attachments, a)
+	}
+
+	src, _ := ReadHeader(toCRLF(r.FormValue("headers")), RFC5322Header)
+	m, err := inboundMessage(src, text, html, attachments)
+	if err != nil {
+		return nil, err
+	}
+	env.Received = time.Now()
+	return &InboundMessage{Message: m, Envelope: env}, nil
+}
+
+// Returns \a s, which SendGrid says is in \a charset, as UTF-8.
+func sendGridText(s, charset string) string {
+	if charset == "" || strings.EqualFold(charset, "utf-8") {
+		return s
+	}
+	if d, err := decode(s, charset); err == nil {
+		return d
+	}
+	return s
+}
+
+// Parses a request made by a Mailgun route forwarding to a URL, in either
+// its parsed form or, if the URL ends in "mime", its raw form (with the whole
+// message in the "body-mime" field).
+//
+// The request's signature is not checked; VerifyMailgunSignature() does
+// that.
+func ParseMailgunInbound(r *http.Request) (*InboundMessage, error) {
+	if err := r.ParseMultipartForm(maxWebhookMemory); err != nil &&
+		err != http.ErrNotMultipart {
+		return nil, err
+	}
+	env := Envelope{
+		Provider: "mailgun",
+		From:     r.FormValue("sender"),
+		Received: time.Now(),
+	}
+	for _, to := range strings.Split(r.FormValue("recipient"), ",") {
+		if to = strings.TrimSpace(to); to != "" {
+			env.To = append(env.To, to)
+		}
+	}
+	if ts, err := strconv.ParseInt(r.FormValue("timestamp"), 10, 64); err == nil {
+		env.Received = time.Unix(ts, 0)
+	}
+
+	if raw := r.FormValue("body-mime"); raw != "" {
+		return ReadInboundMessage(raw, env)
+	}
+
+	src := &Header{mode: RFC5322Header}
+	var pairs [][]string
+	if s := r.FormValue("message-headers"); s != "" {
+		if err := json.Unmarshal([]byte(s), &pairs); err != nil {
+			return nil, errors.New("mail: bad Mailgun message-headers: " + err.Error())
+		}
+	}
+	for _, p := range pairs {
+		if len(p) == 2 {
+			src.Add(p[0], p[1])
+		}
+	}
+	env.ID = strings.Trim(src.Get(MessageIDFieldName), "<>")
+
+	cids := map[string]string{}
+	if s := r.FormValue("content-id-map"); s != "" {
+		json.Unmarshal([]byte(s), &cids)
+	}
+	n, _ := strconv.Atoi(r.FormValue("attachment-count"))
+	attachments := []*Attachment{}
+	for i := 1; i <= n; i++ {
+		name := "attachment-" + strconv.Itoa(i)
+		a, err := formFile(r, name)
+		if err != nil {
+			return nil, err
+		}
+		if a == nil {
+			continue
+		}
+		for cid, field := range cids {
+			if field == name {
+				a.ContentID = strings.Trim(cid, "<>")
+				a.Inline = true
+			}
+		}
+		attachments = append(attachments, a)
+	}
+
+	m, err := inboundMessage(src, r.FormValue("body-plain"), r.FormValue("body-html"), attachments)
+	if err != nil {
+		return nil, err
+	}
+	return &InboundMessage{Message: m, Envelope: env}, nil
+}
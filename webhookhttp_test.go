@@ -0,0 +1,44 @@
+//go:build !tinygo && !mailcore
+// +build !tinygo,!mailcore
+
+package mail_test
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/jimexcel/mail"
+)
+
+func TestSendGridInbound(t *testing.T) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	w.WriteField("headers", "From: Alice <alice@example.com>\nTo: inbox@example.net\n"+
+		"Subject: Webhook\nMessage-ID: <1@example.com>\n"+
+		"Content-Type: multipart/mixed; boundary=x\n")
+	w.WriteField("text", "Hello\n")
+	w.WriteField("envelope", `{"to":["inbox@example.net"],"from":"bounce@example.com"}`)
+	w.WriteField("SPF", "Pass")
+	w.WriteField("attachments", "1")
+	w.WriteField("attachment-info", `{"attachment1":{"filename":"a.txt","type":"text/plain"}}`)
+	fw, _ := w.CreateFormFile("attachment1", "a.txt")
+	fw.Write([]byte("attached\r\n"))
+	w.Close()
+	r := httptest.NewRequest("POST", "/inbound", &body)
+	r.Header.Set("Content-Type", w.FormDataContentType())
+
+	in, err := mail.ParseSendGridInbound(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStringEquals(t, "sendgrid from", in.Envelope.From, "bounce@example.com")
+	testStringEquals(t, "sendgrid spf", in.Envelope.Verdicts["spf"], "pass")
+	testStringEquals(t, "sendgrid subject", in.Message.Header.Subject(), "Webhook")
+	testStringEquals(t, "sendgrid message-id", in.Message.Header.MessageID(), "<1@example.com>")
+	testStringEquals(t, "sendgrid type", in.Message.Header.ContentType().Subtype, "mixed")
+	testIntegerEquals(t, "sendgrid parts", len(in.Message.Parts), 2)
+	testStringEquals(t, "sendgrid text", in.Message.Parts[0].Text, "Hello\r\n")
+	testStringEquals(t, "sendgrid attachment", in.Message.Parts[1].Text, "attached\r\n")
+}